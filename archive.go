@@ -0,0 +1,176 @@
+package tcglog
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// archiveVersion is the version of the archive format written by ArchiveWriter.
+const archiveVersion = 1
+
+type archiveDigest struct {
+	Algorithm AlgorithmId `json:"alg"`
+	Ref       int         `json:"ref"`
+}
+
+type archiveEvent struct {
+	PCRIndex  PCRIndex        `json:"pcr"`
+	EventType EventType       `json:"type"`
+	Digests   []archiveDigest `json:"digests"`
+	Data      int             `json:"data"`
+}
+
+type archiveLog struct {
+	Name   string          `json:"name"`
+	Events []*archiveEvent `json:"events"`
+}
+
+type archive struct {
+	Version  int           `json:"version"`
+	Payloads [][]byte      `json:"payloads"`
+	Logs     []*archiveLog `json:"logs"`
+}
+
+// ArchivedLog is a log read from an archive written by ArchiveWriter.
+type ArchivedLog struct {
+	Name   string
+	Events []*Event
+}
+
+// ArchiveWriter builds an archive of many event logs, such as the logs collected from a fleet of machines. Logs
+// from similar machines contain a lot of identical event data and digests (eg, the measurements of the UEFI
+// signature databases and of the same boot components), so each unique payload is only stored once in the archive
+// and events refer to it. The archive is written as gzip compressed JSON and can be read back with ReadArchive.
+//
+// An ArchiveWriter only retains the unique payloads and not the supplied events.
+type ArchiveWriter struct {
+	payloads  [][]byte
+	refs      map[string]int
+	logs      []*archiveLog
+	names     map[string]bool
+	totalSize int64
+}
+
+// NewArchiveWriter returns a new ArchiveWriter with no logs.
+func NewArchiveWriter() *ArchiveWriter {
+	return &ArchiveWriter{refs: make(map[string]int), names: make(map[string]bool)}
+}
+
+func (w *ArchiveWriter) addPayload(data []byte) int {
+	w.totalSize += int64(len(data))
+	if ref, ok := w.refs[string(data)]; ok {
+		return ref
+	}
+	ref := len(w.payloads)
+	w.payloads = append(w.payloads, append([]byte{}, data...))
+	w.refs[string(data)] = ref
+	return ref
+}
+
+// AddLog adds the supplied events to the archive as a log with the specified name, which must be unique within the
+// archive (eg, a machine identifier).
+func (w *ArchiveWriter) AddLog(name string, events []*Event) error {
+	if w.names[name] {
+		return fmt.Errorf("archive already contains a log named \"%s\"", name)
+	}
+	w.names[name] = true
+
+	log := &archiveLog{Name: name, Events: make([]*archiveEvent, 0, len(events))}
+	for _, e := range events {
+		ae := &archiveEvent{
+			PCRIndex:  e.PCRIndex,
+			EventType: e.EventType,
+			Digests:   make([]archiveDigest, 0, len(e.RawDigests)),
+			Data:      w.addPayload(celEventData(e))}
+		for _, d := range e.RawDigests {
+			ae.Digests = append(ae.Digests, archiveDigest{Algorithm: d.Algorithm, Ref: w.addPayload(d.Digest)})
+		}
+		log.Events = append(log.Events, ae)
+	}
+	w.logs = append(w.logs, log)
+	return nil
+}
+
+// PayloadSizes returns the combined size of the event data and digests of all of the logs added to the archive, and
+// the combined size of the unique payloads that are actually stored.
+func (w *ArchiveWriter) PayloadSizes() (total, unique int64) {
+	for _, p := range w.payloads {
+		unique += int64(len(p))
+	}
+	return w.totalSize, unique
+}
+
+// Write writes the archive to dst.
+func (w *ArchiveWriter) Write(dst io.Writer) error {
+	a := archive{Version: archiveVersion, Payloads: w.payloads, Logs: w.logs}
+	if a.Payloads == nil {
+		a.Payloads = [][]byte{}
+	}
+	if a.Logs == nil {
+		a.Logs = []*archiveLog{}
+	}
+
+	zw := gzip.NewWriter(dst)
+	if err := json.NewEncoder(zw).Encode(&a); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ReadArchive reads all of the logs from an archive written by ArchiveWriter, in the order in which they were added.
+// The events are decoded in the same way as Log. Events with identical event data or digests share storage,
+// including events from different logs.
+func ReadArchive(r io.Reader, options LogOptions) ([]*ArchivedLog, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress archive: %v", err)
+	}
+	defer zr.Close()
+
+	var a archive
+	if err := json.NewDecoder(zr).Decode(&a); err != nil {
+		return nil, fmt.Errorf("cannot decode archive: %v", err)
+	}
+	if a.Version != archiveVersion {
+		return nil, fmt.Errorf("unsupported archive version (%d)", a.Version)
+	}
+
+	payload := func(ref int) ([]byte, error) {
+		if ref < 0 || ref >= len(a.Payloads) {
+			return nil, fmt.Errorf("invalid payload reference (%d)", ref)
+		}
+		return a.Payloads[ref], nil
+	}
+
+	var out []*ArchivedLog
+	for i, l := range a.Logs {
+		if l == nil {
+			return nil, fmt.Errorf("cannot decode log %d: missing log", i)
+		}
+		b := &celEventBuilder{options: options, indexTracker: make(map[PCRIndex]uint)}
+		for j, e := range l.Events {
+			if e == nil {
+				return nil, fmt.Errorf("cannot decode event %d of log \"%s\": missing event", j, l.Name)
+			}
+			data, err := payload(e.Data)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decode event %d of log \"%s\": %v", j, l.Name, err)
+			}
+			var digests TaggedDigestList
+			for _, d := range e.Digests {
+				digest, err := payload(d.Ref)
+				if err != nil {
+					return nil, fmt.Errorf("cannot decode event %d of log \"%s\": %v", j, l.Name, err)
+				}
+				digests = append(digests, TaggedDigest{Algorithm: d.Algorithm, Digest: Digest(digest)})
+			}
+			if err := b.addEvent(uint32(e.PCRIndex), digests, e.EventType, data); err != nil {
+				return nil, fmt.Errorf("cannot decode event %d of log \"%s\": %v", j, l.Name, err)
+			}
+		}
+		out = append(out, &ArchivedLog{Name: l.Name, Events: b.events})
+	}
+	return out, nil
+}
@@ -0,0 +1,96 @@
+package tcglog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+	db := makeTestVariableEventData(convertStringToUtf16("db"))
+
+	var logs [][]*Event
+	for _, action := range []string{"foo", "bar"} {
+		logs = append(logs, readAllTestLogEvents(t, makeTestLog_2(algs, []testLogEvent{
+			makeTestLogEvent(7, EventTypeEFIVariableDriverConfig, db, algs...),
+			makeTestLogEvent(4, EventTypeEFIAction, []byte(action), algs...),
+			makeTestLogEvent(7, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...),
+			makeTestLogEvent(4, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...)}), LogOptions{}))
+	}
+
+	w := NewArchiveWriter()
+	for i, events := range logs {
+		if err := w.AddLog([]string{"host1", "host2"}[i], events); err != nil {
+			t.Fatalf("AddLog failed: %v", err)
+		}
+	}
+	if err := w.AddLog("host1", logs[0]); err == nil {
+		t.Errorf("AddLog should fail with a duplicate name")
+	}
+
+	total, unique := w.PayloadSizes()
+	if unique >= total/2 {
+		t.Errorf("Unexpected payload sizes (total: %d, unique: %d)", total, unique)
+	}
+
+	var buf bytes.Buffer
+	if err := w.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	archived, err := ReadArchive(&buf, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReadArchive failed: %v", err)
+	}
+	if len(archived) != 2 {
+		t.Fatalf("Unexpected number of logs: %d", len(archived))
+	}
+	for i, l := range archived {
+		if l.Name != []string{"host1", "host2"}[i] {
+			t.Errorf("Unexpected name for log %d: %s", i, l.Name)
+		}
+		if len(l.Events) != len(logs[i]) {
+			t.Fatalf("Unexpected number of events in log %d: %d", i, len(l.Events))
+		}
+		for j, e := range l.Events {
+			orig := logs[i][j]
+			if e.Index != orig.Index || e.PCRIndex != orig.PCRIndex || e.EventType != orig.EventType {
+				t.Errorf("Unexpected header for event %d of log %d", j, i)
+			}
+			if !reflect.DeepEqual(e.RawDigests, orig.RawDigests) {
+				t.Errorf("Unexpected digests for event %d of log %d", j, i)
+			}
+			if !bytes.Equal(e.Data().Bytes(), orig.Data().Bytes()) || reflect.TypeOf(e.Data()) != reflect.TypeOf(orig.Data()) {
+				t.Errorf("Unexpected data for event %d of log %d", j, i)
+			}
+		}
+	}
+}
+
+func TestReadArchiveInvalid(t *testing.T) {
+	for _, data := range []struct {
+		desc string
+		json string
+	}{
+		{desc: "Version", json: `{"version":2,"payloads":[],"logs":[]}`},
+		{desc: "DataRef", json: `{"version":1,"payloads":[],"logs":[{"name":"a","events":[{"pcr":0,"type":"EV_ACTION","digests":[],"data":0}]}]}`},
+		{desc: "DigestRef", json: `{"version":1,"payloads":[""],"logs":[{"name":"a","events":[{"pcr":0,"type":"EV_ACTION","digests":[{"alg":"sha1","ref":-1}],"data":0}]}]}`},
+		{desc: "PCR", json: `{"version":1,"payloads":[""],"logs":[{"name":"a","events":[{"pcr":32,"type":"EV_ACTION","digests":[],"data":0}]}]}`},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write([]byte(data.json))
+			zw.Close()
+			if _, err := ReadArchive(&buf, LogOptions{}); err == nil {
+				t.Errorf("ReadArchive should fail")
+			}
+		})
+	}
+
+	if _, err := ReadArchive(bytes.NewReader([]byte("{}")), LogOptions{}); err == nil {
+		t.Errorf("ReadArchive should fail with uncompressed data")
+	}
+}
@@ -0,0 +1,140 @@
+package tcglog
+
+import (
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// derElement is a single ASN.1 element decoded by readDERElement.
+type derElement struct {
+	class       int
+	tag         int
+	constructed bool
+	raw         []byte // The whole element, including the identifier and length
+	content     []byte
+}
+
+// readDERElement reads the first ASN.1 element from data, and returns it with the data that follows it. It is more
+// tolerant than encoding/asn1 and crypto/x509, as it accepts non-minimal length encodings. Indefinite lengths aren't
+// supported.
+func readDERElement(data []byte) (*derElement, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errors.New("truncated element")
+	}
+	e := &derElement{class: int(data[0] >> 6), tag: int(data[0] & 0x1f), constructed: data[0]&0x20 != 0}
+	offset := 1
+	if e.tag == 0x1f {
+		// High tag number form.
+		e.tag = 0
+		for {
+			if offset >= len(data) || offset > 4 {
+				return nil, nil, errors.New("invalid tag")
+			}
+			b := data[offset]
+			offset++
+			e.tag = e.tag<<7 | int(b&0x7f)
+			if b&0x80 == 0 {
+				break
+			}
+		}
+	}
+
+	if offset >= len(data) {
+		return nil, nil, errors.New("truncated element")
+	}
+	length := int(data[offset])
+	offset++
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 {
+			return nil, nil, errors.New("indefinite length is not supported")
+		}
+		if n > 4 || offset+n > len(data) {
+			return nil, nil, errors.New("invalid length")
+		}
+		length = 0
+		for _, b := range data[offset : offset+n] {
+			length = length<<8 | int(b)
+		}
+		offset += n
+	}
+	if length > len(data)-offset {
+		return nil, nil, errors.New("truncated element")
+	}
+
+	e.raw = data[:offset+length]
+	e.content = data[offset : offset+length]
+	return e, data[offset+length:], nil
+}
+
+// readDERSequence reads the first element from data, checking that it is a SEQUENCE.
+func readDERSequence(data []byte) (*derElement, []byte, error) {
+	e, rest, err := readDERElement(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if e.class != asn1.ClassUniversal || e.tag != asn1.TagSequence || !e.constructed {
+		return nil, nil, fmt.Errorf("unexpected tag %d (class %d), expected a SEQUENCE", e.tag, e.class)
+	}
+	return e, rest, nil
+}
+
+// decodeTolerantASN1String decodes the supplied string element. Strings with characters that aren't permitted by their
+// type are accepted, and invalid UTF-8 is replaced. Elements that aren't strings are formatted as a hex encoded DER
+// value, as described in RFC 4514.
+func decodeTolerantASN1String(e *derElement) string {
+	if e.class != asn1.ClassUniversal || e.constructed {
+		return fmt.Sprintf("#%x", e.raw)
+	}
+	switch e.tag {
+	case asn1.TagUTF8String, asn1.TagPrintableString, asn1.TagIA5String, asn1.TagT61String, asn1.TagNumericString,
+		26: // VisibleString
+		return strings.ToValidUTF8(string(e.content), string(utf8.RuneError))
+	case asn1.TagBMPString:
+		var u []uint16
+		for i := 0; i+1 < len(e.content); i += 2 {
+			u = append(u, binary.BigEndian.Uint16(e.content[i:]))
+		}
+		return string(utf16.Decode(u))
+	case 28: // UniversalString
+		var out []rune
+		for i := 0; i+3 < len(e.content); i += 4 {
+			out = append(out, rune(binary.BigEndian.Uint32(e.content[i:])))
+		}
+		return strings.ToValidUTF8(string(out), string(utf8.RuneError))
+	default:
+		return fmt.Sprintf("#%x", e.raw)
+	}
+}
+
+// decodeTolerantASN1Time decodes the supplied UTCTime or GeneralizedTime element. Encodings that aren't permitted by
+// DER, such as omitting the seconds or using a time zone offset, are accepted.
+func decodeTolerantASN1Time(e *derElement) (time.Time, error) {
+	var layouts []string
+	switch e.tag {
+	case asn1.TagUTCTime:
+		layouts = []string{"060102150405Z0700", "0601021504Z0700"}
+	case asn1.TagGeneralizedTime:
+		layouts = []string{"20060102150405Z0700", "20060102150405.999999999Z0700", "200601021504Z0700"}
+	default:
+		return time.Time{}, fmt.Errorf("unexpected tag %d, expected a time", e.tag)
+	}
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, string(e.content))
+		if err != nil {
+			continue
+		}
+		if e.tag == asn1.TagUTCTime && t.Year() >= 2050 {
+			// RFC 5280 section 4.1.2.5.1
+			t = t.AddDate(-100, 0, 0)
+		}
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", e.content)
+}
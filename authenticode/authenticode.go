@@ -0,0 +1,261 @@
+// Package authenticode computes the Authenticode digest of PE/COFF images, which is the digest that UEFI firmware
+// measures to the TPM for EV_EFI_BOOT_SERVICES_APPLICATION, EV_EFI_BOOT_SERVICES_DRIVER and
+// EV_EFI_RUNTIME_SERVICES_DRIVER events. Together with tcglog.VerifyImageLoadEvent and tcglog.ESPContentResolver, it
+// can be used to check that the images recorded in a log are the ones installed on the EFI system partition.
+//
+// See https://download.microsoft.com/download/9/c/5/9c5b2167-8017-4bae-9fde-d599bac8184a/Authenticode_PE.docx
+// (section "Calculating the PE Image Hash").
+package authenticode
+
+import (
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+const (
+	peSignatureSize          = 4
+	coffHeaderSize           = 20
+	sectionHeaderSize        = 40
+	dataDirectoryEntrySize   = 8
+	certTableDataDirectory   = 4
+	optionalHeaderMagicPE32  = 0x10b
+	optionalHeaderMagicPE32P = 0x20b
+)
+
+type sectionHeader struct {
+	sizeOfRawData    uint32
+	pointerToRawData uint32
+}
+
+// imageLayout describes the parts of a PE/COFF image that are relevant to the Authenticode digest.
+type imageLayout struct {
+	checksumOffset  int64 // The file offset of the CheckSum field of the optional header
+	certEntryOffset int64 // The file offset of the certificate table data directory entry, or 0 if there isn't one
+	sizeOfHeaders   int64
+	certTableOffset int64 // The file offset of the certificate table
+	certTableSize   int64
+	sections        []sectionHeader
+}
+
+func readUint16(r io.ReaderAt, off int64) (uint16, error) {
+	var b [2]byte
+	if _, err := r.ReadAt(b[:], off); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(b[:]), nil
+}
+
+func readUint32(r io.ReaderAt, off int64) (uint32, error) {
+	var b [4]byte
+	if _, err := r.ReadAt(b[:], off); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b[:]), nil
+}
+
+func readImageLayout(r io.ReaderAt, size int64) (*imageLayout, error) {
+	const peHeaderPointerOffset = 0x3c
+
+	if size < peHeaderPointerOffset+4 {
+		return nil, errors.New("image is too small")
+	}
+	if magic, err := readUint16(r, 0); err != nil {
+		return nil, err
+	} else if magic != 0x5a4d {
+		return nil, errors.New("image doesn't have a DOS header")
+	}
+
+	peOffset, err := readUint32(r, peHeaderPointerOffset)
+	if err != nil {
+		return nil, err
+	}
+	coffOffset := int64(peOffset) + peSignatureSize
+	optOffset := coffOffset + coffHeaderSize
+	if optOffset > size {
+		return nil, errors.New("invalid PE header offset")
+	}
+	if sig, err := readUint32(r, int64(peOffset)); err != nil {
+		return nil, err
+	} else if sig != 0x00004550 {
+		return nil, errors.New("image doesn't have a PE signature")
+	}
+
+	numberOfSections, err := readUint16(r, coffOffset+2)
+	if err != nil {
+		return nil, err
+	}
+	sizeOfOptionalHeader, err := readUint16(r, coffOffset+16)
+	if err != nil {
+		return nil, err
+	}
+
+	magic, err := readUint16(r, optOffset)
+	if err != nil {
+		return nil, err
+	}
+	var numberOfRvaAndSizesOffset int64
+	switch magic {
+	case optionalHeaderMagicPE32:
+		numberOfRvaAndSizesOffset = 92
+	case optionalHeaderMagicPE32P:
+		numberOfRvaAndSizesOffset = 108
+	default:
+		return nil, fmt.Errorf("unrecognized optional header magic (0x%04x)", magic)
+	}
+	if int64(sizeOfOptionalHeader) < numberOfRvaAndSizesOffset+4 {
+		return nil, errors.New("optional header is too small")
+	}
+
+	layout := &imageLayout{checksumOffset: optOffset + 64}
+
+	sizeOfHeaders, err := readUint32(r, optOffset+60)
+	if err != nil {
+		return nil, err
+	}
+	layout.sizeOfHeaders = int64(sizeOfHeaders)
+
+	numberOfRvaAndSizes, err := readUint32(r, optOffset+numberOfRvaAndSizesOffset)
+	if err != nil {
+		return nil, err
+	}
+	if numberOfRvaAndSizes > certTableDataDirectory {
+		layout.certEntryOffset = optOffset + numberOfRvaAndSizesOffset + 4 +
+			certTableDataDirectory*dataDirectoryEntrySize
+		if layout.certEntryOffset+dataDirectoryEntrySize > optOffset+int64(sizeOfOptionalHeader) {
+			return nil, errors.New("optional header is too small for the number of data directories")
+		}
+		certTableOffset, err := readUint32(r, layout.certEntryOffset)
+		if err != nil {
+			return nil, err
+		}
+		certTableSize, err := readUint32(r, layout.certEntryOffset+4)
+		if err != nil {
+			return nil, err
+		}
+		layout.certTableOffset = int64(certTableOffset)
+		layout.certTableSize = int64(certTableSize)
+		if layout.certTableSize > 0 && layout.certTableOffset+layout.certTableSize > size {
+			return nil, errors.New("certificate table extends beyond the end of the image")
+		}
+	}
+	if layout.sizeOfHeaders > size || layout.sizeOfHeaders < layout.checksumOffset+4 ||
+		layout.sizeOfHeaders < layout.certEntryOffset+dataDirectoryEntrySize {
+		return nil, fmt.Errorf("invalid SizeOfHeaders (%d)", layout.sizeOfHeaders)
+	}
+
+	sectionsOffset := optOffset + int64(sizeOfOptionalHeader)
+	for i := int64(0); i < int64(numberOfSections); i++ {
+		off := sectionsOffset + i*sectionHeaderSize
+		sizeOfRawData, err := readUint32(r, off+16)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read section header %d: %v", i, err)
+		}
+		pointerToRawData, err := readUint32(r, off+20)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read section header %d: %v", i, err)
+		}
+		if sizeOfRawData == 0 {
+			continue
+		}
+		if int64(pointerToRawData)+int64(sizeOfRawData) > size {
+			return nil, fmt.Errorf("section %d extends beyond the end of the image", i)
+		}
+		layout.sections = append(layout.sections,
+			sectionHeader{sizeOfRawData: sizeOfRawData, pointerToRawData: pointerToRawData})
+	}
+	sort.SliceStable(layout.sections, func(i, j int) bool {
+		return layout.sections[i].pointerToRawData < layout.sections[j].pointerToRawData
+	})
+
+	return layout, nil
+}
+
+// Digest computes the Authenticode digest of the PE/COFF image of the specified size read from r, using the specified
+// hash algorithm.
+func Digest(r io.ReaderAt, size int64, h crypto.Hash) ([]byte, error) {
+	if !h.Available() {
+		return nil, fmt.Errorf("hash algorithm %v is not available", h)
+	}
+
+	layout, err := readImageLayout(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode image: %v", err)
+	}
+
+	hasher := h.New()
+	hashRange := func(start, end int64) error {
+		if end <= start {
+			return nil
+		}
+		_, err := io.Copy(hasher, io.NewSectionReader(r, start, end-start))
+		return err
+	}
+
+	// Hash the headers, excluding the CheckSum field and the certificate table data directory entry.
+	if err := hashRange(0, layout.checksumOffset); err != nil {
+		return nil, err
+	}
+	if layout.certEntryOffset > 0 {
+		if err := hashRange(layout.checksumOffset+4, layout.certEntryOffset); err != nil {
+			return nil, err
+		}
+		if err := hashRange(layout.certEntryOffset+dataDirectoryEntrySize, layout.sizeOfHeaders); err != nil {
+			return nil, err
+		}
+	} else if err := hashRange(layout.checksumOffset+4, layout.sizeOfHeaders); err != nil {
+		return nil, err
+	}
+
+	// Hash the sections in the order that they appear in the file.
+	sumOfBytesHashed := layout.sizeOfHeaders
+	for _, s := range layout.sections {
+		start := int64(s.pointerToRawData)
+		if err := hashRange(start, start+int64(s.sizeOfRawData)); err != nil {
+			return nil, err
+		}
+		sumOfBytesHashed += int64(s.sizeOfRawData)
+	}
+
+	// Hash any data after the sections, excluding the certificate table.
+	if end := size - layout.certTableSize; end > sumOfBytesHashed {
+		if err := hashRange(sumOfBytesHashed, end); err != nil {
+			return nil, err
+		}
+	}
+
+	return hasher.Sum(nil), nil
+}
+
+func algorithmHash(alg tcglog.AlgorithmId) (crypto.Hash, bool) {
+	switch alg {
+	case tcglog.AlgorithmSha1:
+		return crypto.SHA1, true
+	case tcglog.AlgorithmSha256:
+		return crypto.SHA256, true
+	case tcglog.AlgorithmSha384:
+		return crypto.SHA384, true
+	case tcglog.AlgorithmSha512:
+		return crypto.SHA512, true
+	default:
+		return 0, false
+	}
+}
+
+// DigestImage computes the Authenticode digest of the PE/COFF image of the specified size read from r, using the
+// specified log digest algorithm. It has the signature of tcglog.ImageDigesterFunc.
+func DigestImage(r io.ReaderAt, size int64, alg tcglog.AlgorithmId) (tcglog.Digest, error) {
+	h, ok := algorithmHash(alg)
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	return Digest(r, size, h)
+}
+
+// ImageDigester is a tcglog.ImageDigester that computes Authenticode digests with DigestImage.
+var ImageDigester tcglog.ImageDigester = tcglog.ImageDigesterFunc(DigestImage)
@@ -0,0 +1,144 @@
+package authenticode
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+const (
+	testOptOffset       = 0x40 + peSignatureSize + coffHeaderSize
+	testChecksumOffset  = testOptOffset + 64
+	testCertEntryOffset = testOptOffset + 112 + certTableDataDirectory*dataDirectoryEntrySize
+	testCertTableOffset = 0x520
+	testImageSize       = 0x540
+)
+
+// makeTestImage creates a minimal PE32+ image with two sections whose headers aren't in file order, some data after
+// the sections and a certificate table.
+func makeTestImage() []byte {
+	image := make([]byte, testImageSize)
+	copy(image, "MZ")
+	binary.LittleEndian.PutUint32(image[0x3c:], 0x40)
+	copy(image[0x40:], "PE\x00\x00")
+
+	coff := image[0x40+peSignatureSize:]
+	binary.LittleEndian.PutUint16(coff[0:], 0x8664)
+	binary.LittleEndian.PutUint16(coff[2:], 2)
+	binary.LittleEndian.PutUint16(coff[16:], 240)
+
+	opt := image[testOptOffset:]
+	binary.LittleEndian.PutUint16(opt[0:], optionalHeaderMagicPE32P)
+	binary.LittleEndian.PutUint32(opt[60:], 0x200)
+	binary.LittleEndian.PutUint32(opt[64:], 0x12345678)
+	binary.LittleEndian.PutUint32(opt[108:], 16)
+	binary.LittleEndian.PutUint32(image[testCertEntryOffset:], testCertTableOffset)
+	binary.LittleEndian.PutUint32(image[testCertEntryOffset+4:], testImageSize-testCertTableOffset)
+
+	sections := image[testOptOffset+240:]
+	copy(sections[0:], ".data")
+	binary.LittleEndian.PutUint32(sections[16:], 0x100)
+	binary.LittleEndian.PutUint32(sections[20:], 0x400)
+	copy(sections[40:], ".text")
+	binary.LittleEndian.PutUint32(sections[56:], 0x200)
+	binary.LittleEndian.PutUint32(sections[60:], 0x200)
+
+	for i := 0x200; i < testCertTableOffset; i++ {
+		image[i] = byte(i)
+	}
+	copy(image[testCertTableOffset:], "signature")
+	return image
+}
+
+func TestDigest(t *testing.T) {
+	image := makeTestImage()
+
+	h := crypto.SHA256.New()
+	h.Write(image[:testChecksumOffset])
+	h.Write(image[testChecksumOffset+4 : testCertEntryOffset])
+	h.Write(image[testCertEntryOffset+dataDirectoryEntrySize : testCertTableOffset])
+	expected := h.Sum(nil)
+
+	digest, err := Digest(bytes.NewReader(image), int64(len(image)), crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Digest failed: %v", err)
+	}
+	if !bytes.Equal(digest, expected) {
+		t.Errorf("Unexpected digest: %x", digest)
+	}
+
+	// The checksum, certificate table entry and certificate table aren't covered by the digest.
+	modified := makeTestImage()
+	binary.LittleEndian.PutUint32(modified[testChecksumOffset:], 0)
+	copy(modified[testCertTableOffset:], "different")
+	if digest2, err := Digest(bytes.NewReader(modified), int64(len(modified)), crypto.SHA256); err != nil {
+		t.Errorf("Digest failed: %v", err)
+	} else if !bytes.Equal(digest2, digest) {
+		t.Errorf("Digest shouldn't depend on the checksum or signature")
+	}
+
+	modified[0x300] ^= 0xff
+	if digest2, err := Digest(bytes.NewReader(modified), int64(len(modified)), crypto.SHA256); err != nil {
+		t.Errorf("Digest failed: %v", err)
+	} else if bytes.Equal(digest2, digest) {
+		t.Errorf("Digest should depend on the section data")
+	}
+}
+
+func TestDigestImage(t *testing.T) {
+	image := makeTestImage()
+	expected, err := Digest(bytes.NewReader(image), int64(len(image)), crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Digest failed: %v", err)
+	}
+
+	digest, err := ImageDigester.DigestImage(bytes.NewReader(image), int64(len(image)), tcglog.AlgorithmSha256)
+	if err != nil {
+		t.Fatalf("DigestImage failed: %v", err)
+	}
+	if !bytes.Equal(digest, expected) {
+		t.Errorf("Unexpected digest: %x", digest)
+	}
+
+	if _, err := DigestImage(bytes.NewReader(image), int64(len(image)), tcglog.AlgorithmId(0x0012)); err == nil {
+		t.Errorf("DigestImage should fail for an unsupported algorithm")
+	}
+}
+
+func TestDigestInvalidImage(t *testing.T) {
+	for _, data := range []struct {
+		desc   string
+		modify func(image []byte) []byte
+	}{
+		{
+			desc:   "NoDOSHeader",
+			modify: func(image []byte) []byte { image[0] = 0; return image },
+		},
+		{
+			desc:   "NoPESignature",
+			modify: func(image []byte) []byte { image[0x41] = 0; return image },
+		},
+		{
+			desc: "InvalidMagic",
+			modify: func(image []byte) []byte {
+				binary.LittleEndian.PutUint16(image[testOptOffset:], 0x107)
+				return image
+			},
+		},
+		{
+			desc:   "TruncatedSection",
+			modify: func(image []byte) []byte { return image[:0x480] },
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			image := data.modify(makeTestImage())
+			if _, err := Digest(bytes.NewReader(image), int64(len(image)), crypto.SHA256); err == nil {
+				t.Errorf("Digest should have failed")
+			}
+		})
+	}
+}
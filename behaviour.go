@@ -0,0 +1,120 @@
+package tcglog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PlatformBehaviour records behaviours of a platform's firmware that were discovered when validating its log, so that
+// they can be persisted and reused without having to derive them from a complete log each time. The only behaviour
+// that is currently discovered is how EV_EFI_VARIABLE_BOOT events are measured. Other differences between firmware
+// implementations, such as the value of EV_SEPARATOR events or whether EV_EFI_VARIABLE_AUTHORITY events are measured
+// more than once, aren't recorded.
+//
+// A saved behaviour is only a starting point. If it isn't consistent with a log (eg, because the firmware has been
+// updated), validation falls back to the other variant.
+type PlatformBehaviour struct {
+	// EFIBootVariableBehaviour indicates whether EV_EFI_VARIABLE_BOOT events measure the entire UEFI_VARIABLE_DATA
+	// structure or only the variable data.
+	EFIBootVariableBehaviour EFIBootVariableBehaviour `json:"efiBootVariableBehaviour"`
+}
+
+// PlatformBehaviour returns the behaviours that were discovered during validation.
+func (r *LogValidateResult) PlatformBehaviour() *PlatformBehaviour {
+	return &PlatformBehaviour{EFIBootVariableBehaviour: r.EfiBootVariableBehaviour}
+}
+
+// BehaviourStore is implemented by types that can persist discovered platform behaviours, keyed by an identifier for
+// the machine (eg, the SMBIOS system UUID or /etc/machine-id).
+type BehaviourStore interface {
+	// Load returns the previously saved behaviours for the specified machine, or nil if there aren't any.
+	Load(machineID string) (*PlatformBehaviour, error)
+
+	// Save persists the behaviours for the specified machine.
+	Save(machineID string, behaviour *PlatformBehaviour) error
+}
+
+// DirBehaviourStore is a BehaviourStore that saves the behaviours for each machine to a JSON file in a directory.
+type DirBehaviourStore struct {
+	Dir string
+}
+
+func (s *DirBehaviourStore) path(machineID string) (string, error) {
+	if machineID == "" || strings.ContainsAny(machineID, "/\\") || machineID == "." || machineID == ".." {
+		return "", fmt.Errorf("invalid machine ID \"%s\"", machineID)
+	}
+	return filepath.Join(s.Dir, machineID+".json"), nil
+}
+
+func (s *DirBehaviourStore) Load(machineID string) (*PlatformBehaviour, error) {
+	path, err := s.path(machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var behaviour PlatformBehaviour
+	if err := json.Unmarshal(data, &behaviour); err != nil {
+		return nil, fmt.Errorf("cannot decode behaviours for machine %s: %v", machineID, err)
+	}
+	return &behaviour, nil
+}
+
+func (s *DirBehaviourStore) Save(machineID string, behaviour *PlatformBehaviour) error {
+	path, err := s.path(machineID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(behaviour)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReplayAndValidateLogWithBehaviourStore is like ReplayAndValidateLog, but uses the behaviours previously saved to
+// store for the specified machine as the starting point for validation, and then saves the behaviours from the result
+// back to store (see PlatformBehaviour).
+func ReplayAndValidateLogWithBehaviourStore(logPath string, options LogOptions, store BehaviourStore,
+	machineID string) (*LogValidateResult, error) {
+	return ReplayAndValidateLogWithBehaviourStoreContext(context.Background(), logPath, options, store, machineID)
+}
+
+// ReplayAndValidateLogWithBehaviourStoreContext is like ReplayAndValidateLogWithBehaviourStore, but stops and returns
+// the error from ctx if it is cancelled or its deadline expires before all of the events have been processed. The
+// behaviours aren't saved in this case.
+func ReplayAndValidateLogWithBehaviourStoreContext(ctx context.Context, logPath string, options LogOptions,
+	store BehaviourStore, machineID string) (*LogValidateResult, error) {
+	behaviour, err := store.Load(machineID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load platform behaviours: %v", err)
+	}
+
+	result, err := replayAndValidateLogImpl(ctx, logPath, "", options, behaviour)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.Save(machineID, result.PlatformBehaviour()); err != nil {
+		return nil, fmt.Errorf("cannot save platform behaviours: %v", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,105 @@
+package tcglog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirBehaviourStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-behaviour")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := &DirBehaviourStore{Dir: dir}
+
+	b, err := store.Load("machine1")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if b != nil {
+		t.Errorf("Load returned behaviours for an unknown machine")
+	}
+
+	if err := store.Save("machine1", &PlatformBehaviour{EFIBootVariableBehaviour: EFIBootVariableBehaviourVarDataOnly}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	b, err = store.Load("machine1")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if b == nil || b.EFIBootVariableBehaviour != EFIBootVariableBehaviourVarDataOnly {
+		t.Errorf("Load returned unexpected behaviours: %v", b)
+	}
+
+	if _, err := store.Load("../machine1"); err == nil {
+		t.Errorf("Load should fail for an invalid machine ID")
+	}
+}
+
+func TestReplayAndValidateLogWithBehaviourStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-behaviour")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	algs := []AlgorithmId{AlgorithmSha256}
+	payload := []byte{1, 0}
+	makeLog := func(behaviour EFIBootVariableBehaviour) []byte {
+		e := makeTestLogEvent(1, EventTypeEFIVariableBoot,
+			makeTestEFIVariableEventData(efiGlobalVariableGUID, "BootOrder", payload), algs...)
+		if behaviour == EFIBootVariableBehaviourVarDataOnly {
+			e.digests = []testLogDigest{{alg: AlgorithmSha256, digest: AlgorithmSha256.hash(payload)}}
+		}
+		return makeTestLog_2(algs, []testLogEvent{e})
+	}
+
+	for _, data := range []struct {
+		desc   string
+		stored EFIBootVariableBehaviour
+		actual EFIBootVariableBehaviour
+	}{
+		{desc: "NoneFull", stored: EFIBootVariableBehaviourUnknown, actual: EFIBootVariableBehaviourFull},
+		{desc: "NoneVarDataOnly", stored: EFIBootVariableBehaviourUnknown, actual: EFIBootVariableBehaviourVarDataOnly},
+		{desc: "Consistent", stored: EFIBootVariableBehaviourVarDataOnly, actual: EFIBootVariableBehaviourVarDataOnly},
+		{desc: "StoredFull", stored: EFIBootVariableBehaviourFull, actual: EFIBootVariableBehaviourVarDataOnly},
+		{desc: "StoredVarDataOnly", stored: EFIBootVariableBehaviourVarDataOnly, actual: EFIBootVariableBehaviourFull},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			store := &DirBehaviourStore{Dir: dir}
+			if err := store.Save(data.desc, &PlatformBehaviour{EFIBootVariableBehaviour: data.stored}); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+			logPath := filepath.Join(dir, "log")
+			if err := ioutil.WriteFile(logPath, makeLog(data.actual), 0644); err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+
+			result, err := ReplayAndValidateLogWithBehaviourStore(logPath, LogOptions{}, store, data.desc)
+			if err != nil {
+				t.Fatalf("ReplayAndValidateLogWithBehaviourStore failed: %v", err)
+			}
+			if result.EfiBootVariableBehaviour != data.actual {
+				t.Errorf("Unexpected behaviour: %v", result.EfiBootVariableBehaviour)
+			}
+			for _, e := range result.ValidatedEvents {
+				if len(e.IncorrectDigestValues) > 0 {
+					t.Errorf("Unexpected incorrect digests for event %d", e.Event.Index)
+				}
+			}
+
+			b, err := store.Load(data.desc)
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if b.EFIBootVariableBehaviour != data.actual {
+				t.Errorf("Unexpected saved behaviour: %v", b.EFIBootVariableBehaviour)
+			}
+		})
+	}
+}
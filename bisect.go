@@ -0,0 +1,70 @@
+package tcglog
+
+import (
+	"bytes"
+)
+
+// PCRHistory returns the expected values of the specified PCR for the specified algorithm after each event in the
+// main log that extends it, in log order. Saving the history of a known-good boot makes it possible to find where a
+// later boot diverges from it with BisectPCRDivergence, even when the event logs themselves are no longer available.
+func (r *LogValidateResult) PCRHistory(pcr PCRIndex, alg AlgorithmId) []Digest {
+	var out []Digest
+	for _, e := range r.ValidatedEvents {
+		if e.Event.PCRIndex != pcr || !doesEventTypeExtendPCR(e.Event.EventType) {
+			continue
+		}
+		out = append(out, e.PCRValueAfter[alg])
+	}
+	return out
+}
+
+// PCRDivergence is the result of BisectPCRDivergence.
+type PCRDivergence struct {
+	PCR       PCRIndex
+	Algorithm AlgorithmId
+
+	// Matching is the number of events extending the PCR, starting from the beginning of the log, after which the
+	// PCR value matches the corresponding value from the reference history.
+	Matching int
+
+	// LastMatching is the last event after which the PCR value matches the reference history, or nil if the
+	// value after the first event extending the PCR already differs.
+	LastMatching *ValidatedEvent
+
+	// FirstDivergent is the earliest event after which the PCR value no longer matches the reference history. It is
+	// nil if every event extending the PCR matches, in which case the log is a prefix of the reference history (see
+	// Missing).
+	FirstDivergent *ValidatedEvent
+
+	// Missing is the number of values in the reference history after the last matching value that have no
+	// corresponding event in the log, if the log doesn't diverge.
+	Missing int
+}
+
+// Diverges indicates whether the PCR value computed from the log differs from the final value of the reference
+// history.
+func (d *PCRDivergence) Diverges() bool {
+	return d.FirstDivergent != nil || d.Missing > 0
+}
+
+// BisectPCRDivergence replays each prefix of the events in the main log that extend the specified PCR, and compares
+// the PCR value after each of them with the corresponding value from reference, which is the history of the same PCR
+// from a known-good boot (see PCRHistory). Because each PCR value depends on every value before it, the values only
+// match up to the first event that differs from the reference boot, so this identifies the earliest event that
+// explains why the PCR value is different rather than just reporting that it is.
+func (r *LogValidateResult) BisectPCRDivergence(pcr PCRIndex, alg AlgorithmId, reference []Digest) *PCRDivergence {
+	d := &PCRDivergence{PCR: pcr, Algorithm: alg}
+	for _, e := range r.ValidatedEvents {
+		if e.Event.PCRIndex != pcr || !doesEventTypeExtendPCR(e.Event.EventType) {
+			continue
+		}
+		if d.Matching >= len(reference) || !bytes.Equal(e.PCRValueAfter[alg], reference[d.Matching]) {
+			d.FirstDivergent = e
+			return d
+		}
+		d.LastMatching = e
+		d.Matching++
+	}
+	d.Missing = len(reference) - d.Matching
+	return d
+}
@@ -0,0 +1,85 @@
+package tcglog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func replayTestBisectLog(t *testing.T, data ...string) *LogValidateResult {
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	algs := []AlgorithmId{AlgorithmSha256}
+	events := []testLogEvent{makeTestLogEvent(0, EventTypeSCRTMVersion, []byte("version"), algs...)}
+	for _, d := range data {
+		events = append(events, makeTestLogEvent(4, EventTypeEFIAction, []byte(d), algs...))
+	}
+	logPath := filepath.Join(dir, "log")
+	if err := ioutil.WriteFile(logPath, makeTestLog_2(algs, events), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	result, err := ReplayAndValidateLog(logPath, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayAndValidateLog failed: %v", err)
+	}
+	return result
+}
+
+func TestPCRHistory(t *testing.T) {
+	result := replayTestBisectLog(t, "foo", "bar")
+
+	history := result.PCRHistory(4, AlgorithmSha256)
+	if len(history) != 2 {
+		t.Fatalf("Unexpected history length: %d", len(history))
+	}
+	if !bytes.Equal(history[1], result.ExpectedPCRValues[4][AlgorithmSha256]) {
+		t.Errorf("Unexpected final value in history: %x", history[1])
+	}
+	if len(result.PCRHistory(5, AlgorithmSha256)) != 0 {
+		t.Errorf("Unexpected history for PCR that isn't extended")
+	}
+}
+
+func TestBisectPCRDivergence(t *testing.T) {
+	reference := replayTestBisectLog(t, "foo", "bar", "baz").PCRHistory(4, AlgorithmSha256)
+
+	for _, data := range []struct {
+		desc           string
+		events         []string
+		matching       int
+		firstDivergent int // Index of the first divergent event in events, or -1
+		missing        int
+		diverges       bool
+	}{
+		{desc: "Identical", events: []string{"foo", "bar", "baz"}, matching: 3, firstDivergent: -1},
+		{desc: "Changed", events: []string{"foo", "qux", "baz"}, matching: 1, firstDivergent: 1, diverges: true},
+		{desc: "ChangedFirst", events: []string{"qux", "bar", "baz"}, firstDivergent: 0, diverges: true},
+		{desc: "Added", events: []string{"foo", "bar", "baz", "qux"}, matching: 3, firstDivergent: 3, diverges: true},
+		{desc: "Removed", events: []string{"foo", "bar"}, matching: 2, firstDivergent: -1, missing: 1, diverges: true},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			result := replayTestBisectLog(t, data.events...)
+			d := result.BisectPCRDivergence(4, AlgorithmSha256, reference)
+			if d.Matching != data.matching || d.Missing != data.missing || d.Diverges() != data.diverges {
+				t.Errorf("Unexpected divergence: %+v", d)
+			}
+			switch {
+			case data.firstDivergent < 0 && d.FirstDivergent != nil:
+				t.Errorf("Unexpected divergent event %d", d.FirstDivergent.Event.Index)
+			case data.firstDivergent >= 0 && (d.FirstDivergent == nil ||
+				d.FirstDivergent.Event.Index != uint(data.firstDivergent)):
+				t.Errorf("Unexpected divergent event: %+v", d.FirstDivergent)
+			}
+			if data.matching > 0 && (d.LastMatching == nil || d.LastMatching.Event.Index != uint(data.matching-1)) {
+				t.Errorf("Unexpected last matching event: %+v", d.LastMatching)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package tcglog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CapsuleUpdateKind describes how an event relates to a firmware update that was processed during boot, eg, from an
+// update capsule staged by the OS with UpdateCapsule or on the ESP.
+type CapsuleUpdateKind int
+
+const (
+	// CapsuleUpdateKindAction indicates an EV_ACTION or EV_EFI_ACTION event with a string that describes a capsule
+	// or firmware update. The strings aren't defined by the TCG, so these are detected heuristically.
+	CapsuleUpdateKindAction CapsuleUpdateKind = iota
+
+	// CapsuleUpdateKindBlobRemeasured indicates an EV_EFI_PLATFORM_FIRMWARE_BLOB or EV_EFI_PLATFORM_FIRMWARE_BLOB2
+	// event that measures a firmware blob that was already measured to the same PCR earlier in the boot, which is
+	// what happens when firmware volumes are measured again after an update has been applied.
+	CapsuleUpdateKindBlobRemeasured
+)
+
+func (k CapsuleUpdateKind) String() string {
+	switch k {
+	case CapsuleUpdateKindAction:
+		return "firmware update action"
+	case CapsuleUpdateKindBlobRemeasured:
+		return "firmware blob measured again"
+	default:
+		return fmt.Sprintf("CapsuleUpdateKind(%d)", int(k))
+	}
+}
+
+// CapsuleUpdateEvent describes an event that indicates that a firmware update was processed during the measured boot.
+// The update adds measurements to PCRs 0 and 2 (and sometimes others) that won't be repeated on the next boot, and
+// which change the values of these PCRs from those of a normal boot.
+type CapsuleUpdateEvent struct {
+	Kind  CapsuleUpdateKind
+	Event *Event
+
+	// Previous is the earlier event that measured the same firmware blob, for CapsuleUpdateKindBlobRemeasured.
+	Previous *Event
+
+	// Changed indicates that the firmware blob has different contents to when it was measured by Previous, for
+	// CapsuleUpdateKindBlobRemeasured.
+	Changed bool
+}
+
+func (e *CapsuleUpdateEvent) String() string {
+	s := fmt.Sprintf("%s (event %d in PCR %d, type: %s)", e.Kind, e.Event.Index, e.Event.PCRIndex, e.Event.EventType)
+	switch {
+	case e.Kind == CapsuleUpdateKindAction:
+		s += fmt.Sprintf(": %s", decodeErrorInfo(e.Event.Data().Bytes()))
+	case e.Changed:
+		s += fmt.Sprintf(", with different contents to event %d", e.Previous.Index)
+	default:
+		s += fmt.Sprintf(", with the same contents as event %d", e.Previous.Index)
+	}
+	return s
+}
+
+func isCapsuleUpdateString(s string) bool {
+	s = strings.ToLower(s)
+	return strings.Contains(s, "capsule") || strings.Contains(s, "firmware update") ||
+		strings.Contains(s, "flash update")
+}
+
+// firmwareBlobRegion returns the region of memory measured by the supplied EV_EFI_PLATFORM_FIRMWARE_BLOB or
+// EV_EFI_PLATFORM_FIRMWARE_BLOB2 event.
+func firmwareBlobRegion(e *Event) (base, length uint64, ok bool) {
+	switch d := e.Data().(type) {
+	case *EFIPlatformFirmwareBlobEventData:
+		return d.BlobBase, d.BlobLength, true
+	case *EFIPlatformFirmwareBlob2EventData:
+		return d.BlobBase, d.BlobLength, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// DetectCapsuleUpdates returns the events that indicate that a firmware update was processed during the measured
+// boot, in the order in which they appear in the log. These are action events with strings that describe a capsule or
+// firmware update, and firmware blobs in PCRs 0 and 2 that are measured more than once. The extra events are replayed
+// like any other event, so a log from a boot that processed an update is still consistent with the TPM, but the
+// values of the affected PCRs will be different on the next boot.
+func DetectCapsuleUpdates(events []*Event) []*CapsuleUpdateEvent {
+	type blobKey struct {
+		pcr    PCRIndex
+		base   uint64
+		length uint64
+	}
+
+	var out []*CapsuleUpdateEvent
+	blobs := make(map[blobKey]*Event)
+
+	for _, e := range events {
+		switch e.EventType {
+		case EventTypeAction, EventTypeEFIAction:
+			if e.Data() == nil {
+				continue
+			}
+			if isCapsuleUpdateString(decodeErrorInfo(e.Data().Bytes())) {
+				out = append(out, &CapsuleUpdateEvent{Kind: CapsuleUpdateKindAction, Event: e})
+			}
+		case EventTypeEFIPlatformFirmwareBlob, EventTypeEFIPlatformFirmwareBlob2:
+			if e.PCRIndex != 0 && e.PCRIndex != 2 {
+				continue
+			}
+			base, length, ok := firmwareBlobRegion(e)
+			if !ok {
+				continue
+			}
+			key := blobKey{pcr: e.PCRIndex, base: base, length: length}
+			if previous, exists := blobs[key]; exists {
+				out = append(out, &CapsuleUpdateEvent{Kind: CapsuleUpdateKindBlobRemeasured, Event: e,
+					Previous: previous, Changed: !eventDigestsEqual(previous, e)})
+			}
+			blobs[key] = e
+		}
+	}
+
+	return out
+}
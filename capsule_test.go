@@ -0,0 +1,100 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectCapsuleUpdates(t *testing.T) {
+	action := func(s string) *Event {
+		return &Event{PCRIndex: 2, EventType: EventTypeEFIAction, data: &asciiStringEventData{data: []byte(s)}}
+	}
+	blob := func(pcr PCRIndex, base uint64, contents string) *Event {
+		return &Event{PCRIndex: pcr, EventType: EventTypeEFIPlatformFirmwareBlob,
+			Digests: NewEventDigests(DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte(contents))}),
+			data:    &EFIPlatformFirmwareBlobEventData{BlobBase: base, BlobLength: 0x1000}}
+	}
+
+	events := []*Event{
+		blob(0, 0xff000000, "fv1"),
+		blob(0, 0xff100000, "fv2"),
+		blob(2, 0xff000000, "fv1"),
+		action("Calling EFI Application from Boot Option"),
+		action("Processing Capsule"),
+		blob(0, 0xff000000, "fv1-updated"),
+		blob(0, 0xff100000, "fv2"),
+	}
+
+	updates := DetectCapsuleUpdates(events)
+	if len(updates) != 3 {
+		t.Fatalf("Unexpected number of events: %d", len(updates))
+	}
+	for i, e := range []CapsuleUpdateEvent{
+		{Kind: CapsuleUpdateKindAction, Event: events[4]},
+		{Kind: CapsuleUpdateKindBlobRemeasured, Event: events[5], Previous: events[0], Changed: true},
+		{Kind: CapsuleUpdateKindBlobRemeasured, Event: events[6], Previous: events[1]},
+	} {
+		if *updates[i] != e {
+			t.Errorf("Unexpected event %d: %s", i, updates[i])
+		}
+	}
+}
+
+func TestReplayAndValidateLogCapsuleUpdate(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+	blob := func(base uint64, contents string) testLogEvent {
+		data := make([]byte, 16)
+		binary.LittleEndian.PutUint64(data, base)
+		binary.LittleEndian.PutUint64(data[8:], 0x1000)
+		e := makeTestLogEvent(0, EventTypeEFIPlatformFirmwareBlob, data, algs...)
+		e.digests[0].digest = AlgorithmSha256.hash([]byte(contents))
+		return e
+	}
+
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "log")
+	log := makeTestLog_2(algs, []testLogEvent{
+		blob(0xff000000, "fv1"),
+		makeTestLogEvent(0, EventTypeEFIAction, []byte("Capsule Update"), algs...),
+		blob(0xff000000, "fv1-updated"),
+		makeTestLogEvent(0, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...)})
+	if err := ioutil.WriteFile(logPath, log, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	result, err := ReplayAndValidateLog(logPath, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayAndValidateLog failed: %v", err)
+	}
+
+	expected := make(Digest, 32)
+	for _, d := range [][]byte{
+		AlgorithmSha256.hash([]byte("fv1")),
+		AlgorithmSha256.hash([]byte("Capsule Update")),
+		AlgorithmSha256.hash([]byte("fv1-updated")),
+		AlgorithmSha256.hash([]byte{0, 0, 0, 0}),
+	} {
+		expected = performHashExtendOperation(AlgorithmSha256, expected, d)
+	}
+	if !bytes.Equal(result.ExpectedPCRValues[0][AlgorithmSha256], expected) {
+		t.Errorf("Unexpected PCR 0 value: %x", result.ExpectedPCRValues[0][AlgorithmSha256])
+	}
+
+	var n int
+	for _, f := range FindingsFromResult(result, false) {
+		if f.Kind == FindingKindFirmwareUpdateDuringBoot {
+			n++
+		}
+	}
+	if n != 2 {
+		t.Errorf("Unexpected number of findings: %d", n)
+	}
+}
@@ -0,0 +1,230 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// cborMaxDepth limits the nesting of arrays and maps that decodeCBOR will accept.
+const cborMaxDepth = 32
+
+// decodeCBOR is a minimal CBOR (RFC 7049) decoder, sufficient for decoding CoSWID tags. Unsigned and negative integers
+// are returned as int64, byte strings as []byte, text strings as string, arrays as []interface{} and maps as
+// map[interface{}]interface{}. Tags are discarded and the tagged item is returned. Indefinite length items and floating
+// point values are not supported.
+func decodeCBOR(r io.Reader) (interface{}, error) {
+	return decodeCBORItem(r, 0)
+}
+
+func decodeCBORArgument(r io.Reader, info uint8) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		var v uint8
+		err := binary.Read(r, binary.BigEndian, &v)
+		return uint64(v), err
+	case info == 25:
+		var v uint16
+		err := binary.Read(r, binary.BigEndian, &v)
+		return uint64(v), err
+	case info == 26:
+		var v uint32
+		err := binary.Read(r, binary.BigEndian, &v)
+		return uint64(v), err
+	case info == 27:
+		var v uint64
+		err := binary.Read(r, binary.BigEndian, &v)
+		return v, err
+	default:
+		return 0, fmt.Errorf("unsupported additional information (%d)", info)
+	}
+}
+
+func decodeCBORItem(r io.Reader, depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, errors.New("maximum nesting depth exceeded")
+	}
+
+	var initial uint8
+	if err := binary.Read(r, binary.BigEndian, &initial); err != nil {
+		return nil, err
+	}
+	major := initial >> 5
+	arg, err := decodeCBORArgument(r, initial&0x1f)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, errors.New("integer overflow")
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, errors.New("integer overflow")
+		}
+		return -1 - int64(arg), nil
+	case 2, 3:
+		if arg > 1<<31 {
+			return nil, fmt.Errorf("invalid string length (%d)", arg)
+		}
+		// Read in to a buffer that grows as data arrives, so that a bogus length can't make us allocate a huge
+		// buffer up front.
+		var buf []byte
+		if _, err := io.CopyN(writerFunc(func(p []byte) (int, error) {
+			buf = append(buf, p...)
+			return len(p), nil
+		}), r, int64(arg)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if major == 3 {
+			return string(buf), nil
+		}
+		if buf == nil {
+			buf = []byte{}
+		}
+		return buf, nil
+	case 4:
+		var out []interface{}
+		for i := uint64(0); i < arg; i++ {
+			item, err := decodeCBORItem(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, item)
+		}
+		return out, nil
+	case 5:
+		out := make(map[interface{}]interface{})
+		for i := uint64(0); i < arg; i++ {
+			key, err := decodeCBORItem(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("unsupported map key type %T", key)
+			}
+			value, err := decodeCBORItem(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = value
+		}
+		return out, nil
+	case 6:
+		return decodeCBORItem(r, depth+1)
+	default:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("unsupported simple value (%d)", arg)
+		}
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func encodeCBORHead(buf *bytes.Buffer, major uint8, arg uint64) {
+	switch {
+	case arg < 24:
+		buf.WriteByte(major<<5 | uint8(arg))
+	case arg <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(uint8(arg))
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(arg))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(arg))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		binary.Write(buf, binary.BigEndian, arg)
+	}
+}
+
+// encodeCBOR is a minimal CBOR encoder, the counterpart to decodeCBOR. It supports the types that decodeCBOR returns,
+// as well as unsigned integer types. Map keys are encoded in sorted order if they are all integers.
+func encodeCBOR(buf *bytes.Buffer, v interface{}) error {
+	switch x := v.(type) {
+	case uint64:
+		encodeCBORHead(buf, 0, x)
+	case uint32:
+		encodeCBORHead(buf, 0, uint64(x))
+	case uint16:
+		encodeCBORHead(buf, 0, uint64(x))
+	case uint8:
+		encodeCBORHead(buf, 0, uint64(x))
+	case int64:
+		if x < 0 {
+			encodeCBORHead(buf, 1, uint64(-1-x))
+		} else {
+			encodeCBORHead(buf, 0, uint64(x))
+		}
+	case int:
+		return encodeCBOR(buf, int64(x))
+	case []byte:
+		encodeCBORHead(buf, 2, uint64(len(x)))
+		buf.Write(x)
+	case string:
+		encodeCBORHead(buf, 3, uint64(len(x)))
+		buf.WriteString(x)
+	case []interface{}:
+		encodeCBORHead(buf, 4, uint64(len(x)))
+		for _, i := range x {
+			if err := encodeCBOR(buf, i); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		var keys []int64
+		for k := range x {
+			i, ok := k.(int64)
+			if !ok {
+				return fmt.Errorf("unsupported map key type %T", k)
+			}
+			keys = append(keys, i)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		encodeCBORHead(buf, 5, uint64(len(keys)))
+		for _, k := range keys {
+			encodeCBOR(buf, k)
+			if err := encodeCBOR(buf, x[k]); err != nil {
+				return err
+			}
+		}
+	case bool:
+		if x {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case nil:
+		buf.WriteByte(0xf6)
+	default:
+		return fmt.Errorf("unsupported type %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// CELFormat specifies an encoding of the TCG Canonical Event Log.
+type CELFormat int
+
+const (
+	CELFormatTLV  CELFormat = iota // CEL-TLV
+	CELFormatJSON                  // CEL-JSON
+	CELFormatCBOR                  // CEL-CBOR
+)
+
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_IWG_CEL_v1_r0p41_pub.pdf
+//  (section 5 "CEL Data Model")
+const (
+	celTypeRecnum      = 0
+	celTypePCR         = 1
+	celTypeNVIndex     = 2
+	celTypeDigests     = 3
+	celTypePCClientStd = 5
+
+	celPCClientStdEventType = 0
+	celPCClientStdEventData = 1
+)
+
+func celAlgorithmName(alg AlgorithmId) string {
+	switch alg {
+	case AlgorithmSha1:
+		return "sha1"
+	case AlgorithmSha256:
+		return "sha256"
+	case AlgorithmSha384:
+		return "sha384"
+	case AlgorithmSha512:
+		return "sha512"
+	default:
+		return fmt.Sprintf("0x%04x", uint16(alg))
+	}
+}
+
+func celEventData(event *Event) []byte {
+	if event.Data() == nil {
+		return []byte{}
+	}
+	return event.Data().Bytes()
+}
+
+func writeCELTLV(buf *bytes.Buffer, t uint8, value []byte) {
+	buf.WriteByte(t)
+	binary.Write(buf, binary.BigEndian, uint32(len(value)))
+	buf.Write(value)
+}
+
+func encodeCELTLVRecord(recnum uint64, event *Event) []byte {
+	var buf bytes.Buffer
+
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], recnum)
+	writeCELTLV(&buf, celTypeRecnum, n[:])
+
+	binary.BigEndian.PutUint32(n[:], uint32(event.PCRIndex))
+	writeCELTLV(&buf, celTypePCR, n[:4])
+
+	var digests bytes.Buffer
+	for _, alg := range event.Digests.Algorithms() {
+		writeCELTLV(&digests, uint8(alg), event.Digests.Get(alg))
+	}
+	writeCELTLV(&buf, celTypeDigests, digests.Bytes())
+
+	var content bytes.Buffer
+	binary.BigEndian.PutUint32(n[:], uint32(event.EventType))
+	writeCELTLV(&content, celPCClientStdEventType, n[:4])
+	writeCELTLV(&content, celPCClientStdEventData, celEventData(event))
+	writeCELTLV(&buf, celTypePCClientStd, content.Bytes())
+
+	return buf.Bytes()
+}
+
+type celJSONDigest struct {
+	HashAlg string `json:"hashAlg"`
+	Digest  string `json:"digest"`
+}
+
+type celJSONPCClientStd struct {
+	EventType uint32 `json:"event_type"`
+	EventData string `json:"event_data"`
+}
+
+type celJSONRecord struct {
+	Recnum      uint64             `json:"recnum"`
+	PCR         uint32             `json:"pcr"`
+	Digests     []celJSONDigest    `json:"digests"`
+	ContentType string             `json:"content_type"`
+	Content     celJSONPCClientStd `json:"content"`
+}
+
+func makeCELJSONRecord(recnum uint64, event *Event) *celJSONRecord {
+	r := &celJSONRecord{
+		Recnum:      recnum,
+		PCR:         uint32(event.PCRIndex),
+		Digests:     []celJSONDigest{},
+		ContentType: "pcclient_std",
+		Content: celJSONPCClientStd{
+			EventType: uint32(event.EventType),
+			EventData: base64.StdEncoding.EncodeToString(celEventData(event))}}
+	for _, alg := range event.Digests.Algorithms() {
+		r.Digests = append(r.Digests, celJSONDigest{HashAlg: celAlgorithmName(alg),
+			Digest: hex.EncodeToString(event.Digests.Get(alg))})
+	}
+	return r
+}
+
+func makeCELCBORRecord(recnum uint64, event *Event) map[interface{}]interface{} {
+	var digests []interface{}
+	for _, alg := range event.Digests.Algorithms() {
+		digests = append(digests, []interface{}{uint64(alg), []byte(event.Digests.Get(alg))})
+	}
+	return map[interface{}]interface{}{
+		int64(celTypeRecnum):  recnum,
+		int64(celTypePCR):     uint64(event.PCRIndex),
+		int64(celTypeDigests): digests,
+		int64(celTypePCClientStd): map[interface{}]interface{}{
+			int64(celPCClientStdEventType): uint64(event.EventType),
+			int64(celPCClientStdEventData): celEventData(event)}}
+}
+
+// WriteCEL encodes the supplied events as a TCG Canonical Event Log in the specified format, using the pcclient_std
+// content type for each record. Records are numbered in the order in which the events are supplied. CEL-JSON and
+// CEL-CBOR logs are written as an array of records, and CEL-TLV logs as a sequence of records.
+//
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_IWG_CEL_v1_r0p41_pub.pdf
+func WriteCEL(w io.Writer, events []*Event, format CELFormat) error {
+	switch format {
+	case CELFormatTLV:
+		for i, e := range events {
+			if _, err := w.Write(encodeCELTLVRecord(uint64(i), e)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case CELFormatJSON:
+		records := []*celJSONRecord{}
+		for i, e := range events {
+			records = append(records, makeCELJSONRecord(uint64(i), e))
+		}
+		return json.NewEncoder(w).Encode(records)
+	case CELFormatCBOR:
+		var records []interface{}
+		for i, e := range events {
+			records = append(records, makeCELCBORRecord(uint64(i), e))
+		}
+		var buf bytes.Buffer
+		if err := encodeCBOR(&buf, records); err != nil {
+			return err
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	default:
+		return fmt.Errorf("invalid CEL format %d", format)
+	}
+}
+
+func celAlgorithmFromName(name string) (AlgorithmId, error) {
+	switch name {
+	case "sha1":
+		return AlgorithmSha1, nil
+	case "sha256":
+		return AlgorithmSha256, nil
+	case "sha384":
+		return AlgorithmSha384, nil
+	case "sha512":
+		return AlgorithmSha512, nil
+	}
+	var alg uint16
+	if _, err := fmt.Sscanf(name, "0x%04x", &alg); err != nil {
+		return 0, fmt.Errorf("unrecognized hash algorithm \"%s\"", name)
+	}
+	return AlgorithmId(alg), nil
+}
+
+// celEventBuilder accumulates the events decoded from CEL records, assigning each event an index in the same way
+// as Log.
+type celEventBuilder struct {
+	options      LogOptions
+	indexTracker map[PCRIndex]uint
+	events       []*Event
+}
+
+func (b *celEventBuilder) addEvent(pcr uint32, digests TaggedDigestList, eventType EventType, data []byte) error {
+	if !isPCRIndexInRange(PCRIndex(pcr)) {
+		return wrapPCRIndexOutOfRangeError(PCRIndex(pcr))
+	}
+
+	event := &Event{
+		Index:      b.indexTracker[PCRIndex(pcr)],
+		PCRIndex:   PCRIndex(pcr),
+		EventType:  eventType,
+		RawDigests: digests}
+	b.indexTracker[event.PCRIndex]++
+
+	var hasDigestOfSeparatorError bool
+	for i, d := range digests {
+		if !d.Algorithm.supported() {
+			continue
+		}
+		if len(d.Digest) != d.Algorithm.size() {
+			return fmt.Errorf("invalid %s digest length (%d)", d.Algorithm, len(d.Digest))
+		}
+		if i == 0 {
+			hasDigestOfSeparatorError = isDigestOfSeparatorErrorValue(d.Digest, d.Algorithm)
+		}
+		event.Digests.Set(d.Algorithm, d.Digest)
+	}
+
+	event.lazy = newLazyEventData(event.PCRIndex, eventType, data, &b.options, hasDigestOfSeparatorError)
+	b.events = append(b.events, event)
+	return nil
+}
+
+func readCELTLV(r *bytes.Reader) (uint8, []byte, error) {
+	t, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	if int64(length) > int64(r.Len()) {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	value := make([]byte, length)
+	r.Read(value)
+	return t, value, nil
+}
+
+func decodeCELTLVContent(value []byte) (EventType, []byte, error) {
+	var eventType EventType
+	var eventData []byte
+	var seenType, seenData bool
+
+	r := bytes.NewReader(value)
+	for r.Len() > 0 {
+		t, v, err := readCELTLV(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		switch t {
+		case celPCClientStdEventType:
+			if len(v) != 4 {
+				return 0, nil, fmt.Errorf("invalid event_type length (%d)", len(v))
+			}
+			eventType = EventType(binary.BigEndian.Uint32(v))
+			seenType = true
+		case celPCClientStdEventData:
+			eventData = v
+			seenData = true
+		default:
+			return 0, nil, fmt.Errorf("unexpected pcclient_std field type %d", t)
+		}
+	}
+
+	if !seenType || !seenData {
+		return 0, nil, errors.New("incomplete pcclient_std content")
+	}
+	return eventType, eventData, nil
+}
+
+func decodeCELTLVRecord(r *bytes.Reader, b *celEventBuilder) error {
+	var pcr uint32
+	var digests TaggedDigestList
+	var seenPCR, seenDigests bool
+
+	for {
+		t, v, err := readCELTLV(r)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		switch t {
+		case celTypeRecnum:
+			if seenPCR || seenDigests {
+				return errors.New("unexpected recnum field")
+			}
+		case celTypePCR:
+			if len(v) != 4 {
+				return fmt.Errorf("invalid pcr length (%d)", len(v))
+			}
+			pcr = binary.BigEndian.Uint32(v)
+			seenPCR = true
+		case celTypeNVIndex:
+			return errors.New("records for NV indices are not supported")
+		case celTypeDigests:
+			dr := bytes.NewReader(v)
+			for dr.Len() > 0 {
+				alg, digest, err := readCELTLV(dr)
+				if err != nil {
+					return fmt.Errorf("cannot decode digests: %v", err)
+				}
+				digests = append(digests, TaggedDigest{Algorithm: AlgorithmId(alg), Digest: digest})
+			}
+			seenDigests = true
+		case celTypePCClientStd:
+			if !seenPCR || !seenDigests {
+				return errors.New("missing pcr or digests field")
+			}
+			eventType, data, err := decodeCELTLVContent(v)
+			if err != nil {
+				return fmt.Errorf("cannot decode content: %v", err)
+			}
+			return b.addEvent(pcr, digests, eventType, data)
+		default:
+			return fmt.Errorf("unsupported field or content type %d", t)
+		}
+	}
+}
+
+func decodeCELJSONRecord(record *celJSONRecord, b *celEventBuilder) error {
+	if record.ContentType != "pcclient_std" {
+		return fmt.Errorf("unsupported content type \"%s\"", record.ContentType)
+	}
+
+	var digests TaggedDigestList
+	for _, d := range record.Digests {
+		alg, err := celAlgorithmFromName(d.HashAlg)
+		if err != nil {
+			return err
+		}
+		digest, err := hex.DecodeString(d.Digest)
+		if err != nil {
+			return fmt.Errorf("cannot decode %s digest: %v", d.HashAlg, err)
+		}
+		digests = append(digests, TaggedDigest{Algorithm: alg, Digest: digest})
+	}
+
+	data, err := base64.StdEncoding.DecodeString(record.Content.EventData)
+	if err != nil {
+		return fmt.Errorf("cannot decode event_data: %v", err)
+	}
+
+	return b.addEvent(record.PCR, digests, EventType(record.Content.EventType), data)
+}
+
+// ReadCEL decodes a TCG Canonical Event Log in the specified format, producing the same Event and EventData
+// structures as Log. This is the inverse of WriteCEL. Only records that describe PCR measurements with the
+// pcclient_std content type are supported. CEL-JSON logs are expected to be an array of records. CEL-CBOR is not
+// supported.
+//
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_IWG_CEL_v1_r0p41_pub.pdf
+func ReadCEL(r io.Reader, format CELFormat, options LogOptions) ([]*Event, error) {
+	b := &celEventBuilder{options: options, indexTracker: make(map[PCRIndex]uint)}
+
+	switch format {
+	case CELFormatTLV:
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		stream := bytes.NewReader(data)
+		for stream.Len() > 0 {
+			if err := decodeCELTLVRecord(stream, b); err != nil {
+				return nil, fmt.Errorf("cannot decode record %d: %v", len(b.events), err)
+			}
+		}
+	case CELFormatJSON:
+		var records []*celJSONRecord
+		if err := json.NewDecoder(r).Decode(&records); err != nil {
+			return nil, err
+		}
+		for i, record := range records {
+			if err := decodeCELJSONRecord(record, b); err != nil {
+				return nil, fmt.Errorf("cannot decode record %d: %v", i, err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported CEL format %d", format)
+	}
+
+	return b.events, nil
+}
@@ -0,0 +1,142 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func makeTestCELEvents() []*Event {
+	return []*Event{
+		{PCRIndex: 4, EventType: EventTypeEFIAction, data: &asciiStringEventData{data: []byte("foo")},
+			Digests: NewEventDigests(DigestMap{AlgorithmSha1: AlgorithmSha1.hash([]byte("foo")), AlgorithmSha256: AlgorithmSha256.hash([]byte("foo"))})},
+		{PCRIndex: 7, EventType: EventTypeSeparator, data: &separatorEventData{data: []byte{0, 0, 0, 0}},
+			Digests: NewEventDigests(DigestMap{AlgorithmSha1: AlgorithmSha1.hash([]byte{0, 0, 0, 0}), AlgorithmSha256: AlgorithmSha256.hash([]byte{0, 0, 0, 0})})},
+	}
+}
+
+func TestWriteCELTLV(t *testing.T) {
+	events := makeTestCELEvents()
+
+	var buf bytes.Buffer
+	if err := WriteCEL(&buf, events[:1], CELFormatTLV); err != nil {
+		t.Fatalf("WriteCEL failed: %v", err)
+	}
+
+	var expected bytes.Buffer
+	expected.Write([]byte{0, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0, 0})
+	expected.Write([]byte{1, 0, 0, 0, 4, 0, 0, 0, 4})
+	expected.Write([]byte{3, 0, 0, 0, 5 + 20 + 5 + 32})
+	expected.Write([]byte{uint8(AlgorithmSha1), 0, 0, 0, 20})
+	expected.Write(events[0].Digests.Get(AlgorithmSha1))
+	expected.Write([]byte{uint8(AlgorithmSha256), 0, 0, 0, 32})
+	expected.Write(events[0].Digests.Get(AlgorithmSha256))
+	expected.Write([]byte{5, 0, 0, 0, 17})
+	expected.Write([]byte{0, 0, 0, 0, 4, 0x80, 0, 0, 7})
+	expected.Write([]byte{1, 0, 0, 0, 3, 'f', 'o', 'o'})
+
+	if !bytes.Equal(buf.Bytes(), expected.Bytes()) {
+		t.Errorf("Unexpected CEL-TLV:\ngot:      %x\nexpected: %x", buf.Bytes(), expected.Bytes())
+	}
+}
+
+func TestWriteCELJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCEL(&buf, makeTestCELEvents(), CELFormatJSON); err != nil {
+		t.Fatalf("WriteCEL failed: %v", err)
+	}
+
+	var records []celJSONRecord
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Unexpected number of records: %d", len(records))
+	}
+	r := records[1]
+	if r.Recnum != 1 || r.PCR != 7 || r.ContentType != "pcclient_std" || r.Content.EventType != uint32(EventTypeSeparator) ||
+		r.Content.EventData != "AAAAAA==" || len(r.Digests) != 2 || r.Digests[0].HashAlg != "sha1" {
+		t.Errorf("Unexpected record: %+v", r)
+	}
+}
+
+func TestWriteCELCBOR(t *testing.T) {
+	events := makeTestCELEvents()
+
+	var buf bytes.Buffer
+	if err := WriteCEL(&buf, events, CELFormatCBOR); err != nil {
+		t.Fatalf("WriteCEL failed: %v", err)
+	}
+
+	v, err := decodeCBOR(&buf)
+	if err != nil {
+		t.Fatalf("decodeCBOR failed: %v", err)
+	}
+	records, ok := v.([]interface{})
+	if !ok || len(records) != 2 {
+		t.Fatalf("Unexpected records: %v", v)
+	}
+	r := records[0].(map[interface{}]interface{})
+	if r[int64(celTypeRecnum)] != int64(0) || r[int64(celTypePCR)] != int64(4) {
+		t.Errorf("Unexpected record: %v", r)
+	}
+	content := r[int64(celTypePCClientStd)].(map[interface{}]interface{})
+	if content[int64(celPCClientStdEventType)] != int64(EventTypeEFIAction) ||
+		!bytes.Equal(content[int64(celPCClientStdEventData)].([]byte), []byte("foo")) {
+		t.Errorf("Unexpected content: %v", content)
+	}
+	digests := r[int64(celTypeDigests)].([]interface{})
+	d := digests[1].([]interface{})
+	if d[0] != int64(AlgorithmSha256) || !bytes.Equal(d[1].([]byte), events[0].Digests.Get(AlgorithmSha256)) {
+		t.Errorf("Unexpected digest: %v", d)
+	}
+}
+
+func TestReadCEL(t *testing.T) {
+	for _, format := range []CELFormat{CELFormatTLV, CELFormatJSON} {
+		events := makeTestCELEvents()
+
+		var buf bytes.Buffer
+		if err := WriteCEL(&buf, events, format); err != nil {
+			t.Fatalf("WriteCEL failed: %v", err)
+		}
+
+		decoded, err := ReadCEL(&buf, format, LogOptions{})
+		if err != nil {
+			t.Fatalf("ReadCEL failed for format %d: %v", format, err)
+		}
+		if len(decoded) != len(events) {
+			t.Fatalf("Unexpected number of events: %d", len(decoded))
+		}
+		for i, e := range decoded {
+			if e.PCRIndex != events[i].PCRIndex || e.EventType != events[i].EventType || e.Index != 0 {
+				t.Errorf("Unexpected event %d: %v", i, e)
+			}
+			if !bytes.Equal(e.Data().Bytes(), events[i].Data().Bytes()) {
+				t.Errorf("Unexpected data for event %d: %x", i, e.Data().Bytes())
+			}
+			if e.Digests.Len() != 2 || len(e.RawDigests) != 2 ||
+				!bytes.Equal(e.Digests.Get(AlgorithmSha256), events[i].Digests.Get(AlgorithmSha256)) {
+				t.Errorf("Unexpected digests for event %d", i)
+			}
+		}
+		if _, ok := decoded[0].Data().(*asciiStringEventData); !ok {
+			t.Errorf("Unexpected data type %T", decoded[0].Data())
+		}
+		if _, ok := decoded[1].Data().(*separatorEventData); !ok {
+			t.Errorf("Unexpected data type %T", decoded[1].Data())
+		}
+	}
+}
+
+func TestReadCELTLVTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCEL(&buf, makeTestCELEvents(), CELFormatTLV); err != nil {
+		t.Fatalf("WriteCEL failed: %v", err)
+	}
+
+	_, err := ReadCEL(bytes.NewReader(buf.Bytes()[:buf.Len()-2]), CELFormatTLV, LogOptions{})
+	if err == nil || err.Error() != "cannot decode record 1: unexpected EOF" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package tcglog
+
+import (
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"io"
+)
+
+// CertificateSource describes where a certificate appears in a log.
+type CertificateSource struct {
+	Event        *Event
+	VariableName EFIGUID // The namespace of the variable that the certificate was measured from
+	Database     string  // The name of the variable that the certificate was measured from, eg, "db" or "MokList"
+
+	// SignatureOwner is the owner of the EFI_SIGNATURE_DATA entry that contains the certificate, or nil if the
+	// certificate was measured without one (eg, shim's built-in vendor certificate).
+	SignatureOwner *EFIGUID
+}
+
+func (s *CertificateSource) String() string {
+	return fmt.Sprintf("event %d in PCR %d (type: %s, variable: %s-%s)", s.Event.Index, s.Event.PCRIndex,
+		s.Event.EventType, &s.VariableName, s.Database)
+}
+
+// LogCertificate is a X.509 certificate that appears in a log, and the events that it appears in.
+type LogCertificate struct {
+	Raw               []byte              // The DER encoded certificate
+	SHA256Fingerprint Digest              // The SHA-256 digest of Raw
+	Summary           *CertificateSummary // The summary of the certificate, or nil if it couldn't be decoded
+	Sources           []CertificateSource // The places that the certificate appears, in the order they appear
+}
+
+// PEM returns the PEM encoding of the certificate.
+func (c *LogCertificate) PEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+}
+
+type certificateExtractor struct {
+	certs []*LogCertificate
+	index map[[sha256.Size]byte]*LogCertificate
+}
+
+func (x *certificateExtractor) add(der []byte, summary *CertificateSummary, source CertificateSource) {
+	fingerprint := sha256.Sum256(der)
+	if c, exists := x.index[fingerprint]; exists {
+		c.Sources = append(c.Sources, source)
+		return
+	}
+	c := &LogCertificate{Raw: der, SHA256Fingerprint: fingerprint[:], Summary: summary,
+		Sources: []CertificateSource{source}}
+	x.certs = append(x.certs, c)
+	x.index[fingerprint] = c
+}
+
+func (x *certificateExtractor) addSignatureLists(event *Event, v *EFIVariableEventData, lists []*EFISignatureList) {
+	for _, l := range lists {
+		for _, s := range l.Signatures {
+			if !s.IsX509Certificate() {
+				continue
+			}
+			summary, _ := s.CertificateSummary()
+			owner := s.SignatureOwner
+			x.add(s.Data, summary, CertificateSource{Event: event, VariableName: v.VariableName,
+				Database: v.UnicodeName, SignatureOwner: &owner})
+		}
+	}
+}
+
+// addAuthority adds the certificate from an EV_EFI_VARIABLE_AUTHORITY event, which is either an EFI_SIGNATURE_DATA
+// entry or a bare DER encoded certificate (see EFIVariableEventData.AuthorityCertificate).
+func (x *certificateExtractor) addAuthority(event *Event, v *EFIVariableEventData) {
+	ownerSize := 16 // sizeof(EFI_GUID)
+	if len(v.VariableData) > ownerSize {
+		der := v.VariableData[ownerSize:]
+		if summary, err := ParseCertificateSummary(der, v.limits.tolerantCertificates); err == nil {
+			owner := decodeEFIGUID(v.VariableData)
+			x.add(der, summary, CertificateSource{Event: event, VariableName: v.VariableName,
+				Database: v.UnicodeName, SignatureOwner: &owner})
+			return
+		}
+	}
+	if summary, err := ParseCertificateSummary(v.VariableData, v.limits.tolerantCertificates); err == nil {
+		x.add(v.VariableData, summary, CertificateSource{Event: event, VariableName: v.VariableName,
+			Database: v.UnicodeName})
+	}
+}
+
+func (x *certificateExtractor) addEvent(event *Event) {
+	switch event.EventType {
+	case EventTypeEFIVariableDriverConfig:
+		d, ok := event.Data().(efiVariableEventDataProvider)
+		if !ok {
+			return
+		}
+		v := d.variableEventData()
+		if !isSignatureDatabaseVariable(v.VariableName, v.UnicodeName) {
+			return
+		}
+		lists, err := v.SignatureLists()
+		if err != nil {
+			return
+		}
+		x.addSignatureLists(event, v, lists)
+	case EventTypeEFIVariableAuthority:
+		switch d := event.Data().(type) {
+		case *ShimMokListEventData:
+			x.addSignatureLists(event, d.EFIVariableEventData, d.SignatureLists)
+		case efiVariableEventDataProvider:
+			x.addAuthority(event, d.variableEventData())
+		}
+	}
+}
+
+// ExtractCertificates reads the remaining events from the log and returns the X.509 certificates that appear in them,
+// in the order in which they first appear. These are the certificates in the signature databases measured by
+// EV_EFI_VARIABLE_DRIVER_CONFIG events (PK, KEK, db, dbx, dbt and dbr), the certificates measured by
+// EV_EFI_VARIABLE_AUTHORITY events when they are used to authorize an image, and the certificates in MokList and
+// MokListX measured by shim. A certificate that appears more than once is only returned once, with a source for each
+// place that it appears. Signature databases that can't be decoded are skipped. Note that this advances the Log
+// instance to the end of the log.
+func ExtractCertificates(log *Log) ([]*LogCertificate, error) {
+	x := &certificateExtractor{index: make(map[[sha256.Size]byte]*LogCertificate)}
+	for {
+		event, err := log.NextEvent()
+		if err == io.EOF {
+			return x.certs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		x.addEvent(event)
+	}
+}
@@ -0,0 +1,86 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/pem"
+	"testing"
+)
+
+func TestExtractCertificates(t *testing.T) {
+	owner := *NewEFIGUID(0x77fa9abd, 0x0359, 0x4d32, 0xbd60, [...]uint8{0x28, 0xf4, 0xe7, 0x8f, 0x78, 0x4b})
+	ca := makeTestCertificate(t, "Test CA")
+	kek := makeTestCertificate(t, "Test KEK")
+	mok := makeTestCertificate(t, "Test MOK")
+	vendor := makeTestCertificate(t, "Test Vendor")
+
+	algs := []AlgorithmId{AlgorithmSha256}
+	db := append(makeTestSignatureList(efiCertX509GUID, owner, ca),
+		makeTestSignatureList(efiCertSHA256GUID, owner, AlgorithmSha256.hash([]byte("foo")))...)
+	var authority bytes.Buffer
+	binary.Write(&authority, binary.LittleEndian, owner)
+	authority.Write(ca)
+	log, err := NewLog(bytes.NewReader(makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(7, EventTypeEFIVariableDriverConfig, makeTestEFIVariableEventData(efiGlobalVariableGUID,
+			"KEK", makeTestSignatureList(efiCertX509GUID, owner, kek)), algs...),
+		makeTestLogEvent(7, EventTypeEFIVariableDriverConfig, makeTestEFIVariableEventData(
+			efiImageSecurityDatabaseGUID, "db", db), algs...),
+		makeTestLogEvent(7, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...),
+		makeTestLogEvent(7, EventTypeEFIVariableAuthority, makeTestEFIVariableEventData(
+			efiImageSecurityDatabaseGUID, "db", authority.Bytes()), algs...),
+		makeTestLogEvent(7, EventTypeEFIVariableAuthority, makeTestEFIVariableEventData(shimLockGUID,
+			"Shim", vendor), algs...),
+		makeTestLogEvent(14, EventTypeEFIVariableAuthority, makeTestEFIVariableEventData(shimLockGUID,
+			"MokList", makeTestSignatureList(efiCertX509GUID, shimLockGUID, mok)), algs...),
+	})), LogOptions{})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+
+	certs, err := ExtractCertificates(log)
+	if err != nil {
+		t.Fatalf("ExtractCertificates failed: %v", err)
+	}
+	if len(certs) != 4 {
+		t.Fatalf("Unexpected number of certificates: %d", len(certs))
+	}
+
+	for i, data := range []struct {
+		der       []byte
+		subject   string
+		databases []string
+		owned     bool
+	}{
+		{der: kek, subject: "CN=Test KEK", databases: []string{"KEK"}, owned: true},
+		{der: ca, subject: "CN=Test CA", databases: []string{"db", "db"}, owned: true},
+		{der: vendor, subject: "CN=Test Vendor", databases: []string{"Shim"}},
+		{der: mok, subject: "CN=Test MOK", databases: []string{"MokList"}, owned: true},
+	} {
+		c := certs[i]
+		if !bytes.Equal(c.Raw, data.der) {
+			t.Errorf("Unexpected certificate %d", i)
+		}
+		if c.Summary == nil || c.Summary.Subject != data.subject {
+			t.Errorf("Unexpected summary for certificate %d: %v", i, c.Summary)
+		}
+		if len(c.Sources) != len(data.databases) {
+			t.Errorf("Unexpected number of sources for certificate %d: %d", i, len(c.Sources))
+			continue
+		}
+		for j, s := range c.Sources {
+			if s.Database != data.databases[j] || (s.SignatureOwner != nil) != data.owned {
+				t.Errorf("Unexpected source %d for certificate %d: %s", j, i, &s)
+			}
+		}
+	}
+
+	if s := certs[1].Sources; s[0].Event.EventType != EventTypeEFIVariableDriverConfig ||
+		s[1].Event.EventType != EventTypeEFIVariableAuthority || *s[1].SignatureOwner != owner {
+		t.Errorf("Unexpected sources for db certificate")
+	}
+
+	block, _ := pem.Decode(certs[0].PEM())
+	if block == nil || block.Type != "CERTIFICATE" || !bytes.Equal(block.Bytes, kek) {
+		t.Errorf("Unexpected PEM encoding")
+	}
+}
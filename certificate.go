@@ -0,0 +1,210 @@
+package tcglog
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CertificateSummary contains the details of a X.509 certificate that are useful for identifying it.
+type CertificateSummary struct {
+	Subject           string
+	Issuer            string
+	NotBefore         time.Time
+	NotAfter          time.Time
+	SHA256Fingerprint Digest // The SHA-256 digest of the DER encoded certificate
+
+	// Malformed indicates that crypto/x509 rejected the certificate, and that it was summarized with the tolerant
+	// parser (see ParseCertificateSummary).
+	Malformed bool
+}
+
+func (s *CertificateSummary) String() string {
+	var malformed string
+	if s.Malformed {
+		malformed = ", Malformed: true"
+	}
+	return fmt.Sprintf("Certificate{ Subject: \"%s\", Issuer: \"%s\", NotBefore: %s, NotAfter: %s, SHA256Fingerprint: %x%s }",
+		s.Subject, s.Issuer, s.NotBefore.Format(time.RFC3339), s.NotAfter.Format(time.RFC3339), s.SHA256Fingerprint,
+		malformed)
+}
+
+// NewCertificateSummary creates a summary of the supplied certificate.
+func NewCertificateSummary(cert *x509.Certificate) *CertificateSummary {
+	fingerprint := sha256.Sum256(cert.Raw)
+	return &CertificateSummary{
+		Subject:           cert.Subject.String(),
+		Issuer:            cert.Issuer.String(),
+		NotBefore:         cert.NotBefore,
+		NotAfter:          cert.NotAfter,
+		SHA256Fingerprint: fingerprint[:]}
+}
+
+// ParseCertificateSummary creates a summary of the supplied DER encoded certificate. Some OEMs ship certificates in
+// db and KEK that are slightly malformed (eg, they contain strings with characters that aren't permitted by their
+// type, or times that aren't encoded as required by DER), which crypto/x509 rejects. If tolerant is true, these are
+// summarized with a minimal parser that only decodes the subject, issuer and validity, and the summary has Malformed
+// set. Data after the end of the certificate is ignored by the tolerant parser.
+func ParseCertificateSummary(der []byte, tolerant bool) (*CertificateSummary, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err == nil {
+		return NewCertificateSummary(cert), nil
+	}
+	if !tolerant {
+		return nil, err
+	}
+	s, tolerantErr := parseTolerantCertificateSummary(der)
+	if tolerantErr != nil {
+		return nil, fmt.Errorf("%v (tolerant parser: %v)", err, tolerantErr)
+	}
+	return s, nil
+}
+
+// parseTolerantCertificateSummary summarizes a certificate without crypto/x509.
+//
+// https://tools.ietf.org/html/rfc5280#section-4.1
+func parseTolerantCertificateSummary(der []byte) (*CertificateSummary, error) {
+	cert, _, err := readDERSequence(der)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode certificate: %v", err)
+	}
+	tbs, _, err := readDERSequence(cert.content)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode tbsCertificate: %v", err)
+	}
+
+	var fields []*derElement
+	for data := tbs.content; len(data) > 0 && len(fields) < 6; {
+		var e *derElement
+		e, data, err = readDERElement(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode tbsCertificate: %v", err)
+		}
+		fields = append(fields, e)
+	}
+	if len(fields) > 0 && fields[0].class == asn1.ClassContextSpecific && fields[0].tag == 0 {
+		// Skip the version.
+		fields = fields[1:]
+	}
+	if len(fields) < 5 {
+		return nil, errors.New("tbsCertificate is truncated")
+	}
+	// The remaining fields are serialNumber, signature, issuer, validity and subject.
+	issuer, validity, subject := fields[2], fields[3], fields[4]
+
+	s := &CertificateSummary{Malformed: true}
+	if s.Issuer, err = parseTolerantName(issuer); err != nil {
+		return nil, fmt.Errorf("cannot decode issuer: %v", err)
+	}
+	if s.Subject, err = parseTolerantName(subject); err != nil {
+		return nil, fmt.Errorf("cannot decode subject: %v", err)
+	}
+
+	notBefore, rest, err := readDERElement(validity.content)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode validity: %v", err)
+	}
+	notAfter, _, err := readDERElement(rest)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode validity: %v", err)
+	}
+	if s.NotBefore, err = decodeTolerantASN1Time(notBefore); err != nil {
+		return nil, fmt.Errorf("cannot decode notBefore: %v", err)
+	}
+	if s.NotAfter, err = decodeTolerantASN1Time(notAfter); err != nil {
+		return nil, fmt.Errorf("cannot decode notAfter: %v", err)
+	}
+
+	fingerprint := sha256.Sum256(cert.raw)
+	s.SHA256Fingerprint = fingerprint[:]
+	return s, nil
+}
+
+// parseTolerantName decodes a Name and formats it in the same way as crypto/x509.
+func parseTolerantName(e *derElement) (string, error) {
+	if e.class != asn1.ClassUniversal || e.tag != asn1.TagSequence {
+		return "", fmt.Errorf("unexpected tag %d (class %d), expected a SEQUENCE", e.tag, e.class)
+	}
+
+	var rdns pkix.RDNSequence
+	for data := e.content; len(data) > 0; {
+		set, rest, err := readDERElement(data)
+		if err != nil {
+			return "", err
+		}
+		data = rest
+
+		var rdn pkix.RelativeDistinguishedNameSET
+		for attrs := set.content; len(attrs) > 0; {
+			attr, rest, err := readDERSequence(attrs)
+			if err != nil {
+				return "", err
+			}
+			attrs = rest
+
+			oidElement, rest, err := readDERElement(attr.content)
+			if err != nil {
+				return "", err
+			}
+			var oid asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(oidElement.raw, &oid); err != nil {
+				return "", fmt.Errorf("invalid attribute type: %v", err)
+			}
+			value, _, err := readDERElement(rest)
+			if err != nil {
+				return "", err
+			}
+			rdn = append(rdn, pkix.AttributeTypeAndValue{Type: oid, Value: decodeTolerantASN1String(value)})
+		}
+		rdns = append(rdns, rdn)
+	}
+
+	var name pkix.Name
+	name.FillFromRDNSequence(&rdns)
+	return name.String(), nil
+}
+
+// AuthorityCertificate decodes the X.509 certificate contained in the variable data of an EV_EFI_VARIABLE_AUTHORITY
+// event. Firmware measures the EFI_SIGNATURE_DATA entry from db that authorized an image, and shim measures either an
+// EFI_SIGNATURE_DATA entry (for MokList) or the bare DER encoded certificate (for its built-in vendor certificate), so
+// both forms are accepted.
+func (e *EFIVariableEventData) AuthorityCertificate() (*x509.Certificate, error) {
+	ownerSize := 16 // sizeof(EFI_GUID)
+	if len(e.VariableData) > ownerSize {
+		if cert, err := x509.ParseCertificate(e.VariableData[ownerSize:]); err == nil {
+			return cert, nil
+		}
+	}
+	if cert, err := x509.ParseCertificate(e.VariableData); err == nil {
+		return cert, nil
+	}
+	return nil, errors.New("variable data does not contain a X.509 certificate")
+}
+
+// AuthorityCertificateSummary summarizes the X.509 certificate contained in the variable data of an
+// EV_EFI_VARIABLE_AUTHORITY event (see AuthorityCertificate). If the log was read with LogOptions.TolerantCertificates,
+// a certificate that crypto/x509 rejects is summarized with the tolerant parser (see ParseCertificateSummary).
+func (e *EFIVariableEventData) AuthorityCertificateSummary() (*CertificateSummary, error) {
+	cert, err := e.AuthorityCertificate()
+	if err == nil {
+		return NewCertificateSummary(cert), nil
+	}
+	if !e.limits.tolerantCertificates {
+		return nil, err
+	}
+
+	ownerSize := 16 // sizeof(EFI_GUID)
+	if len(e.VariableData) > ownerSize {
+		if s, err := parseTolerantCertificateSummary(e.VariableData[ownerSize:]); err == nil {
+			return s, nil
+		}
+	}
+	if s, err := parseTolerantCertificateSummary(e.VariableData); err == nil {
+		return s, nil
+	}
+	return nil, err
+}
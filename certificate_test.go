@@ -0,0 +1,97 @@
+package tcglog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEFIVariableAuthorityCertificate(t *testing.T) {
+	der := makeTestCertificate(t, "Test Authority")
+	owner := *NewEFIGUID(0x605dab50, 0xe046, 0x4300, 0xabb6, [...]uint8{0x3d, 0xd8, 0x10, 0xdd, 0x8b, 0x23})
+	var sigData bytes.Buffer
+	binary.Write(&sigData, binary.LittleEndian, owner)
+	sigData.Write(der)
+
+	for _, data := range []struct {
+		desc         string
+		variableData []byte
+	}{
+		{desc: "EFI_SIGNATURE_DATA", variableData: sigData.Bytes()},
+		{desc: "bare certificate", variableData: der},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			e := &EFIVariableEventData{eventType: EventTypeEFIVariableAuthority, VariableName: efiImageSecurityDatabaseGUID,
+				UnicodeName: "db", VariableData: data.variableData}
+			cert, err := e.AuthorityCertificate()
+			if err != nil {
+				t.Fatalf("AuthorityCertificate failed: %v", err)
+			}
+			s := NewCertificateSummary(cert)
+			if s.Subject != "CN=Test Authority" || s.Issuer != "CN=Test Authority" {
+				t.Errorf("Unexpected subject or issuer: %s", s)
+			}
+			fingerprint := sha256.Sum256(der)
+			if !bytes.Equal(s.SHA256Fingerprint, fingerprint[:]) {
+				t.Errorf("Unexpected fingerprint: %x", s.SHA256Fingerprint)
+			}
+			if !strings.Contains(e.String(), "Subject: \"CN=Test Authority\"") {
+				t.Errorf("Unexpected string: %s", e)
+			}
+		})
+	}
+
+	e := &EFIVariableEventData{eventType: EventTypeEFIVariableAuthority, VariableData: []byte("not a certificate")}
+	if _, err := e.AuthorityCertificate(); err == nil {
+		t.Errorf("AuthorityCertificate should fail for data without a certificate")
+	}
+}
+
+func TestParseCertificateSummaryTolerant(t *testing.T) {
+	// Create a certificate with a PrintableString that contains a character which isn't permitted, as found in some
+	// OEM certificates. crypto/x509 encodes the name as a UTF8String, so change the tag.
+	der := makeTestCertificate(t, "Test_Authority")
+	der = bytes.Replace(der, []byte("\x0c\x0eTest_Authority"), []byte("\x13\x0eTest_Authority"), -1)
+	fingerprint := sha256.Sum256(der)
+
+	if _, err := ParseCertificateSummary(der, false); err == nil {
+		t.Fatalf("ParseCertificateSummary should fail for a malformed certificate without the tolerant parser")
+	}
+
+	// Data after the end of the certificate is ignored by the tolerant parser.
+	s, err := ParseCertificateSummary(append(der, 0, 0), true)
+	if err != nil {
+		t.Fatalf("ParseCertificateSummary failed: %v", err)
+	}
+	if s.Subject != "CN=Test_Authority" || s.Issuer != "CN=Test_Authority" || !s.Malformed {
+		t.Errorf("Unexpected summary: %s", s)
+	}
+	if !s.NotBefore.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) ||
+		!s.NotAfter.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected validity: %s", s)
+	}
+	if !bytes.Equal(s.SHA256Fingerprint, fingerprint[:]) {
+		t.Errorf("Unexpected fingerprint: %x", s.SHA256Fingerprint)
+	}
+
+	if _, err := ParseCertificateSummary([]byte("not a certificate"), true); err == nil {
+		t.Errorf("ParseCertificateSummary should fail for data without a certificate")
+	}
+
+	e := &EFIVariableEventData{eventType: EventTypeEFIVariableAuthority, VariableName: efiImageSecurityDatabaseGUID,
+		UnicodeName: "db", VariableData: der}
+	if _, err := e.AuthorityCertificateSummary(); err == nil {
+		t.Errorf("AuthorityCertificateSummary should fail without LogOptions.TolerantCertificates")
+	}
+	e.limits.tolerantCertificates = true
+	if s, err := e.AuthorityCertificateSummary(); err != nil || s.Subject != "CN=Test_Authority" {
+		t.Errorf("AuthorityCertificateSummary returned an unexpected result: %v, %v", s, err)
+	}
+	if str := e.String(); !strings.Contains(str, "Subject: \"CN=Test_Authority\"") ||
+		!strings.Contains(str, "Malformed: true") {
+		t.Errorf("Unexpected string: %s", e)
+	}
+}
@@ -0,0 +1,248 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CloudQuote is a TPM quote contained in the attestation document of a cloud VM.
+type CloudQuote struct {
+	Attest    []byte // The quote, as a TPMS_ATTEST structure
+	Signature []byte // The signature of the quote, as a TPMT_SIGNATURE structure
+}
+
+// CloudAttestation contains the measurements extracted from the attestation document of a cloud VM with a virtual
+// TPM, so that they can be checked against an event log in the same way as PCR values read from a physical TPM.
+//
+// The PCR values are copied from the document as they are. They should only be trusted once the document has been
+// authenticated, either with VerifyQuotes for documents that contain quotes, or by verifying the signature of the
+// document itself against the certificates of the cloud provider.
+type CloudAttestation struct {
+	PCRValues PCRValues    // The PCR values reported by the document
+	EventLog  []byte       // The TCG event log, if the document contains one
+	Quotes    []CloudQuote // The quotes of the PCR values, if the document contains any
+	AKPublic  []byte       // The public area of the key that signed the quotes (TPM2B_PUBLIC or TPMT_PUBLIC)
+}
+
+// VerifyQuotes verifies the signature of each quote in the document with AKPublic, and checks that each quote is
+// consistent with PCRValues. This authenticates PCRValues if the attestation key is trusted, which must be
+// established separately (eg, with the AK certificate issued by the cloud provider). An error is returned if the
+// document doesn't contain any quotes.
+func (a *CloudAttestation) VerifyQuotes() error {
+	if len(a.Quotes) == 0 {
+		return errors.New("attestation document doesn't contain any quotes")
+	}
+	for i, q := range a.Quotes {
+		result, err := VerifyQuote(q.Attest, q.Signature, a.AKPublic, a.PCRValues)
+		if err != nil {
+			return fmt.Errorf("cannot verify quote %d: %v", i, err)
+		}
+		if !result.Consistent() {
+			return fmt.Errorf("quote %d is not consistent with the PCR values in the attestation document", i)
+		}
+	}
+	return nil
+}
+
+// setFromAttestation adds a PCR value decoded from an attestation document, checking that it is consistent with the
+// algorithm and with the values that have already been decoded.
+func (v PCRValues) setFromAttestation(pcr PCRIndex, alg AlgorithmId, digest []byte) error {
+	if !isPCRIndexInRange(pcr) {
+		return fmt.Errorf("out-of-range PCR index (%d)", pcr)
+	}
+	if !alg.supported() {
+		return fmt.Errorf("unsupported algorithm (%s)", alg)
+	}
+	if len(digest) != alg.size() {
+		return fmt.Errorf("invalid %s value for PCR %d (%d bytes)", alg, pcr, len(digest))
+	}
+	if _, exists := v[pcr][alg]; exists {
+		return fmt.Errorf("more than one %s value for PCR %d", alg, pcr)
+	}
+	if v[pcr] == nil {
+		v[pcr] = make(DigestMap)
+	}
+	v[pcr][alg] = digest
+	return nil
+}
+
+// algorithmForDigestSize returns the supported algorithm that produces digests of the specified size.
+func algorithmForDigestSize(size int) (AlgorithmId, bool) {
+	for _, alg := range []AlgorithmId{AlgorithmSha1, AlgorithmSha256, AlgorithmSha384, AlgorithmSha512} {
+		if alg.size() == size {
+			return alg, true
+		}
+	}
+	return 0, false
+}
+
+type azureTPMInfo struct {
+	AikPub       []byte
+	PcrQuote     []byte
+	PcrSignature []byte
+	PcrValues    []struct {
+		Index  PCRIndex
+		Digest []byte
+	}
+}
+
+type azureAttestationInfo struct {
+	TcgLogs []byte
+	TpmInfo *azureTPMInfo
+}
+
+// ReadAzureAttestation reads the JSON AttestationInfo document that the Azure guest attestation client submits to
+// Microsoft Azure Attestation (MAA) for a VM with a virtual TPM. The PCR values, quote, attestation key and event log
+// are taken from the TpmInfo.PcrValues, TpmInfo.PcrQuote, TpmInfo.PcrSignature, TpmInfo.AikPub and TcgLogs fields.
+// The algorithm of each PCR value is determined from its size.
+func ReadAzureAttestation(r io.Reader) (*CloudAttestation, error) {
+	var doc azureAttestationInfo
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("cannot decode document: %v", err)
+	}
+	if doc.TpmInfo == nil {
+		return nil, errors.New("document doesn't contain TpmInfo")
+	}
+
+	out := &CloudAttestation{
+		PCRValues: make(PCRValues),
+		EventLog:  doc.TcgLogs,
+		AKPublic:  doc.TpmInfo.AikPub}
+	for _, v := range doc.TpmInfo.PcrValues {
+		alg, ok := algorithmForDigestSize(len(v.Digest))
+		if !ok {
+			return nil, fmt.Errorf("invalid value for PCR %d (%d bytes)", v.Index, len(v.Digest))
+		}
+		if err := out.PCRValues.setFromAttestation(v.Index, alg, v.Digest); err != nil {
+			return nil, err
+		}
+	}
+	if len(doc.TpmInfo.PcrQuote) > 0 {
+		out.Quotes = append(out.Quotes,
+			CloudQuote{Attest: doc.TpmInfo.PcrQuote, Signature: doc.TpmInfo.PcrSignature})
+	}
+	return out, nil
+}
+
+// gcpHashAlgo corresponds to the HashAlgo enum of go-tpm-tools, which can be encoded in JSON as either its name or
+// its value. The values are the TPM algorithm identifiers.
+type gcpHashAlgo AlgorithmId
+
+func (a *gcpHashAlgo) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var id uint16
+		if err := json.Unmarshal(data, &id); err != nil {
+			return fmt.Errorf("invalid hash algorithm %s", data)
+		}
+		*a = gcpHashAlgo(id)
+		return nil
+	}
+	id, err := ParseAlgorithm(strings.ToLower(name))
+	if err != nil {
+		return err
+	}
+	*a = gcpHashAlgo(id)
+	return nil
+}
+
+type gcpQuote struct {
+	Quote  []byte `json:"quote"`
+	RawSig []byte `json:"rawSig"`
+	Pcrs   struct {
+		Hash gcpHashAlgo       `json:"hash"`
+		Pcrs map[uint32][]byte `json:"pcrs"`
+	} `json:"pcrs"`
+}
+
+type gcpAttestation struct {
+	AkPub    []byte      `json:"akPub"`
+	Quotes   []*gcpQuote `json:"quotes"`
+	EventLog []byte      `json:"eventLog"`
+}
+
+// ReadGCPAttestation reads the attestation of a Google Cloud Shielded VM or Confidential VM, as produced by the
+// go-tpm-tools attest command and encoded as JSON with the standard protobuf JSON mapping. The document contains a
+// quote for each PCR bank, and the PCR values are taken from the quotes.
+func ReadGCPAttestation(r io.Reader) (*CloudAttestation, error) {
+	var doc gcpAttestation
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("cannot decode document: %v", err)
+	}
+
+	out := &CloudAttestation{
+		PCRValues: make(PCRValues),
+		EventLog:  doc.EventLog,
+		AKPublic:  doc.AkPub}
+	for i, q := range doc.Quotes {
+		if q == nil {
+			return nil, fmt.Errorf("invalid quote %d", i)
+		}
+		alg := AlgorithmId(q.Pcrs.Hash)
+		for pcr, digest := range q.Pcrs.Pcrs {
+			if err := out.PCRValues.setFromAttestation(PCRIndex(pcr), alg, digest); err != nil {
+				return nil, fmt.Errorf("invalid quote %d: %v", i, err)
+			}
+		}
+		out.Quotes = append(out.Quotes, CloudQuote{Attest: q.Quote, Signature: q.RawSig})
+	}
+	return out, nil
+}
+
+// ReadNitroTPMAttestation reads the attestation document of an AWS EC2 instance with NitroTPM, which is a
+// COSE_Sign1 structure containing a CBOR encoded payload. The PCR values are taken from the nitrotpm_pcrs field of
+// the payload, and the algorithm from the digest field. The document doesn't contain the event log or a TPM quote,
+// and the signature of the document isn't verified by this function.
+func ReadNitroTPMAttestation(r io.Reader) (*CloudAttestation, error) {
+	cose, err := decodeCBOR(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode document: %v", err)
+	}
+	sign1, ok := cose.([]interface{})
+	if !ok || len(sign1) != 4 {
+		return nil, errors.New("document is not a COSE_Sign1 structure")
+	}
+	payloadData, ok := sign1[2].([]byte)
+	if !ok {
+		return nil, errors.New("document has an invalid payload")
+	}
+	p, err := decodeCBOR(bytes.NewReader(payloadData))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode payload: %v", err)
+	}
+	payload, ok := p.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("payload is not a map")
+	}
+
+	digest, _ := payload["digest"].(string)
+	alg, err := ParseAlgorithm(strings.ToLower(digest))
+	if err != nil {
+		return nil, fmt.Errorf("payload has an invalid digest algorithm: %v", err)
+	}
+	pcrs, ok := payload["nitrotpm_pcrs"].(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("payload doesn't contain NitroTPM PCR values")
+	}
+
+	out := &CloudAttestation{PCRValues: make(PCRValues)}
+	for k, v := range pcrs {
+		// Check the range before converting to PCRIndex, so that a large key doesn't wrap to a valid index.
+		pcr, ok := k.(int64)
+		if !ok || pcr < 0 || pcr > int64(maxPCRIndex) {
+			return nil, fmt.Errorf("payload has an invalid PCR index (%v)", k)
+		}
+		digest, ok := v.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("payload has an invalid value for PCR %d", pcr)
+		}
+		if err := out.PCRValues.setFromAttestation(PCRIndex(pcr), alg, digest); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
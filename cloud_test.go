@@ -0,0 +1,181 @@
+package tcglog
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// makeTestCloudQuote returns a quote of PCRs 0-7 in values, its TPMT_SIGNATURE and the public area of the key that
+// signed it.
+func makeTestCloudQuote(t *testing.T, values PCRValues) (attest, sig, akPublic []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	pcrs := []PCRIndex{0, 1, 2, 3, 4, 5, 6, 7}
+	pcrDigest, _ := ComputePCRDigest(AlgorithmSha256, pcrs, values)
+	attest = makeTestQuote(pcrs, pcrDigest)
+
+	h := sha256.Sum256(attest)
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, tpmAlgECDSA)
+	binary.Write(&buf, binary.BigEndian, uint16(AlgorithmSha256))
+	writeTestTPM2B(&buf, r.Bytes())
+	writeTestTPM2B(&buf, s.Bytes())
+
+	return attest, buf.Bytes(), makeTestECCAKPublic(&key.PublicKey)
+}
+
+func TestReadAzureAttestation(t *testing.T) {
+	values := makeTestQuotePCRValues()
+	attest, sig, akPublic := makeTestCloudQuote(t, values)
+	log := makeTestLog_2([]AlgorithmId{AlgorithmSha256}, nil)
+
+	type pcrValue struct {
+		Index  PCRIndex
+		Digest []byte
+	}
+	tpmInfo := map[string]interface{}{"AikPub": akPublic, "PcrQuote": attest, "PcrSignature": sig}
+	var pcrValues []pcrValue
+	for _, pcr := range values.PCRs() {
+		pcrValues = append(pcrValues, pcrValue{Index: pcr, Digest: values[pcr][AlgorithmSha256]})
+	}
+	tpmInfo["PcrValues"] = pcrValues
+	doc, _ := json.Marshal(map[string]interface{}{"AttestationProtocolVersion": "2.0", "TcgLogs": log,
+		"TpmInfo": tpmInfo})
+
+	a, err := ReadAzureAttestation(bytes.NewReader(doc))
+	if err != nil {
+		t.Fatalf("ReadAzureAttestation failed: %v", err)
+	}
+	if !bytes.Equal(a.EventLog, log) || len(a.Quotes) != 1 || !bytes.Equal(a.AKPublic, akPublic) {
+		t.Errorf("Unexpected attestation: %+v", a)
+	}
+	if len(a.PCRValues) != 8 || !bytes.Equal(a.PCRValues[7][AlgorithmSha256], values[7][AlgorithmSha256]) {
+		t.Errorf("Unexpected PCR values: %v", a.PCRValues)
+	}
+	if err := a.VerifyQuotes(); err != nil {
+		t.Errorf("VerifyQuotes failed: %v", err)
+	}
+
+	a.PCRValues[4][AlgorithmSha256] = AlgorithmSha256.hash([]byte("modified"))
+	if err := a.VerifyQuotes(); err == nil {
+		t.Errorf("VerifyQuotes should fail with a modified PCR value")
+	}
+
+	pcrValues[0].Digest = []byte{1, 2, 3}
+	doc, _ = json.Marshal(map[string]interface{}{"TpmInfo": tpmInfo})
+	if _, err := ReadAzureAttestation(bytes.NewReader(doc)); err == nil {
+		t.Errorf("ReadAzureAttestation should fail with an invalid PCR value")
+	}
+	if _, err := ReadAzureAttestation(bytes.NewReader([]byte(`{"TcgLogs": ""}`))); err == nil {
+		t.Errorf("ReadAzureAttestation should fail without TpmInfo")
+	}
+}
+
+func TestReadGCPAttestation(t *testing.T) {
+	values := makeTestQuotePCRValues()
+	attest, sig, akPublic := makeTestCloudQuote(t, values)
+	log := makeTestLog_2([]AlgorithmId{AlgorithmSha256}, nil)
+
+	var pcrs []string
+	for _, pcr := range values.PCRs() {
+		pcrs = append(pcrs, fmt.Sprintf(`"%d": "%s"`, pcr,
+			base64.StdEncoding.EncodeToString(values[pcr][AlgorithmSha256])))
+	}
+	b64 := base64.StdEncoding.EncodeToString
+	for _, hash := range []string{`"SHA256"`, "11"} {
+		doc := fmt.Sprintf(`{"akPub": "%s", "quotes": [{"quote": "%s", "rawSig": "%s", `+
+			`"pcrs": {"hash": %s, "pcrs": {%s}}}], "eventLog": "%s"}`, b64(akPublic), b64(attest), b64(sig), hash,
+			strings.Join(pcrs, ", "), b64(log))
+
+		a, err := ReadGCPAttestation(bytes.NewReader([]byte(doc)))
+		if err != nil {
+			t.Fatalf("ReadGCPAttestation failed with hash %s: %v", hash, err)
+		}
+		if !bytes.Equal(a.EventLog, log) || len(a.Quotes) != 1 {
+			t.Errorf("Unexpected attestation: %+v", a)
+		}
+		if len(a.PCRValues) != 8 || !bytes.Equal(a.PCRValues[3][AlgorithmSha256], values[3][AlgorithmSha256]) {
+			t.Errorf("Unexpected PCR values: %v", a.PCRValues)
+		}
+		if err := a.VerifyQuotes(); err != nil {
+			t.Errorf("VerifyQuotes failed: %v", err)
+		}
+	}
+
+	doc := `{"quotes": [{"pcrs": {"hash": "SHA1", "pcrs": {"0": "` + b64(make([]byte, 32)) + `"}}}]}`
+	if _, err := ReadGCPAttestation(bytes.NewReader([]byte(doc))); err == nil {
+		t.Errorf("ReadGCPAttestation should fail with a PCR value of the wrong size")
+	}
+	doc = `{"quotes": [{"pcrs": {"hash": "MD5", "pcrs": {}}}]}`
+	if _, err := ReadGCPAttestation(bytes.NewReader([]byte(doc))); err == nil {
+		t.Errorf("ReadGCPAttestation should fail with an unsupported algorithm")
+	}
+}
+
+func makeTestNitroTPMAttestation(digest string, pcrs map[interface{}]interface{}) []byte {
+	var payload bytes.Buffer
+	encodeCBORHead(&payload, 5, 3)
+	encodeCBOR(&payload, "module_id")
+	encodeCBOR(&payload, "i-0123456789abcdef0")
+	encodeCBOR(&payload, "digest")
+	encodeCBOR(&payload, digest)
+	encodeCBOR(&payload, "nitrotpm_pcrs")
+	encodeCBOR(&payload, pcrs)
+
+	var doc bytes.Buffer
+	doc.WriteByte(0xd2) // tag 18 (COSE_Sign1)
+	encodeCBOR(&doc, []interface{}{[]byte{0xa1, 0x01, 0x38, 0x22}, map[interface{}]interface{}{}, payload.Bytes(),
+		make([]byte, 96)})
+	return doc.Bytes()
+}
+
+func TestReadNitroTPMAttestation(t *testing.T) {
+	pcrs := make(map[interface{}]interface{})
+	for i := int64(0); i < 24; i++ {
+		pcrs[i] = AlgorithmSha384.hash([]byte{byte(i)})
+	}
+
+	a, err := ReadNitroTPMAttestation(bytes.NewReader(makeTestNitroTPMAttestation("SHA384", pcrs)))
+	if err != nil {
+		t.Fatalf("ReadNitroTPMAttestation failed: %v", err)
+	}
+	if a.EventLog != nil || len(a.Quotes) != 0 {
+		t.Errorf("Unexpected attestation: %+v", a)
+	}
+	if len(a.PCRValues) != 24 || !bytes.Equal(a.PCRValues[23][AlgorithmSha384], AlgorithmSha384.hash([]byte{23})) {
+		t.Errorf("Unexpected PCR values: %v", a.PCRValues)
+	}
+	if err := a.VerifyQuotes(); err == nil {
+		t.Errorf("VerifyQuotes should fail without any quotes")
+	}
+
+	if _, err := ReadNitroTPMAttestation(bytes.NewReader(makeTestNitroTPMAttestation("SHA256", pcrs))); err == nil {
+		t.Errorf("ReadNitroTPMAttestation should fail with PCR values of the wrong size")
+	}
+	for _, pcr := range []int64{32, (1 << 32) + 7, -1} {
+		invalid := map[interface{}]interface{}{pcr: AlgorithmSha384.hash(nil)}
+		if _, err := ReadNitroTPMAttestation(bytes.NewReader(makeTestNitroTPMAttestation("SHA384",
+			invalid))); err == nil {
+			t.Errorf("ReadNitroTPMAttestation should fail with an out-of-range PCR (%d)", pcr)
+		}
+	}
+	if _, err := ReadNitroTPMAttestation(bytes.NewReader([]byte{0x80})); err == nil {
+		t.Errorf("ReadNitroTPMAttestation should fail with something that isn't a COSE_Sign1 structure")
+	}
+}
@@ -0,0 +1,290 @@
+package tcglog
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ComplianceSpecification is the specification that CheckCompliance checks logs against.
+const ComplianceSpecification = "https://trustedcomputinggroup.org/wp-content/uploads/" +
+	"TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf"
+
+// ComplianceRule identifies a requirement of the TCG PC Client Platform Firmware Profile specification that a log is
+// checked against by CheckCompliance.
+type ComplianceRule int
+
+const (
+	// ComplianceRuleSpecIdEventFirst requires that the first event in the log is a Spec ID event in PCR 0.
+	ComplianceRuleSpecIdEventFirst ComplianceRule = iota
+
+	// ComplianceRuleSpecIdEventUnique requires that the log contains only one Spec ID event.
+	ComplianceRuleSpecIdEventUnique
+
+	// ComplianceRuleNoActionDigestZero requires that the digests of EV_NO_ACTION events are zero, as these events
+	// aren't extended to a PCR.
+	ComplianceRuleNoActionDigestZero
+
+	// ComplianceRuleSeparatorPresent requires that an EV_SEPARATOR event is measured to each of PCRs 0-7.
+	ComplianceRuleSeparatorPresent
+
+	// ComplianceRuleSeparatorUnique requires that only one EV_SEPARATOR event is measured to each of PCRs 0-7.
+	ComplianceRuleSeparatorUnique
+
+	// ComplianceRuleSeparatorBeforeOSPresent requires that the EV_SEPARATOR events in PCRs 0-7 are measured before
+	// the transition to the OS-present environment, which is indicated by the "Exit Boot Services Invocation" event.
+	ComplianceRuleSeparatorBeforeOSPresent
+
+	// ComplianceRuleEFIActionString requires that the event data of EV_EFI_ACTION events is one of the strings defined
+	// by the specification, without a NULL terminator.
+	ComplianceRuleEFIActionString
+
+	// ComplianceRuleEventPCR requires that events of types that the specification assigns to specific PCRs are
+	// measured to one of those PCRs.
+	ComplianceRuleEventPCR
+)
+
+// ComplianceRuleInfo describes a ComplianceRule.
+type ComplianceRuleInfo struct {
+	Rule ComplianceRule
+
+	// Code is a stable identifier for the rule (eg, "SEPARATOR_PRESENT"). Codes are never changed or reused once
+	// released.
+	Code string
+
+	Section string // The section of the specification that the rule is from
+	Summary string // A one line description of the rule
+}
+
+var complianceRuleInfos = [...]ComplianceRuleInfo{
+	{ComplianceRuleSpecIdEventFirst, "SPEC_ID_EVENT_FIRST", "section 9.4.5.1 \"Specification ID Version Event\"",
+		"The first event in the log is a Spec ID event in PCR 0"},
+	{ComplianceRuleSpecIdEventUnique, "SPEC_ID_EVENT_UNIQUE", "section 9.4.5.1 \"Specification ID Version Event\"",
+		"The log contains only one Spec ID event"},
+	{ComplianceRuleNoActionDigestZero, "NO_ACTION_DIGEST_ZERO", "section 10.4.1 \"Event Types\"",
+		"The digests of EV_NO_ACTION events are zero"},
+	{ComplianceRuleSeparatorPresent, "SEPARATOR_PRESENT", "section 3.3.4 \"PCR Usage\"",
+		"An EV_SEPARATOR event is measured to each of PCRs 0-7"},
+	{ComplianceRuleSeparatorUnique, "SEPARATOR_UNIQUE", "section 3.3.4 \"PCR Usage\"",
+		"Only one EV_SEPARATOR event is measured to each of PCRs 0-7"},
+	{ComplianceRuleSeparatorBeforeOSPresent, "SEPARATOR_BEFORE_OS_PRESENT", "section 3.3.4 \"PCR Usage\"",
+		"The EV_SEPARATOR events in PCRs 0-7 are measured before ExitBootServices is called"},
+	{ComplianceRuleEFIActionString, "EFI_ACTION_STRING", "section 10.4.4 \"EV_EFI_ACTION Event Types\"",
+		"EV_EFI_ACTION events contain one of the strings defined by the specification"},
+	{ComplianceRuleEventPCR, "EVENT_PCR", "section 10.4.1 \"Event Types\"",
+		"Events are measured to the PCRs that the specification assigns to their type"},
+}
+
+// ComplianceRules returns a description of every compliance rule, in the order in which they are defined.
+func ComplianceRules() []ComplianceRuleInfo {
+	return append([]ComplianceRuleInfo(nil), complianceRuleInfos[:]...)
+}
+
+// Code returns the stable identifier for this rule (eg, "SEPARATOR_PRESENT").
+func (r ComplianceRule) Code() string {
+	if r >= 0 && int(r) < len(complianceRuleInfos) {
+		return complianceRuleInfos[r].Code
+	}
+	return fmt.Sprintf("COMPLIANCE_RULE_%d", int(r))
+}
+
+// Section returns the section of the specification that this rule is from.
+func (r ComplianceRule) Section() string {
+	if r >= 0 && int(r) < len(complianceRuleInfos) {
+		return complianceRuleInfos[r].Section
+	}
+	return ""
+}
+
+func (r ComplianceRule) String() string {
+	return r.Code()
+}
+
+// ComplianceViolation describes a way in which a log doesn't comply with the TCG PC Client Platform Firmware Profile
+// specification.
+type ComplianceViolation struct {
+	Severity    Severity
+	Rule        ComplianceRule
+	Event       *Event // The event that violates the rule, or nil if the violation isn't associated with an event
+	Description string
+}
+
+func (v *ComplianceViolation) String() string {
+	return fmt.Sprintf("[%s] %s: %s (%s)", v.Severity, v.Rule.Code(), v.Description, v.Rule.Section())
+}
+
+// efiActionStrings are the strings that the specification defines for EV_EFI_ACTION events.
+//
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+//  (section 10.4.4 "EV_EFI_ACTION Event Types")
+var efiActionStrings = map[string]bool{
+	actionCallingBootOption:          true,
+	actionReturningBootOption:        true,
+	actionExitBootServicesInvocation: true,
+	actionExitBootServicesFailure:    true,
+	actionExitBootServicesSuccess:    true,
+	"DMA Protection Disabled":        true, // Added in version 1.05
+}
+
+// eventTypePCRs are the PCRs that the specification assigns to event types that may only be measured to specific
+// PCRs.
+//
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+//  (section 10.4.1 "Event Types")
+var eventTypePCRs = map[EventType][]PCRIndex{
+	EventTypeSCRTMContents:           {0},
+	EventTypeSCRTMVersion:            {0},
+	EventTypeEFIHCRTMEvent:           {0},
+	EventTypeEFIPlatformFirmwareBlob: {0, 2},
+	EventTypeEFIVariableBoot:         {1},
+	EventTypeEFIHandoffTables:        {1},
+	EventTypeEFIHandoffTables2:       {1},
+	EventTypeEFIGPTEvent:             {5},
+}
+
+func checkSpecIdEvents(events []*Event) (out []*ComplianceViolation) {
+	if len(events) == 0 || !isSpecIdEvent(events[0]) {
+		v := &ComplianceViolation{Severity: SeverityError, Rule: ComplianceRuleSpecIdEventFirst,
+			Description: "the log doesn't begin with a Spec ID event"}
+		if len(events) > 0 {
+			v.Event = events[0]
+		}
+		out = append(out, v)
+	} else if events[0].PCRIndex != 0 {
+		out = append(out, &ComplianceViolation{Severity: SeverityError, Rule: ComplianceRuleSpecIdEventFirst,
+			Event:       events[0],
+			Description: fmt.Sprintf("the Spec ID event is in PCR %d instead of PCR 0", events[0].PCRIndex)})
+	}
+
+	for i, e := range events {
+		if i == 0 || !isSpecIdEvent(e) {
+			continue
+		}
+		out = append(out, &ComplianceViolation{Severity: SeverityError, Rule: ComplianceRuleSpecIdEventUnique,
+			Event:       e,
+			Description: fmt.Sprintf("event %d in PCR %d is an additional Spec ID event", e.Index, e.PCRIndex)})
+	}
+	return out
+}
+
+func checkNoActionDigests(events []*Event) (out []*ComplianceViolation) {
+	for _, e := range events {
+		if e.EventType != EventTypeNoAction {
+			continue
+		}
+		for _, alg := range e.Digests.Algorithms() {
+			digest := e.Digests.Get(alg)
+			if bytes.Equal(digest, make(Digest, len(digest))) {
+				continue
+			}
+			out = append(out, &ComplianceViolation{Severity: SeverityError, Rule: ComplianceRuleNoActionDigestZero,
+				Event: e,
+				Description: fmt.Sprintf("EV_NO_ACTION event %d in PCR %d has a non-zero %s digest (%x)", e.Index,
+					e.PCRIndex, alg, digest)})
+		}
+	}
+	return out
+}
+
+func checkComplianceSeparators(events []*Event) (out []*ComplianceViolation) {
+	// The OS-present environment starts when the OS loader calls ExitBootServices. Logs from legacy BIOS systems
+	// don't record this, in which case the position of the separators isn't checked.
+	osPresent := len(events)
+	for i, e := range events {
+		if e.EventType == EventTypeEFIAction && e.Data() != nil &&
+			string(e.Data().Bytes()) == actionExitBootServicesInvocation {
+			osPresent = i
+			break
+		}
+	}
+
+	positions := make(map[*Event]int)
+	for i, e := range events {
+		if e.EventType == EventTypeSeparator {
+			positions[e] = i
+		}
+	}
+
+	separators := CheckSeparators(events)
+	for pcr := PCRIndex(0); pcr < 8; pcr++ {
+		s := separators[pcr]
+		switch {
+		case !s.Present():
+			out = append(out, &ComplianceViolation{Severity: SeverityError, Rule: ComplianceRuleSeparatorPresent,
+				Description: fmt.Sprintf("no EV_SEPARATOR event was measured to PCR %d", pcr)})
+			continue
+		case s.Duplicated():
+			for _, e := range s.Events[1:] {
+				out = append(out, &ComplianceViolation{Severity: SeverityError,
+					Rule: ComplianceRuleSeparatorUnique, Event: e,
+					Description: fmt.Sprintf("event %d is an additional EV_SEPARATOR event in PCR %d", e.Index,
+						pcr)})
+			}
+		}
+		if first := s.Events[0]; positions[first] > osPresent {
+			out = append(out, &ComplianceViolation{Severity: SeverityError,
+				Rule: ComplianceRuleSeparatorBeforeOSPresent, Event: first,
+				Description: fmt.Sprintf("the EV_SEPARATOR event in PCR %d was measured after ExitBootServices was "+
+					"called", pcr)})
+		}
+	}
+	return out
+}
+
+func checkEFIActionStrings(events []*Event) (out []*ComplianceViolation) {
+	for _, e := range events {
+		if e.EventType != EventTypeEFIAction || e.Data() == nil {
+			continue
+		}
+		data := e.Data().Bytes()
+		if efiActionStrings[string(data)] {
+			continue
+		}
+		description := fmt.Sprintf("EV_EFI_ACTION event %d in PCR %d contains a string that isn't defined by the "+
+			"specification (%q)", e.Index, e.PCRIndex, data)
+		if trimmed := bytes.TrimRight(data, "\x00"); len(trimmed) < len(data) && efiActionStrings[string(trimmed)] {
+			description = fmt.Sprintf("EV_EFI_ACTION event %d in PCR %d contains a NULL terminated string (%q)",
+				e.Index, e.PCRIndex, trimmed)
+		}
+		out = append(out, &ComplianceViolation{Severity: SeverityWarning, Rule: ComplianceRuleEFIActionString,
+			Event: e, Description: description})
+	}
+	return out
+}
+
+func checkEventPCRs(events []*Event) (out []*ComplianceViolation) {
+	for _, e := range events {
+		pcrs, ok := eventTypePCRs[e.EventType]
+		if !ok {
+			continue
+		}
+		permitted := false
+		for _, pcr := range pcrs {
+			if e.PCRIndex == pcr {
+				permitted = true
+				break
+			}
+		}
+		if permitted {
+			continue
+		}
+		out = append(out, &ComplianceViolation{Severity: SeverityWarning, Rule: ComplianceRuleEventPCR, Event: e,
+			Description: fmt.Sprintf("%s event %d is measured to PCR %d instead of PCR %v", e.EventType, e.Index,
+				e.PCRIndex, pcrs)})
+	}
+	return out
+}
+
+// CheckCompliance checks the structure of the supplied events from a log against the requirements of the TCG PC
+// Client Platform Firmware Profile specification (see ComplianceSpecification), and returns the violations in the
+// order of the rules that they violate. This is stricter than validating the log, and many platforms have violations
+// that don't affect the usefulness of their logs (eg, EV_EFI_ACTION events with vendor defined strings). The events
+// must include every event from the log, starting with the first one.
+func CheckCompliance(events []*Event) []*ComplianceViolation {
+	var out []*ComplianceViolation
+	out = append(out, checkSpecIdEvents(events)...)
+	out = append(out, checkNoActionDigests(events)...)
+	out = append(out, checkComplianceSeparators(events)...)
+	out = append(out, checkEFIActionStrings(events)...)
+	out = append(out, checkEventPCRs(events)...)
+	return out
+}
@@ -0,0 +1,95 @@
+package tcglog
+
+import (
+	"testing"
+)
+
+func TestCheckCompliance(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+	separator := func(pcr PCRIndex) testLogEvent {
+		return makeTestLogEvent(pcr, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...)
+	}
+	action := func(pcr PCRIndex, s string) testLogEvent {
+		return makeTestLogEvent(pcr, EventTypeEFIAction, []byte(s), algs...)
+	}
+
+	t.Run("Compliant", func(t *testing.T) {
+		events := []testLogEvent{action(4, "Calling EFI Application from Boot Option")}
+		for pcr := PCRIndex(0); pcr < 8; pcr++ {
+			events = append(events, separator(pcr))
+		}
+		events = append(events, action(5, "Exit Boot Services Invocation"),
+			action(5, "Exit Boot Services Returned with Success"))
+
+		violations := CheckCompliance(readAllTestLogEvents(t, makeTestLog_2(algs, events), LogOptions{}))
+		for _, v := range violations {
+			t.Errorf("Unexpected violation: %s", v)
+		}
+	})
+
+	t.Run("NonCompliant", func(t *testing.T) {
+		noAction := makeTestLogEvent(0, EventTypeNoAction, []byte("foo"), algs...)
+		events := []testLogEvent{
+			noAction,
+			action(4, "Calling EFI Application from Boot Option\x00"),
+			action(2, "Capsule Update"),
+			makeTestLogEvent(4, EventTypeEFIGPTEvent, []byte("gpt"), algs...),
+		}
+		for pcr := PCRIndex(0); pcr < 7; pcr++ {
+			if pcr != 3 {
+				events = append(events, separator(pcr))
+			}
+		}
+		events = append(events, separator(4), action(5, "Exit Boot Services Invocation"), separator(7))
+
+		violations := CheckCompliance(readAllTestLogEvents(t, makeTestLog_2(algs, events), LogOptions{}))
+		expected := []ComplianceRule{
+			ComplianceRuleNoActionDigestZero,
+			ComplianceRuleSeparatorPresent,
+			ComplianceRuleSeparatorUnique,
+			ComplianceRuleSeparatorBeforeOSPresent,
+			ComplianceRuleEFIActionString,
+			ComplianceRuleEFIActionString,
+			ComplianceRuleEventPCR,
+		}
+		if len(violations) != len(expected) {
+			t.Fatalf("Unexpected number of violations: %d (%v)", len(violations), violations)
+		}
+		for i, v := range violations {
+			if v.Rule != expected[i] {
+				t.Errorf("Unexpected violation %d: %s", i, v)
+			}
+		}
+		if violations[2].Event.PCRIndex != 4 || violations[3].Event.PCRIndex != 7 {
+			t.Errorf("Unexpected separator events")
+		}
+		if v := violations[4]; v.Description != "EV_EFI_ACTION event 0 in PCR 4 contains a NULL terminated "+
+			"string (\"Calling EFI Application from Boot Option\")" {
+			t.Errorf("Unexpected description: %s", v.Description)
+		}
+	})
+
+	t.Run("MissingSpecIdEvent", func(t *testing.T) {
+		events := readAllTestLogEvents(t, makeTestLog_1_2([]testLogEvent{
+			makeTestLogEvent(0, EventTypeSCRTMVersion, []byte("1.0"), AlgorithmSha1)}), LogOptions{})
+		violations := CheckCompliance(events)
+		if len(violations) == 0 || violations[0].Rule != ComplianceRuleSpecIdEventFirst ||
+			violations[0].Event != events[0] {
+			t.Errorf("Unexpected violations: %v", violations)
+		}
+	})
+}
+
+func TestComplianceRules(t *testing.T) {
+	rules := ComplianceRules()
+	if len(rules) != int(ComplianceRuleEventPCR)+1 {
+		t.Fatalf("Unexpected number of rules: %d", len(rules))
+	}
+	seen := make(map[string]bool)
+	for i, r := range rules {
+		if r.Rule != ComplianceRule(i) || r.Code == "" || r.Section == "" || seen[r.Code] {
+			t.Errorf("Invalid rule info: %+v", r)
+		}
+		seen[r.Code] = true
+	}
+}
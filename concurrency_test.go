@@ -0,0 +1,166 @@
+package tcglog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// These tests share a single parsed log or validation result between goroutines that only read it, and are intended
+// to be run with the race detector (go test -race) to catch any hidden mutation on the read paths.
+
+const testConcurrentReaders = 8
+
+func makeTestConcurrencyLog() []byte {
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+	return makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(0, EventTypeSCRTMVersion, []byte("1\x00"), algs...),
+		makeTestLogEvent(7, EventTypeEFIVariableDriverConfig,
+			makeTestVariableEventData(convertStringToUtf16("SecureBoot")), algs...),
+		makeTestLogEvent(4, EventTypeEFIAction, []byte("Calling EFI Application from Boot Option"), algs...),
+		makeTestLogEvent(7, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...),
+		makeTestLogEvent(4, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...),
+		makeTestLogEvent(8, EventTypeIPL, []byte("grub_cmd: linux /vmlinuz\x00"), algs...),
+	})
+}
+
+func runConcurrently(fn func()) {
+	var wg sync.WaitGroup
+	for i := 0; i < testConcurrentReaders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn()
+		}()
+	}
+	wg.Wait()
+}
+
+// readEvent exercises the read-only methods of an event.
+func readEvent(e *Event) string {
+	s := e.EventType.String()
+	for _, alg := range e.Digests.Algorithms() {
+		s += fmt.Sprintf("%x", e.Digests.Get(alg))
+	}
+	s += fmt.Sprintf("%x", e.Digests.Map()[AlgorithmSha256])
+	if e.Data() != nil {
+		s += e.Data().String() + string(e.Data().Bytes())
+	}
+	if b, err := json.Marshal(e); err == nil {
+		s += string(b)
+	}
+	CheckInternalLengths(e)
+	CheckUTF16Strings(e)
+	return s
+}
+
+func TestConcurrentEventReaders(t *testing.T) {
+	events := readAllTestLogEvents(t, makeTestConcurrencyLog(), LogOptions{EnableGrub: true})
+
+	var expected []string
+	for _, e := range events {
+		expected = append(expected, readEvent(e))
+	}
+
+	runConcurrently(func() {
+		for i, e := range events {
+			if s := readEvent(e); s != expected[i] {
+				t.Errorf("Unexpected result for event %d", i)
+			}
+		}
+		DiffLogs(events, events)
+		CheckSeparators(events)
+		DetermineStartupSequence(events)
+		FindFirmwareErrors(events)
+		if _, err := replayEvents(events, AlgorithmIdList{AlgorithmSha1, AlgorithmSha256}); err != nil {
+			t.Errorf("replayEvents failed: %v", err)
+		}
+	})
+}
+
+func TestConcurrentValidateResultReaders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log")
+	if err := ioutil.WriteFile(path, makeTestConcurrencyLog(), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	result, err := ReplayAndValidateLog(path, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayAndValidateLog failed: %v", err)
+	}
+	expectedValues := result.ExpectedPCRValues
+
+	runConcurrently(func() {
+		for _, e := range result.ValidatedEvents {
+			readEvent(e.Event)
+			e.TrailingBytes()
+			e.HasTrailingMeasuredBytes()
+		}
+		for _, pcr := range result.ExpectedPCRValues.PCRs() {
+			for _, alg := range result.ExpectedPCRValues[pcr].Algorithms() {
+				_ = fmt.Sprintf("%x", result.ExpectedPCRValues[pcr][alg])
+			}
+		}
+		result.PlatformBehaviour()
+	})
+
+	if !reflect.DeepEqual(result.ExpectedPCRValues, expectedValues) {
+		t.Errorf("ExpectedPCRValues was modified by readers")
+	}
+}
+
+func TestConcurrentLogsDontShareDigests(t *testing.T) {
+	data := makeTestConcurrencyLog()
+	a := readAllTestLogEvents(t, data, LogOptions{})
+	b := readAllTestLogEvents(t, data, LogOptions{})
+
+	// The Spec ID event gets zero digests for the algorithms other than SHA-1. These mustn't alias between logs, so
+	// that modifying one doesn't affect the other.
+	da := a[0].Digests.Get(AlgorithmSha256)
+	db := b[0].Digests.Get(AlgorithmSha256)
+	if len(da) == 0 || len(db) == 0 {
+		t.Fatalf("Missing digests for Spec ID event")
+	}
+	da[0] = 0xff
+	if db[0] != 0 || zeroDigests[AlgorithmSha256][0] != 0 {
+		t.Errorf("Spec ID event digests share storage")
+	}
+}
+
+func TestConcurrentCachingContentResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kernel")
+	if err := ioutil.WriteFile(path, []byte("kernel"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	event := &Event{EventType: EventTypeIPL,
+		Digests: NewEventDigests(DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte("kernel"))})}
+	resolver := NewCachingContentResolver(testContentResolverFunc(func(*Event) (string, error) { return path, nil }), nil)
+
+	runConcurrently(func() {
+		if p, err := resolver.ResolveContent(event); err != nil || p != path {
+			t.Errorf("Unexpected result: %s, %v", p, err)
+		}
+	})
+}
+
+type testContentResolverFunc func(event *Event) (string, error)
+
+func (f testContentResolverFunc) ResolveContent(event *Event) (string, error) {
+	return f(event)
+}
@@ -30,11 +30,41 @@ const (
 	EventTypeEFIGPTEvent                EventType = 0x80000006 // EV_EFI_GPT_EVENT
 	EventTypeEFIAction                  EventType = 0x80000007 // EV_EFI_ACTION
 	EventTypeEFIPlatformFirmwareBlob    EventType = 0x80000008 // EV_EFI_PLATFORM_FIRMWARE_BLOB
-	EventTypeEFIHandoffTables           EventType = 0x80000009 // EF_EFI_HANDOFF_TABLES
-	EventTypeEFIHCRTMEvent              EventType = 0x80000010 // EF_EFI_HCRTM_EVENT
+	EventTypeEFIHandoffTables           EventType = 0x80000009 // EV_EFI_HANDOFF_TABLES
+	EventTypeEFIPlatformFirmwareBlob2   EventType = 0x8000000a // EV_EFI_PLATFORM_FIRMWARE_BLOB2
+	EventTypeEFIHandoffTables2          EventType = 0x8000000b // EV_EFI_HANDOFF_TABLES2
+	EventTypeEFIHCRTMEvent              EventType = 0x80000010 // EV_EFI_HCRTM_EVENT
 	EventTypeEFIVariableAuthority       EventType = 0x800000e0 // EV_EFI_VARIABLE_AUTHORITY
 )
 
+// Event types used by Intel TXT for measurements made by the SINIT ACM and the MLE during a D-RTM launch, as defined
+// in the Intel TXT Software Development Guide.
+const (
+	EventTypeTXTPCRMapping         EventType = 0x00000401 // EVTYPE_PCRMAPPING
+	EventTypeTXTHashStart          EventType = 0x00000402 // EVTYPE_HASH_START
+	EventTypeTXTCombinedHash       EventType = 0x00000403 // EVTYPE_COMBINED_HASH
+	EventTypeTXTMLEHash            EventType = 0x00000404 // EVTYPE_MLE_HASH
+	EventTypeTXTBIOSACRegData      EventType = 0x0000040a // EVTYPE_BIOSAC_REG_DATA
+	EventTypeTXTCPUSCRTMStat       EventType = 0x0000040b // EVTYPE_CPU_SCRTM_STAT
+	EventTypeTXTLCPControlHash     EventType = 0x0000040c // EVTYPE_LCP_CONTROL_HASH
+	EventTypeTXTElementsHash       EventType = 0x0000040d // EVTYPE_ELEMENTS_HASH
+	EventTypeTXTSTMHash            EventType = 0x0000040e // EVTYPE_STM_HASH
+	EventTypeTXTOSSinitDataCapHash EventType = 0x0000040f // EVTYPE_OSSINITDATA_CAP_HASH
+	EventTypeTXTSinitPubKeyHash    EventType = 0x00000410 // EVTYPE_SINIT_PUBKEY_HASH
+	EventTypeTXTLCPHash            EventType = 0x00000411 // EVTYPE_LCP_HASH
+	EventTypeTXTLCPDetailsHash     EventType = 0x00000412 // EVTYPE_LCP_DETAILS_HASH
+	EventTypeTXTLCPAuthoritiesHash EventType = 0x00000413 // EVTYPE_LCP_AUTHORITIES_HASH
+	EventTypeTXTNVInfoHash         EventType = 0x00000414 // EVTYPE_NV_INFO_HASH
+	EventTypeTXTColdBootBIOSHash   EventType = 0x00000415 // EVTYPE_COLD_BOOT_BIOS_HASH
+	EventTypeTXTKMHash             EventType = 0x00000416 // EVTYPE_KM_HASH
+	EventTypeTXTBPMHash            EventType = 0x00000417 // EVTYPE_BPM_HASH
+	EventTypeTXTKMInfoHash         EventType = 0x00000418 // EVTYPE_KM_INFO_HASH
+	EventTypeTXTBPMInfoHash        EventType = 0x00000419 // EVTYPE_BPM_INFO_HASH
+	EventTypeTXTBootPolHash        EventType = 0x0000041a // EVTYPE_BOOT_POL_HASH
+	EventTypeTXTRandomValue        EventType = 0x000004fe // EVTYPE_RANDOM_VALUE
+	EventTypeTXTCapValue           EventType = 0x000004ff // EVTYPE_CAP_VALUE
+)
+
 const (
 	AlgorithmSha1   AlgorithmId = 0x0004 // TPM_ALG_SHA1
 	AlgorithmSha256 AlgorithmId = 0x000b // TPM_ALG_SHA256
@@ -44,7 +74,8 @@ const (
 
 const (
 	// SpecUnknown indicates that the specification to which the log conforms is unknown because it doesn't
-	// start with a spec ID event.
+	// start with a spec ID event. Some older EFI firmware for TPM 1.2 doesn't record one, so these logs are
+	// read as SHA-1 logs in the TCG_PCClientPCREventStruct format.
 	SpecUnknown Spec = iota
 
 	// SpecPCClient indicates that the log conforms to "TCG PC Client Specific Implementation Specification
@@ -65,3 +96,35 @@ const (
 const (
 	separatorEventErrorValue uint32 = 1
 )
+
+const (
+	// EventQuirkDigestCountMismatch indicates that the number of digests specified in the header of a crypto-agile
+	// event didn't match the number of algorithms in the Spec ID event. In this case, the digests were parsed
+	// using their algorithm identifiers rather than the count from the header.
+	EventQuirkDigestCountMismatch EventQuirk = iota + 1
+
+	// EventQuirkTrailingPadding indicates that the event was followed by undocumented padding bytes before the
+	// start of the next event. The padding was skipped.
+	EventQuirkTrailingPadding
+
+	// EventQuirkDuplicateDigest indicates that a crypto-agile event contains more than one digest for the same
+	// algorithm. All of them are recorded in Event.RawDigests, but only the first is used in Event.Digests.
+	EventQuirkDuplicateDigest
+
+	// EventQuirkUnexpectedDigestAlgorithm indicates that a crypto-agile event contains a digest for an algorithm that
+	// isn't in the Spec ID event. It is recorded in Event.RawDigests, but not in Event.Digests.
+	EventQuirkUnexpectedDigestAlgorithm
+
+	// EventQuirkInconsistentInternalLengths indicates that the length fields inside the event data structure don't
+	// agree with the size of the event data. See CheckInternalLengths. This is detected when the event data is
+	// decoded, so it doesn't appear in Event.Quirks - use Event.HasQuirk to check for it.
+	EventQuirkInconsistentInternalLengths
+
+	// EventQuirkPrecededByGap indicates that the event follows a corrupt region of the log that was skipped in
+	// permissive mode (see LogOptions.Permissive and Log.Gaps).
+	EventQuirkPrecededByGap
+
+	// EventQuirkUnexpectedSpecIdEvent indicates that the event is a Spec ID event that isn't the first event of the
+	// log, or that isn't measured to PCR 0. It doesn't affect the format of the log (see Log.HeaderEvents).
+	EventQuirkUnexpectedSpecIdEvent
+)
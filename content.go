@@ -0,0 +1,154 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// ErrContentNotFound is returned from a ContentResolver when it cannot locate the content for an event.
+var ErrContentNotFound = errors.New("content not found")
+
+// ContentResolver is implemented by types that can locate the content that was measured for an event (eg, the
+// image for an image load event), so that the event can be verified.
+type ContentResolver interface {
+	// ResolveContent returns the path of a local file containing the content measured by the supplied event. It
+	// should return ErrContentNotFound if the content isn't known to this resolver.
+	ResolveContent(event *Event) (string, error)
+}
+
+// ContentResolverChain is a ContentResolver that tries each of its resolvers in turn, returning the result of the
+// first one that doesn't return ErrContentNotFound.
+type ContentResolverChain []ContentResolver
+
+func (c ContentResolverChain) ResolveContent(event *Event) (string, error) {
+	for _, r := range c {
+		path, err := r.ResolveContent(event)
+		if err == ErrContentNotFound {
+			continue
+		}
+		return path, err
+	}
+	return "", ErrContentNotFound
+}
+
+// ContentDigestMismatchError is returned from CachingContentResolver when the resolved content doesn't have the
+// digest recorded in the log, eg, because the file was modified after boot.
+type ContentDigestMismatchError struct {
+	Path      string
+	Algorithm AlgorithmId
+	Expected  Digest // The digest recorded in the log
+	Actual    Digest // The digest of the resolved content
+}
+
+func (e *ContentDigestMismatchError) Error() string {
+	return fmt.Sprintf("%s digest of %s doesn't match the log (expected: %x, got: %x)", e.Algorithm, e.Path,
+		e.Expected, e.Actual)
+}
+
+// CachingContentResolver is a ContentResolver that wraps another ContentResolver, and verifies that the content
+// resolved for an event has the digests recorded in the log before returning it. Verified content is cached by
+// digest, so that events that measure the same content are only resolved and verified once. Use
+// NewCachingContentResolver to create one. It is safe for concurrent use if the wrapped ContentResolver and
+// ImageDigester are.
+type CachingContentResolver struct {
+	resolver ContentResolver
+	digester ImageDigester
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// NewCachingContentResolver returns a new CachingContentResolver that wraps resolver. The supplied ImageDigester is
+// used to verify the content resolved for image load events, which are measured with the Authenticode digest of the
+// image rather than the digest of the file. If it is nil, content for image load events can't be verified and
+// ResolveContent will return an error for them. The content for all other events is verified by hashing the file.
+func NewCachingContentResolver(resolver ContentResolver, digester ImageDigester) *CachingContentResolver {
+	return &CachingContentResolver{
+		resolver: resolver,
+		digester: digester,
+		cache:    make(map[string]string)}
+}
+
+func contentCacheKey(event *Event) (string, bool) {
+	algs := event.Digests.Algorithms()
+	if len(algs) == 0 {
+		return "", false
+	}
+	return fmt.Sprintf("%s:%s", algs[0], hex.EncodeToString(event.Digests.Get(algs[0]))), true
+}
+
+func (r *CachingContentResolver) verifyContent(event *Event, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if isImageLoadEventType(event.EventType) {
+		if r.digester == nil {
+			return errors.New("cannot verify image without an image digester")
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		incorrect, err := VerifyImageLoadEvent(event, f, info.Size(), r.digester)
+		if err != nil {
+			return err
+		}
+		if len(incorrect) > 0 {
+			v := incorrect[0]
+			return &ContentDigestMismatchError{Path: path, Algorithm: v.Algorithm, Expected: event.Digests.Get(v.Algorithm),
+				Actual: v.Expected}
+		}
+		return nil
+	}
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	for _, alg := range event.Digests.Algorithms() {
+		if !alg.supported() {
+			continue
+		}
+		if digest := alg.hash(data); !bytes.Equal(digest, event.Digests.Get(alg)) {
+			return &ContentDigestMismatchError{Path: path, Algorithm: alg, Expected: event.Digests.Get(alg), Actual: digest}
+		}
+	}
+	return nil
+}
+
+// ResolveContent resolves the content for the supplied event using the wrapped ContentResolver, and verifies that it
+// has the digests recorded in the log. A *ContentDigestMismatchError is returned if it doesn't.
+func (r *CachingContentResolver) ResolveContent(event *Event) (string, error) {
+	key, ok := contentCacheKey(event)
+	if !ok {
+		return "", ErrContentNotFound
+	}
+
+	r.mu.Lock()
+	path, cached := r.cache[key]
+	r.mu.Unlock()
+	if cached {
+		return path, nil
+	}
+
+	path, err := r.resolver.ResolveContent(event)
+	if err != nil {
+		return "", err
+	}
+	if err := r.verifyContent(event, path); err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	r.cache[key] = path
+	r.mu.Unlock()
+	return path, nil
+}
@@ -0,0 +1,95 @@
+package tcglog
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testContentResolver struct {
+	path  string
+	calls int
+}
+
+func (r *testContentResolver) ResolveContent(event *Event) (string, error) {
+	r.calls++
+	return r.path, nil
+}
+
+func TestCachingContentResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-content")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "kernel")
+	if err := ioutil.WriteFile(path, []byte("kernel"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	inner := &testContentResolver{path: path}
+	resolver := NewCachingContentResolver(ContentResolverChain{inner}, nil)
+
+	event := &Event{EventType: EventTypeIPL, Digests: NewEventDigests(DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte("kernel"))})}
+	for i := 0; i < 2; i++ {
+		p, err := resolver.ResolveContent(event)
+		if err != nil {
+			t.Fatalf("ResolveContent failed: %v", err)
+		}
+		if p != path {
+			t.Errorf("Unexpected path: %s", p)
+		}
+	}
+	if inner.calls != 1 {
+		t.Errorf("Expected the content to be resolved once (got %d)", inner.calls)
+	}
+
+	modified := &Event{EventType: EventTypeIPL, Digests: NewEventDigests(DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte("old kernel"))})}
+	_, err = resolver.ResolveContent(modified)
+	e, ok := err.(*ContentDigestMismatchError)
+	if !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if e.Path != path || e.Algorithm != AlgorithmSha256 {
+		t.Errorf("Unexpected error: %v", e)
+	}
+}
+
+func TestCachingContentResolverImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-content")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "shimx64.efi")
+	if err := ioutil.WriteFile(path, []byte("shim"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	digester := ImageDigesterFunc(func(r io.ReaderAt, size int64, alg AlgorithmId) (Digest, error) {
+		data := make([]byte, size)
+		if _, err := r.ReadAt(data, 0); err != nil {
+			return nil, err
+		}
+		return alg.hash(append([]byte("authenticode:"), data...)), nil
+	})
+
+	event := &Event{EventType: EventTypeEFIBootServicesApplication,
+		Digests: NewEventDigests(DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte("authenticode:shim"))})}
+
+	if _, err := NewCachingContentResolver(&testContentResolver{path: path}, nil).ResolveContent(event); err == nil {
+		t.Errorf("Expected an error without an image digester")
+	}
+
+	p, err := NewCachingContentResolver(&testContentResolver{path: path}, digester).ResolveContent(event)
+	if err != nil {
+		t.Fatalf("ResolveContent failed: %v", err)
+	}
+	if p != path {
+		t.Errorf("Unexpected path: %s", p)
+	}
+}
@@ -0,0 +1,686 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"unicode/utf16"
+)
+
+type efiDevicePathNodeType uint8
+
+func (t efiDevicePathNodeType) String() string {
+	switch t {
+	case efiDevicePathNodeHardware:
+		return "HardwarePath"
+	case efiDevicePathNodeACPI:
+		return "AcpiPath"
+	case efiDevicePathNodeMsg:
+		return "Msg"
+	case efiDevicePathNodeMedia:
+		return "MediaPath"
+	case efiDevicePathNodeBBS:
+		return "BbsPath"
+	default:
+		return fmt.Sprintf("Path[%02x]", uint8(t))
+	}
+}
+
+const (
+	efiDevicePathNodeHardware efiDevicePathNodeType = 0x01
+	efiDevicePathNodeACPI                           = 0x02
+	efiDevicePathNodeMsg                            = 0x03
+	efiDevicePathNodeMedia                          = 0x04
+	efiDevicePathNodeBBS                            = 0x05
+	efiDevicePathNodeEoH                            = 0x7f
+)
+
+const (
+	efiHardwareDevicePathNodePCI    = 0x01
+	efiHardwareDevicePathNodeVendor = 0x04
+
+	efiACPIDevicePathNodeNormal = 0x01
+
+	efiMsgDevicePathNodeUSB      = 0x05
+	efiMsgDevicePathNodeVendor   = 0x0a
+	efiMsgDevicePathNodeMAC      = 0x0b
+	efiMsgDevicePathNodeIPv4     = 0x0c
+	efiMsgDevicePathNodeIPv6     = 0x0d
+	efiMsgDevicePathNodeUSBClass = 0x0f
+	efiMsgDevicePathNodeUSBWWID  = 0x10
+	efiMsgDevicePathNodeLU       = 0x11
+	efiMsgDevicePathNodeSATA     = 0x12
+	efiMsgDevicePathNodeISCSI    = 0x13
+	efiMsgDevicePathNodeNVMe     = 0x17
+	efiMsgDevicePathNodeURI      = 0x18
+	efiMsgDevicePathNodeSD       = 0x1a
+	efiMsgDevicePathNodeEMMC     = 0x1d
+
+	efiMediaDevicePathNodeHardDrive      = 0x01
+	efiMediaDevicePathNodeVendor         = 0x03
+	efiMediaDevicePathNodeFilePath       = 0x04
+	efiMediaDevicePathNodeFvFile         = 0x06
+	efiMediaDevicePathNodeFv             = 0x07
+	efiMediaDevicePathNodeRelOffsetRange = 0x08
+
+	efiEndDevicePathNodeInstance = 0x01
+	efiEndDevicePathNodeEntire   = 0xff
+)
+
+// EFIDevicePathStringStyle specifies the conventions used to convert a device path to text.
+type EFIDevicePathStringStyle int
+
+const (
+	// EFIDevicePathStringStyleEDK2 is the style of EDK2's DevicePathLib, which is also used by the UEFI Shell and
+	// in firmware debug output. Numbers are written in upper case hexadecimal, and file path nodes are written as
+	// the path.
+	EFIDevicePathStringStyleEDK2 EFIDevicePathStringStyle = iota
+
+	// EFIDevicePathStringStyleEfibootmgr is the style of efibootmgr and libefivar. Hexadecimal numbers and GUIDs
+	// are written in lower case, some numbers are written in decimal, and file path nodes are written as File(path).
+	EFIDevicePathStringStyleEfibootmgr
+)
+
+// EFIDevicePathNode is a single node of an EFI device path.
+type EFIDevicePathNode struct {
+	Type    uint8
+	SubType uint8
+	Data    []byte // The node data, excluding the header
+}
+
+// EFIDevicePath corresponds to the EFI_DEVICE_PATH_PROTOCOL type. The nodes include any end of instance nodes in
+// a path with multiple instances, but not the final end of path node.
+type EFIDevicePath []*EFIDevicePathNode
+
+// String returns the textual representation of this device path in the style of the UEFI Shell.
+func (p EFIDevicePath) String() string {
+	return p.StringCompat(EFIDevicePathStringStyleEDK2)
+}
+
+// StringCompat returns the textual representation of this device path in the specified style, for comparing with
+// the output of other tools.
+func (p EFIDevicePath) StringCompat(style EFIDevicePathStringStyle) string {
+	var builder bytes.Buffer
+	for i, node := range p {
+		if efiDevicePathNodeType(node.Type) == efiDevicePathNodeEoH {
+			builder.WriteString(",")
+			continue
+		}
+		if i > 0 && efiDevicePathNodeType(p[i-1].Type) != efiDevicePathNodeEoH {
+			builder.WriteString("/")
+		}
+		builder.WriteString(node.stringCompat(style))
+	}
+	return builder.String()
+}
+
+// efiDevicePathFormatter writes numbers and GUIDs according to a EFIDevicePathStringStyle.
+type efiDevicePathFormatter struct {
+	style EFIDevicePathStringStyle
+}
+
+func (f efiDevicePathFormatter) hex(v uint64) string {
+	if f.style == EFIDevicePathStringStyleEDK2 {
+		return fmt.Sprintf("0x%X", v)
+	}
+	return fmt.Sprintf("0x%x", v)
+}
+
+// num formats numbers that EDK2 writes in hexadecimal and libefivar writes in decimal.
+func (f efiDevicePathFormatter) num(v uint64) string {
+	if f.style == EFIDevicePathStringStyleEDK2 {
+		return f.hex(v)
+	}
+	return fmt.Sprintf("%d", v)
+}
+
+func (f efiDevicePathFormatter) bytes(data []byte) string {
+	if f.style == EFIDevicePathStringStyleEDK2 {
+		return fmt.Sprintf("%X", data)
+	}
+	return fmt.Sprintf("%x", data)
+}
+
+func (f efiDevicePathFormatter) guid(g *EFIGUID) string {
+	s := fmt.Sprintf("%08x-%04x-%04x-%04x-%012x", g.Data1, g.Data2, g.Data3,
+		binary.BigEndian.Uint16(g.Data4[0:2]), g.Data4[2:])
+	if f.style == EFIDevicePathStringStyleEDK2 {
+		return strings.ToUpper(s)
+	}
+	return s
+}
+
+func readEFIDevicePathGUID(data []byte) (*EFIGUID, bool) {
+	if len(data) < efiGUIDSize {
+		return nil, false
+	}
+	guid := decodeEFIGUID(data)
+	return &guid, true
+}
+
+func (n *EFIDevicePathNode) acpiString(f efiDevicePathFormatter) (string, bool) {
+	if len(n.Data) < 8 {
+		return "", false
+	}
+	hid := binary.LittleEndian.Uint32(n.Data)
+	uid := uint64(binary.LittleEndian.Uint32(n.Data[4:]))
+
+	if hid&0xffff != 0x41d0 {
+		return fmt.Sprintf("Acpi(%s,%s)", f.hex(uint64(hid)), f.hex(uid)), true
+	}
+	switch hid >> 16 {
+	case 0x0a03:
+		return fmt.Sprintf("PciRoot(%s)", f.hex(uid)), true
+	case 0x0a08:
+		return fmt.Sprintf("PcieRoot(%s)", f.hex(uid)), true
+	case 0x0604:
+		return fmt.Sprintf("Floppy(%s)", f.hex(uid)), true
+	case 0x0301:
+		return fmt.Sprintf("Keyboard(%s)", f.hex(uid)), true
+	case 0x0501:
+		return fmt.Sprintf("Serial(%s)", f.hex(uid)), true
+	case 0x0401:
+		return fmt.Sprintf("ParallelPort(%s)", f.hex(uid)), true
+	default:
+		return fmt.Sprintf("Acpi(PNP%04X,%s)", hid>>16, f.hex(uid)), true
+	}
+}
+
+func (n *EFIDevicePathNode) hardDriveString(f efiDevicePathFormatter) (string, bool) {
+	if len(n.Data) < 38 {
+		return "", false
+	}
+	partNumber := binary.LittleEndian.Uint32(n.Data)
+	partStart := binary.LittleEndian.Uint64(n.Data[4:])
+	partSize := binary.LittleEndian.Uint64(n.Data[12:])
+	sig := n.Data[20:36]
+	sigType := n.Data[37]
+
+	var s string
+	switch sigType {
+	case 0x01:
+		s = fmt.Sprintf("HD(%d,MBR,0x%s,", partNumber, f.bytes([]byte{sig[3], sig[2], sig[1], sig[0]}))
+	case 0x02:
+		guid, _ := readEFIDevicePathGUID(sig)
+		s = fmt.Sprintf("HD(%d,GPT,%s,", partNumber, f.guid(guid))
+	default:
+		s = fmt.Sprintf("HD(%d,%d,0,", partNumber, sigType)
+	}
+	return fmt.Sprintf("%s%s,%s)", s, f.hex(partStart), f.hex(partSize)), true
+}
+
+// efiMsgVendorTerminalTypes are the vendor-defined messaging device path nodes that identify a console terminal type,
+// which have their own textual representation.
+//
+// https://uefi.org/sites/default/files/resources/UEFI_Spec_2_8_final.pdf
+//  (section "Text Device Node Reference")
+var efiMsgVendorTerminalTypes = map[EFIGUID]string{
+	*NewEFIGUID(0xe0c14753, 0xf9be, 0x11d2, 0x9a0c, [...]uint8{0x00, 0x90, 0x27, 0x3f, 0xc1, 0x4d}): "VenPcAnsi",
+	*NewEFIGUID(0xdfa66065, 0xb419, 0x11d3, 0x9a2d, [...]uint8{0x00, 0x90, 0x27, 0x3f, 0xc1, 0x4d}): "VenVt100",
+	*NewEFIGUID(0x7baec70b, 0x57e0, 0x4c76, 0x8e87, [...]uint8{0x2f, 0x9e, 0x28, 0x08, 0x83, 0x43}): "VenVt100Plus",
+	*NewEFIGUID(0xad15a0d6, 0x8bec, 0x4acf, 0xa073, [...]uint8{0xd0, 0x1d, 0xe7, 0x7e, 0x2d, 0x88}): "VenUtf8",
+}
+
+// vendorString returns the textual representation of a vendor-defined node (VenHw, VenMsg or VenMedia), which
+// consists of the vendor GUID followed by any vendor-defined data as hexadecimal.
+func (n *EFIDevicePathNode) vendorString(f efiDevicePathFormatter, kind string) (string, bool) {
+	guid, ok := readEFIDevicePathGUID(n.Data)
+	if !ok {
+		return "", false
+	}
+	if name, ok := efiMsgVendorTerminalTypes[*guid]; ok && kind == "Msg" && len(n.Data) == 16 {
+		return name + "()", true
+	}
+	s := fmt.Sprintf("Ven%s(%s", kind, f.guid(guid))
+	if len(n.Data) > 16 {
+		s += "," + f.bytes(n.Data[16:])
+	}
+	return s + ")", true
+}
+
+func (n *EFIDevicePathNode) usbWWIDString(f efiDevicePathFormatter) (string, bool) {
+	if len(n.Data) < 6 {
+		return "", false
+	}
+	u16 := make([]uint16, (len(n.Data)-6)/2)
+	binary.Read(bytes.NewReader(n.Data[6:]), binary.LittleEndian, &u16)
+	for i, c := range u16 {
+		if c == 0 {
+			u16 = u16[:i]
+			break
+		}
+	}
+	return fmt.Sprintf("UsbWwid(%s,%s,%s,\"%s\")", f.hex(uint64(binary.LittleEndian.Uint16(n.Data[2:]))),
+		f.hex(uint64(binary.LittleEndian.Uint16(n.Data[4:]))),
+		f.hex(uint64(binary.LittleEndian.Uint16(n.Data))), string(utf16.Decode(u16))), true
+}
+
+func (n *EFIDevicePathNode) macString(f efiDevicePathFormatter) (string, bool) {
+	if len(n.Data) < 33 {
+		return "", false
+	}
+	ifType := n.Data[32]
+	addr := n.Data[:32]
+	if ifType == 0x00 || ifType == 0x01 {
+		// Ethernet, which has a 6 byte address
+		addr = addr[:6]
+	}
+	return fmt.Sprintf("MAC(%s,%s)", f.bytes(addr), f.hex(uint64(ifType))), true
+}
+
+func (f efiDevicePathFormatter) networkProtocol(protocol uint16) string {
+	switch protocol {
+	case 6:
+		return "TCP"
+	case 17:
+		return "UDP"
+	default:
+		return f.hex(uint64(protocol))
+	}
+}
+
+func (f efiDevicePathFormatter) ipv6(addr []byte) string {
+	if f.style == EFIDevicePathStringStyleEDK2 {
+		var groups []string
+		for i := 0; i < 16; i += 2 {
+			groups = append(groups, fmt.Sprintf("%02x%02x", addr[i], addr[i+1]))
+		}
+		return strings.Join(groups, ":")
+	}
+	return net.IP(addr).String()
+}
+
+// https://uefi.org/sites/default/files/resources/UEFI_Spec_2_8_final.pdf
+//  (section 10.3.4.12 "IPv4 Device Path")
+func (n *EFIDevicePathNode) ipv4String(f efiDevicePathFormatter) (string, bool) {
+	if len(n.Data) < 15 {
+		return "", false
+	}
+	origin := "DHCP"
+	if n.Data[14] != 0 {
+		origin = "Static"
+	}
+	s := fmt.Sprintf("IPv4(%s,%s,%s,%s", net.IP(n.Data[4:8]),
+		f.networkProtocol(binary.LittleEndian.Uint16(n.Data[12:])), origin, net.IP(n.Data[0:4]))
+	if len(n.Data) >= 23 {
+		s += fmt.Sprintf(",%s,%s", net.IP(n.Data[15:19]), net.IP(n.Data[19:23]))
+	}
+	return s + ")", true
+}
+
+// https://uefi.org/sites/default/files/resources/UEFI_Spec_2_8_final.pdf
+//  (section 10.3.4.13 "IPv6 Device Path")
+func (n *EFIDevicePathNode) ipv6String(f efiDevicePathFormatter) (string, bool) {
+	if len(n.Data) < 39 {
+		return "", false
+	}
+	var origin string
+	switch n.Data[38] {
+	case 0:
+		origin = "Static"
+	case 1:
+		origin = "StatelessAutoConfigure"
+	default:
+		origin = "StatefulAutoConfigure"
+	}
+	s := fmt.Sprintf("IPv6(%s,%s,%s,%s", f.ipv6(n.Data[16:32]),
+		f.networkProtocol(binary.LittleEndian.Uint16(n.Data[36:])), origin, f.ipv6(n.Data[0:16]))
+	if len(n.Data) >= 56 {
+		s += fmt.Sprintf(",%s,%s", f.ipv6(n.Data[40:56]), f.num(uint64(n.Data[39])))
+	}
+	return s + ")", true
+}
+
+// https://uefi.org/sites/default/files/resources/UEFI_Spec_2_8_final.pdf
+//  (section 10.3.4.22 "NVM Express Namespace Device Path")
+// The IEEE Extended Unique Identifier is stored in little-endian order, but is written most significant byte first.
+func (n *EFIDevicePathNode) nvmeString(f efiDevicePathFormatter) (string, bool) {
+	if len(n.Data) < 12 {
+		return "", false
+	}
+	var eui []string
+	for i := 11; i >= 4; i-- {
+		eui = append(eui, f.bytes(n.Data[i:i+1]))
+	}
+	return fmt.Sprintf("NVMe(%s,%s)", f.hex(uint64(binary.LittleEndian.Uint32(n.Data))), strings.Join(eui, "-")),
+		true
+}
+
+// https://uefi.org/sites/default/files/resources/UEFI_Spec_2_8_final.pdf
+//  (section "iSCSI Device Path")
+func (n *EFIDevicePathNode) iscsiString(f efiDevicePathFormatter) (string, bool) {
+	if len(n.Data) < 14 {
+		return "", false
+	}
+	protocol := binary.LittleEndian.Uint16(n.Data)
+	loginOption := binary.LittleEndian.Uint16(n.Data[2:])
+	lun := n.Data[4:12]
+	portalGroup := binary.LittleEndian.Uint16(n.Data[12:])
+	targetName := n.Data[14:]
+	if i := bytes.IndexByte(targetName, 0); i >= 0 {
+		targetName = targetName[:i]
+	}
+
+	digest := func(enabled bool) string {
+		if enabled {
+			return "CRC32C"
+		}
+		return "None"
+	}
+	var auth string
+	switch {
+	case loginOption&(1<<11) != 0:
+		auth = "None"
+	case loginOption&(1<<12) != 0:
+		auth = "CHAP_UNI"
+	default:
+		auth = "CHAP_BI"
+	}
+	proto := "TCP"
+	if protocol != 0 {
+		proto = "reserved"
+	}
+
+	return fmt.Sprintf("iSCSI(%s,%s,0x%s,%s,%s,%s,%s)", targetName, f.hex(uint64(portalGroup)), f.bytes(lun),
+		digest(loginOption&(1<<1) != 0), digest(loginOption&(1<<3) != 0), auth, proto), true
+}
+
+func (n *EFIDevicePathNode) filePathString(f efiDevicePathFormatter) string {
+	u16 := make([]uint16, len(n.Data)/2)
+	binary.Read(bytes.NewReader(n.Data), binary.LittleEndian, &u16)
+	for i, c := range u16 {
+		if c == 0 {
+			u16 = u16[:i]
+			break
+		}
+	}
+	path := string(utf16.Decode(u16))
+	if f.style == EFIDevicePathStringStyleEfibootmgr {
+		return fmt.Sprintf("File(%s)", path)
+	}
+	return path
+}
+
+// knownString returns the textual representation of nodes with a specific format, or false if the node doesn't
+// have a specific format or its data is too short.
+func (n *EFIDevicePathNode) knownString(f efiDevicePathFormatter) (string, bool) {
+	switch efiDevicePathNodeType(n.Type) {
+	case efiDevicePathNodeHardware:
+		switch n.SubType {
+		case efiHardwareDevicePathNodePCI:
+			if len(n.Data) < 2 {
+				return "", false
+			}
+			return fmt.Sprintf("Pci(%s,%s)", f.hex(uint64(n.Data[1])), f.hex(uint64(n.Data[0]))), true
+		case efiHardwareDevicePathNodeVendor:
+			return n.vendorString(f, "Hw")
+		}
+	case efiDevicePathNodeACPI:
+		if n.SubType == efiACPIDevicePathNodeNormal {
+			return n.acpiString(f)
+		}
+	case efiDevicePathNodeMsg:
+		switch n.SubType {
+		case efiMsgDevicePathNodeUSB:
+			if len(n.Data) < 2 {
+				return "", false
+			}
+			return fmt.Sprintf("USB(%s,%s)", f.num(uint64(n.Data[0])), f.num(uint64(n.Data[1]))), true
+		case efiMsgDevicePathNodeUSBClass:
+			if len(n.Data) < 7 {
+				return "", false
+			}
+			return fmt.Sprintf("UsbClass(%s,%s,%s,%s,%s)", f.hex(uint64(binary.LittleEndian.Uint16(n.Data))),
+				f.hex(uint64(binary.LittleEndian.Uint16(n.Data[2:]))), f.hex(uint64(n.Data[4])),
+				f.hex(uint64(n.Data[5])), f.hex(uint64(n.Data[6]))), true
+		case efiMsgDevicePathNodeUSBWWID:
+			return n.usbWWIDString(f)
+		case efiMsgDevicePathNodeMAC:
+			return n.macString(f)
+		case efiMsgDevicePathNodeIPv4:
+			return n.ipv4String(f)
+		case efiMsgDevicePathNodeIPv6:
+			return n.ipv6String(f)
+		case efiMsgDevicePathNodeNVMe:
+			return n.nvmeString(f)
+		case efiMsgDevicePathNodeURI:
+			return fmt.Sprintf("Uri(%s)", n.Data), true
+		case efiMsgDevicePathNodeISCSI:
+			return n.iscsiString(f)
+		case efiMsgDevicePathNodeSD, efiMsgDevicePathNodeEMMC:
+			if len(n.Data) < 1 {
+				return "", false
+			}
+			name := "SD"
+			if n.SubType == efiMsgDevicePathNodeEMMC {
+				name = "eMMC"
+			}
+			return fmt.Sprintf("%s(%s)", name, f.num(uint64(n.Data[0]))), true
+		case efiMsgDevicePathNodeLU:
+			if len(n.Data) < 1 {
+				return "", false
+			}
+			return fmt.Sprintf("Unit(%s)", f.num(uint64(n.Data[0]))), true
+		case efiMsgDevicePathNodeSATA:
+			if len(n.Data) < 6 {
+				return "", false
+			}
+			return fmt.Sprintf("Sata(%s,%s,%s)", f.num(uint64(binary.LittleEndian.Uint16(n.Data))),
+				f.num(uint64(binary.LittleEndian.Uint16(n.Data[2:]))),
+				f.num(uint64(binary.LittleEndian.Uint16(n.Data[4:])))), true
+		case efiMsgDevicePathNodeVendor:
+			return n.vendorString(f, "Msg")
+		}
+	case efiDevicePathNodeMedia:
+		switch n.SubType {
+		case efiMediaDevicePathNodeHardDrive:
+			return n.hardDriveString(f)
+		case efiMediaDevicePathNodeVendor:
+			return n.vendorString(f, "Media")
+		case efiMediaDevicePathNodeFilePath:
+			return n.filePathString(f), true
+		case efiMediaDevicePathNodeFvFile, efiMediaDevicePathNodeFv:
+			guid, ok := readEFIDevicePathGUID(n.Data)
+			if !ok {
+				return "", false
+			}
+			name := "FvFile"
+			if n.SubType == efiMediaDevicePathNodeFv {
+				name = "Fv"
+			}
+			return fmt.Sprintf("%s(%s)", name, f.guid(guid)), true
+		case efiMediaDevicePathNodeRelOffsetRange:
+			if len(n.Data) < 20 {
+				return "", false
+			}
+			return fmt.Sprintf("Offset(%s,%s)", f.hex(binary.LittleEndian.Uint64(n.Data[4:])),
+				f.hex(binary.LittleEndian.Uint64(n.Data[12:]))), true
+		}
+	}
+	return "", false
+}
+
+func (n *EFIDevicePathNode) stringCompat(style EFIDevicePathStringStyle) string {
+	f := efiDevicePathFormatter{style: style}
+	if s, ok := n.knownString(f); ok {
+		return s
+	}
+
+	var builder bytes.Buffer
+	switch {
+	case style == EFIDevicePathStringStyleEDK2 && n.Type >= uint8(efiDevicePathNodeHardware) &&
+		n.Type <= uint8(efiDevicePathNodeBBS):
+		fmt.Fprintf(&builder, "%s(%d", efiDevicePathNodeType(n.Type), n.SubType)
+	default:
+		fmt.Fprintf(&builder, "Path(%d,%d", n.Type, n.SubType)
+	}
+	if len(n.Data) > 0 {
+		fmt.Fprintf(&builder, ",%s", f.bytes(n.Data))
+	}
+	builder.WriteString(")")
+	return builder.String()
+}
+
+// String returns the textual representation of this node in the style of the UEFI Shell.
+func (n *EFIDevicePathNode) String() string {
+	return n.stringCompat(EFIDevicePathStringStyleEDK2)
+}
+
+// FirmwareFileGUID returns the file GUID if this is a firmware volume file (FvFile) node.
+func (n *EFIDevicePathNode) FirmwareFileGUID() (*EFIGUID, bool) {
+	if efiDevicePathNodeType(n.Type) != efiDevicePathNodeMedia || n.SubType != efiMediaDevicePathNodeFvFile {
+		return nil, false
+	}
+	return readEFIDevicePathGUID(n.Data)
+}
+
+// https://uefi.org/sites/default/files/resources/UEFI_Spec_2_8_final.pdf
+//  (section 10.3 "Device Path Nodes")
+func decodeDevicePath(data []byte, limits decodeLimits) (EFIDevicePath, error) {
+	stream := bytes.NewReader(data)
+	var path EFIDevicePath
+
+	for {
+		// The node header is EFI_DEVICE_PATH_PROTOCOL.{Type, SubType, Length}.
+		var header [4]byte
+		if err := readFull(stream, header[:]); err != nil {
+			return nil, err
+		}
+		length := binary.LittleEndian.Uint16(header[2:])
+		if length < 4 {
+			return nil, fmt.Errorf("unexpected device path node length (got %d, expected >= 4)", length)
+		}
+
+		// Slice the node data from the device path rather than copying it, as the other decoders do for large fields.
+		n := int(length - 4)
+		if n > stream.Len() {
+			if stream.Len() == 0 {
+				return nil, io.EOF
+			}
+			return nil, io.ErrUnexpectedEOF
+		}
+		start := len(data) - stream.Len()
+		node := &EFIDevicePathNode{Type: header[0], SubType: header[1], Data: data[start : start+n : start+n]}
+		stream.Seek(int64(n), io.SeekCurrent)
+
+		if efiDevicePathNodeType(node.Type) == efiDevicePathNodeEoH {
+			if node.SubType != efiEndDevicePathNodeInstance {
+				return path, nil
+			}
+		}
+		if len(path) == limits.devicePathNodes() {
+			return nil, &DecodeLimitError{Kind: DecodeLimitDevicePathNodes, Limit: limits.devicePathNodes()}
+		}
+		path = append(path, node)
+	}
+}
+
+// EFIDevicePathCompareFlags controls how device paths are compared by EFIDevicePath.EqualWithFlags and
+// EFIDevicePath.MatchesWithFlags.
+type EFIDevicePathCompareFlags int
+
+const (
+	// EFIDevicePathCompareIgnorePartitionSignature ignores differences in the signature, start and size of
+	// HD() nodes, so that paths to the same partition and file match even if the disk has been re-imaged.
+	EFIDevicePathCompareIgnorePartitionSignature EFIDevicePathCompareFlags = 1 << iota
+
+	// EFIDevicePathCompareCaseInsensitiveFilePath compares file path nodes case insensitively and ignores
+	// differences in path separators, as FAT file systems are case insensitive.
+	EFIDevicePathCompareCaseInsensitiveFilePath
+)
+
+func (n *EFIDevicePathNode) isHardDrive() bool {
+	return efiDevicePathNodeType(n.Type) == efiDevicePathNodeMedia && n.SubType == efiMediaDevicePathNodeHardDrive &&
+		len(n.Data) >= 38
+}
+
+func (n *EFIDevicePathNode) isFilePath() bool {
+	return efiDevicePathNodeType(n.Type) == efiDevicePathNodeMedia && n.SubType == efiMediaDevicePathNodeFilePath
+}
+
+func normalizeEFIFilePath(path string) string {
+	return strings.ToLower(strings.Replace(path, "/", "\\", -1))
+}
+
+func (n *EFIDevicePathNode) equal(other *EFIDevicePathNode, flags EFIDevicePathCompareFlags) bool {
+	if n.Type != other.Type || n.SubType != other.SubType {
+		return false
+	}
+	switch {
+	case flags&EFIDevicePathCompareIgnorePartitionSignature != 0 && n.isHardDrive() && other.isHardDrive():
+		// Compare only the partition number.
+		return bytes.Equal(n.Data[:4], other.Data[:4])
+	case flags&EFIDevicePathCompareCaseInsensitiveFilePath != 0 && n.isFilePath():
+		f := efiDevicePathFormatter{}
+		return normalizeEFIFilePath(n.filePathString(f)) == normalizeEFIFilePath(other.filePathString(f))
+	default:
+		return bytes.Equal(n.Data, other.Data)
+	}
+}
+
+// EqualWithFlags determines whether this device path is equal to other, using the specified comparison flags.
+func (p EFIDevicePath) EqualWithFlags(other EFIDevicePath, flags EFIDevicePathCompareFlags) bool {
+	if len(p) != len(other) {
+		return false
+	}
+	return p.MatchesWithFlags(other, flags)
+}
+
+// Equal determines whether this device path is identical to other.
+func (p EFIDevicePath) Equal(other EFIDevicePath) bool {
+	return p.EqualWithFlags(other, 0)
+}
+
+// MatchesWithFlags determines whether this device path begins with all of the nodes of prefix, using the specified
+// comparison flags.
+func (p EFIDevicePath) MatchesWithFlags(prefix EFIDevicePath, flags EFIDevicePathCompareFlags) bool {
+	if len(prefix) > len(p) {
+		return false
+	}
+	for i, n := range prefix {
+		if !p[i].equal(n, flags) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches determines whether this device path begins with all of the nodes of prefix. This is useful for checking
+// whether an image was loaded from a specific device.
+func (p EFIDevicePath) Matches(prefix EFIDevicePath) bool {
+	return p.MatchesWithFlags(prefix, 0)
+}
+
+// Normalize returns a copy of this device path with the parts that commonly change when a disk is re-imaged removed.
+// Everything before the last HD() node is removed, as the hardware path to a disk depends on the port it is
+// connected to, and the signature, start and size of the HD() node are cleared. File path nodes are converted to
+// lower case with backslash separators. Paths without a HD() node are only affected by the file path normalization.
+func (p EFIDevicePath) Normalize() EFIDevicePath {
+	start := 0
+	for i, n := range p {
+		if n.isHardDrive() {
+			start = i
+		}
+	}
+
+	var out EFIDevicePath
+	for _, n := range p[start:] {
+		c := &EFIDevicePathNode{Type: n.Type, SubType: n.SubType, Data: append([]byte(nil), n.Data...)}
+		switch {
+		case c.isHardDrive():
+			for i := 4; i < 36; i++ {
+				c.Data[i] = 0
+			}
+		case c.isFilePath():
+			path := normalizeEFIFilePath(c.filePathString(efiDevicePathFormatter{}))
+			var buf bytes.Buffer
+			binary.Write(&buf, binary.LittleEndian, append(convertStringToUtf16(path), 0))
+			c.Data = buf.Bytes()
+		}
+		out = append(out, c)
+	}
+	return out
+}
@@ -0,0 +1,298 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func makeTestDevicePathNode(t efiDevicePathNodeType, subType uint8, data []byte) *EFIDevicePathNode {
+	return &EFIDevicePathNode{Type: uint8(t), SubType: subType, Data: data}
+}
+
+func makeTestFvFileNode(guid EFIGUID) *EFIDevicePathNode {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, guid)
+	return makeTestDevicePathNode(efiDevicePathNodeMedia, efiMediaDevicePathNodeFvFile, buf.Bytes())
+}
+
+func makeTestFilePathNode(path string) *EFIDevicePathNode {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, append(convertStringToUtf16(path), 0))
+	return makeTestDevicePathNode(efiDevicePathNodeMedia, efiMediaDevicePathNodeFilePath, buf.Bytes())
+}
+
+func encodeTestDevicePath(path EFIDevicePath) []byte {
+	var buf bytes.Buffer
+	for _, n := range append(path, &EFIDevicePathNode{Type: 0x7f, SubType: 0xff}) {
+		buf.Write([]byte{n.Type, n.SubType})
+		binary.Write(&buf, binary.LittleEndian, uint16(4+len(n.Data)))
+		buf.Write(n.Data)
+	}
+	return buf.Bytes()
+}
+
+func makeTestBootDevicePath() EFIDevicePath {
+	hd := make([]byte, 38)
+	binary.LittleEndian.PutUint32(hd, 1)
+	binary.LittleEndian.PutUint64(hd[4:], 0x800)
+	binary.LittleEndian.PutUint64(hd[12:], 0x100000)
+	var guid bytes.Buffer
+	binary.Write(&guid, binary.LittleEndian, *NewEFIGUID(0x8c7c1b34, 0x0f3b, 0x4b4a, 0x9a46, [...]uint8{0x7b, 0x6b, 0x8c, 0x0a, 0x0e, 0x11}))
+	copy(hd[20:], guid.Bytes())
+	hd[36] = 0x02
+	hd[37] = 0x02
+
+	return EFIDevicePath{
+		makeTestDevicePathNode(efiDevicePathNodeACPI, efiACPIDevicePathNodeNormal, []byte{0xd0, 0x41, 0x03, 0x0a, 0, 0, 0, 0}),
+		makeTestDevicePathNode(efiDevicePathNodeHardware, efiHardwareDevicePathNodePCI, []byte{0x2, 0x1f}),
+		makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeSATA, []byte{0, 0, 0xff, 0xff, 0, 0}),
+		makeTestDevicePathNode(efiDevicePathNodeMedia, efiMediaDevicePathNodeHardDrive, hd),
+		makeTestFilePathNode("\\EFI\\ubuntu\\shimx64.efi"),
+	}
+}
+
+func TestDecodeDevicePath(t *testing.T) {
+	path, err := decodeDevicePath(encodeTestDevicePath(makeTestBootDevicePath()), decodeLimits{})
+	if err != nil {
+		t.Fatalf("decodeDevicePath failed: %v", err)
+	}
+	if len(path) != 5 {
+		t.Fatalf("Unexpected number of nodes: %d", len(path))
+	}
+
+	for _, data := range []struct {
+		style    EFIDevicePathStringStyle
+		expected string
+	}{
+		{
+			style: EFIDevicePathStringStyleEDK2,
+			expected: "PciRoot(0x0)/Pci(0x1F,0x2)/Sata(0x0,0xFFFF,0x0)/" +
+				"HD(1,GPT,8C7C1B34-0F3B-4B4A-9A46-7B6B8C0A0E11,0x800,0x100000)/\\EFI\\ubuntu\\shimx64.efi",
+		},
+		{
+			style: EFIDevicePathStringStyleEfibootmgr,
+			expected: "PciRoot(0x0)/Pci(0x1f,0x2)/Sata(0,65535,0)/" +
+				"HD(1,GPT,8c7c1b34-0f3b-4b4a-9a46-7b6b8c0a0e11,0x800,0x100000)/File(\\EFI\\ubuntu\\shimx64.efi)",
+		},
+	} {
+		if s := path.StringCompat(data.style); s != data.expected {
+			t.Errorf("Unexpected string for style %d:\ngot:      %s\nexpected: %s", data.style, s, data.expected)
+		}
+	}
+	if path.String() != path.StringCompat(EFIDevicePathStringStyleEDK2) {
+		t.Errorf("String doesn't use the EDK2 style")
+	}
+}
+
+func TestEFIDevicePathVendorAndUnknownNodes(t *testing.T) {
+	var guid bytes.Buffer
+	binary.Write(&guid, binary.LittleEndian, *NewEFIGUID(0xd9dcc5df, 0x4007, 0x435e, 0x9098, [...]uint8{0x89, 0x70, 0x93, 0x55, 0x04, 0xb2}))
+
+	path := EFIDevicePath{
+		makeTestDevicePathNode(efiDevicePathNodeHardware, efiHardwareDevicePathNodeVendor, guid.Bytes()),
+		makeTestDevicePathNode(efiDevicePathNodeMedia, efiMediaDevicePathNodeVendor, append(guid.Bytes(), 0xab)),
+		makeTestDevicePathNode(efiDevicePathNodeMsg, 0x7e, []byte{0x01, 0xcd}),
+		{Type: 0x7f, SubType: efiEndDevicePathNodeInstance},
+		makeTestDevicePathNode(0x20, 1, nil),
+	}
+
+	expected := "VenHw(D9DCC5DF-4007-435E-9098-8970935504B2)/VenMedia(D9DCC5DF-4007-435E-9098-8970935504B2,AB)/" +
+		"Msg(126,01CD),Path(32,1)"
+	if s := path.String(); s != expected {
+		t.Errorf("Unexpected string:\ngot:      %s\nexpected: %s", s, expected)
+	}
+	expected = "VenHw(d9dcc5df-4007-435e-9098-8970935504b2)/VenMedia(d9dcc5df-4007-435e-9098-8970935504b2,ab)/" +
+		"Path(3,126,01cd),Path(32,1)"
+	if s := path.StringCompat(EFIDevicePathStringStyleEfibootmgr); s != expected {
+		t.Errorf("Unexpected string:\ngot:      %s\nexpected: %s", s, expected)
+	}
+}
+
+func TestEFIDevicePathMessagingNodes(t *testing.T) {
+	var wwid bytes.Buffer
+	binary.Write(&wwid, binary.LittleEndian, []uint16{1, 0x0781, 0x5581})
+	binary.Write(&wwid, binary.LittleEndian, convertStringToUtf16("ABC123"))
+
+	mac := make([]byte, 33)
+	copy(mac, []byte{0x52, 0x54, 0x00, 0x12, 0x34, 0x56})
+	mac[32] = 0x01
+
+	ipv4 := make([]byte, 23)
+	copy(ipv4, []byte{192, 168, 0, 2, 192, 168, 0, 1})
+	binary.LittleEndian.PutUint16(ipv4[12:], 6)
+	copy(ipv4[15:], []byte{192, 168, 0, 254, 255, 255, 255, 0})
+
+	ipv6 := make([]byte, 56)
+	ipv6[0] = 0xfe
+	ipv6[1] = 0x80
+	ipv6[15] = 0x02
+	ipv6[16] = 0xfe
+	ipv6[17] = 0x80
+	ipv6[31] = 0x01
+	binary.LittleEndian.PutUint16(ipv6[36:], 17)
+	ipv6[38] = 1
+	ipv6[39] = 64
+
+	nvme := make([]byte, 12)
+	binary.LittleEndian.PutUint32(nvme, 1)
+	copy(nvme[4:], []byte{0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01})
+
+	iscsi := make([]byte, 14)
+	binary.LittleEndian.PutUint16(iscsi[2:], 1<<1|1<<12)
+	iscsi[11] = 0x01
+	binary.LittleEndian.PutUint16(iscsi[12:], 1)
+	iscsi = append(iscsi, "iqn.2020-01.com.example:target\x00"...)
+
+	var vt100 bytes.Buffer
+	binary.Write(&vt100, binary.LittleEndian, *NewEFIGUID(0xdfa66065, 0xb419, 0x11d3, 0x9a2d, [...]uint8{0x00, 0x90, 0x27, 0x3f, 0xc1, 0x4d}))
+
+	for _, data := range []struct {
+		desc       string
+		node       *EFIDevicePathNode
+		edk2       string
+		efibootmgr string
+	}{
+		{
+			desc:       "USB",
+			node:       makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeUSB, []byte{3, 0}),
+			edk2:       "USB(0x3,0x0)",
+			efibootmgr: "USB(3,0)",
+		},
+		{
+			desc:       "UsbClass",
+			node:       makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeUSBClass, []byte{0x81, 0x07, 0x81, 0x55, 0x08, 0x06, 0x50}),
+			edk2:       "UsbClass(0x781,0x5581,0x8,0x6,0x50)",
+			efibootmgr: "UsbClass(0x781,0x5581,0x8,0x6,0x50)",
+		},
+		{
+			desc:       "UsbWwid",
+			node:       makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeUSBWWID, wwid.Bytes()),
+			edk2:       "UsbWwid(0x781,0x5581,0x1,\"ABC123\")",
+			efibootmgr: "UsbWwid(0x781,0x5581,0x1,\"ABC123\")",
+		},
+		{
+			desc:       "MAC",
+			node:       makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeMAC, mac),
+			edk2:       "MAC(525400123456,0x1)",
+			efibootmgr: "MAC(525400123456,0x1)",
+		},
+		{
+			desc:       "IPv4",
+			node:       makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeIPv4, ipv4),
+			edk2:       "IPv4(192.168.0.1,TCP,DHCP,192.168.0.2,192.168.0.254,255.255.255.0)",
+			efibootmgr: "IPv4(192.168.0.1,TCP,DHCP,192.168.0.2,192.168.0.254,255.255.255.0)",
+		},
+		{
+			desc:       "IPv6",
+			node:       makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeIPv6, ipv6),
+			edk2:       "IPv6(fe80:0000:0000:0000:0000:0000:0000:0001,UDP,StatelessAutoConfigure,fe80:0000:0000:0000:0000:0000:0000:0002,0000:0000:0000:0000:0000:0000:0000:0000,0x40)",
+			efibootmgr: "IPv6(fe80::1,UDP,StatelessAutoConfigure,fe80::2,::,64)",
+		},
+		{
+			desc:       "NVMe",
+			node:       makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeNVMe, nvme),
+			edk2:       "NVMe(0x1,01-02-03-04-05-06-07-08)",
+			efibootmgr: "NVMe(0x1,01-02-03-04-05-06-07-08)",
+		},
+		{
+			desc:       "Uri",
+			node:       makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeURI, []byte("http://boot.example.com/shim.efi")),
+			edk2:       "Uri(http://boot.example.com/shim.efi)",
+			efibootmgr: "Uri(http://boot.example.com/shim.efi)",
+		},
+		{
+			desc:       "iSCSI",
+			node:       makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeISCSI, iscsi),
+			edk2:       "iSCSI(iqn.2020-01.com.example:target,0x1,0x0000000000000001,CRC32C,None,CHAP_UNI,TCP)",
+			efibootmgr: "iSCSI(iqn.2020-01.com.example:target,0x1,0x0000000000000001,CRC32C,None,CHAP_UNI,TCP)",
+		},
+		{
+			desc:       "SD",
+			node:       makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeSD, []byte{10}),
+			edk2:       "SD(0xA)",
+			efibootmgr: "SD(10)",
+		},
+		{
+			desc:       "eMMC",
+			node:       makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeEMMC, []byte{1}),
+			edk2:       "eMMC(0x1)",
+			efibootmgr: "eMMC(1)",
+		},
+		{
+			desc:       "VenVt100",
+			node:       makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeVendor, vt100.Bytes()),
+			edk2:       "VenVt100()",
+			efibootmgr: "VenVt100()",
+		},
+		{
+			desc:       "TruncatedNVMe",
+			node:       makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeNVMe, []byte{1, 0, 0, 0}),
+			edk2:       "Msg(23,01000000)",
+			efibootmgr: "Path(3,23,01000000)",
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			if s := data.node.String(); s != data.edk2 {
+				t.Errorf("Unexpected string:\ngot:      %s\nexpected: %s", s, data.edk2)
+			}
+			if s := data.node.stringCompat(EFIDevicePathStringStyleEfibootmgr); s != data.efibootmgr {
+				t.Errorf("Unexpected string:\ngot:      %s\nexpected: %s", s, data.efibootmgr)
+			}
+		})
+	}
+}
+
+func TestEFIDevicePathCompare(t *testing.T) {
+	path := makeTestBootDevicePath()
+
+	reimaged := makeTestBootDevicePath()
+	reimaged[3].Data[20] ^= 0xff
+	reimaged[4] = makeTestFilePathNode("\\EFI\\UBUNTU\\SHIMX64.EFI")
+
+	if !path.Equal(makeTestBootDevicePath()) {
+		t.Errorf("Identical paths should be equal")
+	}
+	if path.Equal(reimaged) {
+		t.Errorf("Paths with different partition signatures shouldn't be equal")
+	}
+	if !path.EqualWithFlags(reimaged,
+		EFIDevicePathCompareIgnorePartitionSignature|EFIDevicePathCompareCaseInsensitiveFilePath) {
+		t.Errorf("Paths should be equal when ignoring partition signatures and file path case")
+	}
+	if path.EqualWithFlags(reimaged, EFIDevicePathCompareIgnorePartitionSignature) {
+		t.Errorf("Paths with file paths of different case shouldn't be equal")
+	}
+
+	if !path.Matches(path[:3]) {
+		t.Errorf("Path should match its own prefix")
+	}
+	if path[:3].Matches(path) {
+		t.Errorf("Path shouldn't match a longer path")
+	}
+	if path.Matches(reimaged[:4]) || !path.MatchesWithFlags(reimaged[:4], EFIDevicePathCompareIgnorePartitionSignature) {
+		t.Errorf("Unexpected prefix match result")
+	}
+}
+
+func TestEFIDevicePathNormalize(t *testing.T) {
+	path := makeTestBootDevicePath()
+
+	reimaged := EFIDevicePath{
+		makeTestDevicePathNode(efiDevicePathNodeACPI, efiACPIDevicePathNodeNormal, []byte{0xd0, 0x41, 0x03, 0x0a, 0, 0, 0, 0}),
+		makeTestDevicePathNode(efiDevicePathNodeHardware, efiHardwareDevicePathNodePCI, []byte{0x0, 0x1d}),
+		makeTestDevicePathNode(efiDevicePathNodeMedia, efiMediaDevicePathNodeHardDrive, append([]byte(nil), path[3].Data...)),
+		makeTestFilePathNode("\\EFI\\Ubuntu\\shimx64.efi"),
+	}
+	reimaged[2].Data[30] ^= 0xff
+
+	if !path.Normalize().Equal(reimaged.Normalize()) {
+		t.Errorf("Normalized paths should be equal:\n%s\n%s", path.Normalize(), reimaged.Normalize())
+	}
+	if s := path.Normalize().String(); s != "HD(1,GPT,00000000-0000-0000-0000-000000000000,0x0,0x0)/\\efi\\ubuntu\\shimx64.efi" {
+		t.Errorf("Unexpected normalized path: %s", s)
+	}
+	if path[3].Data[5] != 0x08 {
+		t.Errorf("Normalize modified the original path")
+	}
+}
@@ -0,0 +1,497 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// splitEFIDevicePathText splits s at each occurrence of one of the separator characters that isn't inside
+// parentheses or a quoted string. The separators that were split at are returned alongside the fields, with 0 for
+// the end of the string.
+func splitEFIDevicePathText(s string, separators string) (fields []string, seps []byte) {
+	depth := 0
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+		case depth == 0 && strings.IndexByte(separators, c) >= 0:
+			fields = append(fields, s[start:i])
+			seps = append(seps, c)
+			start = i + 1
+		}
+	}
+	return append(fields, s[start:]), append(seps, 0)
+}
+
+// parseEFIDevicePathNum parses a number that is written either in hexadecimal with a 0x prefix or in decimal.
+func parseEFIDevicePathNum(s string, bitSize int) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return strconv.ParseUint(s[2:], 16, bitSize)
+	}
+	return strconv.ParseUint(s, 10, bitSize)
+}
+
+type efiDevicePathTextArgs struct {
+	args []string
+	err  error
+}
+
+func (a *efiDevicePathTextArgs) setErr(err error) {
+	if a.err == nil {
+		a.err = err
+	}
+}
+
+func (a *efiDevicePathTextArgs) arg(i int) string {
+	if i >= len(a.args) {
+		a.setErr(fmt.Errorf("missing argument %d", i+1))
+		return ""
+	}
+	return strings.TrimSpace(a.args[i])
+}
+
+func (a *efiDevicePathTextArgs) has(i int) bool {
+	return i < len(a.args)
+}
+
+func (a *efiDevicePathTextArgs) num(i int, bitSize int) uint64 {
+	s := a.arg(i)
+	if a.err != nil {
+		return 0
+	}
+	n, err := parseEFIDevicePathNum(s, bitSize)
+	if err != nil {
+		a.setErr(fmt.Errorf("invalid number \"%s\"", s))
+	}
+	return n
+}
+
+func (a *efiDevicePathTextArgs) bytes(i int) []byte {
+	s := a.arg(i)
+	if a.err != nil {
+		return nil
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"))
+	if err != nil {
+		a.setErr(fmt.Errorf("invalid hexadecimal data \"%s\"", s))
+	}
+	return b
+}
+
+func (a *efiDevicePathTextArgs) guid(i int) EFIGUID {
+	s := a.arg(i)
+	if a.err != nil {
+		return EFIGUID{}
+	}
+	guid, err := parseEFIGUID(s)
+	if err != nil {
+		a.setErr(err)
+	}
+	return guid
+}
+
+func (a *efiDevicePathTextArgs) ip(i int, v4 bool) net.IP {
+	s := a.arg(i)
+	if a.err != nil {
+		return nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		a.setErr(fmt.Errorf("invalid IP address \"%s\"", s))
+		return nil
+	}
+	if v4 {
+		if ip = ip.To4(); ip == nil {
+			a.setErr(fmt.Errorf("invalid IPv4 address \"%s\"", s))
+		}
+		return ip
+	}
+	return ip.To16()
+}
+
+func (a *efiDevicePathTextArgs) networkProtocol(i int) uint16 {
+	switch a.arg(i) {
+	case "TCP":
+		return 6
+	case "UDP":
+		return 17
+	default:
+		return uint16(a.num(i, 16))
+	}
+}
+
+func (a *efiDevicePathTextArgs) choice(i int, choices ...string) int {
+	s := a.arg(i)
+	for j, c := range choices {
+		if s == c {
+			return j
+		}
+	}
+	a.setErr(fmt.Errorf("unexpected value \"%s\"", s))
+	return 0
+}
+
+type efiDevicePathNodeTextParser func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8)
+
+func parseEFIDevicePathACPIText(hid uint32) efiDevicePathNodeTextParser {
+	return func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+		binary.Write(w, binary.LittleEndian, hid)
+		binary.Write(w, binary.LittleEndian, uint32(args.num(0, 32)))
+		return efiDevicePathNodeACPI, efiACPIDevicePathNodeNormal
+	}
+}
+
+func parseEFIDevicePathVendorText(t efiDevicePathNodeType, subType uint8) efiDevicePathNodeTextParser {
+	return func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+		binary.Write(w, binary.LittleEndian, args.guid(0))
+		if args.has(1) {
+			w.Write(args.bytes(1))
+		}
+		return t, subType
+	}
+}
+
+func parseEFIDevicePathGenericText(t efiDevicePathNodeType) efiDevicePathNodeTextParser {
+	return func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+		subType := uint8(args.num(0, 8))
+		if args.has(1) {
+			w.Write(args.bytes(1))
+		}
+		return t, subType
+	}
+}
+
+func parseEFIDevicePathFvText(subType uint8) efiDevicePathNodeTextParser {
+	return func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+		binary.Write(w, binary.LittleEndian, args.guid(0))
+		return efiDevicePathNodeMedia, subType
+	}
+}
+
+func parseEFIDevicePathSlotText(subType uint8) efiDevicePathNodeTextParser {
+	return func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+		w.WriteByte(uint8(args.num(0, 8)))
+		return efiDevicePathNodeMsg, subType
+	}
+}
+
+func writeEFIDevicePathFilePath(w *bytes.Buffer, path string) {
+	binary.Write(w, binary.LittleEndian, append(utf16.Encode([]rune(path)), 0))
+}
+
+var efiDevicePathNodeTextParsers map[string]efiDevicePathNodeTextParser
+
+func init() {
+	efiDevicePathNodeTextParsers = map[string]efiDevicePathNodeTextParser{
+		"Pci": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			device := uint8(args.num(0, 8))
+			w.WriteByte(uint8(args.num(1, 8)))
+			w.WriteByte(device)
+			return efiDevicePathNodeHardware, efiHardwareDevicePathNodePCI
+		},
+		"VenHw":        parseEFIDevicePathVendorText(efiDevicePathNodeHardware, efiHardwareDevicePathNodeVendor),
+		"HardwarePath": parseEFIDevicePathGenericText(efiDevicePathNodeHardware),
+
+		"PciRoot":      parseEFIDevicePathACPIText(0x0a0341d0),
+		"PcieRoot":     parseEFIDevicePathACPIText(0x0a0841d0),
+		"Floppy":       parseEFIDevicePathACPIText(0x060441d0),
+		"Keyboard":     parseEFIDevicePathACPIText(0x030141d0),
+		"Serial":       parseEFIDevicePathACPIText(0x050141d0),
+		"ParallelPort": parseEFIDevicePathACPIText(0x040141d0),
+		"Acpi": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			var hid uint32
+			if s := args.arg(0); strings.HasPrefix(s, "PNP") {
+				id, err := strconv.ParseUint(s[3:], 16, 16)
+				if err != nil {
+					args.setErr(fmt.Errorf("invalid HID \"%s\"", s))
+				}
+				hid = uint32(id)<<16 | 0x41d0
+			} else {
+				hid = uint32(args.num(0, 32))
+			}
+			binary.Write(w, binary.LittleEndian, hid)
+			binary.Write(w, binary.LittleEndian, uint32(args.num(1, 32)))
+			return efiDevicePathNodeACPI, efiACPIDevicePathNodeNormal
+		},
+		"AcpiPath": parseEFIDevicePathGenericText(efiDevicePathNodeACPI),
+
+		"USB": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			w.WriteByte(uint8(args.num(0, 8)))
+			w.WriteByte(uint8(args.num(1, 8)))
+			return efiDevicePathNodeMsg, efiMsgDevicePathNodeUSB
+		},
+		"UsbClass": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			binary.Write(w, binary.LittleEndian, uint16(args.num(0, 16)))
+			binary.Write(w, binary.LittleEndian, uint16(args.num(1, 16)))
+			for i := 2; i < 5; i++ {
+				w.WriteByte(uint8(args.num(i, 8)))
+			}
+			return efiDevicePathNodeMsg, efiMsgDevicePathNodeUSBClass
+		},
+		"UsbWwid": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			vid := uint16(args.num(0, 16))
+			pid := uint16(args.num(1, 16))
+			binary.Write(w, binary.LittleEndian, uint16(args.num(2, 16)))
+			binary.Write(w, binary.LittleEndian, vid)
+			binary.Write(w, binary.LittleEndian, pid)
+			binary.Write(w, binary.LittleEndian, utf16.Encode([]rune(strings.Trim(args.arg(3), "\""))))
+			return efiDevicePathNodeMsg, efiMsgDevicePathNodeUSBWWID
+		},
+		"MAC": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			addr := make([]byte, 32)
+			if b := args.bytes(0); len(b) > len(addr) {
+				args.setErr(errors.New("MAC address is too long"))
+			} else {
+				copy(addr, b)
+			}
+			w.Write(addr)
+			w.WriteByte(uint8(args.num(1, 8)))
+			return efiDevicePathNodeMsg, efiMsgDevicePathNodeMAC
+		},
+		"IPv4": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			remote := args.ip(0, true)
+			protocol := args.networkProtocol(1)
+			origin := args.choice(2, "DHCP", "Static")
+			w.Write(args.ip(3, true))
+			w.Write(remote)
+			w.Write(make([]byte, 4)) // local and remote ports
+			binary.Write(w, binary.LittleEndian, protocol)
+			w.WriteByte(uint8(origin))
+			if args.has(4) {
+				w.Write(args.ip(4, true))
+				w.Write(args.ip(5, true))
+			} else {
+				w.Write(make([]byte, 8))
+			}
+			return efiDevicePathNodeMsg, efiMsgDevicePathNodeIPv4
+		},
+		"IPv6": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			remote := args.ip(0, false)
+			protocol := args.networkProtocol(1)
+			origin := args.choice(2, "Static", "StatelessAutoConfigure", "StatefulAutoConfigure")
+			w.Write(args.ip(3, false))
+			w.Write(remote)
+			w.Write(make([]byte, 4)) // local and remote ports
+			binary.Write(w, binary.LittleEndian, protocol)
+			w.WriteByte(uint8(origin))
+			if args.has(4) {
+				gateway := args.ip(4, false)
+				w.WriteByte(uint8(args.num(5, 8)))
+				w.Write(gateway)
+			} else {
+				w.Write(make([]byte, 17))
+			}
+			return efiDevicePathNodeMsg, efiMsgDevicePathNodeIPv6
+		},
+		"NVMe": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			binary.Write(w, binary.LittleEndian, uint32(args.num(0, 32)))
+			eui, err := hex.DecodeString(strings.Replace(args.arg(1), "-", "", -1))
+			if err != nil || len(eui) != 8 {
+				args.setErr(fmt.Errorf("invalid EUI-64 \"%s\"", args.arg(1)))
+				eui = make([]byte, 8)
+			}
+			for i := len(eui) - 1; i >= 0; i-- {
+				w.WriteByte(eui[i])
+			}
+			return efiDevicePathNodeMsg, efiMsgDevicePathNodeNVMe
+		},
+		"Unit": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			w.WriteByte(uint8(args.num(0, 8)))
+			return efiDevicePathNodeMsg, efiMsgDevicePathNodeLU
+		},
+		"Sata": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			for i := 0; i < 3; i++ {
+				binary.Write(w, binary.LittleEndian, uint16(args.num(i, 16)))
+			}
+			return efiDevicePathNodeMsg, efiMsgDevicePathNodeSATA
+		},
+		"iSCSI": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			name := args.arg(0)
+			portalGroup := uint16(args.num(1, 16))
+			lun := args.bytes(2)
+			if len(lun) != 8 {
+				args.setErr(fmt.Errorf("invalid LUN \"%s\"", args.arg(2)))
+				lun = make([]byte, 8)
+			}
+			var loginOption uint16
+			if args.choice(3, "None", "CRC32C") == 1 {
+				loginOption |= 1 << 1
+			}
+			if args.choice(4, "None", "CRC32C") == 1 {
+				loginOption |= 1 << 3
+			}
+			switch args.choice(5, "CHAP_BI", "None", "CHAP_UNI") {
+			case 1:
+				loginOption |= 1 << 11
+			case 2:
+				loginOption |= 1 << 12
+			}
+			var protocol uint16
+			if args.arg(6) != "TCP" {
+				protocol = uint16(args.num(6, 16))
+			}
+			binary.Write(w, binary.LittleEndian, protocol)
+			binary.Write(w, binary.LittleEndian, loginOption)
+			w.Write(lun)
+			binary.Write(w, binary.LittleEndian, portalGroup)
+			w.WriteString(name)
+			return efiDevicePathNodeMsg, efiMsgDevicePathNodeISCSI
+		},
+		"Uri": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			w.WriteString(strings.Join(args.args, ","))
+			return efiDevicePathNodeMsg, efiMsgDevicePathNodeURI
+		},
+		"SD":     parseEFIDevicePathSlotText(efiMsgDevicePathNodeSD),
+		"eMMC":   parseEFIDevicePathSlotText(efiMsgDevicePathNodeEMMC),
+		"VenMsg": parseEFIDevicePathVendorText(efiDevicePathNodeMsg, efiMsgDevicePathNodeVendor),
+		"Msg":    parseEFIDevicePathGenericText(efiDevicePathNodeMsg),
+
+		"HD": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			binary.Write(w, binary.LittleEndian, uint32(args.num(0, 32)))
+			var sig [16]byte
+			var mbrType, sigType uint8
+			switch args.arg(1) {
+			case "MBR":
+				mbrType, sigType = 0x01, 0x01
+				binary.LittleEndian.PutUint32(sig[:], uint32(args.num(2, 32)))
+			case "GPT":
+				mbrType, sigType = 0x02, 0x02
+				guid := args.guid(2)
+				var b bytes.Buffer
+				binary.Write(&b, binary.LittleEndian, guid)
+				copy(sig[:], b.Bytes())
+			default:
+				sigType = uint8(args.num(1, 8))
+			}
+			binary.Write(w, binary.LittleEndian, args.num(3, 64))
+			binary.Write(w, binary.LittleEndian, args.num(4, 64))
+			w.Write(sig[:])
+			w.WriteByte(mbrType)
+			w.WriteByte(sigType)
+			return efiDevicePathNodeMedia, efiMediaDevicePathNodeHardDrive
+		},
+		"VenMedia": parseEFIDevicePathVendorText(efiDevicePathNodeMedia, efiMediaDevicePathNodeVendor),
+		"File": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			writeEFIDevicePathFilePath(w, strings.Join(args.args, ","))
+			return efiDevicePathNodeMedia, efiMediaDevicePathNodeFilePath
+		},
+		"FvFile": parseEFIDevicePathFvText(efiMediaDevicePathNodeFvFile),
+		"Fv":     parseEFIDevicePathFvText(efiMediaDevicePathNodeFv),
+		"Offset": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			w.Write(make([]byte, 4)) // reserved
+			binary.Write(w, binary.LittleEndian, args.num(0, 64))
+			binary.Write(w, binary.LittleEndian, args.num(1, 64))
+			return efiDevicePathNodeMedia, efiMediaDevicePathNodeRelOffsetRange
+		},
+		"MediaPath": parseEFIDevicePathGenericText(efiDevicePathNodeMedia),
+		"BbsPath":   parseEFIDevicePathGenericText(efiDevicePathNodeBBS),
+		"Path": func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			t := efiDevicePathNodeType(args.num(0, 8))
+			subType := uint8(args.num(1, 8))
+			if args.has(2) {
+				w.Write(args.bytes(2))
+			}
+			return t, subType
+		},
+	}
+
+	for guid, name := range efiMsgVendorTerminalTypes {
+		guid := guid
+		efiDevicePathNodeTextParsers[name] = func(args *efiDevicePathTextArgs, w *bytes.Buffer) (efiDevicePathNodeType, uint8) {
+			binary.Write(w, binary.LittleEndian, guid)
+			return efiDevicePathNodeMsg, efiMsgDevicePathNodeVendor
+		}
+	}
+}
+
+func isEFIDevicePathNodeName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func parseEFIDevicePathNodeText(s string) (*EFIDevicePathNode, error) {
+	open := strings.IndexByte(s, '(')
+	if open < 0 || !strings.HasSuffix(s, ")") || !isEFIDevicePathNodeName(s[:open]) {
+		// Anything that isn't of the form Name(args) is a file path.
+		var w bytes.Buffer
+		writeEFIDevicePathFilePath(&w, s)
+		return &EFIDevicePathNode{Type: uint8(efiDevicePathNodeMedia), SubType: efiMediaDevicePathNodeFilePath,
+			Data: w.Bytes()}, nil
+	}
+
+	name := s[:open]
+	parser, ok := efiDevicePathNodeTextParsers[name]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized node type \"%s\"", name)
+	}
+
+	args := &efiDevicePathTextArgs{}
+	if inner := s[open+1 : len(s)-1]; inner != "" {
+		args.args, _ = splitEFIDevicePathText(inner, ",")
+	}
+	var w bytes.Buffer
+	t, subType := parser(args, &w)
+	if args.err != nil {
+		return nil, args.err
+	}
+	return &EFIDevicePathNode{Type: uint8(t), SubType: subType, Data: append([]byte{}, w.Bytes()...)}, nil
+}
+
+// ParseEFIDevicePath converts the textual representation of a device path back in to a device path. It accepts the
+// output of EFIDevicePath.String, which follows the text representation defined by the UEFI specification, as well
+// as the output of EFIDevicePath.StringCompat with EFIDevicePathStringStyleEfibootmgr. Nodes are separated by "/",
+// and instances by ",". A node that isn't of the form Name(args) is interpreted as a file path.
+//
+// The returned nodes are encoded in their canonical form, which means that nodes containing data that isn't
+// represented in the text (eg, the ports in IPv4 and IPv6 nodes) are not identical to the nodes that the text was
+// produced from, although their textual representations are.
+func ParseEFIDevicePath(s string) (EFIDevicePath, error) {
+	// https://uefi.org/sites/default/files/resources/UEFI_Spec_2_8_final.pdf
+	//  (section "Device Path Text Representation")
+	if s == "" {
+		return nil, errors.New("empty device path")
+	}
+
+	var path EFIDevicePath
+	fields, seps := splitEFIDevicePathText(s, "/,")
+	for i, field := range fields {
+		if field == "" {
+			return nil, fmt.Errorf("empty node at position %d", len(path))
+		}
+		node, err := parseEFIDevicePathNodeText(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid device path node \"%s\": %v", field, err)
+		}
+		path = append(path, node)
+		if seps[i] == ',' {
+			path = append(path, &EFIDevicePathNode{Type: uint8(efiDevicePathNodeEoH),
+				SubType: efiEndDevicePathNodeInstance, Data: []byte{}})
+		}
+	}
+	return path, nil
+}
@@ -0,0 +1,93 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestParseEFIDevicePath(t *testing.T) {
+	var hd bytes.Buffer
+	binary.Write(&hd, binary.LittleEndian, uint32(1))
+	binary.Write(&hd, binary.LittleEndian, uint64(0x800))
+	binary.Write(&hd, binary.LittleEndian, uint64(0x100000))
+	binary.Write(&hd, binary.LittleEndian, *NewEFIGUID(0x66de947b, 0xfdb2, 0x4525, 0xb752, [...]uint8{0x30, 0xd6, 0x6b, 0xb2, 0xb9, 0x60}))
+	hd.Write([]byte{0x02, 0x02})
+
+	var file bytes.Buffer
+	binary.Write(&file, binary.LittleEndian, append(convertStringToUtf16("\\EFI\\ubuntu\\shimx64.efi"), 0))
+
+	expected := EFIDevicePath{
+		makeTestDevicePathNode(efiDevicePathNodeACPI, efiACPIDevicePathNodeNormal, []byte{0xd0, 0x41, 0x03, 0x0a, 0x00, 0x00, 0x00, 0x00}),
+		makeTestDevicePathNode(efiDevicePathNodeHardware, efiHardwareDevicePathNodePCI, []byte{0x00, 0x1d}),
+		makeTestDevicePathNode(efiDevicePathNodeMsg, efiMsgDevicePathNodeNVMe, []byte{0x01, 0x00, 0x00, 0x00, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01}),
+		makeTestDevicePathNode(efiDevicePathNodeMedia, efiMediaDevicePathNodeHardDrive, hd.Bytes()),
+		makeTestDevicePathNode(efiDevicePathNodeMedia, efiMediaDevicePathNodeFilePath, file.Bytes()),
+	}
+
+	for _, style := range []EFIDevicePathStringStyle{EFIDevicePathStringStyleEDK2, EFIDevicePathStringStyleEfibootmgr} {
+		s := expected.StringCompat(style)
+		path, err := ParseEFIDevicePath(s)
+		if err != nil {
+			t.Fatalf("ParseEFIDevicePath(%s) failed: %v", s, err)
+		}
+		if !reflect.DeepEqual(path, expected) {
+			t.Errorf("Unexpected path from %s:\ngot:      %s\nexpected: %s", s, path, expected)
+		}
+	}
+}
+
+func TestParseEFIDevicePathRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		"PciRoot(0x0)/Pci(0x14,0x0)/USB(0x3,0x0)/HD(1,MBR,0x1234ABCD,0x800,0x32000)",
+		"PcieRoot(0x1)/Pci(0x1C,0x4)/Sata(0x0,0xFFFF,0x0)/Unit(0x1)",
+		"Acpi(PNP0A06,0x0)/Acpi(0x12345678,0x1)/Floppy(0x0)",
+		"VenHw(D9DCC5DF-4007-435E-9098-8970935504B2,AB)/VenMedia(D9DCC5DF-4007-435E-9098-8970935504B2)",
+		"PciRoot(0x0)/Pci(0x1F,0x3)/Serial(0x0)/VenVt100()",
+		"MAC(525400123456,0x1)/IPv4(192.168.0.1,TCP,DHCP,192.168.0.2,192.168.0.254,255.255.255.0)/Uri(http://boot.example.com/shim.efi)",
+		"MAC(525400123456,0x1)/IPv6(fe80:0000:0000:0000:0000:0000:0000:0001,UDP,StatelessAutoConfigure,fe80:0000:0000:0000:0000:0000:0000:0002,0000:0000:0000:0000:0000:0000:0000:0000,0x40)",
+		"UsbClass(0x781,0x5581,0x8,0x6,0x50)/UsbWwid(0x781,0x5581,0x1,\"ABC,123\")",
+		"iSCSI(iqn.2020-01.com.example:target,0x1,0x0000000000000001,CRC32C,None,CHAP_UNI,TCP)",
+		"PciRoot(0x0)/Pci(0x1C,0x0)/SD(0xA),PciRoot(0x0)/Pci(0x1C,0x1)/eMMC(0x0)",
+		"Fv(7CB8BDC9-F8EB-4F34-AAEA-3EE4AF6516A1)/FvFile(462CAA21-7614-4503-836E-8AB6F4662331)/Offset(0x0,0xFFF)",
+		"HardwarePath(7,0102)/Msg(126,01CD)/MediaPath(32)/Path(32,1)",
+	} {
+		path, err := ParseEFIDevicePath(s)
+		if err != nil {
+			t.Errorf("ParseEFIDevicePath(%s) failed: %v", s, err)
+			continue
+		}
+		if path.String() != s {
+			t.Errorf("Path didn't round trip:\ngot:      %s\nexpected: %s", path, s)
+		}
+	}
+}
+
+func TestParseEFIDevicePathEfibootmgrStyle(t *testing.T) {
+	path, err := ParseEFIDevicePath("PciRoot(0x0)/Pci(0x14,0x0)/USB(3,0)/Sata(0,65535,0)/File(\\EFI\\BOOT\\BOOTX64.EFI)")
+	if err != nil {
+		t.Fatalf("ParseEFIDevicePath failed: %v", err)
+	}
+	expected := "PciRoot(0x0)/Pci(0x14,0x0)/USB(0x3,0x0)/Sata(0x0,0xFFFF,0x0)/\\EFI\\BOOT\\BOOTX64.EFI"
+	if path.String() != expected {
+		t.Errorf("Unexpected path:\ngot:      %s\nexpected: %s", path, expected)
+	}
+}
+
+func TestParseEFIDevicePathInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"PciRoot(0x0)//Pci(0x1,0x0)",
+		"PciRoot(zero)",
+		"Pci(0x1)",
+		"Foo(0x1)",
+		"HD(1,GPT,not-a-guid,0x800,0x1000)",
+		"IPv4(192.168.0.1,TCP,Manual,192.168.0.2)",
+		"NVMe(0x1,01-02)",
+	} {
+		if _, err := ParseEFIDevicePath(s); err == nil {
+			t.Errorf("ParseEFIDevicePath(%s) should have failed", s)
+		}
+	}
+}
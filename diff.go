@@ -0,0 +1,272 @@
+package tcglog
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// EventDiffKind describes how an event differs between two logs.
+type EventDiffKind int
+
+const (
+	EventDiffAdded   EventDiffKind = iota // The event only appears in the new log
+	EventDiffRemoved                      // The event only appears in the old log
+	EventDiffChanged                      // The event appears in both logs at the same position, but with different digests or data
+)
+
+func (k EventDiffKind) String() string {
+	switch k {
+	case EventDiffAdded:
+		return "added"
+	case EventDiffRemoved:
+		return "removed"
+	case EventDiffChanged:
+		return "changed"
+	default:
+		return fmt.Sprintf("EventDiffKind(%d)", int(k))
+	}
+}
+
+// EventDiff describes a single difference between two logs.
+type EventDiff struct {
+	Kind EventDiffKind
+	Old  *Event // The event from the old log. This is nil for EventDiffAdded
+	New  *Event // The event from the new log. This is nil for EventDiffRemoved
+}
+
+func (d *EventDiff) String() string {
+	switch d.Kind {
+	case EventDiffAdded:
+		return fmt.Sprintf("added event %d (type: %s)", d.New.Index, d.New.EventType)
+	case EventDiffRemoved:
+		return fmt.Sprintf("removed event %d (type: %s)", d.Old.Index, d.Old.EventType)
+	default:
+		return fmt.Sprintf("changed event %d -> %d (type: %s)", d.Old.Index, d.New.Index, d.New.EventType)
+	}
+}
+
+// PCRDiff describes the differences between the events measured to a single PCR in two logs.
+type PCRDiff struct {
+	PCR      PCRIndex
+	Events   []*EventDiff // The differences, in log order
+	Diverges bool         // Whether the differences result in a different PCR value
+}
+
+// LogDiff is the result of DiffLogs.
+type LogDiff struct {
+	PCRs []*PCRDiff // The PCRs with differences, in ascending order
+}
+
+// DivergentPCRs returns the PCRs for which the differences result in a different PCR value, in ascending order.
+func (d *LogDiff) DivergentPCRs() []PCRIndex {
+	var out []PCRIndex
+	for _, p := range d.PCRs {
+		if p.Diverges {
+			out = append(out, p.PCR)
+		}
+	}
+	return out
+}
+
+// eventDigestsEqual determines whether the digests of two events are equal for all of the algorithms that they have
+// in common.
+func eventDigestsEqual(a, b *Event) bool {
+	for _, alg := range a.Digests.Algorithms() {
+		if other, ok := b.Digests.Lookup(alg); ok && !bytes.Equal(a.Digests.Get(alg), other) {
+			return false
+		}
+	}
+	return true
+}
+
+func eventDataBytes(e *Event) []byte {
+	if e.Data() == nil {
+		return nil
+	}
+	return e.Data().Bytes()
+}
+
+func eventsEqual(a, b *Event) bool {
+	return a.EventType == b.EventType && eventDigestsEqual(a, b) && bytes.Equal(eventDataBytes(a), eventDataBytes(b))
+}
+
+// diffEventSequences produces the differences between two sequences of events using a longest common subsequence.
+// Runs of removed and added events are paired up as changed events where the event types match.
+func diffEventSequences(old, new []*Event) []*EventDiff {
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			switch {
+			case eventsEqual(old[i], new[j]):
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out []*EventDiff
+	var removed, added []*Event
+	flush := func() {
+		for len(removed) > 0 && len(added) > 0 && removed[0].EventType == added[0].EventType {
+			out = append(out, &EventDiff{Kind: EventDiffChanged, Old: removed[0], New: added[0]})
+			removed = removed[1:]
+			added = added[1:]
+		}
+		for _, e := range removed {
+			out = append(out, &EventDiff{Kind: EventDiffRemoved, Old: e})
+		}
+		for _, e := range added {
+			out = append(out, &EventDiff{Kind: EventDiffAdded, New: e})
+		}
+		removed = nil
+		added = nil
+	}
+
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		switch {
+		case i < len(old) && j < len(new) && eventsEqual(old[i], new[j]):
+			flush()
+			i++
+			j++
+		case j == len(new) || (i < len(old) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, old[i])
+			i++
+		default:
+			added = append(added, new[j])
+			j++
+		}
+	}
+	flush()
+
+	return out
+}
+
+func (d *EventDiff) affectsPCRValue() bool {
+	switch d.Kind {
+	case EventDiffAdded:
+		return doesEventTypeExtendPCR(d.New.EventType)
+	case EventDiffRemoved:
+		return doesEventTypeExtendPCR(d.Old.EventType)
+	default:
+		return doesEventTypeExtendPCR(d.New.EventType) && !eventDigestsEqual(d.Old, d.New)
+	}
+}
+
+// DiffLogs compares the events from two logs (eg, from the previous boot and the current boot) PCR by PCR, and
+// reports the events that were added, removed or changed in the new log, and which PCRs have a different value as a
+// result. Events are considered to be identical if they have the same type, the same digests for the algorithms
+// that both events have in common, and the same event data.
+func DiffLogs(old, new []*Event) *LogDiff {
+	oldByPCR := make(map[PCRIndex][]*Event)
+	newByPCR := make(map[PCRIndex][]*Event)
+	var pcrs []PCRIndex
+	for _, e := range old {
+		if _, ok := oldByPCR[e.PCRIndex]; !ok {
+			pcrs = append(pcrs, e.PCRIndex)
+		}
+		oldByPCR[e.PCRIndex] = append(oldByPCR[e.PCRIndex], e)
+	}
+	for _, e := range new {
+		_, inOld := oldByPCR[e.PCRIndex]
+		if _, ok := newByPCR[e.PCRIndex]; !ok && !inOld {
+			pcrs = append(pcrs, e.PCRIndex)
+		}
+		newByPCR[e.PCRIndex] = append(newByPCR[e.PCRIndex], e)
+	}
+
+	result := &LogDiff{}
+	for _, pcr := range sortedPCRs(pcrs) {
+		events := diffEventSequences(oldByPCR[pcr], newByPCR[pcr])
+		if len(events) == 0 {
+			continue
+		}
+		d := &PCRDiff{PCR: pcr, Events: events}
+		for _, e := range events {
+			if e.affectsPCRValue() {
+				d.Diverges = true
+				break
+			}
+		}
+		result.PCRs = append(result.PCRs, d)
+	}
+	return result
+}
+
+// AlgorithmDiff describes how the digest algorithms (PCR banks) recorded in two logs differ.
+type AlgorithmDiff struct {
+	Removed AlgorithmIdList // Algorithms recorded in the old log that are missing from the new log
+	Added   AlgorithmIdList // Algorithms recorded in the new log that are missing from the old log
+
+	// Downgrade indicates that the strongest algorithm recorded in the new log is weaker than the strongest algorithm
+	// recorded in the old log, eg, because the SHA-256 bank was disabled leaving only the SHA-1 bank.
+	Downgrade bool
+}
+
+// strongestAlgorithm returns the algorithm with the largest digest size from algs.
+func strongestAlgorithm(algs AlgorithmIdList) (strongest AlgorithmId) {
+	for _, alg := range algs {
+		if alg.supported() && (!strongest.supported() || alg.size() > strongest.size()) {
+			strongest = alg
+		}
+	}
+	return
+}
+
+// DiffLogAlgorithms compares the digest algorithms recorded in two logs (eg, Log.Algorithms from the previous boot
+// and the current boot). An attacker may deliberately disable the stronger PCR banks so that measurements can be
+// forged using the weaker algorithms that remain, so the result should be checked whenever logs from different boots
+// are compared.
+func DiffLogAlgorithms(old, new AlgorithmIdList) *AlgorithmDiff {
+	d := &AlgorithmDiff{}
+	for _, alg := range old {
+		if !new.Contains(alg) {
+			d.Removed = append(d.Removed, alg)
+		}
+	}
+	for _, alg := range new {
+		if !old.Contains(alg) {
+			d.Added = append(d.Added, alg)
+		}
+	}
+	oldStrongest := strongestAlgorithm(old)
+	newStrongest := strongestAlgorithm(new)
+	d.Downgrade = oldStrongest.supported() && (!newStrongest.supported() || newStrongest.size() < oldStrongest.size())
+	return d
+}
+
+func algorithmListString(algs AlgorithmIdList) string {
+	var s []string
+	for _, alg := range algs {
+		s = append(s, alg.String())
+	}
+	return strings.Join(s, ", ")
+}
+
+// Findings returns the findings for these differences. A downgrade is reported with SeverityError, and the removal
+// of algorithms that isn't a downgrade is reported with SeverityWarning.
+func (d *AlgorithmDiff) Findings() []Finding {
+	switch {
+	case d.Downgrade:
+		return []Finding{{
+			Severity: SeverityError,
+			Kind:     FindingKindDigestAlgorithmDowngrade,
+			Description: fmt.Sprintf("the strongest digest algorithm recorded in the log is weaker than in the "+
+				"previous log, which may indicate that PCR banks were deliberately disabled (removed: %s)",
+				algorithmListString(d.Removed))}}
+	case len(d.Removed) > 0:
+		return []Finding{{
+			Severity: SeverityWarning,
+			Kind:     FindingKindDigestAlgorithmDowngrade,
+			Description: fmt.Sprintf("PCR banks recorded in the previous log are missing from the log: %s",
+				algorithmListString(d.Removed))}}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package tcglog
+
+import (
+	"crypto/sha256"
+	"reflect"
+	"testing"
+)
+
+func makeTestDiffEvent(index uint, pcr PCRIndex, eventType EventType, data string) *Event {
+	h := sha256.Sum256([]byte(data))
+	return &Event{
+		Index:     index,
+		PCRIndex:  pcr,
+		EventType: eventType,
+		Digests:   NewEventDigests(DigestMap{AlgorithmSha256: h[:]}),
+		data:      &opaqueEventData{data: []byte(data)}}
+}
+
+func TestDiffLogs(t *testing.T) {
+	old := []*Event{
+		makeTestDiffEvent(0, 0, EventTypeSCRTMVersion, "version"),
+		makeTestDiffEvent(1, 4, EventTypeEFIAction, "action"),
+		makeTestDiffEvent(2, 4, EventTypeEFIBootServicesApplication, "shim"),
+		makeTestDiffEvent(3, 4, EventTypeEFIBootServicesApplication, "grub"),
+		makeTestDiffEvent(4, 5, EventTypeEFIAction, "removed"),
+		makeTestDiffEvent(5, 7, EventTypeSeparator, "sep")}
+	new := []*Event{
+		makeTestDiffEvent(0, 0, EventTypeSCRTMVersion, "version"),
+		makeTestDiffEvent(1, 4, EventTypeEFIAction, "action"),
+		makeTestDiffEvent(2, 4, EventTypeEFIBootServicesApplication, "shim"),
+		makeTestDiffEvent(3, 4, EventTypeEFIBootServicesApplication, "grub2"),
+		makeTestDiffEvent(4, 7, EventTypeSeparator, "sep"),
+		makeTestDiffEvent(5, 8, EventTypeIPL, "cmdline")}
+
+	diff := DiffLogs(old, new)
+	if len(diff.PCRs) != 3 {
+		t.Fatalf("Unexpected number of PCRs with differences: %d", len(diff.PCRs))
+	}
+
+	pcr4 := diff.PCRs[0]
+	if pcr4.PCR != 4 || len(pcr4.Events) != 1 {
+		t.Fatalf("Unexpected differences for PCR 4: %+v", pcr4)
+	}
+	if e := pcr4.Events[0]; e.Kind != EventDiffChanged || e.Old != old[3] || e.New != new[3] {
+		t.Errorf("Unexpected difference for PCR 4: %s", e)
+	}
+
+	pcr5 := diff.PCRs[1]
+	if pcr5.PCR != 5 || len(pcr5.Events) != 1 || pcr5.Events[0].Kind != EventDiffRemoved || pcr5.Events[0].Old != old[4] {
+		t.Errorf("Unexpected differences for PCR 5: %+v", pcr5)
+	}
+
+	pcr8 := diff.PCRs[2]
+	if pcr8.PCR != 8 || len(pcr8.Events) != 1 || pcr8.Events[0].Kind != EventDiffAdded || pcr8.Events[0].New != new[5] {
+		t.Errorf("Unexpected differences for PCR 8: %+v", pcr8)
+	}
+
+	if pcrs := diff.DivergentPCRs(); !reflect.DeepEqual(pcrs, []PCRIndex{4, 5, 8}) {
+		t.Errorf("Unexpected divergent PCRs: %v", pcrs)
+	}
+}
+
+func TestDiffLogsNoActionDoesntDiverge(t *testing.T) {
+	old := []*Event{makeTestDiffEvent(0, 0, EventTypeNoAction, "a")}
+	new := []*Event{makeTestDiffEvent(0, 0, EventTypeNoAction, "b")}
+
+	diff := DiffLogs(old, new)
+	if len(diff.PCRs) != 1 || diff.PCRs[0].Events[0].Kind != EventDiffChanged {
+		t.Fatalf("Unexpected differences: %+v", diff.PCRs)
+	}
+	if len(diff.DivergentPCRs()) != 0 {
+		t.Errorf("EV_NO_ACTION events shouldn't cause a PCR to diverge")
+	}
+}
+
+func TestDiffLogsIdentical(t *testing.T) {
+	events := []*Event{
+		makeTestDiffEvent(0, 0, EventTypeSCRTMVersion, "version"),
+		makeTestDiffEvent(1, 7, EventTypeSeparator, "sep")}
+	if diff := DiffLogs(events, events); len(diff.PCRs) != 0 {
+		t.Errorf("Unexpected differences: %+v", diff.PCRs)
+	}
+}
+
+func TestDiffLogAlgorithms(t *testing.T) {
+	for _, data := range []struct {
+		desc      string
+		old, new  AlgorithmIdList
+		removed   AlgorithmIdList
+		added     AlgorithmIdList
+		downgrade bool
+		severity  Severity
+	}{
+		{desc: "Unchanged", old: AlgorithmIdList{AlgorithmSha1, AlgorithmSha256}, new: AlgorithmIdList{AlgorithmSha1, AlgorithmSha256}},
+		{desc: "SHA256Removed", old: AlgorithmIdList{AlgorithmSha1, AlgorithmSha256}, new: AlgorithmIdList{AlgorithmSha1},
+			removed: AlgorithmIdList{AlgorithmSha256}, downgrade: true, severity: SeverityError},
+		{desc: "SHA1Removed", old: AlgorithmIdList{AlgorithmSha1, AlgorithmSha256}, new: AlgorithmIdList{AlgorithmSha256},
+			removed: AlgorithmIdList{AlgorithmSha1}, severity: SeverityWarning},
+		{desc: "Upgrade", old: AlgorithmIdList{AlgorithmSha1}, new: AlgorithmIdList{AlgorithmSha1, AlgorithmSha384},
+			added: AlgorithmIdList{AlgorithmSha384}},
+		{desc: "Switch", old: AlgorithmIdList{AlgorithmSha384}, new: AlgorithmIdList{AlgorithmSha256},
+			removed: AlgorithmIdList{AlgorithmSha384}, added: AlgorithmIdList{AlgorithmSha256}, downgrade: true,
+			severity: SeverityError},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			d := DiffLogAlgorithms(data.old, data.new)
+			if !reflect.DeepEqual(d.Removed, data.removed) || !reflect.DeepEqual(d.Added, data.added) ||
+				d.Downgrade != data.downgrade {
+				t.Errorf("Unexpected result: %+v", d)
+			}
+
+			findings := d.Findings()
+			if len(data.removed) == 0 {
+				if len(findings) != 0 {
+					t.Errorf("Unexpected findings: %v", findings)
+				}
+				return
+			}
+			if len(findings) != 1 {
+				t.Fatalf("Unexpected number of findings: %d", len(findings))
+			}
+			if findings[0].Severity != data.severity || findings[0].Kind != FindingKindDigestAlgorithmDowngrade {
+				t.Errorf("Unexpected finding: %s", &findings[0])
+			}
+		})
+	}
+}
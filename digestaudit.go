@@ -0,0 +1,130 @@
+package tcglog
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// DigestMismatchEncoding describes how a digest computed with one algorithm was recorded for another algorithm with a
+// different digest size.
+type DigestMismatchEncoding int
+
+const (
+	// DigestMismatchTruncated indicates that a longer digest was truncated to the size of the recorded algorithm, eg,
+	// a SHA-256 digest truncated to 20 bytes and recorded as the SHA-1 digest.
+	DigestMismatchTruncated DigestMismatchEncoding = iota
+
+	// DigestMismatchZeroPadded indicates that a shorter digest was padded with zeros to the size of the recorded
+	// algorithm, eg, a SHA-1 digest followed by 12 zero bytes recorded as the SHA-256 digest.
+	DigestMismatchZeroPadded
+)
+
+func (e DigestMismatchEncoding) String() string {
+	switch e {
+	case DigestMismatchTruncated:
+		return "truncated"
+	case DigestMismatchZeroPadded:
+		return "zero padded"
+	default:
+		return fmt.Sprintf("DigestMismatchEncoding(%d)", int(e))
+	}
+}
+
+// DigestAlgorithmMismatch describes a digest of an event that was recorded for one algorithm, but which was actually
+// computed from the event data with a different algorithm.
+type DigestAlgorithmMismatch struct {
+	Algorithm       AlgorithmId // The algorithm that the digest was recorded for
+	ActualAlgorithm AlgorithmId // The algorithm that the digest was computed with
+	Encoding        DigestMismatchEncoding
+}
+
+func (m DigestAlgorithmMismatch) String() string {
+	return fmt.Sprintf("%s digest is a %s %s digest", m.Algorithm, m.Encoding, m.ActualAlgorithm)
+}
+
+// auditAlgorithms are the algorithms that recorded digests are compared against by AuditEventDigests.
+var auditAlgorithms = [...]AlgorithmId{AlgorithmSha1, AlgorithmSha256, AlgorithmSha384, AlgorithmSha512}
+
+// AuditEventDigests computes the digests of the data of the supplied event with every supported algorithm, and
+// compares each of the event's recorded digests that isn't generated from the data with the digests computed with
+// the other algorithms. Some firmware records the digest from one bank in another bank, truncating or zero padding
+// it to fit, which otherwise appears as an unexplainable incorrect digest. Events that don't extend a PCR or that have
+// data that can't be verified are skipped, and nil is returned if there are no mismatches.
+func AuditEventDigests(event *ValidatedEvent) []DigestAlgorithmMismatch {
+	if !doesEventTypeExtendPCR(event.Event.EventType) {
+		return nil
+	}
+
+	// Try the bytes that were determined to have been measured for the other digests, as well as the bytes that would
+	// be measured with and without the EV_EFI_VARIABLE_BOOT quirk.
+	var candidates [][]byte
+	if len(event.MeasuredBytes) > 0 {
+		candidates = append(candidates, event.MeasuredBytes)
+	}
+	if data, _ := determineMeasuredBytes(event.Event, false); data != nil {
+		candidates = append(candidates, data)
+	}
+	if event.Event.EventType == EventTypeEFIVariableBoot {
+		if data, _ := determineMeasuredBytes(event.Event, true); data != nil {
+			candidates = append(candidates, data)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	computed := make([]DigestMap, len(candidates))
+	for i, data := range candidates {
+		computed[i] = ComputeEventDigests(auditAlgorithms[:], data, nil, false)
+	}
+
+	var out []DigestAlgorithmMismatch
+Digests:
+	for _, alg := range event.Event.Digests.Algorithms() {
+		recorded := event.Event.Digests.Get(alg)
+		for _, digests := range computed {
+			if bytes.Equal(digests[alg], recorded) {
+				continue Digests
+			}
+		}
+
+		for _, digests := range computed {
+			for _, actual := range auditAlgorithms {
+				d := digests[actual]
+				switch {
+				case actual == alg:
+					continue
+				case len(d) >= len(recorded) && bytes.Equal(d[:len(recorded)], recorded):
+					out = append(out, DigestAlgorithmMismatch{
+						Algorithm: alg, ActualAlgorithm: actual, Encoding: DigestMismatchTruncated})
+				case len(d) < len(recorded) && bytes.Equal(recorded[:len(d)], d) &&
+					bytes.Count(recorded[len(d):], []byte{0}) == len(recorded)-len(d):
+					out = append(out, DigestAlgorithmMismatch{
+						Algorithm: alg, ActualAlgorithm: actual, Encoding: DigestMismatchZeroPadded})
+				default:
+					continue
+				}
+				continue Digests
+			}
+		}
+	}
+	return out
+}
+
+// DigestAuditFindings returns a finding for each digest in the supplied result that was computed with a different
+// algorithm to the one it was recorded for (see AuditEventDigests).
+func DigestAuditFindings(result *LogValidateResult) []Finding {
+	var findings []Finding
+	for _, events := range [][]*ValidatedEvent{result.ValidatedEvents, result.FinalEvents} {
+		for _, e := range events {
+			for _, m := range AuditEventDigests(e) {
+				findings = append(findings, Finding{
+					Severity:    SeverityWarning,
+					Kind:        FindingKindDigestAlgorithmMismatch,
+					Description: fmt.Sprintf("%s (digest: %x)", m, e.Event.Digests.Get(m.Algorithm)),
+					Event:       e.Event})
+			}
+		}
+	}
+	return findings
+}
@@ -0,0 +1,61 @@
+package tcglog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAuditEventDigests(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+	action := []byte("Calling EFI Application from Boot Option")
+
+	correct := makeTestLogEvent(4, EventTypeEFIAction, action, algs...)
+	padded := makeTestLogEvent(4, EventTypeEFIAction, action, algs...)
+	padded.digests[1].digest = append(AlgorithmSha1.hash(action), make([]byte, 12)...)
+	truncated := makeTestLogEvent(7, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...)
+	truncated.digests[0].digest = AlgorithmSha256.hash([]byte{0, 0, 0, 0})[:20]
+	unrelated := makeTestLogEvent(7, EventTypeEFIAction, action, algs...)
+	unrelated.digests[1].digest = AlgorithmSha256.hash([]byte("foo"))
+
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "log")
+	log := makeTestLog_2(algs, []testLogEvent{correct, padded, truncated, unrelated})
+	if err := ioutil.WriteFile(logPath, log, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	result, err := ReplayAndValidateLog(logPath, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayAndValidateLog failed: %v", err)
+	}
+	if len(result.ValidatedEvents) != 5 {
+		t.Fatalf("Unexpected number of events: %d", len(result.ValidatedEvents))
+	}
+
+	for i, expected := range [][]DigestAlgorithmMismatch{
+		nil,
+		nil,
+		{{Algorithm: AlgorithmSha256, ActualAlgorithm: AlgorithmSha1, Encoding: DigestMismatchZeroPadded}},
+		{{Algorithm: AlgorithmSha1, ActualAlgorithm: AlgorithmSha256, Encoding: DigestMismatchTruncated}},
+		nil,
+	} {
+		if m := AuditEventDigests(result.ValidatedEvents[i]); !reflect.DeepEqual(m, expected) {
+			t.Errorf("Unexpected result for event %d: %v", i, m)
+		}
+	}
+
+	findings := DigestAuditFindings(result)
+	if len(findings) != 2 {
+		t.Fatalf("Unexpected number of findings: %d", len(findings))
+	}
+	if findings[0].Kind != FindingKindDigestAlgorithmMismatch || findings[0].Event != result.ValidatedEvents[2].Event {
+		t.Errorf("Unexpected finding: %v", findings[0])
+	}
+}
@@ -0,0 +1,181 @@
+package tcglog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// KernelTPMMessageKind describes a TPM related problem reported by the Linux kernel.
+type KernelTPMMessageKind int
+
+const (
+	// KernelTPMMessageTransmitError indicates that the kernel couldn't send a command to the TPM or receive its
+	// response (eg, because of a timeout), so the command may not have been executed.
+	KernelTPMMessageTransmitError KernelTPMMessageKind = iota
+
+	// KernelTPMMessageCommandError indicates that the TPM returned an error for a command sent by the kernel.
+	KernelTPMMessageCommandError
+
+	// KernelTPMMessageEventLogError indicates that the kernel couldn't read all of the event log or the final events
+	// table from the firmware, so the log that it exports may be truncated or may be missing events.
+	KernelTPMMessageEventLogError
+
+	// KernelTPMMessageFirmwareBug indicates that the kernel worked around a bug in the firmware's description of
+	// the TPM.
+	KernelTPMMessageFirmwareBug
+
+	// KernelTPMMessageNoTPM indicates that the kernel didn't find a TPM, so nothing was measured by the kernel
+	// (eg, by IMA).
+	KernelTPMMessageNoTPM
+)
+
+func (k KernelTPMMessageKind) String() string {
+	switch k {
+	case KernelTPMMessageTransmitError:
+		return "transmit error"
+	case KernelTPMMessageCommandError:
+		return "command error"
+	case KernelTPMMessageEventLogError:
+		return "event log error"
+	case KernelTPMMessageFirmwareBug:
+		return "firmware bug"
+	case KernelTPMMessageNoTPM:
+		return "no TPM"
+	default:
+		return fmt.Sprintf("KernelTPMMessageKind(%d)", int(k))
+	}
+}
+
+// KernelTPMMessage is a TPM related message from the kernel log.
+type KernelTPMMessage struct {
+	Kind KernelTPMMessageKind
+	Line int    // The line number in the supplied kernel log, starting from 1
+	Text string // The message, without the timestamp or journal prefix
+}
+
+func (m *KernelTPMMessage) String() string {
+	return fmt.Sprintf("line %d: %s", m.Line, m.Text)
+}
+
+var (
+	// Matches the timestamp prefix added by dmesg ("[    1.234567] ") and the prefix added by journalctl -k
+	// ("Oct 15 09:00:00 host kernel: ").
+	kernelMessagePrefixRE = regexp.MustCompile(`^(?:\S+ +\d+ +[0-9:]+ +\S+ +kernel: +)?(?:\[ *[0-9.]+\] +)?`)
+
+	kernelTPMMessagePatterns = []struct {
+		kind KernelTPMMessageKind
+		re   *regexp.Regexp
+	}{
+		// https://github.com/torvalds/linux/blob/master/drivers/firmware/efi/tpm.c and
+		// https://github.com/torvalds/linux/blob/master/drivers/char/tpm/eventlog/
+		{KernelTPMMessageEventLogError, regexp.MustCompile(`(?i)tpm.*(final event(s)? log|event log).*` +
+			`(fail|too (big|large)|truncat|invalid|not found|corrupt)|` +
+			`fail.*(map|read|parse).*tpm.*(final event|event log)`)},
+		{KernelTPMMessageFirmwareBug, regexp.MustCompile(`(?i)\[Firmware Bug\].*tpm|tpm.*\[Firmware Bug\]`)},
+		// https://github.com/torvalds/linux/blob/master/drivers/char/tpm/tpm-interface.c
+		{KernelTPMMessageTransmitError, regexp.MustCompile(`(?i)tpm.*(send\(\): error|recv\(\): error|` +
+			`tpm_transmit.*error|timed out)`)},
+		// https://github.com/torvalds/linux/blob/master/drivers/char/tpm/tpm2-cmd.c
+		{KernelTPMMessageCommandError, regexp.MustCompile(`(?i)tpm.*(A TPM error \(\d+\) occurred|` +
+			`self test failed|failed to extend|pcr_extend.*error)`)},
+		// https://github.com/torvalds/linux/blob/master/security/integrity/ima/ima_init.c
+		{KernelTPMMessageNoTPM, regexp.MustCompile(`(?i)No TPM chip found`)},
+	}
+)
+
+// ReadKernelTPMMessages reads a kernel log in the format produced by dmesg or journalctl -k from r, and returns the
+// messages that report TPM related problems, in the order in which they appear.
+func ReadKernelTPMMessages(r io.Reader) ([]*KernelTPMMessage, error) {
+	var out []*KernelTPMMessage
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(kernelMessagePrefixRE.ReplaceAllString(scanner.Text(), ""))
+		for _, p := range kernelTPMMessagePatterns {
+			if p.re.MatchString(text) {
+				out = append(out, &KernelTPMMessage{Kind: p.kind, Line: n, Text: text})
+				break
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read kernel log: %v", err)
+	}
+	return out, nil
+}
+
+func hasFindingKind(findings []Finding, kind FindingKind) bool {
+	for _, f := range findings {
+		if f.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// CorrelateKernelTPMMessages correlates the supplied kernel messages with findings from checking the log (eg, from
+// FindingsFromResult or SelfCheck), and returns additional findings that describe the messages and, where the
+// messages explain other findings, a combined diagnosis. The supplied findings are not modified.
+func CorrelateKernelTPMMessages(messages []*KernelTPMMessage, findings []Finding) []Finding {
+	var out []Finding
+	byKind := make(map[KernelTPMMessageKind][]*KernelTPMMessage)
+	for _, m := range messages {
+		byKind[m.Kind] = append(byKind[m.Kind], m)
+		switch m.Kind {
+		case KernelTPMMessageTransmitError, KernelTPMMessageCommandError:
+			out = append(out, Finding{
+				Severity:    SeverityWarning,
+				Kind:        FindingKindKernelTPMError,
+				Description: fmt.Sprintf("kernel reported a TPM %s (%s)", m.Kind, m)})
+		case KernelTPMMessageEventLogError:
+			out = append(out, Finding{
+				Severity:    SeverityWarning,
+				Kind:        FindingKindKernelEventLogError,
+				Description: fmt.Sprintf("kernel reported a problem reading the event log (%s)", m)})
+		case KernelTPMMessageFirmwareBug:
+			out = append(out, Finding{
+				Severity:    SeverityInfo,
+				Kind:        FindingKindKernelTPMFirmwareBug,
+				Description: fmt.Sprintf("kernel worked around a firmware bug (%s)", m)})
+		case KernelTPMMessageNoTPM:
+			out = append(out, Finding{
+				Severity:    SeverityWarning,
+				Kind:        FindingKindKernelNoTPM,
+				Description: fmt.Sprintf("kernel didn't find a TPM (%s)", m)})
+		}
+	}
+
+	mismatch := hasFindingKind(findings, FindingKindPCRMismatch)
+	logErrors := byKind[KernelTPMMessageEventLogError]
+	tpmErrors := append(append([]*KernelTPMMessage(nil), byKind[KernelTPMMessageTransmitError]...),
+		byKind[KernelTPMMessageCommandError]...)
+
+	switch {
+	case mismatch && len(logErrors) > 0:
+		out = append(out, Finding{
+			Severity: SeverityError,
+			Kind:     FindingKindKernelDiagnosis,
+			Description: fmt.Sprintf("the log is not consistent with the TPM, and the kernel reported that it couldn't "+
+				"read all of the event log (%s), so the exported log is probably incomplete rather than the "+
+				"measurements being unexpected", logErrors[0])})
+	case mismatch && len(tpmErrors) > 0:
+		out = append(out, Finding{
+			Severity: SeverityError,
+			Kind:     FindingKindKernelDiagnosis,
+			Description: fmt.Sprintf("the log is not consistent with the TPM, and the kernel reported %d TPM "+
+				"communication errors (first: %s), so measurements may not have reached the TPM or the PCR values "+
+				"may not have been read correctly", len(tpmErrors), tpmErrors[0])})
+	}
+	if len(logErrors) > 0 && hasFindingKind(findings, FindingKindMissingSeparator) {
+		out = append(out, Finding{
+			Severity: SeverityWarning,
+			Kind:     FindingKindKernelDiagnosis,
+			Description: fmt.Sprintf("EV_SEPARATOR events are missing from the log, which is consistent with the "+
+				"kernel's problem reading the event log (%s)", logErrors[0])})
+	}
+
+	sortFindings(out)
+	return out
+}
@@ -0,0 +1,72 @@
+package tcglog
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadKernelTPMMessages(t *testing.T) {
+	log := `[    0.000000] Linux version 5.4.0-42-generic (buildd@lgw01-amd64-038)
+[    0.004512] efi: ACPI=0x7ffbe000 ACPI 2.0=0x7ffbe014 TPMFinalLog=0x7ff4f000 TPMEventLog=0x7cc8c018
+[    0.912345] tpm_tis 00:05: 2.0 TPM (device-id 0x1B, rev-id 16)
+[    0.913001] tpm tpm0: [Firmware Bug]: TPM interrupt not working, polling instead
+[    0.913521] tpm tpm0: Adjusting reported timeouts: A 10000->750000us B 10000->2000000us
+Oct 15 09:00:01 host kernel: [    1.104006] tpm tpm0: tpm_try_transmit: send(): error -62
+Oct 15 09:00:01 host kernel: tpm tpm0: A TPM error (256) occurred attempting extend a PCR
+[    1.500000] tpm tpm0: Failed to map TPM final event log
+[    1.600000] ima: No TPM chip found, activating TPM-bypass!
+`
+	messages, err := ReadKernelTPMMessages(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("ReadKernelTPMMessages failed: %v", err)
+	}
+
+	expected := []*KernelTPMMessage{
+		{Kind: KernelTPMMessageFirmwareBug, Line: 4,
+			Text: "tpm tpm0: [Firmware Bug]: TPM interrupt not working, polling instead"},
+		{Kind: KernelTPMMessageTransmitError, Line: 6, Text: "tpm tpm0: tpm_try_transmit: send(): error -62"},
+		{Kind: KernelTPMMessageCommandError, Line: 7,
+			Text: "tpm tpm0: A TPM error (256) occurred attempting extend a PCR"},
+		{Kind: KernelTPMMessageEventLogError, Line: 8, Text: "tpm tpm0: Failed to map TPM final event log"},
+		{Kind: KernelTPMMessageNoTPM, Line: 9, Text: "ima: No TPM chip found, activating TPM-bypass!"}}
+	if !reflect.DeepEqual(messages, expected) {
+		for _, m := range messages {
+			t.Logf("%d %s", m.Kind, m)
+		}
+		t.Errorf("Unexpected messages")
+	}
+}
+
+func TestCorrelateKernelTPMMessages(t *testing.T) {
+	logError := &KernelTPMMessage{Kind: KernelTPMMessageEventLogError, Line: 2,
+		Text: "tpm tpm0: Failed to map TPM final event log"}
+	transmitError := &KernelTPMMessage{Kind: KernelTPMMessageTransmitError, Line: 1,
+		Text: "tpm tpm0: tpm_try_transmit: send(): error -62"}
+	mismatch := Finding{Severity: SeverityError, Kind: FindingKindPCRMismatch, Description: "foo"}
+	missingSeparator := Finding{Severity: SeverityError, Kind: FindingKindMissingSeparator, Description: "bar"}
+
+	for i, data := range []struct {
+		messages []*KernelTPMMessage
+		findings []Finding
+		kinds    []FindingKind
+	}{
+		{},
+		{messages: []*KernelTPMMessage{transmitError}, kinds: []FindingKind{FindingKindKernelTPMError}},
+		{messages: []*KernelTPMMessage{transmitError}, findings: []Finding{mismatch},
+			kinds: []FindingKind{FindingKindKernelDiagnosis, FindingKindKernelTPMError}},
+		{messages: []*KernelTPMMessage{transmitError, logError}, findings: []Finding{mismatch, missingSeparator},
+			kinds: []FindingKind{FindingKindKernelDiagnosis, FindingKindKernelTPMError,
+				FindingKindKernelEventLogError, FindingKindKernelDiagnosis}},
+		{messages: []*KernelTPMMessage{logError}, findings: []Finding{missingSeparator},
+			kinds: []FindingKind{FindingKindKernelEventLogError, FindingKindKernelDiagnosis}},
+	} {
+		var kinds []FindingKind
+		for _, f := range CorrelateKernelTPMMessages(data.messages, data.findings) {
+			kinds = append(kinds, f.Kind)
+		}
+		if !reflect.DeepEqual(kinds, data.kinds) {
+			t.Errorf("Unexpected findings for test %d: %v", i, kinds)
+		}
+	}
+}
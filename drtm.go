@@ -0,0 +1,95 @@
+package tcglog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// drtmPCRs are the PCRs that are reset by a D-RTM launch (eg, Intel TXT GETSEC[SENTER]). They are initialized to all
+// ones when the TPM starts up, and can only be reset to zero from locality 4 by the CPU during a D-RTM launch.
+var drtmPCRs = [...]PCRIndex{17, 18, 19, 20, 21, 22}
+
+// IsDRTMPCR indicates whether the specified PCR is one of the PCRs that is reset by a D-RTM launch.
+func IsDRTMPCR(pcr PCRIndex) bool {
+	for _, p := range drtmPCRs {
+		if p == pcr {
+			return true
+		}
+	}
+	return false
+}
+
+// NoDRTMPCRValue returns the value of a D-RTM PCR for the specified algorithm on a platform that hasn't performed a
+// D-RTM launch since the TPM was started up. A PCR read from the TPM with this value indicates that the D-RTM log
+// doesn't apply to the current boot.
+func NoDRTMPCRValue(alg AlgorithmId) Digest {
+	d := make(Digest, alg.size())
+	for i := range d {
+		d[i] = 0xff
+	}
+	return d
+}
+
+// https://www.intel.com/content/dam/www/public/us/en/documents/guides/intel-txt-software-development-guide.pdf
+//  (appendix F.1 "TPM 1.2 Event Log")
+const txtEventContainerSignature = "TXT Event Container\x00"
+
+// txtEventContainerHeader corresponds to the header of the TPM 1.2 event log container that the MLE (eg, tboot)
+// places in the TXT heap and advertises to the SINIT ACM in the OsSinitData TPM event log pointer element.
+type txtEventContainerHeader struct {
+	Signature         [20]byte
+	Reserved          [12]byte
+	ContainerVerMajor uint8
+	ContainerVerMinor uint8
+	PCREventVerMajor  uint8
+	PCREventVerMinor  uint8
+	Size              uint32
+	PCREventsOffset   uint32
+	NextEventOffset   uint32
+}
+
+// NewDRTMLog creates a new Log instance that reads the D-RTM event log recorded by an Intel TXT launch from r, which
+// is a copy of the log area of the specified size from the TXT heap, such as the one that tboot or TrenchBoot expose
+// to the OS (eg, /sys/kernel/security/slaunch/eventlog). On platforms with a TPM 1.2 device, the area contains a TXT
+// event container with a log in the format defined by the TCG PC Client specification for TPM 1.2. On platforms with a
+// TPM 2.0 device, it contains a log in the crypto-agile format followed by unused space, as with NewLogFromArea.
+func NewDRTMLog(r io.ReaderAt, size int64, options LogOptions) (*Log, error) {
+	var header txtEventContainerHeader
+	if size >= int64(binary.Size(header)) {
+		if err := binary.Read(io.NewSectionReader(r, 0, size), binary.LittleEndian, &header); err != nil {
+			return nil, fmt.Errorf("cannot read log header: %v", err)
+		}
+	}
+	if string(header.Signature[:]) != txtEventContainerSignature {
+		return NewLogFromArea(r, size, options)
+	}
+
+	if header.ContainerVerMajor != 1 || header.PCREventVerMajor != 1 {
+		return nil, fmt.Errorf("unsupported TXT event container version %d.%d (PCR event version %d.%d)",
+			header.ContainerVerMajor, header.ContainerVerMinor, header.PCREventVerMajor, header.PCREventVerMinor)
+	}
+	if int64(header.Size) > size || header.NextEventOffset > header.Size ||
+		header.PCREventsOffset < uint32(binary.Size(header)) || header.PCREventsOffset > header.NextEventOffset {
+		return nil, fmt.Errorf("invalid TXT event container (size: %d, PCR events offset: %d, next event offset: %d)",
+			header.Size, header.PCREventsOffset, header.NextEventOffset)
+	}
+
+	// NextEventOffset is where the SINIT ACM or MLE will write the next event, so it marks the end of the log.
+	events := io.NewSectionReader(r, int64(header.PCREventsOffset),
+		int64(header.NextEventOffset-header.PCREventsOffset))
+	if events.Size() == 0 {
+		return nil, errors.New("TXT event container is empty")
+	}
+	return NewLog(events, options)
+}
+
+// ReplayAndValidateDRTMLog is like ReplayAndValidateLog, but reads a D-RTM event log from the log area at logPath (see
+// NewDRTMLog). The D-RTM PCRs (17 - 22) start from zero after a launch rather than from their power-on value, so the
+// expected values of all of these PCRs are always present in the result, including those that aren't extended by the
+// log. The analysis of separators, the startup locality and ExitBootServices in the result only applies to logs
+// recorded by the S-RTM.
+func ReplayAndValidateDRTMLog(logPath string, options LogOptions) (*LogValidateResult, error) {
+	return replayAndValidateLogArea(logPath, options, NewDRTMLog, drtmPCRs[:])
+}
@@ -0,0 +1,123 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makeTestTXTEventContainer(events []byte, unused int) []byte {
+	header := txtEventContainerHeader{ContainerVerMajor: 1, PCREventVerMajor: 1}
+	copy(header.Signature[:], txtEventContainerSignature)
+	header.PCREventsOffset = uint32(binary.Size(header))
+	header.NextEventOffset = header.PCREventsOffset + uint32(len(events))
+	header.Size = header.NextEventOffset + uint32(unused)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header)
+	buf.Write(events)
+	buf.Write(make([]byte, unused))
+	return buf.Bytes()
+}
+
+func countTestLogEvents(t *testing.T, log *Log) (n int) {
+	for {
+		_, err := log.NextEvent()
+		if err == io.EOF {
+			return n
+		}
+		if err != nil {
+			t.Fatalf("NextEvent failed: %v", err)
+		}
+		n++
+	}
+}
+
+func TestNewDRTMLog(t *testing.T) {
+	t.Run("TPM12", func(t *testing.T) {
+		events := makeTestLog_1_2([]testLogEvent{
+			{pcrIndex: 17, eventType: EventTypeTXTHashStart, data: []byte("sinit")},
+			{pcrIndex: 17, eventType: EventTypeTXTBIOSACRegData, data: []byte("regs")},
+			{pcrIndex: 18, eventType: EventTypeTXTMLEHash, data: []byte("mle")}})
+		area := makeTestTXTEventContainer(events, 4096)
+
+		log, err := NewDRTMLog(bytes.NewReader(area), int64(len(area)), LogOptions{})
+		if err != nil {
+			t.Fatalf("NewDRTMLog failed: %v", err)
+		}
+		if !log.Algorithms.Contains(AlgorithmSha1) {
+			t.Errorf("Unexpected algorithms: %v", log.Algorithms)
+		}
+		if n := countTestLogEvents(t, log); n != 3 {
+			t.Errorf("Unexpected number of events: %d", n)
+		}
+	})
+
+	t.Run("TPM2", func(t *testing.T) {
+		algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+		area := append(makeTestLog_2(algs, []testLogEvent{
+			makeTestLogEvent(17, EventTypeTXTHashStart, []byte("sinit"), algs...),
+			makeTestLogEvent(18, EventTypeTXTMLEHash, []byte("mle"), algs...)}), make([]byte, 4096)...)
+
+		log, err := NewDRTMLog(bytes.NewReader(area), int64(len(area)), LogOptions{})
+		if err != nil {
+			t.Fatalf("NewDRTMLog failed: %v", err)
+		}
+		if n := countTestLogEvents(t, log); n != 3 {
+			t.Errorf("Unexpected number of events: %d", n)
+		}
+	})
+
+	t.Run("InvalidContainer", func(t *testing.T) {
+		area := makeTestTXTEventContainer(nil, 0)
+		binary.LittleEndian.PutUint32(area[40:], 4096)
+		if _, err := NewDRTMLog(bytes.NewReader(area), int64(len(area)), LogOptions{}); err == nil {
+			t.Errorf("NewDRTMLog should fail with an invalid TXT event container")
+		}
+	})
+}
+
+func TestReplayAndValidateDRTMLog(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+	area := append(makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(17, EventTypeTXTHashStart, []byte("sinit"), algs...),
+		makeTestLogEvent(17, EventTypeTXTBIOSACRegData, []byte("regs"), algs...),
+		makeTestLogEvent(18, EventTypeTXTMLEHash, []byte("mle"), algs...)}), make([]byte, 4096)...)
+
+	dir, err := ioutil.TempDir("", "tcglog")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "drtm")
+	if err := ioutil.WriteFile(path, area, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	result, err := ReplayAndValidateDRTMLog(path, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayAndValidateDRTMLog failed: %v", err)
+	}
+
+	zero := make(Digest, 32)
+	pcr17 := performHashExtendOperation(AlgorithmSha256, zero, AlgorithmSha256.hash([]byte("sinit")))
+	pcr17 = performHashExtendOperation(AlgorithmSha256, pcr17, AlgorithmSha256.hash([]byte("regs")))
+	if !bytes.Equal(result.ExpectedPCRValues[17][AlgorithmSha256], pcr17) {
+		t.Errorf("Unexpected PCR 17 value: %x", result.ExpectedPCRValues[17][AlgorithmSha256])
+	}
+	for _, pcr := range []PCRIndex{19, 20, 21, 22} {
+		if !bytes.Equal(result.ExpectedPCRValues[pcr][AlgorithmSha256], zero) {
+			t.Errorf("Unexpected PCR %d value: %x", pcr, result.ExpectedPCRValues[pcr][AlgorithmSha256])
+		}
+	}
+	if _, ok := result.ExpectedPCRValues[0]; ok {
+		t.Errorf("PCR 0 should not be present")
+	}
+	if IsDRTMPCR(0) || !IsDRTMPCR(17) || !IsDRTMPCR(22) {
+		t.Errorf("Unexpected IsDRTMPCR result")
+	}
+}
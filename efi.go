@@ -3,8 +3,10 @@ package tcglog
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"strings"
 	"unicode/utf16"
 	"unicode/utf8"
 )
@@ -15,20 +17,37 @@ var (
 	surr3 uint16 = 0xe000
 )
 
+// readUTF16Char reads the next little-endian UTF-16 code unit from stream.
+func readUTF16Char(stream *bytes.Reader) (uint16, error) {
+	lo, err := stream.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	hi, err := stream.ReadByte()
+	if err != nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return uint16(lo) | uint16(hi)<<8, nil
+}
+
 // UEFI_VARIABLE_DATA specifies the number of *characters* for a UTF-16 sequence rather than the size of
 // the buffer. Extract a UTF-16 sequence of the correct length, given a buffer and the number of characters.
 // The returned buffer can be passed to utf16.Decode.
-func extractUTF16Buffer(stream io.ReadSeeker, nchars uint64) ([]uint16, error) {
+func extractUTF16Buffer(stream *bytes.Reader, nchars uint64) ([]uint16, error) {
 	var out []uint16
+	if nchars <= uint64(stream.Len()/2) {
+		out = make([]uint16, 0, nchars)
+	}
 
 	for i := nchars; i > 0; i-- {
-		var c uint16
-		if err := binary.Read(stream, binary.LittleEndian, &c); err != nil {
+		c, err := readUTF16Char(stream)
+		if err != nil {
 			return nil, err
 		}
 		out = append(out, c)
 		if c >= surr1 && c < surr2 {
-			if err := binary.Read(stream, binary.LittleEndian, &c); err != nil {
+			c, err = readUTF16Char(stream)
+			if err != nil {
 				return nil, err
 			}
 			if c < surr2 || c >= surr3 {
@@ -66,9 +85,36 @@ func NewEFIGUID(a uint32, b, c, d uint16, e [6]uint8) *EFIGUID {
 	return guid
 }
 
+// efiGUIDSize is the size of an encoded EFI_GUID.
+const efiGUIDSize = 16
+
+// decodeEFIGUID decodes a GUID from the first efiGUIDSize bytes of b, which is equivalent to decoding it with
+// binary.Read but without the reflection.
+func decodeEFIGUID(b []byte) (out EFIGUID) {
+	out.Data1 = binary.LittleEndian.Uint32(b[0:4])
+	out.Data2 = binary.LittleEndian.Uint16(b[4:6])
+	out.Data3 = binary.LittleEndian.Uint16(b[6:8])
+	copy(out.Data4[:], b[8:efiGUIDSize])
+	return out
+}
+
+// parseEFIGUID decodes a GUID from its textual form, with or without braces and in either case.
+func parseEFIGUID(s string) (EFIGUID, error) {
+	b, err := hex.DecodeString(strings.Replace(strings.Trim(s, "{}"), "-", "", -1))
+	if err != nil || len(b) != 16 || strings.Count(s, "-") != 4 {
+		return EFIGUID{}, fmt.Errorf("invalid GUID \"%s\"", s)
+	}
+	var g EFIGUID
+	g.Data1 = binary.BigEndian.Uint32(b[0:])
+	g.Data2 = binary.BigEndian.Uint16(b[4:])
+	g.Data3 = binary.BigEndian.Uint16(b[6:])
+	copy(g.Data4[:], b[8:])
+	return g, nil
+}
+
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_EFI_Platform_1_22_Final_-v15.pdf
 //  (section 7.4 "EV_NO_ACTION Event Types")
-func parseEFI_1_2_SpecIdEvent(stream io.Reader, eventData *SpecIdEventData) error {
+func parseEFI_1_2_SpecIdEvent(stream *bytes.Reader, eventData *SpecIdEventData) error {
 	eventData.Spec = SpecEFI_1_2
 
 	// TCG_EfiSpecIdEventStruct.vendorInfoSize
@@ -88,7 +134,7 @@ func parseEFI_1_2_SpecIdEvent(stream io.Reader, eventData *SpecIdEventData) erro
 
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
 //  (secion 9.4.5.1 "Specification ID Version Event")
-func parseEFI_2_SpecIdEvent(stream io.Reader, eventData *SpecIdEventData) error {
+func parseEFI_2_SpecIdEvent(stream *bytes.Reader, eventData *SpecIdEventData) error {
 	eventData.Spec = SpecEFI_2
 
 	// TCG_EfiSpecIdEvent.numberOfAlgorithms
@@ -100,6 +146,9 @@ func parseEFI_2_SpecIdEvent(stream io.Reader, eventData *SpecIdEventData) error
 	if numberOfAlgorithms < 1 {
 		return invalidSpecIdEventError{"numberOfAlgorithms is zero"}
 	}
+	if uint64(numberOfAlgorithms) > uint64(stream.Len()/binary.Size(EFISpecIdEventAlgorithmSize{})) {
+		return invalidSpecIdEventError{fmt.Sprintf("numberOfAlgorithms is too large (%d)", numberOfAlgorithms)}
+	}
 
 	// TCG_EfiSpecIdEvent.digestSizes
 	eventData.DigestSizes = make([]EFISpecIdEventAlgorithmSize, numberOfAlgorithms)
@@ -129,6 +178,89 @@ func parseEFI_2_SpecIdEvent(stream io.Reader, eventData *SpecIdEventData) error
 	return nil
 }
 
+// EFITCG2Version corresponds to the EFI_TCG2_VERSION type.
+type EFITCG2Version struct {
+	Major uint8
+	Minor uint8
+}
+
+// EFITCG2BootServiceCapability corresponds to the EFI_TCG2_BOOT_SERVICE_CAPABILITY type, which describes the
+// capabilities of the firmware's TCG2 protocol implementation. For structures with a StructureVersion of 1.0, the
+// NumberOfPCRBanks and ActivePCRBanks fields are not present and will be zero.
+type EFITCG2BootServiceCapability struct {
+	Size                uint8
+	StructureVersion    EFITCG2Version
+	ProtocolVersion     EFITCG2Version
+	HashAlgorithmBitmap uint32
+	SupportedEventLogs  uint32
+	TPMPresentFlag      uint8
+	MaxCommandSize      uint16
+	MaxResponseSize     uint16
+	ManufacturerID      uint32
+	NumberOfPCRBanks    uint32
+	ActivePCRBanks      uint32
+}
+
+const (
+	efiTCG2BootServiceCapabilitySize_1_0 = 22
+	efiTCG2BootServiceCapabilitySize_1_1 = 30
+)
+
+// TCG2BootServiceCapability decodes the vendorInfo field of the Spec ID event as a EFI_TCG2_BOOT_SERVICE_CAPABILITY
+// structure, which some EDK2 derived firmware places there. It returns false if the vendorInfo field doesn't contain a
+// recognized layout.
+//
+// https://trustedcomputinggroup.org/wp-content/uploads/EFI-Protocol-Specification-rev13-160330final.pdf
+//  (section 6.4 "EFI_TCG2_PROTOCOL.GetCapability")
+func (e *SpecIdEventData) TCG2BootServiceCapability() (*EFITCG2BootServiceCapability, bool) {
+	if len(e.VendorInfo) == 0 || int(e.VendorInfo[0]) != len(e.VendorInfo) {
+		return nil, false
+	}
+
+	stream := bytes.NewReader(e.VendorInfo)
+	var out EFITCG2BootServiceCapability
+
+	switch len(e.VendorInfo) {
+	case efiTCG2BootServiceCapabilitySize_1_0:
+		var c struct {
+			Size                uint8
+			StructureVersion    EFITCG2Version
+			ProtocolVersion     EFITCG2Version
+			HashAlgorithmBitmap uint32
+			SupportedEventLogs  uint32
+			TPMPresentFlag      uint8
+			MaxCommandSize      uint16
+			MaxResponseSize     uint16
+			ManufacturerID      uint32
+		}
+		if err := binary.Read(stream, binary.LittleEndian, &c); err != nil {
+			return nil, false
+		}
+		out = EFITCG2BootServiceCapability{
+			Size:                c.Size,
+			StructureVersion:    c.StructureVersion,
+			ProtocolVersion:     c.ProtocolVersion,
+			HashAlgorithmBitmap: c.HashAlgorithmBitmap,
+			SupportedEventLogs:  c.SupportedEventLogs,
+			TPMPresentFlag:      c.TPMPresentFlag,
+			MaxCommandSize:      c.MaxCommandSize,
+			MaxResponseSize:     c.MaxResponseSize,
+			ManufacturerID:      c.ManufacturerID}
+	case efiTCG2BootServiceCapabilitySize_1_1:
+		if err := binary.Read(stream, binary.LittleEndian, &out); err != nil {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	if out.StructureVersion.Major != 1 {
+		return nil, false
+	}
+
+	return &out, true
+}
+
 type startupLocalityEventData struct {
 	data     []byte
 	Locality uint8
@@ -195,14 +327,28 @@ func decodeBIMReferenceManifestEvent(stream io.Reader, data []byte) (*bimReferen
 // EFIVariableEventData corresponds to the EFI_VARIABLE_DATA type.
 type EFIVariableEventData struct {
 	data         []byte
+	eventType    EventType
+	limits       decodeLimits // The limits for decoding the variable data
 	VariableName EFIGUID
 	UnicodeName  string
 	VariableData []byte
 }
 
 func (e *EFIVariableEventData) String() string {
-	return fmt.Sprintf("UEFI_VARIABLE_DATA{ VariableName: %s, UnicodeName: \"%s\" }",
-		e.VariableName.String(), e.UnicodeName)
+	switch e.eventType {
+	case EventTypeEFIVariableAuthority:
+		if summary, err := e.AuthorityCertificateSummary(); err == nil {
+			return fmt.Sprintf("UEFI_VARIABLE_DATA{ VariableName: %s, UnicodeName: \"%s\", %s }",
+				e.VariableName.nameOrString(), e.UnicodeName, summary)
+		}
+	case EventTypeEFIVariableBoot:
+		if s, ok := e.bootVariableString(); ok {
+			return fmt.Sprintf("UEFI_VARIABLE_DATA{ VariableName: %s, UnicodeName: \"%s\", VariableData: %s }",
+				e.VariableName.nameOrString(), e.UnicodeName, s)
+		}
+	}
+	return fmt.Sprintf("UEFI_VARIABLE_DATA{ VariableName: %s, UnicodeName: \"%s\", VariableDataLength: %d }",
+		e.VariableName.nameOrString(), e.UnicodeName, len(e.VariableData))
 }
 
 func (e *EFIVariableEventData) Bytes() []byte {
@@ -230,364 +376,61 @@ func (e *EFIVariableEventData) EncodeMeasuredBytes(buf io.Writer) error {
 
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_EFI_Platform_1_22_Final_-v15.pdf (section 7.8 "Measuring EFI Variables")
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf (section 9.2.6 "Measuring UEFI Variables")
-func decodeEventDataEFIVariableImpl(data []byte, eventType EventType) (*EFIVariableEventData, int, error) {
+func decodeEventDataEFIVariableImpl(data []byte, eventType EventType,
+	limits decodeLimits) (*EFIVariableEventData, int, error) {
 	stream := bytes.NewReader(data)
 
-	var guid EFIGUID
-	if err := binary.Read(stream, binary.LittleEndian, &guid); err != nil {
+	guid, err := readEventDataGUID(stream)
+	if err != nil {
 		return nil, 0, err
 	}
 
-	var unicodeNameLength uint64
-	if err := binary.Read(stream, binary.LittleEndian, &unicodeNameLength); err != nil {
+	unicodeNameLength, err := readEventDataUint64(stream)
+	if err != nil {
 		return nil, 0, err
 	}
 
-	var variableDataLength uint64
-	if err := binary.Read(stream, binary.LittleEndian, &variableDataLength); err != nil {
+	variableDataLength, err := readEventDataUint64(stream)
+	if err != nil {
 		return nil, 0, err
 	}
 
 	utf16Name, err := extractUTF16Buffer(stream, unicodeNameLength)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, &eventDataFieldError{offset: 32, err: err}
 	}
 
-	variableData := make([]byte, variableDataLength)
-	if _, err := io.ReadFull(stream, variableData); err != nil {
+	// Variable data can be large (eg, dbx updates), so avoid a copy here by slicing the event data directly. This
+	// also means that a bogus variableDataLength can't be used to make us allocate a huge buffer.
+	start := len(data) - stream.Len()
+	if variableDataLength > uint64(stream.Len()) {
+		return nil, 0, &eventDataFieldError{offset: start, err: io.ErrUnexpectedEOF}
+	}
+	variableData := data[start : start+int(variableDataLength)]
+	if _, err := stream.Seek(int64(variableDataLength), io.SeekCurrent); err != nil {
 		return nil, 0, err
 	}
 
 	return &EFIVariableEventData{data: data,
+		eventType:    eventType,
+		limits:       limits,
 		VariableName: guid,
 		UnicodeName:  convertUtf16ToString(utf16Name),
 		VariableData: variableData}, stream.Len(), nil
 }
 
-func decodeEventDataEFIVariable(data []byte, eventType EventType) (out EventData, trailingBytes int, err error) {
-	d, trailingBytes, err := decodeEventDataEFIVariableImpl(data, eventType)
+func decodeEventDataEFIVariable(data []byte, eventType EventType,
+	limits decodeLimits) (out EventData, trailingBytes int, err error) {
+	d, trailingBytes, err := decodeEventDataEFIVariableImpl(data, eventType, limits)
 	if d != nil {
 		out = d
-	}
-	return
-}
-
-type efiDevicePathNodeType uint8
-
-func (t efiDevicePathNodeType) String() string {
-	switch t {
-	case efiDevicePathNodeHardware:
-		return "HardwarePath"
-	case efiDevicePathNodeACPI:
-		return "AcpiPath"
-	case efiDevicePathNodeMsg:
-		return "Msg"
-	case efiDevicePathNodeMedia:
-		return "MediaPath"
-	case efiDevicePathNodeBBS:
-		return "BbsPath"
-	default:
-		return fmt.Sprintf("Path[%02x]", uint8(t))
-	}
-}
-
-const (
-	efiDevicePathNodeHardware efiDevicePathNodeType = 0x01
-	efiDevicePathNodeACPI                           = 0x02
-	efiDevicePathNodeMsg                            = 0x03
-	efiDevicePathNodeMedia                          = 0x04
-	efiDevicePathNodeBBS                            = 0x05
-	efiDevicePathNodeEoH                            = 0x7f
-)
-
-const (
-	efiHardwareDevicePathNodePCI = 0x01
-
-	efiACPIDevicePathNodeNormal = 0x01
-
-	efiMsgDevicePathNodeLU   = 0x11
-	efiMsgDevicePathNodeSATA = 0x12
-
-	efiMediaDevicePathNodeHardDrive      = 0x01
-	efiMediaDevicePathNodeFilePath       = 0x04
-	efiMediaDevicePathNodeFvFile         = 0x06
-	efiMediaDevicePathNodeFv             = 0x07
-	efiMediaDevicePathNodeRelOffsetRange = 0x08
-)
-
-func firmwareDevicePathNodeToString(subType uint8, data []byte) (string, error) {
-	stream := bytes.NewReader(data)
-
-	var name EFIGUID
-	if err := binary.Read(stream, binary.LittleEndian, &name); err != nil {
-		return "", err
-	}
-
-	var builder bytes.Buffer
-	switch subType {
-	case efiMediaDevicePathNodeFvFile:
-		builder.WriteString("\\FvFile")
-	case efiMediaDevicePathNodeFv:
-		builder.WriteString("\\Fv")
-	default:
-		return "", fmt.Errorf("invalid sub type for firmware device path node: %d", subType)
-	}
-
-	fmt.Fprintf(&builder, "(%s)", &name)
-	return builder.String(), nil
-}
-
-func acpiDevicePathNodeToString(data []byte) (string, error) {
-	stream := bytes.NewReader(data)
-
-	var hid uint32
-	if err := binary.Read(stream, binary.LittleEndian, &hid); err != nil {
-		return "", err
-	}
-
-	var uid uint32
-	if err := binary.Read(stream, binary.LittleEndian, &uid); err != nil {
-		return "", err
-	}
-
-	if hid&0xffff == 0x41d0 {
-		switch hid >> 16 {
-		case 0x0a03:
-			return fmt.Sprintf("\\PciRoot(0x%x)", uid), nil
-		case 0x0a08:
-			return fmt.Sprintf("\\PcieRoot(0x%x)", uid), nil
-		case 0x0604:
-			return fmt.Sprintf("\\Floppy(0x%x)", uid), nil
-		default:
-			return fmt.Sprintf("\\Acpi(PNP%04x,0x%x)", hid>>16, uid), nil
-		}
-	} else {
-		return fmt.Sprintf("\\Acpi(0x%08x,0x%x)", hid, uid), nil
-	}
-}
-
-func pciDevicePathNodeToString(data []byte) (string, error) {
-	stream := bytes.NewReader(data)
-
-	var function uint8
-	if err := binary.Read(stream, binary.LittleEndian, &function); err != nil {
-		return "", err
-	}
-
-	var device uint8
-	if err := binary.Read(stream, binary.LittleEndian, &device); err != nil {
-		return "", err
-	}
-
-	return fmt.Sprintf("\\Pci(0x%x,0x%x)", device, function), nil
-}
-
-func luDevicePathNodeToString(data []byte) (string, error) {
-	stream := bytes.NewReader(data)
-
-	var lun uint8
-	if err := binary.Read(stream, binary.LittleEndian, &lun); err != nil {
-		return "", err
-	}
-
-	return fmt.Sprintf("\\Unit(0x%x)", lun), nil
-}
-
-func hardDriveDevicePathNodeToString(data []byte) (string, error) {
-	stream := bytes.NewReader(data)
-
-	var partNumber uint32
-	if err := binary.Read(stream, binary.LittleEndian, &partNumber); err != nil {
-		return "", err
-	}
-
-	var partStart uint64
-	if err := binary.Read(stream, binary.LittleEndian, &partStart); err != nil {
-		return "", err
-	}
-
-	var partSize uint64
-	if err := binary.Read(stream, binary.LittleEndian, &partSize); err != nil {
-		return "", err
-	}
-
-	var sig [16]byte
-	if _, err := io.ReadFull(stream, sig[:]); err != nil {
-		return "", err
-	}
-
-	var partFormat uint8
-	if err := binary.Read(stream, binary.LittleEndian, &partFormat); err != nil {
-		return "", err
-	}
-
-	var sigType uint8
-	if err := binary.Read(stream, binary.LittleEndian, &sigType); err != nil {
-		return "", err
-	}
-
-	var builder bytes.Buffer
-
-	switch sigType {
-	case 0x01:
-		fmt.Fprintf(&builder, "\\HD(%d,MBR,0x%08x,", partNumber, binary.LittleEndian.Uint32(sig[:]))
-	case 0x02:
-		r := bytes.NewReader(sig[:])
-		var guid EFIGUID
-		if err := binary.Read(r, binary.LittleEndian, &guid); err != nil {
-			return "", err
-		}
-		fmt.Fprintf(&builder, "\\HD(%d,GPT,%s,", partNumber, &guid)
-	default:
-		fmt.Fprintf(&builder, "\\HD(%d,%d,0,", partNumber, sigType)
-	}
-
-	fmt.Fprintf(&builder, "0x%016x, 0x%016x)", partStart, partSize)
-	return builder.String(), nil
-}
-
-func sataDevicePathNodeToString(data []byte) (string, error) {
-	stream := bytes.NewReader(data)
-
-	var hbaPortNumber uint16
-	if err := binary.Read(stream, binary.LittleEndian, &hbaPortNumber); err != nil {
-		return "", err
-	}
-
-	var portMultiplierPortNumber uint16
-	if err := binary.Read(stream, binary.LittleEndian, &portMultiplierPortNumber); err != nil {
-		return "", err
-	}
-
-	var lun uint16
-	if err := binary.Read(stream, binary.LittleEndian, &lun); err != nil {
-		return "", err
-	}
-
-	return fmt.Sprintf("\\Sata(0x%x,0x%x,0x%x)", hbaPortNumber, portMultiplierPortNumber, lun), nil
-}
-
-func filePathDevicePathNodeToString(data []byte) string {
-	u16 := make([]uint16, len(data)/2)
-	stream := bytes.NewReader(data)
-	binary.Read(stream, binary.LittleEndian, &u16)
-
-	var buf bytes.Buffer
-	for _, r := range utf16.Decode(u16) {
-		buf.WriteRune(r)
-	}
-	return buf.String()
-}
-
-func relOffsetRangePathNodeToString(data []byte) (string, error) {
-	stream := bytes.NewReader(data)
-
-	if _, err := stream.Seek(4, io.SeekCurrent); err != nil {
-		return "", err
-	}
-
-	var start uint64
-	if err := binary.Read(stream, binary.LittleEndian, &start); err != nil {
-		return "", err
-	}
-
-	var end uint64
-	if err := binary.Read(stream, binary.LittleEndian, &end); err != nil {
-		return "", err
-	}
-
-	return fmt.Sprintf("\\Offset(0x%x,0x%x)", start, end), nil
-}
-
-func decodeDevicePathNode(stream io.Reader) (string, error) {
-	var t efiDevicePathNodeType
-	if err := binary.Read(stream, binary.LittleEndian, &t); err != nil {
-		return "", err
-	}
-
-	if t == efiDevicePathNodeEoH {
-		return "", nil
-	}
-
-	var subType uint8
-	if err := binary.Read(stream, binary.LittleEndian, &subType); err != nil {
-		return "", err
-	}
-
-	var length uint16
-	if err := binary.Read(stream, binary.LittleEndian, &length); err != nil {
-		return "", err
-	}
-
-	if length < 4 {
-		return "", fmt.Errorf("unexpected device path node length (got %d, expected >= 4)", length)
-	}
-
-	data := make([]byte, length-4)
-	if _, err := io.ReadFull(stream, data); err != nil {
-		return "", err
-	}
-
-	switch t {
-	case efiDevicePathNodeMedia:
-		switch subType {
-		case efiMediaDevicePathNodeFvFile:
-			fallthrough
-		case efiMediaDevicePathNodeFv:
-			return firmwareDevicePathNodeToString(subType, data)
-		case efiMediaDevicePathNodeHardDrive:
-			return hardDriveDevicePathNodeToString(data)
-		case efiMediaDevicePathNodeFilePath:
-			return filePathDevicePathNodeToString(data), nil
-		case efiMediaDevicePathNodeRelOffsetRange:
-			return relOffsetRangePathNodeToString(data)
-		}
-	case efiDevicePathNodeACPI:
-		switch subType {
-		case efiACPIDevicePathNodeNormal:
-			return acpiDevicePathNodeToString(data)
-		}
-	case efiDevicePathNodeHardware:
-		switch subType {
-		case efiHardwareDevicePathNodePCI:
-			return pciDevicePathNodeToString(data)
-		}
-	case efiDevicePathNodeMsg:
-		switch subType {
-		case efiMsgDevicePathNodeLU:
-			return luDevicePathNodeToString(data)
-		case efiMsgDevicePathNodeSATA:
-			return sataDevicePathNodeToString(data)
-		}
-
-	}
-
-	var builder bytes.Buffer
-	fmt.Fprintf(&builder, "\\%s(%d", t, subType)
-	if len(data) > 0 {
-		fmt.Fprintf(&builder, ", 0x")
-		for _, b := range data {
-			fmt.Fprintf(&builder, "%02x", b)
-		}
-	}
-	fmt.Fprintf(&builder, ")")
-	return builder.String(), nil
-}
-
-func decodeDevicePath(data []byte) (string, error) {
-	stream := bytes.NewReader(data)
-	var builder bytes.Buffer
-
-	for {
-		node, err := decodeDevicePathNode(stream)
-		if err != nil {
-			return "", err
-		}
-		if node == "" {
-			return builder.String(), nil
+		if eventType == EventTypeEFIVariableAuthority {
+			if s := decodeShimVariableEventData(d); s != nil {
+				out = s
+			}
 		}
-		fmt.Fprintf(&builder, "%s", node)
 	}
+	return
 }
 
 type efiImageLoadEventData struct {
@@ -595,7 +438,7 @@ type efiImageLoadEventData struct {
 	locationInMemory uint64
 	lengthInMemory   uint64
 	linkTimeAddress  uint64
-	path             string
+	path             EFIDevicePath
 }
 
 func (e *efiImageLoadEventData) String() string {
@@ -610,76 +453,84 @@ func (e *efiImageLoadEventData) Bytes() []byte {
 
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_EFI_Platform_1_22_Final_-v15.pdf (section 4 "Measuring PE/COFF Image Files")
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf (section 9.2.3 "UEFI_IMAGE_LOAD_EVENT Structure")
-func decodeEventDataEFIImageLoadImpl(data []byte) (*efiImageLoadEventData, error) {
+func decodeEventDataEFIImageLoadImpl(data []byte, limits decodeLimits) (*efiImageLoadEventData, int, error) {
 	stream := bytes.NewReader(data)
 
-	var locationInMemory uint64
-	if err := binary.Read(stream, binary.LittleEndian, &locationInMemory); err != nil {
-		return nil, err
+	locationInMemory, err := readEventDataUint64(stream)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	var lengthInMemory uint64
-	if err := binary.Read(stream, binary.LittleEndian, &lengthInMemory); err != nil {
-		return nil, err
+	lengthInMemory, err := readEventDataUint64(stream)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	var linkTimeAddress uint64
-	if err := binary.Read(stream, binary.LittleEndian, &linkTimeAddress); err != nil {
-		return nil, err
+	linkTimeAddress, err := readEventDataUint64(stream)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	var devicePathLength uint64
-	if err := binary.Read(stream, binary.LittleEndian, &devicePathLength); err != nil {
-		return nil, err
+	devicePathLength, err := readEventDataUint64(stream)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	devicePathBuf := make([]byte, devicePathLength)
-
-	if _, err := io.ReadFull(stream, devicePathBuf); err != nil {
-		return nil, err
+	devicePathBuf, err := readEventDataBuffer(stream, devicePathLength)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	path, err := decodeDevicePath(devicePathBuf)
+	path, err := decodeDevicePath(devicePathBuf, limits)
 	if err != nil {
-		return nil, err
+		return nil, 0, &eventDataFieldError{offset: 32, err: err}
 	}
 
 	return &efiImageLoadEventData{data: data,
 		locationInMemory: locationInMemory,
 		lengthInMemory:   lengthInMemory,
 		linkTimeAddress:  linkTimeAddress,
-		path:             path}, nil
+		path:             path}, stream.Len(), nil
 }
 
-func decodeEventDataEFIImageLoad(data []byte) (out EventData, trailingBytes int, err error) {
-	d, err := decodeEventDataEFIImageLoadImpl(data)
+func decodeEventDataEFIImageLoad(data []byte, limits decodeLimits) (out EventData, trailingBytes int, err error) {
+	d, trailingBytes, err := decodeEventDataEFIImageLoadImpl(data, limits)
 	if d != nil {
 		out = d
 	}
 	return
 }
 
-type efiGPTPartitionEntry struct {
-	typeGUID   EFIGUID
-	uniqueGUID EFIGUID
-	name       string
+// EFIPartitionEntry corresponds to the EFI_PARTITION_ENTRY type.
+type EFIPartitionEntry struct {
+	PartitionTypeGUID   EFIGUID
+	UniquePartitionGUID EFIGUID
+	StartingLBA         uint64
+	EndingLBA           uint64
+	Attributes          uint64
+	PartitionName       string
 }
 
-func (p *efiGPTPartitionEntry) String() string {
+func (p *EFIPartitionEntry) String() string {
 	return fmt.Sprintf("PartitionTypeGUID: %s, UniquePartitionGUID: %s, Name: \"%s\"",
-		&p.typeGUID, &p.uniqueGUID, p.name)
+		&p.PartitionTypeGUID, &p.UniquePartitionGUID, p.PartitionName)
 }
 
-type efiGPTEventData struct {
-	data       []byte
-	diskGUID   EFIGUID
-	partitions []efiGPTPartitionEntry
+// EFIGPTEventData corresponds to the UEFI_GPT_DATA type, which is the event data for EV_EFI_GPT_EVENT events.
+type EFIGPTEventData struct {
+	data           []byte
+	MyLBA          uint64
+	AlternateLBA   uint64
+	FirstUsableLBA uint64
+	LastUsableLBA  uint64
+	DiskGUID       EFIGUID
+	Partitions     []EFIPartitionEntry
 }
 
-func (e *efiGPTEventData) String() string {
+func (e *EFIGPTEventData) String() string {
 	var builder bytes.Buffer
-	fmt.Fprintf(&builder, "UEFI_GPT_DATA{ DiskGUID: %s, Partitions: [", &e.diskGUID)
-	for i, part := range e.partitions {
+	fmt.Fprintf(&builder, "UEFI_GPT_DATA{ DiskGUID: %s, Partitions: [", &e.DiskGUID)
+	for i, part := range e.Partitions {
 		if i > 0 {
 			fmt.Fprintf(&builder, ", ")
 		}
@@ -689,21 +540,29 @@ func (e *efiGPTEventData) String() string {
 	return builder.String()
 }
 
-func (e *efiGPTEventData) Bytes() []byte {
+func (e *EFIGPTEventData) Bytes() []byte {
 	return e.data
 }
 
-func decodeEventDataEFIGPTImpl(data []byte) (*efiGPTEventData, int, error) {
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+//  (section 9.2.5 "UEFI_GPT_DATA Structure")
+func decodeEventDataEFIGPTImpl(data []byte) (*EFIGPTEventData, int, error) {
 	stream := bytes.NewReader(data)
 
-	// Skip UEFI_GPT_DATA.UEFIPartitionHeader.{Header, MyLBA, AlternateLBA, FirstUsableLBA, LastUsableLBA}
-	if _, err := stream.Seek(56, io.SeekCurrent); err != nil {
+	// Skip UEFI_GPT_DATA.UEFIPartitionHeader.Header
+	if _, err := stream.Seek(24, io.SeekCurrent); err != nil {
 		return nil, 0, err
 	}
 
-	// UEFI_GPT_DATA.UEFIPartitionHeader.DiskGUID
-	var diskGUID EFIGUID
-	if err := binary.Read(stream, binary.LittleEndian, &diskGUID); err != nil {
+	// UEFI_GPT_DATA.UEFIPartitionHeader.{MyLBA, AlternateLBA, FirstUsableLBA, LastUsableLBA, DiskGUID}
+	var header struct {
+		MyLBA          uint64
+		AlternateLBA   uint64
+		FirstUsableLBA uint64
+		LastUsableLBA  uint64
+		DiskGUID       EFIGUID
+	}
+	if err := readEventDataField(stream, &header); err != nil {
 		return nil, 0, err
 	}
 
@@ -714,7 +573,7 @@ func decodeEventDataEFIGPTImpl(data []byte) (*efiGPTEventData, int, error) {
 
 	// UEFI_GPT_DATA.UEFIPartitionHeader.SizeOfPartitionEntry
 	var partEntrySize uint32
-	if err := binary.Read(stream, binary.LittleEndian, &partEntrySize); err != nil {
+	if err := readEventDataField(stream, &partEntrySize); err != nil {
 		return nil, 0, err
 	}
 
@@ -725,32 +584,45 @@ func decodeEventDataEFIGPTImpl(data []byte) (*efiGPTEventData, int, error) {
 
 	// UEFI_GPT_DATA.NumberOfPartitions
 	var numberOfParts uint64
-	if err := binary.Read(stream, binary.LittleEndian, &numberOfParts); err != nil {
+	if err := readEventDataField(stream, &numberOfParts); err != nil {
 		return nil, 0, err
 	}
 
-	eventData := &efiGPTEventData{diskGUID: diskGUID, partitions: make([]efiGPTPartitionEntry, numberOfParts)}
+	eventData := &EFIGPTEventData{
+		data:           data,
+		MyLBA:          header.MyLBA,
+		AlternateLBA:   header.AlternateLBA,
+		FirstUsableLBA: header.FirstUsableLBA,
+		LastUsableLBA:  header.LastUsableLBA,
+		DiskGUID:       header.DiskGUID}
 
-	for i := uint64(0); i < numberOfParts; i++ {
-		entryData := make([]byte, partEntrySize)
-		if _, err := io.ReadFull(stream, entryData); err != nil {
-			return nil, 0, err
-		}
+	var entry struct {
+		PartitionTypeGUID   EFIGUID
+		UniquePartitionGUID EFIGUID
+		StartingLBA         uint64
+		EndingLBA           uint64
+		Attributes          uint64
+	}
 
-		entryStream := bytes.NewReader(entryData)
+	// Check the partition count against the amount of remaining data before decoding anything, so that a bogus
+	// count or entry size can't be used to make us loop or allocate excessively.
+	if numberOfParts > 0 && partEntrySize < uint32(binary.Size(entry)) {
+		return nil, 0, &eventDataFieldError{offset: 84,
+			err: fmt.Errorf("invalid SizeOfPartitionEntry (%d)", partEntrySize)}
+	}
+	if numberOfParts > 0 && numberOfParts > uint64(stream.Len())/uint64(partEntrySize) {
+		return nil, 0, &eventDataFieldError{offset: eventDataFieldOffset(stream), err: io.ErrUnexpectedEOF}
+	}
 
-		var typeGUID EFIGUID
-		if err := binary.Read(entryStream, binary.LittleEndian, &typeGUID); err != nil {
+	for i := uint64(0); i < numberOfParts; i++ {
+		entryData, err := readEventDataBuffer(stream, uint64(partEntrySize))
+		if err != nil {
 			return nil, 0, err
 		}
 
-		var uniqueGUID EFIGUID
-		if err := binary.Read(entryStream, binary.LittleEndian, &uniqueGUID); err != nil {
-			return nil, 0, err
-		}
+		entryStream := bytes.NewReader(entryData)
 
-		// Skip UEFI_GPT_DATA.Partitions[i].{StartingLBA, EndingLBA, Attributes}
-		if _, err := entryStream.Seek(24, io.SeekCurrent); err != nil {
+		if err := binary.Read(entryStream, binary.LittleEndian, &entry); err != nil {
 			return nil, 0, err
 		}
 
@@ -767,7 +639,13 @@ func decodeEventDataEFIGPTImpl(data []byte) (*efiGPTEventData, int, error) {
 			name.WriteRune(r)
 		}
 
-		eventData.partitions[i] = efiGPTPartitionEntry{typeGUID: typeGUID, uniqueGUID: uniqueGUID, name: name.String()}
+		eventData.Partitions = append(eventData.Partitions, EFIPartitionEntry{
+			PartitionTypeGUID:   entry.PartitionTypeGUID,
+			UniquePartitionGUID: entry.UniquePartitionGUID,
+			StartingLBA:         entry.StartingLBA,
+			EndingLBA:           entry.EndingLBA,
+			Attributes:          entry.Attributes,
+			PartitionName:       name.String()})
 	}
 
 	return eventData, stream.Len(), nil
@@ -780,3 +658,82 @@ func decodeEventDataEFIGPT(data []byte) (out EventData, trailingBytes int, err e
 	}
 	return
 }
+
+// EFIPlatformFirmwareBlobEventData corresponds to the UEFI_PLATFORM_FIRMWARE_BLOB type.
+type EFIPlatformFirmwareBlobEventData struct {
+	data       []byte
+	BlobBase   uint64
+	BlobLength uint64
+}
+
+func (e *EFIPlatformFirmwareBlobEventData) String() string {
+	return fmt.Sprintf("UEFI_PLATFORM_FIRMWARE_BLOB{ BlobBase: 0x%016x, BlobLength: %d }", e.BlobBase, e.BlobLength)
+}
+
+func (e *EFIPlatformFirmwareBlobEventData) Bytes() []byte {
+	return e.data
+}
+
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+//  (section 9.2.5 "UEFI_PLATFORM_FIRMWARE_BLOB Structure")
+func decodeEventDataEFIPlatformFirmwareBlob(data []byte) (out EventData, trailingBytes int, err error) {
+	stream := bytes.NewReader(data)
+
+	var blob struct {
+		BlobBase   uint64
+		BlobLength uint64
+	}
+	if err := readEventDataField(stream, &blob); err != nil {
+		return nil, 0, err
+	}
+
+	return &EFIPlatformFirmwareBlobEventData{data: data, BlobBase: blob.BlobBase, BlobLength: blob.BlobLength},
+		stream.Len(), nil
+}
+
+// EFIPlatformFirmwareBlob2EventData corresponds to the UEFI_PLATFORM_FIRMWARE_BLOB2 type.
+type EFIPlatformFirmwareBlob2EventData struct {
+	data            []byte
+	BlobDescription string
+	BlobBase        uint64
+	BlobLength      uint64
+}
+
+func (e *EFIPlatformFirmwareBlob2EventData) String() string {
+	return fmt.Sprintf("UEFI_PLATFORM_FIRMWARE_BLOB2{ BlobDescription: \"%s\", BlobBase: 0x%016x, BlobLength: %d }",
+		e.BlobDescription, e.BlobBase, e.BlobLength)
+}
+
+func (e *EFIPlatformFirmwareBlob2EventData) Bytes() []byte {
+	return e.data
+}
+
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClient_PFP_r1p05_v23_pub.pdf
+//  (section 10.2.4 "UEFI_PLATFORM_FIRMWARE_BLOB2 Structure")
+func decodeEventDataEFIPlatformFirmwareBlob2(data []byte) (out EventData, trailingBytes int, err error) {
+	stream := bytes.NewReader(data)
+
+	var descriptionSize uint8
+	if err := readEventDataField(stream, &descriptionSize); err != nil {
+		return nil, 0, err
+	}
+
+	description := make([]byte, descriptionSize)
+	if err := readEventDataBytes(stream, description); err != nil {
+		return nil, 0, err
+	}
+
+	var blob struct {
+		BlobBase   uint64
+		BlobLength uint64
+	}
+	if err := readEventDataField(stream, &blob); err != nil {
+		return nil, 0, err
+	}
+
+	return &EFIPlatformFirmwareBlob2EventData{
+		data:            data,
+		BlobDescription: string(bytes.TrimRight(description, "\x00")),
+		BlobBase:        blob.BlobBase,
+		BlobLength:      blob.BlobLength}, stream.Len(), nil
+}
@@ -2,6 +2,7 @@ package tcglog
 
 import (
 	"bytes"
+	"encoding/binary"
 	"testing"
 )
 
@@ -14,8 +15,8 @@ func TestEFIVariableEventDataEncode(t *testing.T) {
 		{
 			desc: "db",
 			in: EFIVariableEventData{
-				VariableName: EFIGUID{0xd719b2cb, 0x3d3a, 0x4596, 0xa3bc,
-					[...]uint8{0xda, 0xd0, 0x0e, 0x67, 0x65, 0x6f}},
+				VariableName: *NewEFIGUID(0xd719b2cb, 0x3d3a, 0x4596, 0xa3bc,
+					[...]uint8{0xda, 0xd0, 0x0e, 0x67, 0x65, 0x6f}),
 				UnicodeName:  "db",
 				VariableData: []byte("foo")},
 			out: []byte{0xcb, 0xb2, 0x19, 0xd7, 0x3a, 0x3d, 0x96, 0x45, 0xa3, 0xbc, 0xda, 0xd0, 0x0e,
@@ -25,8 +26,8 @@ func TestEFIVariableEventDataEncode(t *testing.T) {
 		{
 			desc: "dbx",
 			in: EFIVariableEventData{
-				VariableName: EFIGUID{0xd719b2cb, 0x3d3a, 0x4596, 0xa3bc,
-					[...]uint8{0xda, 0xd0, 0x0e, 0x67, 0x65, 0x6f}},
+				VariableName: *NewEFIGUID(0xd719b2cb, 0x3d3a, 0x4596, 0xa3bc,
+					[...]uint8{0xda, 0xd0, 0x0e, 0x67, 0x65, 0x6f}),
 				UnicodeName:  "dbx",
 				VariableData: []byte("bar")},
 			out: []byte{0xcb, 0xb2, 0x19, 0xd7, 0x3a, 0x3d, 0x96, 0x45, 0xa3, 0xbc, 0xda, 0xd0, 0x0e,
@@ -46,3 +47,239 @@ func TestEFIVariableEventDataEncode(t *testing.T) {
 		})
 	}
 }
+
+func makeLargeEFIVariableEventData(size int) []byte {
+	in := EFIVariableEventData{
+		VariableName: *NewEFIGUID(0xd719b2cb, 0x3d3a, 0x4596, 0xa3bc, [...]uint8{0xda, 0xd0, 0x0e, 0x67, 0x65, 0x6f}),
+		UnicodeName:  "dbx",
+		VariableData: make([]byte, size)}
+	var buf bytes.Buffer
+	in.EncodeMeasuredBytes(&buf)
+	return buf.Bytes()
+}
+
+func TestDecodeEFIGUID(t *testing.T) {
+	guid := *NewEFIGUID(0x8be4df61, 0x93ca, 0x11d2, 0xaa0d, [...]uint8{0x00, 0xe0, 0x98, 0x03, 0x2b, 0x8c})
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, guid)
+	if buf.Len() != efiGUIDSize {
+		t.Fatalf("Unexpected encoded size: %d", buf.Len())
+	}
+	if decoded := decodeEFIGUID(buf.Bytes()); decoded != guid {
+		t.Errorf("Unexpected GUID: %s", &decoded)
+	}
+}
+
+func TestDecodeEventDataEFIVariableLarge(t *testing.T) {
+	data := makeLargeEFIVariableEventData(4 * 1024 * 1024)
+	e, trailing, err := decodeEventDataEFIVariable(data, EventTypeEFIVariableDriverConfig, decodeLimits{})
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if trailing != 0 {
+		t.Errorf("Unexpected trailing bytes: %d", trailing)
+	}
+	d := e.(*EFIVariableEventData)
+	if len(d.VariableData) != 4*1024*1024 {
+		t.Errorf("Unexpected variable data length: %d", len(d.VariableData))
+	}
+	if _, _, err := decodeEventDataEFIVariable(data[:len(data)-1], EventTypeEFIVariableDriverConfig, decodeLimits{}); err == nil {
+		t.Errorf("Decode of truncated data should have failed")
+	}
+}
+
+func benchmarkDecodeEventDataEFIVariable(b *testing.B, size int) {
+	data := makeLargeEFIVariableEventData(size)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := decodeEventDataEFIVariable(data, EventTypeEFIVariableDriverConfig, decodeLimits{}); err != nil {
+			b.Fatalf("Decode failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkDecodeEventDataEFIVariable64K(b *testing.B) {
+	benchmarkDecodeEventDataEFIVariable(b, 64*1024)
+}
+
+func BenchmarkDecodeEventDataEFIVariable4M(b *testing.B) {
+	benchmarkDecodeEventDataEFIVariable(b, 4*1024*1024)
+}
+
+func BenchmarkCheckEFIVariableEventDigest4M(b *testing.B) {
+	data := makeLargeEFIVariableEventData(4 * 1024 * 1024)
+	e, _, err := decodeEventDataEFIVariable(data, EventTypeEFIVariableDriverConfig, decodeLimits{})
+	if err != nil {
+		b.Fatalf("Decode failed: %v", err)
+	}
+	event := &Event{EventType: EventTypeEFIVariableDriverConfig,
+		Digests: NewEventDigests(DigestMap{AlgorithmSha256: AlgorithmSha256.hash(data)}),
+		data:    e}
+	v := &logValidator{}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ve := &ValidatedEvent{Event: event}
+		v.checkEventDigests(ve, 0)
+		if len(ve.IncorrectDigestValues) > 0 {
+			b.Fatalf("Unexpected incorrect digest")
+		}
+	}
+}
+
+func TestSpecIdEventTCG2BootServiceCapability(t *testing.T) {
+	e := SpecIdEventData{VendorInfo: []byte{0x1e, 0x01, 0x01, 0x01, 0x01, 0x06, 0x00, 0x00, 0x00, 0x03, 0x00,
+		0x00, 0x00, 0x01, 0x00, 0x10, 0x00, 0x10, 0x49, 0x4e, 0x54, 0x43, 0x02, 0x00, 0x00, 0x00, 0x06, 0x00,
+		0x00, 0x00}}
+	c, ok := e.TCG2BootServiceCapability()
+	if !ok {
+		t.Fatalf("Failed to decode capability")
+	}
+	if c.HashAlgorithmBitmap != 6 || c.ManufacturerID != 0x43544e49 || c.NumberOfPCRBanks != 2 ||
+		c.ActivePCRBanks != 6 || c.MaxCommandSize != 0x1000 {
+		t.Errorf("Unexpected capability: %+v", c)
+	}
+
+	e.VendorInfo = e.VendorInfo[:len(e.VendorInfo)-1]
+	if _, ok := e.TCG2BootServiceCapability(); ok {
+		t.Errorf("Decoding vendorInfo with an inconsistent size should fail")
+	}
+}
+
+func TestDecodeEventDataEFIGPT(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("EFI PART")
+	buf.Write(make([]byte, 16))
+	binary.Write(&buf, binary.LittleEndian, struct {
+		MyLBA, AlternateLBA, FirstUsableLBA, LastUsableLBA uint64
+		DiskGUID                                           EFIGUID
+		PartitionEntryLBA                                  uint64
+		NumberOfPartitionEntries, SizeOfPartitionEntry     uint32
+		PartitionEntryArrayCRC32                           uint32
+		NumberOfPartitions                                 uint64
+	}{1, 100, 34, 67, *NewEFIGUID(0x11223344, 0x5566, 0x7788, 0x99aa, [...]uint8{1, 2, 3, 4, 5, 6}), 2, 128, 128, 0, 1})
+	binary.Write(&buf, binary.LittleEndian, struct {
+		PartitionTypeGUID, UniquePartitionGUID EFIGUID
+		StartingLBA, EndingLBA, Attributes     uint64
+	}{*NewEFIGUID(0xc12a7328, 0xf81f, 0x11d2, 0xba4b, [...]uint8{0x00, 0xa0, 0xc9, 0x3e, 0xc9, 0x3b}),
+		*NewEFIGUID(0x01020304, 0x0506, 0x0708, 0x090a, [...]uint8{0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}), 34, 66, 0})
+	name := make([]uint16, 36)
+	copy(name, convertStringToUtf16("EFI System Partition"))
+	binary.Write(&buf, binary.LittleEndian, name)
+
+	e, trailing, err := decodeEventDataEFIGPT(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if trailing != 0 {
+		t.Errorf("Unexpected trailing bytes: %d", trailing)
+	}
+	d := e.(*EFIGPTEventData)
+	if !bytes.Equal(d.Bytes(), buf.Bytes()) {
+		t.Errorf("Unexpected event data bytes")
+	}
+	if d.MyLBA != 1 || d.LastUsableLBA != 67 || len(d.Partitions) != 1 {
+		t.Fatalf("Unexpected header: %+v", d)
+	}
+	p := d.Partitions[0]
+	if p.PartitionName != "EFI System Partition" || p.StartingLBA != 34 || p.EndingLBA != 66 {
+		t.Errorf("Unexpected partition entry: %+v", p)
+	}
+}
+
+func TestDecodeEventDataEFIPlatformFirmwareBlob(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint64(0xffd00000))
+	binary.Write(&buf, binary.LittleEndian, uint64(0x300000))
+
+	d, trailing, err := decodeEventDataTCG(EventTypeEFIPlatformFirmwareBlob, buf.Bytes(), false, decodeLimits{})
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if trailing != 0 {
+		t.Errorf("Unexpected trailing bytes: %d", trailing)
+	}
+	blob, ok := d.(*EFIPlatformFirmwareBlobEventData)
+	if !ok {
+		t.Fatalf("Unexpected event data type: %T", d)
+	}
+	if blob.BlobBase != 0xffd00000 || blob.BlobLength != 0x300000 {
+		t.Errorf("Unexpected event data: %s", blob)
+	}
+}
+
+func TestDecodeEventDataEFIPlatformFirmwareBlob2(t *testing.T) {
+	var buf bytes.Buffer
+	description := "POST CODE"
+	buf.WriteByte(uint8(len(description)))
+	buf.WriteString(description)
+	binary.Write(&buf, binary.LittleEndian, uint64(0xff000000))
+	binary.Write(&buf, binary.LittleEndian, uint64(0x10000))
+
+	d, _, err := decodeEventDataTCG(EventTypeEFIPlatformFirmwareBlob2, buf.Bytes(), false, decodeLimits{})
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	blob, ok := d.(*EFIPlatformFirmwareBlob2EventData)
+	if !ok {
+		t.Fatalf("Unexpected event data type: %T", d)
+	}
+	if blob.BlobDescription != description || blob.BlobBase != 0xff000000 || blob.BlobLength != 0x10000 {
+		t.Errorf("Unexpected event data: %s", blob)
+	}
+
+	if _, _, err := decodeEventDataTCG(EventTypeEFIPlatformFirmwareBlob2, buf.Bytes()[:8], false, decodeLimits{}); err == nil {
+		t.Errorf("Decode should fail for truncated data")
+	}
+}
+
+func TestDecodeEventDataEFIBogusLengths(t *testing.T) {
+	// These lengths are all much larger than the event data, and must be rejected without attempting to allocate
+	// a buffer for them.
+	var imageLoad bytes.Buffer
+	binary.Write(&imageLoad, binary.LittleEndian, [4]uint64{0x1000, 0x2000, 0, 1 << 62})
+	imageLoad.Write([]byte{0x7f, 0xff, 0x04, 0x00})
+	if _, _, err := decodeEventDataEFIImageLoad(imageLoad.Bytes(), decodeLimits{}); err == nil {
+		t.Errorf("Decoding an image load event with a bogus device path length should fail")
+	}
+
+	var gpt bytes.Buffer
+	gpt.WriteString("EFI PART")
+	gpt.Write(make([]byte, 16))
+	binary.Write(&gpt, binary.LittleEndian, struct {
+		MyLBA, AlternateLBA, FirstUsableLBA, LastUsableLBA uint64
+		DiskGUID                                           EFIGUID
+		PartitionEntryLBA                                  uint64
+		NumberOfPartitionEntries, SizeOfPartitionEntry     uint32
+		PartitionEntryArrayCRC32                           uint32
+		NumberOfPartitions                                 uint64
+	}{1, 100, 34, 67, EFIGUID{}, 2, 128, 0xffffffff, 0, 1<<64 - 1})
+	gpt.Write(make([]byte, 128))
+	if _, _, err := decodeEventDataEFIGPT(gpt.Bytes()); err == nil {
+		t.Errorf("Decoding a GPT event with a bogus partition entry size should fail")
+	}
+
+	data := gpt.Bytes()
+	binary.LittleEndian.PutUint32(data[84:], 0)
+	if _, _, err := decodeEventDataEFIGPT(data); err == nil {
+		t.Errorf("Decoding a GPT event with a zero partition entry size should fail")
+	}
+
+	binary.LittleEndian.PutUint32(data[84:], 128)
+	if _, _, err := decodeEventDataEFIGPT(data); err == nil {
+		t.Errorf("Decoding a GPT event with a bogus partition count should fail")
+	}
+
+	var specId bytes.Buffer
+	specId.WriteString("Spec ID Event03\x00")
+	binary.Write(&specId, binary.LittleEndian, uint32(0))
+	specId.Write([]byte{0, 2, 0, 2})
+	binary.Write(&specId, binary.LittleEndian, uint32(0xffffffff))
+	binary.Write(&specId, binary.LittleEndian, EFISpecIdEventAlgorithmSize{AlgorithmId: AlgorithmSha256, DigestSize: 32})
+	if _, _, err := decodeEventDataNoAction(specId.Bytes()); err == nil {
+		t.Errorf("Decoding a spec ID event with a bogus algorithm count should fail")
+	}
+}
@@ -0,0 +1,134 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+var (
+	mpsTableGUID       = *NewEFIGUID(0xeb9d2d2f, 0x2d88, 0x11d3, 0x9a16, [...]uint8{0x00, 0x90, 0x27, 0x3f, 0xc1, 0x4d})
+	acpiTableGUID      = *NewEFIGUID(0xeb9d2d30, 0x2d88, 0x11d3, 0x9a16, [...]uint8{0x00, 0x90, 0x27, 0x3f, 0xc1, 0x4d})
+	smbiosTableGUID    = *NewEFIGUID(0xeb9d2d31, 0x2d88, 0x11d3, 0x9a16, [...]uint8{0x00, 0x90, 0x27, 0x3f, 0xc1, 0x4d})
+	salSystemTableGUID = *NewEFIGUID(0xeb9d2d32, 0x2d88, 0x11d3, 0x9a16, [...]uint8{0x00, 0x90, 0x27, 0x3f, 0xc1, 0x4d})
+	acpi20TableGUID    = *NewEFIGUID(0x8868e871, 0xe4f1, 0x11d3, 0xbc22, [...]uint8{0x00, 0x80, 0xc7, 0x3c, 0x88, 0x81})
+	smbios3TableGUID   = *NewEFIGUID(0xf2fd1544, 0x9794, 0x4a2c, 0x992e, [...]uint8{0xe5, 0xbb, 0xcf, 0x20, 0xe3, 0x94})
+)
+
+// EFIConfigurationTable corresponds to the EFI_CONFIGURATION_TABLE type.
+type EFIConfigurationTable struct {
+	VendorGUID  EFIGUID
+	VendorTable uint64 // The physical address of the table
+}
+
+// Name returns the name of a well-known configuration table (see RegisterEFIGUIDName), or the vendor GUID if it isn't
+// recognized.
+func (t *EFIConfigurationTable) Name() string {
+	return t.VendorGUID.nameOrString()
+}
+
+func (t *EFIConfigurationTable) String() string {
+	return fmt.Sprintf("%s: 0x%016x", t.Name(), t.VendorTable)
+}
+
+func configurationTablesString(tables []EFIConfigurationTable) string {
+	var builder bytes.Buffer
+	builder.WriteString("[")
+	for i, t := range tables {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString(t.String())
+	}
+	builder.WriteString("]")
+	return builder.String()
+}
+
+// EFIHandoffTablesEventData corresponds to the UEFI_HANDOFF_TABLE_POINTERS type.
+type EFIHandoffTablesEventData struct {
+	data   []byte
+	Tables []EFIConfigurationTable
+}
+
+func (e *EFIHandoffTablesEventData) String() string {
+	return fmt.Sprintf("UEFI_HANDOFF_TABLE_POINTERS{ TableEntry: %s }", configurationTablesString(e.Tables))
+}
+
+func (e *EFIHandoffTablesEventData) Bytes() []byte {
+	return e.data
+}
+
+// EFIHandoffTables2EventData corresponds to the UEFI_HANDOFF_TABLE_POINTERS2 type.
+type EFIHandoffTables2EventData struct {
+	data             []byte
+	TableDescription string
+	Tables           []EFIConfigurationTable
+}
+
+func (e *EFIHandoffTables2EventData) String() string {
+	return fmt.Sprintf("UEFI_HANDOFF_TABLE_POINTERS2{ TableDescription: \"%s\", TableEntry: %s }",
+		e.TableDescription, configurationTablesString(e.Tables))
+}
+
+func (e *EFIHandoffTables2EventData) Bytes() []byte {
+	return e.data
+}
+
+// decodeEFIConfigurationTables decodes a list of EFI_CONFIGURATION_TABLE structures preceded by a 64-bit count. This
+// assumes a 64-bit platform, where VendorTable is 8 bytes.
+func decodeEFIConfigurationTables(stream *bytes.Reader) ([]EFIConfigurationTable, error) {
+	var numberOfTables uint64
+	if err := readEventDataField(stream, &numberOfTables); err != nil {
+		return nil, err
+	}
+
+	if numberOfTables > uint64(stream.Len()/binary.Size(EFIConfigurationTable{})) {
+		return nil, &eventDataFieldError{offset: eventDataFieldOffset(stream), err: io.ErrUnexpectedEOF}
+	}
+
+	tables := make([]EFIConfigurationTable, numberOfTables)
+	if err := readEventDataField(stream, tables); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+//  (section 9.2.4 "UEFI_HANDOFF_TABLE_POINTERS Structure")
+func decodeEventDataEFIHandoffTables(data []byte) (out EventData, trailingBytes int, err error) {
+	stream := bytes.NewReader(data)
+
+	tables, err := decodeEFIConfigurationTables(stream)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &EFIHandoffTablesEventData{data: data, Tables: tables}, stream.Len(), nil
+}
+
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClient_PFP_r1p05_v23_pub.pdf
+//  (section 10.2.5 "UEFI_HANDOFF_TABLE_POINTERS2 Structure")
+func decodeEventDataEFIHandoffTables2(data []byte) (out EventData, trailingBytes int, err error) {
+	stream := bytes.NewReader(data)
+
+	var descriptionSize uint8
+	if err := readEventDataField(stream, &descriptionSize); err != nil {
+		return nil, 0, err
+	}
+
+	description := make([]byte, descriptionSize)
+	if err := readEventDataBytes(stream, description); err != nil {
+		return nil, 0, err
+	}
+
+	tables, err := decodeEFIConfigurationTables(stream)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &EFIHandoffTables2EventData{
+		data:             data,
+		TableDescription: string(bytes.TrimRight(description, "\x00")),
+		Tables:           tables}, stream.Len(), nil
+}
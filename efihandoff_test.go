@@ -0,0 +1,65 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestDecodeEventDataEFIHandoffTables(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint64(2))
+	binary.Write(&buf, binary.LittleEndian, EFIConfigurationTable{VendorGUID: smbiosTableGUID, VendorTable: 0x7a000000})
+	binary.Write(&buf, binary.LittleEndian, EFIConfigurationTable{
+		VendorGUID:  *NewEFIGUID(0x12345678, 0x1234, 0x5678, 0x9abc, [...]uint8{0, 1, 2, 3, 4, 5}),
+		VendorTable: 0x7b000000})
+
+	d, trailing, err := decodeEventDataTCG(EventTypeEFIHandoffTables, buf.Bytes(), false, decodeLimits{})
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if trailing != 0 {
+		t.Errorf("Unexpected trailing bytes: %d", trailing)
+	}
+	tables, ok := d.(*EFIHandoffTablesEventData)
+	if !ok {
+		t.Fatalf("Unexpected event data type: %T", d)
+	}
+	if len(tables.Tables) != 2 {
+		t.Fatalf("Unexpected number of tables: %d", len(tables.Tables))
+	}
+	if tables.Tables[0].Name() != "SMBIOS_TABLE" || tables.Tables[0].VendorTable != 0x7a000000 {
+		t.Errorf("Unexpected first table: %s", &tables.Tables[0])
+	}
+	if tables.Tables[1].Name() != "{12345678-1234-5678-9abc-000102030405}" {
+		t.Errorf("Unexpected second table: %s", &tables.Tables[1])
+	}
+}
+
+func TestDecodeEventDataEFIHandoffTables2(t *testing.T) {
+	var buf bytes.Buffer
+	description := "SMBIOS"
+	buf.WriteByte(uint8(len(description)))
+	buf.WriteString(description)
+	binary.Write(&buf, binary.LittleEndian, uint64(1))
+	binary.Write(&buf, binary.LittleEndian, EFIConfigurationTable{VendorGUID: smbios3TableGUID, VendorTable: 0x7a000000})
+
+	d, _, err := decodeEventDataTCG(EventTypeEFIHandoffTables2, buf.Bytes(), false, decodeLimits{})
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	tables, ok := d.(*EFIHandoffTables2EventData)
+	if !ok {
+		t.Fatalf("Unexpected event data type: %T", d)
+	}
+	if tables.TableDescription != description || len(tables.Tables) != 1 || tables.Tables[0].Name() != "SMBIOS3_TABLE" {
+		t.Errorf("Unexpected event data: %s", tables)
+	}
+
+	// A bogus table count shouldn't cause a huge allocation.
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint64(data[1+len(description):], 1<<60)
+	if _, _, err := decodeEventDataTCG(EventTypeEFIHandoffTables2, data, false, decodeLimits{}); err == nil {
+		t.Errorf("Decode should fail for an invalid table count")
+	}
+}
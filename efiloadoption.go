@@ -0,0 +1,119 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// EFILoadOption corresponds to the EFI_LOAD_OPTION type.
+type EFILoadOption struct {
+	Attributes   uint32
+	Description  string
+	FilePath     EFIDevicePath
+	OptionalData []byte
+}
+
+func (o *EFILoadOption) String() string {
+	return fmt.Sprintf("EFI_LOAD_OPTION{ Attributes: 0x%08x, Description: \"%s\", FilePath: %s, OptionalDataLength: %d }",
+		o.Attributes, o.Description, o.FilePath, len(o.OptionalData))
+}
+
+// https://uefi.org/sites/default/files/resources/UEFI_Spec_2_8_final.pdf
+//  (section 3.1.3 "Load Options")
+func decodeEFILoadOption(data []byte, limits decodeLimits) (*EFILoadOption, error) {
+	stream := bytes.NewReader(data)
+
+	var attributes uint32
+	if err := binary.Read(stream, binary.LittleEndian, &attributes); err != nil {
+		return nil, err
+	}
+
+	var filePathListLength uint16
+	if err := binary.Read(stream, binary.LittleEndian, &filePathListLength); err != nil {
+		return nil, err
+	}
+
+	var description []uint16
+	for {
+		var c uint16
+		if err := binary.Read(stream, binary.LittleEndian, &c); err != nil {
+			return nil, err
+		}
+		if c == 0 {
+			break
+		}
+		description = append(description, c)
+	}
+
+	filePathList := make([]byte, filePathListLength)
+	if _, err := io.ReadFull(stream, filePathList); err != nil {
+		return nil, err
+	}
+	path, err := decodeDevicePath(filePathList, limits)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode FilePathList: %w", err)
+	}
+
+	return &EFILoadOption{
+		Attributes:   attributes,
+		Description:  convertUtf16ToString(description),
+		FilePath:     path,
+		OptionalData: data[len(data)-stream.Len():]}, nil
+}
+
+func isBootOptionVariable(guid EFIGUID, name string) bool {
+	if guid != efiGlobalVariableGUID || len(name) != 8 || name[:4] != "Boot" {
+		return false
+	}
+	_, err := strconv.ParseUint(name[4:], 16, 16)
+	return err == nil
+}
+
+// LoadOption decodes the variable data as an EFI_LOAD_OPTION structure. This is only valid for Boot#### variables.
+// Note that this decodes the event data recorded in the log, regardless of whether the firmware measured the entire
+// UEFI_VARIABLE_DATA structure or just the variable data (see EFIBootVariableBehaviour).
+func (e *EFIVariableEventData) LoadOption() (*EFILoadOption, error) {
+	if !isBootOptionVariable(e.VariableName, e.UnicodeName) {
+		return nil, fmt.Errorf("%s-%s is not a boot option variable", &e.VariableName, e.UnicodeName)
+	}
+	return decodeEFILoadOption(e.VariableData, e.limits)
+}
+
+// BootOrder decodes the variable data as a list of boot option numbers. This is only valid for the BootOrder variable.
+func (e *EFIVariableEventData) BootOrder() ([]uint16, error) {
+	if e.VariableName != efiGlobalVariableGUID || e.UnicodeName != "BootOrder" {
+		return nil, fmt.Errorf("%s-%s is not the BootOrder variable", &e.VariableName, e.UnicodeName)
+	}
+	if len(e.VariableData)%2 != 0 {
+		return nil, errors.New("variable data has an odd length")
+	}
+
+	out := make([]uint16, len(e.VariableData)/2)
+	for i := range out {
+		out[i] = binary.LittleEndian.Uint16(e.VariableData[i*2:])
+	}
+	return out, nil
+}
+
+func (e *EFIVariableEventData) bootVariableString() (string, bool) {
+	if option, err := e.LoadOption(); err == nil {
+		return option.String(), true
+	}
+	if order, err := e.BootOrder(); err == nil {
+		var builder bytes.Buffer
+		builder.WriteString("[")
+		for i, n := range order {
+			if i > 0 {
+				builder.WriteString(", ")
+			}
+			fmt.Fprintf(&builder, "Boot%04X", n)
+		}
+		builder.WriteString("]")
+		return builder.String(), true
+	}
+	return "", false
+}
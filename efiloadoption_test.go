@@ -0,0 +1,67 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func makeTestLoadOption(attributes uint32, description, path string, optionalData []byte) []byte {
+	var filePath bytes.Buffer
+	pathData := convertStringToUtf16(path)
+	binary.Write(&filePath, binary.LittleEndian, struct {
+		Type, SubType uint8
+		Length        uint16
+	}{efiDevicePathNodeMedia, efiMediaDevicePathNodeFilePath, uint16(4 + len(pathData)*2)})
+	binary.Write(&filePath, binary.LittleEndian, pathData)
+	filePath.Write([]byte{0x7f, 0xff, 0x04, 0x00})
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, attributes)
+	binary.Write(&buf, binary.LittleEndian, uint16(filePath.Len()))
+	binary.Write(&buf, binary.LittleEndian, append(convertStringToUtf16(description), 0))
+	buf.Write(filePath.Bytes())
+	buf.Write(optionalData)
+	return buf.Bytes()
+}
+
+func TestEFIVariableLoadOption(t *testing.T) {
+	e := &EFIVariableEventData{eventType: EventTypeEFIVariableBoot, VariableName: efiGlobalVariableGUID,
+		UnicodeName: "Boot0001", VariableData: makeTestLoadOption(1, "ubuntu", "\\EFI\\ubuntu\\shimx64.efi", []byte{1, 2, 3})}
+	option, err := e.LoadOption()
+	if err != nil {
+		t.Fatalf("LoadOption failed: %v", err)
+	}
+	if option.Attributes != 1 {
+		t.Errorf("Unexpected Attributes: 0x%08x", option.Attributes)
+	}
+	if option.Description != "ubuntu" {
+		t.Errorf("Unexpected Description: %s", option.Description)
+	}
+	if option.FilePath.String() != "\\EFI\\ubuntu\\shimx64.efi" {
+		t.Errorf("Unexpected FilePath: %s", option.FilePath)
+	}
+	if !bytes.Equal(option.OptionalData, []byte{1, 2, 3}) {
+		t.Errorf("Unexpected OptionalData: %x", option.OptionalData)
+	}
+
+	e.UnicodeName = "BootOrder"
+	if _, err := e.LoadOption(); err == nil {
+		t.Errorf("LoadOption should fail for BootOrder")
+	}
+}
+
+func TestEFIVariableBootOrder(t *testing.T) {
+	e := &EFIVariableEventData{eventType: EventTypeEFIVariableBoot, VariableName: efiGlobalVariableGUID,
+		UnicodeName: "BootOrder", VariableData: []byte{0x03, 0x00, 0x01, 0x00, 0x0a, 0x00}}
+	order, err := e.BootOrder()
+	if err != nil {
+		t.Fatalf("BootOrder failed: %v", err)
+	}
+	if len(order) != 3 || order[0] != 3 || order[1] != 1 || order[2] != 10 {
+		t.Errorf("Unexpected BootOrder: %v", order)
+	}
+	if s := e.String(); !bytes.Contains([]byte(s), []byte("[Boot0003, Boot0001, Boot000A]")) {
+		t.Errorf("Unexpected string: %s", s)
+	}
+}
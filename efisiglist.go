@@ -0,0 +1,225 @@
+package tcglog
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	efiGlobalVariableGUID        = *NewEFIGUID(0x8be4df61, 0x93ca, 0x11d2, 0xaa0d, [...]uint8{0x00, 0xe0, 0x98, 0x03, 0x2b, 0x8c})
+	efiImageSecurityDatabaseGUID = *NewEFIGUID(0xd719b2cb, 0x3d3a, 0x4596, 0xa3bc, [...]uint8{0xda, 0xd0, 0x0e, 0x67, 0x65, 0x6f})
+
+	efiCertSHA1GUID       = *NewEFIGUID(0x826ca512, 0xcf10, 0x4ac9, 0xb187, [...]uint8{0xbe, 0x01, 0x49, 0x66, 0x31, 0xbd})
+	efiCertSHA256GUID     = *NewEFIGUID(0xc1c41626, 0x504c, 0x4092, 0xaca9, [...]uint8{0x41, 0xf9, 0x36, 0x93, 0x43, 0x28})
+	efiCertSHA384GUID     = *NewEFIGUID(0xff3e5307, 0x9fd0, 0x48c9, 0x85f1, [...]uint8{0x8a, 0xd5, 0x6c, 0x70, 0x1e, 0x01})
+	efiCertSHA512GUID     = *NewEFIGUID(0x093e0fae, 0xa6c4, 0x4f50, 0x9f1b, [...]uint8{0xd4, 0x1e, 0x2b, 0x89, 0xc1, 0x9a})
+	efiCertRSA2048GUID    = *NewEFIGUID(0x3c5766e8, 0x269c, 0x4e34, 0xaa14, [...]uint8{0xed, 0x77, 0x6e, 0x85, 0xb3, 0xb6})
+	efiCertX509GUID       = *NewEFIGUID(0xa5c059a1, 0x94e4, 0x4aa7, 0x87b5, [...]uint8{0xab, 0x15, 0x5c, 0x2b, 0xf0, 0x72})
+	efiCertX509SHA256GUID = *NewEFIGUID(0x3bd2a492, 0x96c0, 0x4079, 0xb420, [...]uint8{0xfc, 0xf9, 0x8e, 0xf1, 0x03, 0xed})
+	efiCertX509SHA384GUID = *NewEFIGUID(0x7076876e, 0x80c2, 0x4ee6, 0xaad2, [...]uint8{0x28, 0xb3, 0x49, 0xa6, 0x86, 0x5b})
+	efiCertX509SHA512GUID = *NewEFIGUID(0x446dbf63, 0x2502, 0x4cda, 0xbcfa, [...]uint8{0x24, 0x65, 0xd2, 0xb0, 0xfe, 0x9d})
+)
+
+func efiSignatureTypeString(t EFIGUID) string {
+	switch t {
+	case efiCertSHA1GUID:
+		return "EFI_CERT_SHA1"
+	case efiCertSHA256GUID:
+		return "EFI_CERT_SHA256"
+	case efiCertSHA384GUID:
+		return "EFI_CERT_SHA384"
+	case efiCertSHA512GUID:
+		return "EFI_CERT_SHA512"
+	case efiCertRSA2048GUID:
+		return "EFI_CERT_RSA2048"
+	case efiCertX509GUID:
+		return "EFI_CERT_X509"
+	case efiCertX509SHA256GUID:
+		return "EFI_CERT_X509_SHA256"
+	case efiCertX509SHA384GUID:
+		return "EFI_CERT_X509_SHA384"
+	case efiCertX509SHA512GUID:
+		return "EFI_CERT_X509_SHA512"
+	default:
+		return t.String()
+	}
+}
+
+// isSignatureDatabaseVariable determines whether the variable with the specified GUID and name contains a list of
+// EFI_SIGNATURE_LIST structures.
+func isSignatureDatabaseVariable(guid EFIGUID, name string) bool {
+	switch guid {
+	case efiGlobalVariableGUID:
+		return name == "PK" || name == "KEK"
+	case efiImageSecurityDatabaseGUID:
+		return name == "db" || name == "dbx" || name == "dbt" || name == "dbr"
+	default:
+		return false
+	}
+}
+
+// EFISignatureData corresponds to the EFI_SIGNATURE_DATA type.
+type EFISignatureData struct {
+	SignatureType  EFIGUID // The type of the signature list that this entry belongs to
+	SignatureOwner EFIGUID
+	Data           []byte
+
+	tolerantCertificates bool // Whether to summarize malformed certificates with the tolerant parser
+}
+
+// IsX509Certificate indicates whether this entry contains a DER encoded X.509 certificate.
+func (d *EFISignatureData) IsX509Certificate() bool {
+	return d.SignatureType == efiCertX509GUID
+}
+
+// X509Certificate decodes the X.509 certificate contained in this entry.
+func (d *EFISignatureData) X509Certificate() (*x509.Certificate, error) {
+	if !d.IsX509Certificate() {
+		return nil, errors.New("signature data does not contain a X.509 certificate")
+	}
+	return x509.ParseCertificate(d.Data)
+}
+
+// CertificateSummary summarizes the X.509 certificate contained in this entry. If the log was read with
+// LogOptions.TolerantCertificates, a certificate that crypto/x509 rejects is summarized with the tolerant parser (see
+// ParseCertificateSummary).
+func (d *EFISignatureData) CertificateSummary() (*CertificateSummary, error) {
+	if !d.IsX509Certificate() {
+		return nil, errors.New("signature data does not contain a X.509 certificate")
+	}
+	return ParseCertificateSummary(d.Data, d.tolerantCertificates)
+}
+
+func (d *EFISignatureData) String() string {
+	if d.IsX509Certificate() {
+		summary, err := d.CertificateSummary()
+		if err != nil {
+			return fmt.Sprintf("EFI_SIGNATURE_DATA{ SignatureOwner: %s, Certificate: <invalid: %v> }",
+				&d.SignatureOwner, err)
+		}
+		return fmt.Sprintf("EFI_SIGNATURE_DATA{ SignatureOwner: %s, Subject: \"%s\", Issuer: \"%s\" }",
+			&d.SignatureOwner, summary.Subject, summary.Issuer)
+	}
+	return fmt.Sprintf("EFI_SIGNATURE_DATA{ SignatureOwner: %s, Data: %x }", &d.SignatureOwner, d.Data)
+}
+
+// EFISignatureList corresponds to the EFI_SIGNATURE_LIST type.
+type EFISignatureList struct {
+	SignatureType   EFIGUID
+	SignatureHeader []byte
+	Signatures      []*EFISignatureData
+}
+
+func (l *EFISignatureList) String() string {
+	var builder bytes.Buffer
+	fmt.Fprintf(&builder, "EFI_SIGNATURE_LIST{ SignatureType: %s, Signatures: [", efiSignatureTypeString(l.SignatureType))
+	for i, s := range l.Signatures {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString(s.String())
+	}
+	builder.WriteString("] }")
+	return builder.String()
+}
+
+// https://uefi.org/sites/default/files/resources/UEFI_Spec_2_8_final.pdf
+//  (section 32.4.1 "Signature Database")
+func decodeEFISignatureList(stream *bytes.Reader, limits decodeLimits, decoded int) (*EFISignatureList, error) {
+	const headerSize = efiGUIDSize + 12
+	var buf [headerSize]byte
+	if err := readFull(stream, buf[:]); err != nil {
+		return nil, err
+	}
+	header := struct {
+		SignatureType       EFIGUID
+		SignatureListSize   uint32
+		SignatureHeaderSize uint32
+		SignatureSize       uint32
+	}{
+		SignatureType:       decodeEFIGUID(buf[:]),
+		SignatureListSize:   binary.LittleEndian.Uint32(buf[efiGUIDSize:]),
+		SignatureHeaderSize: binary.LittleEndian.Uint32(buf[efiGUIDSize+4:]),
+		SignatureSize:       binary.LittleEndian.Uint32(buf[efiGUIDSize+8:])}
+
+	if header.SignatureListSize < headerSize || header.SignatureListSize-headerSize > uint32(stream.Len()) {
+		return nil, fmt.Errorf("invalid SignatureListSize (%d)", header.SignatureListSize)
+	}
+	remaining := header.SignatureListSize - headerSize
+
+	if header.SignatureHeaderSize > remaining {
+		return nil, fmt.Errorf("invalid SignatureHeaderSize (%d)", header.SignatureHeaderSize)
+	}
+	remaining -= header.SignatureHeaderSize
+
+	const ownerSize = efiGUIDSize
+	if header.SignatureSize < ownerSize || remaining%header.SignatureSize != 0 {
+		return nil, fmt.Errorf("invalid SignatureSize (%d)", header.SignatureSize)
+	}
+
+	list := &EFISignatureList{SignatureType: header.SignatureType,
+		SignatureHeader: make([]byte, header.SignatureHeaderSize)}
+	if err := readFull(stream, list.SignatureHeader); err != nil {
+		return nil, err
+	}
+
+	if uint64(decoded)+uint64(remaining/header.SignatureSize) > uint64(limits.signatures()) {
+		return nil, &DecodeLimitError{Kind: DecodeLimitSignatures, Limit: limits.signatures()}
+	}
+
+	// The signatures are all decoded from a single copy of the data, rather than from an allocation each. The
+	// length of the data has already been checked against the remaining size of the stream.
+	count := remaining / header.SignatureSize
+	data := make([]byte, remaining)
+	if err := readFull(stream, data); err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return list, nil
+	}
+	signatures := make([]EFISignatureData, count)
+	list.Signatures = make([]*EFISignatureData, count)
+	for i := range signatures {
+		entry := data[uint32(i)*header.SignatureSize : uint32(i+1)*header.SignatureSize]
+		signatures[i] = EFISignatureData{
+			SignatureType:  header.SignatureType,
+			SignatureOwner: decodeEFIGUID(entry),
+			Data:           entry[ownerSize:len(entry):len(entry)],
+
+			tolerantCertificates: limits.tolerantCertificates}
+		list.Signatures[i] = &signatures[i]
+	}
+
+	return list, nil
+}
+
+func decodeEFISignatureDatabase(data []byte, limits decodeLimits) ([]*EFISignatureList, error) {
+	stream := bytes.NewReader(data)
+	var lists []*EFISignatureList
+	decoded := 0
+	for stream.Len() > 0 {
+		l, err := decodeEFISignatureList(stream, limits, decoded)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("cannot decode EFI_SIGNATURE_LIST at offset %d: %w", len(data)-stream.Len(), err)
+		}
+		lists = append(lists, l)
+		decoded += len(l.Signatures)
+	}
+	return lists, nil
+}
+
+// SignatureLists decodes the variable data as a list of EFI_SIGNATURE_LIST structures. This is only valid for the
+// signature database variables (PK, KEK, db, dbx, dbt and dbr).
+func (e *EFIVariableEventData) SignatureLists() ([]*EFISignatureList, error) {
+	if !isSignatureDatabaseVariable(e.VariableName, e.UnicodeName) {
+		return nil, fmt.Errorf("%s-%s is not a signature database variable", &e.VariableName, e.UnicodeName)
+	}
+	return decodeEFISignatureDatabase(e.VariableData, e.limits)
+}
@@ -0,0 +1,108 @@
+package tcglog
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func makeTestCertificate(t *testing.T, cn string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cert, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	return cert
+}
+
+func makeTestSignatureList(sigType EFIGUID, owner EFIGUID, entries ...[]byte) []byte {
+	var buf bytes.Buffer
+	sigSize := uint32(len(entries[0]) + 16)
+	binary.Write(&buf, binary.LittleEndian, struct {
+		SignatureType                                         EFIGUID
+		SignatureListSize, SignatureHeaderSize, SignatureSize uint32
+	}{sigType, 28 + sigSize*uint32(len(entries)), 0, sigSize})
+	for _, e := range entries {
+		binary.Write(&buf, binary.LittleEndian, owner)
+		buf.Write(e)
+	}
+	return buf.Bytes()
+}
+
+func TestEFIVariableEventDataSignatureLists(t *testing.T) {
+	owner := *NewEFIGUID(0x77fa9abd, 0x0359, 0x4d32, 0xbd60, [...]uint8{0x28, 0xf4, 0xe7, 0x8f, 0x78, 0x4b})
+	cert := makeTestCertificate(t, "Test CA")
+
+	var data []byte
+	data = append(data, makeTestSignatureList(efiCertX509GUID, owner, cert)...)
+	data = append(data, makeTestSignatureList(efiCertSHA256GUID, owner,
+		AlgorithmSha256.hash([]byte("foo")), AlgorithmSha256.hash([]byte("bar")))...)
+
+	e := EFIVariableEventData{VariableName: efiImageSecurityDatabaseGUID, UnicodeName: "db", VariableData: data}
+	lists, err := e.SignatureLists()
+	if err != nil {
+		t.Fatalf("SignatureLists failed: %v", err)
+	}
+	if len(lists) != 2 {
+		t.Fatalf("Unexpected number of lists: %d", len(lists))
+	}
+	if len(lists[0].Signatures) != 1 || len(lists[1].Signatures) != 2 {
+		t.Fatalf("Unexpected number of signatures")
+	}
+	c, err := lists[0].Signatures[0].X509Certificate()
+	if err != nil {
+		t.Fatalf("X509Certificate failed: %v", err)
+	}
+	if c.Subject.CommonName != "Test CA" {
+		t.Errorf("Unexpected subject: %s", c.Subject)
+	}
+	if lists[1].Signatures[1].SignatureOwner != owner ||
+		!bytes.Equal(lists[1].Signatures[1].Data, AlgorithmSha256.hash([]byte("bar"))) {
+		t.Errorf("Unexpected signature data")
+	}
+
+	e.VariableData = data[:len(data)-1]
+	if _, err := e.SignatureLists(); err == nil {
+		t.Errorf("SignatureLists should fail for truncated data")
+	}
+
+	e.UnicodeName = "SecureBoot"
+	if _, err := e.SignatureLists(); err == nil {
+		t.Errorf("SignatureLists should fail for a non signature database variable")
+	}
+}
+
+func BenchmarkDecodeEFISignatureDatabase(b *testing.B) {
+	owner := *NewEFIGUID(0x77fa9abd, 0x0359, 0x4d32, 0xbd60, [...]uint8{0x28, 0xf4, 0xe7, 0x8f, 0x78, 0x4b})
+
+	// A database similar in size to a recent dbx update.
+	var entries [][]byte
+	for i := 0; i < 400; i++ {
+		entries = append(entries, AlgorithmSha256.hash([]byte{byte(i), byte(i >> 8)}))
+	}
+	data := makeTestSignatureList(efiCertSHA256GUID, owner, entries...)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := decodeEFISignatureDatabase(data, decodeLimits{}); err != nil {
+			b.Fatalf("Decode failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package tcglog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EFIFileLocation describes the location of a file referenced by an EFI device path, with the parts of the path that
+// depend on how the disk is connected removed.
+type EFIFileLocation struct {
+	// FirmwareVolume indicates that the file is contained in a firmware volume rather than on a disk, in which case
+	// FirmwareFile contains its GUID and the other fields are unset.
+	FirmwareVolume bool
+	FirmwareFile   *EFIGUID
+
+	PartitionNumber uint32   // The partition number from the HD() node, or zero if the path has no HD() node
+	PartitionGUID   *EFIGUID // The GPT partition GUID, or nil if the partition isn't a GPT partition
+	MBRSignature    uint32   // The MBR disk signature, if the partition is a MBR partition
+	Path            string   // The path of the file relative to the root of the partition, using backslash separators
+}
+
+func (l *EFIFileLocation) String() string {
+	switch {
+	case l.FirmwareVolume:
+		return fmt.Sprintf("firmware volume (file %s)", l.FirmwareFile)
+	case l.PartitionGUID != nil:
+		return fmt.Sprintf("partition %d (GPT %s): %s", l.PartitionNumber, l.PartitionGUID, l.Path)
+	case l.PartitionNumber > 0:
+		return fmt.Sprintf("partition %d (MBR 0x%08x): %s", l.PartitionNumber, l.MBRSignature, l.Path)
+	default:
+		return l.Path
+	}
+}
+
+// FileLocation reduces this device path to the partition and path of the file that it refers to. Paths to files in a
+// firmware volume return a location with FirmwareVolume set. An error is returned if the path doesn't refer to a
+// file.
+func (p EFIDevicePath) FileLocation() (*EFIFileLocation, error) {
+	loc := &EFIFileLocation{}
+	var components []string
+
+	for _, n := range p {
+		if guid, ok := n.FirmwareFileGUID(); ok {
+			return &EFIFileLocation{FirmwareVolume: true, FirmwareFile: guid}, nil
+		}
+		switch {
+		case n.isHardDrive():
+			loc.PartitionNumber = binary.LittleEndian.Uint32(n.Data)
+			switch n.Data[37] {
+			case 0x01:
+				loc.MBRSignature = binary.LittleEndian.Uint32(n.Data[20:])
+			case 0x02:
+				loc.PartitionGUID, _ = readEFIDevicePathGUID(n.Data[20:36])
+			}
+			components = nil
+		case n.isFilePath():
+			c := strings.Trim(strings.Replace(n.filePathString(efiDevicePathFormatter{}), "/", "\\", -1), "\\")
+			if c != "" {
+				components = append(components, c)
+			}
+		}
+	}
+
+	if len(components) == 0 {
+		return nil, errors.New("device path doesn't contain a file path")
+	}
+	loc.Path = "\\" + strings.Join(components, "\\")
+	return loc, nil
+}
+
+// ImageLoadEventDevicePath returns the device path recorded in the UEFI_IMAGE_LOAD_EVENT structure of an
+// EV_EFI_BOOT_SERVICES_APPLICATION, EV_EFI_BOOT_SERVICES_DRIVER or EV_EFI_RUNTIME_SERVICES_DRIVER event.
+func ImageLoadEventDevicePath(event *Event) (EFIDevicePath, bool) {
+	d, ok := event.Data().(*efiImageLoadEventData)
+	if !ok {
+		return nil, false
+	}
+	return d.path, true
+}
+
+// lookupPathCaseInsensitive finds the file corresponding to the supplied backslash separated path inside root,
+// ignoring differences in case as the ESP is a FAT file system.
+func lookupPathCaseInsensitive(root, path string) (string, error) {
+	current := root
+	for _, c := range strings.Split(strings.Trim(path, "\\"), "\\") {
+		entries, err := ioutil.ReadDir(current)
+		if err != nil {
+			return "", err
+		}
+		found := false
+		for _, e := range entries {
+			if strings.EqualFold(e.Name(), c) {
+				current = filepath.Join(current, e.Name())
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", ErrContentNotFound
+		}
+	}
+	return current, nil
+}
+
+// ESPContentResolver is a ContentResolver that resolves the images loaded from disk by image load events to files
+// on a mounted EFI system partition.
+type ESPContentResolver struct {
+	Path string // The path at which the ESP is mounted
+
+	// PartitionGUID restricts this resolver to images loaded from the GPT partition with this GUID. If nil, images
+	// loaded from any partition are resolved against Path.
+	PartitionGUID *EFIGUID
+}
+
+func (r *ESPContentResolver) ResolveContent(event *Event) (string, error) {
+	path, ok := ImageLoadEventDevicePath(event)
+	if !ok {
+		return "", ErrContentNotFound
+	}
+	loc, err := path.FileLocation()
+	if err != nil {
+		return "", ErrContentNotFound
+	}
+	if loc.FirmwareVolume {
+		return "", fmt.Errorf("image was loaded from a firmware volume (file %s)", loc.FirmwareFile)
+	}
+	if r.PartitionGUID != nil && (loc.PartitionGUID == nil || *loc.PartitionGUID != *r.PartitionGUID) {
+		return "", ErrContentNotFound
+	}
+
+	localPath, err := lookupPathCaseInsensitive(r.Path, loc.Path)
+	switch {
+	case err == ErrContentNotFound || os.IsNotExist(err):
+		return "", ErrContentNotFound
+	case err != nil:
+		return "", fmt.Errorf("cannot resolve %s: %v", loc.Path, err)
+	}
+	return localPath, nil
+}
@@ -0,0 +1,77 @@
+package tcglog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEFIDevicePathFileLocation(t *testing.T) {
+	loc, err := makeTestBootDevicePath().FileLocation()
+	if err != nil {
+		t.Fatalf("FileLocation failed: %v", err)
+	}
+	if loc.FirmwareVolume || loc.PartitionNumber != 1 || loc.Path != "\\EFI\\ubuntu\\shimx64.efi" {
+		t.Errorf("Unexpected location: %+v", loc)
+	}
+	expectedGUID := NewEFIGUID(0x8c7c1b34, 0x0f3b, 0x4b4a, 0x9a46, [...]uint8{0x7b, 0x6b, 0x8c, 0x0a, 0x0e, 0x11})
+	if loc.PartitionGUID == nil || *loc.PartitionGUID != *expectedGUID {
+		t.Errorf("Unexpected partition GUID: %v", loc.PartitionGUID)
+	}
+
+	guid := *NewEFIGUID(0x7c04a583, 0x9e3e, 0x4f1c, 0xad65, [...]uint8{0xe0, 0x52, 0x68, 0xd0, 0xb4, 0xd1})
+	loc, err = EFIDevicePath{makeTestFvFileNode(guid)}.FileLocation()
+	if err != nil {
+		t.Fatalf("FileLocation failed: %v", err)
+	}
+	if !loc.FirmwareVolume || *loc.FirmwareFile != guid {
+		t.Errorf("Unexpected location: %+v", loc)
+	}
+	if loc.String() != "firmware volume (file {7c04a583-9e3e-4f1c-ad65-e05268d0b4d1})" {
+		t.Errorf("Unexpected string: %s", loc)
+	}
+
+	if _, err := (EFIDevicePath{makeTestBootDevicePath()[0]}).FileLocation(); err == nil {
+		t.Errorf("Expected an error for a path without a file")
+	}
+}
+
+func TestESPContentResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-esp")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "EFI", "Ubuntu"), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	expected := filepath.Join(dir, "EFI", "Ubuntu", "shimx64.efi")
+	if err := ioutil.WriteFile(expected, []byte("shim"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	event := &Event{EventType: EventTypeEFIBootServicesApplication,
+		data: &efiImageLoadEventData{path: makeTestBootDevicePath()}}
+	resolver := ContentResolverChain{&ESPContentResolver{Path: dir}}
+
+	path, err := resolver.ResolveContent(event)
+	if err != nil {
+		t.Fatalf("ResolveContent failed: %v", err)
+	}
+	if path != expected {
+		t.Errorf("Unexpected path: %s", path)
+	}
+
+	event.data = &efiImageLoadEventData{path: EFIDevicePath{makeTestFilePathNode("\\EFI\\ubuntu\\grubx64.efi")}}
+	if _, err := resolver.ResolveContent(event); err != ErrContentNotFound {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	other := *NewEFIGUID(0, 0, 0, 0, [...]uint8{0, 0, 0, 0, 0, 1})
+	event.data = &efiImageLoadEventData{path: makeTestBootDevicePath()}
+	if _, err := (&ESPContentResolver{Path: dir, PartitionGUID: &other}).ResolveContent(event); err != ErrContentNotFound {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
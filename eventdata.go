@@ -1,8 +1,11 @@
 package tcglog
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"sync"
 )
 
 // EventData is an interface that represents all event data types that appear in a log. Most implementations of
@@ -15,8 +18,9 @@ type EventData interface {
 // BrokenEventData corresponds to an event data buffer that could not be parsed correctly, for the reason
 // described by Error.
 type BrokenEventData struct {
-	data  []byte
-	Error error
+	data   []byte
+	offset int // The offset of the field that couldn't be decoded, or -1 if it isn't known
+	Error  error
 }
 
 func (e *BrokenEventData) String() string {
@@ -30,6 +34,135 @@ func (e *BrokenEventData) Bytes() []byte {
 	return e.data
 }
 
+// EventDecodeError describes why the event data of an event couldn't be decoded. This distinguishes event data that
+// is malformed from event data that is in a format that isn't known to this package, which is valid but has no
+// decoded representation.
+type EventDecodeError struct {
+	Index     uint      // The index of the event in its PCR
+	PCRIndex  PCRIndex  // The PCR that the event was measured to
+	EventType EventType // The type of the event
+	Offset    int       // The offset in the event data of the field that couldn't be decoded, or -1 if it isn't known
+	Err       error     // The underlying error
+}
+
+func (e *EventDecodeError) Error() string {
+	if e.Offset < 0 {
+		return fmt.Sprintf("cannot decode data for event %d in PCR %d (type: %s): %v", e.Index, e.PCRIndex,
+			e.EventType, e.Err)
+	}
+	return fmt.Sprintf("cannot decode data for event %d in PCR %d (type: %s) at offset %d: %v", e.Index,
+		e.PCRIndex, e.EventType, e.Offset, e.Err)
+}
+
+func (e *EventDecodeError) Unwrap() error {
+	return e.Err
+}
+
+// newEventDecodeError returns an EventDecodeError for the supplied event if its data couldn't be decoded.
+func newEventDecodeError(event *Event) *EventDecodeError {
+	d, isBroken := event.Data().(*BrokenEventData)
+	if !isBroken {
+		return nil
+	}
+	return &EventDecodeError{
+		Index:     event.Index,
+		PCRIndex:  event.PCRIndex,
+		EventType: event.EventType,
+		Offset:    d.offset,
+		Err:       d.Error}
+}
+
+// eventDataFieldError is returned from event data decoders to record the offset of the field that couldn't be
+// decoded.
+type eventDataFieldError struct {
+	offset int
+	err    error
+}
+
+func (e *eventDataFieldError) Error() string {
+	return e.err.Error()
+}
+
+func eventDataFieldOffset(stream *bytes.Reader) int {
+	return int(stream.Size()) - stream.Len()
+}
+
+// readEventDataField decodes the next little-endian field of some event data from stream in to v.
+func readEventDataField(stream *bytes.Reader, v interface{}) error {
+	offset := eventDataFieldOffset(stream)
+	if err := binary.Read(stream, binary.LittleEndian, v); err != nil {
+		return &eventDataFieldError{offset: offset, err: err}
+	}
+	return nil
+}
+
+// readEventDataUint16 decodes the next little-endian uint16 field of some event data from stream. This and the other
+// typed readers are used instead of readEventDataField in the decoders of common event types, as they avoid the
+// reflection and allocations of binary.Read.
+func readEventDataUint16(stream *bytes.Reader) (uint16, error) {
+	var buf [2]byte
+	if err := readEventDataBytes(stream, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(buf[:]), nil
+}
+
+// readEventDataUint64 decodes the next little-endian uint64 field of some event data from stream.
+func readEventDataUint64(stream *bytes.Reader) (uint64, error) {
+	var buf [8]byte
+	if err := readEventDataBytes(stream, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+// readEventDataGUID decodes the next EFI_GUID field of some event data from stream.
+func readEventDataGUID(stream *bytes.Reader) (EFIGUID, error) {
+	var buf [efiGUIDSize]byte
+	if err := readEventDataBytes(stream, buf[:]); err != nil {
+		return EFIGUID{}, err
+	}
+	return decodeEFIGUID(buf[:]), nil
+}
+
+// readFull is equivalent to io.ReadFull for a bytes.Reader. It calls stream directly rather than through io.Reader, so
+// that a buf on the stack of the caller doesn't escape to the heap. A bytes.Reader only returns fewer bytes than
+// requested at the end of its data.
+func readFull(stream *bytes.Reader, buf []byte) error {
+	n, _ := stream.Read(buf)
+	switch {
+	case n == len(buf):
+		return nil
+	case n == 0:
+		return io.EOF
+	default:
+		return io.ErrUnexpectedEOF
+	}
+}
+
+// readEventDataBytes reads the next len(buf) bytes of some event data from stream in to buf.
+func readEventDataBytes(stream *bytes.Reader, buf []byte) error {
+	offset := eventDataFieldOffset(stream)
+	if err := readFull(stream, buf); err != nil {
+		return &eventDataFieldError{offset: offset, err: err}
+	}
+	return nil
+}
+
+// readEventDataBuffer reads the next n bytes of some event data from stream, where n is a length decoded from the
+// event data. The length is checked against the amount of remaining data before anything is allocated, so that a
+// bogus length can't be used to make us allocate a huge buffer.
+func readEventDataBuffer(stream *bytes.Reader, n uint64) ([]byte, error) {
+	if n > uint64(stream.Len()) {
+		return nil, &eventDataFieldError{offset: eventDataFieldOffset(stream), err: io.ErrUnexpectedEOF}
+	}
+	buf := make([]byte, n)
+	if err := readEventDataBytes(stream, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
 type opaqueEventData struct {
 	data []byte
 }
@@ -42,9 +175,31 @@ func (e *opaqueEventData) Bytes() []byte {
 	return e.data
 }
 
+// isDecodedEventData indicates whether the supplied event data was decoded, rather than being in a format that isn't
+// known or being malformed.
+func isDecodedEventData(data EventData) bool {
+	switch data.(type) {
+	case *opaqueEventData, *BrokenEventData:
+		return false
+	default:
+		return true
+	}
+}
+
+// eventDataConsumed returns the number of bytes of the supplied event data that were consumed by its decoder, from
+// the number of trailing bytes returned from decodeEventData.
+func eventDataConsumed(data EventData, trailingBytes int) int {
+	if !isDecodedEventData(data) {
+		return 0
+	}
+	return len(data.Bytes()) - trailingBytes
+}
+
 func decodeEventDataImpl(pcrIndex PCRIndex, eventType EventType, data []byte, options *LogOptions,
 	hasDigestOfSeparatorError bool) (EventData, int, error) {
 	switch {
+	case options.EnableWindowsSIPA && eventType == EventTypeEventTag:
+		return decodeEventDataSIPA(data, options.decodeLimits())
 	case options.EnableGrub && (pcrIndex == 8 || pcrIndex == 9):
 		if d, n := decodeEventDataGRUB(pcrIndex, eventType, data); d != nil {
 			return d, n, nil
@@ -58,20 +213,62 @@ func decodeEventDataImpl(pcrIndex PCRIndex, eventType EventType, data []byte, op
 		}
 		fallthrough
 	default:
-		return decodeEventDataTCG(eventType, data, hasDigestOfSeparatorError)
+		return decodeEventDataTCG(eventType, data, hasDigestOfSeparatorError, options.decodeLimits())
 	}
 }
 
+// lazyEventData defers decoding the data of an event until it is first accessed.
+type lazyEventData struct {
+	once sync.Once
+
+	pcrIndex                  PCRIndex
+	eventType                 EventType
+	raw                       []byte
+	options                   *LogOptions
+	hasDigestOfSeparatorError bool
+
+	decoded decodedEventData
+}
+
+type decodedEventData struct {
+	data          EventData
+	trailingBytes int
+}
+
+func newLazyEventData(pcrIndex PCRIndex, eventType EventType, data []byte, options *LogOptions,
+	hasDigestOfSeparatorError bool) *lazyEventData {
+	return &lazyEventData{
+		pcrIndex:                  pcrIndex,
+		eventType:                 eventType,
+		raw:                       data,
+		options:                   options,
+		hasDigestOfSeparatorError: hasDigestOfSeparatorError}
+}
+
+func (d *lazyEventData) get() *decodedEventData {
+	d.once.Do(func() {
+		d.decoded.data, d.decoded.trailingBytes =
+			decodeEventData(d.pcrIndex, d.eventType, d.raw, d.options, d.hasDigestOfSeparatorError)
+		d.raw = nil
+		d.options = nil
+	})
+	return &d.decoded
+}
+
 func decodeEventData(pcrIndex PCRIndex, eventType EventType, data []byte, options *LogOptions,
 	hasDigestOfSeparatorError bool) (EventData, int) {
 	event, trailingBytes, err :=
 		decodeEventDataImpl(pcrIndex, eventType, data, options, hasDigestOfSeparatorError)
 
 	if err != nil {
+		offset := -1
+		if e, isFieldErr := err.(*eventDataFieldError); isFieldErr {
+			offset, err = e.offset, e.err
+		}
 		if err == io.EOF {
 			err = io.ErrUnexpectedEOF
 		}
-		return &BrokenEventData{data: data, Error: err}, 0
+		return &BrokenEventData{data: data, offset: offset, Error: err}, 0
 	}
 
 	if event != nil {
@@ -0,0 +1,113 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestEventDecodeError(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+
+	// UEFI_VARIABLE_DATA with a VariableDataLength that exceeds the size of the event data.
+	var variable bytes.Buffer
+	binary.Write(&variable, binary.LittleEndian, efiGlobalVariableGUID)
+	binary.Write(&variable, binary.LittleEndian, uint64(2))
+	binary.Write(&variable, binary.LittleEndian, uint64(16))
+	binary.Write(&variable, binary.LittleEndian, convertStringToUtf16("PK"))
+	variable.Write([]byte{1, 2, 3, 4})
+
+	// UEFI_IMAGE_LOAD_EVENT that is truncated in the middle of ImageLinkTimeAddress.
+	imageLoad := make([]byte, 20)
+
+	events := readAllTestLogEvents(t, makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(7, EventTypeEFIVariableDriverConfig, variable.Bytes(), algs...),
+		makeTestLogEvent(4, EventTypeEFIBootServicesApplication, imageLoad, algs...),
+		makeTestLogEvent(4, EventTypeEFIBootServicesApplication, imageLoad, algs...),
+		makeTestLogEvent(8, EventTypeIPL, []byte("unknown format"), algs...)}), LogOptions{})
+
+	for _, data := range []struct {
+		event    *Event
+		expected *EventDecodeError
+	}{
+		{events[1], &EventDecodeError{Index: 0, PCRIndex: 7, EventType: EventTypeEFIVariableDriverConfig, Offset: 36,
+			Err: io.ErrUnexpectedEOF}},
+		{events[2], &EventDecodeError{Index: 0, PCRIndex: 4, EventType: EventTypeEFIBootServicesApplication,
+			Offset: 16, Err: io.ErrUnexpectedEOF}},
+		{events[3], &EventDecodeError{Index: 1, PCRIndex: 4, EventType: EventTypeEFIBootServicesApplication,
+			Offset: 16, Err: io.ErrUnexpectedEOF}},
+	} {
+		if data.event.DecodeError() == nil {
+			t.Errorf("Event %d in PCR %d should have a decode error", data.event.Index, data.event.PCRIndex)
+			continue
+		}
+		if *data.event.DecodeError() != *data.expected {
+			t.Errorf("Unexpected decode error: %v", data.event.DecodeError())
+		}
+	}
+
+	if events[1].DecodeError().Error() != "cannot decode data for event 0 in PCR 7 (type: EV_EFI_VARIABLE_DRIVER_CONFIG) "+
+		"at offset 36: unexpected EOF" {
+		t.Errorf("Unexpected error string: %v", events[1].DecodeError())
+	}
+
+	// Event data in a format that isn't known isn't an error.
+	if events[4].DecodeError() != nil {
+		t.Errorf("Unexpected decode error: %v", events[4].DecodeError())
+	}
+	if _, isBroken := events[4].Data().(*BrokenEventData); isBroken {
+		t.Errorf("Unexpected broken event data")
+	}
+}
+
+func TestEventDataConsumed(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+
+	// UEFI_IMAGE_LOAD_EVENT with vendor data after the device path.
+	var imageLoad bytes.Buffer
+	binary.Write(&imageLoad, binary.LittleEndian, [4]uint64{0x1000, 0x2000, 0, 4})
+	imageLoad.Write([]byte{0x7f, 0xff, 0x04, 0x00})
+	imageLoad.Write([]byte{0xaa, 0xbb})
+
+	// UEFI_PLATFORM_FIRMWARE_BLOB with no trailing data.
+	var blob bytes.Buffer
+	binary.Write(&blob, binary.LittleEndian, [2]uint64{0x800000, 0x10000})
+
+	// UEFI_HANDOFF_TABLE_POINTERS that declares more tables than are present.
+	var handoff bytes.Buffer
+	binary.Write(&handoff, binary.LittleEndian, uint64(2))
+	binary.Write(&handoff, binary.LittleEndian, EFIConfigurationTable{VendorGUID: acpi20TableGUID, VendorTable: 0x1000})
+
+	events := readAllTestLogEvents(t, makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(4, EventTypeEFIBootServicesApplication, imageLoad.Bytes(), algs...),
+		makeTestLogEvent(0, EventTypeEFIPlatformFirmwareBlob, blob.Bytes(), algs...),
+		makeTestLogEvent(1, EventTypeEFIHandoffTables, handoff.Bytes(), algs...),
+		makeTestLogEvent(8, EventTypeIPL, []byte("unknown format"), algs...)}), LogOptions{})
+
+	// The spec ID event is consumed entirely.
+	if events[0].DataConsumed() != len(events[0].Data().Bytes()) || events[0].TrailingDataBytes() != nil {
+		t.Errorf("Unexpected consumed bytes for spec ID event: %d", events[0].DataConsumed())
+	}
+
+	if events[1].DataConsumed() != 36 || !bytes.Equal(events[1].TrailingDataBytes(), []byte{0xaa, 0xbb}) {
+		t.Errorf("Unexpected consumed bytes for image load event: %d (trailing: %x)", events[1].DataConsumed(),
+			events[1].TrailingDataBytes())
+	}
+	if events[1].IsDataOverDeclared() {
+		t.Errorf("Image load event shouldn't be over-declared")
+	}
+
+	if events[2].DataConsumed() != 16 || events[2].TrailingDataBytes() != nil {
+		t.Errorf("Unexpected consumed bytes for blob event: %d", events[2].DataConsumed())
+	}
+
+	if events[3].DataConsumed() != 0 || events[3].TrailingDataBytes() != nil || !events[3].IsDataOverDeclared() {
+		t.Errorf("Unexpected result for over-declared handoff tables event: %d, %v", events[3].DataConsumed(),
+			events[3].DecodeError())
+	}
+
+	if events[4].DataConsumed() != 0 || events[4].TrailingDataBytes() != nil || events[4].IsDataOverDeclared() {
+		t.Errorf("Unexpected result for event data in an unknown format: %d", events[4].DataConsumed())
+	}
+}
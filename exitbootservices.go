@@ -0,0 +1,165 @@
+package tcglog
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+	//  (section 10.4.4 "EV_EFI_ACTION Event Types")
+	actionExitBootServicesInvocation = "Exit Boot Services Invocation"
+	actionExitBootServicesFailure    = "Exit Boot Services Returned with Failure"
+	actionExitBootServicesSuccess    = "Exit Boot Services Returned with Success"
+)
+
+// ExitBootServicesOutcome describes the result of the OS loader calling ExitBootServices, as indicated by a log.
+type ExitBootServicesOutcome int
+
+const (
+	// ExitBootServicesNotInvoked indicates that the log doesn't record a call to ExitBootServices. This is normal
+	// for a log read from the firmware before ExitBootServices is called, if the final events table isn't included.
+	ExitBootServicesNotInvoked ExitBootServicesOutcome = iota
+
+	// ExitBootServicesNoResult indicates that the log records the last call to ExitBootServices, but not whether it
+	// returned.
+	ExitBootServicesNoResult
+
+	// ExitBootServicesSucceeded indicates that the last call to ExitBootServices returned with success, so the OS
+	// is present.
+	ExitBootServicesSucceeded
+
+	// ExitBootServicesFailed indicates that the last call to ExitBootServices returned with failure, so the
+	// platform is still in the pre-OS environment.
+	ExitBootServicesFailed
+)
+
+func (o ExitBootServicesOutcome) String() string {
+	switch o {
+	case ExitBootServicesNotInvoked:
+		return "not invoked"
+	case ExitBootServicesNoResult:
+		return "invoked without result"
+	case ExitBootServicesSucceeded:
+		return "returned with success"
+	case ExitBootServicesFailed:
+		return "returned with failure"
+	default:
+		return fmt.Sprintf("ExitBootServicesOutcome(%d)", int(o))
+	}
+}
+
+// ExitBootServicesAttempt describes a single call to ExitBootServices. OS loaders retry the call if it fails
+// because the memory map changed, so a log may record more than one.
+type ExitBootServicesAttempt struct {
+	Invocation *Event // The "Exit Boot Services Invocation" event, if present
+	Return     *Event // The "Exit Boot Services Returned with Success|Failure" event, if present
+	Succeeded  bool   // Whether Return indicates success
+}
+
+// ExitBootServicesInfo describes the calls to ExitBootServices recorded in a log, and any inconsistencies in the way
+// that they were recorded.
+type ExitBootServicesInfo struct {
+	Outcome  ExitBootServicesOutcome   // The outcome of the last call
+	Attempts []ExitBootServicesAttempt // The calls, in the order in which they appear in the log
+	Problems []string                  // Inconsistencies in the pairing and ordering of the events
+}
+
+func exitBootServicesAction(e *Event) string {
+	if e.EventType != EventTypeEFIAction || e.Data() == nil {
+		return ""
+	}
+	switch action := string(e.Data().Bytes()); action {
+	case actionExitBootServicesInvocation, actionExitBootServicesFailure, actionExitBootServicesSuccess:
+		return action
+	default:
+		return ""
+	}
+}
+
+// CheckExitBootServices pairs the "Exit Boot Services Invocation" EV_EFI_ACTION events in the supplied events with
+// the "Exit Boot Services Returned with Success|Failure" events that follow them, and determines the outcome of the
+// last call. These events are measured to PCR 5 after the OS loader has normally retrieved the log, so the supplied
+// events should include those from the final events table if it is available.
+//
+// A return event without a preceding invocation is reported as a problem if it indicates success. Some firmware
+// (eg, EDK2) only measures the invocation when ExitBootServices succeeds, so a failure without a preceding
+// invocation is expected.
+func CheckExitBootServices(events []*Event) *ExitBootServicesInfo {
+	info := &ExitBootServicesInfo{}
+	var pending *Event
+	var succeeded bool
+
+	for _, e := range events {
+		action := exitBootServicesAction(e)
+		if action == "" {
+			continue
+		}
+		if e.PCRIndex != 5 {
+			info.Problems = append(info.Problems,
+				fmt.Sprintf("\"%s\" event %d is measured to PCR %d instead of PCR 5", action, e.Index, e.PCRIndex))
+		}
+		if succeeded {
+			info.Problems = append(info.Problems,
+				fmt.Sprintf("\"%s\" event %d in PCR %d follows a successful return", action, e.Index, e.PCRIndex))
+		}
+
+		switch action {
+		case actionExitBootServicesInvocation:
+			if pending != nil {
+				info.Problems = append(info.Problems,
+					fmt.Sprintf("invocation event %d in PCR %d has no return event", pending.Index, pending.PCRIndex))
+				info.Attempts = append(info.Attempts, ExitBootServicesAttempt{Invocation: pending})
+			}
+			pending = e
+		default:
+			a := ExitBootServicesAttempt{Invocation: pending, Return: e,
+				Succeeded: action == actionExitBootServicesSuccess}
+			if a.Succeeded {
+				if pending == nil {
+					info.Problems = append(info.Problems,
+						fmt.Sprintf("successful return event %d in PCR %d has no invocation event", e.Index,
+							e.PCRIndex))
+				}
+				succeeded = true
+			}
+			info.Attempts = append(info.Attempts, a)
+			pending = nil
+		}
+	}
+	if pending != nil {
+		info.Attempts = append(info.Attempts, ExitBootServicesAttempt{Invocation: pending})
+	}
+
+	if len(info.Attempts) > 0 {
+		last := info.Attempts[len(info.Attempts)-1]
+		switch {
+		case last.Return == nil:
+			info.Outcome = ExitBootServicesNoResult
+		case last.Succeeded:
+			info.Outcome = ExitBootServicesSucceeded
+		default:
+			info.Outcome = ExitBootServicesFailed
+		}
+	}
+	return info
+}
+
+// RequireOSPresent returns an error describing why the log doesn't show that the platform transitioned to the OS,
+// or nil if the last call to ExitBootServices returned with success. Attestations that the OS is present should not
+// be accepted when this returns an error.
+func (i *ExitBootServicesInfo) RequireOSPresent() error {
+	switch i.Outcome {
+	case ExitBootServicesSucceeded:
+		return nil
+	case ExitBootServicesFailed:
+		e := i.Attempts[len(i.Attempts)-1].Return
+		return fmt.Errorf("ExitBootServices returned with failure (event %d in PCR %d)", e.Index, e.PCRIndex)
+	case ExitBootServicesNoResult:
+		e := i.Attempts[len(i.Attempts)-1].Invocation
+		return fmt.Errorf("ExitBootServices was invoked (event %d in PCR %d) but the log doesn't record that it "+
+			"returned", e.Index, e.PCRIndex)
+	default:
+		return errors.New("the log doesn't record a call to ExitBootServices")
+	}
+}
@@ -0,0 +1,74 @@
+package tcglog
+
+import (
+	"testing"
+)
+
+func makeTestExitBootServicesEvent(index uint, pcr PCRIndex, s string) *Event {
+	return &Event{Index: index, PCRIndex: pcr, EventType: EventTypeEFIAction,
+		data: &asciiStringEventData{data: []byte(s)}}
+}
+
+func TestCheckExitBootServices(t *testing.T) {
+	invocation := func(index uint) *Event {
+		return makeTestExitBootServicesEvent(index, 5, "Exit Boot Services Invocation")
+	}
+	success := func(index uint) *Event {
+		return makeTestExitBootServicesEvent(index, 5, "Exit Boot Services Returned with Success")
+	}
+	failure := func(index uint) *Event {
+		return makeTestExitBootServicesEvent(index, 5, "Exit Boot Services Returned with Failure")
+	}
+	other := makeTestExitBootServicesEvent(0, 4, "Calling EFI Application from Boot Option")
+
+	for _, data := range []struct {
+		desc     string
+		events   []*Event
+		outcome  ExitBootServicesOutcome
+		attempts int
+		problems int
+	}{
+		{desc: "NotInvoked", events: []*Event{other}, outcome: ExitBootServicesNotInvoked},
+		{desc: "Success", events: []*Event{other, invocation(0), success(1)}, outcome: ExitBootServicesSucceeded,
+			attempts: 1},
+		{desc: "Failure", events: []*Event{invocation(0), failure(1)}, outcome: ExitBootServicesFailed, attempts: 1},
+		{desc: "NoResult", events: []*Event{invocation(0)}, outcome: ExitBootServicesNoResult, attempts: 1},
+		// EDK2 doesn't measure the invocation when ExitBootServices fails.
+		{desc: "RetryAfterFailure", events: []*Event{failure(0), invocation(1), success(2)},
+			outcome: ExitBootServicesSucceeded, attempts: 2},
+		{desc: "SuccessWithoutInvocation", events: []*Event{success(0)}, outcome: ExitBootServicesSucceeded,
+			attempts: 1, problems: 1},
+		{desc: "InvocationWithoutReturn", events: []*Event{invocation(0), invocation(1), success(2)},
+			outcome: ExitBootServicesSucceeded, attempts: 2, problems: 1},
+		{desc: "AfterSuccess", events: []*Event{invocation(0), success(1), invocation(2), failure(3)},
+			outcome: ExitBootServicesFailed, attempts: 2, problems: 2},
+		{desc: "WrongPCR", events: []*Event{makeTestExitBootServicesEvent(0, 4, "Exit Boot Services Invocation"),
+			success(0)}, outcome: ExitBootServicesSucceeded, attempts: 1, problems: 1},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			info := CheckExitBootServices(data.events)
+			if info.Outcome != data.outcome {
+				t.Errorf("Unexpected outcome: %s", info.Outcome)
+			}
+			if len(info.Attempts) != data.attempts {
+				t.Errorf("Unexpected number of attempts: %d", len(info.Attempts))
+			}
+			if len(info.Problems) != data.problems {
+				t.Errorf("Unexpected problems: %q", info.Problems)
+			}
+			if err := info.RequireOSPresent(); (err == nil) != (data.outcome == ExitBootServicesSucceeded) {
+				t.Errorf("Unexpected RequireOSPresent result: %v", err)
+			}
+		})
+	}
+}
+
+func TestRequireOSPresentError(t *testing.T) {
+	info := CheckExitBootServices([]*Event{
+		makeTestExitBootServicesEvent(0, 5, "Exit Boot Services Invocation"),
+		makeTestExitBootServicesEvent(1, 5, "Exit Boot Services Returned with Failure")})
+	if err := info.RequireOSPresent(); err == nil ||
+		err.Error() != "ExitBootServices returned with failure (event 1 in PCR 5)" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package tcglog
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Severity indicates how serious a Finding is.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// FindingKind identifies findings that callers may need to handle specially.
+type FindingKind int
+
+const (
+	FindingKindGeneric FindingKind = iota
+
+	// FindingKindPlatformMeasurementError indicates that the platform firmware reported an error during boot, which
+	// means that the log may not be a complete record of what was measured.
+	FindingKindPlatformMeasurementError
+
+	// FindingKindInconsistentInternalLengths indicates that the length fields inside the event data structure of an
+	// event don't agree with the size of the event data. This is a common cause of unexpected trailing bytes.
+	FindingKindInconsistentInternalLengths
+
+	// FindingKindFirmwareUIEntered indicates that the user entered firmware setup or the boot menu during boot, which
+	// alters the measurements made to PCRs 1, 4 and 7 on many platforms.
+	FindingKindFirmwareUIEntered
+
+	// FindingKindMalformedUTF16 indicates that a variable or partition name in the event data of an event is not
+	// well-formed UTF-16. This is only reported in strict UTF-16 mode.
+	FindingKindMalformedUTF16
+
+	// FindingKindLogIntegrityMismatch indicates that the log doesn't match a digest of the log recorded by the
+	// platform, which means that it was modified after the digest was recorded.
+	FindingKindLogIntegrityMismatch
+
+	// FindingKindDigestAlgorithmDowngrade indicates that PCR banks recorded in the log from a previous boot are
+	// missing from the log, which may be a deliberate attempt to leave only weaker algorithms (see
+	// DiffLogAlgorithms).
+	FindingKindDigestAlgorithmDowngrade
+
+	// FindingKindUnexpectedSpecIdEvent indicates that the log contains a Spec ID event other than its first event, or
+	// that its Spec ID event isn't measured to PCR 0, which doesn't conform to the specification.
+	FindingKindUnexpectedSpecIdEvent
+
+	// FindingKindMissingSpecIdEvent indicates that the log doesn't begin with a Spec ID event, so it was assumed to be
+	// a SHA-1 log in the format used by TPM 1.2 firmware (see SpecUnknown).
+	FindingKindMissingSpecIdEvent
+
+	// FindingKindExitBootServicesFailed indicates that the last call to ExitBootServices recorded in the log returned
+	// with failure, so the log doesn't describe a platform on which the OS is present.
+	FindingKindExitBootServicesFailed
+
+	// FindingKindTrailingMeasuredBytes indicates that the bytes hashed and measured for an event include bytes at the
+	// end of the event data that weren't consumed by the decoder.
+	FindingKindTrailingMeasuredBytes
+
+	// FindingKindIncorrectDigest indicates that a digest of an event isn't generated from its event data.
+	FindingKindIncorrectDigest
+
+	// FindingKindMissingSeparator indicates that no EV_SEPARATOR event was measured to one of PCRs 0-7.
+	FindingKindMissingSeparator
+
+	// FindingKindDuplicateSeparator indicates that more than one EV_SEPARATOR event was measured to a PCR.
+	FindingKindDuplicateSeparator
+
+	// FindingKindPCRMismatch indicates that the value of a PCR computed from the log is not consistent with the value
+	// read from the TPM.
+	FindingKindPCRMismatch
+
+	// FindingKindEFIBootVariableDataOnly indicates that EV_EFI_VARIABLE_BOOT events only contain a measurement of
+	// the variable data rather than the entire UEFI_VARIABLE_DATA structure.
+	FindingKindEFIBootVariableDataOnly
+
+	// FindingKindNonStandardStartup indicates that PCR 0 was initialized by something other than a TPM2_Startup
+	// command from locality 0 (see StartupSequence).
+	FindingKindNonStandardStartup
+
+	// FindingKindInconsistentStartup indicates that the events that record how PCR 0 was initialized are
+	// inconsistent (see StartupInfo).
+	FindingKindInconsistentStartup
+
+	// FindingKindInconsistentExitBootServices indicates that the events that record the calls to ExitBootServices
+	// are inconsistent (see ExitBootServicesInfo).
+	FindingKindInconsistentExitBootServices
+
+	// FindingKindLogIntegrityVerified indicates that the log matches a digest of the log recorded by the platform.
+	FindingKindLogIntegrityVerified
+
+	// FindingKindKernelTPMError indicates that the kernel reported an error communicating with the TPM (see
+	// CorrelateKernelTPMMessages).
+	FindingKindKernelTPMError
+
+	// FindingKindKernelEventLogError indicates that the kernel reported that it couldn't read all of the event log or
+	// the final events table.
+	FindingKindKernelEventLogError
+
+	// FindingKindKernelTPMFirmwareBug indicates that the kernel worked around a bug in the firmware's description of
+	// the TPM.
+	FindingKindKernelTPMFirmwareBug
+
+	// FindingKindKernelNoTPM indicates that the kernel didn't find a TPM.
+	FindingKindKernelNoTPM
+
+	// FindingKindKernelDiagnosis indicates that messages from the kernel explain other findings.
+	FindingKindKernelDiagnosis
+
+	// FindingKindMultipleBootSegments indicates that the log contains measurements from more than one boot, eg,
+	// because a kernel started with kexec appended its own measurement sequence (see SplitLogSegments).
+	FindingKindMultipleBootSegments
+
+	// FindingKindDigestAlgorithmMismatch indicates that a digest of an event was computed with a different algorithm
+	// to the one it was recorded for (see AuditEventDigests).
+	FindingKindDigestAlgorithmMismatch
+
+	// FindingKindFirmwareUpdateDuringBoot indicates that a firmware update was processed during boot, which adds
+	// measurements to PCRs 0 and 2 that won't be repeated on the next boot (see DetectCapsuleUpdates).
+	FindingKindFirmwareUpdateDuringBoot
+
+	// FindingKindTPMRestarted indicates that the TPM has been restarted or resumed since it was last reset, so its
+	// PCR values may not correspond to the log (see CheckTPMClockInfo).
+	FindingKindTPMRestarted
+
+	// FindingKindTPMResetAfterBoot indicates that the TPM was reset after the log was produced, so its PCR values
+	// don't correspond to the log (see CheckTPMClockInfo).
+	FindingKindTPMResetAfterBoot
+)
+
+// FindingKindInfo describes a kind of finding.
+type FindingKindInfo struct {
+	Kind FindingKind
+
+	// Code is a stable identifier for the kind of finding (eg, "TRAILING_MEASURED_BYTES"), which is suitable for
+	// keying automation, suppressions and dashboards off. Codes are never changed or reused once released.
+	Code string
+
+	Summary string // A one line description of the kind of finding
+}
+
+var findingKindInfos = [...]FindingKindInfo{
+	{FindingKindGeneric, "GENERIC", "A finding that doesn't have a more specific kind"},
+	{FindingKindPlatformMeasurementError, "PLATFORM_MEASUREMENT_ERROR",
+		"The platform firmware reported an error during boot"},
+	{FindingKindInconsistentInternalLengths, "INCONSISTENT_INTERNAL_LENGTHS",
+		"The length fields inside the event data don't agree with the size of the event data"},
+	{FindingKindFirmwareUIEntered, "FIRMWARE_UI_ENTERED",
+		"The user entered firmware setup or the boot menu during boot"},
+	{FindingKindMalformedUTF16, "MALFORMED_UTF16", "A variable or partition name is not well-formed UTF-16"},
+	{FindingKindLogIntegrityMismatch, "LOG_INTEGRITY_MISMATCH",
+		"The log doesn't match a digest of the log recorded by the platform"},
+	{FindingKindDigestAlgorithmDowngrade, "DIGEST_ALGORITHM_DOWNGRADE",
+		"PCR banks recorded in the log from a previous boot are missing from the log"},
+	{FindingKindUnexpectedSpecIdEvent, "UNEXPECTED_SPEC_ID_EVENT",
+		"The log contains a Spec ID event that isn't the first event in PCR 0"},
+	{FindingKindMissingSpecIdEvent, "MISSING_SPEC_ID_EVENT", "The log doesn't begin with a Spec ID event"},
+	{FindingKindExitBootServicesFailed, "EXIT_BOOT_SERVICES_FAILED",
+		"The last call to ExitBootServices returned with failure"},
+	{FindingKindTrailingMeasuredBytes, "TRAILING_MEASURED_BYTES",
+		"The measured bytes of an event include trailing bytes that weren't decoded"},
+	{FindingKindIncorrectDigest, "INCORRECT_DIGEST", "A digest of an event isn't generated from its event data"},
+	{FindingKindMissingSeparator, "MISSING_SEPARATOR", "No EV_SEPARATOR event was measured to one of PCRs 0-7"},
+	{FindingKindDuplicateSeparator, "DUPLICATE_SEPARATOR", "More than one EV_SEPARATOR event was measured to a PCR"},
+	{FindingKindPCRMismatch, "PCR_MISMATCH", "The log is not consistent with a PCR value read from the TPM"},
+	{FindingKindEFIBootVariableDataOnly, "EFI_BOOT_VARIABLE_DATA_ONLY",
+		"EV_EFI_VARIABLE_BOOT events only measure the variable data"},
+	{FindingKindNonStandardStartup, "NON_STANDARD_STARTUP",
+		"PCR 0 wasn't initialized by TPM2_Startup from locality 0"},
+	{FindingKindInconsistentStartup, "INCONSISTENT_STARTUP",
+		"The events that record how PCR 0 was initialized are inconsistent"},
+	{FindingKindInconsistentExitBootServices, "INCONSISTENT_EXIT_BOOT_SERVICES",
+		"The events that record the calls to ExitBootServices are inconsistent"},
+	{FindingKindLogIntegrityVerified, "LOG_INTEGRITY_VERIFIED",
+		"The log matches a digest of the log recorded by the platform"},
+	{FindingKindKernelTPMError, "KERNEL_TPM_ERROR", "The kernel reported an error communicating with the TPM"},
+	{FindingKindKernelEventLogError, "KERNEL_EVENT_LOG_ERROR",
+		"The kernel reported that it couldn't read all of the event log"},
+	{FindingKindKernelTPMFirmwareBug, "KERNEL_TPM_FIRMWARE_BUG",
+		"The kernel worked around a bug in the firmware's description of the TPM"},
+	{FindingKindKernelNoTPM, "KERNEL_NO_TPM", "The kernel didn't find a TPM"},
+	{FindingKindKernelDiagnosis, "KERNEL_DIAGNOSIS", "Messages from the kernel explain other findings"},
+	{FindingKindMultipleBootSegments, "MULTIPLE_BOOT_SEGMENTS",
+		"The log contains measurements from more than one boot"},
+	{FindingKindDigestAlgorithmMismatch, "DIGEST_ALGORITHM_MISMATCH",
+		"A digest of an event was computed with a different algorithm to the one it was recorded for"},
+	{FindingKindFirmwareUpdateDuringBoot, "FIRMWARE_UPDATE_DURING_BOOT",
+		"A firmware update was processed during boot"},
+	{FindingKindTPMRestarted, "TPM_RESTARTED", "The TPM has been restarted or resumed since it was last reset"},
+	{FindingKindTPMResetAfterBoot, "TPM_RESET_AFTER_BOOT", "The TPM was reset after the log was produced"},
+}
+
+// FindingKinds returns a description of every kind of finding, in the order in which they are defined.
+func FindingKinds() []FindingKindInfo {
+	return append([]FindingKindInfo(nil), findingKindInfos[:]...)
+}
+
+// Code returns the stable identifier for this kind of finding (eg, "TRAILING_MEASURED_BYTES").
+func (k FindingKind) Code() string {
+	if k >= 0 && int(k) < len(findingKindInfos) {
+		return findingKindInfos[k].Code
+	}
+	return fmt.Sprintf("FINDING_KIND_%d", int(k))
+}
+
+func (k FindingKind) String() string {
+	return k.Code()
+}
+
+// ParseFindingCode returns the kind of finding identified by the supplied code.
+func ParseFindingCode(code string) (FindingKind, error) {
+	for _, info := range findingKindInfos {
+		if info.Code == code {
+			return info.Kind, nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognized finding code \"%s\"", code)
+}
+
+// Finding describes something notable that was discovered when checking a log.
+type Finding struct {
+	Severity    Severity
+	Kind        FindingKind
+	Description string
+	Event       *Event // The event that this finding relates to, if any
+}
+
+func (f *Finding) String() string {
+	if f.Event == nil {
+		return fmt.Sprintf("%s: %s", f.Severity, f.Description)
+	}
+	return fmt.Sprintf("%s: event %d in PCR %d (type: %s): %s", f.Severity, f.Event.Index, f.Event.PCRIndex,
+		f.Event.EventType, f.Description)
+}
+
+// sortFindings sorts findings in descending order of severity, preserving the original order of findings with the
+// same severity.
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Severity > findings[j].Severity })
+}
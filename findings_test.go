@@ -0,0 +1,61 @@
+package tcglog
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+)
+
+func TestFindingKinds(t *testing.T) {
+	codeRe := regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+	codes := make(map[string]bool)
+	for i, info := range FindingKinds() {
+		if info.Kind != FindingKind(i) {
+			t.Errorf("Unexpected kind at index %d: %d", i, info.Kind)
+		}
+		if !codeRe.MatchString(info.Code) || codes[info.Code] {
+			t.Errorf("Invalid or duplicate code for kind %d: %s", i, info.Code)
+		}
+		codes[info.Code] = true
+		if info.Summary == "" {
+			t.Errorf("Missing summary for %s", info.Code)
+		}
+		if info.Kind.Code() != info.Code {
+			t.Errorf("Unexpected code for kind %d: %s", i, info.Kind.Code())
+		}
+		if k, err := ParseFindingCode(info.Code); err != nil || k != info.Kind {
+			t.Errorf("ParseFindingCode(%s) returned unexpected result: %d, %v", info.Code, k, err)
+		}
+	}
+	if len(codes) != int(FindingKindTPMResetAfterBoot)+1 {
+		t.Errorf("Unexpected number of kinds: %d", len(codes))
+	}
+
+	if FindingKindTrailingMeasuredBytes.Code() != "TRAILING_MEASURED_BYTES" {
+		t.Errorf("Unexpected code: %s", FindingKindTrailingMeasuredBytes)
+	}
+	if FindingKind(1000).Code() != "FINDING_KIND_1000" {
+		t.Errorf("Unexpected code for unknown kind: %s", FindingKind(1000))
+	}
+	if _, err := ParseFindingCode("FOO"); err == nil {
+		t.Errorf("ParseFindingCode should fail for an unknown code")
+	}
+}
+
+func TestFindingKindJSON(t *testing.T) {
+	data, err := json.Marshal(Finding{Severity: SeverityError, Kind: FindingKindPCRMismatch, Description: "foo"})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `{"Severity":2,"Kind":"PCR_MISMATCH","Description":"foo","Event":null}` {
+		t.Errorf("Unexpected JSON: %s", data)
+	}
+
+	var f Finding
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if f.Kind != FindingKindPCRMismatch {
+		t.Errorf("Unexpected kind: %s", f.Kind)
+	}
+}
@@ -0,0 +1,156 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FirmwareRegion describes a region of a firmware image that the platform firmware measures to PCR 0.
+type FirmwareRegion struct {
+	EventType   EventType // The type of event used to measure this region
+	Description string    // A description of this region (used for EV_EFI_PLATFORM_FIRMWARE_BLOB2 events)
+	Offset      int64     // The offset of this region from the start of the image
+	Length      int64     // The length of this region
+	BlobBase    uint64    // The physical address of this region when the image is mapped
+}
+
+// FirmwareLayoutAnalyzer is implemented by types that understand the layout of a particular type of firmware image, and
+// can determine which regions of it are measured by the SRTM.
+type FirmwareLayoutAnalyzer interface {
+	// Name returns the name of the layout supported by this analyzer.
+	Name() string
+
+	// MeasuredRegions returns the regions of the supplied image that are measured to PCR 0, in the order in which
+	// they are measured.
+	MeasuredRegions(image io.ReaderAt, size int64) ([]FirmwareRegion, error)
+}
+
+// PredictFirmwareMeasurements computes the events that the platform firmware would measure to PCR 0 for the supplied
+// image, using analyzer to determine its layout, and the resulting PCR value for each of the specified algorithms.
+// These can be compared with the events in an observed log. Note that the returned events only contain the firmware
+// volume measurements - other PCR 0 events, such as EV_S_CRTM_VERSION and EV_SEPARATOR, are not included.
+func PredictFirmwareMeasurements(image io.ReaderAt, size int64, analyzer FirmwareLayoutAnalyzer,
+	algorithms AlgorithmIdList) ([]*Event, PCRValues, error) {
+	regions, err := analyzer.MeasuredRegions(image, size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot analyze %s image: %v", analyzer.Name(), err)
+	}
+
+	var events []*Event
+	for i, r := range regions {
+		if r.Offset < 0 || r.Length < 0 || r.Offset+r.Length > size {
+			return nil, nil, fmt.Errorf("region %d is outside of the image", i)
+		}
+
+		digests := DigestMap{}
+		for _, alg := range algorithms {
+			h := alg.newHash()
+			if _, err := io.Copy(h, io.NewSectionReader(image, r.Offset, r.Length)); err != nil {
+				return nil, nil, fmt.Errorf("cannot read region %d: %v", i, err)
+			}
+			digests[alg] = h.Sum(nil)
+		}
+
+		var data EventData
+		switch r.EventType {
+		case EventTypeEFIPlatformFirmwareBlob2:
+			data = &EFIPlatformFirmwareBlob2EventData{BlobDescription: r.Description, BlobBase: r.BlobBase,
+				BlobLength: uint64(r.Length)}
+		default:
+			data = &EFIPlatformFirmwareBlobEventData{BlobBase: r.BlobBase, BlobLength: uint64(r.Length)}
+		}
+
+		events = append(events, &Event{Index: uint(i), PCRIndex: 0, EventType: r.EventType, Digests: NewEventDigests(digests),
+			data: data})
+	}
+
+	values, err := replayEvents(events, algorithms)
+	if err != nil {
+		return nil, nil, err
+	}
+	return events, values, nil
+}
+
+var (
+	efiFirmwareFileSystem2GUID = *NewEFIGUID(0x8c8ce578, 0x8a3d, 0x4f1c, 0x9935, [...]uint8{0x89, 0x61, 0x85, 0xc3, 0x2d, 0xd3})
+	efiFirmwareFileSystem3GUID = *NewEFIGUID(0x5473c07a, 0x3dcb, 0x4dca, 0xbd6f, [...]uint8{0x1e, 0x96, 0x89, 0xe7, 0x34, 0x9a})
+)
+
+// https://uefi.org/sites/default/files/resources/PI_Spec_1_7_final_Jan_2019.pdf
+//  (volume 3, section 3.2.1 "Firmware Volume Header")
+type efiFirmwareVolumeHeader struct {
+	ZeroVector      [16]uint8
+	FileSystemGuid  EFIGUID
+	FvLength        uint64
+	Signature       uint32
+	Attributes      uint32
+	HeaderLength    uint16
+	Checksum        uint16
+	ExtHeaderOffset uint16
+	Reserved        uint8
+	Revision        uint8
+}
+
+const efiFVHSignature uint32 = 0x4856465f // "_FVH"
+
+// EDK2FirmwareLayout is a FirmwareLayoutAnalyzer for firmware images built with EDK2, which measures each of the
+// firmware volumes containing a PI firmware file system as an EV_EFI_PLATFORM_FIRMWARE_BLOB event. Only firmware
+// volumes that are stored uncompressed in the image can be found - volumes that are decompressed at runtime (such
+// as the DXE volume in OVMF) are not supported.
+type EDK2FirmwareLayout struct {
+	// BaseAddress is the physical address at which the image is mapped. If zero, the image is assumed to be mapped
+	// immediately below 4GiB.
+	BaseAddress uint64
+}
+
+func (l *EDK2FirmwareLayout) Name() string {
+	return "EDK2"
+}
+
+func (l *EDK2FirmwareLayout) MeasuredRegions(image io.ReaderAt, size int64) ([]FirmwareRegion, error) {
+	base := l.BaseAddress
+	if base == 0 {
+		if size > 1<<32 {
+			return nil, errors.New("image is too large to be mapped below 4GiB")
+		}
+		base = 1<<32 - uint64(size)
+	}
+
+	headerSize := int64(binary.Size(efiFirmwareVolumeHeader{}))
+
+	var regions []FirmwareRegion
+	buf := make([]byte, headerSize)
+	// Firmware volumes are aligned to at least 8 bytes.
+	for offset := int64(0); offset+headerSize <= size; {
+		var header efiFirmwareVolumeHeader
+		if _, err := image.ReadAt(buf, offset); err != nil {
+			return nil, err
+		}
+		binary.Read(bytes.NewReader(buf), binary.LittleEndian, &header)
+
+		if header.Signature != efiFVHSignature || header.FvLength < uint64(headerSize) ||
+			header.FvLength > uint64(size-offset) {
+			offset += 8
+			continue
+		}
+
+		if header.FileSystemGuid == efiFirmwareFileSystem2GUID || header.FileSystemGuid == efiFirmwareFileSystem3GUID {
+			regions = append(regions, FirmwareRegion{
+				EventType: EventTypeEFIPlatformFirmwareBlob,
+				Offset:    offset,
+				Length:    int64(header.FvLength),
+				BlobBase:  base + uint64(offset)})
+		}
+
+		// Skip over the volume so that nested volumes aren't measured separately.
+		offset += int64(header.FvLength)
+	}
+
+	if len(regions) == 0 {
+		return nil, errors.New("no firmware volumes found")
+	}
+	return regions, nil
+}
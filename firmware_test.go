@@ -0,0 +1,55 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func makeTestFirmwareVolume(fs EFIGUID, length int) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, efiFirmwareVolumeHeader{
+		FileSystemGuid: fs,
+		FvLength:       uint64(length),
+		Signature:      efiFVHSignature,
+		HeaderLength:   uint16(binary.Size(efiFirmwareVolumeHeader{}))})
+	for buf.Len() < length {
+		buf.WriteByte(0xff)
+	}
+	return buf.Bytes()
+}
+
+func TestPredictFirmwareMeasurements(t *testing.T) {
+	nvram := *NewEFIGUID(0xfff12b8d, 0x7696, 0x4c8b, 0xa985, [...]uint8{0x27, 0x47, 0x07, 0x5b, 0x4f, 0x50})
+
+	var image bytes.Buffer
+	image.Write(makeTestFirmwareVolume(nvram, 0x1000))
+	image.Write(make([]byte, 0x100))
+	pei := makeTestFirmwareVolume(efiFirmwareFileSystem2GUID, 0x2000)
+	image.Write(pei)
+	dxe := makeTestFirmwareVolume(efiFirmwareFileSystem3GUID, 0x1000)
+	image.Write(dxe)
+
+	algs := AlgorithmIdList{AlgorithmSha256}
+	events, values, err := PredictFirmwareMeasurements(bytes.NewReader(image.Bytes()), int64(image.Len()),
+		&EDK2FirmwareLayout{}, algs)
+	if err != nil {
+		t.Fatalf("PredictFirmwareMeasurements failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Unexpected number of events: %d", len(events))
+	}
+
+	expected, _ := replayEvents([]*Event{
+		{PCRIndex: 0, EventType: EventTypeEFIPlatformFirmwareBlob, Digests: NewEventDigests(DigestMap{AlgorithmSha256: AlgorithmSha256.hash(pei)})},
+		{PCRIndex: 0, EventType: EventTypeEFIPlatformFirmwareBlob, Digests: NewEventDigests(DigestMap{AlgorithmSha256: AlgorithmSha256.hash(dxe)})},
+	}, algs)
+	if !bytes.Equal(values[0][AlgorithmSha256], expected[0][AlgorithmSha256]) {
+		t.Errorf("Unexpected PCR 0 value: %x", values[0][AlgorithmSha256])
+	}
+
+	blob := events[0].Data().(*EFIPlatformFirmwareBlobEventData)
+	if blob.BlobBase != 1<<32-uint64(image.Len())+0x1100 || blob.BlobLength != 0x2000 {
+		t.Errorf("Unexpected event data: %s", blob)
+	}
+}
@@ -0,0 +1,83 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// FirmwareError describes an event with which the platform firmware reported an error during boot. This includes
+// EV_SEPARATOR events that measure the error value, and action or S-CRTM events with a string describing an error.
+// The presence of any of these means that the log may not be a complete record of what was measured.
+type FirmwareError struct {
+	Event *Event
+	Info  string // The error information decoded from the event data
+}
+
+func (e *FirmwareError) String() string {
+	return fmt.Sprintf("event %d in PCR %d (type: %s): %s", e.Event.Index, e.Event.PCRIndex, e.Event.EventType, e.Info)
+}
+
+// decodeErrorInfo returns a printable representation of error information recorded in event data, which may be an
+// ASCII string, a UCS-2 string or arbitrary binary data. Only strings made entirely of printable ASCII characters are
+// decoded as such, as arbitrary binary data often happens to be valid UTF-8 or UCS-2.
+func decodeErrorInfo(data []byte) string {
+	isPrintable := func(s string) bool {
+		if s == "" {
+			return false
+		}
+		for _, r := range s {
+			if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if s := string(bytes.TrimRight(data, "\x00")); isPrintable(s) {
+		return s
+	}
+	if len(data)%2 == 0 {
+		u16 := make([]uint16, len(data)/2)
+		binary.Read(bytes.NewReader(data), binary.LittleEndian, &u16)
+		for len(u16) > 0 && u16[len(u16)-1] == 0 {
+			u16 = u16[:len(u16)-1]
+		}
+		if s := string(utf16.Decode(u16)); isPrintable(s) {
+			return s
+		}
+	}
+	return fmt.Sprintf("%x", data)
+}
+
+func isErrorString(s string) bool {
+	s = strings.ToLower(s)
+	return strings.Contains(s, "error") || strings.Contains(s, "fail")
+}
+
+// FindFirmwareErrors returns the events with which the platform firmware reported an error during boot.
+func FindFirmwareErrors(events []*Event) []*FirmwareError {
+	var out []*FirmwareError
+	for _, e := range events {
+		switch e.EventType {
+		case EventTypeSeparator:
+			if !isSeparatorErrorEvent(e) {
+				continue
+			}
+			out = append(out, &FirmwareError{Event: e, Info: decodeErrorInfo(e.Data().Bytes())})
+		case EventTypeAction, EventTypeEFIAction, EventTypeSCRTMContents, EventTypeSCRTMVersion:
+			if e.Data() == nil {
+				continue
+			}
+			info := decodeErrorInfo(e.Data().Bytes())
+			if !isErrorString(info) {
+				continue
+			}
+			out = append(out, &FirmwareError{Event: e, Info: info})
+		}
+	}
+	return out
+}
@@ -0,0 +1,33 @@
+package tcglog
+
+import (
+	"testing"
+)
+
+func TestFindFirmwareErrors(t *testing.T) {
+	events := []*Event{
+		{Index: 0, PCRIndex: 0, EventType: EventTypeSCRTMVersion, data: &opaqueEventData{data: []byte{'1', 0, '.', 0, '0', 0, 0, 0}}},
+		{Index: 1, PCRIndex: 4, EventType: EventTypeEFIAction, data: &asciiStringEventData{data: []byte("Calling EFI Application from Boot Option")}},
+		{Index: 2, PCRIndex: 5, EventType: EventTypeEFIAction, data: &asciiStringEventData{data: []byte("Exit Boot Services Returned with Failure")}},
+		{Index: 3, PCRIndex: 0, EventType: EventTypeSeparator, data: &separatorEventData{data: []byte{0, 0, 0, 0}}},
+		{Index: 4, PCRIndex: 1, EventType: EventTypeSeparator, data: &separatorEventData{data: []byte("TPM timeout\x00"), isError: true}},
+		{Index: 5, PCRIndex: 2, EventType: EventTypeSeparator, data: &separatorEventData{data: []byte{0x01, 0xff}, isError: true}},
+	}
+
+	errors := FindFirmwareErrors(events)
+	if len(errors) != 3 {
+		t.Fatalf("Unexpected number of errors: %d", len(errors))
+	}
+	for i, expected := range []struct {
+		index uint
+		info  string
+	}{
+		{2, "Exit Boot Services Returned with Failure"},
+		{4, "TPM timeout"},
+		{5, "01ff"},
+	} {
+		if errors[i].Event.Index != expected.index || errors[i].Info != expected.info {
+			t.Errorf("Unexpected error %d: %s", i, errors[i])
+		}
+	}
+}
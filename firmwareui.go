@@ -0,0 +1,109 @@
+package tcglog
+
+import (
+	"fmt"
+)
+
+var (
+	// The file GUIDs of the setup (UiApp) and boot manager menu applications in EDK2 based firmware.
+	edk2UiAppGUID              = *NewEFIGUID(0x462caa21, 0x7614, 0x4503, 0x836e, [...]uint8{0x8a, 0xb6, 0xf4, 0x66, 0x23, 0x31})
+	edk2BootManagerMenuAppGUID = *NewEFIGUID(0xeec25bdc, 0x67f2, 0x4d95, 0xb1d5, [...]uint8{0xf8, 0x1b, 0x20, 0x39, 0xd1, 0x1d})
+)
+
+const (
+	// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+	//  (section 10.4.3 "EV_ACTION Event Types" and section 10.4.4 "EV_EFI_ACTION Event Types")
+	actionEnteringROMBasedSetup = "Entering ROM Based Setup"
+	actionReturningBootOption   = "Returning from EFI Application from Boot Option"
+	actionCallingBootOption     = "Calling EFI Application from Boot Option"
+)
+
+// FirmwareUIKind describes how the user interacted with the firmware during boot.
+type FirmwareUIKind int
+
+const (
+	// FirmwareUIKindSetup indicates that the user entered firmware setup.
+	FirmwareUIKindSetup FirmwareUIKind = iota
+
+	// FirmwareUIKindBootMenu indicates that the user entered the firmware boot menu.
+	FirmwareUIKindBootMenu
+
+	// FirmwareUIKindBootOptionReturned indicates that an application launched from a boot option returned to the
+	// firmware before another one was launched, which happens when the user exits from setup or the boot menu, or
+	// when a boot option fails.
+	FirmwareUIKindBootOptionReturned
+)
+
+func (k FirmwareUIKind) String() string {
+	switch k {
+	case FirmwareUIKindSetup:
+		return "firmware setup"
+	case FirmwareUIKindBootMenu:
+		return "boot menu"
+	case FirmwareUIKindBootOptionReturned:
+		return "return from boot option"
+	default:
+		return fmt.Sprintf("FirmwareUIKind(%d)", int(k))
+	}
+}
+
+// FirmwareUIEntry describes an event that indicates that the user interacted with the firmware during boot. This
+// alters the events measured to PCRs 1, 4 and 7 on many platforms, and is a common benign reason for a sealed object
+// to fail to unseal.
+type FirmwareUIEntry struct {
+	Kind  FirmwareUIKind
+	Event *Event
+}
+
+func (e *FirmwareUIEntry) String() string {
+	return fmt.Sprintf("%s (event %d in PCR %d, type: %s)", e.Kind, e.Event.Index, e.Event.PCRIndex, e.Event.EventType)
+}
+
+// DetectFirmwareUIEntry returns the events that indicate that the user entered firmware setup or the boot menu
+// during the measured boot, in the order in which they appear in the log. Setup is detected from the
+// "Entering ROM Based Setup" EV_ACTION event. Setup and the boot menu are also detected from EDK2's UiApp and
+// BootManagerMenuApp being launched. An EV_EFI_ACTION event indicating that a boot option returned is only reported
+// if another boot option was launched afterwards.
+func DetectFirmwareUIEntry(events []*Event) []*FirmwareUIEntry {
+	var out []*FirmwareUIEntry
+	var returned *Event
+
+	for _, e := range events {
+		switch e.EventType {
+		case EventTypeAction, EventTypeEFIAction:
+			if e.Data() == nil {
+				continue
+			}
+			switch string(e.Data().Bytes()) {
+			case actionEnteringROMBasedSetup:
+				out = append(out, &FirmwareUIEntry{Kind: FirmwareUIKindSetup, Event: e})
+			case actionReturningBootOption:
+				returned = e
+			case actionCallingBootOption:
+				if returned != nil {
+					out = append(out, &FirmwareUIEntry{Kind: FirmwareUIKindBootOptionReturned, Event: returned})
+					returned = nil
+				}
+			}
+		case EventTypeEFIBootServicesApplication:
+			d, ok := e.Data().(*efiImageLoadEventData)
+			if !ok {
+				continue
+			}
+			for _, node := range d.path {
+				guid, ok := node.FirmwareFileGUID()
+				if !ok {
+					continue
+				}
+				switch *guid {
+				case edk2UiAppGUID:
+					out = append(out, &FirmwareUIEntry{Kind: FirmwareUIKindSetup, Event: e})
+				case edk2BootManagerMenuAppGUID:
+					out = append(out, &FirmwareUIEntry{Kind: FirmwareUIKindBootMenu, Event: e})
+				}
+			}
+		}
+	}
+
+	return out
+}
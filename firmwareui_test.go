@@ -0,0 +1,53 @@
+package tcglog
+
+import (
+	"testing"
+)
+
+func TestDetectFirmwareUIEntry(t *testing.T) {
+	action := func(t EventType, s string) *Event {
+		return &Event{PCRIndex: 4, EventType: t, data: &asciiStringEventData{data: []byte(s)}}
+	}
+	app := func(path EFIDevicePath) *Event {
+		return &Event{PCRIndex: 4, EventType: EventTypeEFIBootServicesApplication,
+			data: &efiImageLoadEventData{path: path}}
+	}
+
+	events := []*Event{
+		action(EventTypeAction, "Entering ROM Based Setup"),
+		action(EventTypeEFIAction, "Calling EFI Application from Boot Option"),
+		app(EFIDevicePath{makeTestFvFileNode(edk2BootManagerMenuAppGUID)}),
+		action(EventTypeEFIAction, "Returning from EFI Application from Boot Option"),
+		action(EventTypeEFIAction, "Calling EFI Application from Boot Option"),
+		app(makeTestBootDevicePath()),
+		action(EventTypeEFIAction, "Returning from EFI Application from Boot Option"),
+	}
+
+	entries := DetectFirmwareUIEntry(events)
+	if len(entries) != 3 {
+		t.Fatalf("Unexpected number of entries: %d", len(entries))
+	}
+	for i, e := range []struct {
+		kind  FirmwareUIKind
+		event *Event
+	}{
+		{FirmwareUIKindSetup, events[0]},
+		{FirmwareUIKindBootMenu, events[2]},
+		{FirmwareUIKindBootOptionReturned, events[3]},
+	} {
+		if entries[i].Kind != e.kind || entries[i].Event != e.event {
+			t.Errorf("Unexpected entry %d: %s", i, entries[i])
+		}
+	}
+}
+
+func TestDetectFirmwareUIEntryNormalBoot(t *testing.T) {
+	events := []*Event{
+		{PCRIndex: 4, EventType: EventTypeEFIAction,
+			data: &asciiStringEventData{data: []byte("Calling EFI Application from Boot Option")}},
+		{PCRIndex: 4, EventType: EventTypeSeparator, data: &separatorEventData{data: []byte{0, 0, 0, 0}}},
+	}
+	if entries := DetectFirmwareUIEntry(events); len(entries) != 0 {
+		t.Errorf("Unexpected entries: %v", entries)
+	}
+}
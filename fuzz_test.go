@@ -0,0 +1,125 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+// fuzzEventTypes are the event types that have a decoder, used to select the decoder for FuzzDecodeEventData.
+var fuzzEventTypes = []EventType{
+	EventTypeNoAction,
+	EventTypeSeparator,
+	EventTypeAction,
+	EventTypeEventTag,
+	EventTypeSCRTMVersion,
+	EventTypeIPL,
+	EventTypeEFIVariableDriverConfig,
+	EventTypeEFIVariableBoot,
+	EventTypeEFIVariableAuthority,
+	EventTypeEFIBootServicesApplication,
+	EventTypeEFIBootServicesDriver,
+	EventTypeEFIRuntimeServicesDriver,
+	EventTypeEFIGPTEvent,
+	EventTypeEFIAction,
+	EventTypeEFIPlatformFirmwareBlob,
+	EventTypeEFIPlatformFirmwareBlob2,
+	EventTypeEFIHandoffTables,
+	EventTypeEFIHandoffTables2,
+}
+
+// exerciseFuzzEvent calls the methods of an event that process its decoded data, so that fuzzing covers them as
+// well as the decoders.
+func exerciseFuzzEvent(t *testing.T, event *Event) {
+	_ = event.Data().String()
+	if _, err := json.Marshal(event); err != nil {
+		t.Errorf("Cannot encode event: %v", err)
+	}
+	CheckInternalLengths(event)
+	event.TrailingDataBytes()
+	if d, ok := event.Data().(*EFIVariableEventData); ok {
+		decodeEFILoadOption(d.VariableData, d.limits)
+		decodeEFISignatureDatabase(d.VariableData, d.limits)
+	}
+}
+
+func FuzzNewLog(f *testing.F) {
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+	f.Add(makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(0, EventTypeSCRTMVersion, []byte("1.0\x00"), algs...),
+		makeTestLogEvent(7, EventTypeEFIVariableDriverConfig,
+			makeTestVariableEventData(convertStringToUtf16("SecureBoot")), algs...),
+		makeTestLogEvent(7, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...)}), false)
+	f.Add(makeTestLog_2([]AlgorithmId{AlgorithmSha256}, []testLogEvent{
+		makeTestLogEvent(4, EventTypeEFIAction, []byte("Calling EFI Application from Boot Option"), AlgorithmSha256)}),
+		true)
+
+	f.Fuzz(func(t *testing.T, data []byte, permissive bool) {
+		log, err := NewLog(bytes.NewReader(data), LogOptions{
+			EnableGrub:           true,
+			EnableSystemdEFIStub: true,
+			SystemdEFIStubPCR:    12,
+			EnableWindowsSIPA:    true,
+			Permissive:           permissive,
+			MaxEventDataSize:     4096})
+		if err != nil {
+			return
+		}
+		for i := 0; ; i++ {
+			event, err := log.NextEvent()
+			if err != nil {
+				if err != io.EOF {
+					return
+				}
+				break
+			}
+			if i > len(data) {
+				t.Fatalf("Read more events than there are bytes in the log")
+			}
+			exerciseFuzzEvent(t, event)
+		}
+	})
+}
+
+func FuzzDecodeEventData(f *testing.F) {
+	f.Add(uint8(7), uint8(6), makeTestVariableEventData(convertStringToUtf16("SecureBoot")))
+	f.Add(uint8(0), uint8(0), append([]byte("Spec ID Event03\x00"), make([]byte, 16)...))
+
+	var imageLoad bytes.Buffer
+	binary.Write(&imageLoad, binary.LittleEndian, [4]uint64{0x1000, 0x2000, 0, 4})
+	imageLoad.Write([]byte{0x7f, 0xff, 0x04, 0x00})
+	f.Add(uint8(4), uint8(9), imageLoad.Bytes())
+
+	f.Fuzz(func(t *testing.T, pcr uint8, eventType uint8, data []byte) {
+		event := &Event{
+			PCRIndex:  PCRIndex(pcr % 32),
+			EventType: fuzzEventTypes[int(eventType)%len(fuzzEventTypes)]}
+		event.lazy = newLazyEventData(event.PCRIndex, event.EventType, data, &LogOptions{
+			EnableGrub:           true,
+			EnableSystemdEFIStub: true,
+			SystemdEFIStubPCR:    12,
+			EnableWindowsSIPA:    true}, false)
+		if trailing := event.trailingBytes(); trailing < 0 || trailing > len(data) {
+			t.Fatalf("Invalid number of trailing bytes (%d) for %d bytes of event data", trailing, len(data))
+		}
+		exerciseFuzzEvent(t, event)
+	})
+}
+
+func FuzzDecodeDevicePath(f *testing.F) {
+	f.Add(encodeTestDevicePath(makeTestBootDevicePath()))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		path, err := decodeDevicePath(data, decodeLimits{})
+		if err != nil {
+			return
+		}
+		_ = path.String()
+		for _, style := range []EFIDevicePathStringStyle{EFIDevicePathStringStyleEDK2, EFIDevicePathStringStyleEfibootmgr} {
+			_ = path.StringCompat(style)
+		}
+		path.Normalize()
+	})
+}
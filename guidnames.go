@@ -0,0 +1,96 @@
+package tcglog
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var systemdLoaderGUID = *NewEFIGUID(0x4a67b082, 0x0a4c, 0x41cf, 0xb6c7, [...]uint8{0x44, 0x0b, 0x29, 0xbb, 0x8c, 0x4f})
+
+var (
+	efiGUIDNamesMu sync.RWMutex
+	efiGUIDNames   = map[EFIGUID]string{
+		efiGlobalVariableGUID:        "EFI_GLOBAL_VARIABLE",
+		efiImageSecurityDatabaseGUID: "EFI_IMAGE_SECURITY_DATABASE",
+		shimLockGUID:                 "SHIM_LOCK",
+		systemdLoaderGUID:            "SYSTEMD_LOADER",
+
+		efiCertSHA1GUID:       "EFI_CERT_SHA1",
+		efiCertSHA256GUID:     "EFI_CERT_SHA256",
+		efiCertSHA384GUID:     "EFI_CERT_SHA384",
+		efiCertSHA512GUID:     "EFI_CERT_SHA512",
+		efiCertRSA2048GUID:    "EFI_CERT_RSA2048",
+		efiCertX509GUID:       "EFI_CERT_X509",
+		efiCertX509SHA256GUID: "EFI_CERT_X509_SHA256",
+		efiCertX509SHA384GUID: "EFI_CERT_X509_SHA384",
+		efiCertX509SHA512GUID: "EFI_CERT_X509_SHA512",
+
+		mpsTableGUID:       "MPS_TABLE",
+		acpiTableGUID:      "ACPI_TABLE",
+		smbiosTableGUID:    "SMBIOS_TABLE",
+		salSystemTableGUID: "SAL_SYSTEM_TABLE",
+		acpi20TableGUID:    "EFI_ACPI_20_TABLE",
+		smbios3TableGUID:   "SMBIOS3_TABLE"}
+)
+
+// RegisterEFIGUIDName associates a symbolic name with a GUID, so that it is used in place of the GUID in the string
+// representation of event data and is accepted by EFIGUID.Parse. It returns an error if the GUID already has a name
+// or if the name is already used for another GUID. It is safe to call from multiple goroutines.
+func RegisterEFIGUIDName(guid EFIGUID, name string) error {
+	if name == "" {
+		return errors.New("empty name")
+	}
+
+	efiGUIDNamesMu.Lock()
+	defer efiGUIDNamesMu.Unlock()
+
+	if n, exists := efiGUIDNames[guid]; exists {
+		return fmt.Errorf("%s already has the name %s", &guid, n)
+	}
+	for g, n := range efiGUIDNames {
+		if n == name {
+			return fmt.Errorf("name %s is already used for %s", name, &g)
+		}
+	}
+	efiGUIDNames[guid] = name
+	return nil
+}
+
+// Name returns the symbolic name for this GUID if it is a well-known GUID or one registered with
+// RegisterEFIGUIDName.
+func (g *EFIGUID) Name() (name string, ok bool) {
+	efiGUIDNamesMu.RLock()
+	defer efiGUIDNamesMu.RUnlock()
+	name, ok = efiGUIDNames[*g]
+	return
+}
+
+// nameOrString returns the symbolic name for this GUID if it has one, or the canonical string form otherwise.
+func (g *EFIGUID) nameOrString() string {
+	if name, ok := g.Name(); ok {
+		return name
+	}
+	return g.String()
+}
+
+// Parse sets this GUID from s, which is either the canonical string form (with or without braces) or a symbolic
+// name known to Name.
+func (g *EFIGUID) Parse(s string) error {
+	efiGUIDNamesMu.RLock()
+	for guid, name := range efiGUIDNames {
+		if name == s {
+			efiGUIDNamesMu.RUnlock()
+			*g = guid
+			return nil
+		}
+	}
+	efiGUIDNamesMu.RUnlock()
+
+	guid, err := parseEFIGUID(s)
+	if err != nil {
+		return err
+	}
+	*g = guid
+	return nil
+}
@@ -0,0 +1,86 @@
+package tcglog
+
+import (
+	"testing"
+)
+
+func TestEFIGUIDName(t *testing.T) {
+	for _, data := range []struct {
+		guid EFIGUID
+		name string
+	}{
+		{efiGlobalVariableGUID, "EFI_GLOBAL_VARIABLE"},
+		{efiImageSecurityDatabaseGUID, "EFI_IMAGE_SECURITY_DATABASE"},
+		{shimLockGUID, "SHIM_LOCK"},
+		{systemdLoaderGUID, "SYSTEMD_LOADER"},
+	} {
+		name, ok := data.guid.Name()
+		if !ok || name != data.name {
+			t.Errorf("Unexpected name for %s: %s", &data.guid, name)
+		}
+	}
+
+	guid := NewEFIGUID(0x01234567, 0x89ab, 0xcdef, 0x0123, [...]uint8{0x45, 0x67, 0x89, 0xab, 0xcd, 0xef})
+	if _, ok := guid.Name(); ok {
+		t.Errorf("Unregistered GUID shouldn't have a name")
+	}
+	if guid.nameOrString() != "{01234567-89ab-cdef-0123-456789abcdef}" {
+		t.Errorf("Unexpected string: %s", guid.nameOrString())
+	}
+}
+
+func TestRegisterEFIGUIDName(t *testing.T) {
+	guid := *NewEFIGUID(0x3e0eb2a0, 0x37d8, 0x4cf4, 0x9d29, [...]uint8{0x1a, 0x77, 0x07, 0x3c, 0x5b, 0x21})
+	if err := RegisterEFIGUIDName(guid, "TEST_VENDOR"); err != nil {
+		t.Fatalf("RegisterEFIGUIDName failed: %v", err)
+	}
+	defer func() {
+		efiGUIDNamesMu.Lock()
+		delete(efiGUIDNames, guid)
+		efiGUIDNamesMu.Unlock()
+	}()
+
+	if name, _ := guid.Name(); name != "TEST_VENDOR" {
+		t.Errorf("Unexpected name: %s", name)
+	}
+
+	e := EFIVariableEventData{VariableName: guid, UnicodeName: "Foo"}
+	expected := "UEFI_VARIABLE_DATA{ VariableName: TEST_VENDOR, UnicodeName: \"Foo\", VariableDataLength: 0 }"
+	if e.String() != expected {
+		t.Errorf("Unexpected string:\ngot:      %s\nexpected: %s", &e, expected)
+	}
+
+	if err := RegisterEFIGUIDName(guid, "OTHER_NAME"); err == nil {
+		t.Errorf("Registering a second name for a GUID should fail")
+	}
+	if err := RegisterEFIGUIDName(EFIGUID{}, "EFI_GLOBAL_VARIABLE"); err == nil {
+		t.Errorf("Registering a duplicate name should fail")
+	}
+}
+
+func TestEFIGUIDParse(t *testing.T) {
+	for _, data := range []struct {
+		s        string
+		expected EFIGUID
+	}{
+		{"8be4df61-93ca-11d2-aa0d-00e098032b8c", efiGlobalVariableGUID},
+		{"{605DAB50-E046-4300-ABB6-3DD810DD8B23}", shimLockGUID},
+		{"EFI_IMAGE_SECURITY_DATABASE", efiImageSecurityDatabaseGUID},
+	} {
+		var guid EFIGUID
+		if err := guid.Parse(data.s); err != nil {
+			t.Errorf("Parse(%s) failed: %v", data.s, err)
+			continue
+		}
+		if guid != data.expected {
+			t.Errorf("Unexpected GUID from %s: %s", data.s, &guid)
+		}
+	}
+
+	var guid EFIGUID
+	for _, s := range []string{"", "NOT_A_GUID", "8be4df61-93ca-11d2-aa0d", "8be4df6193ca11d2aa0d00e098032b8c"} {
+		if err := guid.Parse(s); err == nil {
+			t.Errorf("Parse(%s) should have failed", s)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package tcglog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	imaTemplateNameLenMax = 255 // TCG_EVENT_NAME_LEN_MAX
+	imaEventNameLenMax    = 255 // IMA_EVENT_NAME_LEN_MAX
+
+	// The maximum size of the template data we're prepared to read for a single entry, to avoid making huge
+	// allocations when reading a corrupted log. The kernel limits this to 2 * PAGE_SIZE for the ima-buf template,
+	// but signatures and buffers can make entries larger than this on some architectures.
+	imaTemplateDataLenMax = 1 << 20
+)
+
+// IMALogFormat specifies the format of a Linux IMA runtime measurement list.
+type IMALogFormat int
+
+const (
+	IMALogFormatBinary IMALogFormat = iota // The format of binary_runtime_measurements
+	IMALogFormatASCII                      // The format of ascii_runtime_measurements
+)
+
+// IMAEvent corresponds to a single entry in a Linux IMA runtime measurement list.
+type IMAEvent struct {
+	PCRIndex       PCRIndex
+	TemplateDigest Digest // The template digest recorded in the log
+	TemplateName   string // The name of the template, eg, "ima-ng" or "ima-sig"
+	TemplateData   []byte // The template data, in the form that is hashed to produce the template digest
+
+	// The following fields are decoded from the template data for the ima, ima-ng and ima-sig templates.
+	FileDigestAlgorithm string // The algorithm of FileDigest, eg, "sha256"
+	FileDigest          Digest
+	FileName            string
+	Signature           []byte // The file signature, for the ima-sig template
+}
+
+// IsViolation indicates whether this entry records a measurement violation, in which case the template digest is
+// zero and the PCR is extended with a digest of all 0xff bytes instead.
+func (e *IMAEvent) IsViolation() bool {
+	for _, b := range e.TemplateDigest {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ComputeTemplateDigest computes the template digest of this entry for the specified algorithm, which is the value
+// that IMA extends in to the corresponding PCR bank. For a measurement violation, this returns a digest of all 0xff
+// bytes.
+func (e *IMAEvent) ComputeTemplateDigest(alg AlgorithmId) Digest {
+	if e.IsViolation() {
+		return Digest(bytes.Repeat([]byte{0xff}, alg.size()))
+	}
+	return alg.hash(e.TemplateData)
+}
+
+func (e *IMAEvent) String() string {
+	return fmt.Sprintf("PCR %d, template: %s, file: %s, digest: %s:%x", e.PCRIndex, e.TemplateName, e.FileName,
+		e.FileDigestAlgorithm, e.FileDigest)
+}
+
+// imaLegacyTemplateData produces the data that is hashed for an entry with the original "ima" template, where the
+// file name is padded to a fixed length.
+func imaLegacyTemplateData(digest []byte, name string) []byte {
+	out := make([]byte, 20+imaEventNameLenMax+1)
+	copy(out, digest)
+	copy(out[20:], name)
+	return out
+}
+
+// appendIMAField appends a template field, prefixed with its length, to the supplied template data.
+func appendIMAField(data []byte, field []byte) []byte {
+	var l [4]byte
+	binary.LittleEndian.PutUint32(l[:], uint32(len(field)))
+	return append(append(data, l[:]...), field...)
+}
+
+// decodeIMATemplateFields decodes the fields from the template data of an entry using a template other than "ima".
+func decodeIMATemplateFields(data []byte) ([][]byte, error) {
+	var fields [][]byte
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		n := binary.LittleEndian.Uint32(data)
+		data = data[4:]
+		if uint64(n) > uint64(len(data)) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		fields = append(fields, data[:n])
+		data = data[n:]
+	}
+	return fields, nil
+}
+
+// decodeIMADigestNG decodes a d-ng field, which consists of the algorithm name, a ':' and a NULL terminator,
+// followed by the digest.
+func decodeIMADigestNG(field []byte) (string, Digest, error) {
+	i := bytes.IndexByte(field, 0)
+	if i < 1 || field[i-1] != ':' {
+		return "", nil, errors.New("invalid d-ng field")
+	}
+	return string(field[:i-1]), Digest(field[i+1:]), nil
+}
+
+// decodeTemplateData populates the decoded fields of the supplied entry from its template data.
+func (e *IMAEvent) decodeTemplateData() error {
+	switch e.TemplateName {
+	case "ima-ng", "ima-sig":
+	default:
+		return nil
+	}
+
+	fields, err := decodeIMATemplateFields(e.TemplateData)
+	if err != nil {
+		return fmt.Errorf("cannot decode template data: %v", err)
+	}
+	if len(fields) < 2 || (e.TemplateName == "ima-sig" && len(fields) < 3) {
+		return fmt.Errorf("too few fields for %s template", e.TemplateName)
+	}
+
+	alg, digest, err := decodeIMADigestNG(fields[0])
+	if err != nil {
+		return err
+	}
+	e.FileDigestAlgorithm = alg
+	e.FileDigest = digest
+	e.FileName = string(bytes.TrimRight(fields[1], "\x00"))
+	if e.TemplateName == "ima-sig" {
+		e.Signature = fields[2]
+	}
+	return nil
+}
+
+func readIMABinaryEvent(r io.Reader, digestSize int) (*IMAEvent, error) {
+	var pcr uint32
+	if err := binary.Read(r, binary.LittleEndian, &pcr); err != nil {
+		return nil, err
+	}
+	if !isPCRIndexInRange(PCRIndex(pcr)) {
+		return nil, wrapPCRIndexOutOfRangeError(PCRIndex(pcr))
+	}
+
+	e := &IMAEvent{PCRIndex: PCRIndex(pcr), TemplateDigest: make(Digest, digestSize)}
+	if _, err := io.ReadFull(r, e.TemplateDigest); err != nil {
+		return nil, err
+	}
+
+	var nameLen uint32
+	if err := binary.Read(r, binary.LittleEndian, &nameLen); err != nil {
+		return nil, err
+	}
+	if nameLen > imaTemplateNameLenMax {
+		return nil, fmt.Errorf("invalid template name length (%d)", nameLen)
+	}
+	name := make([]byte, nameLen)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, err
+	}
+	e.TemplateName = string(name)
+
+	if e.TemplateName == "ima" {
+		// The original template has no template data length, and the length of the digest field is omitted.
+		fileDigest := make([]byte, 20)
+		if _, err := io.ReadFull(r, fileDigest); err != nil {
+			return nil, err
+		}
+		var fileNameLen uint32
+		if err := binary.Read(r, binary.LittleEndian, &fileNameLen); err != nil {
+			return nil, err
+		}
+		if fileNameLen > imaEventNameLenMax {
+			return nil, fmt.Errorf("invalid file name length (%d)", fileNameLen)
+		}
+		fileName := make([]byte, fileNameLen)
+		if _, err := io.ReadFull(r, fileName); err != nil {
+			return nil, err
+		}
+		e.FileDigestAlgorithm = "sha1"
+		e.FileDigest = fileDigest
+		e.FileName = string(fileName)
+		e.TemplateData = imaLegacyTemplateData(fileDigest, e.FileName)
+		return e, nil
+	}
+
+	var dataLen uint32
+	if err := binary.Read(r, binary.LittleEndian, &dataLen); err != nil {
+		return nil, err
+	}
+	if dataLen > imaTemplateDataLenMax {
+		return nil, fmt.Errorf("invalid template data length (%d)", dataLen)
+	}
+	e.TemplateData = make([]byte, dataLen)
+	if _, err := io.ReadFull(r, e.TemplateData); err != nil {
+		return nil, err
+	}
+
+	if err := e.decodeTemplateData(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func parseIMAASCIIEvent(line string, digestSize int) (*IMAEvent, error) {
+	// The PCR index is right-aligned to 2 characters.
+	fields := strings.SplitN(strings.TrimLeft(line, " "), " ", 4)
+	if len(fields) < 4 {
+		return nil, errors.New("too few fields")
+	}
+
+	pcr, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PCR index: %v", err)
+	}
+	if !isPCRIndexInRange(PCRIndex(pcr)) {
+		return nil, wrapPCRIndexOutOfRangeError(PCRIndex(pcr))
+	}
+
+	e := &IMAEvent{PCRIndex: PCRIndex(pcr), TemplateName: fields[2]}
+	e.TemplateDigest, err = hex.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid template digest: %v", err)
+	}
+	if len(e.TemplateDigest) != digestSize {
+		return nil, fmt.Errorf("invalid template digest length (%d)", len(e.TemplateDigest))
+	}
+
+	rest := fields[3]
+	var digestField string
+	if i := strings.IndexByte(rest, ' '); i >= 0 {
+		digestField, rest = rest[:i], rest[i+1:]
+	} else {
+		digestField, rest = rest, ""
+	}
+
+	switch e.TemplateName {
+	case "ima":
+		e.FileDigestAlgorithm = "sha1"
+		e.FileDigest, err = hex.DecodeString(digestField)
+		if err != nil || len(e.FileDigest) != 20 {
+			return nil, errors.New("invalid file digest")
+		}
+		e.FileName = rest
+		e.TemplateData = imaLegacyTemplateData(e.FileDigest, e.FileName)
+		return e, nil
+	case "ima-ng", "ima-sig":
+		i := strings.IndexByte(digestField, ':')
+		if i < 1 {
+			return nil, errors.New("invalid file digest")
+		}
+		e.FileDigestAlgorithm = digestField[:i]
+		e.FileDigest, err = hex.DecodeString(digestField[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid file digest: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported template \"%s\"", e.TemplateName)
+	}
+
+	e.FileName = rest
+	if e.TemplateName == "ima-sig" {
+		// The file name may contain spaces, but the signature is always the last field. It is empty if the file
+		// isn't signed, in which case the line ends with a space.
+		i := strings.LastIndexByte(rest, ' ')
+		if i < 0 {
+			return nil, errors.New("missing signature field")
+		}
+		e.FileName = rest[:i]
+		e.Signature, err = hex.DecodeString(rest[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature: %v", err)
+		}
+	}
+
+	// Reconstruct the template data from the fields so that the template digest can be computed.
+	digestNG := append([]byte(e.FileDigestAlgorithm+":\x00"), e.FileDigest...)
+	e.TemplateData = appendIMAField(nil, digestNG)
+	e.TemplateData = appendIMAField(e.TemplateData, append([]byte(e.FileName), 0))
+	if e.TemplateName == "ima-sig" {
+		e.TemplateData = appendIMAField(e.TemplateData, e.Signature)
+	}
+	return e, nil
+}
+
+// ReadIMALog reads a Linux IMA runtime measurement list in the specified format. The alg argument specifies the
+// algorithm of the template digests recorded in the list, which is SHA-1 for binary_runtime_measurements and
+// ascii_runtime_measurements, or the algorithm in the suffix of the per-bank lists on newer kernels (eg,
+// binary_runtime_measurements_sha256). Binary lists are expected to be in little-endian (canonical) format.
+//
+// Entries with any template can be read from a binary list, but only the ima, ima-ng and ima-sig templates are
+// supported for ASCII lists, as the template data has to be reconstructed from the fields.
+//
+// https://www.kernel.org/doc/html/latest/security/IMA-templates.html
+func ReadIMALog(r io.Reader, format IMALogFormat, alg AlgorithmId) ([]*IMAEvent, error) {
+	if !alg.supported() {
+		return nil, fmt.Errorf("unsupported algorithm %s", alg)
+	}
+
+	var events []*IMAEvent
+
+	switch format {
+	case IMALogFormatBinary:
+		br := bufio.NewReader(r)
+		for {
+			if _, err := br.Peek(1); err == io.EOF {
+				return events, nil
+			}
+			e, err := readIMABinaryEvent(br, alg.size())
+			if err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, fmt.Errorf("cannot read entry %d: %v", len(events), err)
+			}
+			events = append(events, e)
+		}
+	case IMALogFormatASCII:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, 2*imaTemplateDataLenMax)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				continue
+			}
+			e, err := parseIMAASCIIEvent(line, alg.size())
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse entry %d: %v", len(events), err)
+			}
+			events = append(events, e)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return events, nil
+	default:
+		return nil, fmt.Errorf("invalid IMA log format %d", format)
+	}
+}
+
+// IMAValidateResult is the result of ReplayAndValidateIMALog.
+type IMAValidateResult struct {
+	ExpectedPCRValues        PCRValues   // The PCR values that result from replaying the list
+	IncorrectTemplateDigests []*IMAEvent // Entries with a template digest that isn't generated from the template data
+}
+
+// ReplayAndValidateIMALog replays the supplied IMA runtime measurement list for the specified algorithms, and checks
+// that the template digest of each entry is consistent with its template data. The logAlg argument specifies the
+// algorithm of the template digests recorded in the list. The PCRs measured by IMA are assumed to start from zero.
+func ReplayAndValidateIMALog(events []*IMAEvent, logAlg AlgorithmId, algorithms AlgorithmIdList) *IMAValidateResult {
+	result := &IMAValidateResult{ExpectedPCRValues: make(PCRValues)}
+	table := sortedAlgorithmTable(algorithms)
+
+	for _, e := range events {
+		if !e.IsViolation() && !bytes.Equal(e.ComputeTemplateDigest(logAlg), e.TemplateDigest) {
+			result.IncorrectTemplateDigests = append(result.IncorrectTemplateDigests, e)
+		}
+
+		digests := newEventDigests(table)
+		for _, alg := range algorithms {
+			if alg == logAlg && !e.IsViolation() {
+				digests.Set(alg, e.TemplateDigest)
+			} else {
+				digests.Set(alg, e.ComputeTemplateDigest(alg))
+			}
+		}
+		extendPCRValues(result.ExpectedPCRValues, e.PCRIndex, algorithms, digests)
+	}
+
+	return result
+}
+
+// BootAggregate replays the remaining events in log and computes the boot_aggregate digest for the specified
+// algorithm, in the same way that the Linux IMA subsystem does when it creates the first entry in its measurement
+// list. The boot_aggregate is the digest of the concatenation of the values of PCRs 0-7. For algorithms other than
+// SHA-1, the values of PCRs 8 and 9 are also included, matching the behaviour of newer kernels. The initial value of
+// PCR 0 depends on the startup sequence recorded in the log, and is determined in the same way as it is by
+// ReplayAndValidateLog.
+//
+// The log should not have been advanced before calling this, else the result will be incorrect.
+//
+// See ima_calc_boot_aggregate in security/integrity/ima/ima_crypto.c in the Linux kernel source.
+func BootAggregate(log *Log, alg AlgorithmId) (Digest, error) {
+	if !log.Algorithms.Contains(alg) {
+		return nil, fmt.Errorf("log doesn't contain entries for the %s digest algorithm", alg)
+	}
+
+	pcrValues := make(map[PCRIndex]Digest)
+	for i := PCRIndex(0); i < 10; i++ {
+		pcrValues[i] = make(Digest, alg.size())
+	}
+
+	var startup pcr0Startup
+	for {
+		event, err := log.NextEvent()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		if locality, replay, reinitialize := startup.process(event); reinitialize {
+			pcrValues[0] = initialPCRValue(alg, 0, locality)
+			for _, e := range replay {
+				pcrValues[0] = performHashExtendOperation(alg, pcrValues[0], e.Digests.Get(alg))
+			}
+		}
+		if !doesEventTypeExtendPCR(event.EventType) {
+			continue
+		}
+		if _, ok := pcrValues[event.PCRIndex]; !ok {
+			continue
+		}
+
+		pcrValues[event.PCRIndex] = performHashExtendOperation(alg, pcrValues[event.PCRIndex],
+			event.Digests.Get(alg))
+	}
+
+	return computeBootAggregate(alg, pcrValues), nil
+}
+
+func computeBootAggregate(alg AlgorithmId, pcrValues map[PCRIndex]Digest) Digest {
+	lastPCR := PCRIndex(7)
+	if alg != AlgorithmSha1 {
+		lastPCR = 9
+	}
+
+	h := alg.newHash()
+	for i := PCRIndex(0); i <= lastPCR; i++ {
+		h.Write(pcrValues[i])
+	}
+	return h.Sum(nil)
+}
+
+// IMABootAggregateMismatchError is returned from CheckIMABootAggregate when the boot_aggregate entry of an IMA
+// runtime measurement list doesn't match the firmware log.
+type IMABootAggregateMismatchError struct {
+	Algorithm AlgorithmId
+	Expected  Digest // The boot_aggregate computed from the firmware log
+	Actual    Digest // The boot_aggregate recorded in the IMA runtime measurement list
+}
+
+func (e *IMABootAggregateMismatchError) Error() string {
+	return fmt.Sprintf("boot_aggregate entry is not consistent with the log (%s digest: %x, expected from log: %x)",
+		e.Algorithm, e.Actual, e.Expected)
+}
+
+// CheckIMABootAggregate checks that the boot_aggregate entry at the start of the supplied IMA runtime measurement list
+// is consistent with the supplied firmware log, by computing the boot_aggregate from the log with BootAggregate for
+// the algorithm of the entry. If it isn't consistent, an *IMABootAggregateMismatchError is returned. Note that this
+// advances the Log instance to the end of the log.
+func CheckIMABootAggregate(events []*IMAEvent, log *Log) error {
+	if len(events) == 0 || events[0].FileName != "boot_aggregate" {
+		return errors.New("list doesn't begin with a boot_aggregate entry")
+	}
+	e := events[0]
+	alg, err := ParseAlgorithm(e.FileDigestAlgorithm)
+	if err != nil {
+		return fmt.Errorf("cannot determine boot_aggregate algorithm: %v", err)
+	}
+
+	expected, err := BootAggregate(log, alg)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(expected, e.FileDigest) {
+		return &IMABootAggregateMismatchError{Algorithm: alg, Expected: expected, Actual: e.FileDigest}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func makeTestIMANGEntry(name string, fileDigest []byte, sig []byte) (templateName string, templateData []byte) {
+	templateName = "ima-ng"
+	templateData = appendIMAField(nil, append([]byte("sha256:\x00"), fileDigest...))
+	templateData = appendIMAField(templateData, append([]byte(name), 0))
+	if sig != nil {
+		templateName = "ima-sig"
+		templateData = appendIMAField(templateData, sig)
+	}
+	return
+}
+
+func writeTestIMABinaryEntry(buf *bytes.Buffer, templateDigest []byte, templateName string, templateData []byte) {
+	binary.Write(buf, binary.LittleEndian, uint32(10))
+	buf.Write(templateDigest)
+	binary.Write(buf, binary.LittleEndian, uint32(len(templateName)))
+	buf.WriteString(templateName)
+	binary.Write(buf, binary.LittleEndian, uint32(len(templateData)))
+	buf.Write(templateData)
+}
+
+func TestReadIMALogBinary(t *testing.T) {
+	fileDigest := AlgorithmSha256.hash([]byte("foo"))
+	name1, data1 := makeTestIMANGEntry("/usr/bin/foo", fileDigest, nil)
+	name2, data2 := makeTestIMANGEntry("/usr/bin/bar", fileDigest, []byte{0x03, 0x02, 0x01})
+
+	var buf bytes.Buffer
+	writeTestIMABinaryEntry(&buf, AlgorithmSha1.hash(data1), name1, data1)
+	writeTestIMABinaryEntry(&buf, AlgorithmSha1.hash(data2), name2, data2)
+	writeTestIMABinaryEntry(&buf, make([]byte, 20), name1, data1)
+
+	events, err := ReadIMALog(&buf, IMALogFormatBinary, AlgorithmSha1)
+	if err != nil {
+		t.Fatalf("ReadIMALog failed: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Unexpected number of events: %d", len(events))
+	}
+	if events[0].TemplateName != "ima-ng" || events[0].FileName != "/usr/bin/foo" ||
+		events[0].FileDigestAlgorithm != "sha256" || !bytes.Equal(events[0].FileDigest, fileDigest) {
+		t.Errorf("Unexpected event: %s", events[0])
+	}
+	if events[1].TemplateName != "ima-sig" || !bytes.Equal(events[1].Signature, []byte{0x03, 0x02, 0x01}) {
+		t.Errorf("Unexpected event: %s", events[1])
+	}
+	if events[0].IsViolation() || !events[2].IsViolation() {
+		t.Errorf("Unexpected violation status")
+	}
+
+	result := ReplayAndValidateIMALog(events, AlgorithmSha1, AlgorithmIdList{AlgorithmSha1, AlgorithmSha256})
+	if len(result.IncorrectTemplateDigests) != 0 {
+		t.Errorf("Unexpected incorrect template digests")
+	}
+
+	expected := make(Digest, 32)
+	expected = performHashExtendOperation(AlgorithmSha256, expected, AlgorithmSha256.hash(data1))
+	expected = performHashExtendOperation(AlgorithmSha256, expected, AlgorithmSha256.hash(data2))
+	expected = performHashExtendOperation(AlgorithmSha256, expected, bytes.Repeat([]byte{0xff}, 32))
+	if !bytes.Equal(result.ExpectedPCRValues[10][AlgorithmSha256], expected) {
+		t.Errorf("Unexpected PCR 10 value: %x", result.ExpectedPCRValues[10][AlgorithmSha256])
+	}
+}
+
+func TestReadIMALogASCII(t *testing.T) {
+	fileDigest := AlgorithmSha256.hash([]byte("foo"))
+	_, data1 := makeTestIMANGEntry("/usr/bin/foo bar", fileDigest, nil)
+	_, data2 := makeTestIMANGEntry("/usr/bin/baz", fileDigest, []byte{})
+	legacyDigest := AlgorithmSha1.hash([]byte("bar"))
+	data3 := imaLegacyTemplateData(legacyDigest, "boot_aggregate")
+
+	var log strings.Builder
+	fmt.Fprintf(&log, "10 %x ima-ng sha256:%x /usr/bin/foo bar\n", AlgorithmSha1.hash(data1), fileDigest)
+	fmt.Fprintf(&log, "10 %x ima-sig sha256:%x /usr/bin/baz \n", AlgorithmSha1.hash(data2), fileDigest)
+	fmt.Fprintf(&log, "10 %x ima %x boot_aggregate\n", AlgorithmSha1.hash(data3), legacyDigest)
+
+	events, err := ReadIMALog(strings.NewReader(log.String()), IMALogFormatASCII, AlgorithmSha1)
+	if err != nil {
+		t.Fatalf("ReadIMALog failed: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Unexpected number of events: %d", len(events))
+	}
+	if events[0].FileName != "/usr/bin/foo bar" || events[1].FileName != "/usr/bin/baz" ||
+		events[2].FileName != "boot_aggregate" {
+		t.Errorf("Unexpected file names")
+	}
+
+	result := ReplayAndValidateIMALog(events, AlgorithmSha1, AlgorithmIdList{AlgorithmSha1})
+	if len(result.IncorrectTemplateDigests) != 0 {
+		t.Errorf("Unexpected incorrect template digests: %v", result.IncorrectTemplateDigests)
+	}
+}
+
+func TestReplayAndValidateIMALogIncorrectDigest(t *testing.T) {
+	digest, _ := hex.DecodeString("0102030405060708090a0b0c0d0e0f1011121314")
+	_, data := makeTestIMANGEntry("/usr/bin/foo", AlgorithmSha256.hash([]byte("foo")), nil)
+	events := []*IMAEvent{{PCRIndex: 10, TemplateDigest: digest, TemplateName: "ima-ng", TemplateData: data}}
+
+	result := ReplayAndValidateIMALog(events, AlgorithmSha1, AlgorithmIdList{AlgorithmSha1})
+	if len(result.IncorrectTemplateDigests) != 1 {
+		t.Errorf("Expected an incorrect template digest")
+	}
+	expected := performHashExtendOperation(AlgorithmSha1, make(Digest, 20), digest)
+	if !bytes.Equal(result.ExpectedPCRValues[10][AlgorithmSha1], expected) {
+		t.Errorf("Unexpected PCR 10 value: %x", result.ExpectedPCRValues[10][AlgorithmSha1])
+	}
+}
+
+var testBootAggregateAlgs = []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+
+func makeTestStartupLocalityEvent(locality uint8) testLogEvent {
+	return testLogEvent{pcrIndex: 0, eventType: EventTypeNoAction, digestCount: 2,
+		digests: []testLogDigest{{alg: AlgorithmSha1, digest: make(Digest, 20)},
+			{alg: AlgorithmSha256, digest: make(Digest, 32)}},
+		data: append([]byte("StartupLocality\x00"), locality)}
+}
+
+// makeTestBootAggregateLog creates a log containing the supplied PCR 0 events followed by events for PCRs 7-10. If
+// no PCR 0 events are supplied, it contains a single EV_S_CRTM_VERSION event.
+func makeTestBootAggregateLog(pcr0 ...testLogEvent) []byte {
+	if len(pcr0) == 0 {
+		pcr0 = append(pcr0, makeTestLogEvent(0, EventTypeSCRTMVersion, []byte("1.0"), testBootAggregateAlgs...))
+	}
+	events := append(pcr0,
+		makeTestLogEvent(7, EventTypeSeparator, []byte{0, 0, 0, 0}, testBootAggregateAlgs...),
+		makeTestLogEvent(8, EventTypeIPL, []byte("grub"), testBootAggregateAlgs...),
+		makeTestLogEvent(9, EventTypeIPL, []byte("kernel"), testBootAggregateAlgs...),
+		makeTestLogEvent(10, EventTypeIPL, []byte("ima"), testBootAggregateAlgs...))
+	return makeTestLog_2(testBootAggregateAlgs, events)
+}
+
+func TestBootAggregate(t *testing.T) {
+	// The expected values were computed independently, in the same way as ima_calc_boot_aggregate: the SHA-1
+	// boot_aggregate covers PCRs 0-7, and the boot_aggregate for other algorithms covers PCRs 0-9. PCR 0 is
+	// initialized with its last byte set to the startup locality, which is 4 for a H-CRTM sequence.
+	scrtm := makeTestLogEvent(0, EventTypeSCRTMVersion, []byte("1.0"), testBootAggregateAlgs...)
+	hcrtm := makeTestLogEvent(0, EventTypeEFIHCRTMEvent, []byte("HCRTM"), testBootAggregateAlgs...)
+
+	for _, data := range []struct {
+		desc     string
+		alg      AlgorithmId
+		pcr0     []testLogEvent
+		expected string
+	}{
+		{desc: "SHA1", alg: AlgorithmSha1, expected: "1f5a7aaa145d04b624c356feb3a199d91c5d733d"},
+		{desc: "SHA256", alg: AlgorithmSha256,
+			expected: "887b3d6b918dd0a2b50ff761731cd4b78667ccbca9116d8d443349a9175d0454"},
+		{desc: "SHA256Locality3", alg: AlgorithmSha256,
+			pcr0:     []testLogEvent{makeTestStartupLocalityEvent(3), scrtm},
+			expected: "aeb3bc3ede541449cb5ca1b98e9bbcbc8a729cc31f0586b3e7faf0906e1fc3d9"},
+		{desc: "SHA256LateLocality", alg: AlgorithmSha256,
+			pcr0:     []testLogEvent{scrtm, makeTestStartupLocalityEvent(3)},
+			expected: "887b3d6b918dd0a2b50ff761731cd4b78667ccbca9116d8d443349a9175d0454"},
+		{desc: "SHA256HCRTM", alg: AlgorithmSha256, pcr0: []testLogEvent{hcrtm, scrtm},
+			expected: "1475613a1851fc3b62ca86b891a403b9f84936a7f60d74c5bf503b032106b43d"},
+		{desc: "SHA256HCRTMLocality4", alg: AlgorithmSha256,
+			pcr0:     []testLogEvent{hcrtm, makeTestStartupLocalityEvent(4), scrtm},
+			expected: "1475613a1851fc3b62ca86b891a403b9f84936a7f60d74c5bf503b032106b43d"},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			log, err := NewLog(bytes.NewReader(makeTestBootAggregateLog(data.pcr0...)), LogOptions{})
+			if err != nil {
+				t.Fatalf("NewLog failed: %v", err)
+			}
+			digest, err := BootAggregate(log, data.alg)
+			if err != nil {
+				t.Fatalf("BootAggregate failed: %v", err)
+			}
+			if hex.EncodeToString(digest) != data.expected {
+				t.Errorf("Unexpected boot_aggregate: %x", digest)
+			}
+		})
+	}
+
+	log, err := NewLog(bytes.NewReader(makeTestBootAggregateLog()), LogOptions{})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	if _, err := BootAggregate(log, AlgorithmSha384); err == nil {
+		t.Errorf("BootAggregate should fail for an algorithm that isn't in the log")
+	}
+}
+
+func TestCheckIMABootAggregate(t *testing.T) {
+	aggregate, _ := hex.DecodeString("887b3d6b918dd0a2b50ff761731cd4b78667ccbca9116d8d443349a9175d0454")
+	makeEvents := func(digest Digest) []*IMAEvent {
+		return []*IMAEvent{{PCRIndex: 10, TemplateName: "ima-ng", FileDigestAlgorithm: "sha256", FileDigest: digest,
+			FileName: "boot_aggregate"}}
+	}
+
+	for _, data := range []struct {
+		desc     string
+		events   []*IMAEvent
+		mismatch bool
+		fails    bool
+	}{
+		{desc: "Match", events: makeEvents(aggregate)},
+		{desc: "Mismatch", events: makeEvents(make(Digest, 32)), mismatch: true, fails: true},
+		{desc: "Missing", events: []*IMAEvent{{PCRIndex: 10, FileName: "/usr/bin/foo"}}, fails: true},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			log, err := NewLog(bytes.NewReader(makeTestBootAggregateLog()), LogOptions{})
+			if err != nil {
+				t.Fatalf("NewLog failed: %v", err)
+			}
+			err = CheckIMABootAggregate(data.events, log)
+			if (err != nil) != data.fails {
+				t.Fatalf("Unexpected result: %v", err)
+			}
+			mismatch, isMismatch := err.(*IMABootAggregateMismatchError)
+			if isMismatch != data.mismatch {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if isMismatch && !bytes.Equal(mismatch.Expected, aggregate) {
+				t.Errorf("Unexpected expected value: %x", mismatch.Expected)
+			}
+		})
+	}
+}
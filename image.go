@@ -0,0 +1,61 @@
+package tcglog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ImageDigester is implemented by types that can compute the digest of a PE/COFF image in the same way that firmware
+// does when measuring it (the Authenticode digest), for use when verifying image load events. This allows an external
+// implementation (eg, a FIPS validated one) to be used.
+type ImageDigester interface {
+	DigestImage(r io.ReaderAt, size int64, alg AlgorithmId) (Digest, error)
+}
+
+// ImageDigesterFunc allows an ordinary function to be used as an ImageDigester.
+type ImageDigesterFunc func(r io.ReaderAt, size int64, alg AlgorithmId) (Digest, error)
+
+func (f ImageDigesterFunc) DigestImage(r io.ReaderAt, size int64, alg AlgorithmId) (Digest, error) {
+	return f(r, size, alg)
+}
+
+func isImageLoadEventType(t EventType) bool {
+	switch t {
+	case EventTypeEFIBootServicesApplication, EventTypeEFIBootServicesDriver, EventTypeEFIRuntimeServicesDriver:
+		return true
+	default:
+		return false
+	}
+}
+
+// VerifyImageLoadEvent checks that the digests recorded for an EV_EFI_BOOT_SERVICES_APPLICATION,
+// EV_EFI_BOOT_SERVICES_DRIVER or EV_EFI_RUNTIME_SERVICES_DRIVER event correspond to the supplied image, using the
+// supplied ImageDigester to compute the expected digests. The returned slice contains an entry for each digest that
+// doesn't match the image, and will be empty if the image is the one that was measured.
+func VerifyImageLoadEvent(event *Event, image io.ReaderAt, size int64, digester ImageDigester) ([]IncorrectDigestValue, error) {
+	if !isImageLoadEventType(event.EventType) {
+		return nil, fmt.Errorf("unexpected event type (%s)", event.EventType)
+	}
+	if digester == nil {
+		return nil, errors.New("no image digester supplied")
+	}
+
+	var incorrect []IncorrectDigestValue
+	for _, alg := range event.Digests.Algorithms() {
+		digest := event.Digests.Get(alg)
+		expected, err := digester.DigestImage(image, size, alg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compute %s digest of image: %v", alg, err)
+		}
+		if len(expected) != alg.size() {
+			return nil, fmt.Errorf("image digester returned a digest with an invalid length for %s", alg)
+		}
+		if !bytes.Equal(digest, expected) {
+			incorrect = append(incorrect, IncorrectDigestValue{Algorithm: alg, Expected: expected})
+		}
+	}
+
+	return incorrect, nil
+}
@@ -0,0 +1,78 @@
+package tcglog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestVerifyImageLoadEvent(t *testing.T) {
+	image := []byte("shim")
+	digester := ImageDigesterFunc(func(r io.ReaderAt, size int64, alg AlgorithmId) (Digest, error) {
+		data := make([]byte, size)
+		if _, err := r.ReadAt(data, 0); err != nil {
+			return nil, err
+		}
+		return alg.hash(append([]byte("authenticode:"), data...)), nil
+	})
+	makeEvent := func(eventType EventType, sha1Data, sha256Data string) *Event {
+		return &Event{EventType: eventType, Digests: NewEventDigests(DigestMap{
+			AlgorithmSha1:   AlgorithmSha1.hash([]byte(sha1Data)),
+			AlgorithmSha256: AlgorithmSha256.hash([]byte(sha256Data))})}
+	}
+
+	t.Run("Match", func(t *testing.T) {
+		for _, eventType := range []EventType{EventTypeEFIBootServicesApplication, EventTypeEFIBootServicesDriver,
+			EventTypeEFIRuntimeServicesDriver} {
+			event := makeEvent(eventType, "authenticode:shim", "authenticode:shim")
+			incorrect, err := VerifyImageLoadEvent(event, bytes.NewReader(image), int64(len(image)), digester)
+			if err != nil {
+				t.Fatalf("VerifyImageLoadEvent failed for %s: %v", eventType, err)
+			}
+			if len(incorrect) != 0 {
+				t.Errorf("Unexpected incorrect digests for %s: %v", eventType, incorrect)
+			}
+		}
+	})
+
+	t.Run("IncorrectDigestValue", func(t *testing.T) {
+		event := makeEvent(EventTypeEFIBootServicesApplication, "authenticode:shim", "authenticode:grub")
+		incorrect, err := VerifyImageLoadEvent(event, bytes.NewReader(image), int64(len(image)), digester)
+		if err != nil {
+			t.Fatalf("VerifyImageLoadEvent failed: %v", err)
+		}
+		if len(incorrect) != 1 {
+			t.Fatalf("Unexpected number of incorrect digests: %d", len(incorrect))
+		}
+		if incorrect[0].Algorithm != AlgorithmSha256 ||
+			!bytes.Equal(incorrect[0].Expected, AlgorithmSha256.hash([]byte("authenticode:shim"))) {
+			t.Errorf("Unexpected incorrect digest: %+v", incorrect[0])
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		event := makeEvent(EventTypeEFIBootServicesApplication, "authenticode:shim", "authenticode:shim")
+		for _, data := range []struct {
+			desc     string
+			event    *Event
+			digester ImageDigester
+		}{
+			{desc: "WrongEventType", event: makeEvent(EventTypeEFIAction, "", ""), digester: digester},
+			{desc: "NoDigester", event: event},
+			{desc: "DigesterError", event: event, digester: ImageDigesterFunc(
+				func(r io.ReaderAt, size int64, alg AlgorithmId) (Digest, error) {
+					return nil, errors.New("invalid image")
+				})},
+			{desc: "InvalidLength", event: event, digester: ImageDigesterFunc(
+				func(r io.ReaderAt, size int64, alg AlgorithmId) (Digest, error) {
+					return Digest{1, 2, 3}, nil
+				})},
+		} {
+			if _, err := VerifyImageLoadEvent(data.event, bytes.NewReader(image), int64(len(image)),
+				data.digester); err == nil {
+				t.Errorf("VerifyImageLoadEvent should have failed (%s)", data.desc)
+			}
+		}
+	})
+}
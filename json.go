@@ -0,0 +1,504 @@
+package tcglog
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// jsonHexBytes is used to encode binary fields of event data as hex strings.
+type jsonHexBytes []byte
+
+func (b jsonHexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(b))
+}
+
+// MarshalJSON encodes this digest as a hex string.
+func (d Digest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(d))
+}
+
+// UnmarshalJSON decodes a digest from a hex string.
+func (d *Digest) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("invalid digest: %v", err)
+	}
+	*d = b
+	return nil
+}
+
+// MarshalJSON encodes these digests as an object with a hex encoded digest for each algorithm (eg,
+// {"sha256":"..."}).
+func (d EventDigests) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Map())
+}
+
+// UnmarshalJSON decodes digests from an object with a hex encoded digest for each algorithm.
+func (d *EventDigests) UnmarshalJSON(data []byte) error {
+	var m DigestMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*d = NewEventDigests(m)
+	return nil
+}
+
+// MarshalText encodes this algorithm as its lower case name (eg, "sha256"), which allows it to be used as a JSON
+// object key.
+func (a AlgorithmId) MarshalText() ([]byte, error) {
+	return []byte(celAlgorithmName(a)), nil
+}
+
+// UnmarshalText decodes an algorithm from its lower case name or its numeric value.
+func (a *AlgorithmId) UnmarshalText(data []byte) error {
+	alg, err := celAlgorithmFromName(string(data))
+	if err != nil {
+		return err
+	}
+	*a = alg
+	return nil
+}
+
+// MarshalText encodes this event type as its name (eg, "EV_EFI_ACTION"), or its numeric value if it is not a known
+// event type.
+func (e EventType) MarshalText() ([]byte, error) {
+	for _, t := range knownEventTypes {
+		if t == e {
+			return []byte(e.String()), nil
+		}
+	}
+	return []byte(fmt.Sprintf("0x%08x", uint32(e))), nil
+}
+
+// UnmarshalText decodes an event type from its name or numeric value.
+func (e *EventType) UnmarshalText(data []byte) error {
+	t, err := ParseEventType(string(data))
+	if err != nil {
+		return err
+	}
+	*e = t
+	return nil
+}
+
+// MarshalText encodes this kind of finding as its code (eg, "TRAILING_MEASURED_BYTES").
+func (k FindingKind) MarshalText() ([]byte, error) {
+	return []byte(k.Code()), nil
+}
+
+// UnmarshalText decodes a kind of finding from its code.
+func (k *FindingKind) UnmarshalText(data []byte) error {
+	kind, err := ParseFindingCode(string(data))
+	if err != nil {
+		return err
+	}
+	*k = kind
+	return nil
+}
+
+var knownEventQuirks = [...]EventQuirk{
+	EventQuirkDigestCountMismatch,
+	EventQuirkTrailingPadding,
+	EventQuirkDuplicateDigest,
+	EventQuirkUnexpectedDigestAlgorithm,
+	EventQuirkInconsistentInternalLengths,
+	EventQuirkPrecededByGap,
+	EventQuirkUnexpectedSpecIdEvent,
+}
+
+// MarshalText encodes this quirk as its description.
+func (q EventQuirk) MarshalText() ([]byte, error) {
+	return []byte(q.String()), nil
+}
+
+// UnmarshalText decodes a quirk from its description.
+func (q *EventQuirk) UnmarshalText(data []byte) error {
+	for _, k := range knownEventQuirks {
+		if k.String() == string(data) {
+			*q = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unrecognized quirk \"%s\"", data)
+}
+
+// MarshalJSON encodes this GUID in its textual form without braces (eg, "8be4df61-93ca-11d2-aa0d-00e098032b8c").
+func (g EFIGUID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strings.Trim(g.String(), "{}"))
+}
+
+// UnmarshalJSON decodes a GUID from its textual form, with or without braces.
+func (g *EFIGUID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	guid, err := parseEFIGUID(s)
+	if err != nil {
+		return err
+	}
+	*g = guid
+	return nil
+}
+
+func (e *BrokenEventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Error string `json:"error"`
+	}{e.Error.Error()})
+}
+
+func (e *opaqueEventData) MarshalJSON() ([]byte, error) {
+	return []byte("{}"), nil
+}
+
+func (e *unknownNoActionEventData) MarshalJSON() ([]byte, error) {
+	return []byte("{}"), nil
+}
+
+func (e *VendorNoActionEventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Signature  jsonHexBytes `json:"signature"`
+		VendorData jsonHexBytes `json:"vendorData"`
+	}{e.Signature[:], e.VendorData})
+}
+
+func (e *asciiStringEventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Str string `json:"str"`
+	}{e.String()})
+}
+
+func (e *separatorEventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		IsError bool `json:"isError"`
+	}{e.isError})
+}
+
+func (e *startupLocalityEventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Locality uint8 `json:"locality"`
+	}{e.Locality})
+}
+
+func (e *bimReferenceManifestEventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		VendorId uint32  `json:"vendorId"`
+		Guid     EFIGUID `json:"referenceManifestGuid"`
+	}{e.VendorId, e.Guid})
+}
+
+func (e *SpecIdEventData) MarshalJSON() ([]byte, error) {
+	type algSize struct {
+		Algorithm  AlgorithmId `json:"algorithm"`
+		DigestSize uint16      `json:"digestSize"`
+	}
+	out := struct {
+		Spec             Spec         `json:"spec"`
+		PlatformClass    uint32       `json:"platformClass"`
+		SpecVersionMinor uint8        `json:"specVersionMinor"`
+		SpecVersionMajor uint8        `json:"specVersionMajor"`
+		SpecErrata       uint8        `json:"specErrata"`
+		UintnSize        uint8        `json:"uintnSize"`
+		DigestSizes      []algSize    `json:"digestSizes"`
+		VendorInfo       jsonHexBytes `json:"vendorInfo"`
+	}{
+		Spec:             e.Spec,
+		PlatformClass:    e.PlatformClass,
+		SpecVersionMinor: e.SpecVersionMinor,
+		SpecVersionMajor: e.SpecVersionMajor,
+		SpecErrata:       e.SpecErrata,
+		UintnSize:        e.UintnSize,
+		DigestSizes:      []algSize{},
+		VendorInfo:       e.VendorInfo}
+	for _, s := range e.DigestSizes {
+		out.DigestSizes = append(out.DigestSizes, algSize{s.AlgorithmId, s.DigestSize})
+	}
+	return json.Marshal(out)
+}
+
+func (e *SCRTMVersionEventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Version string   `json:"version,omitempty"`
+		GUID    *EFIGUID `json:"guid,omitempty"`
+	}{e.Version, e.GUID})
+}
+
+func (e *EFIVariableEventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		VariableName EFIGUID      `json:"variableName"`
+		UnicodeName  string       `json:"unicodeName"`
+		VariableData jsonHexBytes `json:"variableData"`
+	}{e.VariableName, e.UnicodeName, e.VariableData})
+}
+
+func (e *efiImageLoadEventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		LocationInMemory uint64 `json:"locationInMemory"`
+		LengthInMemory   uint64 `json:"lengthInMemory"`
+		LinkTimeAddress  uint64 `json:"linkTimeAddress"`
+		DevicePath       string `json:"devicePath"`
+	}{e.locationInMemory, e.lengthInMemory, e.linkTimeAddress, e.path.String()})
+}
+
+func (e *EFIGPTEventData) MarshalJSON() ([]byte, error) {
+	type partition struct {
+		PartitionTypeGUID   EFIGUID `json:"partitionTypeGuid"`
+		UniquePartitionGUID EFIGUID `json:"uniquePartitionGuid"`
+		StartingLBA         uint64  `json:"startingLBA"`
+		EndingLBA           uint64  `json:"endingLBA"`
+		Attributes          uint64  `json:"attributes"`
+		PartitionName       string  `json:"partitionName"`
+	}
+	out := struct {
+		DiskGUID       EFIGUID     `json:"diskGuid"`
+		MyLBA          uint64      `json:"myLBA"`
+		AlternateLBA   uint64      `json:"alternateLBA"`
+		FirstUsableLBA uint64      `json:"firstUsableLBA"`
+		LastUsableLBA  uint64      `json:"lastUsableLBA"`
+		Partitions     []partition `json:"partitions"`
+	}{
+		DiskGUID:       e.DiskGUID,
+		MyLBA:          e.MyLBA,
+		AlternateLBA:   e.AlternateLBA,
+		FirstUsableLBA: e.FirstUsableLBA,
+		LastUsableLBA:  e.LastUsableLBA,
+		Partitions:     []partition{}}
+	for _, p := range e.Partitions {
+		out.Partitions = append(out.Partitions, partition(p))
+	}
+	return json.Marshal(out)
+}
+
+func (e *EFIPlatformFirmwareBlobEventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		BlobBase   uint64 `json:"blobBase"`
+		BlobLength uint64 `json:"blobLength"`
+	}{e.BlobBase, e.BlobLength})
+}
+
+func (e *EFIPlatformFirmwareBlob2EventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		BlobDescription string `json:"blobDescription"`
+		BlobBase        uint64 `json:"blobBase"`
+		BlobLength      uint64 `json:"blobLength"`
+	}{e.BlobDescription, e.BlobBase, e.BlobLength})
+}
+
+type jsonConfigurationTable struct {
+	VendorGUID  EFIGUID `json:"vendorGuid"`
+	VendorTable uint64  `json:"vendorTable"`
+}
+
+func makeJSONConfigurationTables(tables []EFIConfigurationTable) []jsonConfigurationTable {
+	out := []jsonConfigurationTable{}
+	for _, t := range tables {
+		out = append(out, jsonConfigurationTable(t))
+	}
+	return out
+}
+
+func (e *EFIHandoffTablesEventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Tables []jsonConfigurationTable `json:"tables"`
+	}{makeJSONConfigurationTables(e.Tables)})
+}
+
+func (e *EFIHandoffTables2EventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TableDescription string                   `json:"tableDescription"`
+		Tables           []jsonConfigurationTable `json:"tables"`
+	}{e.TableDescription, makeJSONConfigurationTables(e.Tables)})
+}
+
+func (e *GrubStringEventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Str  string `json:"str"`
+	}{grubEventTypeString(e.Type), e.Str})
+}
+
+func (e *SystemdEFIStubEventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Str string `json:"str"`
+	}{e.Str})
+}
+
+func (e *SIPAEvent) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Type     string       `json:"type"`
+		Data     jsonHexBytes `json:"data,omitempty"`
+		Value    string       `json:"value,omitempty"`
+		Children []*SIPAEvent `json:"children,omitempty"`
+	}{Type: e.Type.String()}
+	if e.Type.IsContainer() {
+		out.Children = e.Children
+	} else {
+		out.Data = e.Data
+		out.Value = e.valueString()
+	}
+	return json.Marshal(out)
+}
+
+func (e *SIPAEventData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Events []*SIPAEvent `json:"events"`
+	}{append([]*SIPAEvent{}, e.Events...)})
+}
+
+// eventDataJSONType returns the name used for the type of the supplied event data in JSON.
+func eventDataJSONType(data EventData) string {
+	switch data.(type) {
+	case *BrokenEventData:
+		return "broken"
+	case *asciiStringEventData:
+		return "string"
+	case *separatorEventData:
+		return "separator"
+	case *startupLocalityEventData:
+		return "StartupLocalityEvent"
+	case *bimReferenceManifestEventData:
+		return "SP800-155-Event"
+	case *unknownNoActionEventData:
+		return "NoActionEvent"
+	case *VendorNoActionEventData:
+		return "VendorNoActionEvent"
+	case *SpecIdEventData:
+		return "SpecIdEvent"
+	case *SCRTMVersionEventData:
+		return "S-CRTM-Version"
+	case *EFIVariableEventData:
+		return "UEFI_VARIABLE_DATA"
+	case *efiImageLoadEventData:
+		return "UEFI_IMAGE_LOAD_EVENT"
+	case *EFIGPTEventData:
+		return "UEFI_GPT_DATA"
+	case *EFIPlatformFirmwareBlobEventData:
+		return "UEFI_PLATFORM_FIRMWARE_BLOB"
+	case *EFIPlatformFirmwareBlob2EventData:
+		return "UEFI_PLATFORM_FIRMWARE_BLOB2"
+	case *EFIHandoffTablesEventData:
+		return "UEFI_HANDOFF_TABLE_POINTERS"
+	case *EFIHandoffTables2EventData:
+		return "UEFI_HANDOFF_TABLE_POINTERS2"
+	case *GrubStringEventData:
+		return "grub"
+	case *SystemdEFIStubEventData:
+		return "systemd-efi-stub"
+	case *SIPAEventData:
+		return "sipa"
+	default:
+		return "opaque"
+	}
+}
+
+type jsonTaggedDigest struct {
+	Algorithm AlgorithmId `json:"algorithm"`
+	Digest    Digest      `json:"digest"`
+}
+
+type jsonEvent struct {
+	Index      uint               `json:"index"`
+	PCR        PCRIndex           `json:"pcr"`
+	EventType  EventType          `json:"type"`
+	Digests    EventDigests       `json:"digests"`
+	RawDigests []jsonTaggedDigest `json:"rawDigests,omitempty"`
+	Quirks     []EventQuirk       `json:"quirks,omitempty"`
+	DataType   string             `json:"dataType,omitempty"`
+	Data       json.RawMessage    `json:"data,omitempty"`
+	RawData    *jsonHexBytes      `json:"rawData,omitempty"`
+}
+
+// MarshalJSON encodes this event as JSON. The encoding contains the decoded fields of the event data for
+// readability, as well as the raw event data so that the event can be decoded again with UnmarshalJSON. The quirks
+// include those detected when decoding the event data (see Event.HasQuirk).
+func (e *Event) MarshalJSON() ([]byte, error) {
+	out := jsonEvent{
+		Index:     e.Index,
+		PCR:       e.PCRIndex,
+		EventType: e.EventType,
+		Digests:   e.Digests,
+		Quirks:    e.Quirks}
+	if CheckInternalLengths(e) != nil {
+		out.Quirks = append(append([]EventQuirk(nil), e.Quirks...), EventQuirkInconsistentInternalLengths)
+	}
+	for _, d := range e.RawDigests {
+		out.RawDigests = append(out.RawDigests, jsonTaggedDigest{d.Algorithm, d.Digest})
+	}
+	if e.Data() != nil {
+		data, err := json.Marshal(e.Data())
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode event data: %v", err)
+		}
+		raw := jsonHexBytes(e.Data().Bytes())
+		out.DataType = eventDataJSONType(e.Data())
+		out.Data = data
+		out.RawData = &raw
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes an event from JSON produced by MarshalJSON. The event data is decoded from the raw event data
+// rather than from the decoded fields, using the same decoder that produced the original event.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var in struct {
+		jsonEvent
+		RawData *string `json:"rawData"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	*e = Event{
+		Index:     in.Index,
+		PCRIndex:  in.PCR,
+		EventType: in.EventType,
+		Digests:   in.Digests}
+	for _, q := range in.Quirks {
+		if q == EventQuirkInconsistentInternalLengths {
+			// This is detected again when the event data is decoded.
+			continue
+		}
+		e.Quirks = append(e.Quirks, q)
+	}
+	for _, d := range in.RawDigests {
+		e.RawDigests = append(e.RawDigests, TaggedDigest{d.Algorithm, d.Digest})
+	}
+
+	if in.RawData == nil {
+		return nil
+	}
+	rawData, err := hex.DecodeString(*in.RawData)
+	if err != nil {
+		return fmt.Errorf("invalid event data: %v", err)
+	}
+
+	var options LogOptions
+	switch in.DataType {
+	case "grub":
+		options.EnableGrub = true
+	case "systemd-efi-stub":
+		options.EnableSystemdEFIStub = true
+		options.SystemdEFIStubPCR = e.PCRIndex
+	case "sipa":
+		options.EnableWindowsSIPA = true
+	}
+
+	hasDigestOfSeparatorError := false
+	for _, alg := range e.Digests.Algorithms() {
+		if alg.supported() && isDigestOfSeparatorErrorValue(e.Digests.Get(alg), alg) {
+			hasDigestOfSeparatorError = true
+		}
+	}
+
+	e.lazy = newLazyEventData(e.PCRIndex, e.EventType, rawData, &options, hasDigestOfSeparatorError)
+	if dataType := eventDataJSONType(e.Data()); in.DataType != "" && dataType != in.DataType {
+		return errors.New("event data doesn't decode to the expected type (" + in.DataType + ")")
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package tcglog
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func makeTestJSONEvent(pcr PCRIndex, eventType EventType, data []byte, options *LogOptions) *Event {
+	h1 := sha1.Sum(data)
+	h256 := sha256.Sum256(data)
+	event := &Event{
+		Index:     3,
+		PCRIndex:  pcr,
+		EventType: eventType,
+		Digests:   NewEventDigests(DigestMap{AlgorithmSha1: h1[:], AlgorithmSha256: h256[:]})}
+	event.lazy = newLazyEventData(pcr, eventType, data, options, false)
+	return event
+}
+
+func TestEventJSONRoundTrip(t *testing.T) {
+	var grub bytes.Buffer
+	grub.WriteString("grub_cmd: linux /vmlinuz")
+	grub.WriteByte(0)
+
+	for _, data := range []struct {
+		desc     string
+		event    *Event
+		dataType string
+	}{
+		{
+			desc: "Variable",
+			event: makeTestJSONEvent(7, EventTypeEFIVariableDriverConfig,
+				makeTestVariableEventData(convertStringToUtf16("SecureBoot")), &LogOptions{}),
+			dataType: "UEFI_VARIABLE_DATA",
+		},
+		{
+			desc:     "Separator",
+			event:    makeTestJSONEvent(7, EventTypeSeparator, []byte{0, 0, 0, 0}, &LogOptions{}),
+			dataType: "separator",
+		},
+		{
+			desc:     "Grub",
+			event:    makeTestJSONEvent(8, EventTypeIPL, grub.Bytes(), &LogOptions{EnableGrub: true}),
+			dataType: "grub",
+		},
+		{
+			desc:     "Opaque",
+			event:    makeTestJSONEvent(4, EventType(0x1234), []byte{1, 2, 3}, &LogOptions{}),
+			dataType: "opaque",
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			data.event.Quirks = []EventQuirk{EventQuirkTrailingPadding}
+			b, err := json.Marshal(data.event)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+
+			var raw map[string]interface{}
+			if err := json.Unmarshal(b, &raw); err != nil {
+				t.Fatalf("Unmarshal to map failed: %v", err)
+			}
+			if raw["dataType"] != data.dataType {
+				t.Errorf("Unexpected dataType: %v", raw["dataType"])
+			}
+
+			var event Event
+			if err := json.Unmarshal(b, &event); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if !reflect.DeepEqual(&event, data.event) {
+				t.Errorf("Event didn't round trip:\n%+v\n%+v", &event, data.event)
+			}
+		})
+	}
+}
+
+func TestEventJSONSchema(t *testing.T) {
+	event := makeTestJSONEvent(7, EventTypeEFIVariableAuthority,
+		makeTestVariableEventData(convertStringToUtf16("db")), &LogOptions{})
+	b, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	s := string(b)
+	for _, expected := range []string{
+		"\"type\":\"EV_EFI_VARIABLE_AUTHORITY\"",
+		"\"sha256\":\"",
+		"\"variableName\":\"8be4df61-93ca-11d2-aa0d-00e098032b8c\"",
+		"\"unicodeName\":\"db\"",
+		"\"variableData\":\"01\"",
+	} {
+		if !strings.Contains(s, expected) {
+			t.Errorf("JSON doesn't contain %s: %s", expected, s)
+		}
+	}
+}
+
+func TestEventTypeRoundTrip(t *testing.T) {
+	for _, e := range knownEventTypes {
+		name := e.String()
+		// TXT event types use the EVTYPE_ prefix from the Intel TXT specification.
+		if !strings.HasPrefix(name, "EV_") && !strings.HasPrefix(name, "EVTYPE_") {
+			t.Errorf("Unexpected name for event type 0x%08x: %s", uint32(e), name)
+		}
+		parsed, err := ParseEventType(name)
+		if err != nil {
+			t.Errorf("ParseEventType failed for %s: %v", name, err)
+		} else if parsed != e {
+			t.Errorf("%s didn't round trip: 0x%08x", name, uint32(parsed))
+		}
+
+		b, err := json.Marshal(e)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if string(b) != "\""+name+"\"" {
+			t.Errorf("Unexpected JSON for %s: %s", name, b)
+		}
+		var out EventType
+		if err := json.Unmarshal(b, &out); err != nil {
+			t.Errorf("Unmarshal failed for %s: %v", name, err)
+		} else if out != e {
+			t.Errorf("%s didn't round trip through JSON: 0x%08x", name, uint32(out))
+		}
+	}
+
+	if EventTypeEFIGPTEvent.String() != "EV_EFI_GPT_EVENT" {
+		t.Errorf("Unexpected name: %s", EventTypeEFIGPTEvent)
+	}
+}
+
+func TestEventJSONSeparatorError(t *testing.T) {
+	var data [4]byte
+	binary.LittleEndian.PutUint32(data[:], 1)
+	event := makeTestJSONEvent(7, EventTypeSeparator, []byte("error"), &LogOptions{})
+	h := sha1.Sum(data[:])
+	h256 := sha256.Sum256(data[:])
+	event.Digests = NewEventDigests(DigestMap{AlgorithmSha1: h[:], AlgorithmSha256: h256[:]})
+	event.lazy = newLazyEventData(7, EventTypeSeparator, []byte("error"), &LogOptions{}, true)
+
+	b, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var out Event
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(out.Data(), event.Data()) {
+		t.Errorf("Unexpected event data: %+v", out.Data())
+	}
+}
+
+func TestEFIGUIDJSON(t *testing.T) {
+	for _, s := range []string{"\"8be4df61-93ca-11d2-aa0d-00e098032b8c\"", "\"{8be4df61-93ca-11d2-aa0d-00e098032b8c}\""} {
+		var guid EFIGUID
+		if err := json.Unmarshal([]byte(s), &guid); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		if guid != efiGlobalVariableGUID {
+			t.Errorf("Unexpected GUID: %s", &guid)
+		}
+	}
+
+	var guid EFIGUID
+	if err := json.Unmarshal([]byte("\"8be4df61\""), &guid); err == nil {
+		t.Errorf("Unmarshal should have failed")
+	}
+}
@@ -0,0 +1,101 @@
+package tcglog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// InternalLengthInconsistency describes an event where the length fields inside the event data structure don't
+// agree with the size of the event data. When the structure claims less data than is present, the remaining bytes are
+// reported as trailing bytes by the decoder and may or may not have been measured. When the structure claims more
+// data than is present, the event data can't be decoded.
+type InternalLengthInconsistency struct {
+	Structure string   // The name of the event data structure, eg, "UEFI_VARIABLE_DATA"
+	Fields    []string // The length fields that were checked
+	Expected  uint64   // The event data size implied by the length fields, saturated at math.MaxUint64
+	Actual    uint64   // The actual size of the event data
+}
+
+func (i *InternalLengthInconsistency) String() string {
+	expected := fmt.Sprintf("%d", i.Expected)
+	if i.Expected == math.MaxUint64 {
+		expected = "an impossible number of"
+	}
+	return fmt.Sprintf("%s.%s imply %s bytes of event data, but the event data is %d bytes", i.Structure,
+		strings.Join(i.Fields, " and "), expected, i.Actual)
+}
+
+func addLengths(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+func mulLengths(a, b uint64) uint64 {
+	if a != 0 && b > math.MaxUint64/a {
+		return math.MaxUint64
+	}
+	return a * b
+}
+
+// CheckInternalLengths cross-checks the internal length fields of the event data of the supplied event against the
+// size of the event data, for events that contain a UEFI_VARIABLE_DATA, UEFI_IMAGE_LOAD_EVENT or UEFI_GPT_DATA
+// structure. It returns nil if the lengths are consistent, if the event has no internal length fields, or if the
+// event data is too short to contain them.
+func CheckInternalLengths(event *Event) *InternalLengthInconsistency {
+	if event.Data() == nil {
+		return nil
+	}
+	data := event.Data().Bytes()
+	actual := uint64(len(data))
+
+	var out *InternalLengthInconsistency
+
+	switch event.EventType {
+	case EventTypeEFIVariableDriverConfig, EventTypeEFIVariableBoot, EventTypeEFIVariableAuthority:
+		// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+		//  (section 9.2.6 "UEFI_VARIABLE_DATA Structure")
+		if len(data) < 32 {
+			return nil
+		}
+		unicodeNameLength := binary.LittleEndian.Uint64(data[16:])
+		variableDataLength := binary.LittleEndian.Uint64(data[24:])
+		out = &InternalLengthInconsistency{
+			Structure: "UEFI_VARIABLE_DATA",
+			Fields:    []string{"UnicodeNameLength", "VariableDataLength"},
+			Expected:  addLengths(32, addLengths(mulLengths(unicodeNameLength, 2), variableDataLength))}
+	case EventTypeEFIBootServicesApplication, EventTypeEFIBootServicesDriver, EventTypeEFIRuntimeServicesDriver:
+		// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+		//  (section 9.2.3 "UEFI_IMAGE_LOAD_EVENT Structure")
+		if len(data) < 32 {
+			return nil
+		}
+		out = &InternalLengthInconsistency{
+			Structure: "UEFI_IMAGE_LOAD_EVENT",
+			Fields:    []string{"LengthOfDevicePath"},
+			Expected:  addLengths(32, binary.LittleEndian.Uint64(data[24:]))}
+	case EventTypeEFIGPTEvent:
+		// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+		//  (section 9.2.5 "UEFI_GPT_DATA Structure")
+		if len(data) < 100 {
+			return nil
+		}
+		sizeOfPartitionEntry := binary.LittleEndian.Uint32(data[84:])
+		numberOfPartitions := binary.LittleEndian.Uint64(data[92:])
+		out = &InternalLengthInconsistency{
+			Structure: "UEFI_GPT_DATA",
+			Fields:    []string{"UEFIPartitionHeader.SizeOfPartitionEntry", "NumberOfPartitions"},
+			Expected:  addLengths(100, mulLengths(numberOfPartitions, uint64(sizeOfPartitionEntry)))}
+	default:
+		return nil
+	}
+
+	if out.Expected == actual {
+		return nil
+	}
+	out.Actual = actual
+	return out
+}
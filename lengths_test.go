@@ -0,0 +1,93 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func makeTestVariableData(unicodeNameLength, variableDataLength uint64, size int) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, efiGlobalVariableGUID)
+	binary.Write(&buf, binary.LittleEndian, unicodeNameLength)
+	binary.Write(&buf, binary.LittleEndian, variableDataLength)
+	buf.Write(make([]byte, size-buf.Len()))
+	return buf.Bytes()
+}
+
+func TestCheckInternalLengths(t *testing.T) {
+	for _, data := range []struct {
+		desc      string
+		eventType EventType
+		data      []byte
+		expected  *InternalLengthInconsistency
+	}{
+		{
+			desc:      "Consistent",
+			eventType: EventTypeEFIVariableDriverConfig,
+			data:      makeTestVariableData(4, 10, 50),
+		},
+		{
+			desc:      "TrailingBytes",
+			eventType: EventTypeEFIVariableBoot,
+			data:      makeTestVariableData(4, 10, 52),
+			expected: &InternalLengthInconsistency{Structure: "UEFI_VARIABLE_DATA",
+				Fields: []string{"UnicodeNameLength", "VariableDataLength"}, Expected: 50, Actual: 52},
+		},
+		{
+			desc:      "Overflow",
+			eventType: EventTypeEFIVariableAuthority,
+			data:      makeTestVariableData(math.MaxUint64/2, 10, 50),
+			expected: &InternalLengthInconsistency{Structure: "UEFI_VARIABLE_DATA",
+				Fields: []string{"UnicodeNameLength", "VariableDataLength"}, Expected: math.MaxUint64, Actual: 50},
+		},
+		{
+			desc:      "ImageLoad",
+			eventType: EventTypeEFIBootServicesApplication,
+			data:      makeTestVariableData(0, 20, 40),
+			expected: &InternalLengthInconsistency{Structure: "UEFI_IMAGE_LOAD_EVENT",
+				Fields: []string{"LengthOfDevicePath"}, Expected: 52, Actual: 40},
+		},
+		{
+			desc:      "Short",
+			eventType: EventTypeEFIVariableDriverConfig,
+			data:      make([]byte, 20),
+		},
+		{
+			desc:      "OtherType",
+			eventType: EventTypeEFIAction,
+			data:      makeTestVariableData(4, 10, 52),
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			i := CheckInternalLengths(&Event{EventType: data.eventType, data: &opaqueEventData{data: data.data}})
+			switch {
+			case data.expected == nil && i != nil:
+				t.Errorf("Unexpected inconsistency: %s", i)
+			case data.expected != nil && i == nil:
+				t.Errorf("Expected an inconsistency")
+			case data.expected != nil:
+				if i.Structure != data.expected.Structure || len(i.Fields) != len(data.expected.Fields) ||
+					i.Expected != data.expected.Expected || i.Actual != data.expected.Actual {
+					t.Errorf("Unexpected inconsistency: %+v", i)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckInternalLengthsGPT(t *testing.T) {
+	data := make([]byte, 100+2*128)
+	binary.LittleEndian.PutUint32(data[84:], 128)
+	binary.LittleEndian.PutUint64(data[92:], 3)
+
+	i := CheckInternalLengths(&Event{EventType: EventTypeEFIGPTEvent, data: &opaqueEventData{data: data}})
+	if i == nil {
+		t.Fatalf("Expected an inconsistency")
+	}
+	if i.String() != "UEFI_GPT_DATA.UEFIPartitionHeader.SizeOfPartitionEntry and NumberOfPartitions imply 484 bytes "+
+		"of event data, but the event data is 356 bytes" {
+		t.Errorf("Unexpected string: %s", i)
+	}
+}
@@ -0,0 +1,98 @@
+package tcglog
+
+import (
+	"fmt"
+)
+
+// DecodeLimitKind identifies a limit that is enforced when decoding event data (see DecodeLimitError).
+type DecodeLimitKind int
+
+const (
+	// DecodeLimitDevicePathNodes is the limit on the number of nodes in a device path (see
+	// LogOptions.MaxDevicePathNodes).
+	DecodeLimitDevicePathNodes DecodeLimitKind = iota + 1
+
+	// DecodeLimitNestingDepth is the limit on the depth of nested structures, such as SIPA containers in the event
+	// data of an EV_EVENT_TAG event (see LogOptions.MaxNestingDepth).
+	DecodeLimitNestingDepth
+
+	// DecodeLimitSignatures is the limit on the number of signatures in an EFI signature database (see
+	// LogOptions.MaxSignatures).
+	DecodeLimitSignatures
+)
+
+func (k DecodeLimitKind) String() string {
+	switch k {
+	case DecodeLimitDevicePathNodes:
+		return "number of device path nodes"
+	case DecodeLimitNestingDepth:
+		return "nesting depth"
+	case DecodeLimitSignatures:
+		return "number of signatures"
+	default:
+		return fmt.Sprintf("limit(%d)", int(k))
+	}
+}
+
+// DecodeLimitError is returned when decoding event data would exceed one of the limits configured in LogOptions. For
+// event data, it is the error wrapped by the EventDecodeError returned from Event.DecodeError.
+type DecodeLimitError struct {
+	Kind  DecodeLimitKind // The limit that was exceeded
+	Limit int             // The value of the limit
+}
+
+func (e *DecodeLimitError) Error() string {
+	return fmt.Sprintf("%s exceeds the limit (%d)", e.Kind, e.Limit)
+}
+
+const (
+	// DefaultMaxDevicePathNodes is the default value of LogOptions.MaxDevicePathNodes. Device paths recorded by
+	// real firmware rarely contain more than 10 nodes.
+	DefaultMaxDevicePathNodes = 128
+
+	// DefaultMaxNestingDepth is the default value of LogOptions.MaxNestingDepth.
+	DefaultMaxNestingDepth = 16
+
+	// DefaultMaxSignatures is the default value of LogOptions.MaxSignatures. This is much larger than the number of
+	// signatures in the largest dbx updates.
+	DefaultMaxSignatures = 65536
+)
+
+// decodeLimits are the limits applied when decoding event data. The zero value applies the defaults. It also carries
+// the options that affect how decoded event data is interpreted later on.
+type decodeLimits struct {
+	maxDevicePathNodes int
+	maxNestingDepth    int
+	maxSignatures      int
+
+	tolerantCertificates bool // See LogOptions.TolerantCertificates
+}
+
+func (o *LogOptions) decodeLimits() decodeLimits {
+	return decodeLimits{
+		maxDevicePathNodes:   o.MaxDevicePathNodes,
+		maxNestingDepth:      o.MaxNestingDepth,
+		maxSignatures:        o.MaxSignatures,
+		tolerantCertificates: o.TolerantCertificates}
+}
+
+func (l decodeLimits) devicePathNodes() int {
+	if l.maxDevicePathNodes == 0 {
+		return DefaultMaxDevicePathNodes
+	}
+	return l.maxDevicePathNodes
+}
+
+func (l decodeLimits) nestingDepth() int {
+	if l.maxNestingDepth == 0 {
+		return DefaultMaxNestingDepth
+	}
+	return l.maxNestingDepth
+}
+
+func (l decodeLimits) signatures() int {
+	if l.maxSignatures == 0 {
+		return DefaultMaxSignatures
+	}
+	return l.maxSignatures
+}
@@ -0,0 +1,139 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func makeTestLongDevicePath(n int) EFIDevicePath {
+	var path EFIDevicePath
+	for i := 0; i < n; i++ {
+		path = append(path, &EFIDevicePathNode{Type: 0x01, SubType: 0x01, Data: []byte{0, byte(i)}})
+	}
+	return path
+}
+
+func TestDecodeDevicePathLimit(t *testing.T) {
+	data := encodeTestDevicePath(makeTestLongDevicePath(8))
+
+	if _, err := decodeDevicePath(data, decodeLimits{maxDevicePathNodes: 8}); err != nil {
+		t.Errorf("decodeDevicePath failed at the limit: %v", err)
+	}
+
+	_, err := decodeDevicePath(data, decodeLimits{maxDevicePathNodes: 7})
+	var e *DecodeLimitError
+	if !errors.As(err, &e) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if *e != (DecodeLimitError{Kind: DecodeLimitDevicePathNodes, Limit: 7}) {
+		t.Errorf("Unexpected limit error: %+v", e)
+	}
+	if e.Error() != "number of device path nodes exceeds the limit (7)" {
+		t.Errorf("Unexpected error string: %v", e)
+	}
+}
+
+func TestEventDecodeErrorDevicePathLimit(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+
+	path := encodeTestDevicePath(makeTestLongDevicePath(DefaultMaxDevicePathNodes + 1))
+	var imageLoad bytes.Buffer
+	binary.Write(&imageLoad, binary.LittleEndian, uint64(0x7c000000))
+	binary.Write(&imageLoad, binary.LittleEndian, uint64(0x1000))
+	binary.Write(&imageLoad, binary.LittleEndian, uint64(0))
+	binary.Write(&imageLoad, binary.LittleEndian, uint64(len(path)))
+	imageLoad.Write(path)
+
+	data := makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(4, EventTypeEFIBootServicesApplication, imageLoad.Bytes(), algs...)})
+
+	events := readAllTestLogEvents(t, data, LogOptions{})
+	var e *DecodeLimitError
+	if !errors.As(events[1].DecodeError(), &e) || e.Kind != DecodeLimitDevicePathNodes {
+		t.Errorf("Unexpected decode error: %v", events[1].DecodeError())
+	}
+
+	events = readAllTestLogEvents(t, data, LogOptions{MaxDevicePathNodes: DefaultMaxDevicePathNodes + 1})
+	if events[1].DecodeError() != nil {
+		t.Errorf("Unexpected decode error with a larger limit: %v", events[1].DecodeError())
+	}
+}
+
+func TestDecodeEventDataSIPANestingLimit(t *testing.T) {
+	data := encodeTestSIPAEvent(0x00050003, []byte{0})
+	for i := 0; i < 4; i++ {
+		data = encodeTestSIPAEvent(0x40010003, data)
+	}
+
+	event, _ := decodeEventData(13, EventTypeEventTag, data,
+		&LogOptions{EnableWindowsSIPA: true, MaxNestingDepth: 4}, false)
+	if _, ok := event.(*SIPAEventData); !ok {
+		t.Errorf("Unexpected event data at the limit: %T (%s)", event, event)
+	}
+
+	event, _ = decodeEventData(13, EventTypeEventTag, data,
+		&LogOptions{EnableWindowsSIPA: true, MaxNestingDepth: 3}, false)
+	broken, ok := event.(*BrokenEventData)
+	if !ok {
+		t.Fatalf("Unexpected event data: %T (%s)", event, event)
+	}
+	var e *DecodeLimitError
+	if !errors.As(broken.Error, &e) || e.Kind != DecodeLimitNestingDepth || e.Limit != 3 {
+		t.Errorf("Unexpected error: %v", broken.Error)
+	}
+}
+
+func TestSignatureListsLimit(t *testing.T) {
+	owner := *NewEFIGUID(0x77fa9abd, 0x0359, 0x4d32, 0xbd60, [...]uint8{0x28, 0xf4, 0xe7, 0x8f, 0x78, 0x4b})
+
+	var data []byte
+	data = append(data, makeTestSignatureList(efiCertSHA256GUID, owner,
+		AlgorithmSha256.hash([]byte("foo")), AlgorithmSha256.hash([]byte("bar")))...)
+	data = append(data, makeTestSignatureList(efiCertSHA256GUID, owner, AlgorithmSha256.hash([]byte("baz")))...)
+
+	e := EFIVariableEventData{VariableName: efiImageSecurityDatabaseGUID, UnicodeName: "dbx", VariableData: data,
+		limits: decodeLimits{maxSignatures: 3}}
+	if _, err := e.SignatureLists(); err != nil {
+		t.Errorf("SignatureLists failed at the limit: %v", err)
+	}
+
+	// The limit applies to the whole database rather than to each list.
+	e.limits.maxSignatures = 2
+	_, err := e.SignatureLists()
+	var le *DecodeLimitError
+	if !errors.As(err, &le) || le.Kind != DecodeLimitSignatures || le.Limit != 2 {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestNewLogOptionsDecodeLimits(t *testing.T) {
+	options, err := NewLogOptions(WithMaxDevicePathNodes(16), WithMaxNestingDepth(4), WithMaxSignatures(1000),
+		WithMaxNestingDepth(4))
+	if err != nil {
+		t.Fatalf("NewLogOptions failed: %v", err)
+	}
+	if options != (LogOptions{MaxDevicePathNodes: 16, MaxNestingDepth: 4, MaxSignatures: 1000}) {
+		t.Errorf("Unexpected options: %+v", options)
+	}
+
+	for _, data := range []struct {
+		desc string
+		opts []LogOption
+	}{
+		{desc: "MaxDevicePathNodesZero", opts: []LogOption{WithMaxDevicePathNodes(0)}},
+		{desc: "MaxNestingDepthNegative", opts: []LogOption{WithMaxNestingDepth(-1)}},
+		{desc: "MaxSignaturesConflict", opts: []LogOption{WithMaxSignatures(10), WithMaxSignatures(20)}},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			if _, err := NewLogOptions(data.opts...); err == nil {
+				t.Errorf("NewLogOptions should have failed")
+			}
+		})
+	}
+
+	if err := (LogOptions{MaxSignatures: -1}).Validate(); err == nil {
+		t.Errorf("Validate should fail with a negative limit")
+	}
+}
@@ -6,27 +6,96 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 )
 
-// LogOptions allows the behaviour of Log to be controlled.
+// LogOptions allows the behaviour of Log to be controlled. Use NewLogOptions to construct one from LogOption
+// values, which validates the resulting combination.
 type LogOptions struct {
 	EnableGrub           bool     // Enable support for interpreting events recorded by GRUB
 	EnableSystemdEFIStub bool     // Enable support for interpreting events recorded by systemd's EFI linux loader stub
 	SystemdEFIStubPCR    PCRIndex // Specify the PCR that systemd's EFI linux loader stub measures to
+	EnableWindowsSIPA    bool     // Enable support for interpreting the SIPA events recorded by Windows in EV_EVENT_TAG events
+
+	// ExpectedEventCount is a hint for the number of events in the log, which is used to preallocate storage when
+	// the whole log is read. If this is zero, the number of events is estimated from the size of the log and the
+	// average size of the events read so far.
+	ExpectedEventCount int
+
+	// Permissive enables recovery from corrupt event headers. Rather than failing, the log is searched for the next
+	// plausible event boundary and reading continues from there. The skipped regions are recorded (see Log.Gaps),
+	// and the first event after each one has EventQuirkPrecededByGap. Events in the skipped regions are lost, so the
+	// PCR values computed from a log that has gaps won't match the TPM.
+	Permissive bool
+
+	// MaxEventDataSize is the largest event data size that will be accepted when reading a log. An event that
+	// declares a larger size is treated as corrupt without allocating storage for its data, so that a malicious log
+	// can't be used to exhaust the memory of the reader. If this is zero, DefaultMaxEventDataSize is used.
+	MaxEventDataSize uint32
+
+	// MaxDevicePathNodes, MaxNestingDepth and MaxSignatures limit the size of structures decoded from event data,
+	// so that crafted event data can't be used to cause excessive recursion or allocation. Event data that exceeds
+	// one of these is treated as malformed, with a *DecodeLimitError as the reason. If any of these is zero, the
+	// corresponding default (DefaultMaxDevicePathNodes, DefaultMaxNestingDepth or DefaultMaxSignatures) is used.
+	MaxDevicePathNodes int // The maximum number of nodes in a device path
+	MaxNestingDepth    int // The maximum depth of nested structures, such as SIPA containers
+	MaxSignatures      int // The maximum number of signatures in an EFI signature database
+
+	// TolerantCertificates enables a fallback parser for X.509 certificates in EV_EFI_VARIABLE_AUTHORITY events and
+	// EFI signature databases that crypto/x509 rejects, so that the subject, issuer and fingerprint of slightly
+	// malformed OEM certificates are still reported (see ParseCertificateSummary).
+	TolerantCertificates bool
+}
+
+// DefaultMaxEventDataSize is the default value of LogOptions.MaxEventDataSize. This is much larger than the data of
+// any event recorded by real firmware - the largest are normally the measurements of the UEFI signature databases.
+const DefaultMaxEventDataSize = 16 * 1024 * 1024
+
+func (o *LogOptions) maxEventDataSize() uint32 {
+	if o.MaxEventDataSize == 0 {
+		return DefaultMaxEventDataSize
+	}
+	return o.MaxEventDataSize
 }
 
+// sha1AlgorithmTable is the algorithm table for the digests of events in logs that aren't crypto-agile.
+var sha1AlgorithmTable = AlgorithmIdList{AlgorithmSha1}
+
 var zeroDigests = map[AlgorithmId][]byte{
 	AlgorithmSha1:   make([]byte, AlgorithmSha1.size()),
 	AlgorithmSha256: make([]byte, AlgorithmSha256.size()),
 	AlgorithmSha384: make([]byte, AlgorithmSha384.size()),
 	AlgorithmSha512: make([]byte, AlgorithmSha512.size())}
 
+// separatorErrorDigests are the digests of the separator event error value for each supported algorithm, which are
+// computed once rather than for every event.
+var separatorErrorDigests = func() map[AlgorithmId]Digest {
+	errorValue := make([]byte, 4)
+	binary.LittleEndian.PutUint32(errorValue, separatorEventErrorValue)
+
+	out := make(map[AlgorithmId]Digest)
+	for _, alg := range []AlgorithmId{AlgorithmSha1, AlgorithmSha256, AlgorithmSha384, AlgorithmSha512} {
+		out[alg] = alg.hash(errorValue)
+	}
+	return out
+}()
+
 type stream interface {
-	readNextEvent() (*Event, int, error)
+	readNextEvent() (*Event, error)
+}
+
+// resyncStream is implemented by streams that support recovery from corrupt events in permissive mode.
+type resyncStream interface {
+	stream
+
+	// plausibleEventLength determines whether the stream is positioned at something that looks like the start of an
+	// event, and returns the total length of the event if it is.
+	plausibleEventLength() (int64, bool, error)
 }
 
+const maxPCRIndex PCRIndex = 31
+
 func isPCRIndexInRange(index PCRIndex) bool {
-	const maxPCRIndex PCRIndex = 31
 	return index <= maxPCRIndex
 }
 
@@ -36,10 +105,38 @@ func isPCRIndexInRange(index PCRIndex) bool {
 //  (section 2.3.2 "Error Conditions", section 2.3.4 "PCR Usage", section 7.2
 //   "Procedure for Pre-OS to OS-Present Transition")
 func isDigestOfSeparatorErrorValue(digest Digest, alg AlgorithmId) bool {
-	errorValue := make([]byte, 4)
-	binary.LittleEndian.PutUint32(errorValue, separatorEventErrorValue)
+	errorDigest, ok := separatorErrorDigests[alg]
+	return ok && bytes.Equal(digest, errorDigest)
+}
+
+const (
+	maxEventPadding    = 64
+	minEventHeaderSize = 14 // TCG_PCR_EVENT2.{pcrIndex, eventType, digests.count, digests.digests[0].hashAlg}
+)
+
+// logReader is the source of the events read by a stream. It decodes fixed size fields in to a scratch buffer,
+// which avoids the reflection and allocations of binary.Read when reading each event.
+type logReader struct {
+	io.ReadSeeker
+	buf [maxEventPadding + minEventHeaderSize]byte
+}
 
-	return bytes.Compare(digest, alg.hash(errorValue)) == 0
+func newLogReader(r io.ReadSeeker) *logReader {
+	return &logReader{ReadSeeker: r}
+}
+
+func (r *logReader) readUint16() (uint16, error) {
+	if _, err := io.ReadFull(r.ReadSeeker, r.buf[:2]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(r.buf[:]), nil
+}
+
+func (r *logReader) readUint32() (uint32, error) {
+	if _, err := io.ReadFull(r.ReadSeeker, r.buf[:4]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(r.buf[:]), nil
 }
 
 func wrapLogReadError(origErr error, partial bool) error {
@@ -57,54 +154,81 @@ func wrapPCRIndexOutOfRangeError(pcrIndex PCRIndex) error {
 	return fmt.Errorf("log entry has an out-of-range PCR index (%d)", pcrIndex)
 }
 
+func wrapEventDataSizeLimitError(size, limit uint32) error {
+	return fmt.Errorf("log entry has an event data size (%d) that exceeds the limit (%d)", size, limit)
+}
+
 type eventHeader_1_2 struct {
 	PCRIndex  PCRIndex
 	EventType EventType
 }
 
 type stream_1_2 struct {
-	r       io.ReadSeeker
+	r       *logReader
 	options LogOptions
 }
 
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientImplementation_1-21_1_00.pdf
 //  (section 11.1.1 "TCG_PCClientPCREventStruct Structure")
-func (s *stream_1_2) readNextEvent() (*Event, int, error) {
-	var header eventHeader_1_2
-	if err := binary.Read(s.r, binary.LittleEndian, &header); err != nil {
-		return nil, 0, wrapLogReadError(err, false)
+func (s *stream_1_2) readNextEvent() (*Event, error) {
+	if _, err := io.ReadFull(s.r, s.r.buf[:8]); err != nil {
+		return nil, wrapLogReadError(err, false)
 	}
+	header := eventHeader_1_2{
+		PCRIndex:  PCRIndex(binary.LittleEndian.Uint32(s.r.buf[0:4])),
+		EventType: EventType(binary.LittleEndian.Uint32(s.r.buf[4:8]))}
 
 	if !isPCRIndexInRange(header.PCRIndex) {
-		return nil, 0, wrapPCRIndexOutOfRangeError(header.PCRIndex)
+		return nil, wrapPCRIndexOutOfRangeError(header.PCRIndex)
 	}
 
 	digest := make(Digest, AlgorithmSha1.size())
 	if _, err := s.r.Read(digest); err != nil {
-		return nil, 0, wrapLogReadError(err, true)
+		return nil, wrapLogReadError(err, true)
 	}
-	digests := make(DigestMap)
-	digests[AlgorithmSha1] = digest
+	digests := newEventDigests(sha1AlgorithmTable)
+	digests.Set(AlgorithmSha1, digest)
+	rawDigests := TaggedDigestList{{Algorithm: AlgorithmSha1, Digest: digest}}
 
-	var eventSize uint32
-	if err := binary.Read(s.r, binary.LittleEndian, &eventSize); err != nil {
-		return nil, 0, wrapLogReadError(err, true)
+	eventSize, err := s.r.readUint32()
+	if err != nil {
+		return nil, wrapLogReadError(err, true)
+	}
+	if limit := s.options.maxEventDataSize(); eventSize > limit {
+		return nil, wrapEventDataSizeLimitError(eventSize, limit)
 	}
 
 	event := make([]byte, eventSize)
 	if _, err := io.ReadFull(s.r, event); err != nil {
-		return nil, 0, wrapLogReadError(err, true)
+		return nil, wrapLogReadError(err, true)
 	}
 
-	data, trailing := decodeEventData(header.PCRIndex, header.EventType, event, &s.options,
-		isDigestOfSeparatorErrorValue(digest, AlgorithmSha1))
-
 	return &Event{
-		PCRIndex:  header.PCRIndex,
-		EventType: header.EventType,
-		Digests:   digests,
-		Data:      data,
-	}, trailing, nil
+		PCRIndex:   header.PCRIndex,
+		EventType:  header.EventType,
+		Digests:    digests,
+		RawDigests: rawDigests,
+		lazy: newLazyEventData(header.PCRIndex, header.EventType, event, &s.options,
+			isDigestOfSeparatorErrorValue(digest, AlgorithmSha1)),
+	}, nil
+}
+
+// plausibleEventLength determines whether the stream is positioned at something that looks like the start of an
+// event, and returns the total length of the event if it is. It doesn't allocate storage for the event data.
+func (s *stream_1_2) plausibleEventLength() (int64, bool, error) {
+	var header struct {
+		eventHeader_1_2
+		Digest    [20]byte
+		EventSize uint32
+	}
+	if err := binary.Read(s.r, binary.LittleEndian, &header); err != nil {
+		return 0, false, err
+	}
+	if !isPCRIndexInRange(header.PCRIndex) || header.EventType == EventTypePrebootCert ||
+		!isKnownEventType(header.EventType) || header.EventSize > s.options.maxEventDataSize() {
+		return 0, false, nil
+	}
+	return int64(binary.Size(header)) + int64(header.EventSize), true, nil
 }
 
 type eventHeader_2 struct {
@@ -114,102 +238,414 @@ type eventHeader_2 struct {
 }
 
 type stream_2 struct {
-	r              io.ReadSeeker
+	r              *logReader
 	options        LogOptions
 	algSizes       []EFISpecIdEventAlgorithmSize
+	algorithms     AlgorithmIdList // The algorithm table for the digests of each event
+	digestsSize    int             // The combined size of a digest for each algorithm in algSizes
 	readFirstEvent bool
 }
 
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
 //  (section 9.2.2 "TCG_PCR_EVENT2 Structure")
-func (s *stream_2) readNextEvent() (*Event, int, error) {
+func (s *stream_2) readNextEvent() (*Event, error) {
 	if !s.readFirstEvent {
 		s.readFirstEvent = true
-		stream := stream_1_2{r: s.r}
+		stream := stream_1_2{r: s.r, options: s.options}
 		return stream.readNextEvent()
 	}
 
-	var header eventHeader_2
-	if err := binary.Read(s.r, binary.LittleEndian, &header); err != nil {
-		return nil, 0, wrapLogReadError(err, false)
+	legacy, err := s.atLegacySpecIdEvent()
+	if err != nil {
+		return nil, wrapLogReadError(err, false)
+	}
+	if legacy {
+		// Some buggy firmware records the Spec ID event more than once, and the copies are in the same format
+		// as the first event of the log rather than the crypto-agile format.
+		stream := stream_1_2{r: s.r, options: s.options}
+		return stream.readNextEvent()
+	}
+
+	if _, err := io.ReadFull(s.r, s.r.buf[:12]); err != nil {
+		return nil, wrapLogReadError(err, false)
 	}
+	header := eventHeader_2{
+		PCRIndex:  PCRIndex(binary.LittleEndian.Uint32(s.r.buf[0:4])),
+		EventType: EventType(binary.LittleEndian.Uint32(s.r.buf[4:8])),
+		Count:     binary.LittleEndian.Uint32(s.r.buf[8:12])}
 
 	if !isPCRIndexInRange(header.PCRIndex) {
-		return nil, 0, wrapPCRIndexOutOfRangeError(header.PCRIndex)
+		return nil, wrapPCRIndexOutOfRangeError(header.PCRIndex)
 	}
 
-	digests := make(DigestMap)
+	var rawDigests TaggedDigestList
+	var quirks []EventQuirk
+
+	// All of the digests for this event are read in to a single buffer, and the entries in rawDigests and digests
+	// refer to it rather than to their own allocations.
+	buf := make([]byte, s.digestsSize)
+
+	trustCount := int(header.Count) >= len(s.algSizes)
+	if trustCount {
+		// An event may contain additional digests for algorithms that aren't in the Spec ID event, or more than one
+		// digest for the same algorithm. These are read using the count as long as their sizes are known.
+		start, err := s.r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, wrapLogReadError(err, true)
+		}
+		d, q, err := s.readDigests(header.Count, buf)
+		switch {
+		case err == nil:
+			rawDigests = d
+			quirks = append(quirks, q...)
+		case int(header.Count) > len(s.algSizes):
+			if _, unrecognized := err.(*unrecognizedDigestAlgorithmError); !unrecognized {
+				return nil, err
+			}
+			// The count is probably too high, and the event size was read as an algorithm identifier.
+			if _, err := s.r.Seek(start, io.SeekStart); err != nil {
+				return nil, wrapLogReadError(err, true)
+			}
+			trustCount = false
+		default:
+			return nil, err
+		}
+	}
+	if !trustCount {
+		// Some buggy firmware writes a digest count that disagrees with the number of digests that are actually
+		// present. Don't trust the count and use the algorithm identifiers instead, so that we don't lose
+		// synchronization with the rest of the log.
+		quirks = append(quirks, EventQuirkDigestCountMismatch)
+		d, err := s.readDigestsWithoutCount(buf)
+		if err != nil {
+			return nil, err
+		}
+		rawDigests = d
+	}
 
+	// Only the first digest for each algorithm from the Spec ID event is used. Anything else is only available from
+	// rawDigests.
+	digests := newEventDigests(s.algorithms)
+	for _, d := range rawDigests {
+		if !d.Algorithm.supported() {
+			continue
+		}
+		if _, known := s.digestSize(d.Algorithm); !known {
+			continue
+		}
+		if _, exists := digests.Lookup(d.Algorithm); exists {
+			continue
+		}
+		digests.Set(d.Algorithm, d.Digest)
+	}
+
+	eventSize, err := s.r.readUint32()
+	if err != nil {
+		return nil, wrapLogReadError(err, true)
+	}
+	if limit := s.options.maxEventDataSize(); eventSize > limit {
+		return nil, wrapEventDataSizeLimitError(eventSize, limit)
+	}
+
+	event := make([]byte, eventSize)
+	if _, err := io.ReadFull(s.r, event); err != nil {
+		return nil, wrapLogReadError(err, true)
+	}
+
+	lazy := newLazyEventData(header.PCRIndex, header.EventType, event, &s.options,
+		isDigestOfSeparatorErrorValue(digests.Get(s.algSizes[0].AlgorithmId), s.algSizes[0].AlgorithmId))
+
+	padding, err := s.skipPadding()
+	if err != nil {
+		return nil, wrapLogReadError(err, false)
+	}
+	if padding > 0 {
+		quirks = append(quirks, EventQuirkTrailingPadding)
+	}
+
+	return &Event{
+		PCRIndex:   header.PCRIndex,
+		EventType:  header.EventType,
+		Digests:    digests,
+		RawDigests: rawDigests,
+		Quirks:     quirks,
+		lazy:       lazy,
+	}, nil
+}
+
+// legacySpecIdEventHeaderSize is the size of a TCG_PCClientPCREventStruct header and the signature of the Spec ID
+// event that follows it.
+const legacySpecIdEventHeaderSize = 48
+
+// isLegacySpecIdEventHeader determines whether buf begins with a Spec ID event in the TCG_PCClientPCREventStruct
+// format used by the first event of a crypto-agile log. A crypto-agile event can't begin with this, as the 20 byte
+// SHA-1 digest of a Spec ID event is all zeroes and the digest count and first algorithm of a crypto-agile event
+// occupy the same bytes.
+func isLegacySpecIdEventHeader(buf []byte) bool {
+	if len(buf) < legacySpecIdEventHeaderSize {
+		return false
+	}
+	if EventType(binary.LittleEndian.Uint32(buf[4:8])) != EventTypeNoAction {
+		return false
+	}
+	if !bytes.Equal(buf[8:28], zeroDigests[AlgorithmSha1]) {
+		return false
+	}
+	return bytes.HasPrefix(buf[32:48], []byte("Spec ID Event"))
+}
+
+// atLegacySpecIdEvent determines whether the stream is positioned at a Spec ID event in the format used by the
+// first event of the log, without advancing it.
+func (s *stream_2) atLegacySpecIdEvent() (bool, error) {
+	start, err := s.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, err
+	}
+
+	buf := s.r.buf[:legacySpecIdEventHeaderSize]
+	n, err := io.ReadFull(s.r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+
+	if _, err := s.r.Seek(start, io.SeekStart); err != nil {
+		return false, err
+	}
+	return isLegacySpecIdEventHeader(buf[:n]), nil
+}
+
+// isPlausibleEventHeader determines whether buf looks like it begins with a TCG_PCR_EVENT2 header. If strict is
+// false, the digest count isn't checked, so that events with an incorrect count are still considered plausible.
+func (s *stream_2) isPlausibleEventHeader(buf []byte, strict bool) bool {
+	if !isPCRIndexInRange(PCRIndex(binary.LittleEndian.Uint32(buf[0:4]))) {
+		return false
+	}
+	if strict && int(binary.LittleEndian.Uint32(buf[8:12])) != len(s.algSizes) {
+		return false
+	}
+	_, known := s.digestSize(AlgorithmId(binary.LittleEndian.Uint16(buf[12:14])))
+	return known
+}
+
+// skipPadding handles logs from some OEM firmware that contain undocumented padding between the end of an event
+// and the start of the next one. If the stream isn't positioned at something that looks like the start of an
+// event, it searches forward for a plausible event header and skips to it, returning the number of bytes skipped.
+// If no plausible header is found, the stream position is left unchanged.
+func (s *stream_2) skipPadding() (int, error) {
+	start, err := s.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+
+	buf := s.r.buf[:]
+	n, err := io.ReadFull(s.r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	buf = buf[:n]
+
+	padding := 0
+	if isLegacySpecIdEventHeader(buf) {
+		// Don't search for an event header inside a duplicated Spec ID event, which contains something that looks
+		// like one.
+		buf = nil
+	}
+	for i := 0; i <= maxEventPadding && i+minEventHeaderSize <= len(buf); i++ {
+		if s.isPlausibleEventHeader(buf[i:], i > 0) {
+			padding = i
+			break
+		}
+	}
+
+	if _, err := s.r.Seek(start+int64(padding), io.SeekStart); err != nil {
+		return 0, err
+	}
+	return padding, nil
+}
+
+// plausibleEventLength determines whether the stream is positioned at something that looks like the start of an
+// event, and returns the total length of the event if it is. It doesn't allocate storage for the event data.
+func (s *stream_2) plausibleEventLength() (int64, bool, error) {
+	var header eventHeader_2
+	if err := binary.Read(s.r, binary.LittleEndian, &header); err != nil {
+		return 0, false, err
+	}
+	if !isPCRIndexInRange(header.PCRIndex) || int(header.Count) != len(s.algSizes) {
+		return 0, false, nil
+	}
+	n := int64(binary.Size(header))
+
+	var seen TaggedDigestList
 	for i := uint32(0); i < header.Count; i++ {
 		var algorithmId AlgorithmId
 		if err := binary.Read(s.r, binary.LittleEndian, &algorithmId); err != nil {
-			return nil, 0, wrapLogReadError(err, true)
+			return 0, false, err
+		}
+		digestSize, known := s.digestSize(algorithmId)
+		if !known || seen.hasDigest(algorithmId) {
+			return 0, false, nil
+		}
+		seen = append(seen, TaggedDigest{Algorithm: algorithmId})
+		if _, err := s.r.Seek(int64(digestSize), io.SeekCurrent); err != nil {
+			return 0, false, err
+		}
+		n += int64(binary.Size(algorithmId)) + int64(digestSize)
+	}
+
+	var eventSize uint32
+	if err := binary.Read(s.r, binary.LittleEndian, &eventSize); err != nil {
+		return 0, false, err
+	}
+	if eventSize > s.options.maxEventDataSize() {
+		return 0, false, nil
+	}
+	return n + int64(binary.Size(eventSize)) + int64(eventSize), true, nil
+}
+
+func (s *stream_2) digestSize(alg AlgorithmId) (uint16, bool) {
+	for _, algSize := range s.algSizes {
+		if algSize.AlgorithmId == alg {
+			return algSize.DigestSize, true
+		}
+	}
+	return 0, false
+}
+
+// hasDigest determines whether the supplied list already contains a digest for the specified algorithm.
+func (l TaggedDigestList) hasDigest(alg AlgorithmId) bool {
+	for _, d := range l {
+		if d.Algorithm == alg {
+			return true
 		}
+	}
+	return false
+}
+
+// readDigest reads a digest of the specified size from the stream, using the start of buf for storage. It returns
+// the digest and the rest of buf.
+func (s *stream_2) readDigest(size uint16, buf []byte) (Digest, []byte, error) {
+	if int(size) > len(buf) {
+		// This only happens if the event contains duplicate digests or digests for algorithms that aren't in the
+		// Spec ID event.
+		buf = make([]byte, size)
+	}
+	digest := Digest(buf[:size:size])
+	if _, err := io.ReadFull(s.r, digest); err != nil {
+		return nil, nil, wrapLogReadError(err, true)
+	}
+	return digest, buf[size:], nil
+}
+
+// unrecognizedDigestAlgorithmError is returned from readDigests when an event contains a digest for an algorithm
+// with an unknown size, which means that the rest of the event can't be located.
+type unrecognizedDigestAlgorithmError struct {
+	alg AlgorithmId
+}
 
-		var digestSize uint16
-		var j int
-		for j = 0; j < len(s.algSizes); j++ {
-			if s.algSizes[j].AlgorithmId == algorithmId {
-				digestSize = s.algSizes[j].DigestSize
-				break
+func (e *unrecognizedDigestAlgorithmError) Error() string {
+	return fmt.Sprintf("crypto-agile log entry contains a digest for an unrecognized algorithm (%s)", e.alg)
+}
+
+// readDigests reads count digests from the stream. Digests for an algorithm that isn't in the Spec ID event, and
+// additional digests for an algorithm that has already been seen, are tolerated as long as their size is known. They
+// are returned in the list along with a quirk that describes them.
+func (s *stream_2) readDigests(count uint32, buf []byte) (TaggedDigestList, []EventQuirk, error) {
+	raw := make(TaggedDigestList, 0, len(s.algSizes))
+	var quirks []EventQuirk
+	addQuirk := func(quirk EventQuirk) {
+		for _, q := range quirks {
+			if q == quirk {
+				return
 			}
 		}
+		quirks = append(quirks, quirk)
+	}
 
-		if j == len(s.algSizes) {
-			return nil, 0, fmt.Errorf("crypto-agile log entry contains a digest for an unrecognized "+
-				"algorithm (%s)", algorithmId)
+	for i := uint32(0); i < count; i++ {
+		id, err := s.r.readUint16()
+		if err != nil {
+			return nil, nil, wrapLogReadError(err, true)
 		}
+		algorithmId := AlgorithmId(id)
 
-		digest := make(Digest, digestSize)
-		if _, err := io.ReadFull(s.r, digest); err != nil {
-			return nil, 0, wrapLogReadError(err, true)
+		digestSize, known := s.digestSize(algorithmId)
+		if !known {
+			if !algorithmId.supported() {
+				return nil, nil, &unrecognizedDigestAlgorithmError{algorithmId}
+			}
+			digestSize = uint16(algorithmId.size())
+			addQuirk(EventQuirkUnexpectedDigestAlgorithm)
 		}
 
-		if _, exists := digests[algorithmId]; exists {
-			return nil, 0, fmt.Errorf("crypto-agile log entry contains more than one digest value "+
-				"for algorithm %s", algorithmId)
+		if raw.hasDigest(algorithmId) {
+			addQuirk(EventQuirkDuplicateDigest)
 		}
-		digests[algorithmId] = digest
+
+		var digest Digest
+		digest, buf, err = s.readDigest(digestSize, buf)
+		if err != nil {
+			return nil, nil, err
+		}
+		raw = append(raw, TaggedDigest{Algorithm: algorithmId, Digest: digest})
+	}
+
+	if err := s.checkDigestsComplete(raw); err != nil {
+		return nil, nil, err
 	}
 
+	return raw, quirks, nil
+}
+
+// checkDigestsComplete checks that raw contains a digest for every algorithm in the Spec ID event.
+func (s *stream_2) checkDigestsComplete(raw TaggedDigestList) error {
 	for _, algSize := range s.algSizes {
-		if _, exists := digests[algSize.AlgorithmId]; !exists {
-			return nil, 0,
-				fmt.Errorf("crypto-agile log entry is missing a digest value for algorithm %s "+
-					"that was present in the Spec ID Event", algSize.AlgorithmId)
+		if !raw.hasDigest(algSize.AlgorithmId) {
+			return fmt.Errorf("crypto-agile log entry is missing a digest value for algorithm %s "+
+				"that was present in the Spec ID Event", algSize.AlgorithmId)
 		}
 	}
+	return nil
+}
 
-	for alg, _ := range digests {
-		if alg.supported() {
-			continue
+// readDigestsWithoutCount reads digests for as long as the next algorithm identifier in the stream corresponds to an
+// algorithm from the Spec ID event that hasn't already been seen for this event. Anything else is assumed to be the
+// start of the event size field, and the stream is rewound to the start of it. The count is only used to locate the
+// event size field, so the event must still contain a digest for every algorithm from the Spec ID event.
+func (s *stream_2) readDigestsWithoutCount(buf []byte) (TaggedDigestList, error) {
+	raw := make(TaggedDigestList, 0, len(s.algSizes))
+
+	for len(raw) < len(s.algSizes) {
+		id, err := s.r.readUint16()
+		if err != nil {
+			return nil, wrapLogReadError(err, true)
 		}
-		delete(digests, alg)
-	}
+		algorithmId := AlgorithmId(id)
 
-	var eventSize uint32
-	if err := binary.Read(s.r, binary.LittleEndian, &eventSize); err != nil {
-		return nil, 0, wrapLogReadError(err, true)
-	}
+		digestSize, known := s.digestSize(algorithmId)
+		if !known || raw.hasDigest(algorithmId) {
+			if _, err := s.r.Seek(-int64(binary.Size(algorithmId)), io.SeekCurrent); err != nil {
+				return nil, wrapLogReadError(err, true)
+			}
+			break
+		}
 
-	event := make([]byte, eventSize)
-	if _, err := io.ReadFull(s.r, event); err != nil {
-		return nil, 0, wrapLogReadError(err, true)
+		var digest Digest
+		digest, buf, err = s.readDigest(digestSize, buf)
+		if err != nil {
+			return nil, err
+		}
+		raw = append(raw, TaggedDigest{Algorithm: algorithmId, Digest: digest})
 	}
 
-	data, trailing := decodeEventData(header.PCRIndex, header.EventType, event, &s.options,
-		isDigestOfSeparatorErrorValue(digests[s.algSizes[0].AlgorithmId], s.algSizes[0].AlgorithmId))
+	if err := s.checkDigestsComplete(raw); err != nil {
+		return nil, err
+	}
 
-	return &Event{
-		PCRIndex:  header.PCRIndex,
-		EventType: header.EventType,
-		Digests:   digests,
-		Data:      data,
-	}, trailing, nil
+	return raw, nil
 }
 
 func fixupSpecIdEvent(event *Event, algorithms AlgorithmIdList) {
-	if event.Data.(*SpecIdEventData).Spec != SpecEFI_2 {
+	if event.Data().(*SpecIdEventData).Spec != SpecEFI_2 {
 		return
 	}
 
@@ -218,40 +654,222 @@ func fixupSpecIdEvent(event *Event, algorithms AlgorithmIdList) {
 			continue
 		}
 
-		if _, ok := event.Digests[alg]; ok {
+		if _, ok := event.Digests.Lookup(alg); ok {
 			continue
 		}
 
-		event.Digests[alg] = zeroDigests[alg]
+		// Copy the digest so that events from different logs don't share storage.
+		event.Digests.Set(alg, append(Digest(nil), zeroDigests[alg]...))
 	}
 }
 
 func isSpecIdEvent(event *Event) (out bool) {
-	_, out = event.Data.(*SpecIdEventData)
+	if event.EventType != EventTypeNoAction {
+		// Avoid decoding the data of other events.
+		return false
+	}
+	_, out = event.Data().(*SpecIdEventData)
 	return
 }
 
 // Log corresponds to an event log parser instance, and allows the consumer to iterate over log entries.
+//
+// A Log is not safe for concurrent use, as reading an event advances it. However, the events that it returns are
+// never modified once they have been returned, so they can be shared between goroutines without synchronization
+// as long as the consumer doesn't modify them either.
 type Log struct {
 	Spec         Spec            // The specification to which this log conforms
 	Algorithms   AlgorithmIdList // The digest algorithms that appear in the log
 	stream       stream
 	failed       bool
 	indexTracker map[PCRIndex]uint
+
+	r                  io.Seeker // The reader used by stream, for tracking the number of bytes read
+	size               int64     // The size of the log, or 0 if it isn't known
+	expectedEventCount int
+	eventCount         int
+	bytesRead          int64
+
+	permissive   bool
+	gaps         []LogGap
+	gapPreceding bool // Whether the next event follows a gap
+
+	areaEnd int64 // For a log read from a fixed size log area, the offset of the unused part of the area
+
+	readFirstEvent bool
+	headerEvents   []*Event
+}
+
+// LogGap describes a corrupt region of a log that was skipped in permissive mode (see LogOptions.Permissive).
+type LogGap struct {
+	Offset int64 // The offset of the start of the region in the log
+	Length int64 // The length of the region. If no plausible event was found after it, it extends to the end of the log
+	Err    error // The error that occurred when reading the event at the start of the region
+}
+
+// Gaps returns the regions of the log that have been skipped so far because they were corrupt. This is only
+// populated in permissive mode (see LogOptions.Permissive).
+func (l *Log) Gaps() []LogGap {
+	return l.gaps
 }
 
-func (l *Log) nextEventInternal() (*Event, int, error) {
+// HeaderEvents returns the Spec ID events that have been read from the log so far. The first event of a log that
+// conforms to one of the supported specifications is a Spec ID event, and it determines the format of the rest of the
+// log. Some buggy firmware records more than one, or records it to a PCR other than 0. Any Spec ID event other than
+// the first event of a log, or that isn't in PCR 0, has EventQuirkUnexpectedSpecIdEvent. These don't affect the
+// format of the log.
+func (l *Log) HeaderEvents() []*Event {
+	return l.headerEvents
+}
+
+// defaultAverageEventSize is used to estimate the number of events in a log before any events have been read. It
+// errs on the side of underestimating, as the consequence of that is only some extra slice growth.
+const defaultAverageEventSize = 256
+
+// maxEstimatedEventCount limits preallocation, so that a log with a bogus size or event count hint doesn't result in a
+// huge allocation.
+const maxEstimatedEventCount = 1 << 16
+
+// logSize returns the size of the log read from r, or 0 if it can't be determined. Note that files in securityfs
+// report a size of 0, in which case the estimate is only based on the running statistics.
+func logSize(r io.ReaderAt) int64 {
+	switch s := r.(type) {
+	case interface{ Size() int64 }:
+		return s.Size()
+	case interface{ Stat() (os.FileInfo, error) }:
+		fi, err := s.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return 0
+		}
+		return fi.Size()
+	default:
+		return 0
+	}
+}
+
+// estimatedEventCount returns an estimate of the total number of events in the log, for preallocating storage when
+// the whole log is going to be read. It returns ExpectedEventCount from the options if that was supplied. Otherwise,
+// it is based on the size of the log and the average size of the events read so far. It returns 0 if there isn't
+// enough information to make an estimate. The estimate never exceeds maxEstimatedEventCount, as the hint may come from
+// an untrusted source such as the header of a final events table.
+func (l *Log) estimatedEventCount() int {
+	if l.expectedEventCount > 0 {
+		if l.expectedEventCount > maxEstimatedEventCount {
+			return maxEstimatedEventCount
+		}
+		return l.expectedEventCount
+	}
+	if l.size <= 0 {
+		return l.eventCount
+	}
+
+	avg := int64(defaultAverageEventSize)
+	if l.eventCount > 0 && l.bytesRead > 0 {
+		avg = l.bytesRead / int64(l.eventCount)
+		if avg == 0 {
+			avg = 1
+		}
+	}
+	n := l.size / avg
+	if n > maxEstimatedEventCount {
+		n = maxEstimatedEventCount
+	}
+	if n < int64(l.eventCount) {
+		n = int64(l.eventCount)
+	}
+	return int(n)
+}
+
+// isPlausibleEventBoundary determines whether offset looks like the start of an event, by checking that there is a
+// plausible event there that is followed by either another plausible event or the end of the log.
+func isPlausibleEventBoundary(s resyncStream, r io.Seeker, offset int64) (bool, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return false, err
+	}
+	n, ok, err := s.plausibleEventLength()
+	if err != nil || !ok {
+		return false, err
+	}
+	if _, err := r.Seek(offset+n, io.SeekStart); err != nil {
+		return false, err
+	}
+	_, ok, err = s.plausibleEventLength()
+	if err == io.EOF {
+		// The event ends at the end of the log.
+		return true, nil
+	}
+	return ok, nil
+}
+
+// resync searches forward from the event at offset, which couldn't be read, for the next plausible event boundary
+// and positions the stream there. It records the skipped region as a gap, and returns false if there are no more
+// events.
+func (l *Log) resync(s resyncStream, offset int64, readErr error) (bool, error) {
+	for candidate := offset + 1; ; candidate++ {
+		ok, err := isPlausibleEventBoundary(s, l.r, candidate)
+		switch {
+		case err == io.EOF:
+			// There is no data left at candidate.
+			l.gaps = append(l.gaps, LogGap{Offset: offset, Length: candidate - offset, Err: readErr})
+			return false, nil
+		case err == io.ErrUnexpectedEOF:
+			// There's not enough data left for an event at candidate, but keep searching until the end of the log.
+		case err != nil:
+			return false, err
+		case ok:
+			if _, err := l.r.Seek(candidate, io.SeekStart); err != nil {
+				return false, err
+			}
+			l.gaps = append(l.gaps, LogGap{Offset: offset, Length: candidate - offset, Err: readErr})
+			return true, nil
+		}
+	}
+}
+
+// NextEvent returns an Event structure that corresponds to the next event in the log. Upon successful completion,
+// the Log instance will advance to the next event. If there are no more events in the log, it will return io.EOF.
+func (l *Log) NextEvent() (*Event, error) {
 	if l.failed {
-		return nil, 0,
-			errors.New("cannot read next event: log status inconsistent due to a previous error")
+		return nil, errors.New("cannot read next event: log status inconsistent due to a previous error")
 	}
 
-	event, trailing, err := l.stream.readNextEvent()
+	start := l.bytesRead
+	if l.areaEnd > 0 && start >= l.areaEnd {
+		return nil, io.EOF
+	}
+	event, err := l.stream.readNextEvent()
+	if s, ok := l.stream.(resyncStream); ok && l.permissive {
+		for err != nil && err != io.EOF {
+			more, resyncErr := l.resync(s, start, err)
+			switch {
+			case resyncErr != nil:
+				err = resyncErr
+			case !more:
+				err = io.EOF
+			default:
+				l.gapPreceding = true
+				start, _ = l.r.Seek(0, io.SeekCurrent)
+				event, err = l.stream.readNextEvent()
+				continue
+			}
+			break
+		}
+	}
 	if err != nil {
 		if err != io.EOF {
 			l.failed = true
 		}
-		return nil, 0, err
+		return nil, err
+	}
+
+	if l.gapPreceding {
+		event.Quirks = append(event.Quirks, EventQuirkPrecededByGap)
+		l.gapPreceding = false
+	}
+
+	l.eventCount++
+	if offset, err := l.r.Seek(0, io.SeekCurrent); err == nil {
+		l.bytesRead = offset
 	}
 
 	if i, exists := l.indexTracker[event.PCRIndex]; exists {
@@ -264,22 +882,40 @@ func (l *Log) nextEventInternal() (*Event, int, error) {
 
 	if isSpecIdEvent(event) {
 		fixupSpecIdEvent(event, l.Algorithms)
+		if l.readFirstEvent || event.PCRIndex != 0 {
+			event.Quirks = append(event.Quirks, EventQuirkUnexpectedSpecIdEvent)
+		}
+		l.headerEvents = append(l.headerEvents, event)
 	}
+	l.readFirstEvent = true
 
-	return event, trailing, nil
+	return event, nil
 }
 
-// NextEvent returns an Event structure that corresponds to the next event in the log. Upon successful completion,
-// the Log instance will advance to the next event. If there are no more events in the log, it will return io.EOF.
-func (l *Log) NextEvent() (event *Event, err error) {
-	event, _, err = l.nextEventInternal()
-	return
+// checkFirstEventWithoutSpecId determines whether the first event of a log that doesn't begin with a Spec ID event is
+// a plausible TCG_PCClientPCREventStruct, as recorded by some older firmware that implements the TCG EFI
+// specification for TPM 1.2 without a Spec ID event. This avoids interpreting something that isn't a log, or a log
+// with an unsupported header, as a SHA-1 log.
+func checkFirstEventWithoutSpecId(event *Event) error {
+	data := event.Data().Bytes()
+	if event.EventType == EventTypeNoAction && bytes.HasPrefix(data, []byte("Spec ID Event")) {
+		if len(data) > 16 {
+			data = data[:16]
+		}
+		return fmt.Errorf("log begins with an unsupported Spec ID event (%q)", bytes.TrimRight(data, "\x00"))
+	}
+	if event.EventType == EventTypePrebootCert || !isKnownEventType(event.EventType) {
+		return fmt.Errorf("log doesn't begin with a Spec ID event or a recognized event (type: %s)", event.EventType)
+	}
+	return nil
 }
 
 // NewLog creates a new Log instance that reads an event log from r
 func NewLog(r io.ReaderAt, options LogOptions) (*Log, error) {
-	var stream stream = &stream_1_2{r: io.NewSectionReader(r, 0, (1<<63)-1), options: options}
-	event, _, err := stream.readNextEvent()
+	sr := io.NewSectionReader(r, 0, (1<<63)-1)
+	lr := newLogReader(sr)
+	var stream stream = &stream_1_2{r: lr, options: options}
+	event, err := stream.readNextEvent()
 	if err != nil {
 		return nil, wrapLogReadError(err, true)
 	}
@@ -288,7 +924,7 @@ func NewLog(r io.ReaderAt, options LogOptions) (*Log, error) {
 	var digestSizes []EFISpecIdEventAlgorithmSize
 	var algorithms AlgorithmIdList
 
-	switch d := event.Data.(type) {
+	switch d := event.Data().(type) {
 	case *SpecIdEventData:
 		spec = d.Spec
 		digestSizes = d.DigestSizes
@@ -305,18 +941,138 @@ func NewLog(r io.ReaderAt, options LogOptions) (*Log, error) {
 				algorithms = append(algorithms, specAlgSize.AlgorithmId)
 			}
 		}
-		stream = &stream_2{r: io.NewSectionReader(r, 0, (1<<63)-1),
+		digestsSize := 0
+		for _, specAlgSize := range digestSizes {
+			digestsSize += int(specAlgSize.DigestSize)
+		}
+		stream = &stream_2{r: lr,
 			options:        options,
 			algSizes:       digestSizes,
+			algorithms:     sortedAlgorithmTable(algorithms),
+			digestsSize:    digestsSize,
 			readFirstEvent: false}
 	} else {
+		if spec == SpecUnknown {
+			if err := checkFirstEventWithoutSpecId(event); err != nil {
+				return nil, err
+			}
+		}
 		algorithms = AlgorithmIdList{AlgorithmSha1}
-		stream.(*stream_1_2).r.Seek(0, io.SeekStart)
 	}
+	sr.Seek(0, io.SeekStart)
 
 	return &Log{Spec: spec,
-		Algorithms:   algorithms,
-		stream:       stream,
-		failed:       false,
-		indexTracker: map[PCRIndex]uint{}}, nil
+		Algorithms:         algorithms,
+		stream:             stream,
+		failed:             false,
+		indexTracker:       map[PCRIndex]uint{},
+		r:                  sr,
+		size:               logSize(r),
+		expectedEventCount: options.ExpectedEventCount,
+		permissive:         options.Permissive}, nil
+}
+
+// finalEventsStream limits a stream to the number of events recorded in the header of a final events table.
+type finalEventsStream struct {
+	stream
+	remaining uint64
+}
+
+func (s *finalEventsStream) readNextEvent() (*Event, error) {
+	if s.remaining == 0 {
+		return nil, io.EOF
+	}
+	s.remaining--
+	return s.stream.readNextEvent()
+}
+
+// NewFinalEventsLog creates a new Log instance that reads the events from a final events table
+// (EFI_TCG2_FINAL_EVENTS_TABLE) from r. The firmware records events that are measured after the event log is
+// retrieved from it (eg, by the OS loader just before ExitBootServices) in this table rather than in the main log.
+// The table doesn't begin with a Spec ID event, so the digest algorithms are taken from mainLog, which must be
+// crypto-agile. The indices of the returned events continue from the events already read from mainLog.
+func NewFinalEventsLog(r io.ReaderAt, mainLog *Log, options LogOptions) (*Log, error) {
+	// https://trustedcomputinggroup.org/wp-content/uploads/EFI-Protocol-Specification-rev13-160330final.pdf
+	//  (section 7 "Final Events Table")
+	mainStream, ok := mainLog.stream.(*stream_2)
+	if !ok {
+		return nil, errors.New("a final events table is only supported for crypto-agile logs")
+	}
+
+	var header struct {
+		Version        uint64
+		NumberOfEvents uint64
+	}
+	if err := binary.Read(io.NewSectionReader(r, 0, 16), binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("cannot read final events table header: %v", wrapLogReadError(err, true))
+	}
+	if header.Version != 1 {
+		return nil, fmt.Errorf("unsupported final events table version (%d)", header.Version)
+	}
+
+	sr := io.NewSectionReader(r, 16, (1<<63)-17)
+	stream := &stream_2{r: newLogReader(sr),
+		options:        options,
+		algSizes:       mainStream.algSizes,
+		algorithms:     mainStream.algorithms,
+		digestsSize:    mainStream.digestsSize,
+		readFirstEvent: true}
+
+	indexTracker := make(map[PCRIndex]uint)
+	for pcr, i := range mainLog.indexTracker {
+		indexTracker[pcr] = i
+	}
+
+	// Avoid overflowing int with a bogus event count. estimatedEventCount clamps it further.
+	expectedEventCount := header.NumberOfEvents
+	if expectedEventCount > maxEstimatedEventCount {
+		expectedEventCount = maxEstimatedEventCount
+	}
+
+	return &Log{Spec: mainLog.Spec,
+		Algorithms:         mainLog.Algorithms,
+		stream:             &finalEventsStream{stream: stream, remaining: header.NumberOfEvents},
+		failed:             false,
+		indexTracker:       indexTracker,
+		r:                  sr,
+		expectedEventCount: int(expectedEventCount),
+		readFirstEvent:     true}, nil
+}
+
+// eventHasDigest indicates whether any of the digests of the supplied event, from any bank, starts with prefix.
+func eventHasDigest(event *Event, prefix []byte) bool {
+	for _, d := range event.RawDigests {
+		if bytes.HasPrefix(d.Digest, prefix) {
+			return true
+		}
+	}
+	for _, alg := range event.Digests.Algorithms() {
+		if bytes.HasPrefix(event.Digests.Get(alg), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindEventsByDigest reads the remaining events from the log and returns those with a digest in any bank that matches
+// the supplied digest. The supplied digest may be a truncated prefix of the full digest, which is useful when it has
+// been copied from a log message. Note that this advances the Log instance to the end of the log.
+func (l *Log) FindEventsByDigest(digest []byte) ([]*Event, error) {
+	if len(digest) == 0 {
+		return nil, errors.New("no digest supplied")
+	}
+
+	var out []*Event
+	for {
+		event, err := l.NextEvent()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if eventHasDigest(event, digest) {
+			out = append(out, event)
+		}
+	}
 }
@@ -0,0 +1,798 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+type testLogEvent struct {
+	pcrIndex    PCRIndex
+	eventType   EventType
+	digestCount uint32
+	digests     []testLogDigest
+	data        []byte
+	padding     int
+}
+
+type testLogDigest struct {
+	alg    AlgorithmId
+	digest Digest
+}
+
+func makeTestLog_2(algs []AlgorithmId, events []testLogEvent) []byte {
+	var buf bytes.Buffer
+
+	var specId bytes.Buffer
+	specId.WriteString("Spec ID Event03\x00")
+	binary.Write(&specId, binary.LittleEndian, uint32(0))
+	specId.Write([]byte{0, 2, 0, 2})
+	binary.Write(&specId, binary.LittleEndian, uint32(len(algs)))
+	for _, alg := range algs {
+		binary.Write(&specId, binary.LittleEndian, alg)
+		binary.Write(&specId, binary.LittleEndian, uint16(alg.size()))
+	}
+	specId.WriteByte(0)
+
+	binary.Write(&buf, binary.LittleEndian, eventHeader_1_2{PCRIndex: 0, EventType: EventTypeNoAction})
+	buf.Write(make([]byte, AlgorithmSha1.size()))
+	binary.Write(&buf, binary.LittleEndian, uint32(specId.Len()))
+	buf.Write(specId.Bytes())
+
+	writeTestLogEvents_2(&buf, events)
+	return buf.Bytes()
+}
+
+func writeTestLogEvents_2(buf *bytes.Buffer, events []testLogEvent) {
+	for _, e := range events {
+		binary.Write(buf, binary.LittleEndian,
+			eventHeader_2{PCRIndex: e.pcrIndex, EventType: e.eventType, Count: e.digestCount})
+		for _, d := range e.digests {
+			binary.Write(buf, binary.LittleEndian, d.alg)
+			buf.Write(d.digest)
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(len(e.data)))
+		buf.Write(e.data)
+		buf.Write(make([]byte, e.padding))
+	}
+}
+
+// makeTestFinalEventsTable creates a final events table (EFI_TCG2_FINAL_EVENTS_TABLE) containing the supplied events.
+func makeTestFinalEventsTable(events []testLogEvent) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint64(1))
+	binary.Write(&buf, binary.LittleEndian, uint64(len(events)))
+	writeTestLogEvents_2(&buf, events)
+	return buf.Bytes()
+}
+
+// makeTestLog_1_2 returns a log in the SHA-1 TCG_PCClientPCREventStruct format, without a Spec ID event.
+func makeTestLog_1_2(events []testLogEvent) []byte {
+	var buf bytes.Buffer
+	for _, e := range events {
+		binary.Write(&buf, binary.LittleEndian, e.pcrIndex)
+		binary.Write(&buf, binary.LittleEndian, e.eventType)
+		buf.Write(AlgorithmSha1.hash(e.data))
+		binary.Write(&buf, binary.LittleEndian, uint32(len(e.data)))
+		buf.Write(e.data)
+	}
+	return buf.Bytes()
+}
+
+func makeTestLogEvent(pcrIndex PCRIndex, eventType EventType, data []byte, algs ...AlgorithmId) testLogEvent {
+	e := testLogEvent{pcrIndex: pcrIndex, eventType: eventType, digestCount: uint32(len(algs)), data: data}
+	for _, alg := range algs {
+		e.digests = append(e.digests, testLogDigest{alg: alg, digest: alg.hash(data)})
+	}
+	return e
+}
+
+func readAllTestLogEvents(t *testing.T, data []byte, options LogOptions) []*Event {
+	log, err := NewLog(bytes.NewReader(data), options)
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	var events []*Event
+	for {
+		event, err := log.NextEvent()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatalf("NextEvent failed: %v", err)
+		}
+		events = append(events, event)
+	}
+}
+
+func TestLogDigestCountMismatch(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+
+	for _, data := range []struct {
+		desc  string
+		count uint32
+	}{
+		{desc: "TooLow", count: 1},
+		{desc: "TooHigh", count: 3},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			e1 := makeTestLogEvent(7, EventTypeEFIAction, []byte("foo"), algs...)
+			e1.digestCount = data.count
+			e2 := makeTestLogEvent(7, EventTypeEFIAction, []byte("bar"), algs...)
+
+			events := readAllTestLogEvents(t, makeTestLog_2(algs, []testLogEvent{e1, e2}), LogOptions{})
+			if len(events) != 3 {
+				t.Fatalf("Unexpected number of events: %d", len(events))
+			}
+			if len(events[1].Quirks) != 1 || events[1].Quirks[0] != EventQuirkDigestCountMismatch {
+				t.Errorf("Expected digest count mismatch quirk")
+			}
+			if len(events[2].Quirks) != 0 {
+				t.Errorf("Unexpected quirks for following event")
+			}
+			for i, s := range []string{"foo", "bar"} {
+				e := events[i+1]
+				if string(e.Data().Bytes()) != s {
+					t.Errorf("Unexpected event data for event %d: %q", i+1, e.Data().Bytes())
+				}
+				for _, alg := range algs {
+					if !bytes.Equal(e.Digests.Get(alg), alg.hash([]byte(s))) {
+						t.Errorf("Unexpected %s digest for event %d", alg, i+1)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLogDigestCountMismatchMissingDigest(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+
+	// The event has the correct number of digests for its count, but is missing the SHA-256 bank from the Spec ID
+	// event, so the event size follows the SHA-1 digest.
+	e := makeTestLogEvent(7, EventTypeEFIAction, []byte("foo"), algs...)
+	e.digestCount = 1
+	e.digests = e.digests[:1]
+
+	log, err := NewLog(bytes.NewReader(makeTestLog_2(algs, []testLogEvent{e})), LogOptions{})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	if _, err := log.NextEvent(); err != nil {
+		t.Fatalf("NextEvent failed: %v", err)
+	}
+	_, err = log.NextEvent()
+	if err == nil {
+		t.Fatalf("NextEvent should have failed")
+	}
+	if err.Error() != "crypto-agile log entry is missing a digest value for algorithm SHA-256 that was "+
+		"present in the Spec ID Event" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestLogExtraDigests(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+
+	for _, data := range []struct {
+		desc  string
+		extra testLogDigest
+		quirk EventQuirk
+	}{
+		{desc: "Duplicate", extra: testLogDigest{alg: AlgorithmSha256, digest: make(Digest, AlgorithmSha256.size())},
+			quirk: EventQuirkDuplicateDigest},
+		{desc: "UnexpectedAlgorithm", extra: testLogDigest{alg: AlgorithmSha384,
+			digest: AlgorithmSha384.hash([]byte("foo"))}, quirk: EventQuirkUnexpectedDigestAlgorithm},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			e1 := makeTestLogEvent(7, EventTypeEFIAction, []byte("foo"), algs...)
+			e1.digests = append(e1.digests, data.extra)
+			e1.digestCount = uint32(len(e1.digests))
+			e2 := makeTestLogEvent(7, EventTypeEFIAction, []byte("bar"), algs...)
+
+			events := readAllTestLogEvents(t, makeTestLog_2(algs, []testLogEvent{e1, e2}), LogOptions{})
+			if len(events) != 3 {
+				t.Fatalf("Unexpected number of events: %d", len(events))
+			}
+			if len(events[1].Quirks) != 1 || events[1].Quirks[0] != data.quirk {
+				t.Errorf("Unexpected quirks: %v", events[1].Quirks)
+			}
+			expectedRaw := TaggedDigestList{
+				{Algorithm: AlgorithmSha1, Digest: AlgorithmSha1.hash([]byte("foo"))},
+				{Algorithm: AlgorithmSha256, Digest: AlgorithmSha256.hash([]byte("foo"))},
+				{Algorithm: data.extra.alg, Digest: data.extra.digest}}
+			if !reflect.DeepEqual(events[1].RawDigests, expectedRaw) {
+				t.Errorf("Unexpected raw digests: %v", events[1].RawDigests)
+			}
+			if !reflect.DeepEqual(events[1].Digests.Algorithms(), AlgorithmIdList(algs)) {
+				t.Errorf("Unexpected digest algorithms: %v", events[1].Digests.Algorithms())
+			}
+			for _, alg := range algs {
+				if !bytes.Equal(events[1].Digests.Get(alg), alg.hash([]byte("foo"))) {
+					t.Errorf("Unexpected %s digest", alg)
+				}
+			}
+			if string(events[2].Data().Bytes()) != "bar" || len(events[2].Quirks) != 0 {
+				t.Errorf("Unexpected following event")
+			}
+		})
+	}
+}
+
+func TestLogTrailingPadding(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+
+	e1 := makeTestLogEvent(7, EventTypeEFIAction, []byte("foo"), algs...)
+	e1.padding = 6
+	e2 := makeTestLogEvent(7, EventTypeEFIAction, []byte("bar"), algs...)
+	e3 := makeTestLogEvent(4, EventTypeEFIAction, []byte("baz"), algs...)
+
+	events := readAllTestLogEvents(t, makeTestLog_2(algs, []testLogEvent{e1, e2, e3}), LogOptions{})
+	if len(events) != 4 {
+		t.Fatalf("Unexpected number of events: %d", len(events))
+	}
+	if len(events[1].Quirks) != 1 || events[1].Quirks[0] != EventQuirkTrailingPadding {
+		t.Errorf("Expected trailing padding quirk")
+	}
+	for i, s := range []string{"foo", "bar", "baz"} {
+		e := events[i+1]
+		if string(e.Data().Bytes()) != s {
+			t.Errorf("Unexpected event data for event %d: %q", i+1, e.Data().Bytes())
+		}
+		if i > 0 && len(e.Quirks) != 0 {
+			t.Errorf("Unexpected quirks for event %d", i+1)
+		}
+	}
+}
+
+func TestLogFindEventsByDigest(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+
+	e1 := makeTestLogEvent(7, EventTypeEFIAction, []byte("foo"), algs...)
+	e2 := makeTestLogEvent(4, EventTypeEFIAction, []byte("bar"), algs...)
+	e3 := makeTestLogEvent(5, EventTypeEFIAction, []byte("foo"), algs...)
+	data := makeTestLog_2(algs, []testLogEvent{e1, e2, e3})
+
+	for _, test := range []struct {
+		desc   string
+		digest []byte
+		pcrs   []PCRIndex
+	}{
+		{desc: "SHA1", digest: AlgorithmSha1.hash([]byte("foo")), pcrs: []PCRIndex{7, 5}},
+		{desc: "SHA256", digest: AlgorithmSha256.hash([]byte("bar")), pcrs: []PCRIndex{4}},
+		{desc: "Prefix", digest: AlgorithmSha256.hash([]byte("bar"))[:4], pcrs: []PCRIndex{4}},
+		{desc: "NoMatch", digest: AlgorithmSha256.hash([]byte("baz"))},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			log, err := NewLog(bytes.NewReader(data), LogOptions{})
+			if err != nil {
+				t.Fatalf("NewLog failed: %v", err)
+			}
+			events, err := log.FindEventsByDigest(test.digest)
+			if err != nil {
+				t.Fatalf("FindEventsByDigest failed: %v", err)
+			}
+			if len(events) != len(test.pcrs) {
+				t.Fatalf("Unexpected number of events: %d", len(events))
+			}
+			for i, e := range events {
+				if e.PCRIndex != test.pcrs[i] {
+					t.Errorf("Unexpected event %d in PCR %d", i, e.PCRIndex)
+				}
+			}
+		})
+	}
+}
+
+func TestLogEstimatedEventCount(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+	var events []testLogEvent
+	for i := 0; i < 100; i++ {
+		events = append(events, makeTestLogEvent(7, EventTypeEFIAction, []byte("action"), algs...))
+	}
+	data := makeTestLog_2(algs, events)
+
+	log, err := NewLog(bytes.NewReader(data), LogOptions{})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	if n := log.estimatedEventCount(); n != len(data)/defaultAverageEventSize {
+		t.Errorf("Unexpected initial estimate: %d", n)
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, err := log.NextEvent(); err != nil {
+			t.Fatalf("NextEvent failed: %v", err)
+		}
+	}
+	// The first event is the larger Spec ID event, so the estimate is slightly low but in the right ballpark.
+	if n := log.estimatedEventCount(); n < 90 || n > 101 {
+		t.Errorf("Unexpected estimate after reading events: %d", n)
+	}
+
+	log, err = NewLog(bytes.NewReader(data), LogOptions{ExpectedEventCount: 5000})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	if n := log.estimatedEventCount(); n != 5000 {
+		t.Errorf("Unexpected estimate with hint: %d", n)
+	}
+
+	log, err = NewLog(bytes.NewReader(data), LogOptions{ExpectedEventCount: 1 << 40})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	if n := log.estimatedEventCount(); n != maxEstimatedEventCount {
+		t.Errorf("Unexpected estimate with huge hint: %d", n)
+	}
+}
+
+func TestLogEstimatedEventCountUnknownSize(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+	data := makeTestLog_2(algs, []testLogEvent{makeTestLogEvent(7, EventTypeEFIAction, []byte("action"), algs...)})
+
+	log, err := NewLog(&testReaderAt{data}, LogOptions{})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	if n := log.estimatedEventCount(); n != 0 {
+		t.Errorf("Unexpected initial estimate: %d", n)
+	}
+	if _, err := log.NextEvent(); err != nil {
+		t.Fatalf("NextEvent failed: %v", err)
+	}
+	if n := log.estimatedEventCount(); n != 1 {
+		t.Errorf("Unexpected estimate after reading events: %d", n)
+	}
+}
+
+// testReaderAt is an io.ReaderAt that doesn't expose its size.
+type testReaderAt struct {
+	data []byte
+}
+
+func (r *testReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(r.data).ReadAt(p, off)
+}
+
+func TestFinalEventsLog(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+	log, err := NewLog(bytes.NewReader(makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(4, EventTypeEFIAction, []byte("Calling EFI Application from Boot Option"), algs...),
+		makeTestLogEvent(4, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...),
+	})), LogOptions{})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	for {
+		if _, err := log.NextEvent(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("NextEvent failed: %v", err)
+		}
+	}
+
+	// Data after the number of events in the header is ignored.
+	table := makeTestFinalEventsTable([]testLogEvent{
+		makeTestLogEvent(4, EventTypeEFIAction, []byte("Exit Boot Services Invocation"), algs...),
+		makeTestLogEvent(5, EventTypeEFIAction, []byte("Exit Boot Services Returned with Success"), algs...),
+	})
+	table = append(table, 0xff, 0xff, 0xff, 0xff)
+
+	finalLog, err := NewFinalEventsLog(bytes.NewReader(table), log, LogOptions{})
+	if err != nil {
+		t.Fatalf("NewFinalEventsLog failed: %v", err)
+	}
+	var events []*Event
+	for {
+		event, err := finalLog.NextEvent()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("NextEvent failed: %v", err)
+		}
+		events = append(events, event)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Unexpected number of events: %d", len(events))
+	}
+	if events[0].PCRIndex != 4 || events[0].Index != 2 {
+		t.Errorf("Unexpected first event: PCR %d, index %d", events[0].PCRIndex, events[0].Index)
+	}
+	if events[1].PCRIndex != 5 || events[1].Index != 0 {
+		t.Errorf("Unexpected second event: PCR %d, index %d", events[1].PCRIndex, events[1].Index)
+	}
+	if !bytes.Equal(events[0].Digests.Get(AlgorithmSha256),
+		AlgorithmSha256.hash([]byte("Exit Boot Services Invocation"))) {
+		t.Errorf("Unexpected digest for first event")
+	}
+}
+
+func TestFinalEventsLogInvalidVersion(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+	log, err := NewLog(bytes.NewReader(makeTestLog_2(algs, nil)), LogOptions{})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	table := makeTestFinalEventsTable(nil)
+	table[0] = 2
+	if _, err := NewFinalEventsLog(bytes.NewReader(table), log, LogOptions{}); err == nil {
+		t.Errorf("NewFinalEventsLog should have failed")
+	}
+}
+
+func TestFinalEventsLogHugeEventCount(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+	log, err := NewLog(bytes.NewReader(makeTestLog_2(algs, nil)), LogOptions{})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	table := makeTestFinalEventsTable([]testLogEvent{
+		makeTestLogEvent(5, EventTypeEFIAction, []byte("Exit Boot Services Invocation"), algs...)})
+	binary.LittleEndian.PutUint64(table[8:], 1<<40)
+
+	finalLog, err := NewFinalEventsLog(bytes.NewReader(table), log, LogOptions{})
+	if err != nil {
+		t.Fatalf("NewFinalEventsLog failed: %v", err)
+	}
+	if n := finalLog.estimatedEventCount(); n != maxEstimatedEventCount {
+		t.Errorf("Unexpected estimate: %d", n)
+	}
+	if _, err := finalLog.NextEvent(); err != nil {
+		t.Fatalf("NextEvent failed: %v", err)
+	}
+	if _, err := finalLog.NextEvent(); err == nil {
+		t.Errorf("NextEvent should have failed")
+	}
+}
+
+func TestLogPermissive(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+	events := []testLogEvent{
+		makeTestLogEvent(0, EventTypeSCRTMVersion, []byte("1.0\x00"), algs...),
+		makeTestLogEvent(4, EventTypeEFIAction, []byte("corrupt"), algs...),
+		makeTestLogEvent(7, EventTypeEFIAction, []byte("foo"), algs...),
+		makeTestLogEvent(7, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...)}
+
+	offset := len(makeTestLog_2(algs, events[:1]))
+	end := len(makeTestLog_2(algs, events[:2]))
+	data := makeTestLog_2(algs, events)
+	binary.LittleEndian.PutUint32(data[offset:], 0xffffffff)
+
+	log, err := NewLog(bytes.NewReader(data), LogOptions{})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	for {
+		if _, err = log.NextEvent(); err != nil {
+			break
+		}
+	}
+	if err == io.EOF {
+		t.Errorf("Reading the log should fail without permissive mode")
+	}
+
+	log, err = NewLog(bytes.NewReader(data), LogOptions{Permissive: true})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	var read []*Event
+	for {
+		e, err := log.NextEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextEvent failed: %v", err)
+		}
+		read = append(read, e)
+	}
+
+	if len(read) != 4 {
+		t.Fatalf("Unexpected number of events: %d", len(read))
+	}
+	if read[1].EventType != EventTypeSCRTMVersion || len(read[1].Quirks) != 0 {
+		t.Errorf("Unexpected event before gap: %s (quirks: %v)", read[1].EventType, read[1].Quirks)
+	}
+	if string(read[2].Data().Bytes()) != "foo" || len(read[2].Quirks) != 1 || read[2].Quirks[0] != EventQuirkPrecededByGap {
+		t.Errorf("Unexpected event after gap: %q (quirks: %v)", read[2].Data().Bytes(), read[2].Quirks)
+	}
+	if len(read[3].Quirks) != 0 {
+		t.Errorf("Unexpected quirks for following event: %v", read[3].Quirks)
+	}
+
+	gaps := log.Gaps()
+	if len(gaps) != 1 || gaps[0].Offset != int64(offset) || gaps[0].Length != int64(end-offset) || gaps[0].Err == nil {
+		t.Errorf("Unexpected gaps: %+v", gaps)
+	}
+}
+
+func TestLogPermissiveTruncated(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+	events := []testLogEvent{
+		makeTestLogEvent(7, EventTypeEFIAction, []byte("foo"), algs...),
+		makeTestLogEvent(7, EventTypeEFIAction, []byte("bar"), algs...)}
+
+	offset := len(makeTestLog_2(algs, events[:1]))
+	data := makeTestLog_2(algs, events)
+	data = data[:len(data)-2]
+
+	log, err := NewLog(bytes.NewReader(data), LogOptions{Permissive: true})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	var n int
+	for {
+		_, err := log.NextEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextEvent failed: %v", err)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("Unexpected number of events: %d", n)
+	}
+
+	gaps := log.Gaps()
+	if len(gaps) != 1 || gaps[0].Offset != int64(offset) || gaps[0].Length != int64(len(data)-offset) {
+		t.Errorf("Unexpected gaps: %+v", gaps)
+	}
+}
+
+func TestLogMaxEventDataSize(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+	events := []testLogEvent{
+		makeTestLogEvent(7, EventTypeEFIAction, bytes.Repeat([]byte("a"), 64), algs...),
+		makeTestLogEvent(7, EventTypeEFIAction, bytes.Repeat([]byte("b"), 100), algs...)}
+	data := makeTestLog_2(algs, events)
+
+	readEvents := func(data []byte, options LogOptions) (n int, err error) {
+		log, err := NewLog(bytes.NewReader(data), options)
+		if err != nil {
+			t.Fatalf("NewLog failed: %v", err)
+		}
+		for {
+			if _, err := log.NextEvent(); err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				return n, err
+			}
+			n++
+		}
+	}
+
+	n, err := readEvents(data, LogOptions{MaxEventDataSize: 64})
+	if err == nil {
+		t.Errorf("Reading the log should fail with a limit that is smaller than an event")
+	}
+	if n != 2 {
+		t.Errorf("Unexpected number of events before failure: %d", n)
+	}
+	if n, err := readEvents(data, LogOptions{MaxEventDataSize: 100}); err != nil || n != 3 {
+		t.Errorf("Unexpected result with a limit that is the same as the largest event: %d, %v", n, err)
+	}
+
+	// An event that declares a huge size shouldn't cause a huge allocation with the default limit.
+	offset := len(makeTestLog_2(algs, events[:1]))
+	eventSizeOffset := offset + binary.Size(eventHeader_2{}) + binary.Size(AlgorithmSha256) + AlgorithmSha256.size()
+	binary.LittleEndian.PutUint32(data[eventSizeOffset:], 0xfffffff0)
+	if _, err := readEvents(data, LogOptions{}); err == nil {
+		t.Errorf("Reading the log should fail with an event that exceeds the default limit")
+	}
+}
+
+func TestLogDuplicateSpecIdEvent(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+
+	// Repeat the Spec ID event in the same format as the first event of the log, followed by another copy in the
+	// crypto-agile format in PCR 1.
+	header := makeTestLog_2(algs, nil)
+	var buf bytes.Buffer
+	buf.Write(header)
+	buf.Write(header)
+	specId := makeTestLogEvent(1, EventTypeNoAction, header[32:], algs...)
+	for i := range specId.digests {
+		specId.digests[i].digest = make(Digest, specId.digests[i].alg.size())
+	}
+	writeTestLogEvents_2(&buf, []testLogEvent{
+		specId,
+		makeTestLogEvent(7, EventTypeEFIAction, []byte("foo"), algs...)})
+
+	log, err := NewLog(bytes.NewReader(buf.Bytes()), LogOptions{})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	if log.Spec != SpecEFI_2 {
+		t.Errorf("Unexpected spec: %v", log.Spec)
+	}
+	var events []*Event
+	for {
+		event, err := log.NextEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextEvent failed: %v", err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 4 {
+		t.Fatalf("Unexpected number of events: %d", len(events))
+	}
+
+	headers := log.HeaderEvents()
+	if len(headers) != 3 {
+		t.Fatalf("Unexpected number of header events: %d", len(headers))
+	}
+	for i, e := range headers {
+		if e != events[i] {
+			t.Errorf("Unexpected header event %d", i)
+		}
+		if d, ok := e.Data().(*SpecIdEventData); !ok || d.Spec != SpecEFI_2 || len(d.DigestSizes) != len(algs) {
+			t.Errorf("Unexpected data for header event %d: %v", i, e.Data())
+		}
+		if e.HasQuirk(EventQuirkUnexpectedSpecIdEvent) != (i > 0) {
+			t.Errorf("Unexpected quirks for header event %d: %v", i, e.Quirks)
+		}
+		if e.HasQuirk(EventQuirkTrailingPadding) {
+			t.Errorf("Header event %d shouldn't be followed by padding", i)
+		}
+		for _, alg := range algs {
+			if !bytes.Equal(e.Digests.Get(alg), zeroDigests[alg]) {
+				t.Errorf("Unexpected %s digest for header event %d", alg, i)
+			}
+		}
+	}
+	if headers[2].PCRIndex != 1 {
+		t.Errorf("Unexpected PCR for last header event: %d", headers[2].PCRIndex)
+	}
+
+	if string(events[3].Data().Bytes()) != "foo" || len(events[3].Quirks) != 0 {
+		t.Errorf("Unexpected final event: %q (quirks: %v)", events[3].Data().Bytes(), events[3].Quirks)
+	}
+}
+
+func TestLogWithoutSpecIdEvent(t *testing.T) {
+	data := makeTestLog_1_2([]testLogEvent{
+		makeTestLogEvent(0, EventTypeSCRTMVersion, []byte("1.0")),
+		makeTestLogEvent(4, EventTypeEFIAction, []byte("Calling EFI Application from Boot Option")),
+		makeTestLogEvent(4, EventTypeSeparator, []byte{0, 0, 0, 0})})
+
+	log, err := NewLog(bytes.NewReader(data), LogOptions{})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	if log.Spec != SpecUnknown || len(log.Algorithms) != 1 || log.Algorithms[0] != AlgorithmSha1 {
+		t.Errorf("Unexpected log format (spec: %v, algorithms: %v)", log.Spec, log.Algorithms)
+	}
+	events := readAllTestLogEvents(t, data, LogOptions{})
+	if len(events) != 3 || events[2].EventType != EventTypeSeparator {
+		t.Errorf("Unexpected events")
+	}
+	expected := AlgorithmSha1.hash([]byte("Calling EFI Application from Boot Option"))
+	if !bytes.Equal(events[1].Digests.Get(AlgorithmSha1), expected) {
+		t.Errorf("Unexpected digest: %x", events[1].Digests.Get(AlgorithmSha1))
+	}
+
+	for _, data := range []struct {
+		desc  string
+		first testLogEvent
+		err   string
+	}{
+		{desc: "UnsupportedSpecIdEvent", first: makeTestLogEvent(0, EventTypeNoAction, []byte("Spec ID Event04\x00\x00")),
+			err: "log begins with an unsupported Spec ID event (\"Spec ID Event04\")"},
+		{desc: "Zeroes", first: makeTestLogEvent(0, EventTypePrebootCert, nil),
+			err: "log doesn't begin with a Spec ID event or a recognized event (type: EV_PREBOOT_CERT)"},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			_, err := NewLog(bytes.NewReader(makeTestLog_1_2([]testLogEvent{data.first})), LogOptions{})
+			if err == nil || err.Error() != data.err {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLogLazyDecoding(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+	events := readAllTestLogEvents(t, makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(7, EventTypeEFIVariableDriverConfig,
+			makeTestVariableEventData(convertStringToUtf16("SecureBoot")), algs...),
+		makeTestLogEvent(7, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...)}), LogOptions{})
+	if len(events) != 3 {
+		t.Fatalf("Unexpected number of events: %d", len(events))
+	}
+
+	for i, e := range events[1:] {
+		if e.lazy == nil || e.lazy.decoded.data != nil {
+			t.Errorf("Data for event %d was decoded when it was read", i+1)
+		}
+	}
+
+	d, ok := events[1].Data().(*EFIVariableEventData)
+	if !ok || d.UnicodeName != "SecureBoot" {
+		t.Errorf("Unexpected data for event 1: %v", events[1].Data())
+	}
+	if events[1].Data() != d {
+		t.Errorf("Data for event 1 was decoded more than once")
+	}
+	if events[1].DecodeError() != nil || events[1].DataConsumed() != len(d.Bytes()) {
+		t.Errorf("Unexpected decode result for event 1 (error: %v, consumed: %d)", events[1].DecodeError(),
+			events[1].DataConsumed())
+	}
+	if events[2].lazy.decoded.data != nil {
+		t.Errorf("Data for event 2 was decoded when accessing event 1")
+	}
+}
+
+// makeBenchmarkLog returns a crypto-agile log with a mix of events that is similar in size and content to the log
+// of a typical machine.
+func makeBenchmarkLog() []byte {
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+
+	var imageLoad bytes.Buffer
+	path := encodeTestDevicePath(makeTestBootDevicePath())
+	binary.Write(&imageLoad, binary.LittleEndian, uint64(0x7c000000))
+	binary.Write(&imageLoad, binary.LittleEndian, uint64(0x100000))
+	binary.Write(&imageLoad, binary.LittleEndian, uint64(0))
+	binary.Write(&imageLoad, binary.LittleEndian, uint64(len(path)))
+	imageLoad.Write(path)
+
+	var events []testLogEvent
+	for i := 0; i < 20; i++ {
+		events = append(events,
+			makeTestLogEvent(7, EventTypeEFIVariableDriverConfig,
+				makeTestVariableEventData(convertStringToUtf16("SecureBoot")), algs...),
+			makeTestLogEvent(1, EventTypeEFIVariableBoot,
+				makeTestVariableEventData(convertStringToUtf16("Boot0001")), algs...),
+			makeTestLogEvent(4, EventTypeEFIAction, []byte("Calling EFI Application from Boot Option"), algs...),
+			makeTestLogEvent(4, EventTypeEFIBootServicesApplication, imageLoad.Bytes(), algs...),
+			makeTestLogEvent(8, EventTypeIPL, []byte("grub_cmd: linux /vmlinuz root=/dev/sda1 ro quiet\x00"),
+				algs...))
+	}
+	for pcr := PCRIndex(0); pcr < 8; pcr++ {
+		events = append(events, makeTestLogEvent(pcr, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...))
+	}
+	return makeTestLog_2(algs, events)
+}
+
+func benchmarkReadLog(b *testing.B, decode bool) {
+	data := makeBenchmarkLog()
+	options := LogOptions{EnableGrub: true}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		log, err := NewLog(bytes.NewReader(data), options)
+		if err != nil {
+			b.Fatalf("NewLog failed: %v", err)
+		}
+		for {
+			event, err := log.NextEvent()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatalf("NextEvent failed: %v", err)
+			}
+			if decode {
+				event.Data()
+			}
+		}
+	}
+}
+
+func BenchmarkReadLog(b *testing.B) {
+	benchmarkReadLog(b, false)
+}
+
+func BenchmarkReadLogAndDecodeEventData(b *testing.B) {
+	benchmarkReadLog(b, true)
+}
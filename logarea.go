@@ -0,0 +1,202 @@
+package tcglog
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// ACPILogArea describes the region of memory that firmware reserves for the event log, as advertised to the OS by the
+// ACPI TPM2 table (or the TCPA table on platforms with a TPM 1.2 device). Hypervisors that provide a virtual TPM
+// advertise the log in the same way. Confidential computing guests (eg, Intel TDX) advertise their event log with the
+// CCEL table.
+type ACPILogArea struct {
+	MinimumLength uint32 // Log Area Minimum Length (LAML), which is the size of the log area
+	StartAddress  uint64 // Log Area Start Address (LASA), which is the physical address of the log area
+}
+
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_ACPIGeneralSpecification_v1.20_r8.pdf
+//  (section 7.1 "ACPI Table Layout" and section 8.1 "TPM2 ACPI Table")
+const (
+	acpiTableHeaderSize = 36
+
+	// The offset of LAML in the client TCPA table, after PlatformClass.
+	acpiTCPALAMLOffset = acpiTableHeaderSize + 2
+
+	// The offset of LAML in the TPM2 table, after PlatformClass, Reserved, AddressOfControlArea, StartMethod and
+	// 12 bytes of StartMethodSpecificParameters.
+	acpiTPM2LAMLOffset = acpiTableHeaderSize + 28
+
+	// The offset of LAML in the CCEL table, after CC Type, CC Subtype and Reserved. LAML is 64 bits in this table.
+	acpiCCELLAMLOffset = acpiTableHeaderSize + 4
+)
+
+// DecodeACPILogArea decodes the log area fields from the supplied ACPI TPM2, TCPA or CCEL table, such as one read from
+// /sys/firmware/acpi/tables/TPM2 on Linux. The log itself can then be read from physical memory with NewLogFromArea.
+// An error is returned if the table isn't a TPM2, TCPA or CCEL table, or if it doesn't advertise a log area - the LAML
+// and LASA fields are optional in the TPM2 table.
+func DecodeACPILogArea(table []byte) (*ACPILogArea, error) {
+	if len(table) < acpiTableHeaderSize {
+		return nil, errors.New("table is too short for an ACPI table header")
+	}
+	length := binary.LittleEndian.Uint32(table[4:])
+	if uint64(length) > uint64(len(table)) {
+		return nil, fmt.Errorf("table is shorter than its header indicates (%d bytes)", length)
+	}
+	table = table[:length]
+
+	var offset, lamlSize int
+	switch string(table[0:4]) {
+	case "TPM2":
+		offset, lamlSize = acpiTPM2LAMLOffset, 4
+	case "TCPA":
+		offset, lamlSize = acpiTCPALAMLOffset, 4
+	case "CCEL":
+		offset, lamlSize = acpiCCELLAMLOffset, 8
+	default:
+		return nil, fmt.Errorf("unexpected ACPI table signature %q", table[0:4])
+	}
+	if len(table) < offset+lamlSize+8 {
+		return nil, errors.New("table doesn't contain a log area")
+	}
+
+	area := &ACPILogArea{StartAddress: binary.LittleEndian.Uint64(table[offset+lamlSize:])}
+	if lamlSize == 8 {
+		laml := binary.LittleEndian.Uint64(table[offset:])
+		if laml > math.MaxUint32 {
+			return nil, fmt.Errorf("log area is too large (%d bytes)", laml)
+		}
+		area.MinimumLength = uint32(laml)
+	} else {
+		area.MinimumLength = binary.LittleEndian.Uint32(table[offset:])
+	}
+	if area.MinimumLength == 0 || area.StartAddress == 0 {
+		return nil, errors.New("table doesn't contain a log area")
+	}
+	return area, nil
+}
+
+// logAreaEnd returns the offset of the start of the unused part of a fixed size log area read from r, which is the
+// start of the run of 0x00 or 0xff bytes at the end of the area. Firmware normally zeroes the unused part of the
+// area, but some implementations leave it filled with 0xff.
+func logAreaEnd(r io.ReaderAt, size int64) (int64, error) {
+	const chunkSize = 4096
+
+	if size == 0 {
+		return 0, nil
+	}
+
+	buf := make([]byte, chunkSize)
+	if _, err := r.ReadAt(buf[:1], size-1); err != nil {
+		return 0, err
+	}
+	fill := buf[0]
+	if fill != 0x00 && fill != 0xff {
+		// The log fills the entire area.
+		return size, nil
+	}
+
+	end := size
+	for end > 0 {
+		start := end - chunkSize
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+		if _, err := r.ReadAt(chunk, start); err != nil {
+			return 0, err
+		}
+		for len(chunk) > 0 && chunk[len(chunk)-1] == fill {
+			chunk = chunk[:len(chunk)-1]
+		}
+		end = start + int64(len(chunk))
+		if len(chunk) > 0 {
+			break
+		}
+	}
+	return end, nil
+}
+
+// NewLogFromArea creates a new Log instance that reads an event log from a fixed size log area of the specified size,
+// such as the area described by ACPILogArea or the log buffer that QEMU provides to guest firmware through fw_cfg. A
+// log area contains a log in the same format as the one exposed by the Linux kernel, followed by unused space which
+// is treated as the end of the log. Reading from a log area with NewLog would fail when it reaches the unused space.
+//
+// There is no special handling for the log area of a Hyper-V virtual TPM. Its firmware advertises the log area in the
+// ACPI TPM2 table in the same way as physical platforms, and the log uses the standard TCG format, so the only
+// framing difference from the log exposed by the kernel is the unused space, which is handled here regardless of
+// whether it is filled with 0x00 or 0xff bytes. Quirks in the contents of individual events are handled by the same
+// code that handles them for physical platforms.
+func NewLogFromArea(r io.ReaderAt, size int64, options LogOptions) (*Log, error) {
+	area := io.NewSectionReader(r, 0, size)
+
+	end, err := logAreaEnd(area, size)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine the end of the log: %v", err)
+	}
+	if end == 0 {
+		return nil, errors.New("log area is empty")
+	}
+
+	log, err := NewLog(area, options)
+	if err != nil {
+		return nil, err
+	}
+	log.size = end
+	log.areaEnd = end
+	return log, nil
+}
+
+// replayAndValidateLogArea replays and validates the log read with newLog from the log area at logPath. The expected
+// values of resetPCRs are present in the result even if the log doesn't extend them, starting from zero. Other PCRs
+// are only present if the log extends them, as the log doesn't say anything about their values otherwise - the Spec ID
+// event is recorded to PCR 0, but that doesn't mean that PCR 0 is used.
+func replayAndValidateLogArea(logPath string, options LogOptions,
+	newLog func(io.ReaderAt, int64, LogOptions) (*Log, error), resetPCRs []PCRIndex) (*LogValidateResult, error) {
+	file, err := os.Open(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	log, err := newLog(file, fi.Size(), options)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &logValidator{log: log, expectedPCRValues: make(PCRValues), options: options}
+	keep := make(map[PCRIndex]bool)
+	for _, pcr := range resetPCRs {
+		keep[pcr] = true
+		v.expectedPCRValues[pcr] = DigestMap{}
+		for _, alg := range log.Algorithms {
+			v.expectedPCRValues[pcr][alg] = make(Digest, alg.size())
+		}
+	}
+
+	result, err := v.run(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range result.ValidatedEvents {
+		if doesEventTypeExtendPCR(e.Event.EventType) {
+			keep[e.Event.PCRIndex] = true
+		}
+	}
+	for pcr := range result.ExpectedPCRValues {
+		if !keep[pcr] {
+			delete(result.ExpectedPCRValues, pcr)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,126 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func makeTestACPITable(signature string, body []byte) []byte {
+	table := make([]byte, acpiTableHeaderSize)
+	copy(table, signature)
+	binary.LittleEndian.PutUint32(table[4:], uint32(acpiTableHeaderSize+len(body)))
+	return append(table, body...)
+}
+
+func TestDecodeACPILogArea(t *testing.T) {
+	var tpm2 bytes.Buffer
+	tpm2.Write(make([]byte, 28)) // PlatformClass to StartMethodSpecificParameters
+	binary.Write(&tpm2, binary.LittleEndian, uint32(0x10000))
+	binary.Write(&tpm2, binary.LittleEndian, uint64(0x7fa0c000))
+
+	var tcpa bytes.Buffer
+	binary.Write(&tcpa, binary.LittleEndian, uint16(0))
+	binary.Write(&tcpa, binary.LittleEndian, uint32(0x10000))
+	binary.Write(&tcpa, binary.LittleEndian, uint64(0xbffbd000))
+
+	var ccel bytes.Buffer
+	ccel.Write([]byte{2, 0, 0, 0}) // CC Type (TDX), CC Subtype and Reserved
+	binary.Write(&ccel, binary.LittleEndian, uint64(0x10000))
+	binary.Write(&ccel, binary.LittleEndian, uint64(0x7d8c0000))
+
+	for _, data := range []struct {
+		desc     string
+		table    []byte
+		expected *ACPILogArea
+	}{
+		{desc: "TPM2", table: makeTestACPITable("TPM2", tpm2.Bytes()),
+			expected: &ACPILogArea{MinimumLength: 0x10000, StartAddress: 0x7fa0c000}},
+		{desc: "TCPA", table: makeTestACPITable("TCPA", tcpa.Bytes()),
+			expected: &ACPILogArea{MinimumLength: 0x10000, StartAddress: 0xbffbd000}},
+		{desc: "CCEL", table: makeTestACPITable("CCEL", ccel.Bytes()),
+			expected: &ACPILogArea{MinimumLength: 0x10000, StartAddress: 0x7d8c0000}},
+		{desc: "TPM2WithoutLogArea", table: makeTestACPITable("TPM2", make([]byte, 16))},
+		{desc: "TPM2WithZeroLogArea", table: makeTestACPITable("TPM2", make([]byte, 40))},
+		{desc: "WrongSignature", table: makeTestACPITable("APIC", tpm2.Bytes())},
+		{desc: "Truncated", table: makeTestACPITable("TPM2", tpm2.Bytes())[:60]},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			area, err := DecodeACPILogArea(data.table)
+			if data.expected == nil {
+				if err == nil {
+					t.Errorf("DecodeACPILogArea should have failed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeACPILogArea failed: %v", err)
+			}
+			if *area != *data.expected {
+				t.Errorf("Unexpected log area: %+v", area)
+			}
+		})
+	}
+}
+
+func TestNewLogFromArea(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+	log := makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(4, EventTypeEFIAction, []byte("Calling EFI Application from Boot Option"), algs...),
+		makeTestLogEvent(7, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...)})
+
+	for _, data := range []struct {
+		desc string
+		fill byte
+		n    int
+	}{
+		{desc: "ZeroFilled", fill: 0x00, n: 8192},
+		{desc: "FFFilled", fill: 0xff, n: 5000},
+		{desc: "Full", n: 0},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			area := append(append([]byte(nil), log...), bytes.Repeat([]byte{data.fill}, data.n)...)
+
+			l, err := NewLogFromArea(bytes.NewReader(area), int64(len(area)), LogOptions{})
+			if err != nil {
+				t.Fatalf("NewLogFromArea failed: %v", err)
+			}
+			var n int
+			for {
+				_, err := l.NextEvent()
+				if err != nil {
+					if err != io.EOF {
+						t.Fatalf("NextEvent failed: %v", err)
+					}
+					break
+				}
+				n++
+			}
+			if n != 3 {
+				t.Errorf("Unexpected number of events: %d", n)
+			}
+		})
+	}
+
+	// Reading a log area as a normal log doesn't stop at the unused space - it either fails or decodes the unused
+	// space as bogus events.
+	area := append(append([]byte(nil), log...), make([]byte, 4096)...)
+	l, err := NewLog(bytes.NewReader(area), LogOptions{})
+	if err != nil {
+		t.Fatalf("NewLog failed: %v", err)
+	}
+	var n int
+	for ; ; n++ {
+		if _, err = l.NextEvent(); err != nil {
+			break
+		}
+	}
+	if err == io.EOF && n == 3 {
+		t.Errorf("Reading a log area with NewLog should not stop at the unused space")
+	}
+
+	if _, err := NewLogFromArea(bytes.NewReader(make([]byte, 4096)), 4096, LogOptions{}); err == nil {
+		t.Errorf("NewLogFromArea should fail with an empty log area")
+	}
+}
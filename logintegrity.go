@@ -0,0 +1,172 @@
+package tcglog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// LogIntegrityStatus indicates the outcome of verifying a log against an integrity value provided by the platform.
+type LogIntegrityStatus int
+
+const (
+	// LogIntegrityNotPresent indicates that the platform doesn't provide an integrity value for the mechanism.
+	LogIntegrityNotPresent LogIntegrityStatus = iota
+
+	// LogIntegrityVerified indicates that the log is consistent with the integrity value provided by the platform.
+	LogIntegrityVerified
+
+	// LogIntegrityMismatch indicates that the log is not consistent with the integrity value provided by the
+	// platform, which means that it was modified after the value was recorded.
+	LogIntegrityMismatch
+)
+
+func (s LogIntegrityStatus) String() string {
+	switch s {
+	case LogIntegrityNotPresent:
+		return "not present"
+	case LogIntegrityVerified:
+		return "verified"
+	case LogIntegrityMismatch:
+		return "mismatch"
+	default:
+		return fmt.Sprintf("LogIntegrityStatus(%d)", int(s))
+	}
+}
+
+// LogIntegrityResult is the result of verifying a log with a LogIntegrityVerifier.
+type LogIntegrityResult struct {
+	Mechanism   string // The name of the verifier that produced this result
+	Status      LogIntegrityStatus
+	Description string // Details of the result, eg, the expected and actual digests for a mismatch
+}
+
+// LogIntegrityVerifier is implemented by types that understand a platform specific mechanism for recording the
+// integrity of the event log, such as a digest of the log stored in an NV index or in a final event.
+type LogIntegrityVerifier interface {
+	// Name returns the name of the mechanism supported by this verifier.
+	Name() string
+
+	// VerifyLogIntegrity verifies the supplied raw event log against the integrity value provided by the platform.
+	// The Mechanism field of the returned result doesn't need to be set. An error should only be returned if the
+	// integrity value can't be obtained - a platform that doesn't provide one should be reported with a status of
+	// LogIntegrityNotPresent.
+	VerifyLogIntegrity(ctx context.Context, log []byte) (*LogIntegrityResult, error)
+}
+
+// ErrNVIndexNotDefined should be returned from NVIndexReader.ReadNVIndex when the requested index isn't defined.
+var ErrNVIndexNotDefined = errors.New("NV index is not defined")
+
+// NVIndexReader is implemented by types that can read the contents of NV indices from a TPM. This allows the TPM
+// access to be supplied by the caller so that this package doesn't depend on a particular TPM library.
+type NVIndexReader interface {
+	ReadNVIndex(ctx context.Context, index uint32) ([]byte, error)
+}
+
+// NVLogDigestVerifier is a LogIntegrityVerifier for platforms that store a digest of the entire event log in an NV
+// index. The index contains the digest, and may contain additional data after it that is ignored.
+type NVLogDigestVerifier struct {
+	Reader    NVIndexReader
+	Index     uint32
+	Algorithm AlgorithmId
+}
+
+func (v *NVLogDigestVerifier) Name() string {
+	return fmt.Sprintf("NV index 0x%08x (%s)", v.Index, v.Algorithm)
+}
+
+func (v *NVLogDigestVerifier) VerifyLogIntegrity(ctx context.Context, log []byte) (*LogIntegrityResult, error) {
+	if !v.Algorithm.supported() {
+		return nil, fmt.Errorf("unsupported algorithm %s", v.Algorithm)
+	}
+
+	data, err := v.Reader.ReadNVIndex(ctx, v.Index)
+	switch {
+	case err == ErrNVIndexNotDefined:
+		return &LogIntegrityResult{Status: LogIntegrityNotPresent}, nil
+	case err != nil:
+		return nil, fmt.Errorf("cannot read NV index 0x%08x: %v", v.Index, err)
+	}
+
+	return compareLogDigest(v.Algorithm, data, log), nil
+}
+
+// LogDigestEventVerifier is a LogIntegrityVerifier for platforms that record a digest of the event log in an event,
+// normally the last one. The last event selected by Filter must have event data that begins with the digest of all
+// of the events that precede it in the log, using the specified algorithm.
+type LogDigestEventVerifier struct {
+	Filter    EventFilter
+	Algorithm AlgorithmId
+}
+
+func (v *LogDigestEventVerifier) Name() string {
+	return fmt.Sprintf("log digest event (%s)", v.Algorithm)
+}
+
+func (v *LogDigestEventVerifier) VerifyLogIntegrity(ctx context.Context, log []byte) (*LogIntegrityResult, error) {
+	if !v.Algorithm.supported() {
+		return nil, fmt.Errorf("unsupported algorithm %s", v.Algorithm)
+	}
+
+	l, err := NewLog(bytes.NewReader(log), LogOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var event *Event
+	var offset int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		start := l.bytesRead
+		e, err := l.NextEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if v.Filter.Match(e) {
+			event, offset = e, start
+		}
+	}
+
+	if event == nil || event.Data() == nil {
+		return &LogIntegrityResult{Status: LogIntegrityNotPresent}, nil
+	}
+	return compareLogDigest(v.Algorithm, event.Data().Bytes(), log[:offset]), nil
+}
+
+// compareLogDigest compares the digest at the start of recorded with the digest of log.
+func compareLogDigest(alg AlgorithmId, recorded, log []byte) *LogIntegrityResult {
+	digest := alg.hash(log)
+	if len(recorded) < len(digest) {
+		return &LogIntegrityResult{
+			Status:      LogIntegrityMismatch,
+			Description: fmt.Sprintf("recorded value is too short for a %s digest (%d bytes)", alg, len(recorded))}
+	}
+	if !bytes.Equal(recorded[:len(digest)], digest) {
+		return &LogIntegrityResult{
+			Status:      LogIntegrityMismatch,
+			Description: fmt.Sprintf("recorded digest: %x, digest of log: %x", recorded[:len(digest)], digest)}
+	}
+	return &LogIntegrityResult{Status: LogIntegrityVerified, Description: fmt.Sprintf("%s digest: %x", alg, digest)}
+}
+
+// VerifyLogIntegrity verifies the supplied raw event log with each of the supplied verifiers, and returns a result
+// for each of them.
+func VerifyLogIntegrity(ctx context.Context, log []byte, verifiers []LogIntegrityVerifier) ([]LogIntegrityResult, error) {
+	var results []LogIntegrityResult
+	for _, v := range verifiers {
+		r, err := v.VerifyLogIntegrity(ctx, log)
+		if err != nil {
+			return nil, fmt.Errorf("cannot verify log integrity with %s: %v", v.Name(), err)
+		}
+		r.Mechanism = v.Name()
+		results = append(results, *r)
+	}
+	return results, nil
+}
@@ -0,0 +1,98 @@
+package tcglog
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+type testNVIndexReader map[uint32][]byte
+
+func (r testNVIndexReader) ReadNVIndex(ctx context.Context, index uint32) ([]byte, error) {
+	data, ok := r[index]
+	if !ok {
+		return nil, ErrNVIndexNotDefined
+	}
+	return data, nil
+}
+
+func makeTestLogIntegrityLog() []byte {
+	algs := []AlgorithmId{AlgorithmSha256}
+	return makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(0, EventTypeAction, []byte("action"), algs...),
+		makeTestLogEvent(0, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...)})
+}
+
+func TestNVLogDigestVerifier(t *testing.T) {
+	log := makeTestLogIntegrityLog()
+	digest := AlgorithmSha256.hash(log)
+
+	for _, data := range []struct {
+		desc     string
+		nv       testNVIndexReader
+		expected LogIntegrityStatus
+	}{
+		{desc: "Verified", nv: testNVIndexReader{0x1c00100: append(digest, 0xff, 0xff)}, expected: LogIntegrityVerified},
+		{desc: "Mismatch", nv: testNVIndexReader{0x1c00100: make([]byte, 32)}, expected: LogIntegrityMismatch},
+		{desc: "TooShort", nv: testNVIndexReader{0x1c00100: digest[:20]}, expected: LogIntegrityMismatch},
+		{desc: "NotPresent", nv: testNVIndexReader{}, expected: LogIntegrityNotPresent},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			v := &NVLogDigestVerifier{Reader: data.nv, Index: 0x1c00100, Algorithm: AlgorithmSha256}
+			results, err := VerifyLogIntegrity(context.Background(), log, []LogIntegrityVerifier{v})
+			if err != nil {
+				t.Fatalf("VerifyLogIntegrity failed: %v", err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("Unexpected number of results (%d)", len(results))
+			}
+			if results[0].Status != data.expected {
+				t.Errorf("Unexpected status (got %s, expected %s)", results[0].Status, data.expected)
+			}
+			if results[0].Mechanism != "NV index 0x01c00100 (SHA-256)" {
+				t.Errorf("Unexpected mechanism: %s", results[0].Mechanism)
+			}
+		})
+	}
+}
+
+func TestLogDigestEventVerifier(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+	filter := EventFilterFunc(func(e *Event) bool {
+		return e.PCRIndex == 8 && e.EventType == EventTypeEventTag
+	})
+	v := &LogDigestEventVerifier{Filter: filter, Algorithm: AlgorithmSha256}
+
+	log := makeTestLogIntegrityLog()
+	buf := bytes.NewBuffer(append([]byte(nil), log...))
+	writeTestLogEvents_2(buf, []testLogEvent{
+		makeTestLogEvent(8, EventTypeEventTag, AlgorithmSha256.hash(log), algs...)})
+
+	result, err := v.VerifyLogIntegrity(context.Background(), buf.Bytes())
+	if err != nil {
+		t.Fatalf("VerifyLogIntegrity failed: %v", err)
+	}
+	if result.Status != LogIntegrityVerified {
+		t.Errorf("Unexpected status: %s (%s)", result.Status, result.Description)
+	}
+
+	modified := makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(0, EventTypeAction, []byte("modified"), algs...),
+		makeTestLogEvent(0, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...),
+		makeTestLogEvent(8, EventTypeEventTag, AlgorithmSha256.hash(log), algs...)})
+	result, err = v.VerifyLogIntegrity(context.Background(), modified)
+	if err != nil {
+		t.Fatalf("VerifyLogIntegrity failed: %v", err)
+	}
+	if result.Status != LogIntegrityMismatch {
+		t.Errorf("Unexpected status: %s", result.Status)
+	}
+
+	result, err = v.VerifyLogIntegrity(context.Background(), log)
+	if err != nil {
+		t.Fatalf("VerifyLogIntegrity failed: %v", err)
+	}
+	if result.Status != LogIntegrityNotPresent {
+		t.Errorf("Unexpected status: %s", result.Status)
+	}
+}
@@ -0,0 +1,169 @@
+package tcglog
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LogOption is used to configure a LogOptions with NewLogOptions.
+type LogOption func(o *LogOptions) error
+
+// WithGrub enables support for interpreting events recorded by GRUB.
+func WithGrub() LogOption {
+	return func(o *LogOptions) error {
+		o.EnableGrub = true
+		return nil
+	}
+}
+
+// WithSystemdEFIStub enables support for interpreting events recorded by systemd's EFI linux loader stub, which
+// measures to the specified PCR.
+func WithSystemdEFIStub(pcr PCRIndex) LogOption {
+	return func(o *LogOptions) error {
+		if o.EnableSystemdEFIStub && o.SystemdEFIStubPCR != pcr {
+			return fmt.Errorf("systemd EFI stub PCR specified more than once (%d and %d)", o.SystemdEFIStubPCR, pcr)
+		}
+		o.EnableSystemdEFIStub = true
+		o.SystemdEFIStubPCR = pcr
+		return nil
+	}
+}
+
+// WithWindowsSIPA enables support for interpreting the SIPA events recorded by Windows in EV_EVENT_TAG events.
+func WithWindowsSIPA() LogOption {
+	return func(o *LogOptions) error {
+		o.EnableWindowsSIPA = true
+		return nil
+	}
+}
+
+// WithPermissiveParsing enables recovery from corrupt event headers (see LogOptions.Permissive).
+func WithPermissiveParsing() LogOption {
+	return func(o *LogOptions) error {
+		o.Permissive = true
+		return nil
+	}
+}
+
+// WithTolerantCertificates enables the fallback parser for malformed X.509 certificates (see
+// LogOptions.TolerantCertificates).
+func WithTolerantCertificates() LogOption {
+	return func(o *LogOptions) error {
+		o.TolerantCertificates = true
+		return nil
+	}
+}
+
+// WithExpectedEventCount provides a hint for the number of events in the log (see LogOptions.ExpectedEventCount).
+func WithExpectedEventCount(n int) LogOption {
+	return func(o *LogOptions) error {
+		if o.ExpectedEventCount != 0 && o.ExpectedEventCount != n {
+			return fmt.Errorf("expected event count specified more than once (%d and %d)", o.ExpectedEventCount, n)
+		}
+		o.ExpectedEventCount = n
+		return nil
+	}
+}
+
+// WithMaxEventDataSize sets the largest event data size that will be accepted when reading a log (see
+// LogOptions.MaxEventDataSize).
+func WithMaxEventDataSize(n uint32) LogOption {
+	return func(o *LogOptions) error {
+		if n == 0 {
+			return errors.New("maximum event data size must not be zero")
+		}
+		if o.MaxEventDataSize != 0 && o.MaxEventDataSize != n {
+			return fmt.Errorf("maximum event data size specified more than once (%d and %d)", o.MaxEventDataSize, n)
+		}
+		o.MaxEventDataSize = n
+		return nil
+	}
+}
+
+// WithMaxDevicePathNodes sets the largest number of nodes that will be decoded from a device path (see
+// LogOptions.MaxDevicePathNodes).
+func WithMaxDevicePathNodes(n int) LogOption {
+	return func(o *LogOptions) error {
+		if n <= 0 {
+			return fmt.Errorf("limit on %s must be positive", DecodeLimitDevicePathNodes)
+		}
+		if o.MaxDevicePathNodes != 0 && o.MaxDevicePathNodes != n {
+			return fmt.Errorf("limit on %s specified more than once (%d and %d)", DecodeLimitDevicePathNodes,
+				o.MaxDevicePathNodes, n)
+		}
+		o.MaxDevicePathNodes = n
+		return nil
+	}
+}
+
+// WithMaxNestingDepth sets the deepest nesting of structures that will be decoded from event data (see
+// LogOptions.MaxNestingDepth).
+func WithMaxNestingDepth(n int) LogOption {
+	return func(o *LogOptions) error {
+		if n <= 0 {
+			return fmt.Errorf("limit on %s must be positive", DecodeLimitNestingDepth)
+		}
+		if o.MaxNestingDepth != 0 && o.MaxNestingDepth != n {
+			return fmt.Errorf("limit on %s specified more than once (%d and %d)", DecodeLimitNestingDepth,
+				o.MaxNestingDepth, n)
+		}
+		o.MaxNestingDepth = n
+		return nil
+	}
+}
+
+// WithMaxSignatures sets the largest number of signatures that will be decoded from an EFI signature database (see
+// LogOptions.MaxSignatures).
+func WithMaxSignatures(n int) LogOption {
+	return func(o *LogOptions) error {
+		if n <= 0 {
+			return fmt.Errorf("limit on %s must be positive", DecodeLimitSignatures)
+		}
+		if o.MaxSignatures != 0 && o.MaxSignatures != n {
+			return fmt.Errorf("limit on %s specified more than once (%d and %d)", DecodeLimitSignatures,
+				o.MaxSignatures, n)
+		}
+		o.MaxSignatures = n
+		return nil
+	}
+}
+
+// NewLogOptions returns a LogOptions configured with the supplied options. An error is returned if any of the
+// options are invalid, if an option is specified more than once with different values, or if the resulting
+// LogOptions fails Validate.
+func NewLogOptions(opts ...LogOption) (LogOptions, error) {
+	var o LogOptions
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return LogOptions{}, err
+		}
+	}
+	if err := o.Validate(); err != nil {
+		return LogOptions{}, err
+	}
+	return o, nil
+}
+
+// Validate checks that these options are consistent. This catches fields that have been left at their zero value
+// by mistake when LogOptions is constructed directly, such as enabling support for systemd's EFI linux loader stub
+// without specifying the PCR that it measures to. LogOptions returned from NewLogOptions have already been
+// validated.
+func (o LogOptions) Validate() error {
+	switch {
+	case o.EnableSystemdEFIStub && o.SystemdEFIStubPCR == 0:
+		return errors.New("systemd EFI stub support is enabled without specifying the PCR that it measures to")
+	case o.EnableSystemdEFIStub && !isPCRIndexInRange(o.SystemdEFIStubPCR):
+		return fmt.Errorf("systemd EFI stub PCR %d is out of range", o.SystemdEFIStubPCR)
+	case !o.EnableSystemdEFIStub && o.SystemdEFIStubPCR != 0:
+		return errors.New("systemd EFI stub PCR is specified without enabling systemd EFI stub support")
+	case o.ExpectedEventCount < 0:
+		return fmt.Errorf("expected event count %d is negative", o.ExpectedEventCount)
+	case o.MaxDevicePathNodes < 0:
+		return fmt.Errorf("limit on %s %d is negative", DecodeLimitDevicePathNodes, o.MaxDevicePathNodes)
+	case o.MaxNestingDepth < 0:
+		return fmt.Errorf("limit on %s %d is negative", DecodeLimitNestingDepth, o.MaxNestingDepth)
+	case o.MaxSignatures < 0:
+		return fmt.Errorf("limit on %s %d is negative", DecodeLimitSignatures, o.MaxSignatures)
+	}
+	return nil
+}
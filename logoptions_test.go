@@ -0,0 +1,59 @@
+package tcglog
+
+import (
+	"testing"
+)
+
+func TestNewLogOptions(t *testing.T) {
+	options, err := NewLogOptions(WithGrub(), WithSystemdEFIStub(8), WithWindowsSIPA(), WithExpectedEventCount(100),
+		WithSystemdEFIStub(8), WithMaxEventDataSize(1024), WithTolerantCertificates())
+	if err != nil {
+		t.Fatalf("NewLogOptions failed: %v", err)
+	}
+	expected := LogOptions{EnableGrub: true, EnableSystemdEFIStub: true, SystemdEFIStubPCR: 8, EnableWindowsSIPA: true,
+		ExpectedEventCount: 100, MaxEventDataSize: 1024, TolerantCertificates: true}
+	if options != expected {
+		t.Errorf("Unexpected options: %+v", options)
+	}
+
+	options, err = NewLogOptions()
+	if err != nil {
+		t.Fatalf("NewLogOptions failed: %v", err)
+	}
+	if options != (LogOptions{}) {
+		t.Errorf("Unexpected options: %+v", options)
+	}
+}
+
+func TestNewLogOptionsInvalid(t *testing.T) {
+	for _, data := range []struct {
+		desc string
+		opts []LogOption
+	}{
+		{desc: "SystemdEFIStubPCRZero", opts: []LogOption{WithSystemdEFIStub(0)}},
+		{desc: "SystemdEFIStubPCROutOfRange", opts: []LogOption{WithSystemdEFIStub(32)}},
+		{desc: "SystemdEFIStubConflict", opts: []LogOption{WithSystemdEFIStub(8), WithSystemdEFIStub(12)}},
+		{desc: "ExpectedEventCountNegative", opts: []LogOption{WithExpectedEventCount(-1)}},
+		{desc: "ExpectedEventCountConflict", opts: []LogOption{WithExpectedEventCount(10), WithExpectedEventCount(20)}},
+		{desc: "MaxEventDataSizeZero", opts: []LogOption{WithMaxEventDataSize(0)}},
+		{desc: "MaxEventDataSizeConflict", opts: []LogOption{WithMaxEventDataSize(1024), WithMaxEventDataSize(2048)}},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			if _, err := NewLogOptions(data.opts...); err == nil {
+				t.Errorf("NewLogOptions should have failed")
+			}
+		})
+	}
+}
+
+func TestLogOptionsValidate(t *testing.T) {
+	if err := (LogOptions{EnableSystemdEFIStub: true}).Validate(); err == nil {
+		t.Errorf("Validate should fail when the systemd EFI stub PCR isn't specified")
+	}
+	if err := (LogOptions{SystemdEFIStubPCR: 8}).Validate(); err == nil {
+		t.Errorf("Validate should fail when the systemd EFI stub PCR is specified without enabling support")
+	}
+	if err := (LogOptions{EnableGrub: true, EnableSystemdEFIStub: true, SystemdEFIStubPCR: 8}).Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const dirLogStoreIndex = "index.json"
+
+// StoredBoot describes a boot whose log is archived in a DirLogStore.
+type StoredBoot struct {
+	ID         string          `json:"id"`   // The boot identifier (eg, /proc/sys/kernel/random/boot_id)
+	Time       time.Time       `json:"time"` // When the boot happened
+	Algorithms AlgorithmIdList `json:"algorithms"`
+}
+
+// DirLogStore archives the logs from successive boots of a machine to a directory, keyed by boot ID, so that the log
+// from any boot can be compared with any other. Each log is saved in the format written by ArchiveWriter, and the
+// boots are listed in an index file in the same directory.
+type DirLogStore struct {
+	Dir string
+}
+
+func (s *DirLogStore) path(bootID string) (string, error) {
+	if bootID == "" || strings.ContainsAny(bootID, "/\\") || bootID == "." || bootID == ".." {
+		return "", fmt.Errorf("invalid boot ID \"%s\"", bootID)
+	}
+	return filepath.Join(s.Dir, bootID+".log.gz"), nil
+}
+
+// Boots returns the boots in the store, in the order in which they happened.
+func (s *DirLogStore) Boots() ([]StoredBoot, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.Dir, dirLogStoreIndex))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var boots []StoredBoot
+	if err := json.Unmarshal(data, &boots); err != nil {
+		return nil, fmt.Errorf("cannot decode index: %v", err)
+	}
+	sort.SliceStable(boots, func(i, j int) bool { return boots[i].Time.Before(boots[j].Time) })
+	return boots, nil
+}
+
+// Boot returns the boot with the specified ID.
+func (s *DirLogStore) Boot(bootID string) (*StoredBoot, error) {
+	boots, err := s.Boots()
+	if err != nil {
+		return nil, err
+	}
+	for i := range boots {
+		if boots[i].ID == bootID {
+			return &boots[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no boot with ID \"%s\"", bootID)
+}
+
+// BootAt returns the last boot that happened at or before t, which is the boot that was running at that time.
+func (s *DirLogStore) BootAt(t time.Time) (*StoredBoot, error) {
+	boots, err := s.Boots()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(boots) - 1; i >= 0; i-- {
+		if !boots[i].Time.After(t) {
+			return &boots[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no boot at or before %s", t.Format(time.RFC3339))
+}
+
+// Add archives the supplied events as the log for the specified boot, which must not already be in the store. The
+// directory is created if it doesn't exist.
+func (s *DirLogStore) Add(boot *StoredBoot, events []*Event) error {
+	path, err := s.path(boot.ID)
+	if err != nil {
+		return err
+	}
+	boots, err := s.Boots()
+	if err != nil {
+		return err
+	}
+	for _, b := range boots {
+		if b.ID == boot.ID {
+			return fmt.Errorf("store already contains boot \"%s\"", boot.ID)
+		}
+	}
+
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	w := NewArchiveWriter()
+	if err := w.AddLog(boot.ID, events); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := w.Write(&buf); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	// Only add the boot to the index once its log has been saved.
+	data, err := json.Marshal(append(boots, *boot))
+	if err != nil {
+		return err
+	}
+	index := filepath.Join(s.Dir, dirLogStoreIndex)
+	if err := ioutil.WriteFile(index+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(index+".tmp", index)
+}
+
+// Events returns the archived events for the specified boot, decoded with the supplied options.
+func (s *DirLogStore) Events(bootID string, options LogOptions) ([]*Event, error) {
+	path, err := s.path(bootID)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	logs, err := ReadArchive(f, options)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read log for boot \"%s\": %v", bootID, err)
+	}
+	if len(logs) != 1 {
+		return nil, fmt.Errorf("cannot read log for boot \"%s\": unexpected number of logs (%d)", bootID, len(logs))
+	}
+	return logs[0].Events, nil
+}
+
+// Diff compares the logs for the specified boots with DiffLogs.
+func (s *DirLogStore) Diff(oldID, newID string, options LogOptions) (*LogDiff, error) {
+	oldEvents, err := s.Events(oldID, options)
+	if err != nil {
+		return nil, err
+	}
+	newEvents, err := s.Events(newID, options)
+	if err != nil {
+		return nil, err
+	}
+	return DiffLogs(oldEvents, newEvents), nil
+}
@@ -0,0 +1,93 @@
+package tcglog
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDirLogStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-logstore")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := &DirLogStore{Dir: dir}
+
+	boots, err := store.Boots()
+	if err != nil {
+		t.Fatalf("Boots failed: %v", err)
+	}
+	if len(boots) != 0 {
+		t.Errorf("Boots returned boots for an empty store: %v", boots)
+	}
+
+	algs := []AlgorithmId{AlgorithmSha256}
+	base := time.Date(2020, 3, 10, 9, 0, 0, 0, time.UTC)
+	for i, action := range []string{"grub", "grub", "grub2"} {
+		events := readAllTestLogEvents(t, makeTestLog_2(algs, []testLogEvent{
+			makeTestLogEvent(4, EventTypeEFIAction, []byte("shim"), algs...),
+			makeTestLogEvent(4, EventTypeEFIAction, []byte(action), algs...)}), LogOptions{})
+		boot := &StoredBoot{ID: []string{"boot1", "boot2", "boot3"}[i], Time: base.AddDate(0, 0, i),
+			Algorithms: algs}
+		if err := store.Add(boot, events); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if err := store.Add(&StoredBoot{ID: "boot1"}, nil); err == nil {
+		t.Errorf("Add should fail for a duplicate boot ID")
+	}
+	if err := store.Add(&StoredBoot{ID: "../boot4"}, nil); err == nil {
+		t.Errorf("Add should fail for an invalid boot ID")
+	}
+
+	boots, err = store.Boots()
+	if err != nil {
+		t.Fatalf("Boots failed: %v", err)
+	}
+	if len(boots) != 3 || boots[2].ID != "boot3" || !boots[2].Time.Equal(base.AddDate(0, 0, 2)) ||
+		len(boots[2].Algorithms) != 1 || boots[2].Algorithms[0] != AlgorithmSha256 {
+		t.Errorf("Unexpected boots: %v", boots)
+	}
+
+	boot, err := store.BootAt(base.AddDate(0, 0, 1).Add(time.Hour))
+	if err != nil {
+		t.Fatalf("BootAt failed: %v", err)
+	}
+	if boot.ID != "boot2" {
+		t.Errorf("Unexpected boot: %s", boot.ID)
+	}
+	if _, err := store.BootAt(base.Add(-time.Hour)); err == nil {
+		t.Errorf("BootAt should fail for a time before the first boot")
+	}
+	if _, err := store.Boot("boot4"); err == nil {
+		t.Errorf("Boot should fail for an unknown boot ID")
+	}
+
+	events, err := store.Events("boot1", LogOptions{})
+	if err != nil {
+		t.Fatalf("Events failed: %v", err)
+	}
+	if len(events) != 3 || events[2].Data().String() != "grub" {
+		t.Errorf("Unexpected events: %v", events)
+	}
+
+	diff, err := store.Diff("boot1", "boot2", LogOptions{})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if len(diff.PCRs) != 0 {
+		t.Errorf("Unexpected differences between identical boots: %v", diff.PCRs)
+	}
+
+	diff, err = store.Diff("boot2", "boot3", LogOptions{})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if len(diff.PCRs) != 1 || diff.PCRs[0].PCR != 4 || len(diff.PCRs[0].Events) != 1 ||
+		diff.PCRs[0].Events[0].Kind != EventDiffChanged {
+		t.Errorf("Unexpected differences: %v", diff.PCRs)
+	}
+}
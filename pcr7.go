@@ -0,0 +1,142 @@
+package tcglog
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// SecureBootVariables contains the contents of the secure boot configuration variables that are measured to PCR 7.
+// PK, KEK, db and dbx are always measured, with no data if the variable doesn't exist. dbt and dbr are only measured
+// if they are not nil.
+type SecureBootVariables struct {
+	PK  []byte
+	KEK []byte
+	Db  []byte
+	Dbx []byte
+	Dbt []byte
+	Dbr []byte
+}
+
+// PCR7Scenario describes the secure boot state of a platform.
+type PCR7Scenario struct {
+	SecureBootEnabled bool // Whether the SecureBoot variable indicates that secure boot is enabled
+	SetupMode         bool // Whether the platform is in setup mode, in which case PK is empty
+}
+
+func (s PCR7Scenario) String() string {
+	state := "disabled"
+	if s.SecureBootEnabled {
+		state = "enabled"
+	}
+	mode := "user mode"
+	if s.SetupMode {
+		mode = "setup mode"
+	}
+	return fmt.Sprintf("secure boot %s, %s", state, mode)
+}
+
+// PCR7Prediction is a predicted value of PCR 7 for a single PCR7Scenario.
+type PCR7Prediction struct {
+	Scenario PCR7Scenario
+	Value    DigestMap
+}
+
+func makeEFIVariableEvent(pcr PCRIndex, eventType EventType, algorithms AlgorithmIdList, guid EFIGUID, name string,
+	data []byte) (*Event, error) {
+	d := &EFIVariableEventData{eventType: eventType, VariableName: guid, UnicodeName: name, VariableData: data}
+	var buf bytes.Buffer
+	if err := d.EncodeMeasuredBytes(&buf); err != nil {
+		return nil, err
+	}
+	d.data = buf.Bytes()
+	return &Event{PCRIndex: pcr, EventType: eventType, data: d,
+		Digests: NewEventDigests(ComputeEventDigests(algorithms, d.data, nil, false))}, nil
+}
+
+// predictPCR7 computes the value of PCR 7 for the specified scenario.
+func predictPCR7(scenario PCR7Scenario, vars *SecureBootVariables, authorities []*EFIVariableEventData,
+	algorithms AlgorithmIdList) (DigestMap, error) {
+	secureBoot := []byte{0}
+	if scenario.SecureBootEnabled {
+		secureBoot[0] = 1
+	}
+	pk := vars.PK
+	if scenario.SetupMode {
+		pk = nil
+	}
+
+	type variable struct {
+		guid EFIGUID
+		name string
+		data []byte
+	}
+	config := []variable{
+		{efiGlobalVariableGUID, "SecureBoot", secureBoot},
+		{efiGlobalVariableGUID, "PK", pk},
+		{efiGlobalVariableGUID, "KEK", vars.KEK},
+		{efiImageSecurityDatabaseGUID, "db", vars.Db},
+		{efiImageSecurityDatabaseGUID, "dbx", vars.Dbx}}
+	if vars.Dbt != nil {
+		config = append(config, variable{efiImageSecurityDatabaseGUID, "dbt", vars.Dbt})
+	}
+	if vars.Dbr != nil {
+		config = append(config, variable{efiImageSecurityDatabaseGUID, "dbr", vars.Dbr})
+	}
+
+	var events []*Event
+	for _, v := range config {
+		e, err := makeEFIVariableEvent(7, EventTypeEFIVariableDriverConfig, algorithms, v.guid, v.name, v.data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot measure %s: %v", v.name, err)
+		}
+		events = append(events, e)
+	}
+
+	separator := make([]byte, 4)
+	events = append(events, &Event{PCRIndex: 7, EventType: EventTypeSeparator,
+		Digests: NewEventDigests(ComputeEventDigests(algorithms, separator, nil, false))})
+
+	if scenario.SecureBootEnabled {
+		for _, a := range authorities {
+			e, err := makeEFIVariableEvent(7, EventTypeEFIVariableAuthority, algorithms, a.VariableName,
+				a.UnicodeName, a.VariableData)
+			if err != nil {
+				return nil, fmt.Errorf("cannot measure authority %s: %v", a.UnicodeName, err)
+			}
+			events = append(events, e)
+		}
+	}
+
+	values, err := replayEvents(events, algorithms)
+	if err != nil {
+		return nil, err
+	}
+	return values[7], nil
+}
+
+// PredictPCR7Scenarios computes the value of PCR 7 for each combination of secure boot being enabled or disabled and
+// the platform being in setup mode or user mode, given the contents of the secure boot configuration variables. This
+// allows policies to be computed for a machine before secure boot has been finalized.
+//
+// The authorities argument specifies the EV_EFI_VARIABLE_AUTHORITY events that are measured when verifying the
+// components of the boot chain, in the order in which they are measured. These are only measured when secure boot is
+// enabled. Note that the UEFI specification requires secure boot to be disabled in setup mode, but some platforms
+// permit it to be enabled, so this combination is included.
+//
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+//  (section 3.3.4.8 "PCR[7] - Secure Boot Policy Measurements")
+func PredictPCR7Scenarios(vars *SecureBootVariables, authorities []*EFIVariableEventData,
+	algorithms AlgorithmIdList) ([]*PCR7Prediction, error) {
+	var out []*PCR7Prediction
+	for _, enabled := range []bool{false, true} {
+		for _, setup := range []bool{true, false} {
+			scenario := PCR7Scenario{SecureBootEnabled: enabled, SetupMode: setup}
+			value, err := predictPCR7(scenario, vars, authorities, algorithms)
+			if err != nil {
+				return nil, fmt.Errorf("cannot predict PCR 7 with %s: %v", scenario, err)
+			}
+			out = append(out, &PCR7Prediction{Scenario: scenario, Value: value})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,54 @@
+package tcglog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPredictPCR7Scenarios(t *testing.T) {
+	algs := AlgorithmIdList{AlgorithmSha256}
+	vars := &SecureBootVariables{PK: []byte("pk"), KEK: []byte("kek"), Db: []byte("db"), Dbx: []byte("dbx")}
+	authority := &EFIVariableEventData{VariableName: efiImageSecurityDatabaseGUID, UnicodeName: "db",
+		VariableData: []byte("cert")}
+
+	predictions, err := PredictPCR7Scenarios(vars, []*EFIVariableEventData{authority}, algs)
+	if err != nil {
+		t.Fatalf("PredictPCR7Scenarios failed: %v", err)
+	}
+	if len(predictions) != 4 {
+		t.Fatalf("Unexpected number of predictions: %d", len(predictions))
+	}
+
+	measure := func(guid EFIGUID, name string, data []byte) Digest {
+		var buf bytes.Buffer
+		d := &EFIVariableEventData{VariableName: guid, UnicodeName: name, VariableData: data}
+		d.EncodeMeasuredBytes(&buf)
+		return AlgorithmSha256.hash(buf.Bytes())
+	}
+	expected := make(Digest, 32)
+	for _, d := range []Digest{
+		measure(efiGlobalVariableGUID, "SecureBoot", []byte{1}),
+		measure(efiGlobalVariableGUID, "PK", []byte("pk")),
+		measure(efiGlobalVariableGUID, "KEK", []byte("kek")),
+		measure(efiImageSecurityDatabaseGUID, "db", []byte("db")),
+		measure(efiImageSecurityDatabaseGUID, "dbx", []byte("dbx")),
+		AlgorithmSha256.hash([]byte{0, 0, 0, 0}),
+		measure(efiImageSecurityDatabaseGUID, "db", []byte("cert")),
+	} {
+		expected = performHashExtendOperation(AlgorithmSha256, expected, d)
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range predictions {
+		v := string(p.Value[AlgorithmSha256])
+		if seen[v] {
+			t.Errorf("Duplicate prediction for %s", p.Scenario)
+		}
+		seen[v] = true
+
+		if p.Scenario.SecureBootEnabled && !p.Scenario.SetupMode &&
+			!bytes.Equal(p.Value[AlgorithmSha256], expected) {
+			t.Errorf("Unexpected value for %s: %x", p.Scenario, p.Value[AlgorithmSha256])
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package tcglog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	tpmCCPolicyOR  uint32 = 0x00000171 // TPM_CC_PolicyOR
+	tpmCCPolicyPCR uint32 = 0x0000017f // TPM_CC_PolicyPCR
+
+	policyORMaxDigests = 8 // The maximum number of digests accepted by TPM2_PolicyOR
+)
+
+// marshalPCRSelection produces the TPM wire format representation of a TPML_PCR_SELECTION that selects the specified
+// PCRs from a single bank.
+func marshalPCRSelection(alg AlgorithmId, pcrs []PCRIndex) []byte {
+	sizeOfSelect := 3
+	for _, pcr := range pcrs {
+		if int(pcr/8)+1 > sizeOfSelect {
+			sizeOfSelect = int(pcr/8) + 1
+		}
+	}
+
+	out := make([]byte, 7+sizeOfSelect)
+	binary.BigEndian.PutUint32(out[0:], 1)
+	binary.BigEndian.PutUint16(out[4:], uint16(alg))
+	out[6] = uint8(sizeOfSelect)
+	for _, pcr := range pcrs {
+		out[7+pcr/8] |= 1 << (pcr % 8)
+	}
+	return out
+}
+
+func sortedPCRs(pcrs []PCRIndex) []PCRIndex {
+	out := make([]PCRIndex, len(pcrs))
+	copy(out, pcrs)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// computePCRDigest computes the digest of the selected PCR values, in the order in which the TPM would select them.
+func computePCRDigest(alg AlgorithmId, pcrs []PCRIndex, values PCRValues) (Digest, error) {
+	h := alg.newHash()
+	for _, pcr := range sortedPCRs(pcrs) {
+		v, ok := values[pcr][alg]
+		if !ok {
+			return nil, fmt.Errorf("no %s value for PCR %d", alg, pcr)
+		}
+		h.Write(v)
+	}
+	return h.Sum(nil), nil
+}
+
+// computePolicyPCRDigest computes the result of extending policyDigest with a TPM2_PolicyPCR assertion.
+func computePolicyPCRDigest(alg AlgorithmId, policyDigest Digest, pcrs []PCRIndex, pcrDigest Digest) Digest {
+	var cc [4]byte
+	binary.BigEndian.PutUint32(cc[:], tpmCCPolicyPCR)
+
+	h := alg.newHash()
+	h.Write(policyDigest)
+	h.Write(cc[:])
+	h.Write(marshalPCRSelection(alg, sortedPCRs(pcrs)))
+	h.Write(pcrDigest)
+	return h.Sum(nil)
+}
+
+// computePolicyORDigest computes the result of a TPM2_PolicyOR assertion with the supplied list of digests.
+func computePolicyORDigest(alg AlgorithmId, digests []Digest) Digest {
+	var cc [4]byte
+	binary.BigEndian.PutUint32(cc[:], tpmCCPolicyOR)
+
+	h := alg.newHash()
+	h.Write(make([]byte, alg.size()))
+	h.Write(cc[:])
+	for _, d := range digests {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// ComputePCRDigest computes the composite digest of the specified PCRs from the supplied PCR values, as used by the
+// TPM2_PolicyPCR assertion. The PCR values are concatenated in ascending order of PCR index, which is the order in
+// which the TPM selects them, regardless of the order in which they are specified.
+func ComputePCRDigest(alg AlgorithmId, pcrs []PCRIndex, values PCRValues) (Digest, error) {
+	if !alg.supported() {
+		return nil, fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	if len(pcrs) == 0 {
+		return nil, errors.New("no PCRs specified")
+	}
+	seen := make(map[PCRIndex]bool)
+	for _, pcr := range pcrs {
+		if seen[pcr] {
+			return nil, fmt.Errorf("PCR %d specified more than once", pcr)
+		}
+		seen[pcr] = true
+	}
+	return computePCRDigest(alg, pcrs, values)
+}
+
+// ComputePolicyPCRDigest computes the policy digest of a policy that consists of a single TPM2_PolicyPCR assertion for
+// the specified PCRs and values, along with the composite PCR digest (see ComputePCRDigest). The PCR values would
+// normally be those computed by replaying a log. The policy digest is suitable for use as the authorization policy of
+// a sealed object.
+func ComputePolicyPCRDigest(alg AlgorithmId, pcrs []PCRIndex, values PCRValues) (policyDigest, pcrDigest Digest, err error) {
+	pcrDigest, err = ComputePCRDigest(alg, pcrs, values)
+	if err != nil {
+		return nil, nil, err
+	}
+	return computePolicyPCRDigest(alg, make(Digest, alg.size()), pcrs, pcrDigest), pcrDigest, nil
+}
+
+// PolicyORTree is a tree of TPM2_PolicyOR assertions that permits any one of a number of branches, where each branch
+// corresponds to a single predicted PCR state. As TPM2_PolicyOR accepts a maximum of 8 digests, branches are grouped
+// in to chunks of 8 and the tree has as many levels as are required to reduce these to a single policy digest.
+type PolicyORTree struct {
+	Algorithm    AlgorithmId // The digest algorithm of the policy
+	PCRs         []PCRIndex  // The PCRs included in the TPM2_PolicyPCR assertion for each branch
+	Branches     []Digest    // The policy digest of each branch
+	PolicyDigest Digest      // The policy digest of the complete tree, for use as the authorization policy of an object
+	levels       [][][]Digest
+}
+
+// NewPCRPolicyORTree constructs a tree of TPM2_PolicyOR assertions from a set of predicted PCR states, where each
+// branch consists of a single TPM2_PolicyPCR assertion for the specified PCRs and one of the states.
+func NewPCRPolicyORTree(alg AlgorithmId, pcrs []PCRIndex, states []PCRValues) (*PolicyORTree, error) {
+	if !alg.supported() {
+		return nil, fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	if len(states) == 0 {
+		return nil, errors.New("no PCR states supplied")
+	}
+
+	tree := &PolicyORTree{Algorithm: alg, PCRs: sortedPCRs(pcrs)}
+	for i, state := range states {
+		policyDigest, _, err := ComputePolicyPCRDigest(alg, pcrs, state)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compute policy digest for state %d: %v", i, err)
+		}
+		tree.Branches = append(tree.Branches, policyDigest)
+	}
+
+	current := tree.Branches
+	for len(current) > 1 {
+		var chunks [][]Digest
+		var next []Digest
+		for len(current) > 0 {
+			n := len(current)
+			if n > policyORMaxDigests {
+				n = policyORMaxDigests
+			}
+			chunk := current[:n]
+			current = current[n:]
+			if len(chunk) == 1 {
+				// TPM2_PolicyOR requires at least 2 digests.
+				chunk = []Digest{chunk[0], chunk[0]}
+			}
+			chunks = append(chunks, chunk)
+			next = append(next, computePolicyORDigest(alg, chunk))
+		}
+		tree.levels = append(tree.levels, chunks)
+		current = next
+	}
+	tree.PolicyDigest = current[0]
+
+	return tree, nil
+}
+
+// ExecutionPath returns the digest lists that must be supplied to each TPM2_PolicyOR assertion, in order, in order to
+// satisfy the policy using the specified branch. These should be executed after the TPM2_PolicyPCR assertion for the
+// branch. If the tree only has a single branch, the returned list is empty.
+func (t *PolicyORTree) ExecutionPath(branch int) ([][]Digest, error) {
+	if branch < 0 || branch >= len(t.Branches) {
+		return nil, fmt.Errorf("invalid branch index %d", branch)
+	}
+
+	var path [][]Digest
+	for _, chunks := range t.levels {
+		path = append(path, chunks[branch/policyORMaxDigests])
+		branch /= policyORMaxDigests
+	}
+	return path, nil
+}
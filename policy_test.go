@@ -0,0 +1,96 @@
+package tcglog
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestPCRPolicyORTree(t *testing.T) {
+	for _, n := range []int{1, 2, 8, 9, 20, 65} {
+		t.Run(fmt.Sprintf("%d", n), func(t *testing.T) {
+			var states []PCRValues
+			for i := 0; i < n; i++ {
+				states = append(states, PCRValues{
+					4: DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte(fmt.Sprintf("pcr4-%d", i)))},
+					7: DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte("pcr7"))}})
+			}
+
+			tree, err := NewPCRPolicyORTree(AlgorithmSha256, []PCRIndex{7, 4}, states)
+			if err != nil {
+				t.Fatalf("NewPCRPolicyORTree failed: %v", err)
+			}
+			if len(tree.Branches) != n {
+				t.Fatalf("Unexpected number of branches")
+			}
+
+			for i := 0; i < n; i++ {
+				path, err := tree.ExecutionPath(i)
+				if err != nil {
+					t.Fatalf("ExecutionPath failed: %v", err)
+				}
+				digest := tree.Branches[i]
+				for _, digests := range path {
+					if len(digests) < 2 || len(digests) > 8 {
+						t.Fatalf("Invalid number of digests for TPM2_PolicyOR: %d", len(digests))
+					}
+					found := false
+					for _, d := range digests {
+						if bytes.Equal(d, digest) {
+							found = true
+						}
+					}
+					if !found {
+						t.Fatalf("Current policy digest not in TPM2_PolicyOR digest list")
+					}
+					digest = computePolicyORDigest(AlgorithmSha256, digests)
+				}
+				if !bytes.Equal(digest, tree.PolicyDigest) {
+					t.Errorf("Branch %d does not produce the expected policy digest", i)
+				}
+			}
+		})
+	}
+}
+
+func TestComputePolicyPCRDigest(t *testing.T) {
+	values := PCRValues{
+		4: DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte("pcr4"))},
+		7: DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte("pcr7"))}}
+
+	policyDigest, pcrDigest, err := ComputePolicyPCRDigest(AlgorithmSha256, []PCRIndex{7, 4}, values)
+	if err != nil {
+		t.Fatalf("ComputePolicyPCRDigest failed: %v", err)
+	}
+
+	expectedPCRDigest := AlgorithmSha256.hash(append(append([]byte{}, values[4][AlgorithmSha256]...),
+		values[7][AlgorithmSha256]...))
+	if !bytes.Equal(pcrDigest, expectedPCRDigest) {
+		t.Errorf("Unexpected PCR digest: %x", pcrDigest)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 32))
+	buf.Write([]byte{0x00, 0x00, 0x01, 0x7f})
+	buf.Write([]byte{0x00, 0x00, 0x00, 0x01, 0x00, 0x0b, 0x03, 0x90, 0x00, 0x00})
+	buf.Write(expectedPCRDigest)
+	if !bytes.Equal(policyDigest, AlgorithmSha256.hash(buf.Bytes())) {
+		t.Errorf("Unexpected policy digest: %x", policyDigest)
+	}
+}
+
+func TestComputePCRDigestErrors(t *testing.T) {
+	values := PCRValues{7: DigestMap{AlgorithmSha256: make(Digest, 32)}}
+
+	if _, err := ComputePCRDigest(AlgorithmSha256, []PCRIndex{7, 7}, values); err == nil ||
+		err.Error() != "PCR 7 specified more than once" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := ComputePCRDigest(AlgorithmSha256, []PCRIndex{4}, values); err == nil ||
+		err.Error() != "no SHA-256 value for PCR 4" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := ComputePCRDigest(AlgorithmSha256, nil, values); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
@@ -0,0 +1,197 @@
+package tcglog
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// replayEvents computes the PCR values that result from replaying the supplied events for the specified algorithms.
+func replayEvents(events []*Event, algorithms AlgorithmIdList) (PCRValues, error) {
+	values := make(PCRValues)
+	if err := replayEventsFrom(values, events, algorithms); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// replayEventsFrom replays the supplied events for the specified algorithms on top of values, which is updated. PCRs
+// that aren't in values are in their reset state.
+func replayEventsFrom(values PCRValues, events []*Event, algorithms AlgorithmIdList) error {
+	var startup pcr0Startup
+	if _, extended := values[0]; extended {
+		// PCR 0 isn't in its reset state, so the startup sequence can't affect it.
+		startup.measured = true
+	}
+	for _, e := range events {
+		if locality, replay, reinitialize := startup.process(e); reinitialize {
+			values[0] = DigestMap{}
+			for _, alg := range algorithms {
+				values[0][alg] = initialPCRValue(alg, 0, locality)
+			}
+			for _, r := range replay {
+				if err := extendPCRValues(values, 0, algorithms, r.Digests); err != nil {
+					return fmt.Errorf("cannot replay event %d in PCR 0: %v", r.Index, err)
+				}
+			}
+		}
+		if !doesEventTypeExtendPCR(e.EventType) {
+			continue
+		}
+		if err := extendPCRValues(values, e.PCRIndex, algorithms, e.Digests); err != nil {
+			return fmt.Errorf("cannot replay event %d in PCR %d: %v", e.Index, e.PCRIndex, err)
+		}
+	}
+	return nil
+}
+
+func extendPCRValues(values PCRValues, pcr PCRIndex, algorithms AlgorithmIdList, digests EventDigests) error {
+	if _, exists := values[pcr]; !exists {
+		values[pcr] = DigestMap{}
+		for _, alg := range algorithms {
+			values[pcr][alg] = make(Digest, alg.size())
+		}
+	}
+
+	for _, alg := range algorithms {
+		digest, ok := digests.Lookup(alg)
+		if !ok {
+			return fmt.Errorf("missing %s digest", alg)
+		}
+		values[pcr][alg] = performHashExtendOperation(alg, values[pcr][alg], digest)
+	}
+	return nil
+}
+
+// BootAlternative describes an alternative path through the boot manager, eg, booting from a different Boot####
+// option to the one that was used during the boot described by the log.
+type BootAlternative struct {
+	OptionNumber     uint16      // The number of the Boot#### option associated with this alternative
+	Description      string      // A description of this alternative
+	ImageDigests     []DigestMap // The digests of each EFI application loaded on this path, in the order they are loaded
+	AuthorityDigests []DigestMap // The digests of the EV_EFI_VARIABLE_AUTHORITY events measured when verifying the images on this path
+}
+
+// SimulateBootAlternatives predicts the values of PCRs 1, 4 and 7 for each of the supplied alternative boot paths,
+// using the events from a log as a template. The events measured to PCR 4 and PCR 7 before the EV_SEPARATOR events
+// are retained, and the EV_EFI_BOOT_SERVICES_APPLICATION and EV_EFI_VARIABLE_AUTHORITY events measured afterwards
+// are replaced by those for the alternative. PCR 1 is retained, as the boot manager measures all of the Boot####
+// variables and BootOrder regardless of which option is selected.
+//
+// The returned slice contains the predicted PCR values for each alternative, in the same order as alternatives.
+func SimulateBootAlternatives(events []*Event, algorithms AlgorithmIdList, alternatives []*BootAlternative) ([]PCRValues, error) {
+	var out []PCRValues
+
+	for _, alt := range alternatives {
+		var simulated []*Event
+		seenSeparator := make(map[PCRIndex]bool)
+		insertedAlternative := make(map[PCRIndex]bool)
+
+		insert := func(pcr PCRIndex) {
+			if insertedAlternative[pcr] {
+				return
+			}
+			insertedAlternative[pcr] = true
+
+			var t EventType
+			var digests []DigestMap
+			switch pcr {
+			case 4:
+				t = EventTypeEFIBootServicesApplication
+				digests = alt.ImageDigests
+			case 7:
+				t = EventTypeEFIVariableAuthority
+				digests = alt.AuthorityDigests
+			}
+			for _, d := range digests {
+				simulated = append(simulated, &Event{PCRIndex: pcr, EventType: t, Digests: NewEventDigests(d)})
+			}
+		}
+
+		for _, e := range events {
+			switch e.PCRIndex {
+			case 1:
+				simulated = append(simulated, e)
+			case 4, 7:
+				if e.EventType == EventTypeSeparator {
+					seenSeparator[e.PCRIndex] = true
+					simulated = append(simulated, e)
+					continue
+				}
+				if !seenSeparator[e.PCRIndex] {
+					simulated = append(simulated, e)
+					continue
+				}
+				switch {
+				case e.PCRIndex == 4 && e.EventType == EventTypeEFIBootServicesApplication:
+					insert(4)
+				case e.PCRIndex == 7 && e.EventType == EventTypeEFIVariableAuthority:
+					insert(7)
+				default:
+					simulated = append(simulated, e)
+				}
+			}
+		}
+
+		// Handle the case where the log contains no events to replace.
+		for _, pcr := range []PCRIndex{4, 7} {
+			if seenSeparator[pcr] {
+				insert(pcr)
+			}
+		}
+
+		values, err := replayEvents(simulated, algorithms)
+		if err != nil {
+			return nil, fmt.Errorf("cannot simulate boot option %04x: %v", alt.OptionNumber, err)
+		}
+		out = append(out, values)
+	}
+
+	return out, nil
+}
+
+// PCRValueAlternatives contains a list of the permitted values for each PCR, for use when constructing policies that
+// permit more than one value (eg, with TPM2_PolicyOR).
+type PCRValueAlternatives map[PCRIndex][]DigestMap
+
+func (a PCRValueAlternatives) contains(pcr PCRIndex, value DigestMap) bool {
+	for _, v := range a[pcr] {
+		match := len(v) == len(value)
+		for alg, digest := range value {
+			if !match {
+				break
+			}
+			match = bytes.Equal(v[alg], digest)
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// CombinePCRValues returns the union of the supplied sets of PCR values. Each distinct value for a PCR appears once,
+// in the order in which it is first encountered.
+func CombinePCRValues(values ...PCRValues) PCRValueAlternatives {
+	out := make(PCRValueAlternatives)
+	for _, v := range values {
+		for _, pcr := range v.PCRs() {
+			if out.contains(pcr, v[pcr]) {
+				continue
+			}
+			out[pcr] = append(out[pcr], v[pcr])
+		}
+	}
+	return out
+}
+
+// PredictBootSlots generates the permitted values of PCRs 1, 4 and 7 for a system with an A/B layout, where more than
+// one set of boot components is installed at the same time and any of them may be booted. Each slot is described by
+// a BootAlternative, and the events from a log are used as a template in the same way as SimulateBootAlternatives.
+// The result is the union of the predicted values for each slot.
+func PredictBootSlots(events []*Event, algorithms AlgorithmIdList, slots []*BootAlternative) (PCRValueAlternatives, error) {
+	values, err := SimulateBootAlternatives(events, algorithms, slots)
+	if err != nil {
+		return nil, err
+	}
+	return CombinePCRValues(values...), nil
+}
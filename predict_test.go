@@ -0,0 +1,90 @@
+package tcglog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSimulateBootAlternatives(t *testing.T) {
+	algs := AlgorithmIdList{AlgorithmSha256}
+	digests := func(s string) DigestMap {
+		return DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte(s))}
+	}
+	sep := digests("\x00\x00\x00\x00")
+
+	events := []*Event{
+		{PCRIndex: 1, EventType: EventTypeEFIVariableBoot, Digests: NewEventDigests(digests("BootOrder"))},
+		{PCRIndex: 4, EventType: EventTypeEFIAction, Digests: NewEventDigests(digests("Calling EFI Application from Boot Option"))},
+		{PCRIndex: 7, EventType: EventTypeEFIVariableDriverConfig, Digests: NewEventDigests(digests("SecureBoot"))},
+		{PCRIndex: 1, EventType: EventTypeSeparator, Digests: NewEventDigests(sep)},
+		{PCRIndex: 4, EventType: EventTypeSeparator, Digests: NewEventDigests(sep)},
+		{PCRIndex: 7, EventType: EventTypeSeparator, Digests: NewEventDigests(sep)},
+		{PCRIndex: 7, EventType: EventTypeEFIVariableAuthority, Digests: NewEventDigests(digests("ubuntu-ca"))},
+		{PCRIndex: 4, EventType: EventTypeEFIBootServicesApplication, Digests: NewEventDigests(digests("shim"))},
+		{PCRIndex: 4, EventType: EventTypeEFIBootServicesApplication, Digests: NewEventDigests(digests("grub"))},
+	}
+
+	alt := &BootAlternative{
+		OptionNumber:     1,
+		ImageDigests:     []DigestMap{digests("bootmgfw")},
+		AuthorityDigests: []DigestMap{digests("windows-ca")}}
+
+	values, err := SimulateBootAlternatives(events, algs, []*BootAlternative{alt})
+	if err != nil {
+		t.Fatalf("SimulateBootAlternatives failed: %v", err)
+	}
+	if len(values) != 1 {
+		t.Fatalf("Unexpected number of results")
+	}
+
+	expected, _ := replayEvents([]*Event{
+		events[0], events[1], events[2], events[3], events[4], events[5],
+		{PCRIndex: 7, EventType: EventTypeEFIVariableAuthority, Digests: NewEventDigests(digests("windows-ca"))},
+		{PCRIndex: 4, EventType: EventTypeEFIBootServicesApplication, Digests: NewEventDigests(digests("bootmgfw"))},
+	}, algs)
+
+	for _, pcr := range []PCRIndex{1, 4, 7} {
+		if !bytes.Equal(values[0][pcr][AlgorithmSha256], expected[pcr][AlgorithmSha256]) {
+			t.Errorf("Unexpected value for PCR %d", pcr)
+		}
+	}
+}
+
+func TestPredictBootSlots(t *testing.T) {
+	algs := AlgorithmIdList{AlgorithmSha256}
+	digests := func(s string) DigestMap {
+		return DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte(s))}
+	}
+	sep := digests("\x00\x00\x00\x00")
+
+	events := []*Event{
+		{PCRIndex: 1, EventType: EventTypeSeparator, Digests: NewEventDigests(sep)},
+		{PCRIndex: 4, EventType: EventTypeSeparator, Digests: NewEventDigests(sep)},
+		{PCRIndex: 7, EventType: EventTypeSeparator, Digests: NewEventDigests(sep)},
+		{PCRIndex: 7, EventType: EventTypeEFIVariableAuthority, Digests: NewEventDigests(digests("ca"))},
+		{PCRIndex: 4, EventType: EventTypeEFIBootServicesApplication, Digests: NewEventDigests(digests("shim"))},
+		{PCRIndex: 4, EventType: EventTypeEFIBootServicesApplication, Digests: NewEventDigests(digests("kernel-a"))},
+	}
+
+	slots := []*BootAlternative{
+		{Description: "A", ImageDigests: []DigestMap{digests("shim"), digests("kernel-a")},
+			AuthorityDigests: []DigestMap{digests("ca")}},
+		{Description: "B", ImageDigests: []DigestMap{digests("shim"), digests("kernel-b")},
+			AuthorityDigests: []DigestMap{digests("ca")}},
+	}
+
+	values, err := PredictBootSlots(events, algs, slots)
+	if err != nil {
+		t.Fatalf("PredictBootSlots failed: %v", err)
+	}
+	if len(values[1]) != 1 || len(values[7]) != 1 {
+		t.Errorf("Expected a single value for PCRs 1 and 7")
+	}
+	if len(values[4]) != 2 {
+		t.Fatalf("Expected 2 values for PCR 4, got %d", len(values[4]))
+	}
+	expected, _ := replayEvents(events, algs)
+	if !bytes.Equal(values[4][0][AlgorithmSha256], expected[4][AlgorithmSha256]) {
+		t.Errorf("Unexpected value for slot A")
+	}
+}
@@ -0,0 +1,339 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EventFilter is implemented by types that select events from a log.
+type EventFilter interface {
+	Match(event *Event) bool
+}
+
+// EventFilterFunc allows an ordinary function to be used as an EventFilter.
+type EventFilterFunc func(event *Event) bool
+
+func (f EventFilterFunc) Match(event *Event) bool {
+	return f(event)
+}
+
+type queryTokenType int
+
+const (
+	queryTokenEOF queryTokenType = iota
+	queryTokenIdent
+	queryTokenString
+	queryTokenOp
+	queryTokenLParen
+	queryTokenRParen
+)
+
+type queryToken struct {
+	t   queryTokenType
+	val string
+	pos int
+}
+
+var queryOperators = []string{"&&", "||", "==", "!=", "~=", "<=", ">=", "<", ">", "!"}
+
+func tokenizeQuery(expr string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{queryTokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{queryTokenRParen, ")", i})
+			i++
+		case c == '"':
+			s, n, err := unquoteQueryString(expr[i:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d: %v", i, err)
+			}
+			tokens = append(tokens, queryToken{queryTokenString, s, i})
+			i += n
+		case c == '_' || c == '.' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			start := i
+			// Permit '-' after the first character so that GUIDs can be written as bare words.
+			for i < len(expr) && (expr[i] == '_' || expr[i] == '.' || expr[i] == '-' ||
+				unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i]))) {
+				i++
+			}
+			tokens = append(tokens, queryToken{queryTokenIdent, expr[start:i], start})
+		default:
+			matched := false
+			for _, op := range queryOperators {
+				if strings.HasPrefix(expr[i:], op) {
+					tokens = append(tokens, queryToken{queryTokenOp, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character '%c' at offset %d", c, i)
+			}
+		}
+	}
+	return append(tokens, queryToken{queryTokenEOF, "", len(expr)}), nil
+}
+
+// unquoteQueryString returns the contents of the double quoted string at the start of s, and the number of bytes
+// consumed.
+func unquoteQueryString(s string) (string, int, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			out, err := strconv.Unquote(s[:i+1])
+			return out, i + 1, err
+		}
+	}
+	return "", 0, errors.New("unterminated string")
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.tokens[p.pos]
+	if t.t != queryTokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) parseOr() (EventFilter, error) {
+	lhs, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().t == queryTokenOp && p.peek().val == "||" {
+		p.next()
+		rhs, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := lhs
+		lhs = EventFilterFunc(func(e *Event) bool { return l.Match(e) || rhs.Match(e) })
+	}
+	return lhs, nil
+}
+
+func (p *queryParser) parseAnd() (EventFilter, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().t == queryTokenOp && p.peek().val == "&&" {
+		p.next()
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := lhs
+		lhs = EventFilterFunc(func(e *Event) bool { return l.Match(e) && rhs.Match(e) })
+	}
+	return lhs, nil
+}
+
+func (p *queryParser) parseUnary() (EventFilter, error) {
+	t := p.next()
+	switch {
+	case t.t == queryTokenOp && t.val == "!":
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return EventFilterFunc(func(e *Event) bool { return !f.Match(e) }), nil
+	case t.t == queryTokenLParen:
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.t != queryTokenRParen {
+			return nil, fmt.Errorf("expected ')' at offset %d", t.pos)
+		}
+		return f, nil
+	case t.t == queryTokenIdent:
+		op := p.next()
+		if op.t != queryTokenOp || op.val == "&&" || op.val == "||" || op.val == "!" {
+			return nil, fmt.Errorf("expected comparison operator at offset %d", op.pos)
+		}
+		value := p.next()
+		if value.t != queryTokenIdent && value.t != queryTokenString {
+			return nil, fmt.Errorf("expected value at offset %d", value.pos)
+		}
+		return makeQueryComparison(t.val, op.val, value.val)
+	default:
+		return nil, fmt.Errorf("unexpected token at offset %d", t.pos)
+	}
+}
+
+func compareQueryUint(op string, a, b uint64) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+func makeQueryUintComparison(field, op, value string, get func(*Event) uint64) (EventFilter, error) {
+	if op == "~=" {
+		return nil, fmt.Errorf("operator %s is not valid for field %s", op, field)
+	}
+	v, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for field %s: %v", field, err)
+	}
+	return EventFilterFunc(func(e *Event) bool { return compareQueryUint(op, get(e), v) }), nil
+}
+
+// makeQueryStringComparison creates a comparison for a string field, where ~= tests whether the field contains value.
+// The comparison is false for events that don't have the field.
+func makeQueryStringComparison(field, op, value string, get func(*Event) (string, bool)) (EventFilter, error) {
+	var match func(string) bool
+	switch op {
+	case "==":
+		match = func(s string) bool { return s == value }
+	case "!=":
+		match = func(s string) bool { return s != value }
+	case "~=":
+		match = func(s string) bool { return strings.Contains(s, value) }
+	default:
+		return nil, fmt.Errorf("operator %s is not valid for field %s", op, field)
+	}
+	return EventFilterFunc(func(e *Event) bool {
+		s, ok := get(e)
+		return ok && match(s)
+	}), nil
+}
+
+func queryEventVariable(e *Event) (*EFIVariableEventData, bool) {
+	d, ok := e.Data().(efiVariableEventDataProvider)
+	if !ok {
+		return nil, false
+	}
+	return d.variableEventData(), true
+}
+
+func makeQueryComparison(field, op, value string) (EventFilter, error) {
+	switch field {
+	case "pcr":
+		return makeQueryUintComparison(field, op, value, func(e *Event) uint64 { return uint64(e.PCRIndex) })
+	case "index":
+		return makeQueryUintComparison(field, op, value, func(e *Event) uint64 { return uint64(e.Index) })
+	case "type":
+		t, err := ParseEventType(value)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "==":
+			return EventFilterFunc(func(e *Event) bool { return e.EventType == t }), nil
+		case "!=":
+			return EventFilterFunc(func(e *Event) bool { return e.EventType != t }), nil
+		default:
+			return nil, fmt.Errorf("operator %s is not valid for field %s", op, field)
+		}
+	case "digest":
+		digest, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest: %v", err)
+		}
+		switch op {
+		case "==":
+			return EventFilterFunc(func(e *Event) bool {
+				for _, alg := range e.Digests.Algorithms() {
+					if bytes.Equal(e.Digests.Get(alg), digest) {
+						return true
+					}
+				}
+				return false
+			}), nil
+		case "~=":
+			return EventFilterFunc(func(e *Event) bool { return eventHasDigest(e, digest) }), nil
+		default:
+			return nil, fmt.Errorf("operator %s is not valid for field %s", op, field)
+		}
+	case "data":
+		return makeQueryStringComparison(field, op, value, func(e *Event) (string, bool) {
+			if e.Data() == nil {
+				return "", false
+			}
+			return e.Data().String(), true
+		})
+	case "var.name":
+		return makeQueryStringComparison(field, op, value, func(e *Event) (string, bool) {
+			v, ok := queryEventVariable(e)
+			if !ok {
+				return "", false
+			}
+			return v.UnicodeName, true
+		})
+	case "var.guid":
+		return makeQueryStringComparison(field, op, strings.ToLower(value), func(e *Event) (string, bool) {
+			v, ok := queryEventVariable(e)
+			if !ok {
+				return "", false
+			}
+			return strings.Trim(v.VariableName.String(), "{}"), true
+		})
+	default:
+		return nil, fmt.Errorf("unrecognized field \"%s\"", field)
+	}
+}
+
+// ParseEventFilter parses a query expression in to an EventFilter. An expression consists of comparisons combined
+// with the && and || operators, negated with ! and grouped with parentheses, eg:
+//  pcr == 7 && type == EV_EFI_VARIABLE_AUTHORITY && var.name == "db"
+//
+// The following fields are supported:
+//  pcr, index: compared numerically with ==, !=, <, <=, > and >=
+//  type: the event type name or numeric value, compared with == and !=
+//  digest: a hex digest from any bank, compared with == or, to match a digest prefix, ~=
+//  data: the string representation of the event data
+//  var.name, var.guid: the name and GUID of a EFI variable event
+// String fields are compared with == and !=, and ~= tests whether a field contains the supplied value. Values may be
+// bare words or double quoted strings.
+func ParseEventFilter(expr string) (EventFilter, error) {
+	tokens, err := tokenizeQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.t != queryTokenEOF {
+		return nil, fmt.Errorf("unexpected token at offset %d", t.pos)
+	}
+	return f, nil
+}
@@ -0,0 +1,57 @@
+package tcglog
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseEventFilter(t *testing.T) {
+	dbData := &EFIVariableEventData{VariableName: efiImageSecurityDatabaseGUID, UnicodeName: "db"}
+	events := []*Event{
+		{Index: 0, PCRIndex: 7, EventType: EventTypeEFIVariableAuthority, data: dbData,
+			Digests: NewEventDigests(DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte("db"))})},
+		{Index: 1, PCRIndex: 7, EventType: EventTypeEFIVariableDriverConfig,
+			data:    &EFIVariableEventData{VariableName: efiGlobalVariableGUID, UnicodeName: "SecureBoot"},
+			Digests: NewEventDigests(DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte("SecureBoot"))})},
+		{Index: 0, PCRIndex: 4, EventType: EventTypeEFIAction,
+			data:    &asciiStringEventData{data: []byte("Calling EFI Application from Boot Option")},
+			Digests: NewEventDigests(DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte("Calling EFI Application from Boot Option"))})},
+	}
+
+	for _, data := range []struct {
+		expr     string
+		expected []int
+	}{
+		{expr: `pcr==7 && type==EV_EFI_VARIABLE_AUTHORITY && var.name=="db"`, expected: []int{0}},
+		{expr: `pcr == 7`, expected: []int{0, 1}},
+		{expr: `pcr < 7 || var.name == SecureBoot`, expected: []int{1, 2}},
+		{expr: `!(pcr == 7)`, expected: []int{2}},
+		{expr: `data ~= "Boot Option"`, expected: []int{2}},
+		{expr: fmt.Sprintf("digest ~= %x", AlgorithmSha256.hash([]byte("db"))[:4]), expected: []int{0}},
+		{expr: fmt.Sprintf("digest == %x", AlgorithmSha256.hash([]byte("SecureBoot"))), expected: []int{1}},
+		{expr: `var.guid == 8BE4DF61-93CA-11D2-AA0D-00E098032B8C`, expected: []int{1}},
+		{expr: `type != EV_EFI_ACTION && index >= 1`, expected: []int{1}},
+	} {
+		t.Run(data.expr, func(t *testing.T) {
+			f, err := ParseEventFilter(data.expr)
+			if err != nil {
+				t.Fatalf("ParseEventFilter failed: %v", err)
+			}
+			var matched []int
+			for i, e := range events {
+				if f.Match(e) {
+					matched = append(matched, i)
+				}
+			}
+			if fmt.Sprint(matched) != fmt.Sprint(data.expected) {
+				t.Errorf("Unexpected matches: %v", matched)
+			}
+		})
+	}
+
+	for _, expr := range []string{`pcr ==`, `pcr == 7 &&`, `(pcr == 7`, `foo == 1`, `pcr ~= 7`, `pcr == "x`, `type == EV_BOGUS`} {
+		if _, err := ParseEventFilter(expr); err == nil {
+			t.Errorf("ParseEventFilter should fail for %q", expr)
+		}
+	}
+}
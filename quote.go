@@ -0,0 +1,379 @@
+package tcglog
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+const (
+	tpmGeneratedValue uint32 = 0xff544347 // TPM_GENERATED_VALUE
+	tpmSTAttestQuote  uint16 = 0x8018     // TPM_ST_ATTEST_QUOTE
+
+	tpmAlgRSA    uint16 = 0x0001 // TPM_ALG_RSA
+	tpmAlgNull   uint16 = 0x0010 // TPM_ALG_NULL
+	tpmAlgRSASSA uint16 = 0x0014 // TPM_ALG_RSASSA
+	tpmAlgRSAPSS uint16 = 0x0016 // TPM_ALG_RSAPSS
+	tpmAlgECDSA  uint16 = 0x0018 // TPM_ALG_ECDSA
+	tpmAlgECC    uint16 = 0x0023 // TPM_ALG_ECC
+
+	tpmECCNistP256 uint16 = 0x0003 // TPM_ECC_NIST_P256
+	tpmECCNistP384 uint16 = 0x0004 // TPM_ECC_NIST_P384
+	tpmECCNistP521 uint16 = 0x0005 // TPM_ECC_NIST_P521
+)
+
+func readTPM2B(r io.Reader) ([]byte, error) {
+	var size uint16
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// QuotePCRSelection describes the PCRs selected from a single bank by a TPM quote.
+type QuotePCRSelection struct {
+	Algorithm AlgorithmId
+	PCRs      []PCRIndex // The selected PCRs, in ascending order
+}
+
+// TPMQuote corresponds to a TPMS_ATTEST structure with the TPMS_QUOTE_INFO attestation type, as produced by the
+// TPM2_Quote command.
+type TPMQuote struct {
+	QualifiedSigner []byte
+	ExtraData       []byte // The qualifying data (nonce) supplied by the caller
+	Clock           uint64
+	ResetCount      uint32
+	RestartCount    uint32
+	Safe            bool
+	FirmwareVersion uint64
+	PCRSelection    []QuotePCRSelection
+	PCRDigest       Digest // The digest of the selected PCR values, computed with the hash of the signing scheme
+
+	data []byte
+}
+
+// DecodeTPMQuote decodes the supplied TPMS_ATTEST structure, which must be the result of a TPM2_Quote command. The
+// structure may optionally be prefixed with the size field of a TPM2B_ATTEST.
+//
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_TPM2_r1p59_Part2_Structures_pub.pdf
+//  (section 10.12.12 "TPMS_ATTEST")
+func DecodeTPMQuote(data []byte) (*TPMQuote, error) {
+	if len(data) >= 6 && binary.BigEndian.Uint32(data) != tpmGeneratedValue &&
+		binary.BigEndian.Uint32(data[2:]) == tpmGeneratedValue && int(binary.BigEndian.Uint16(data)) == len(data)-2 {
+		data = data[2:]
+	}
+
+	stream := bytes.NewReader(data)
+
+	var hdr struct {
+		Magic uint32
+		Type  uint16
+	}
+	if err := binary.Read(stream, binary.BigEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("cannot read header: %v", err)
+	}
+	if hdr.Magic != tpmGeneratedValue {
+		return nil, errors.New("invalid magic value")
+	}
+	if hdr.Type != tpmSTAttestQuote {
+		return nil, fmt.Errorf("unexpected attestation type 0x%04x", hdr.Type)
+	}
+
+	quote := &TPMQuote{data: data}
+	var err error
+	if quote.QualifiedSigner, err = readTPM2B(stream); err != nil {
+		return nil, fmt.Errorf("cannot read qualified signer: %v", err)
+	}
+	if quote.ExtraData, err = readTPM2B(stream); err != nil {
+		return nil, fmt.Errorf("cannot read extra data: %v", err)
+	}
+
+	var info struct {
+		Clock           uint64
+		ResetCount      uint32
+		RestartCount    uint32
+		Safe            uint8
+		FirmwareVersion uint64
+		Count           uint32
+	}
+	if err := binary.Read(stream, binary.BigEndian, &info); err != nil {
+		return nil, fmt.Errorf("cannot read clock info: %v", err)
+	}
+	quote.Clock = info.Clock
+	quote.ResetCount = info.ResetCount
+	quote.RestartCount = info.RestartCount
+	quote.Safe = info.Safe != 0
+	quote.FirmwareVersion = info.FirmwareVersion
+
+	for i := uint32(0); i < info.Count; i++ {
+		var sel struct {
+			Hash         AlgorithmId
+			SizeofSelect uint8
+		}
+		if err := binary.Read(stream, binary.BigEndian, &sel); err != nil {
+			return nil, fmt.Errorf("cannot read PCR selection: %v", err)
+		}
+		bitmap := make([]byte, sel.SizeofSelect)
+		if _, err := io.ReadFull(stream, bitmap); err != nil {
+			return nil, fmt.Errorf("cannot read PCR selection: %v", err)
+		}
+		s := QuotePCRSelection{Algorithm: sel.Hash}
+		for j, b := range bitmap {
+			for k := uint(0); k < 8; k++ {
+				if b&(1<<k) != 0 {
+					s.PCRs = append(s.PCRs, PCRIndex(uint(j)*8+k))
+				}
+			}
+		}
+		quote.PCRSelection = append(quote.PCRSelection, s)
+	}
+
+	pcrDigest, err := readTPM2B(stream)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read PCR digest: %v", err)
+	}
+	quote.PCRDigest = pcrDigest
+
+	return quote, nil
+}
+
+// quoteSignature corresponds to a TPMT_SIGNATURE structure for the signature schemes supported by VerifyQuote.
+type quoteSignature struct {
+	scheme uint16
+	hash   AlgorithmId
+	sig    []byte
+	r, s   *big.Int
+}
+
+func decodeQuoteSignature(data []byte) (*quoteSignature, error) {
+	stream := bytes.NewReader(data)
+
+	var hdr struct {
+		Scheme uint16
+		Hash   AlgorithmId
+	}
+	if err := binary.Read(stream, binary.BigEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if !hdr.Hash.supported() {
+		return nil, fmt.Errorf("unsupported digest algorithm %s", hdr.Hash)
+	}
+
+	out := &quoteSignature{scheme: hdr.Scheme, hash: hdr.Hash}
+	switch hdr.Scheme {
+	case tpmAlgRSASSA, tpmAlgRSAPSS:
+		sig, err := readTPM2B(stream)
+		if err != nil {
+			return nil, err
+		}
+		out.sig = sig
+	case tpmAlgECDSA:
+		r, err := readTPM2B(stream)
+		if err != nil {
+			return nil, err
+		}
+		s, err := readTPM2B(stream)
+		if err != nil {
+			return nil, err
+		}
+		out.r = new(big.Int).SetBytes(r)
+		out.s = new(big.Int).SetBytes(s)
+	default:
+		return nil, fmt.Errorf("unsupported signature scheme 0x%04x", hdr.Scheme)
+	}
+	return out, nil
+}
+
+// decodeQuotePublicKey decodes the public key from the supplied TPM2B_PUBLIC or TPMT_PUBLIC structure.
+//
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_TPM2_r1p59_Part2_Structures_pub.pdf
+//  (section 12.2.4 "TPMT_PUBLIC")
+func decodeQuotePublicKey(data []byte) (crypto.PublicKey, error) {
+	if len(data) >= 2 && int(binary.BigEndian.Uint16(data)) == len(data)-2 {
+		data = data[2:]
+	}
+
+	stream := bytes.NewReader(data)
+
+	var hdr struct {
+		Type       uint16
+		NameAlg    uint16
+		Attributes uint32
+	}
+	if err := binary.Read(stream, binary.BigEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if _, err := readTPM2B(stream); err != nil {
+		return nil, fmt.Errorf("cannot read auth policy: %v", err)
+	}
+
+	// Skip the symmetric and signing schemes. If they aren't TPM_ALG_NULL, the symmetric scheme is followed by the
+	// key bits and mode, and the signing scheme is followed by the digest algorithm.
+	var symmetric uint16
+	if err := binary.Read(stream, binary.BigEndian, &symmetric); err != nil {
+		return nil, err
+	}
+	if symmetric != tpmAlgNull {
+		if _, err := stream.Seek(4, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+	var scheme uint16
+	if err := binary.Read(stream, binary.BigEndian, &scheme); err != nil {
+		return nil, err
+	}
+	if scheme != tpmAlgNull {
+		if _, err := stream.Seek(2, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+
+	switch hdr.Type {
+	case tpmAlgRSA:
+		var params struct {
+			KeyBits  uint16
+			Exponent uint32
+		}
+		if err := binary.Read(stream, binary.BigEndian, &params); err != nil {
+			return nil, err
+		}
+		modulus, err := readTPM2B(stream)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read modulus: %v", err)
+		}
+		exponent := int(params.Exponent)
+		if exponent == 0 {
+			exponent = 65537
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: exponent}, nil
+	case tpmAlgECC:
+		var params struct {
+			CurveID uint16
+			KDF     uint16
+		}
+		if err := binary.Read(stream, binary.BigEndian, &params); err != nil {
+			return nil, err
+		}
+		if params.KDF != tpmAlgNull {
+			if _, err := stream.Seek(2, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+		var curve elliptic.Curve
+		switch params.CurveID {
+		case tpmECCNistP256:
+			curve = elliptic.P256()
+		case tpmECCNistP384:
+			curve = elliptic.P384()
+		case tpmECCNistP521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve 0x%04x", params.CurveID)
+		}
+		x, err := readTPM2B(stream)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read public point: %v", err)
+		}
+		y, err := readTPM2B(stream)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read public point: %v", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type 0x%04x", hdr.Type)
+	}
+}
+
+func verifyQuoteSignature(data []byte, sig *quoteSignature, key crypto.PublicKey) error {
+	digest := sig.hash.hash(data)
+
+	switch sig.scheme {
+	case tpmAlgRSASSA, tpmAlgRSAPSS:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("signature scheme is not compatible with the key")
+		}
+		if sig.scheme == tpmAlgRSASSA {
+			return rsa.VerifyPKCS1v15(pub, sig.hash.getHash(), digest, sig.sig)
+		}
+		return rsa.VerifyPSS(pub, sig.hash.getHash(), digest, sig.sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+	default:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("signature scheme is not compatible with the key")
+		}
+		if !ecdsa.Verify(pub, digest, sig.r, sig.s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+}
+
+// computeQuotePCRDigest computes the digest of the PCR values selected by a quote, in the order in which the TPM
+// selects them, using the specified digest algorithm.
+func computeQuotePCRDigest(alg AlgorithmId, selection []QuotePCRSelection, values PCRValues) (Digest, error) {
+	h := alg.newHash()
+	for _, s := range selection {
+		for _, pcr := range s.PCRs {
+			v, ok := values[pcr][s.Algorithm]
+			if !ok {
+				return nil, fmt.Errorf("no %s value for PCR %d", s.Algorithm, pcr)
+			}
+			h.Write(v)
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// QuoteVerifyResult is the result of VerifyQuote.
+type QuoteVerifyResult struct {
+	Quote             *TPMQuote
+	ExpectedPCRDigest Digest // The PCR digest computed from the supplied PCR values
+}
+
+// Consistent indicates whether the PCR digest in the quote matches the one computed from the supplied PCR values.
+func (r *QuoteVerifyResult) Consistent() bool {
+	return bytes.Equal(r.Quote.PCRDigest, r.ExpectedPCRDigest)
+}
+
+// VerifyQuote verifies a quote produced by the TPM2_Quote command, and computes the PCR digest for the PCRs selected
+// by the quote from the supplied PCR values (eg, the values obtained by replaying a log), so that the log can be
+// validated without access to the TPM. The quote is supplied as a TPMS_ATTEST structure, the signature as a
+// TPMT_SIGNATURE structure and the attestation key as a TPM2B_PUBLIC or TPMT_PUBLIC structure. RSASSA, RSAPSS and
+// ECDSA signatures are supported. An error is returned if the signature is invalid. Note that this doesn't check that
+// the attestation key belongs to a genuine TPM, or that the quote contains the expected qualifying data.
+func VerifyQuote(attest, signature, akPublic []byte, values PCRValues) (*QuoteVerifyResult, error) {
+	quote, err := DecodeTPMQuote(attest)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode quote: %v", err)
+	}
+	sig, err := decodeQuoteSignature(signature)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode signature: %v", err)
+	}
+	key, err := decodeQuotePublicKey(akPublic)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode attestation key: %v", err)
+	}
+	if err := verifyQuoteSignature(quote.data, sig, key); err != nil {
+		return nil, fmt.Errorf("cannot verify signature: %v", err)
+	}
+
+	expected, err := computeQuotePCRDigest(sig.hash, quote.PCRSelection, values)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compute PCR digest: %v", err)
+	}
+
+	return &QuoteVerifyResult{Quote: quote, ExpectedPCRDigest: expected}, nil
+}
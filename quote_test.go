@@ -0,0 +1,165 @@
+package tcglog
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+)
+
+func writeTestTPM2B(buf *bytes.Buffer, data []byte) {
+	binary.Write(buf, binary.BigEndian, uint16(len(data)))
+	buf.Write(data)
+}
+
+func makeTestQuote(pcrs []PCRIndex, pcrDigest Digest) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, tpmGeneratedValue)
+	binary.Write(&buf, binary.BigEndian, tpmSTAttestQuote)
+	writeTestTPM2B(&buf, []byte("signer"))
+	writeTestTPM2B(&buf, []byte("nonce"))
+	binary.Write(&buf, binary.BigEndian, uint64(1000))
+	binary.Write(&buf, binary.BigEndian, uint32(1))
+	binary.Write(&buf, binary.BigEndian, uint32(2))
+	buf.WriteByte(1)
+	binary.Write(&buf, binary.BigEndian, uint64(0x10000))
+	buf.Write(marshalPCRSelection(AlgorithmSha256, pcrs))
+	writeTestTPM2B(&buf, pcrDigest)
+	return buf.Bytes()
+}
+
+func makeTestRSAAKPublic(key *rsa.PublicKey) []byte {
+	var pub bytes.Buffer
+	binary.Write(&pub, binary.BigEndian, tpmAlgRSA)
+	binary.Write(&pub, binary.BigEndian, uint16(AlgorithmSha256))
+	binary.Write(&pub, binary.BigEndian, uint32(0x00050072))
+	writeTestTPM2B(&pub, nil)
+	binary.Write(&pub, binary.BigEndian, tpmAlgNull)
+	binary.Write(&pub, binary.BigEndian, tpmAlgRSASSA)
+	binary.Write(&pub, binary.BigEndian, uint16(AlgorithmSha256))
+	binary.Write(&pub, binary.BigEndian, uint16(key.N.BitLen()))
+	binary.Write(&pub, binary.BigEndian, uint32(0))
+	writeTestTPM2B(&pub, key.N.Bytes())
+
+	var buf bytes.Buffer
+	writeTestTPM2B(&buf, pub.Bytes())
+	return buf.Bytes()
+}
+
+func makeTestECCAKPublic(key *ecdsa.PublicKey) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, tpmAlgECC)
+	binary.Write(&buf, binary.BigEndian, uint16(AlgorithmSha256))
+	binary.Write(&buf, binary.BigEndian, uint32(0x00050072))
+	writeTestTPM2B(&buf, nil)
+	binary.Write(&buf, binary.BigEndian, tpmAlgNull)
+	binary.Write(&buf, binary.BigEndian, tpmAlgECDSA)
+	binary.Write(&buf, binary.BigEndian, uint16(AlgorithmSha256))
+	binary.Write(&buf, binary.BigEndian, tpmECCNistP256)
+	binary.Write(&buf, binary.BigEndian, tpmAlgNull)
+	writeTestTPM2B(&buf, key.X.Bytes())
+	writeTestTPM2B(&buf, key.Y.Bytes())
+	return buf.Bytes()
+}
+
+func makeTestQuotePCRValues() PCRValues {
+	values := make(PCRValues)
+	for i := PCRIndex(0); i < 8; i++ {
+		values[i] = DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte{byte(i)})}
+	}
+	return values
+}
+
+func TestVerifyQuoteRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	values := makeTestQuotePCRValues()
+	pcrs := []PCRIndex{0, 4, 7}
+	pcrDigest, _ := ComputePCRDigest(AlgorithmSha256, pcrs, values)
+	attest := makeTestQuote(pcrs, pcrDigest)
+
+	h := sha256.Sum256(attest)
+	rawSig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	if err != nil {
+		t.Fatalf("SignPKCS1v15 failed: %v", err)
+	}
+	var sig bytes.Buffer
+	binary.Write(&sig, binary.BigEndian, tpmAlgRSASSA)
+	binary.Write(&sig, binary.BigEndian, uint16(AlgorithmSha256))
+	writeTestTPM2B(&sig, rawSig)
+
+	result, err := VerifyQuote(attest, sig.Bytes(), makeTestRSAAKPublic(&key.PublicKey), values)
+	if err != nil {
+		t.Fatalf("VerifyQuote failed: %v", err)
+	}
+	if !result.Consistent() {
+		t.Errorf("Expected the quote to be consistent with the PCR values")
+	}
+	if !bytes.Equal(result.Quote.ExtraData, []byte("nonce")) || result.Quote.Clock != 1000 || !result.Quote.Safe {
+		t.Errorf("Unexpected quote: %+v", result.Quote)
+	}
+	if len(result.Quote.PCRSelection) != 1 || result.Quote.PCRSelection[0].Algorithm != AlgorithmSha256 ||
+		len(result.Quote.PCRSelection[0].PCRs) != 3 || result.Quote.PCRSelection[0].PCRs[2] != 7 {
+		t.Errorf("Unexpected PCR selection: %+v", result.Quote.PCRSelection)
+	}
+
+	values[4][AlgorithmSha256] = AlgorithmSha256.hash([]byte("modified"))
+	result, err = VerifyQuote(attest, sig.Bytes(), makeTestRSAAKPublic(&key.PublicKey), values)
+	if err != nil {
+		t.Fatalf("VerifyQuote failed: %v", err)
+	}
+	if result.Consistent() {
+		t.Errorf("Expected the quote to be inconsistent with the PCR values")
+	}
+
+	attest[len(attest)-1] ^= 0xff
+	if _, err := VerifyQuote(attest, sig.Bytes(), makeTestRSAAKPublic(&key.PublicKey), values); err == nil {
+		t.Errorf("Expected an error for a modified quote")
+	}
+}
+
+func TestVerifyQuoteECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	values := makeTestQuotePCRValues()
+	pcrs := []PCRIndex{7}
+	pcrDigest, _ := ComputePCRDigest(AlgorithmSha256, pcrs, values)
+	attest := makeTestQuote(pcrs, pcrDigest)
+
+	h := sha256.Sum256(attest)
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	var sig bytes.Buffer
+	binary.Write(&sig, binary.BigEndian, tpmAlgECDSA)
+	binary.Write(&sig, binary.BigEndian, uint16(AlgorithmSha256))
+	writeTestTPM2B(&sig, r.Bytes())
+	writeTestTPM2B(&sig, s.Bytes())
+
+	var tpm2bAttest bytes.Buffer
+	writeTestTPM2B(&tpm2bAttest, attest)
+
+	result, err := VerifyQuote(tpm2bAttest.Bytes(), sig.Bytes(), makeTestECCAKPublic(&key.PublicKey), values)
+	if err != nil {
+		t.Fatalf("VerifyQuote failed: %v", err)
+	}
+	if !result.Consistent() {
+		t.Errorf("Expected the quote to be consistent with the PCR values")
+	}
+
+	if _, err := VerifyQuote(attest, sig.Bytes(), makeTestECCAKPublic(&key.PublicKey), PCRValues{}); err == nil {
+		t.Errorf("Expected an error for missing PCR values")
+	}
+}
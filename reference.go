@@ -0,0 +1,228 @@
+package tcglog
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// referenceFileVersion is the version of the reference file format written by ReferenceValues.Write.
+const referenceFileVersion = 1
+
+// ReferenceEvent is an event from a known-good boot that is recorded in a reference file.
+type ReferenceEvent struct {
+	PCRIndex  PCRIndex  `json:"pcr"`
+	EventType EventType `json:"type"`
+	Digests   DigestMap `json:"digests"`
+
+	// Description is the textual representation of the event data, which identifies the component that was
+	// measured.
+	Description string `json:"description"`
+}
+
+func (e *ReferenceEvent) String() string {
+	return fmt.Sprintf("%s in PCR %d (%s)", e.EventType, e.PCRIndex, e.Description)
+}
+
+// ReferenceValues are the expected PCR values and event digests from a validation run of a known-good boot. They can
+// be saved to a reference file and later compared with the log from a fresh boot, in order to determine which
+// components changed.
+type ReferenceValues struct {
+	Algorithms AlgorithmIdList  `json:"algorithms"`
+	PCRValues  PCRValues        `json:"pcrValues"`
+	Events     []ReferenceEvent `json:"events"` // The events that extend the recorded PCRs, in log order
+}
+
+// NewReferenceValues creates reference values from the specified PCRs and algorithms of result.
+func NewReferenceValues(result *LogValidateResult, pcrs []PCRIndex, algorithms AlgorithmIdList) *ReferenceValues {
+	selected := make(map[PCRIndex]bool)
+	for _, pcr := range pcrs {
+		selected[pcr] = true
+	}
+
+	r := &ReferenceValues{Algorithms: algorithms, PCRValues: make(PCRValues), Events: []ReferenceEvent{}}
+	for _, pcr := range sortedPCRs(pcrs) {
+		r.PCRValues[pcr] = make(DigestMap)
+		for _, alg := range algorithms {
+			if v, ok := result.ExpectedPCRValues[pcr][alg]; ok {
+				r.PCRValues[pcr][alg] = v
+			}
+		}
+	}
+	for _, e := range result.ValidatedEvents {
+		if !selected[e.Event.PCRIndex] || !doesEventTypeExtendPCR(e.Event.EventType) {
+			continue
+		}
+		re := ReferenceEvent{PCRIndex: e.Event.PCRIndex, EventType: e.Event.EventType, Digests: make(DigestMap),
+			Description: eventDescription(e.Event)}
+		for _, alg := range algorithms {
+			if d, ok := e.Event.Digests.Lookup(alg); ok {
+				re.Digests[alg] = d
+			}
+		}
+		r.Events = append(r.Events, re)
+	}
+	return r
+}
+
+type referenceFile struct {
+	Version   int             `json:"version"`
+	Reference json.RawMessage `json:"reference"`
+	Checksum  Digest          `json:"checksum"`            // SHA-256 of the compact encoding of Reference
+	Signature []byte          `json:"signature,omitempty"` // Ed25519 signature of Checksum
+}
+
+// Write writes these reference values to w as JSON, along with a SHA-256 checksum that detects accidental
+// modification. If key is not nil, the checksum is also signed with it so that ReadReferenceValues can detect
+// deliberate modification.
+func (r *ReferenceValues) Write(w io.Writer, key ed25519.PrivateKey) error {
+	reference, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	checksum := sha256.Sum256(reference)
+	f := referenceFile{Version: referenceFileVersion, Reference: reference, Checksum: checksum[:]}
+	if key != nil {
+		f.Signature = ed25519.Sign(key, checksum[:])
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(&f)
+}
+
+// ReadReferenceValues reads reference values written by ReferenceValues.Write, and verifies the checksum. If key is
+// not nil, the file must also have a valid signature from the corresponding private key.
+func ReadReferenceValues(r io.Reader, key ed25519.PublicKey) (*ReferenceValues, error) {
+	var f referenceFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("cannot decode reference file: %v", err)
+	}
+	if f.Version != referenceFileVersion {
+		return nil, fmt.Errorf("unsupported reference file version (%d)", f.Version)
+	}
+
+	// The reference values are indented along with the rest of the file, so the checksum is computed over the
+	// compact encoding that was originally hashed.
+	var reference bytes.Buffer
+	if err := json.Compact(&reference, f.Reference); err != nil {
+		return nil, fmt.Errorf("cannot decode reference values: %v", err)
+	}
+	checksum := sha256.Sum256(reference.Bytes())
+	if !bytes.Equal(checksum[:], f.Checksum) {
+		return nil, errors.New("reference file checksum mismatch")
+	}
+	if key != nil && (len(f.Signature) == 0 || !ed25519.Verify(key, checksum[:], f.Signature)) {
+		return nil, errors.New("reference file doesn't have a valid signature")
+	}
+
+	var out ReferenceValues
+	if err := json.Unmarshal(reference.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("cannot decode reference values: %v", err)
+	}
+	return &out, nil
+}
+
+// ReferenceChange describes an event that differs between a reference and a log.
+type ReferenceChange struct {
+	Kind      EventDiffKind
+	Reference *ReferenceEvent // The event from the reference. This is nil for EventDiffAdded
+	Event     *Event          // The event from the log. This is nil for EventDiffRemoved
+}
+
+func (c *ReferenceChange) String() string {
+	switch c.Kind {
+	case EventDiffAdded:
+		return fmt.Sprintf("added event %d (type: %s): %s", c.Event.Index, c.Event.EventType, eventDescription(c.Event))
+	case EventDiffRemoved:
+		return fmt.Sprintf("removed %s", c.Reference)
+	default:
+		return fmt.Sprintf("changed event %d (type: %s): %s -> %s", c.Event.Index, c.Event.EventType,
+			c.Reference.Description, eventDescription(c.Event))
+	}
+}
+
+func eventDescription(e *Event) string {
+	if e.Data() == nil {
+		return ""
+	}
+	return e.Data().String()
+}
+
+// ReferencePCRDiff describes how a PCR differs between a reference and a log.
+type ReferencePCRDiff struct {
+	PCR      PCRIndex
+	Changes  []*ReferenceChange // The events that were added, removed or changed, in log order
+	Diverges bool               // Whether the PCR value expected from the log differs from the reference value
+}
+
+// Compare compares the events and expected PCR values of result with these reference values, and returns the
+// recorded PCRs that differ in ascending order. Events are compared by type and by the digests for the algorithms
+// in the reference, so the changes identify which components were measured differently.
+func (r *ReferenceValues) Compare(result *LogValidateResult) []*ReferencePCRDiff {
+	// DiffLogs compares event data as well as digests, so compare events without their data. The events are mapped
+	// back to the originals afterwards.
+	references := make(map[*Event]*ReferenceEvent)
+	var old []*Event
+	for i := range r.Events {
+		e := &r.Events[i]
+		digests := make(DigestMap)
+		for _, alg := range r.Algorithms {
+			if d, ok := e.Digests[alg]; ok {
+				digests[alg] = d
+			}
+		}
+		stripped := &Event{PCRIndex: e.PCRIndex, EventType: e.EventType, Digests: NewEventDigests(digests)}
+		references[stripped] = e
+		old = append(old, stripped)
+	}
+	originals := make(map[*Event]*Event)
+	var new []*Event
+	for _, e := range result.ValidatedEvents {
+		if _, ok := r.PCRValues[e.Event.PCRIndex]; !ok || !doesEventTypeExtendPCR(e.Event.EventType) {
+			continue
+		}
+		stripped := &Event{Index: e.Event.Index, PCRIndex: e.Event.PCRIndex, EventType: e.Event.EventType,
+			Digests: e.Event.Digests}
+		originals[stripped] = e.Event
+		new = append(new, stripped)
+	}
+
+	diffs := make(map[PCRIndex]*ReferencePCRDiff)
+	for _, p := range DiffLogs(old, new).PCRs {
+		d := &ReferencePCRDiff{PCR: p.PCR}
+		for _, e := range p.Events {
+			c := &ReferenceChange{Kind: e.Kind}
+			if e.Old != nil {
+				c.Reference = references[e.Old]
+			}
+			if e.New != nil {
+				c.Event = originals[e.New]
+			}
+			d.Changes = append(d.Changes, c)
+		}
+		diffs[p.PCR] = d
+	}
+
+	var out []*ReferencePCRDiff
+	for _, pcr := range r.PCRValues.PCRs() {
+		d := diffs[pcr]
+		for alg, v := range r.PCRValues[pcr] {
+			if bytes.Equal(result.ExpectedPCRValues[pcr][alg], v) {
+				continue
+			}
+			if d == nil {
+				d = &ReferencePCRDiff{PCR: pcr}
+			}
+			d.Diverges = true
+		}
+		if d != nil {
+			out = append(out, d)
+		}
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package tcglog
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func replayTestReferenceLog(t *testing.T, pcr4 ...string) *LogValidateResult {
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+	events := []testLogEvent{makeTestLogEvent(0, EventTypeSCRTMVersion, []byte("version"), algs...)}
+	for _, d := range pcr4 {
+		events = append(events, makeTestLogEvent(4, EventTypeEFIAction, []byte(d), algs...))
+	}
+	logPath := filepath.Join(dir, "log")
+	if err := ioutil.WriteFile(logPath, makeTestLog_2(algs, events), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	result, err := ReplayAndValidateLog(logPath, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayAndValidateLog failed: %v", err)
+	}
+	return result
+}
+
+func TestReferenceValuesWriteAndRead(t *testing.T) {
+	result := replayTestReferenceLog(t, "foo", "bar")
+	ref := NewReferenceValues(result, []PCRIndex{0, 4}, AlgorithmIdList{AlgorithmSha256})
+	if len(ref.Events) != 3 || ref.Events[1].Description != "foo" {
+		t.Fatalf("Unexpected events: %+v", ref.Events)
+	}
+	if _, ok := ref.Events[1].Digests[AlgorithmSha1]; ok {
+		t.Errorf("Unexpected digest for algorithm that wasn't selected")
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ref.Write(&buf, priv); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	read, err := ReadReferenceValues(bytes.NewReader(buf.Bytes()), pub)
+	if err != nil {
+		t.Fatalf("ReadReferenceValues failed: %v", err)
+	}
+	if !reflect.DeepEqual(read, ref) {
+		t.Errorf("Unexpected reference values: %+v", read)
+	}
+
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := ReadReferenceValues(bytes.NewReader(buf.Bytes()), otherPub); err == nil {
+		t.Errorf("ReadReferenceValues should fail with the wrong key")
+	}
+
+	modified := strings.Replace(buf.String(), `"foo"`, `"baz"`, 1)
+	if _, err := ReadReferenceValues(strings.NewReader(modified), nil); err == nil ||
+		err.Error() != "reference file checksum mismatch" {
+		t.Errorf("Unexpected error for modified file: %v", err)
+	}
+
+	buf.Reset()
+	if err := ref.Write(&buf, nil); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if _, err := ReadReferenceValues(bytes.NewReader(buf.Bytes()), nil); err != nil {
+		t.Errorf("ReadReferenceValues failed without a key: %v", err)
+	}
+	if _, err := ReadReferenceValues(bytes.NewReader(buf.Bytes()), pub); err == nil {
+		t.Errorf("ReadReferenceValues should fail for an unsigned file when a key is supplied")
+	}
+}
+
+func TestReferenceValuesCompare(t *testing.T) {
+	ref := NewReferenceValues(replayTestReferenceLog(t, "shim", "grub", "kernel"), []PCRIndex{0, 4},
+		AlgorithmIdList{AlgorithmSha256})
+
+	if diffs := ref.Compare(replayTestReferenceLog(t, "shim", "grub", "kernel")); len(diffs) != 0 {
+		t.Errorf("Unexpected differences for identical log: %v", diffs)
+	}
+
+	diffs := ref.Compare(replayTestReferenceLog(t, "shim", "grub2", "kernel", "initrd"))
+	if len(diffs) != 1 || diffs[0].PCR != 4 || !diffs[0].Diverges {
+		t.Fatalf("Unexpected differences: %+v", diffs)
+	}
+	changes := diffs[0].Changes
+	if len(changes) != 2 {
+		t.Fatalf("Unexpected changes: %v", changes)
+	}
+	if changes[0].Kind != EventDiffChanged || changes[0].Reference.Description != "grub" ||
+		changes[0].Event.Index != 1 {
+		t.Errorf("Unexpected first change: %s", changes[0])
+	}
+	if changes[0].String() != "changed event 1 (type: EV_EFI_ACTION): grub -> grub2" {
+		t.Errorf("Unexpected description: %s", changes[0])
+	}
+	if changes[1].Kind != EventDiffAdded || changes[1].Event.Index != 3 || changes[1].Reference != nil {
+		t.Errorf("Unexpected second change: %s", changes[1])
+	}
+
+	diffs = ref.Compare(replayTestReferenceLog(t, "shim", "kernel"))
+	if len(diffs) != 1 || len(diffs[0].Changes) != 1 || diffs[0].Changes[0].Kind != EventDiffRemoved {
+		t.Fatalf("Unexpected differences: %+v", diffs)
+	}
+	if diffs[0].Changes[0].String() != "removed EV_EFI_ACTION in PCR 4 (grub)" {
+		t.Errorf("Unexpected description: %s", diffs[0].Changes[0])
+	}
+}
@@ -0,0 +1,154 @@
+package tcglog
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+	"time"
+)
+
+// ReportEnvironment supplies the parts of the environment that templates created with
+// NewReportTemplateWithEnvironment depend on. Templates rendered with the same inputs and the same ReportEnvironment
+// produce identical output, which is needed for reports that are signed or compared byte for byte.
+type ReportEnvironment struct {
+	Clock    func() time.Time // Returns the time used by the "now" function. If this is nil, time.Now is used
+	Location *time.Location   // The location that times are rendered in. If this is nil, time.Local is used
+}
+
+// ReproducibleReportEnvironment is a ReportEnvironment that doesn't depend on when or where a report is rendered.
+// The "now" function always returns the Unix epoch, and times are rendered in UTC.
+var ReproducibleReportEnvironment = ReportEnvironment{
+	Clock:    func() time.Time { return time.Unix(0, 0) },
+	Location: time.UTC}
+
+func (e ReportEnvironment) now() time.Time {
+	if e.Clock == nil {
+		return time.Now().In(e.location())
+	}
+	return e.Clock().In(e.location())
+}
+
+func (e ReportEnvironment) location() *time.Location {
+	if e.Location == nil {
+		return time.Local
+	}
+	return e.Location
+}
+
+// reportTemplateEnvFuncs returns the functions available to templates created with NewReportTemplateWithEnvironment
+// that depend on the supplied environment.
+func reportTemplateEnvFuncs(env ReportEnvironment) template.FuncMap {
+	return template.FuncMap{
+		// now returns the current time, as supplied by the environment.
+		"now": env.now,
+
+		// formatTime formats a time in the location of the environment, as RFC 3339 or with the optional layout.
+		// Go's time formatting doesn't depend on the locale of the host.
+		"formatTime": func(t time.Time, layout ...string) (string, error) {
+			switch len(layout) {
+			case 0:
+				return t.In(env.location()).Format(time.RFC3339), nil
+			case 1:
+				return t.In(env.location()).Format(layout[0]), nil
+			default:
+				return "", errors.New("formatTime accepts at most one layout")
+			}
+		},
+	}
+}
+
+// reportTemplateFuncs are the functions available to templates created with NewReportTemplate.
+var reportTemplateFuncs = template.FuncMap{
+	// hex formats a byte slice (eg, a Digest) as a hexadecimal string.
+	"hex": func(b []byte) string {
+		return hex.EncodeToString(b)
+	},
+
+	// digest returns the hexadecimal digest of an event for the named algorithm (eg, "sha256").
+	"digest": func(event *Event, alg string) (string, error) {
+		id, err := ParseAlgorithm(alg)
+		if err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(event.Digests.Get(id)), nil
+	},
+
+	// dataType returns the type of event data, using the same names as the "dataType" field of the JSON encoding
+	// of an event (eg, "UEFI_VARIABLE_DATA").
+	"dataType": func(data EventData) string {
+		if data == nil {
+			return ""
+		}
+		return eventDataJSONType(data)
+	},
+
+	// fields returns the decoded fields of event data, using the same names and values as the JSON encoding of an
+	// event (eg, (fields .Data).unicodeName). This works for all event data types, including those whose fields
+	// aren't exported.
+	"fields": func(data EventData) (interface{}, error) {
+		if data == nil {
+			return nil, nil
+		}
+		b, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode event data: %v", err)
+		}
+		var out interface{}
+		if err := json.Unmarshal(b, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	},
+
+	// guid returns the symbolic name of a GUID if it has one (see RegisterEFIGUIDName), or the canonical string
+	// form otherwise.
+	"guid": func(v interface{}) (string, error) {
+		switch g := v.(type) {
+		case EFIGUID:
+			return g.nameOrString(), nil
+		case *EFIGUID:
+			return g.nameOrString(), nil
+		default:
+			return "", fmt.Errorf("%T is not a GUID", v)
+		}
+	},
+}
+
+// NewReportTemplate returns a new text/template with the specified name, for customizing how the tools in this
+// module render events and findings. It is equivalent to NewReportTemplateWithEnvironment with the default
+// ReportEnvironment, which uses the clock and time zone of the host.
+func NewReportTemplate(name string) *template.Template {
+	return NewReportTemplateWithEnvironment(name, ReportEnvironment{})
+}
+
+// NewReportTemplateWithEnvironment returns a new text/template with the specified name, for customizing how the
+// tools in this module render events and findings. In addition to the standard template functions, the returned
+// template provides:
+//   - hex: formats a byte slice as a hexadecimal string.
+//   - digest EVENT ALG: returns the digest of an event for the named algorithm as a hexadecimal string.
+//   - dataType DATA: returns the type of some event data, as used in the JSON encoding of events.
+//   - fields DATA: returns the decoded fields of some event data as a map, as used in the JSON encoding of events.
+//   - guid GUID: returns the symbolic name of a GUID if it has one, or its canonical string form otherwise.
+//   - now: returns the current time according to env.
+//   - formatTime TIME [LAYOUT]: formats a time in the location of env, as RFC 3339 unless a layout is supplied.
+func NewReportTemplateWithEnvironment(name string, env ReportEnvironment) *template.Template {
+	return template.New(name).Funcs(reportTemplateFuncs).Funcs(reportTemplateEnvFuncs(env))
+}
+
+// ParseReportTemplateFile creates a template with NewReportTemplate and parses the specified file in to it.
+func ParseReportTemplateFile(path string) (*template.Template, error) {
+	return ParseReportTemplateFileWithEnvironment(path, ReportEnvironment{})
+}
+
+// ParseReportTemplateFileWithEnvironment creates a template with NewReportTemplateWithEnvironment and parses the
+// specified file in to it.
+func ParseReportTemplateFileWithEnvironment(path string, env ReportEnvironment) (*template.Template, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReportTemplateWithEnvironment(path, env).Parse(string(data))
+}
@@ -0,0 +1,75 @@
+package tcglog
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNewReportTemplate(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+	events := readAllTestLogEvents(t, makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(7, EventTypeEFIVariableDriverConfig,
+			makeTestVariableEventData(convertStringToUtf16("SecureBoot")), algs...),
+		makeTestLogEvent(4, EventTypeEFIAction, []byte("Calling EFI Application from Boot Option"), algs...)}),
+		LogOptions{})
+
+	tmpl, err := NewReportTemplate("test").Parse(`{{range .}}{{.PCRIndex}} {{digest . "sha256" | printf "%.8s"}} ` +
+		`{{dataType .Data}}{{if eq (dataType .Data) "UEFI_VARIABLE_DATA"}} {{guid .Data.VariableName}}-` +
+		`{{(fields .Data).unicodeName}}{{end}}
+{{end}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, events[1:]); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	expected := fmt.Sprintf("7 %x UEFI_VARIABLE_DATA EFI_GLOBAL_VARIABLE-SecureBoot\n4 %x string\n",
+		events[1].Digests.Get(AlgorithmSha256)[:4], events[2].Digests.Get(AlgorithmSha256)[:4])
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\ngot:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestNewReportTemplateInvalidAlgorithm(t *testing.T) {
+	tmpl, err := NewReportTemplate("test").Parse(`{{digest . "md5"}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if err := tmpl.Execute(new(bytes.Buffer), &Event{}); err == nil {
+		t.Errorf("Execute should have failed")
+	}
+}
+
+func TestNewReportTemplateWithEnvironment(t *testing.T) {
+	tmpl, err := NewReportTemplateWithEnvironment("test", ReproducibleReportEnvironment).Parse(
+		`{{formatTime now}} {{formatTime . "Mon Jan 2 15:04"}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	ts := time.Date(2020, time.March, 4, 1, 30, 0, 0, time.FixedZone("test", 3600))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ts); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if buf.String() != "1970-01-01T00:00:00Z Wed Mar 4 00:30" {
+		t.Errorf("Unexpected output: %s", buf.String())
+	}
+
+	env := ReportEnvironment{Clock: func() time.Time { return ts }, Location: time.FixedZone("test2", -7200)}
+	tmpl, err = NewReportTemplateWithEnvironment("test", env).Parse(`{{formatTime now}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	buf.Reset()
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if buf.String() != "2020-03-03T22:30:00-02:00" {
+		t.Errorf("Unexpected output: %s", buf.String())
+	}
+}
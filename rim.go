@@ -0,0 +1,291 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// RIMFile describes a file in the payload of a Reference Integrity Manifest, along with its reference digests.
+type RIMFile struct {
+	Name    string
+	Size    uint64
+	Digests DigestMap
+}
+
+// ReferenceIntegrityManifest is a TCG Reference Integrity Manifest (RIM) published by a platform vendor, which
+// contains the reference digests of the firmware components that the platform measures.
+type ReferenceIntegrityManifest struct {
+	TagID   string
+	Name    string
+	Version string
+	Files   []*RIMFile
+}
+
+// https://www.w3.org/TR/xmldsig-core1/#sec-AlgID
+var swidHashAlgorithms = map[string]AlgorithmId{
+	"http://www.w3.org/2000/09/xmldsig#sha1":        AlgorithmSha1,
+	"http://www.w3.org/2001/04/xmlenc#sha256":       AlgorithmSha256,
+	"http://www.w3.org/2001/04/xmldsig-more#sha384": AlgorithmSha384,
+	"http://www.w3.org/2001/04/xmlenc#sha512":       AlgorithmSha512,
+}
+
+// ReadSWIDRIM reads a Reference Integrity Manifest in the form of a SWID tag (ISO/IEC 19770-2) as described by the
+// TCG PC Client RIM specification. The reference digests are read from the hash attributes of the File elements in
+// the Payload, where the namespace of each attribute identifies the digest algorithm.
+//
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_RIM_Model_v1p01_r0p16_pub.pdf
+//  (section 6 "SWID Tags as RIM")
+func ReadSWIDRIM(r io.Reader) (*ReferenceIntegrityManifest, error) {
+	decoder := xml.NewDecoder(r)
+
+	var rim *ReferenceIntegrityManifest
+	payloadDepth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode XML: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Local == "SoftwareIdentity" && rim == nil:
+				rim = &ReferenceIntegrityManifest{}
+				for _, attr := range t.Attr {
+					switch attr.Name.Local {
+					case "tagId":
+						rim.TagID = attr.Value
+					case "name":
+						rim.Name = attr.Value
+					case "version":
+						rim.Version = attr.Value
+					}
+				}
+			case t.Name.Local == "Payload" && rim != nil:
+				payloadDepth = 1
+			case payloadDepth > 0:
+				payloadDepth++
+				if t.Name.Local != "File" {
+					continue
+				}
+				file, err := decodeSWIDFile(t)
+				if err != nil {
+					return nil, err
+				}
+				rim.Files = append(rim.Files, file)
+			}
+		case xml.EndElement:
+			if payloadDepth > 0 {
+				payloadDepth--
+			}
+		}
+	}
+
+	if rim == nil {
+		return nil, errors.New("no SoftwareIdentity element")
+	}
+	return rim, nil
+}
+
+func decodeSWIDFile(elem xml.StartElement) (*RIMFile, error) {
+	file := &RIMFile{Digests: DigestMap{}}
+	for _, attr := range elem.Attr {
+		switch {
+		case attr.Name.Local == "name":
+			file.Name = attr.Value
+		case attr.Name.Local == "size":
+			size, err := strconv.ParseUint(attr.Value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid size for file %s: %v", file.Name, err)
+			}
+			file.Size = size
+		case attr.Name.Local == "hash":
+			alg, ok := swidHashAlgorithms[attr.Name.Space]
+			if !ok {
+				continue
+			}
+			digest, err := hex.DecodeString(attr.Value)
+			if err != nil || len(digest) != alg.size() {
+				return nil, fmt.Errorf("invalid %s hash for file %s", alg, file.Name)
+			}
+			file.Digests[alg] = digest
+		}
+	}
+	return file, nil
+}
+
+const (
+	coswidTagID           = 0
+	coswidSoftwareName    = 1
+	coswidPayload         = 6
+	coswidHash            = 7
+	coswidSoftwareVersion = 13
+	coswidDirectory       = 16
+	coswidFile            = 17
+	coswidSize            = 20
+	coswidFSName          = 24
+	coswidPathElements    = 26
+)
+
+// https://www.iana.org/assignments/named-information/named-information.xhtml
+var coswidHashAlgorithms = map[int64]AlgorithmId{
+	1: AlgorithmSha256,
+	7: AlgorithmSha384,
+	8: AlgorithmSha512,
+}
+
+// ReadCoSWIDRIM reads a Reference Integrity Manifest in the form of a CBOR encoded CoSWID tag. The reference digests
+// are read from the hash entries of the file entries in the payload.
+//
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_RIM_Model_v1p01_r0p16_pub.pdf
+//  (section 7 "CoSWID Tags as RIM")
+func ReadCoSWIDRIM(r io.Reader) (*ReferenceIntegrityManifest, error) {
+	item, err := decodeCBOR(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode CBOR: %v", err)
+	}
+	tag, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("CoSWID tag is not a map")
+	}
+
+	rim := &ReferenceIntegrityManifest{}
+	switch id := tag[int64(coswidTagID)].(type) {
+	case string:
+		rim.TagID = id
+	case []byte:
+		rim.TagID = fmt.Sprintf("%x", id)
+	}
+	rim.Name, _ = tag[int64(coswidSoftwareName)].(string)
+	rim.Version, _ = tag[int64(coswidSoftwareVersion)].(string)
+
+	if payload, ok := tag[int64(coswidPayload)].(map[interface{}]interface{}); ok {
+		if err := decodeCoSWIDResources(rim, payload, 0); err != nil {
+			return nil, err
+		}
+	}
+	return rim, nil
+}
+
+// coswidEntries returns the entries for a CoSWID key, which may contain a single entry or an array of entries.
+func coswidEntries(v interface{}) []map[interface{}]interface{} {
+	var out []map[interface{}]interface{}
+	switch e := v.(type) {
+	case map[interface{}]interface{}:
+		out = append(out, e)
+	case []interface{}:
+		for _, i := range e {
+			if m, ok := i.(map[interface{}]interface{}); ok {
+				out = append(out, m)
+			}
+		}
+	}
+	return out
+}
+
+func decodeCoSWIDResources(rim *ReferenceIntegrityManifest, resources map[interface{}]interface{}, depth int) error {
+	if depth > cborMaxDepth {
+		return errors.New("maximum directory depth exceeded")
+	}
+
+	for _, dir := range coswidEntries(resources[int64(coswidDirectory)]) {
+		if elements, ok := dir[int64(coswidPathElements)].(map[interface{}]interface{}); ok {
+			if err := decodeCoSWIDResources(rim, elements, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, f := range coswidEntries(resources[int64(coswidFile)]) {
+		file := &RIMFile{Digests: DigestMap{}}
+		file.Name, _ = f[int64(coswidFSName)].(string)
+		if size, ok := f[int64(coswidSize)].(int64); ok && size >= 0 {
+			file.Size = uint64(size)
+		}
+		if hash, ok := f[int64(coswidHash)].([]interface{}); ok && len(hash) == 2 {
+			algId, _ := hash[0].(int64)
+			digest, _ := hash[1].([]byte)
+			if alg, ok := coswidHashAlgorithms[algId]; ok {
+				if len(digest) != alg.size() {
+					return fmt.Errorf("invalid %s hash for file %s", alg, file.Name)
+				}
+				file.Digests[alg] = digest
+			}
+		}
+		rim.Files = append(rim.Files, file)
+	}
+
+	return nil
+}
+
+func isFirmwareComponentEventType(t EventType) bool {
+	switch t {
+	case EventTypePostCode, EventTypeSCRTMContents, EventTypeEFIPlatformFirmwareBlob,
+		EventTypeEFIPlatformFirmwareBlob2, EventTypeEFIBootServicesDriver, EventTypeEFIRuntimeServicesDriver,
+		EventTypeEFIBootServicesApplication:
+		return true
+	default:
+		return false
+	}
+}
+
+// RIMMatch associates an event with the file from a Reference Integrity Manifest that it corresponds to.
+type RIMMatch struct {
+	Event *Event
+	RIM   *ReferenceIntegrityManifest
+	File  *RIMFile
+}
+
+// RIMVerificationResult is the result of VerifyFirmwareMeasurements.
+type RIMVerificationResult struct {
+	Matched   []RIMMatch // Events with a digest that matches a reference digest
+	Unmatched []*Event   // Events with no matching reference digest
+}
+
+func (f *RIMFile) matches(digests EventDigests) bool {
+	matched := false
+	for _, alg := range digests.Algorithms() {
+		ref, ok := f.Digests[alg]
+		if !ok {
+			continue
+		}
+		if !bytes.Equal(ref, digests.Get(alg)) {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// VerifyFirmwareMeasurements checks the firmware component measurements in PCR 0 and PCR 2 against the reference
+// digests contained in the supplied Reference Integrity Manifests. An event matches a file if it has at least one
+// digest in common with the file's reference digests, and none that differ.
+func VerifyFirmwareMeasurements(events []*Event, rims ...*ReferenceIntegrityManifest) *RIMVerificationResult {
+	result := &RIMVerificationResult{}
+
+Events:
+	for _, e := range events {
+		if (e.PCRIndex != 0 && e.PCRIndex != 2) || !isFirmwareComponentEventType(e.EventType) {
+			continue
+		}
+		for _, rim := range rims {
+			for _, f := range rim.Files {
+				if f.matches(e.Digests) {
+					result.Matched = append(result.Matched, RIMMatch{Event: e, RIM: rim, File: f})
+					continue Events
+				}
+			}
+		}
+		result.Unmatched = append(result.Unmatched, e)
+	}
+
+	return result
+}
@@ -0,0 +1,94 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestReadSWIDRIM(t *testing.T) {
+	digest := AlgorithmSha256.hash([]byte("firmware volume"))
+	doc := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<SoftwareIdentity xmlns="http://standards.iso.org/iso/19770/-2/2015/schema.xsd"
+    xmlns:SHA256="http://www.w3.org/2001/04/xmlenc#sha256"
+    tagId="94f6b457-9ac9-4d35-9b3f-78804173b65a" name="Example BIOS" version="01.00">
+  <Entity name="Example Inc" regid="example.com" role="softwareCreator tagCreator"/>
+  <Payload>
+    <Directory name="rim">
+      <File name="dxe.bin" size="1024" SHA256:hash="%x"/>
+    </Directory>
+  </Payload>
+</SoftwareIdentity>`, digest)
+
+	rim, err := ReadSWIDRIM(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("ReadSWIDRIM failed: %v", err)
+	}
+	if rim.Name != "Example BIOS" || rim.Version != "01.00" || rim.TagID != "94f6b457-9ac9-4d35-9b3f-78804173b65a" {
+		t.Errorf("Unexpected RIM: %+v", rim)
+	}
+	if len(rim.Files) != 1 {
+		t.Fatalf("Unexpected number of files: %d", len(rim.Files))
+	}
+	if rim.Files[0].Name != "dxe.bin" || rim.Files[0].Size != 1024 || !bytes.Equal(rim.Files[0].Digests[AlgorithmSha256], digest) {
+		t.Errorf("Unexpected file: %+v", rim.Files[0])
+	}
+}
+
+func TestReadCoSWIDRIM(t *testing.T) {
+	digest := AlgorithmSha256.hash([]byte("firmware volume"))
+
+	var buf bytes.Buffer
+	buf.Write([]byte{0xa3})                       // map(3)
+	buf.Write([]byte{0x00, 0x62, 't', '1'})       // tag-id: "t1"
+	buf.Write([]byte{0x01, 0x62, 'f', 'w'})       // software-name: "fw"
+	buf.Write([]byte{0x06, 0xa1, 0x11, 0xa3})     // payload: { file: map(3)
+	buf.Write([]byte{0x18, 0x18, 0x67})           // fs-name:
+	buf.WriteString("dxe.bin")                    // "dxe.bin"
+	buf.Write([]byte{0x14, 0x19, 0x04, 0x00})     // size: 1024
+	buf.Write([]byte{0x07, 0x82, 0x01, 0x58, 32}) // hash: [sha-256, bytes(32)
+	buf.Write(digest)
+
+	rim, err := ReadCoSWIDRIM(&buf)
+	if err != nil {
+		t.Fatalf("ReadCoSWIDRIM failed: %v", err)
+	}
+	if rim.TagID != "t1" || rim.Name != "fw" {
+		t.Errorf("Unexpected RIM: %+v", rim)
+	}
+	if len(rim.Files) != 1 {
+		t.Fatalf("Unexpected number of files: %d", len(rim.Files))
+	}
+	if rim.Files[0].Name != "dxe.bin" || rim.Files[0].Size != 1024 || !bytes.Equal(rim.Files[0].Digests[AlgorithmSha256], digest) {
+		t.Errorf("Unexpected file: %+v", rim.Files[0])
+	}
+
+	// A bogus string length shouldn't cause a huge allocation.
+	data, _ := hex.DecodeString("5b7fffffffffffffff")
+	if _, err := ReadCoSWIDRIM(bytes.NewReader(data)); err == nil {
+		t.Errorf("ReadCoSWIDRIM should fail for an invalid string length")
+	}
+}
+
+func TestVerifyFirmwareMeasurements(t *testing.T) {
+	good := DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte("good"))}
+	bad := DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte("bad"))}
+
+	rim := &ReferenceIntegrityManifest{Files: []*RIMFile{{Name: "good.bin", Digests: good}}}
+	events := []*Event{
+		{PCRIndex: 0, EventType: EventTypeEFIPlatformFirmwareBlob, Digests: NewEventDigests(good)},
+		{PCRIndex: 0, EventType: EventTypeEFIPlatformFirmwareBlob, Digests: NewEventDigests(bad)},
+		{PCRIndex: 0, EventType: EventTypeSeparator, Digests: NewEventDigests(bad)},
+		{PCRIndex: 4, EventType: EventTypeEFIBootServicesApplication, Digests: NewEventDigests(bad)},
+	}
+
+	result := VerifyFirmwareMeasurements(events, rim)
+	if len(result.Matched) != 1 || result.Matched[0].Event != events[0] || result.Matched[0].File.Name != "good.bin" {
+		t.Errorf("Unexpected matches: %+v", result.Matched)
+	}
+	if len(result.Unmatched) != 1 || result.Unmatched[0] != events[1] {
+		t.Errorf("Unexpected unmatched events: %+v", result.Unmatched)
+	}
+}
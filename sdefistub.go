@@ -27,6 +27,9 @@ func (e *SystemdEFIStubEventData) EncodeMeasuredBytes(buf io.Writer) error {
 func decodeEventDataSystemdEFIStub(data []byte) (EventData, int, error) {
 	// data is a UTF-16 string in little-endian form terminated with a single zero byte.
 	// Omit the zero byte added by the EFI stub and then convert to native byte order.
+	if len(data) == 0 {
+		return nil, 0, nil
+	}
 	reader := bytes.NewReader(data[:len(data)-1])
 
 	utf16Str := make([]uint16, len(data)/2)
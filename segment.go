@@ -0,0 +1,124 @@
+package tcglog
+
+import (
+	"fmt"
+)
+
+// LogSegmentStart describes how the start of a boot segment was detected.
+type LogSegmentStart int
+
+const (
+	// LogSegmentStartLog indicates that the segment starts at the beginning of the log.
+	LogSegmentStartLog LogSegmentStart = iota
+
+	// LogSegmentStartSpecId indicates that the segment starts with a Spec ID event in PCR 0 that appears after
+	// measurements, eg, because a kernel started with kexec appended its own measurement sequence to the log. The
+	// TPM isn't reset, so the segment extends the PCR values from the end of the previous segment unless it also
+	// contains a StartupLocality event.
+	LogSegmentStartSpecId
+
+	// LogSegmentStartStartupLocality indicates that the segment starts with a StartupLocality event that appears after
+	// a measurement to PCR 0, which means that the TPM was restarted.
+	LogSegmentStartStartupLocality
+)
+
+func (s LogSegmentStart) String() string {
+	switch s {
+	case LogSegmentStartLog:
+		return "start of log"
+	case LogSegmentStartSpecId:
+		return "Spec ID event"
+	case LogSegmentStartStartupLocality:
+		return "StartupLocality event"
+	default:
+		return fmt.Sprintf("LogSegmentStart(%d)", int(s))
+	}
+}
+
+// LogSegment is a sequence of events from a log that was recorded by a single boot.
+type LogSegment struct {
+	Start   LogSegmentStart
+	Events  []*Event
+	Startup *StartupInfo // The startup sequence indicated by the events in this segment
+
+	// Reset indicates that the PCRs are in their reset state at the start of this segment, rather than having the
+	// values from the end of the previous segment.
+	Reset bool
+
+	// InitialPCRValues are the PCR values at the start of this segment. PCRs that aren't present are in their reset
+	// state.
+	InitialPCRValues PCRValues
+
+	ExpectedPCRValues PCRValues // The PCR values after replaying this segment from InitialPCRValues
+}
+
+// splitLogSegments splits events at the events that start a new boot segment.
+func splitLogSegments(events []*Event) []*LogSegment {
+	segment := &LogSegment{Start: LogSegmentStartLog, Reset: true}
+	out := []*LogSegment{segment}
+	measured := false
+	pcr0Measured := false
+
+	for _, e := range events {
+		var start LogSegmentStart
+		switch _, isLocality := startupLocality(e); {
+		case isSpecIdEvent(e) && e.PCRIndex == 0 && measured:
+			start = LogSegmentStartSpecId
+		case isLocality && pcr0Measured:
+			start = LogSegmentStartStartupLocality
+		case isLocality:
+			// A StartupLocality event before any measurements to PCR 0 in a segment that starts with a Spec ID
+			// event indicates that the TPM was restarted.
+			segment.Reset = true
+		}
+		if start != LogSegmentStartLog {
+			segment = &LogSegment{Start: start, Reset: start == LogSegmentStartStartupLocality}
+			out = append(out, segment)
+			measured = false
+			pcr0Measured = false
+		}
+
+		segment.Events = append(segment.Events, e)
+		if doesEventTypeExtendPCR(e.EventType) {
+			measured = true
+			if e.PCRIndex == 0 {
+				pcr0Measured = true
+			}
+		}
+	}
+
+	return out
+}
+
+// SplitLogSegments splits the supplied events from a log in to the segments recorded by each boot. Some systems
+// append a second measurement sequence to the log after a kexec, which starts with another Spec ID event, and a
+// StartupLocality event after measurements to PCR 0 indicates that the TPM was restarted. Each segment is replayed
+// for the specified algorithms from the appropriate initial PCR values: the reset state if the TPM was restarted, or
+// the values from the end of the previous segment otherwise. A log recorded by a single boot has one segment.
+func SplitLogSegments(events []*Event, algorithms AlgorithmIdList) ([]*LogSegment, error) {
+	segments := splitLogSegments(events)
+
+	values := make(PCRValues)
+	for _, s := range segments {
+		if s.Reset {
+			values = make(PCRValues)
+		}
+		s.InitialPCRValues = values.Copy()
+		s.Startup = DetermineStartupSequence(s.Events)
+		if err := replayEventsFrom(values, s.Events, algorithms); err != nil {
+			return nil, err
+		}
+		s.ExpectedPCRValues = values.Copy()
+	}
+
+	return segments, nil
+}
+
+// BootSegments splits the events from the log in to the segments recorded by each boot (see SplitLogSegments).
+func (r *LogValidateResult) BootSegments() ([]*LogSegment, error) {
+	var events []*Event
+	for _, e := range r.ValidatedEvents {
+		events = append(events, e.Event)
+	}
+	return SplitLogSegments(events, r.Algorithms)
+}
@@ -0,0 +1,114 @@
+package tcglog
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestSplitLogSegments(t *testing.T) {
+	algs := AlgorithmIdList{AlgorithmSha256}
+	specId := func() *Event {
+		return &Event{PCRIndex: 0, EventType: EventTypeNoAction, data: &SpecIdEventData{}}
+	}
+	locality := func(l uint8) *Event {
+		return &Event{PCRIndex: 0, EventType: EventTypeNoAction, data: &startupLocalityEventData{Locality: l}}
+	}
+	measure := func(pcr PCRIndex, data string) *Event {
+		return &Event{PCRIndex: pcr, EventType: EventTypeEventTag,
+			Digests: NewEventDigests(DigestMap{AlgorithmSha256: AlgorithmSha256.hash([]byte(data))})}
+	}
+	extend := func(initial Digest, data ...string) Digest {
+		for _, d := range data {
+			initial = performHashExtendOperation(AlgorithmSha256, initial, AlgorithmSha256.hash([]byte(d)))
+		}
+		return initial
+	}
+	zero := make(Digest, 32)
+	locality3 := make(Digest, 32)
+	locality3[31] = 3
+
+	t.Run("SingleBoot", func(t *testing.T) {
+		// Some buggy firmware records more than one Spec ID event, or records one to a PCR other than 0.
+		pcr1SpecId := specId()
+		pcr1SpecId.PCRIndex = 1
+		events := []*Event{specId(), specId(), measure(0, "crtm"), pcr1SpecId, measure(4, "loader")}
+		segments, err := SplitLogSegments(events, algs)
+		if err != nil {
+			t.Fatalf("SplitLogSegments failed: %v", err)
+		}
+		if len(segments) != 1 {
+			t.Fatalf("Unexpected number of segments: %d", len(segments))
+		}
+		if !reflect.DeepEqual(segments[0].Events, events) || !segments[0].Reset {
+			t.Errorf("Unexpected segment")
+		}
+	})
+
+	t.Run("Kexec", func(t *testing.T) {
+		events := []*Event{specId(), measure(0, "crtm"), measure(8, "kernel1"), specId(), measure(8, "kernel2"),
+			measure(9, "initrd2")}
+		segments, err := SplitLogSegments(events, algs)
+		if err != nil {
+			t.Fatalf("SplitLogSegments failed: %v", err)
+		}
+		if len(segments) != 2 {
+			t.Fatalf("Unexpected number of segments: %d", len(segments))
+		}
+		s := segments[1]
+		if s.Start != LogSegmentStartSpecId || s.Reset || !reflect.DeepEqual(s.Events, events[3:]) {
+			t.Errorf("Unexpected second segment: %s %v", s.Start, s.Reset)
+		}
+		if !bytes.Equal(s.InitialPCRValues[8][AlgorithmSha256], extend(zero, "kernel1")) {
+			t.Errorf("Unexpected initial PCR 8 value: %x", s.InitialPCRValues[8][AlgorithmSha256])
+		}
+		if !bytes.Equal(s.ExpectedPCRValues[8][AlgorithmSha256], extend(zero, "kernel1", "kernel2")) {
+			t.Errorf("Unexpected PCR 8 value: %x", s.ExpectedPCRValues[8][AlgorithmSha256])
+		}
+		if !bytes.Equal(s.ExpectedPCRValues[0][AlgorithmSha256], extend(zero, "crtm")) {
+			t.Errorf("Unexpected PCR 0 value: %x", s.ExpectedPCRValues[0][AlgorithmSha256])
+		}
+	})
+
+	t.Run("Restart", func(t *testing.T) {
+		events := []*Event{specId(), measure(0, "crtm1"), measure(4, "loader1"), specId(), locality(3),
+			measure(0, "crtm2")}
+		segments, err := SplitLogSegments(events, algs)
+		if err != nil {
+			t.Fatalf("SplitLogSegments failed: %v", err)
+		}
+		if len(segments) != 2 {
+			t.Fatalf("Unexpected number of segments: %d", len(segments))
+		}
+		s := segments[1]
+		if s.Start != LogSegmentStartSpecId || !s.Reset || len(s.InitialPCRValues) != 0 {
+			t.Errorf("Unexpected second segment: %s %v", s.Start, s.Reset)
+		}
+		if s.Startup.Sequence != StartupSequenceLocality3 || len(s.Startup.Problems) > 0 {
+			t.Errorf("Unexpected startup sequence: %s %v", s.Startup.Sequence, s.Startup.Problems)
+		}
+		if !bytes.Equal(s.ExpectedPCRValues[0][AlgorithmSha256], extend(locality3, "crtm2")) {
+			t.Errorf("Unexpected PCR 0 value: %x", s.ExpectedPCRValues[0][AlgorithmSha256])
+		}
+		if _, ok := s.ExpectedPCRValues[4]; ok {
+			t.Errorf("PCR 4 should be in its reset state")
+		}
+	})
+
+	t.Run("LateStartupLocality", func(t *testing.T) {
+		events := []*Event{measure(0, "crtm1"), locality(0), measure(0, "crtm2")}
+		segments, err := SplitLogSegments(events, algs)
+		if err != nil {
+			t.Fatalf("SplitLogSegments failed: %v", err)
+		}
+		if len(segments) != 2 {
+			t.Fatalf("Unexpected number of segments: %d", len(segments))
+		}
+		if segments[1].Start != LogSegmentStartStartupLocality || !segments[1].Reset {
+			t.Errorf("Unexpected second segment: %s %v", segments[1].Start, segments[1].Reset)
+		}
+		if !bytes.Equal(segments[1].ExpectedPCRValues[0][AlgorithmSha256], extend(zero, "crtm2")) {
+			t.Errorf("Unexpected PCR 0 value: %x", segments[1].ExpectedPCRValues[0][AlgorithmSha256])
+		}
+	})
+}
@@ -0,0 +1,321 @@
+package tcglog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+)
+
+// PCRReader is implemented by types that can read PCR values from a TPM. This allows the TPM access to be supplied
+// by the caller so that this package doesn't depend on a particular TPM library.
+type PCRReader interface {
+	ReadPCRs(ctx context.Context, pcrs []PCRIndex, algorithms AlgorithmIdList) (PCRValues, error)
+}
+
+// SelfCheckOptions allows the behaviour of SelfCheck to be controlled.
+type SelfCheckOptions struct {
+	LogOptions
+	LogPath    string          // The path of the log to check. Defaults to the log for tpm0 from securityfs
+	PCRs       []PCRIndex      // The PCRs to check. Defaults to PCRs 0-7
+	Algorithms AlgorithmIdList // The digest algorithms to check. Defaults to all of the algorithms in the log
+	PCRReader  PCRReader       // Used to read PCR values from the TPM. If nil, the log isn't checked against the TPM
+
+	// StrictUTF16 enables reporting of variable and partition names that aren't well-formed UTF-16 (see
+	// CheckUTF16Strings).
+	StrictUTF16 bool
+
+	// LogIntegrityVerifiers are used to verify the log against digests of the log recorded by the platform (see
+	// LogIntegrityVerifier).
+	LogIntegrityVerifiers []LogIntegrityVerifier
+
+	// FinalEventsPath is the path of a copy of the final events table (EFI_TCG2_FINAL_EVENTS_TABLE). If supplied, its
+	// events are merged with the log (see ReplayAndValidateLogWithFinalEvents) and the PCR values computed with them
+	// are compared with the TPM.
+	FinalEventsPath string
+
+	// KernelMessages are TPM related messages from the kernel log (see ReadKernelTPMMessages). If supplied, they are
+	// correlated with the other findings (see CorrelateKernelTPMMessages).
+	KernelMessages []*KernelTPMMessage
+
+	// AuditDigests enables comparing each digest that isn't generated from the event data with the digests computed
+	// with the other supported algorithms, to detect digests that were recorded for the wrong algorithm (see
+	// AuditEventDigests).
+	AuditDigests bool
+}
+
+// HealthReport is the result of SelfCheck.
+type HealthReport struct {
+	Healthy      bool                 // Whether the log is consistent and there are no findings with SeverityError
+	Findings     []Finding            // Findings in descending order of severity
+	Result       *LogValidateResult   // The full result of replaying and validating the log
+	TPMPCRValues PCRValues            // The PCR values read from the TPM, if a PCRReader was supplied
+	LogIntegrity []LogIntegrityResult // The results of each of the supplied LogIntegrityVerifiers
+
+	// PCRTrust contains the trust classification of each of the checked PCRs, which indicates whether it is
+	// suitable for sealing against on this platform (see LogValidateResult.ClassifyPCRTrust).
+	PCRTrust []*PCRTrustClassification
+}
+
+// SelfCheck replays and validates the event log for this machine, optionally compares the result with the PCR values
+// read from the TPM, and returns a summary of everything that was found. This performs the same checks as the
+// tcglog-validate tool.
+func SelfCheck(ctx context.Context, opts SelfCheckOptions) (*HealthReport, error) {
+	logPath := opts.LogPath
+	if logPath == "" {
+		logPath = "/sys/kernel/security/tpm0/binary_bios_measurements"
+	}
+	pcrs := opts.PCRs
+	if len(pcrs) == 0 {
+		pcrs = []PCRIndex{0, 1, 2, 3, 4, 5, 6, 7}
+	}
+
+	result, err := ReplayAndValidateLogWithFinalEventsContext(ctx, logPath, opts.FinalEventsPath, opts.LogOptions)
+	if err != nil {
+		return nil, fmt.Errorf("cannot replay and validate log: %w", err)
+	}
+
+	algorithms := opts.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = result.Algorithms
+	}
+	for _, alg := range algorithms {
+		if !result.Algorithms.Contains(alg) {
+			return nil, fmt.Errorf("log doesn't contain entries for %s algorithm", alg)
+		}
+	}
+
+	report := &HealthReport{Result: result, Findings: FindingsFromResult(result, opts.StrictUTF16)}
+	if opts.AuditDigests {
+		report.Findings = append(report.Findings, DigestAuditFindings(result)...)
+	}
+
+	if opts.PCRReader != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		tpmPCRValues, err := opts.PCRReader.ReadPCRs(ctx, pcrs, algorithms)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read PCR values from TPM: %v", err)
+		}
+		report.TPMPCRValues = tpmPCRValues
+
+		expected := result.ExpectedPCRValues
+		if result.ExpectedPCRValuesWithFinalEvents != nil {
+			expected = result.ExpectedPCRValuesWithFinalEvents
+		}
+		for _, i := range pcrs {
+			for _, alg := range algorithms {
+				if bytes.Equal(expected[i][alg], tpmPCRValues[i][alg]) {
+					continue
+				}
+				report.Findings = append(report.Findings, Finding{
+					Severity: SeverityError,
+					Kind:     FindingKindPCRMismatch,
+					Description: fmt.Sprintf("log is not consistent with PCR %d, bank %s (actual PCR value: %x, "+
+						"expected PCR value from log: %x)", i, alg, tpmPCRValues[i][alg], expected[i][alg])})
+			}
+		}
+	}
+
+	report.PCRTrust = result.ClassifyPCRTrust(pcrs, report.TPMPCRValues)
+
+	if len(opts.LogIntegrityVerifiers) > 0 {
+		data, err := ioutil.ReadFile(logPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read log: %v", err)
+		}
+		report.LogIntegrity, err = VerifyLogIntegrity(ctx, data, opts.LogIntegrityVerifiers)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range report.LogIntegrity {
+			switch r.Status {
+			case LogIntegrityVerified:
+				report.Findings = append(report.Findings, Finding{
+					Severity:    SeverityInfo,
+					Kind:        FindingKindLogIntegrityVerified,
+					Description: fmt.Sprintf("log integrity verified with %s", r.Mechanism)})
+			case LogIntegrityMismatch:
+				report.Findings = append(report.Findings, Finding{
+					Severity:    SeverityError,
+					Kind:        FindingKindLogIntegrityMismatch,
+					Description: fmt.Sprintf("log integrity check with %s failed: %s", r.Mechanism, r.Description)})
+			}
+		}
+	}
+
+	report.Findings = append(report.Findings, CorrelateKernelTPMMessages(opts.KernelMessages, report.Findings)...)
+	sortFindings(report.Findings)
+
+	report.Healthy = true
+	for _, f := range report.Findings {
+		if f.Severity == SeverityError {
+			report.Healthy = false
+			break
+		}
+	}
+
+	return report, nil
+}
+
+// FindingsFromResult returns the findings for the supplied result of replaying and validating a log, in descending
+// order of severity. This is the subset of the checks performed by SelfCheck that don't require access to the TPM or
+// the raw log. If strictUTF16 is true, variable and partition names that aren't well-formed UTF-16 are reported.
+func FindingsFromResult(result *LogValidateResult, strictUTF16 bool) []Finding {
+	var findings []Finding
+
+	if result.Spec == SpecUnknown {
+		findings = append(findings, Finding{
+			Severity: SeverityWarning,
+			Kind:     FindingKindMissingSpecIdEvent,
+			Description: "log doesn't begin with a Spec ID event, so it was interpreted as a SHA-1 log in the " +
+				"TCG 1.2 format"})
+	}
+
+	if result.EfiBootVariableBehaviour == EFIBootVariableBehaviourVarDataOnly {
+		findings = append(findings, Finding{
+			Severity: SeverityInfo,
+			Kind:     FindingKindEFIBootVariableDataOnly,
+			Description: "EV_EFI_VARIABLE_BOOT events only contain measurement of variable data rather than the " +
+				"entire UEFI_VARIABLE_DATA structure"})
+	}
+
+	if result.Startup.Sequence != StartupSequenceLocality0 {
+		findings = append(findings, Finding{
+			Severity:    SeverityInfo,
+			Kind:        FindingKindNonStandardStartup,
+			Description: fmt.Sprintf("PCR 0 was initialized by a %s", result.Startup.Sequence)})
+	}
+	for _, p := range result.Startup.Problems {
+		findings = append(findings, Finding{
+			Severity:    SeverityWarning,
+			Kind:        FindingKindInconsistentStartup,
+			Description: p})
+	}
+
+	if ebs := result.ExitBootServices; ebs != nil {
+		if ebs.Outcome == ExitBootServicesFailed {
+			findings = append(findings, Finding{
+				Severity:    SeverityError,
+				Kind:        FindingKindExitBootServicesFailed,
+				Description: "the last call to ExitBootServices returned with failure",
+				Event:       ebs.Attempts[len(ebs.Attempts)-1].Return})
+		}
+		for _, p := range ebs.Problems {
+			findings = append(findings, Finding{
+				Severity:    SeverityWarning,
+				Kind:        FindingKindInconsistentExitBootServices,
+				Description: fmt.Sprintf("ExitBootServices events are inconsistent: %s", p)})
+		}
+	}
+
+	for _, e := range result.ValidatedEvents {
+		if i := CheckInternalLengths(e.Event); i != nil {
+			findings = append(findings, Finding{
+				Severity:    SeverityWarning,
+				Kind:        FindingKindInconsistentInternalLengths,
+				Description: fmt.Sprintf("inconsistent internal lengths: %s", i),
+				Event:       e.Event})
+		}
+		if e.Event.HasQuirk(EventQuirkUnexpectedSpecIdEvent) {
+			findings = append(findings, Finding{
+				Severity:    SeverityWarning,
+				Kind:        FindingKindUnexpectedSpecIdEvent,
+				Description: "Spec ID event is not the first event of the log in PCR 0",
+				Event:       e.Event})
+		}
+		if strictUTF16 {
+			for _, p := range CheckUTF16Strings(e.Event) {
+				findings = append(findings, Finding{
+					Severity:    SeverityWarning,
+					Kind:        FindingKindMalformedUTF16,
+					Description: fmt.Sprintf("malformed UTF-16 string: %s", p),
+					Event:       e.Event})
+			}
+		}
+		if e.HasTrailingMeasuredBytes() {
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Kind:     FindingKindTrailingMeasuredBytes,
+				Description: fmt.Sprintf("event data has %d trailing bytes that were hashed and measured: %x",
+					e.MeasuredTrailingBytesCount, e.TrailingBytes()),
+				Event: e.Event})
+		}
+		for _, v := range e.IncorrectDigestValues {
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Kind:     FindingKindIncorrectDigest,
+				Description: fmt.Sprintf("%s digest isn't generated from the event data (expected: %x, got: %x)",
+					v.Algorithm, v.Expected, e.Event.Digests.Get(v.Algorithm)),
+				Event: e.Event})
+		}
+	}
+
+	var separatorPCRs []PCRIndex
+	for i := range result.Separators {
+		separatorPCRs = append(separatorPCRs, i)
+	}
+	for _, i := range sortedPCRs(separatorPCRs) {
+		status := result.Separators[i]
+		switch {
+		case !status.Present():
+			if i < 8 {
+				findings = append(findings, Finding{
+					Severity:    SeverityError,
+					Kind:        FindingKindMissingSeparator,
+					Description: fmt.Sprintf("no EV_SEPARATOR event was measured to PCR %d", i)})
+			}
+		case status.Duplicated():
+			for _, e := range status.Events[1:] {
+				findings = append(findings, Finding{
+					Severity:    SeverityWarning,
+					Kind:        FindingKindDuplicateSeparator,
+					Description: fmt.Sprintf("duplicate EV_SEPARATOR event in PCR %d", i),
+					Event:       e})
+			}
+		}
+	}
+
+	var events []*Event
+	for _, e := range result.ValidatedEvents {
+		events = append(events, e.Event)
+	}
+	for _, s := range splitLogSegments(events)[1:] {
+		findings = append(findings, Finding{
+			Severity: SeverityWarning,
+			Kind:     FindingKindMultipleBootSegments,
+			Description: fmt.Sprintf("log contains measurements from another boot, starting with a %s, so it "+
+				"has to be replayed one segment at a time (see SplitLogSegments)", s.Start),
+			Event: s.Events[0]})
+	}
+	for _, e := range FindFirmwareErrors(events) {
+		findings = append(findings, Finding{
+			Severity:    SeverityError,
+			Kind:        FindingKindPlatformMeasurementError,
+			Description: fmt.Sprintf("platform reported a measurement error during boot: %s", e.Info),
+			Event:       e.Event})
+	}
+
+	for _, e := range DetectFirmwareUIEntry(events) {
+		findings = append(findings, Finding{
+			Severity: SeverityWarning,
+			Kind:     FindingKindFirmwareUIEntered,
+			Description: fmt.Sprintf("the user interacted with the firmware during boot (%s), which may change the "+
+				"values of PCRs 1, 4 and 7 from those of a normal boot", e.Kind),
+			Event: e.Event})
+	}
+
+	for _, e := range DetectCapsuleUpdates(events) {
+		findings = append(findings, Finding{
+			Severity: SeverityWarning,
+			Kind:     FindingKindFirmwareUpdateDuringBoot,
+			Description: fmt.Sprintf("a firmware update was processed during boot (%s), which adds measurements "+
+				"that won't be repeated on the next boot", e),
+			Event: e.Event})
+	}
+
+	sortFindings(findings)
+	return findings
+}
@@ -0,0 +1,134 @@
+package tcglog
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testPCRReader is a PCRReader that returns fixed values, and records what it was asked to read.
+type testPCRReader struct {
+	values PCRValues
+	err    error
+
+	pcrs       []PCRIndex
+	algorithms AlgorithmIdList
+}
+
+func (r *testPCRReader) ReadPCRs(ctx context.Context, pcrs []PCRIndex, algorithms AlgorithmIdList) (PCRValues, error) {
+	r.pcrs = pcrs
+	r.algorithms = algorithms
+	return r.values, r.err
+}
+
+func TestSelfCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+	var events []testLogEvent
+	for pcr := PCRIndex(0); pcr < 8; pcr++ {
+		events = append(events, makeTestLogEvent(pcr, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...))
+	}
+	logPath := filepath.Join(dir, "log")
+	if err := ioutil.WriteFile(logPath, makeTestLog_2(algs, events), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	expected := make(PCRValues)
+	for pcr := PCRIndex(0); pcr < 8; pcr++ {
+		expected[pcr] = DigestMap{}
+		for _, alg := range algs {
+			expected[pcr][alg] = performHashExtendOperation(alg, make(Digest, alg.size()), alg.hash([]byte{0, 0, 0, 0}))
+		}
+	}
+
+	t.Run("Consistent", func(t *testing.T) {
+		reader := &testPCRReader{values: expected}
+		report, err := SelfCheck(context.Background(), SelfCheckOptions{LogPath: logPath, PCRReader: reader})
+		if err != nil {
+			t.Fatalf("SelfCheck failed: %v", err)
+		}
+		if !reflect.DeepEqual(reader.pcrs, []PCRIndex{0, 1, 2, 3, 4, 5, 6, 7}) {
+			t.Errorf("Unexpected PCRs read: %v", reader.pcrs)
+		}
+		if !reflect.DeepEqual(reader.algorithms, AlgorithmIdList(algs)) {
+			t.Errorf("Unexpected algorithms read: %v", reader.algorithms)
+		}
+		if !report.Healthy {
+			t.Errorf("Unexpected unhealthy report: %v", report.Findings)
+		}
+		if !reflect.DeepEqual(report.TPMPCRValues, expected) {
+			t.Errorf("Unexpected TPM PCR values")
+		}
+		if len(report.PCRTrust) != 8 {
+			t.Errorf("Unexpected number of PCR trust classifications: %d", len(report.PCRTrust))
+		}
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		values := expected.Copy()
+		values[4][AlgorithmSha256] = make(Digest, AlgorithmSha256.size())
+		reader := &testPCRReader{values: values}
+		report, err := SelfCheck(context.Background(), SelfCheckOptions{LogPath: logPath, PCRs: []PCRIndex{4, 7},
+			Algorithms: AlgorithmIdList{AlgorithmSha256}, PCRReader: reader})
+		if err != nil {
+			t.Fatalf("SelfCheck failed: %v", err)
+		}
+		if !reflect.DeepEqual(reader.pcrs, []PCRIndex{4, 7}) {
+			t.Errorf("Unexpected PCRs read: %v", reader.pcrs)
+		}
+		if report.Healthy {
+			t.Errorf("Unexpected healthy report")
+		}
+		var mismatches []Finding
+		for _, f := range report.Findings {
+			if f.Kind == FindingKindPCRMismatch {
+				mismatches = append(mismatches, f)
+			}
+		}
+		if len(mismatches) != 1 || mismatches[0].Severity != SeverityError {
+			t.Fatalf("Unexpected PCR mismatch findings: %v", mismatches)
+		}
+		if report.Findings[0].Kind != FindingKindPCRMismatch {
+			t.Errorf("Findings aren't sorted by severity: %v", report.Findings)
+		}
+	})
+
+	t.Run("NoPCRReader", func(t *testing.T) {
+		report, err := SelfCheck(context.Background(), SelfCheckOptions{LogPath: logPath})
+		if err != nil {
+			t.Fatalf("SelfCheck failed: %v", err)
+		}
+		if !report.Healthy || report.TPMPCRValues != nil {
+			t.Errorf("Unexpected report: %v", report.Findings)
+		}
+	})
+
+	t.Run("ReadError", func(t *testing.T) {
+		reader := &testPCRReader{err: errors.New("no TPM")}
+		_, err := SelfCheck(context.Background(), SelfCheckOptions{LogPath: logPath, PCRReader: reader})
+		if err == nil || err.Error() != "cannot read PCR values from TPM: no TPM" {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("UnknownAlgorithm", func(t *testing.T) {
+		reader := &testPCRReader{values: expected}
+		_, err := SelfCheck(context.Background(), SelfCheckOptions{LogPath: logPath,
+			Algorithms: AlgorithmIdList{AlgorithmSha384}, PCRReader: reader})
+		if err == nil {
+			t.Errorf("SelfCheck should have failed")
+		}
+		if reader.pcrs != nil {
+			t.Errorf("PCRs shouldn't have been read")
+		}
+	})
+}
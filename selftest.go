@@ -0,0 +1,217 @@
+package tcglog
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+)
+
+// SelfTestResult is the result of a single known-answer test run by SelfTest.
+type SelfTestResult struct {
+	Name string
+	Err  error // The reason that the test failed, or nil if it passed
+}
+
+// Passed indicates whether the test passed.
+func (r SelfTestResult) Passed() bool {
+	return r.Err == nil
+}
+
+// selfTestHashVectors are the digests of "abc" for each supported algorithm.
+//
+// https://csrc.nist.gov/CSRC/media/Projects/Cryptographic-Standards-and-Guidelines/documents/examples/SHA_All.pdf
+var selfTestHashVectors = []struct {
+	alg    AlgorithmId
+	digest string
+}{
+	{AlgorithmSha1, "a9993e364706816aba3e25717850c26c9cd0d89d"},
+	{AlgorithmSha256, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	{AlgorithmSha384, "cb00753f45a35e8bb5a03d699ac65007272c32ab0eded1631a8b605a43ff5bed8086072ba1e7cc2358baeca134c825a7"},
+	{AlgorithmSha512, "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"},
+}
+
+// selfTestLog is a crypto-agile log with SHA-1 and SHA-256 digests, containing an S-CRTM version, the SecureBoot
+// variable, an EFI action, a separator for each of PCRs 0-7 and the load of an EFI application from an NVMe drive.
+const selfTestLog = "" +
+	"000000000300000000000000000000000000000000000000000000002500000053706563204944204576656e743033000000000000020002" +
+	"02000000040014000b002000000000000008000000020000000400e91fe173f59b063d620a934ce1a010f2b114c1f30b00e79e418e486235" +
+	"69d75e2a7b09ae88ed9b77b126a445b9ff9dc6989a08efa0790200000031000700000001000080020000000400d4fdd1f14d4041494deb8f" +
+	"c990c45343d2277d080b00ccfc4bb32888a345bc8aeadaba552b627d99348c767681ab3141f5b01e40a40e3500000061dfe48bca93d211aa" +
+	"0d00e098032b8c0a00000000000000010000000000000053006500630075007200650042006f006f00740001040000000700008002000000" +
+	"0400cd0fdb4531a6ec41be2753ba042637d6e5f7f2560b003d6772b4f84ed47595d72a2c4c5ffd15f5bb72c7507fe26f2aaee2c69d5633ba" +
+	"2800000043616c6c696e6720454649204170706c69636174696f6e2066726f6d20426f6f74204f7074696f6e000000000400000002000000" +
+	"04009069ca78e7450a285173431b3e52c5c25299e4730b00df3f619804a92fdb4057192dc43dd748ea778adc52bc498ce80524c014b81119" +
+	"040000000000000001000000040000000200000004009069ca78e7450a285173431b3e52c5c25299e4730b00df3f619804a92fdb4057192d" +
+	"c43dd748ea778adc52bc498ce80524c014b81119040000000000000002000000040000000200000004009069ca78e7450a285173431b3e52" +
+	"c5c25299e4730b00df3f619804a92fdb4057192dc43dd748ea778adc52bc498ce80524c014b8111904000000000000000300000004000000" +
+	"0200000004009069ca78e7450a285173431b3e52c5c25299e4730b00df3f619804a92fdb4057192dc43dd748ea778adc52bc498ce80524c0" +
+	"14b81119040000000000000004000000040000000200000004009069ca78e7450a285173431b3e52c5c25299e4730b00df3f619804a92fdb" +
+	"4057192dc43dd748ea778adc52bc498ce80524c014b81119040000000000000005000000040000000200000004009069ca78e7450a285173" +
+	"431b3e52c5c25299e4730b00df3f619804a92fdb4057192dc43dd748ea778adc52bc498ce80524c014b81119040000000000000006000000" +
+	"040000000200000004009069ca78e7450a285173431b3e52c5c25299e4730b00df3f619804a92fdb4057192dc43dd748ea778adc52bc498c" +
+	"e80524c014b81119040000000000000007000000040000000200000004009069ca78e7450a285173431b3e52c5c25299e4730b00df3f6198" +
+	"04a92fdb4057192dc43dd748ea778adc52bc498ce80524c014b8111904000000000000000400000003000080020000000400035e6cfd1c04" +
+	"f032c36e2ce14a3782f171ec41810b00caaff3a76e5a79b24b50185093b2342c07da06378ed768b993264c58404f77a9a400000018b0e66c" +
+	"0000000040c40d00000000000000000000000000840000000000000002010c00d041030a0000000001010600001d03171000010000000807" +
+	"06050403020104012a0001000000000800000000000000001000000000007b94de66b2fd2545b75230d66bb2b9600202040434005c004500" +
+	"460049005c007500620075006e00740075005c007300680069006d007800360034002e0065006600690000007fff0400"
+
+var selfTestLogEvents = []struct {
+	pcr       PCRIndex
+	eventType EventType
+	data      string
+}{
+	{0, EventTypeNoAction, ""},
+	{0, EventTypeSCRTMVersion, ""},
+	{7, EventTypeEFIVariableDriverConfig, "UEFI_VARIABLE_DATA{ VariableName: EFI_GLOBAL_VARIABLE, " +
+		"UnicodeName: \"SecureBoot\", VariableDataLength: 1 }"},
+	{4, EventTypeEFIAction, "Calling EFI Application from Boot Option"},
+	{0, EventTypeSeparator, ""},
+	{1, EventTypeSeparator, ""},
+	{2, EventTypeSeparator, ""},
+	{3, EventTypeSeparator, ""},
+	{4, EventTypeSeparator, ""},
+	{5, EventTypeSeparator, ""},
+	{6, EventTypeSeparator, ""},
+	{7, EventTypeSeparator, ""},
+	{4, EventTypeEFIBootServicesApplication, "UEFI_IMAGE_LOAD_EVENT{ ImageLocationInMemory: 0x000000006ce6b018, " +
+		"ImageLengthInMemory: 902208, ImageLinkTimeAddress: 0x0000000000000000, DevicePath: " + selfTestDevicePath + " }"},
+}
+
+// selfTestLogPCRValues are the PCR values produced by replaying selfTestLog.
+var selfTestLogPCRValues = map[PCRIndex][2]string{
+	0: {"a5af180c593821e16c80615e59ac85cb9dd83585",
+		"4287d55d4c633d79c1641e064d6500bed9e439d87421290a3e33679d2a3d3f49"},
+	1: {"b2a83b0ebf2f8374299a5b2bdfc31ea955ad7236",
+		"3d458cfe55cc03ea1f443f1562beec8df51c75e14a9fcf9a7234a13f198e7969"},
+	2: {"b2a83b0ebf2f8374299a5b2bdfc31ea955ad7236",
+		"3d458cfe55cc03ea1f443f1562beec8df51c75e14a9fcf9a7234a13f198e7969"},
+	3: {"b2a83b0ebf2f8374299a5b2bdfc31ea955ad7236",
+		"3d458cfe55cc03ea1f443f1562beec8df51c75e14a9fcf9a7234a13f198e7969"},
+	4: {"01efcb2304c8e08349270346bc330846ca5652b7",
+		"f793dd3e0fd27888711613da26121fde76378e2cdc1b447d2cccc67d04174e0e"},
+	5: {"b2a83b0ebf2f8374299a5b2bdfc31ea955ad7236",
+		"3d458cfe55cc03ea1f443f1562beec8df51c75e14a9fcf9a7234a13f198e7969"},
+	6: {"b2a83b0ebf2f8374299a5b2bdfc31ea955ad7236",
+		"3d458cfe55cc03ea1f443f1562beec8df51c75e14a9fcf9a7234a13f198e7969"},
+	7: {"3a73fc9d29ebdbc866f1ad32f75fbafc0cc48807",
+		"3a765fab0c4555e805964d8c75231894f45c5a6f2161738cf157015250a3e624"},
+}
+
+// selfTestDevicePath is the text of the device path in the last event of selfTestLog.
+const selfTestDevicePath = "PciRoot(0x0)/Pci(0x1D,0x0)/NVMe(0x1,01-02-03-04-05-06-07-08)/" +
+	"HD(1,GPT,66DE947B-FDB2-4525-B752-30D66BB2B960,0x800,0x100000)/\\EFI\\ubuntu\\shimx64.efi"
+
+func selfTestHashes() error {
+	for _, v := range selfTestHashVectors {
+		expected, _ := hex.DecodeString(v.digest)
+		if !v.alg.supported() {
+			return fmt.Errorf("%s is not supported", v.alg)
+		}
+		if d := v.alg.hash([]byte("abc")); !bytes.Equal(d, expected) {
+			return fmt.Errorf("unexpected %s digest: %x", v.alg, d)
+		}
+	}
+	return nil
+}
+
+func selfTestReadLog() (*LogValidateResult, error) {
+	data, err := hex.DecodeString(selfTestLog)
+	if err != nil {
+		return nil, err
+	}
+	log, err := NewLog(bytes.NewReader(data), LogOptions{})
+	if err != nil {
+		return nil, err
+	}
+	v := &logValidator{log: log, expectedPCRValues: make(PCRValues)}
+	return v.run(context.Background())
+}
+
+func selfTestDecodeLog(result *LogValidateResult) error {
+	if result.Spec != SpecEFI_2 {
+		return fmt.Errorf("unexpected spec: %v", result.Spec)
+	}
+	if len(result.ValidatedEvents) != len(selfTestLogEvents) {
+		return fmt.Errorf("unexpected number of events: %d", len(result.ValidatedEvents))
+	}
+	for i, expected := range selfTestLogEvents {
+		event := result.ValidatedEvents[i].Event
+		if event.PCRIndex != expected.pcr || event.EventType != expected.eventType {
+			return fmt.Errorf("unexpected event %d: PCR %d, type %s", i, event.PCRIndex, event.EventType)
+		}
+		if expected.data != "" && event.Data().String() != expected.data {
+			return fmt.Errorf("unexpected data for event %d: %s", i, event.Data())
+		}
+	}
+	return nil
+}
+
+func selfTestEventDigests(result *LogValidateResult) error {
+	for i, e := range result.ValidatedEvents {
+		if len(e.IncorrectDigestValues) > 0 {
+			return fmt.Errorf("event %d has an incorrect %s digest", i, e.IncorrectDigestValues[0].Algorithm)
+		}
+	}
+	return nil
+}
+
+func selfTestReplay(result *LogValidateResult) error {
+	if len(result.ExpectedPCRValues) != len(selfTestLogPCRValues) {
+		return fmt.Errorf("unexpected number of PCRs: %d", len(result.ExpectedPCRValues))
+	}
+	for pcr, values := range selfTestLogPCRValues {
+		for i, alg := range []AlgorithmId{AlgorithmSha1, AlgorithmSha256} {
+			expected, _ := hex.DecodeString(values[i])
+			if !bytes.Equal(result.ExpectedPCRValues[pcr][alg], expected) {
+				return fmt.Errorf("unexpected value for PCR %d, bank %s: %x", pcr, alg, result.ExpectedPCRValues[pcr][alg])
+			}
+		}
+	}
+	return nil
+}
+
+func selfTestDevicePaths(result *LogValidateResult) error {
+	d, ok := result.ValidatedEvents[len(result.ValidatedEvents)-1].Event.Data().(*efiImageLoadEventData)
+	if !ok {
+		return fmt.Errorf("unexpected image load event data type")
+	}
+	if s := d.path.String(); s != selfTestDevicePath {
+		return fmt.Errorf("unexpected device path: %s", s)
+	}
+	path, err := ParseEFIDevicePath(selfTestDevicePath)
+	if err != nil {
+		return err
+	}
+	if !path.Equal(d.path) {
+		return fmt.Errorf("device path didn't round trip: %s", path)
+	}
+	return nil
+}
+
+// SelfTest runs this package against embedded known-answer vectors: digests of a known input for each supported
+// algorithm, and the decoded events, event digests, device paths and replayed PCR values of a reference log. It is
+// intended to detect a miscompiled or modified build before it is relied on to verify logs. All of the tests are run,
+// and the result of each is returned.
+func SelfTest() []SelfTestResult {
+	results := []SelfTestResult{{Name: "hash", Err: selfTestHashes()}}
+
+	result, err := selfTestReadLog()
+	if err == nil {
+		err = selfTestDecodeLog(result)
+	}
+	results = append(results, SelfTestResult{Name: "log-decode", Err: err})
+	if err != nil {
+		// The remaining tests depend on the log being decoded correctly.
+		for _, name := range []string{"event-digests", "replay", "device-path"} {
+			results = append(results, SelfTestResult{Name: name, Err: fmt.Errorf("skipped: %v", err)})
+		}
+		return results
+	}
+
+	return append(results,
+		SelfTestResult{Name: "event-digests", Err: selfTestEventDigests(result)},
+		SelfTestResult{Name: "replay", Err: selfTestReplay(result)},
+		SelfTestResult{Name: "device-path", Err: selfTestDevicePaths(result)})
+}
@@ -0,0 +1,39 @@
+package tcglog
+
+import (
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	results := SelfTest()
+	if len(results) != 5 {
+		t.Errorf("Unexpected number of results: %d", len(results))
+	}
+	for _, r := range results {
+		if !r.Passed() {
+			t.Errorf("Self test %s failed: %v", r.Name, r.Err)
+		}
+	}
+}
+
+func TestSelfTestDetectsIncorrectResults(t *testing.T) {
+	result, err := selfTestReadLog()
+	if err != nil {
+		t.Fatalf("selfTestReadLog failed: %v", err)
+	}
+
+	result.ExpectedPCRValues[4][AlgorithmSha256] = make(Digest, AlgorithmSha256.size())
+	if err := selfTestReplay(result); err == nil {
+		t.Errorf("selfTestReplay should have failed")
+	}
+
+	result.ValidatedEvents[3].Event.EventType = EventTypeAction
+	if err := selfTestDecodeLog(result); err == nil {
+		t.Errorf("selfTestDecodeLog should have failed")
+	}
+
+	result.ValidatedEvents[1].IncorrectDigestValues = []IncorrectDigestValue{{Algorithm: AlgorithmSha1}}
+	if err := selfTestEventDigests(result); err == nil {
+		t.Errorf("selfTestEventDigests should have failed")
+	}
+}
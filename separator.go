@@ -0,0 +1,65 @@
+package tcglog
+
+// SeparatorStatus describes the EV_SEPARATOR events measured to a PCR. Platform firmware is expected to measure exactly
+// one EV_SEPARATOR event to each of PCRs 0-7 before transferring control to the OS loader. If a pre-OS error occurs,
+// the firmware measures the error value (0x00000001) instead, and the event data may contain information about the
+// error rather than the value that was measured.
+type SeparatorStatus struct {
+	Events  []*Event // The EV_SEPARATOR events measured to this PCR, in the order in which they appear in the log
+	IsError bool     // Whether any of the EV_SEPARATOR events signal a pre-OS error
+}
+
+// Present indicates whether an EV_SEPARATOR event was measured to this PCR.
+func (s *SeparatorStatus) Present() bool {
+	return len(s.Events) > 0
+}
+
+// Duplicated indicates whether more than one EV_SEPARATOR event was measured to this PCR.
+func (s *SeparatorStatus) Duplicated() bool {
+	return len(s.Events) > 1
+}
+
+// ErrorInfo returns the event data of the first EV_SEPARATOR event in this PCR that signals a pre-OS error, or nil if
+// there isn't one.
+func (s *SeparatorStatus) ErrorInfo() []byte {
+	for _, e := range s.Events {
+		if isSeparatorErrorEvent(e) {
+			return e.Data().Bytes()
+		}
+	}
+	return nil
+}
+
+func isSeparatorErrorEvent(e *Event) bool {
+	d, ok := e.Data().(*separatorEventData)
+	return ok && d.isError
+}
+
+// CheckSeparators returns the status of the EV_SEPARATOR events in each PCR. The result always contains entries for
+// PCRs 0-7, and also contains entries for any other PCR that has EV_SEPARATOR events measured to it.
+//
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+//  (section 3.3.4 "PCR Usage")
+func CheckSeparators(events []*Event) map[PCRIndex]*SeparatorStatus {
+	out := make(map[PCRIndex]*SeparatorStatus)
+	for i := PCRIndex(0); i < 8; i++ {
+		out[i] = &SeparatorStatus{}
+	}
+
+	for _, e := range events {
+		if e.EventType != EventTypeSeparator {
+			continue
+		}
+		s, ok := out[e.PCRIndex]
+		if !ok {
+			s = &SeparatorStatus{}
+			out[e.PCRIndex] = s
+		}
+		s.Events = append(s.Events, e)
+		if isSeparatorErrorEvent(e) {
+			s.IsError = true
+		}
+	}
+
+	return out
+}
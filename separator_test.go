@@ -0,0 +1,34 @@
+package tcglog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCheckSeparators(t *testing.T) {
+	var events []*Event
+	for i := PCRIndex(0); i < 7; i++ {
+		events = append(events, &Event{PCRIndex: i, EventType: EventTypeSeparator,
+			data: &separatorEventData{data: []byte{0, 0, 0, 0}}})
+	}
+	events = append(events,
+		&Event{PCRIndex: 1, EventType: EventTypeSeparator, data: &separatorEventData{data: []byte{0, 0, 0, 0}}},
+		&Event{PCRIndex: 4, EventType: EventTypeSeparator, data: &separatorEventData{data: []byte("error info"), isError: true}})
+
+	status := CheckSeparators(events)
+	if len(status) != 8 {
+		t.Fatalf("Unexpected number of entries: %d", len(status))
+	}
+	if !status[0].Present() || status[0].Duplicated() || status[0].IsError {
+		t.Errorf("Unexpected status for PCR 0: %+v", status[0])
+	}
+	if !status[1].Duplicated() {
+		t.Errorf("Expected a duplicate separator in PCR 1")
+	}
+	if !status[4].IsError || !bytes.Equal(status[4].ErrorInfo(), []byte("error info")) {
+		t.Errorf("Unexpected error status for PCR 4: %+v", status[4])
+	}
+	if status[7].Present() {
+		t.Errorf("Expected no separator in PCR 7")
+	}
+}
@@ -0,0 +1,122 @@
+package tcglog
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+var shimLockGUID = *NewEFIGUID(0x605dab50, 0xe046, 0x4300, 0xabb6, [...]uint8{0x3d, 0xd8, 0x10, 0xdd, 0x8b, 0x23})
+
+// efiVariableEventDataProvider is implemented by EFIVariableEventData and the types that embed it.
+type efiVariableEventDataProvider interface {
+	variableEventData() *EFIVariableEventData
+}
+
+func (e *EFIVariableEventData) variableEventData() *EFIVariableEventData {
+	return e
+}
+
+// SbatEntry corresponds to a single entry in a SBAT CSV document.
+type SbatEntry struct {
+	Component  string
+	Generation string
+	Extra      []string // Any additional fields, such as the date in a SbatLevel entry
+}
+
+// ShimSbatLevelEventData is the event data for the EV_EFI_VARIABLE_AUTHORITY event with which shim measures the
+// SbatLevel variable.
+type ShimSbatLevelEventData struct {
+	*EFIVariableEventData
+	Entries []SbatEntry
+}
+
+func (e *ShimSbatLevelEventData) String() string {
+	var entries []string
+	for _, s := range e.Entries {
+		entries = append(entries, fmt.Sprintf("%s,%s", s.Component, s.Generation))
+	}
+	return fmt.Sprintf("UEFI_VARIABLE_DATA{ VariableName: %s, UnicodeName: \"%s\", SbatLevel: [%s] }",
+		&e.VariableName, e.UnicodeName, strings.Join(entries, "; "))
+}
+
+// ShimMokListEventData is the event data for the EV_EFI_VARIABLE_AUTHORITY events with which shim measures the
+// MokList and MokListX variables.
+type ShimMokListEventData struct {
+	*EFIVariableEventData
+	SignatureLists []*EFISignatureList
+}
+
+func (e *ShimMokListEventData) String() string {
+	n := 0
+	for _, l := range e.SignatureLists {
+		n += len(l.Signatures)
+	}
+	return fmt.Sprintf("UEFI_VARIABLE_DATA{ VariableName: %s, UnicodeName: \"%s\", Entries: %d }",
+		&e.VariableName, e.UnicodeName, n)
+}
+
+// ShimMokSBStateEventData is the event data for the EV_EFI_VARIABLE_AUTHORITY event with which shim measures the
+// MokSBState variable.
+type ShimMokSBStateEventData struct {
+	*EFIVariableEventData
+	State uint8
+}
+
+// ValidationDisabled indicates whether the user has disabled shim's image validation with mokutil.
+func (e *ShimMokSBStateEventData) ValidationDisabled() bool {
+	return e.State == 1
+}
+
+func (e *ShimMokSBStateEventData) String() string {
+	return fmt.Sprintf("UEFI_VARIABLE_DATA{ VariableName: %s, UnicodeName: \"%s\", MokSBState: %d }",
+		&e.VariableName, e.UnicodeName, e.State)
+}
+
+// decodeSbat decodes a SBAT CSV document.
+//
+// https://github.com/rhboot/shim/blob/main/SBAT.md
+func decodeSbat(data []byte) []SbatEntry {
+	var out []SbatEntry
+	for _, line := range strings.Split(string(bytes.TrimRight(data, "\x00")), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		entry := SbatEntry{Component: fields[0]}
+		if len(fields) > 1 {
+			entry.Generation = fields[1]
+		}
+		if len(fields) > 2 {
+			entry.Extra = fields[2:]
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// decodeShimVariableEventData returns typed event data for the variables that shim measures with the SHIM_LOCK GUID,
+// or nil if the variable isn't recognized or its payload can't be decoded.
+func decodeShimVariableEventData(d *EFIVariableEventData) EventData {
+	if d.VariableName != shimLockGUID {
+		return nil
+	}
+
+	switch d.UnicodeName {
+	case "SbatLevel":
+		return &ShimSbatLevelEventData{EFIVariableEventData: d, Entries: decodeSbat(d.VariableData)}
+	case "MokList", "MokListX":
+		lists, err := decodeEFISignatureDatabase(d.VariableData, d.limits)
+		if err != nil {
+			return nil
+		}
+		return &ShimMokListEventData{EFIVariableEventData: d, SignatureLists: lists}
+	case "MokSBState":
+		if len(d.VariableData) != 1 {
+			return nil
+		}
+		return &ShimMokSBStateEventData{EFIVariableEventData: d, State: d.VariableData[0]}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func makeTestEFIVariableEventData(guid EFIGUID, name string, data []byte) []byte {
+	var buf bytes.Buffer
+	e := &EFIVariableEventData{VariableName: guid, UnicodeName: name, VariableData: data}
+	e.EncodeMeasuredBytes(&buf)
+	return buf.Bytes()
+}
+
+func TestDecodeShimVariableEventData(t *testing.T) {
+	t.Run("SbatLevel", func(t *testing.T) {
+		data := makeTestEFIVariableEventData(shimLockGUID, "SbatLevel", []byte("sbat,1,2021030218\nshim,2\n\x00"))
+		d, _, err := decodeEventDataEFIVariable(data, EventTypeEFIVariableAuthority, decodeLimits{})
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		sbat, ok := d.(*ShimSbatLevelEventData)
+		if !ok {
+			t.Fatalf("Unexpected event data type: %T", d)
+		}
+		if len(sbat.Entries) != 2 || sbat.Entries[0].Component != "sbat" || sbat.Entries[0].Generation != "1" ||
+			len(sbat.Entries[0].Extra) != 1 || sbat.Entries[1].Component != "shim" || sbat.Entries[1].Generation != "2" {
+			t.Errorf("Unexpected entries: %+v", sbat.Entries)
+		}
+		if !bytes.Equal(sbat.Bytes(), data) {
+			t.Errorf("Unexpected event data bytes")
+		}
+	})
+
+	t.Run("MokList", func(t *testing.T) {
+		cert := makeTestCertificate(t, "Test MOK")
+		data := makeTestEFIVariableEventData(shimLockGUID, "MokList", makeTestSignatureList(efiCertX509GUID, shimLockGUID, cert))
+		d, _, err := decodeEventDataEFIVariable(data, EventTypeEFIVariableAuthority, decodeLimits{})
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		mok, ok := d.(*ShimMokListEventData)
+		if !ok {
+			t.Fatalf("Unexpected event data type: %T", d)
+		}
+		if len(mok.SignatureLists) != 1 || len(mok.SignatureLists[0].Signatures) != 1 ||
+			!bytes.Equal(mok.SignatureLists[0].Signatures[0].Data, cert) {
+			t.Errorf("Unexpected signature lists: %v", mok.SignatureLists)
+		}
+	})
+
+	t.Run("MokSBState", func(t *testing.T) {
+		data := makeTestEFIVariableEventData(shimLockGUID, "MokSBState", []byte{1})
+		d, _, err := decodeEventDataEFIVariable(data, EventTypeEFIVariableAuthority, decodeLimits{})
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		state, ok := d.(*ShimMokSBStateEventData)
+		if !ok {
+			t.Fatalf("Unexpected event data type: %T", d)
+		}
+		if !state.ValidationDisabled() {
+			t.Errorf("Expected validation to be disabled")
+		}
+	})
+
+	t.Run("MeasuredBytes", func(t *testing.T) {
+		data := makeTestEFIVariableEventData(shimLockGUID, "MokSBState", []byte{0})
+		d, _, _ := decodeEventDataEFIVariable(data, EventTypeEFIVariableAuthority, decodeLimits{})
+		measured, _ := determineMeasuredBytes(&Event{EventType: EventTypeEFIVariableAuthority, data: d}, false)
+		if !bytes.Equal(measured, data) {
+			t.Errorf("Unexpected measured bytes: %x", measured)
+		}
+	})
+
+	t.Run("Other", func(t *testing.T) {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, shimLockGUID)
+		data := makeTestEFIVariableEventData(efiImageSecurityDatabaseGUID, "db", buf.Bytes())
+		d, _, _ := decodeEventDataEFIVariable(data, EventTypeEFIVariableAuthority, decodeLimits{})
+		if _, ok := d.(*EFIVariableEventData); !ok {
+			t.Errorf("Unexpected event data type: %T", d)
+		}
+	})
+}
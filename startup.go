@@ -0,0 +1,171 @@
+package tcglog
+
+import (
+	"fmt"
+)
+
+// StartupSequence describes how the TPM was started and PCR 0 initialized, as indicated by the log.
+type StartupSequence int
+
+const (
+	// StartupSequenceLocality0 indicates that TPM2_Startup was issued from locality 0, either because there is no
+	// StartupLocality event or because it indicates locality 0. PCR 0 is initialized to all zeroes.
+	StartupSequenceLocality0 StartupSequence = iota
+
+	// StartupSequenceLocality3 indicates that TPM2_Startup was issued from locality 3. PCR 0 is initialized with
+	// its last byte set to 3.
+	StartupSequenceLocality3
+
+	// StartupSequenceHCRTM indicates that a H-CRTM sequence was performed from locality 4 before TPM2_Startup.
+	// PCR 0 is initialized with its last byte set to 4, and is then extended with the H-CRTM measurement, which is
+	// recorded in the log as an EV_EFI_HCRTM_EVENT.
+	StartupSequenceHCRTM
+)
+
+func (s StartupSequence) String() string {
+	switch s {
+	case StartupSequenceLocality0:
+		return "TPM2_Startup from locality 0"
+	case StartupSequenceLocality3:
+		return "TPM2_Startup from locality 3"
+	case StartupSequenceHCRTM:
+		return "H-CRTM sequence from locality 4"
+	default:
+		return fmt.Sprintf("StartupSequence(%d)", int(s))
+	}
+}
+
+// StartupInfo describes the startup sequence indicated by a log, and any inconsistencies in the way that it was
+// recorded.
+type StartupInfo struct {
+	Sequence      StartupSequence
+	Locality      uint8    // The locality from which PCR 0 was initialized
+	LocalityEvent *Event   // The StartupLocality EV_NO_ACTION event, if present
+	HCRTMEvents   []*Event // The EV_EFI_HCRTM_EVENT events
+	Problems      []string // Inconsistencies between the StartupLocality event and the other events in the log
+}
+
+func startupLocality(e *Event) (uint8, bool) {
+	if e.PCRIndex != 0 || e.EventType != EventTypeNoAction {
+		return 0, false
+	}
+	d, ok := e.Data().(*startupLocalityEventData)
+	if !ok {
+		return 0, false
+	}
+	return d.Locality, true
+}
+
+// initialPCRValue returns the initial value of a PCR after the TPM is started from the specified locality. Only PCR 0
+// is affected by the startup locality.
+//
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+//  (section 3.3.4.1 "PCR[0] - SRTM, BIOS, Host Platform Extensions, Embedded Option ROMs and PI Drivers")
+func initialPCRValue(alg AlgorithmId, pcr PCRIndex, locality uint8) Digest {
+	out := make(Digest, alg.size())
+	if pcr == 0 {
+		out[len(out)-1] = locality
+	}
+	return out
+}
+
+// pcr0Startup tracks the events that determine the initial value of PCR 0 during a replay. The TPM initializes PCR 0
+// according to the locality from which TPM2_Startup is issued, or for locality 4 if a H-CRTM sequence is performed
+// before TPM2_Startup. As the H-CRTM sequence happens first, some firmware records the StartupLocality event after
+// the EV_EFI_HCRTM_EVENT events, and some omits the StartupLocality event altogether.
+type pcr0Startup struct {
+	localitySeen bool     // Whether a StartupLocality event has been applied
+	measured     bool     // Whether PCR 0 has been extended by an event other than an EV_EFI_HCRTM_EVENT
+	hcrtmEvents  []*Event // The EV_EFI_HCRTM_EVENT events that extended PCR 0 before any other event
+}
+
+// process updates the state with the supplied event. If the event changes the initial value of PCR 0, it returns
+// true along with the locality to initialize PCR 0 for. In this case, the caller must reinitialize PCR 0 and then
+// extend it again with the returned events, which were recorded earlier, before applying e.
+func (s *pcr0Startup) process(e *Event) (locality uint8, replay []*Event, reinitialize bool) {
+	if e.PCRIndex != 0 {
+		return 0, nil, false
+	}
+	if l, ok := startupLocality(e); ok {
+		if s.localitySeen || s.measured {
+			// Only the first StartupLocality event before the first measurement is used (see
+			// DetermineStartupSequence).
+			return 0, nil, false
+		}
+		s.localitySeen = true
+		return l, s.hcrtmEvents, true
+	}
+	if !doesEventTypeExtendPCR(e.EventType) {
+		return 0, nil, false
+	}
+	if e.EventType != EventTypeEFIHCRTMEvent || s.measured {
+		s.measured = true
+		return 0, nil, false
+	}
+
+	first := len(s.hcrtmEvents) == 0
+	s.hcrtmEvents = append(s.hcrtmEvents, e)
+	if first && !s.localitySeen {
+		// The H-CRTM sequence initializes PCR 0 for locality 4, even if there is no StartupLocality event.
+		return 4, nil, true
+	}
+	return 0, nil, false
+}
+
+// DetermineStartupSequence determines the startup sequence from the StartupLocality and EV_EFI_HCRTM_EVENT events in
+// the supplied events.
+func DetermineStartupSequence(events []*Event) *StartupInfo {
+	info := &StartupInfo{}
+	seenPCR0Measurement := false
+
+	for _, e := range events {
+		if locality, ok := startupLocality(e); ok {
+			switch {
+			case info.LocalityEvent != nil:
+				info.Problems = append(info.Problems,
+					fmt.Sprintf("duplicate StartupLocality event (event %d)", e.Index))
+				continue
+			case seenPCR0Measurement:
+				info.Problems = append(info.Problems,
+					fmt.Sprintf("StartupLocality event (event %d) appears after the first measurement to PCR 0", e.Index))
+			}
+			info.LocalityEvent = e
+			info.Locality = locality
+			continue
+		}
+		if e.PCRIndex == 0 && doesEventTypeExtendPCR(e.EventType) {
+			seenPCR0Measurement = true
+		}
+		if e.EventType == EventTypeEFIHCRTMEvent {
+			info.HCRTMEvents = append(info.HCRTMEvents, e)
+		}
+	}
+
+	if info.LocalityEvent == nil && len(info.HCRTMEvents) > 0 {
+		// The H-CRTM sequence initializes PCR 0 for locality 4.
+		info.Locality = 4
+	}
+
+	switch info.Locality {
+	case 0:
+		info.Sequence = StartupSequenceLocality0
+	case 3:
+		info.Sequence = StartupSequenceLocality3
+	case 4:
+		info.Sequence = StartupSequenceHCRTM
+	default:
+		info.Problems = append(info.Problems, fmt.Sprintf("invalid startup locality %d", info.Locality))
+	}
+
+	switch {
+	case info.Sequence == StartupSequenceHCRTM && len(info.HCRTMEvents) == 0:
+		info.Problems = append(info.Problems, "StartupLocality event indicates a H-CRTM sequence, but there is no EV_EFI_HCRTM_EVENT")
+	case info.Sequence != StartupSequenceHCRTM && len(info.HCRTMEvents) > 0:
+		info.Problems = append(info.Problems, "log contains an EV_EFI_HCRTM_EVENT, but there is no StartupLocality event indicating locality 4")
+	case len(info.HCRTMEvents) > 0 && info.LocalityEvent == nil:
+		info.Problems = append(info.Problems, "log contains an EV_EFI_HCRTM_EVENT, but there is no StartupLocality "+
+			"event, so PCR 0 is assumed to be initialized for locality 4")
+	}
+
+	return info
+}
@@ -0,0 +1,112 @@
+package tcglog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDetermineStartupSequence(t *testing.T) {
+	locality := func(l uint8) *Event {
+		return &Event{PCRIndex: 0, EventType: EventTypeNoAction, data: &startupLocalityEventData{Locality: l}}
+	}
+	hcrtm := &Event{PCRIndex: 0, EventType: EventTypeEFIHCRTMEvent}
+	crtm := &Event{PCRIndex: 0, EventType: EventTypeSCRTMVersion}
+
+	for _, data := range []struct {
+		desc     string
+		events   []*Event
+		sequence StartupSequence
+		problems int
+	}{
+		{desc: "NoLocalityEvent", events: []*Event{crtm}, sequence: StartupSequenceLocality0},
+		{desc: "Locality0", events: []*Event{locality(0), crtm}, sequence: StartupSequenceLocality0},
+		{desc: "Locality3", events: []*Event{locality(3), crtm}, sequence: StartupSequenceLocality3},
+		{desc: "HCRTM", events: []*Event{locality(4), hcrtm, crtm}, sequence: StartupSequenceHCRTM},
+		{desc: "HCRTMWithoutEvent", events: []*Event{locality(4), crtm}, sequence: StartupSequenceHCRTM, problems: 1},
+		{desc: "HCRTMWithoutLocality", events: []*Event{hcrtm, crtm}, sequence: StartupSequenceHCRTM, problems: 1},
+		{desc: "HCRTMWithLocality3", events: []*Event{locality(3), hcrtm, crtm}, sequence: StartupSequenceLocality3,
+			problems: 1},
+		{desc: "LateLocality", events: []*Event{crtm, locality(3)}, sequence: StartupSequenceLocality3, problems: 1},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			info := DetermineStartupSequence(data.events)
+			if info.Sequence != data.sequence {
+				t.Errorf("Unexpected sequence: %s", info.Sequence)
+			}
+			if len(info.Problems) != data.problems {
+				t.Errorf("Unexpected problems: %v", info.Problems)
+			}
+		})
+	}
+}
+
+func TestReplayEventsStartupLocality(t *testing.T) {
+	algs := AlgorithmIdList{AlgorithmSha256}
+	digest := AlgorithmSha256.hash([]byte("crtm"))
+	events := []*Event{
+		{PCRIndex: 0, EventType: EventTypeNoAction, data: &startupLocalityEventData{Locality: 3}},
+		{PCRIndex: 0, EventType: EventTypeSCRTMVersion, Digests: NewEventDigests(DigestMap{AlgorithmSha256: digest})},
+	}
+
+	values, err := replayEvents(events, algs)
+	if err != nil {
+		t.Fatalf("replayEvents failed: %v", err)
+	}
+
+	initial := make(Digest, 32)
+	initial[31] = 3
+	expected := performHashExtendOperation(AlgorithmSha256, initial, digest)
+	if !bytes.Equal(values[0][AlgorithmSha256], expected) {
+		t.Errorf("Unexpected PCR 0 value: %x", values[0][AlgorithmSha256])
+	}
+}
+
+func TestReplayEventsHCRTM(t *testing.T) {
+	algs := AlgorithmIdList{AlgorithmSha256}
+	hcrtmDigest := AlgorithmSha256.hash([]byte("hcrtm"))
+	crtmDigest := AlgorithmSha256.hash([]byte("crtm"))
+	locality := func(l uint8) *Event {
+		return &Event{PCRIndex: 0, EventType: EventTypeNoAction, data: &startupLocalityEventData{Locality: l}}
+	}
+	hcrtm := &Event{PCRIndex: 0, EventType: EventTypeEFIHCRTMEvent,
+		Digests: NewEventDigests(DigestMap{AlgorithmSha256: hcrtmDigest})}
+	crtm := &Event{PCRIndex: 0, EventType: EventTypeSCRTMVersion,
+		Digests: NewEventDigests(DigestMap{AlgorithmSha256: crtmDigest})}
+
+	initial := make(Digest, 32)
+	initial[31] = 4
+	expected := performHashExtendOperation(AlgorithmSha256, performHashExtendOperation(AlgorithmSha256, initial,
+		hcrtmDigest), crtmDigest)
+
+	for _, data := range []struct {
+		desc   string
+		events []*Event
+	}{
+		{desc: "LocalityFirst", events: []*Event{locality(4), hcrtm, crtm}},
+		// Some firmware records the StartupLocality event after the H-CRTM measurement.
+		{desc: "LocalityAfterHCRTM", events: []*Event{hcrtm, locality(4), crtm}},
+		// Some firmware doesn't record a StartupLocality event at all.
+		{desc: "NoLocality", events: []*Event{hcrtm, crtm}},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			values, err := replayEvents(data.events, algs)
+			if err != nil {
+				t.Fatalf("replayEvents failed: %v", err)
+			}
+			if !bytes.Equal(values[0][AlgorithmSha256], expected) {
+				t.Errorf("Unexpected PCR 0 value: %x", values[0][AlgorithmSha256])
+			}
+		})
+	}
+
+	// A late StartupLocality event doesn't change PCR 0 once it has been extended by something other than the
+	// H-CRTM.
+	values, err := replayEvents([]*Event{crtm, locality(3)}, algs)
+	if err != nil {
+		t.Fatalf("replayEvents failed: %v", err)
+	}
+	if !bytes.Equal(values[0][AlgorithmSha256], performHashExtendOperation(AlgorithmSha256, make(Digest, 32),
+		crtmDigest)) {
+		t.Errorf("Unexpected PCR 0 value: %x", values[0][AlgorithmSha256])
+	}
+}
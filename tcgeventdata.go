@@ -30,6 +30,7 @@ const (
 	SpecId
 	StartupLocality
 	BiosIntegrityMeasurement
+	VendorNoActionEvent // An event with an all-zero or vendor specific signature (see VendorNoActionEventData)
 )
 
 type NoActionEventData interface {
@@ -94,7 +95,7 @@ func wrapSpecIdEventReadError(origErr error) error {
 
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientImplementation_1-21_1_00.pdf
 //  (section 11.3.4.1 "Specification Event")
-func parsePCClientSpecIdEvent(stream io.Reader, eventData *SpecIdEventData) error {
+func parsePCClientSpecIdEvent(stream *bytes.Reader, eventData *SpecIdEventData) error {
 	eventData.Spec = SpecPCClient
 
 	// TCG_PCClientSpecIdEventStruct.vendorInfoSize
@@ -126,7 +127,7 @@ type specIdEventCommon struct {
 //  (section 7.4 "EV_NO_ACTION Event Types")
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
 //  (secion 9.4.5.1 "Specification ID Version Event")
-func decodeSpecIdEvent(stream io.Reader, data []byte, helper func(io.Reader, *SpecIdEventData) error) (*SpecIdEventData, error) {
+func decodeSpecIdEvent(stream *bytes.Reader, data []byte, helper func(*bytes.Reader, *SpecIdEventData) error) (*SpecIdEventData, error) {
 	var common struct{
 		PlatformClass uint32
 		SpecVersionMinor uint8
@@ -185,6 +186,43 @@ func (e *unknownNoActionEventData) Type() NoActionEventType {
 	return UnknownNoActionEvent
 }
 
+// VendorNoActionEventData corresponds to the event data for an EV_NO_ACTION event with a signature that isn't
+// defined by the TCG. Some firmware records manufacturer specific data (eg, TPM manufacturer information) in these
+// events, sometimes with a signature that is all zeros. The raw signature is exposed so that consumers can identify
+// formats that they understand.
+type VendorNoActionEventData struct {
+	data       []byte
+	Signature  [16]byte // The signature field from the start of the event data
+	VendorData []byte   // The event data following the signature
+}
+
+// HasZeroSignature indicates whether the signature field of this event is all zeros.
+func (e *VendorNoActionEventData) HasZeroSignature() bool {
+	return e.Signature == [16]byte{}
+}
+
+func (e *VendorNoActionEventData) String() string {
+	if e.HasZeroSignature() {
+		return fmt.Sprintf("VendorNoActionEvent{ Signature: <zero>, VendorDataSize: %d }", len(e.VendorData))
+	}
+	signature := bytes.TrimRight(e.Signature[:], "\x00")
+	for _, c := range signature {
+		if c < 0x20 || c > 0x7e {
+			return fmt.Sprintf("VendorNoActionEvent{ Signature: %x, VendorDataSize: %d }", e.Signature,
+				len(e.VendorData))
+		}
+	}
+	return fmt.Sprintf("VendorNoActionEvent{ Signature: %q, VendorDataSize: %d }", signature, len(e.VendorData))
+}
+
+func (e *VendorNoActionEventData) Bytes() []byte {
+	return e.data
+}
+
+func (e *VendorNoActionEventData) Type() NoActionEventType {
+	return VendorNoActionEvent
+}
+
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientImplementation_1-21_1_00.pdf
 //  (section 11.3.4 "EV_NO_ACTION Event Types")
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
@@ -195,7 +233,8 @@ func decodeEventDataNoAction(data []byte) (out EventData, trailingBytes int, err
 	// Signature field
 	signature := make([]byte, 16)
 	if _, err := io.ReadFull(stream, signature); err != nil {
-		return nil, 0, err
+		// Too short to have a signature, so there's nothing to identify it by.
+		return &unknownNoActionEventData{data}, 0, nil
 	}
 
 	switch *(*string)(unsafe.Pointer(&signature)) {
@@ -230,9 +269,14 @@ func decodeEventDataNoAction(data []byte) (out EventData, trailingBytes int, err
 		}
 		err = e
 	default:
-		return &unknownNoActionEventData{data}, 0, nil
+		d := &VendorNoActionEventData{data: data, VendorData: data[len(signature):]}
+		copy(d.Signature[:], signature)
+		return d, 0, nil
 	}
 
+	if err == nil {
+		trailingBytes = stream.Len()
+	}
 	return
 }
 
@@ -262,11 +306,56 @@ func decodeEventDataSeparator(data []byte, isError bool) (*separatorEventData, i
 	return &separatorEventData{data: data, isError: isError}, 0, nil
 }
 
+// SCRTMVersionEventData is the event data for EV_S_CRTM_VERSION events, which contain either a NULL terminated UCS-2
+// version string or a GUID.
+type SCRTMVersionEventData struct {
+	data    []byte
+	Version string   // The version string, if the event data is a UCS-2 string
+	GUID    *EFIGUID // The version GUID, if the event data is a GUID
+}
+
+func (e *SCRTMVersionEventData) String() string {
+	if e.GUID != nil {
+		return e.GUID.nameOrString()
+	}
+	return fmt.Sprintf("\"%s\"", e.Version)
+}
+
+func (e *SCRTMVersionEventData) Bytes() []byte {
+	return e.data
+}
+
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf (section 3.3.2.2 "S-CRTM Version Event")
+func decodeEventDataSCRTMVersion(data []byte) (out EventData, trailingBytes int, err error) {
+	if len(data) >= 2 && len(data)%2 == 0 && data[len(data)-2] == 0 && data[len(data)-1] == 0 {
+		u16 := make([]uint16, len(data)/2-1)
+		binary.Read(bytes.NewReader(data), binary.LittleEndian, &u16)
+		isString := true
+		for _, c := range u16 {
+			if c < 0x20 || (c >= surr1 && c < surr3) {
+				isString = false
+				break
+			}
+		}
+		if isString {
+			return &SCRTMVersionEventData{data: data, Version: convertUtf16ToString(u16)}, 0, nil
+		}
+	}
+
+	if len(data) == binary.Size(EFIGUID{}) {
+		var guid EFIGUID
+		binary.Read(bytes.NewReader(data), binary.LittleEndian, &guid)
+		return &SCRTMVersionEventData{data: data, GUID: &guid}, 0, nil
+	}
+
+	return nil, 0, nil
+}
+
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientImplementation_1-21_1_00.pdf (section 11.3.1 "Event Types")
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_EFI_Platform_1_22_Final_-v15.pdf (section 7.2 "Event Types")
 // https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf (section 9.4.1 "Event Types")
-func decodeEventDataTCG(eventType EventType, data []byte,
-	hasDigestOfSeparatorError bool) (out EventData, trailingBytes int, err error) {
+func decodeEventDataTCG(eventType EventType, data []byte, hasDigestOfSeparatorError bool,
+	limits decodeLimits) (out EventData, trailingBytes int, err error) {
 	switch eventType {
 	case EventTypeNoAction:
 		return decodeEventDataNoAction(data)
@@ -274,13 +363,23 @@ func decodeEventDataTCG(eventType EventType, data []byte,
 		return decodeEventDataSeparator(data, hasDigestOfSeparatorError)
 	case EventTypeAction, EventTypeEFIAction:
 		return decodeEventDataAction(data)
+	case EventTypeSCRTMVersion:
+		return decodeEventDataSCRTMVersion(data)
 	case EventTypeEFIVariableDriverConfig, EventTypeEFIVariableBoot, EventTypeEFIVariableAuthority:
-		return decodeEventDataEFIVariable(data, eventType)
+		return decodeEventDataEFIVariable(data, eventType, limits)
 	case EventTypeEFIBootServicesApplication, EventTypeEFIBootServicesDriver,
 		EventTypeEFIRuntimeServicesDriver:
-		return decodeEventDataEFIImageLoad(data)
+		return decodeEventDataEFIImageLoad(data, limits)
 	case EventTypeEFIGPTEvent:
 		return decodeEventDataEFIGPT(data)
+	case EventTypeEFIPlatformFirmwareBlob:
+		return decodeEventDataEFIPlatformFirmwareBlob(data)
+	case EventTypeEFIPlatformFirmwareBlob2:
+		return decodeEventDataEFIPlatformFirmwareBlob2(data)
+	case EventTypeEFIHandoffTables:
+		return decodeEventDataEFIHandoffTables(data)
+	case EventTypeEFIHandoffTables2:
+		return decodeEventDataEFIHandoffTables2(data)
 	default:
 	}
 	return nil, 0, nil
@@ -0,0 +1,126 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestDecodeEventDataSCRTMVersion(t *testing.T) {
+	var str bytes.Buffer
+	binary.Write(&str, binary.LittleEndian, append(convertStringToUtf16("1.0.0"), 0))
+
+	guid := *NewEFIGUID(0x12345678, 0x1234, 0x5678, 0x9abc, [...]uint8{0, 1, 2, 3, 4, 5})
+	var guidData bytes.Buffer
+	binary.Write(&guidData, binary.LittleEndian, guid)
+
+	for _, data := range []struct {
+		desc    string
+		data    []byte
+		version string
+		guid    *EFIGUID
+	}{
+		{desc: "UCS-2", data: str.Bytes(), version: "1.0.0"},
+		{desc: "Empty", data: []byte{0, 0}, version: ""},
+		{desc: "GUID", data: guidData.Bytes(), guid: &guid},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			d, _, err := decodeEventDataTCG(EventTypeSCRTMVersion, data.data, false, decodeLimits{})
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			v, ok := d.(*SCRTMVersionEventData)
+			if !ok {
+				t.Fatalf("Unexpected event data type: %T", d)
+			}
+			if v.Version != data.version {
+				t.Errorf("Unexpected version: %s", v.Version)
+			}
+			if (v.GUID == nil) != (data.guid == nil) || (v.GUID != nil && *v.GUID != *data.guid) {
+				t.Errorf("Unexpected GUID: %v", v.GUID)
+			}
+		})
+	}
+
+	d, _, _ := decodeEventDataTCG(EventTypeSCRTMVersion, []byte{1, 2, 3}, false, decodeLimits{})
+	if d != nil {
+		t.Errorf("Unexpected event data for data that is neither a string or GUID: %s", d)
+	}
+}
+
+func TestDecodeEventDataNoActionVendor(t *testing.T) {
+	for _, data := range []struct {
+		desc      string
+		signature string
+		zero      bool
+		str       string
+	}{
+		{
+			desc:      "Zero",
+			signature: "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00",
+			zero:      true,
+			str:       "VendorNoActionEvent{ Signature: <zero>, VendorDataSize: 4 }",
+		},
+		{
+			desc:      "ASCII",
+			signature: "NuvotonTPMInfo\x00\x00",
+			str:       "VendorNoActionEvent{ Signature: \"NuvotonTPMInfo\", VendorDataSize: 4 }",
+		},
+		{
+			desc:      "Binary",
+			signature: "\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\x0d\x0e\x0f\x10",
+			str:       "VendorNoActionEvent{ Signature: 0102030405060708090a0b0c0d0e0f10, VendorDataSize: 4 }",
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			event := append([]byte(data.signature), 1, 2, 3, 4)
+			d, _, err := decodeEventDataTCG(EventTypeNoAction, event, false, decodeLimits{})
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			v, ok := d.(*VendorNoActionEventData)
+			if !ok {
+				t.Fatalf("Unexpected event data type: %T", d)
+			}
+			if string(v.Signature[:]) != data.signature {
+				t.Errorf("Unexpected signature: %x", v.Signature)
+			}
+			if !bytes.Equal(v.VendorData, []byte{1, 2, 3, 4}) {
+				t.Errorf("Unexpected vendor data: %x", v.VendorData)
+			}
+			if v.HasZeroSignature() != data.zero {
+				t.Errorf("Unexpected HasZeroSignature result")
+			}
+			if v.Type() != VendorNoActionEvent {
+				t.Errorf("Unexpected type: %v", v.Type())
+			}
+			if v.String() != data.str {
+				t.Errorf("Unexpected string: %s", v)
+			}
+		})
+	}
+}
+
+func TestDecodeEventDataNoActionShort(t *testing.T) {
+	d, _, err := decodeEventDataTCG(EventTypeNoAction, []byte{0, 0, 0, 0}, false, decodeLimits{})
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if _, ok := d.(*unknownNoActionEventData); !ok {
+		t.Errorf("Unexpected event data type: %T", d)
+	}
+}
+
+func TestLogWithVendorNoActionEvent(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+	vendor := makeTestLogEvent(0, EventTypeNoAction, make([]byte, 24), algs...)
+	events := readAllTestLogEvents(t, makeTestLog_2(algs, []testLogEvent{
+		vendor,
+		makeTestLogEvent(0, EventTypeSCRTMVersion, []byte("1\x00"), algs...)}), LogOptions{})
+	if len(events) != 3 {
+		t.Fatalf("Unexpected number of events: %d", len(events))
+	}
+	if _, ok := events[1].Data().(*VendorNoActionEventData); !ok {
+		t.Errorf("Unexpected event data type: %T", events[1].Data())
+	}
+}
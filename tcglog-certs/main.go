@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+var (
+	format        string
+	tolerantCerts bool
+)
+
+func init() {
+	flag.StringVar(&format, "format", "pem", "Output format (pem or json)")
+	flag.BoolVar(&tolerantCerts, "tolerant-certificates", false, "Display the subject and issuer of malformed X.509 certificates that would otherwise be rejected")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [log]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Extract the X.509 certificates from the signature databases, "+
+			"authority events and MOK lists in a log as a PEM bundle, with the events that each certificate "+
+			"appears in.\n\n")
+		flag.PrintDefaults()
+	}
+}
+
+type jsonCertificateSource struct {
+	Event          uint   `json:"event"`
+	PCR            uint32 `json:"pcr"`
+	EventType      string `json:"type"`
+	VariableName   string `json:"variableName"`
+	Database       string `json:"database"`
+	SignatureOwner string `json:"signatureOwner,omitempty"`
+}
+
+type jsonCertificate struct {
+	SHA256Fingerprint string                  `json:"sha256Fingerprint"`
+	Subject           string                  `json:"subject,omitempty"`
+	Issuer            string                  `json:"issuer,omitempty"`
+	NotBefore         string                  `json:"notBefore,omitempty"`
+	NotAfter          string                  `json:"notAfter,omitempty"`
+	Malformed         bool                    `json:"malformed,omitempty"`
+	PEM               string                  `json:"pem"`
+	Sources           []jsonCertificateSource `json:"sources"`
+}
+
+func makeJSONCertificate(c *tcglog.LogCertificate) *jsonCertificate {
+	out := &jsonCertificate{
+		SHA256Fingerprint: hex.EncodeToString(c.SHA256Fingerprint),
+		PEM:               string(c.PEM()),
+		Sources:           []jsonCertificateSource{}}
+	if c.Summary != nil {
+		out.Subject = c.Summary.Subject
+		out.Issuer = c.Summary.Issuer
+		out.NotBefore = c.Summary.NotBefore.Format(time.RFC3339)
+		out.NotAfter = c.Summary.NotAfter.Format(time.RFC3339)
+		out.Malformed = c.Summary.Malformed
+	}
+	for _, s := range c.Sources {
+		source := jsonCertificateSource{
+			Event:        s.Event.Index,
+			PCR:          uint32(s.Event.PCRIndex),
+			EventType:    s.Event.EventType.String(),
+			VariableName: s.VariableName.String(),
+			Database:     s.Database}
+		if s.SignatureOwner != nil {
+			source.SignatureOwner = s.SignatureOwner.String()
+		}
+		out.Sources = append(out.Sources, source)
+	}
+	return out
+}
+
+// writePEMCertificate writes the certificate in PEM format, preceded by a description of the certificate and where it
+// appears in the log. Text outside of the PEM blocks is ignored by tools that read PEM bundles.
+func writePEMCertificate(c *tcglog.LogCertificate) {
+	if c.Summary != nil {
+		fmt.Printf("Subject: %s\nIssuer: %s\nValidity: %s - %s\n", c.Summary.Subject, c.Summary.Issuer,
+			c.Summary.NotBefore.Format(time.RFC3339), c.Summary.NotAfter.Format(time.RFC3339))
+	} else {
+		fmt.Printf("Subject: <invalid certificate>\n")
+	}
+	fmt.Printf("SHA256 Fingerprint: %x\n", c.SHA256Fingerprint)
+	for _, s := range c.Sources {
+		fmt.Printf("Found in: %s\n", &s)
+	}
+	os.Stdout.Write(c.PEM())
+	fmt.Printf("\n")
+}
+
+func main() {
+	flag.Parse()
+
+	switch format {
+	case "pem", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "Unrecognized output format \"%s\"\n", format)
+		os.Exit(1)
+	}
+
+	args := flag.Args()
+	if len(args) > 1 {
+		fmt.Fprintf(os.Stderr, "Too many arguments\n")
+		os.Exit(1)
+	}
+
+	path := "/sys/kernel/security/tpm0/binary_bios_measurements"
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	log, err := tcglog.NewLog(file, tcglog.LogOptions{TolerantCertificates: tolerantCerts})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse log file: %v\n", err)
+		os.Exit(1)
+	}
+
+	certs, err := tcglog.ExtractCertificates(log)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Encountered an error when reading the log: %v\n", err)
+		os.Exit(1)
+	}
+
+	if format == "json" {
+		out := []*jsonCertificate{}
+		for _, c := range certs {
+			out = append(out, makeJSONCertificate(c))
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(out); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write JSON output: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	for _, c := range certs {
+		writePEMCertificate(c)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+var (
+	format     string
+	permissive bool
+	noWarnings bool
+)
+
+func init() {
+	flag.StringVar(&format, "format", "text", "Output format (text or json)")
+	flag.BoolVar(&permissive, "permissive", false, "Skip over corrupt regions of the log instead of failing")
+	flag.BoolVar(&noWarnings, "no-warnings", false, "Only report violations with error severity")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [log]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Check the structure of a log against the TCG PC Client Platform "+
+			"Firmware Profile specification. Exits with a non-zero status if there are violations with error "+
+			"severity.\n\n")
+		flag.PrintDefaults()
+	}
+}
+
+type jsonViolation struct {
+	Severity    string  `json:"severity"`
+	Code        string  `json:"code"`
+	Section     string  `json:"section"`
+	Description string  `json:"description"`
+	Event       *uint   `json:"event,omitempty"`
+	PCR         *uint32 `json:"pcr,omitempty"`
+}
+
+type jsonReport struct {
+	Specification string          `json:"specification"`
+	Violations    []jsonViolation `json:"violations"`
+}
+
+func makeJSONViolation(v *tcglog.ComplianceViolation) jsonViolation {
+	out := jsonViolation{
+		Severity:    v.Severity.String(),
+		Code:        v.Rule.Code(),
+		Section:     v.Rule.Section(),
+		Description: v.Description}
+	if v.Event != nil {
+		index := v.Event.Index
+		pcr := uint32(v.Event.PCRIndex)
+		out.Event = &index
+		out.PCR = &pcr
+	}
+	return out
+}
+
+func main() {
+	flag.Parse()
+
+	switch format {
+	case "text", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "Unrecognized output format \"%s\"\n", format)
+		os.Exit(1)
+	}
+
+	args := flag.Args()
+	if len(args) > 1 {
+		fmt.Fprintf(os.Stderr, "Too many arguments\n")
+		os.Exit(1)
+	}
+
+	path := "/sys/kernel/security/tpm0/binary_bios_measurements"
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	log, err := tcglog.NewLog(file, tcglog.LogOptions{Permissive: permissive})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse log file: %v\n", err)
+		os.Exit(1)
+	}
+
+	var events []*tcglog.Event
+	for {
+		event, err := log.NextEvent()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			fmt.Fprintf(os.Stderr, "Encountered an error when reading the next log event: %v\n", err)
+			os.Exit(1)
+		}
+		events = append(events, event)
+	}
+
+	var violations []*tcglog.ComplianceViolation
+	failed := false
+	for _, v := range tcglog.CheckCompliance(events) {
+		if v.Severity == tcglog.SeverityError {
+			failed = true
+		} else if noWarnings {
+			continue
+		}
+		violations = append(violations, v)
+	}
+
+	if format == "json" {
+		report := jsonReport{Specification: tcglog.ComplianceSpecification, Violations: []jsonViolation{}}
+		for _, v := range violations {
+			report.Violations = append(report.Violations, makeJSONViolation(v))
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write JSON output: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		fmt.Printf("Checked %d events against %s\n", len(events), tcglog.ComplianceSpecification)
+		if len(violations) == 0 {
+			fmt.Printf("- No violations found\n")
+		}
+		for _, v := range violations {
+			fmt.Printf("- %s\n", v)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+const defaultLogPath = "/sys/kernel/security/tpm0/binary_bios_measurements"
+
+func logOptions() tcglog.LogOptions {
+	return tcglog.LogOptions{EnableGrub: withGrub, EnableSystemdEFIStub: withSdEfiStub,
+		SystemdEFIStubPCR: tcglog.PCRIndex(sdEfiStubPcr)}
+}
+
+// currentBootID returns the kernel's identifier for the current boot.
+func currentBootID() (string, error) {
+	data, err := ioutil.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// currentBootTime returns the time at which the system booted, from the btime field of /proc/stat.
+func currentBootTime() (time.Time, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != "btime" {
+			continue
+		}
+		secs, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid btime: %v", err)
+		}
+		return time.Unix(secs, 0), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return time.Time{}, err
+	}
+	return time.Time{}, errors.New("no btime field")
+}
+
+// resolveBoot returns the ID of the boot specified by arg, which is either a boot ID or a time in RFC 3339 or
+// YYYY-MM-DD format, in which case the boot that was running at that time is used.
+func resolveBoot(store *tcglog.DirLogStore, arg string) (string, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		t, err := time.ParseInLocation(layout, arg, time.Local)
+		if err != nil {
+			continue
+		}
+		boot, err := store.BootAt(t)
+		if err != nil {
+			return "", err
+		}
+		return boot.ID, nil
+	}
+	boot, err := store.Boot(arg)
+	if err != nil {
+		return "", err
+	}
+	return boot.ID, nil
+}
+
+func historyAdd(store *tcglog.DirLogStore, args []string) error {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	var bootID string
+	fs.StringVar(&bootID, "boot-id", "", "Identifier of the boot (defaults to the current boot ID)")
+	fs.Parse(args)
+
+	path := defaultLogPath
+	boot := &tcglog.StoredBoot{ID: bootID}
+	switch {
+	case fs.NArg() > 1:
+		return errors.New("too many arguments")
+	case fs.NArg() == 1:
+		path = fs.Arg(0)
+		boot.Time = time.Now()
+	default:
+		t, err := currentBootTime()
+		if err != nil {
+			return fmt.Errorf("cannot determine boot time: %v", err)
+		}
+		boot.Time = t
+	}
+	if boot.ID == "" {
+		id, err := currentBootID()
+		if err != nil {
+			return fmt.Errorf("cannot determine boot ID: %v", err)
+		}
+		boot.ID = id
+	}
+
+	events, algorithms, err := readEvents(path)
+	if err != nil {
+		return err
+	}
+	boot.Algorithms = algorithms
+	if err := store.Add(boot, events); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Added log for boot %s\n", boot.ID)
+	return nil
+}
+
+func historyList(store *tcglog.DirLogStore, args []string) error {
+	if len(args) > 0 {
+		return errors.New("too many arguments")
+	}
+	boots, err := store.Boots()
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		if boots == nil {
+			boots = []tcglog.StoredBoot{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(boots)
+	}
+	for _, b := range boots {
+		fmt.Printf("%s %s %s\n", b.Time.Local().Format(time.RFC3339), b.ID, b.Algorithms)
+	}
+	return nil
+}
+
+func historyDiff(store *tcglog.DirLogStore, args []string) error {
+	var newID string
+	switch len(args) {
+	case 0:
+		return errors.New("missing old boot")
+	case 1:
+		boots, err := store.Boots()
+		if err != nil {
+			return err
+		}
+		if len(boots) == 0 {
+			return errors.New("no boots in store")
+		}
+		newID = boots[len(boots)-1].ID
+	case 2:
+		id, err := resolveBoot(store, args[1])
+		if err != nil {
+			return fmt.Errorf("cannot find new boot: %v", err)
+		}
+		newID = id
+	default:
+		return errors.New("too many arguments")
+	}
+	oldID, err := resolveBoot(store, args[0])
+	if err != nil {
+		return fmt.Errorf("cannot find old boot: %v", err)
+	}
+
+	oldBoot, err := store.Boot(oldID)
+	if err != nil {
+		return err
+	}
+	newBoot, err := store.Boot(newID)
+	if err != nil {
+		return err
+	}
+	diff, err := store.Diff(oldID, newID, logOptions())
+	if err != nil {
+		return err
+	}
+	printDiff(diff, tcglog.DiffLogAlgorithms(oldBoot.Algorithms, newBoot.Algorithms).Findings())
+	return nil
+}
+
+// runHistory implements the history subcommand, which archives the log from each boot to a store and compares the
+// logs from any two boots.
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	var dir string
+	fs.StringVar(&dir, "store", "/var/lib/tcglog/history", "Directory in which the logs are archived")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [options] history [-store <dir>] <command>\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Commands:\n")
+		fmt.Fprintf(fs.Output(), "  add [-boot-id <id>] [log]\n")
+		fmt.Fprintf(fs.Output(), "\tArchive the log for the current boot, or the specified log\n")
+		fmt.Fprintf(fs.Output(), "  list\n")
+		fmt.Fprintf(fs.Output(), "\tList the archived boots\n")
+		fmt.Fprintf(fs.Output(), "  diff <old> [new]\n")
+		fmt.Fprintf(fs.Output(), "\tDisplay the differences between two boots, each specified by boot ID or by a time "+
+			"(RFC 3339 or\n\tYYYY-MM-DD). The new boot defaults to the last one\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	store := &tcglog.DirLogStore{Dir: dir}
+	var err error
+	switch fs.Arg(0) {
+	case "add":
+		err = historyAdd(store, fs.Args()[1:])
+	case "list":
+		err = historyList(store, fs.Args()[1:])
+	case "diff":
+		err = historyDiff(store, fs.Args()[1:])
+	default:
+		err = fmt.Errorf("unrecognized command \"%s\"", fs.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot run history %s: %v\n", fs.Arg(0), err)
+		os.Exit(1)
+	}
+}
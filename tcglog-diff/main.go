@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+var (
+	format        string
+	withGrub      bool
+	withSdEfiStub bool
+	sdEfiStubPcr  int
+)
+
+func init() {
+	flag.StringVar(&format, "format", "text", "Output format (text or json)")
+	flag.BoolVar(&withGrub, "with-grub", false, "Interpret measurements made by GRUB to PCR's 8 and 9")
+	flag.BoolVar(&withSdEfiStub, "with-systemd-efi-stub", false, "Interpret measurements made by systemd's EFI stub Linux loader")
+	flag.IntVar(&sdEfiStubPcr, "systemd-efi-stub-pcr", 8, "Specify the PCR that systemd's EFI stub Linux loader measures to")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <old log> [new log]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [options] history [-store <dir>] add|list|diff ...\n\n",
+			os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Display the differences between two logs, eg, a log saved from the "+
+			"previous boot and the log for the current boot. The history subcommand archives the log from each "+
+			"boot so that any two boots can be compared later.\n\n")
+		flag.PrintDefaults()
+	}
+}
+
+type jsonEvent struct {
+	Index     uint              `json:"index"`
+	PCR       uint32            `json:"pcr"`
+	EventType string            `json:"type"`
+	Digests   map[string]string `json:"digests"`
+	Data      string            `json:"data,omitempty"`
+}
+
+func makeJSONEvent(event *tcglog.Event) *jsonEvent {
+	if event == nil {
+		return nil
+	}
+	e := &jsonEvent{
+		Index:     event.Index,
+		PCR:       uint32(event.PCRIndex),
+		EventType: event.EventType.String(),
+		Digests:   make(map[string]string)}
+	for _, alg := range event.Digests.Algorithms() {
+		e.Digests[alg.String()] = hex.EncodeToString(event.Digests.Get(alg))
+	}
+	if event.Data() != nil {
+		e.Data = event.Data().String()
+	}
+	return e
+}
+
+type jsonEventDiff struct {
+	Kind string     `json:"kind"`
+	Old  *jsonEvent `json:"old,omitempty"`
+	New  *jsonEvent `json:"new,omitempty"`
+}
+
+type jsonPCRDiff struct {
+	PCR      uint32           `json:"pcr"`
+	Diverges bool             `json:"diverges"`
+	Events   []*jsonEventDiff `json:"events"`
+}
+
+func formatTextEvent(prefix string, event *tcglog.Event) string {
+	var builder bytes.Buffer
+	fmt.Fprintf(&builder, "%s %3d", prefix, event.Index)
+	for _, alg := range event.Digests.Algorithms() {
+		fmt.Fprintf(&builder, " %s:%x", alg, event.Digests.Get(alg))
+	}
+	fmt.Fprintf(&builder, " %s", event.EventType)
+	if event.Data() != nil {
+		if data := event.Data().String(); data != "" {
+			fmt.Fprintf(&builder, " [ %s ]", data)
+		}
+	}
+	return builder.String()
+}
+
+func readEvents(path string) ([]*tcglog.Event, tcglog.AlgorithmIdList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open log file: %v", err)
+	}
+	defer file.Close()
+
+	log, err := tcglog.NewLog(file, logOptions())
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse log file: %v", err)
+	}
+
+	var events []*tcglog.Event
+	for {
+		event, err := log.NextEvent()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, nil, fmt.Errorf("encountered an error when reading the next log event: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events, log.Algorithms, nil
+}
+
+func main() {
+	flag.Parse()
+
+	switch format {
+	case "text", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "Unrecognized output format \"%s\"\n", format)
+		os.Exit(1)
+	}
+
+	args := flag.Args()
+	if len(args) > 0 && args[0] == "history" {
+		runHistory(args[1:])
+		return
+	}
+
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(os.Stderr, "Missing path to old log\n")
+		os.Exit(1)
+	case len(args) > 2:
+		fmt.Fprintf(os.Stderr, "Too many arguments\n")
+		os.Exit(1)
+	}
+
+	newPath := defaultLogPath
+	if len(args) == 2 {
+		newPath = args[1]
+	}
+
+	oldEvents, oldAlgorithms, err := readEvents(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot read old log: %v\n", err)
+		os.Exit(1)
+	}
+	newEvents, newAlgorithms, err := readEvents(newPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot read new log: %v\n", err)
+		os.Exit(1)
+	}
+
+	diff := tcglog.DiffLogs(oldEvents, newEvents)
+	printDiff(diff, tcglog.DiffLogAlgorithms(oldAlgorithms, newAlgorithms).Findings())
+}
+
+func printDiff(diff *tcglog.LogDiff, algorithmFindings []tcglog.Finding) {
+	if format == "json" {
+		// Keep the JSON output compatible by reporting these separately.
+		for _, f := range algorithmFindings {
+			fmt.Fprintf(os.Stderr, "%s\n", &f)
+		}
+
+		out := []*jsonPCRDiff{}
+		for _, p := range diff.PCRs {
+			d := &jsonPCRDiff{PCR: uint32(p.PCR), Diverges: p.Diverges}
+			for _, e := range p.Events {
+				d.Events = append(d.Events, &jsonEventDiff{Kind: e.Kind.String(), Old: makeJSONEvent(e.Old), New: makeJSONEvent(e.New)})
+			}
+			out = append(out, d)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(out); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write JSON output: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	for _, f := range algorithmFindings {
+		fmt.Printf("%s\n", &f)
+	}
+	if len(algorithmFindings) > 0 {
+		fmt.Printf("\n")
+	}
+
+	switch {
+	case len(diff.PCRs) == 0 && len(algorithmFindings) > 0:
+		fmt.Printf("The events in the logs are identical\n")
+		return
+	case len(diff.PCRs) == 0:
+		fmt.Printf("The logs are identical\n")
+		return
+	}
+
+	for _, p := range diff.PCRs {
+		if p.Diverges {
+			fmt.Printf("PCR %d (value differs):\n", p.PCR)
+		} else {
+			fmt.Printf("PCR %d (value unchanged):\n", p.PCR)
+		}
+		for _, e := range p.Events {
+			if e.Old != nil {
+				fmt.Println(formatTextEvent("  -", e.Old))
+			}
+			if e.New != nil {
+				fmt.Println(formatTextEvent("  +", e.New))
+			}
+		}
+	}
+}
@@ -10,44 +10,142 @@ import (
 	"github.com/chrisccoulson/tcglog-parser"
 )
 
+type AlgorithmIdArgList tcglog.AlgorithmIdList
+
+func (l *AlgorithmIdArgList) String() string {
+	var builder bytes.Buffer
+	for i, alg := range *l {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		fmt.Fprintf(&builder, "%s", alg)
+	}
+	return builder.String()
+}
+
+func (l *AlgorithmIdArgList) Set(value string) error {
+	algorithmId, err := tcglog.ParseAlgorithm(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, algorithmId)
+	return nil
+}
+
+type EventTypeArgList []tcglog.EventType
+
+func (l *EventTypeArgList) String() string {
+	var builder bytes.Buffer
+	for i, t := range *l {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		fmt.Fprintf(&builder, "%s", t)
+	}
+	return builder.String()
+}
+
+func (l *EventTypeArgList) Set(value string) error {
+	t, err := tcglog.ParseEventType(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, t)
+	return nil
+}
+
 var (
-	alg           string
+	algorithms    AlgorithmIdArgList
 	verbose       bool
 	withGrub      bool
 	withSdEfiStub bool
 	sdEfiStubPcr  int
+	withSIPA      bool
 	pcrs          tcglog.PCRArgList
+	eventTypes    EventTypeArgList
+	celFormat     string
+	templatePath  string
+	permissive    bool
+	logArea       bool
+	reproducible  bool
+	tolerantCerts bool
+	drtm          bool
 )
 
 func init() {
-	flag.StringVar(&alg, "alg", "sha1", "Name of the hash algorithm to display")
+	flag.Var(&algorithms, "alg", "Name of the hash algorithm to display. Can be specified multiple times (default sha1)")
 	flag.BoolVar(&verbose, "verbose", false, "Display details of event data")
 	flag.BoolVar(&withGrub, "with-grub", false, "Interpret measurements made by GRUB to PCR's 8 and 9")
 	flag.BoolVar(&withSdEfiStub, "with-systemd-efi-stub", false, "Interpret measurements made by systemd's EFI stub Linux loader")
 	flag.IntVar(&sdEfiStubPcr, "systemd-efi-stub-pcr", 8, "Specify the PCR that systemd's EFI stub Linux loader measures to")
+	flag.BoolVar(&withSIPA, "with-windows-sipa", false, "Interpret the SIPA events in EV_EVENT_TAG events recorded by Windows")
 	flag.Var(&pcrs, "pcr", "Display events associated with the specified PCR. Can be specified multiple times")
+	flag.Var(&eventTypes, "event-type", "Display events with the specified type (eg, EV_EFI_ACTION). Can be specified multiple times")
+	flag.BoolVar(&permissive, "permissive", false, "Skip corrupt regions of the log instead of failing")
+	flag.BoolVar(&logArea, "log-area", false, "Read the log from a fixed size log area that ends with unused space (eg, a dump of the area advertised by the ACPI TPM2 table)")
+	flag.BoolVar(&tolerantCerts, "tolerant-certificates", false, "Display the subject and issuer of malformed X.509 certificates that would otherwise be rejected")
+	flag.BoolVar(&drtm, "drtm", false, "Read an Intel TXT D-RTM event log from a copy of its log area (eg, /sys/kernel/security/slaunch/eventlog)")
+	flag.StringVar(&templatePath, "template", "", "Render the displayed events with the specified Go text/template file")
+	flag.BoolVar(&reproducible, "reproducible", false, "Render templates independently of when and where they are rendered (the current time is the Unix epoch and times are rendered in UTC)")
+	flag.StringVar(&celFormat, "cel", "", "Write the displayed events as a TCG Canonical Event Log in the specified format (tlv, json or cbor)")
 }
 
 func shouldDisplayEvent(event *tcglog.Event) bool {
-	if len(pcrs) == 0 {
-		return true
+	if len(pcrs) > 0 {
+		found := false
+		for _, pcr := range pcrs {
+			if pcr == event.PCRIndex {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
 	}
 
-	for _, pcr := range pcrs {
-		if pcr == event.PCRIndex {
-			return true
+	if len(eventTypes) > 0 {
+		for _, t := range eventTypes {
+			if t == event.EventType {
+				return true
+			}
 		}
+		return false
 	}
 
-	return false
+	return true
+}
+
+// templateLog is the data supplied to templates specified with -template.
+type templateLog struct {
+	Spec       tcglog.Spec
+	Algorithms tcglog.AlgorithmIdList // The algorithms selected with -alg
+	Events     []*tcglog.Event        // The events selected with -pcr and -event-type
 }
 
 func main() {
 	flag.Parse()
 
-	algorithmId, err := tcglog.ParseAlgorithm(alg)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
+	if len(algorithms) == 0 {
+		algorithms = AlgorithmIdArgList{tcglog.AlgorithmSha1}
+	}
+
+	var cel tcglog.CELFormat
+	switch celFormat {
+	case "":
+	case "tlv":
+		cel = tcglog.CELFormatTLV
+	case "json":
+		cel = tcglog.CELFormatJSON
+	case "cbor":
+		cel = tcglog.CELFormatCBOR
+	default:
+		fmt.Fprintf(os.Stderr, "Unrecognized CEL format \"%s\"\n", celFormat)
+		os.Exit(1)
+	}
+
+	if templatePath != "" && celFormat != "" {
+		fmt.Fprintf(os.Stderr, "-template and -cel can't be used together\n")
 		os.Exit(1)
 	}
 
@@ -70,18 +168,38 @@ func main() {
 		os.Exit(1)
 	}
 
-	log, err := tcglog.NewLog(file, tcglog.LogOptions{EnableGrub: withGrub, EnableSystemdEFIStub: withSdEfiStub, SystemdEFIStubPCR: tcglog.PCRIndex(sdEfiStubPcr)})
+	options := tcglog.LogOptions{EnableGrub: withGrub, EnableSystemdEFIStub: withSdEfiStub, SystemdEFIStubPCR: tcglog.PCRIndex(sdEfiStubPcr), EnableWindowsSIPA: withSIPA, Permissive: permissive, TolerantCertificates: tolerantCerts}
+
+	var log *tcglog.Log
+	if logArea || drtm {
+		fi, statErr := file.Stat()
+		if statErr != nil {
+			fmt.Fprintf(os.Stderr, "Failed to determine the size of the log area: %v\n", statErr)
+			os.Exit(1)
+		}
+		if drtm {
+			log, err = tcglog.NewDRTMLog(file, fi.Size(), options)
+		} else {
+			log, err = tcglog.NewLogFromArea(file, fi.Size(), options)
+		}
+	} else {
+		log, err = tcglog.NewLog(file, options)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to parse log file: %v\n", err)
 		os.Exit(1)
 	}
 
-	if !log.Algorithms.Contains(algorithmId) {
-		fmt.Fprintf(os.Stderr,
-			"The log doesn't contain entries for the %s digest algorithm\n", algorithmId)
-		os.Exit(1)
+	for _, alg := range algorithms {
+		if !log.Algorithms.Contains(alg) {
+			fmt.Fprintf(os.Stderr,
+				"The log doesn't contain entries for the %s digest algorithm\n", alg)
+			os.Exit(1)
+		}
 	}
 
+	var celEvents []*tcglog.Event
+	var templateEvents []*tcglog.Event
 	for {
 		event, err := log.NextEvent()
 		if err != nil {
@@ -97,18 +215,59 @@ func main() {
 			continue
 		}
 
+		if celFormat != "" {
+			celEvents = append(celEvents, event)
+			continue
+		}
+		if templatePath != "" {
+			templateEvents = append(templateEvents, event)
+			continue
+		}
+
 		var builder bytes.Buffer
-		fmt.Fprintf(&builder, "%2d %x %s", event.PCRIndex, event.Digests[algorithmId], event.EventType)
+		fmt.Fprintf(&builder, "%2d", event.PCRIndex)
 		if verbose {
-			data := event.Data.String()
+			fmt.Fprintf(&builder, " %3d", event.Index)
+		}
+		for _, alg := range algorithms {
+			fmt.Fprintf(&builder, " %x", event.Digests.Get(alg))
+		}
+		fmt.Fprintf(&builder, " %s", event.EventType)
+		if verbose {
+			data := event.Data().String()
 			if data != "" {
 				fmt.Fprintf(&builder, " [ %s ]", data)
 			}
 
 		}
+		fmt.Println(builder.String())
+	}
+
+	for _, g := range log.Gaps() {
+		fmt.Fprintf(os.Stderr, "Skipped %d corrupt bytes at offset %d (%v)\n", g.Length, g.Offset, g.Err)
+	}
+
+	if celFormat != "" {
+		if err := tcglog.WriteCEL(os.Stdout, celEvents, cel); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write CEL: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if templatePath != "" {
+		env := tcglog.ReportEnvironment{}
+		if reproducible {
+			env = tcglog.ReproducibleReportEnvironment
+		}
+		tmpl, err := tcglog.ParseReportTemplateFileWithEnvironment(templatePath, env)
 		if err != nil {
-			fmt.Fprintf(&builder, " (WARNING: %s)", err)
+			fmt.Fprintf(os.Stderr, "Cannot parse template: %v\n", err)
+			os.Exit(1)
+		}
+		data := &templateLog{Spec: log.Spec, Algorithms: tcglog.AlgorithmIdList(algorithms), Events: templateEvents}
+		if err := tmpl.Execute(os.Stdout, data); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot render template: %v\n", err)
+			os.Exit(1)
 		}
-		fmt.Println(builder.String())
 	}
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+var (
+	format        string
+	withGrub      bool
+	withSdEfiStub bool
+	sdEfiStubPcr  int
+)
+
+func init() {
+	flag.StringVar(&format, "format", "text", "Output format (text or json)")
+	flag.BoolVar(&withGrub, "with-grub", false, "Interpret measurements made by GRUB to PCR's 8 and 9")
+	flag.BoolVar(&withSdEfiStub, "with-systemd-efi-stub", false, "Interpret measurements made by systemd's EFI stub Linux loader")
+	flag.IntVar(&sdEfiStubPcr, "systemd-efi-stub-pcr", 8, "Specify the PCR that systemd's EFI stub Linux loader measures to")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <expression> [log]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Display the events from a log that match an expression, eg:\n"+
+			"  pcr==7 && type==EV_EFI_VARIABLE_AUTHORITY && var.name==\"db\"\n"+
+			"  digest~=a1b2c3\n\n")
+		flag.PrintDefaults()
+	}
+}
+
+type jsonEvent struct {
+	Index     uint              `json:"index"`
+	PCR       uint32            `json:"pcr"`
+	EventType string            `json:"type"`
+	Digests   map[string]string `json:"digests"`
+	Data      string            `json:"data,omitempty"`
+}
+
+func makeJSONEvent(event *tcglog.Event) *jsonEvent {
+	e := &jsonEvent{
+		Index:     event.Index,
+		PCR:       uint32(event.PCRIndex),
+		EventType: event.EventType.String(),
+		Digests:   make(map[string]string)}
+	for _, alg := range event.Digests.Algorithms() {
+		e.Digests[alg.String()] = hex.EncodeToString(event.Digests.Get(alg))
+	}
+	if event.Data() != nil {
+		e.Data = event.Data().String()
+	}
+	return e
+}
+
+func formatTextEvent(event *tcglog.Event) string {
+	var builder bytes.Buffer
+	fmt.Fprintf(&builder, "%2d %3d", event.PCRIndex, event.Index)
+	for _, alg := range event.Digests.Algorithms() {
+		fmt.Fprintf(&builder, " %s:%x", alg, event.Digests.Get(alg))
+	}
+	fmt.Fprintf(&builder, " %s", event.EventType)
+	if event.Data() != nil {
+		if data := event.Data().String(); data != "" {
+			fmt.Fprintf(&builder, " [ %s ]", data)
+		}
+	}
+	return builder.String()
+}
+
+func main() {
+	flag.Parse()
+
+	switch format {
+	case "text", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "Unrecognized output format \"%s\"\n", format)
+		os.Exit(1)
+	}
+
+	args := flag.Args()
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(os.Stderr, "Missing expression\n")
+		os.Exit(1)
+	case len(args) > 2:
+		fmt.Fprintf(os.Stderr, "Too many arguments\n")
+		os.Exit(1)
+	}
+
+	filter, err := tcglog.ParseEventFilter(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid expression: %v\n", err)
+		os.Exit(1)
+	}
+
+	path := "/sys/kernel/security/tpm0/binary_bios_measurements"
+	if len(args) == 2 {
+		path = args[1]
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
+		os.Exit(1)
+	}
+
+	log, err := tcglog.NewLog(file, tcglog.LogOptions{EnableGrub: withGrub, EnableSystemdEFIStub: withSdEfiStub, SystemdEFIStubPCR: tcglog.PCRIndex(sdEfiStubPcr)})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse log file: %v\n", err)
+		os.Exit(1)
+	}
+
+	matched := []*jsonEvent{}
+	for {
+		event, err := log.NextEvent()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			fmt.Fprintf(os.Stderr, "Encountered an error when reading the next log event: %v\n", err)
+			os.Exit(1)
+		}
+
+		if !filter.Match(event) {
+			continue
+		}
+
+		if format == "json" {
+			matched = append(matched, makeJSONEvent(event))
+		} else {
+			fmt.Println(formatTextEvent(event))
+		}
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(matched); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write JSON output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+var quiet bool
+
+func init() {
+	flag.BoolVar(&quiet, "quiet", false, "Only report failures")
+}
+
+func main() {
+	flag.Parse()
+
+	if len(flag.Args()) > 0 {
+		fmt.Fprintf(os.Stderr, "Too many arguments\n")
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, r := range tcglog.SelfTest() {
+		if !r.Passed() {
+			failed = true
+			fmt.Printf("FAIL %s: %v\n", r.Name, r.Err)
+			continue
+		}
+		if !quiet {
+			fmt.Printf("PASS %s\n", r.Name)
+		}
+	}
+
+	if failed {
+		fmt.Fprintf(os.Stderr, "*** Self test failed - this build of tcglog-parser must not be relied on! ***\n")
+		os.Exit(1)
+	}
+}
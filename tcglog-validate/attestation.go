@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+// readCloudAttestation reads the attestation document specified with -attestation, in the form FORMAT:PATH.
+func readCloudAttestation(spec string) (*tcglog.CloudAttestation, error) {
+	i := strings.IndexByte(spec, ':')
+	if i < 0 {
+		return nil, fmt.Errorf("expected FORMAT:PATH")
+	}
+	format, path := spec[:i], spec[i+1:]
+
+	var read func(io.Reader) (*tcglog.CloudAttestation, error)
+	switch format {
+	case "azure":
+		read = tcglog.ReadAzureAttestation
+	case "gcp":
+		read = tcglog.ReadGCPAttestation
+	case "nitrotpm":
+		read = tcglog.ReadNitroTPMAttestation
+	case "tdx":
+		read = readTDXAttestation
+	default:
+		return nil, fmt.Errorf("unrecognized format \"%s\"", format)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return read(f)
+}
+
+// readTDXAttestation reads a TDX quote, and returns its RTMR values indexed by measurement register so that they can
+// be checked against a CC event log.
+func readTDXAttestation(r io.Reader) (*tcglog.CloudAttestation, error) {
+	quote, err := tcglog.ReadTDXQuote(r)
+	if err != nil {
+		return nil, err
+	}
+	return &tcglog.CloudAttestation{PCRValues: quote.RTMRValues()}, nil
+}
+
+// isTDXAttestation indicates whether the document specified with -attestation is a TDX quote, in which case the log
+// is a CC event log that is indexed by measurement register rather than PCR.
+func isTDXAttestation() bool {
+	return strings.HasPrefix(attestSpec, "tdx:")
+}
+
+// writeAttestationLog writes the event log contained in an attestation document to a temporary file, so that it can
+// be validated in the same way as a log read from securityfs. The caller is responsible for removing the file.
+func writeAttestationLog(attestation *tcglog.CloudAttestation) (string, error) {
+	f, err := ioutil.TempFile("", "tcglog-validate-attestation")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(attestation.EventLog); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// attestationAlgorithms returns the algorithms in algs for which the attestation document contains PCR values.
+func attestationAlgorithms(attestation *tcglog.CloudAttestation, algs tcglog.AlgorithmIdList) (out AlgorithmIdArgList) {
+	for _, alg := range algs {
+		for _, digests := range attestation.PCRValues {
+			if _, ok := digests[alg]; ok {
+				out = append(out, alg)
+				break
+			}
+		}
+	}
+	return out
+}
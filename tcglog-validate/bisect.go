@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+func (d *jsonDigest) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	*d = b
+	return nil
+}
+
+// readReferenceHistory reads the PCR histories from the JSON report of a known-good boot specified with
+// -bisect-reference. The histories are indexed by PCR and by the name of the algorithm.
+func readReferenceHistory(path string) (map[tcglog.PCRIndex]map[string][]tcglog.Digest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var report struct {
+		PCRValues []jsonPCRValue `json:"pcrValues"`
+	}
+	if err := json.NewDecoder(f).Decode(&report); err != nil {
+		return nil, fmt.Errorf("cannot decode report: %v", err)
+	}
+
+	out := make(map[tcglog.PCRIndex]map[string][]tcglog.Digest)
+	for _, v := range report.PCRValues {
+		if len(v.History) == 0 {
+			continue
+		}
+		pcr := tcglog.PCRIndex(v.PCR)
+		if out[pcr] == nil {
+			out[pcr] = make(map[string][]tcglog.Digest)
+		}
+		for _, d := range v.History {
+			out[pcr][v.Algorithm] = append(out[pcr][v.Algorithm], tcglog.Digest(d))
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("report doesn't contain any PCR history (it must be created with -format json)")
+	}
+	return out, nil
+}
+
+// bisectAgainstReference compares the selected PCRs and algorithms with the history from the report specified with
+// -bisect-reference, and returns the PCRs that diverge from it.
+func bisectAgainstReference(result *tcglog.LogValidateResult, path string) ([]*tcglog.PCRDivergence, error) {
+	reference, err := readReferenceHistory(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*tcglog.PCRDivergence
+	for _, i := range pcrs {
+		for _, alg := range algorithms {
+			history, ok := reference[i][alg.String()]
+			if !ok {
+				continue
+			}
+			if d := result.BisectPCRDivergence(i, alg, history); d.Diverges() {
+				out = append(out, d)
+			}
+		}
+	}
+	return out, nil
+}
+
+func printDivergence(d *tcglog.PCRDivergence) {
+	if d.FirstDivergent != nil {
+		fmt.Printf("  - PCR %d, bank %s - diverges at event %d (type: %s, preceding matching events: %d)\n", d.PCR,
+			d.Algorithm, d.FirstDivergent.Event.Index, d.FirstDivergent.Event.EventType, d.Matching)
+		return
+	}
+	fmt.Printf("  - PCR %d, bank %s - all %d events match, but %d more events were measured in the reference boot\n",
+		d.PCR, d.Algorithm, d.Matching, d.Missing)
+}
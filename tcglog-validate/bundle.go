@@ -0,0 +1,396 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chrisccoulson/go-tpm2"
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+// version is the version of this tool that is recorded in capture bundles. It can be set at build time with
+// -ldflags "-X main.version=<version>".
+var version = "unknown"
+
+// Names of the files in a capture bundle.
+const (
+	bundleManifestFile      = "manifest.json"
+	bundleLogFile           = "log"
+	bundleFinalEventsFile   = "final-events"
+	bundleIMALogFile        = "ima-log"
+	bundleQuoteFile         = "quote"
+	bundleQuoteSigFile      = "quote-signature"
+	bundleAKPublicFile      = "ak-public"
+	bundleTPMPropertiesFile = "tpm-properties"
+)
+
+// bundleMaxFileSize is the maximum size of a file extracted from a capture bundle.
+const bundleMaxFileSize = 64 * 1024 * 1024
+
+var bundleFiles = map[string]bool{
+	bundleManifestFile:      true,
+	bundleLogFile:           true,
+	bundleFinalEventsFile:   true,
+	bundleIMALogFile:        true,
+	bundleQuoteFile:         true,
+	bundleQuoteSigFile:      true,
+	bundleAKPublicFile:      true,
+	bundleTPMPropertiesFile: true,
+}
+
+// smbiosIdentityFields are the DMI attributes exported by the kernel that identify the platform and its firmware.
+// Serial numbers and UUIDs are deliberately excluded, as bundles are intended to be shared.
+var smbiosIdentityFields = []string{
+	"sys_vendor",
+	"product_name",
+	"product_version",
+	"product_family",
+	"board_vendor",
+	"board_name",
+	"board_version",
+	"bios_vendor",
+	"bios_version",
+	"bios_date",
+}
+
+type bundleOptions struct {
+	WithGrub          bool                   `json:"withGrub"`
+	WithSdEfiStub     bool                   `json:"withSystemdEFIStub"`
+	SdEfiStubPCR      int                    `json:"systemdEFIStubPCR"`
+	IMALogFormat      string                 `json:"imaLogFormat,omitempty"`
+	FinalEvents       bool                   `json:"finalEvents,omitempty"`
+	StrictUTF16       bool                   `json:"strictUTF16"`
+	AuditDigests      bool                   `json:"auditDigests,omitempty"`
+	PCRs              []uint32               `json:"pcrs"`
+	Algorithms        tcglog.AlgorithmIdList `json:"algorithms,omitempty"`
+	TPMPCRValuesTaken bool                   `json:"tpmPCRValuesTaken"`
+}
+
+type bundlePCRValue struct {
+	PCR       uint32             `json:"pcr"`
+	Algorithm tcglog.AlgorithmId `json:"algorithm"`
+	Value     string             `json:"value"`
+}
+
+// bundleManifest describes the contents of a capture bundle and the options that the analysis was run with.
+type bundleManifest struct {
+	ToolVersion  string            `json:"toolVersion"`
+	GoVersion    string            `json:"goVersion,omitempty"`
+	Created      time.Time         `json:"created"`
+	Options      bundleOptions     `json:"options"`
+	SMBIOS       map[string]string `json:"smbios,omitempty"`
+	TPMPCRValues []bundlePCRValue  `json:"tpmPCRValues,omitempty"`
+}
+
+// captureBundle is a capture bundle that has been read for replay. Its files are extracted to dir, so that they can
+// be consumed by the same code paths as the files of a live analysis.
+type captureBundle struct {
+	manifest bundleManifest
+	dir      string
+}
+
+func (b *captureBundle) path(name string) string {
+	path := filepath.Join(b.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+func (b *captureBundle) tpmPCRValues() (map[tcglog.PCRIndex]tcglog.DigestMap, error) {
+	if !b.manifest.Options.TPMPCRValuesTaken {
+		return nil, nil
+	}
+	out := make(map[tcglog.PCRIndex]tcglog.DigestMap)
+	for _, v := range b.manifest.TPMPCRValues {
+		alg := v.Algorithm
+		digest, err := hex.DecodeString(v.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PCR value for PCR %d, bank %s: %v", v.PCR, alg, err)
+		}
+		pcr := tcglog.PCRIndex(v.PCR)
+		if _, exists := out[pcr]; !exists {
+			out[pcr] = tcglog.DigestMap{}
+		}
+		out[pcr][alg] = digest
+	}
+	return out, nil
+}
+
+// applyOptions restores the options that the captured analysis was run with.
+func (b *captureBundle) applyOptions() error {
+	opts := b.manifest.Options
+	withGrub = opts.WithGrub
+	withSdEfiStub = opts.WithSdEfiStub
+	sdEfiStubPcr = opts.SdEfiStubPCR
+	strictUTF16 = opts.StrictUTF16
+	auditDigests = opts.AuditDigests
+	if opts.IMALogFormat != "" {
+		imaLogFormat = opts.IMALogFormat
+	}
+
+	pcrs = nil
+	for _, pcr := range opts.PCRs {
+		pcrs = append(pcrs, tcglog.PCRIndex(pcr))
+	}
+	algorithms = AlgorithmIdArgList(opts.Algorithms)
+
+	logPath = b.path(bundleLogFile)
+	if logPath == "" {
+		return errors.New("bundle doesn't contain an event log")
+	}
+	finalEvtsPath = b.path(bundleFinalEventsFile)
+	if opts.FinalEvents && finalEvtsPath == "" {
+		return errors.New("bundle doesn't contain the final events table")
+	}
+	imaLogPath = b.path(bundleIMALogFile)
+	quotePath = b.path(bundleQuoteFile)
+	quoteSigPath = b.path(bundleQuoteSigFile)
+	akPublicPath = b.path(bundleAKPublicFile)
+	return nil
+}
+
+// readSMBIOSIdentity returns the SMBIOS attributes that identify this platform, as exported by the kernel.
+func readSMBIOSIdentity() map[string]string {
+	out := make(map[string]string)
+	for _, field := range smbiosIdentityFields {
+		data, err := ioutil.ReadFile(filepath.Join("/sys/class/dmi/id", field))
+		if err != nil {
+			continue
+		}
+		out[field] = strings.TrimSpace(string(data))
+	}
+	return out
+}
+
+// readTPMProperties returns the response to a TPM2_GetCapability command for the fixed TPM properties
+// (TPM_CAP_TPM_PROPERTIES, PT_FIXED), which identify the TPM manufacturer and firmware version. The response is
+// recorded unmodified.
+func readTPMProperties(ctx context.Context) ([]byte, error) {
+	tcti, err := openTCTI(ctx, tctiSpec)
+	if err != nil {
+		return nil, fmt.Errorf("could not open TPM device: %v", err)
+	}
+	tpm, _ := tpm2.NewTPMContext(tcti)
+	defer tpm.Close()
+
+	if getTPMDeviceVersion(tpm) != 2 {
+		return nil, nil
+	}
+
+	in, err := tpm2.MarshalToBytes(uint32(0x00000006), uint32(0x00000100), uint32(64))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read TPM properties due to a marshalling error: %v", err)
+	}
+	rc, _, out, err := tpm.RunCommandBytes(tpm2.StructTag(0x8001), tpm2.CommandCode(0x0000017a), in)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read TPM properties: %v", err)
+	}
+	if rc != tpm2.Success {
+		return nil, fmt.Errorf("cannot read TPM properties: unexpected response code (0x%08x)", rc)
+	}
+	return out, nil
+}
+
+// bundleTime returns the time recorded in capture bundles, which is the Unix epoch when -reproducible is specified.
+func bundleTime() time.Time {
+	if reproducible {
+		return time.Unix(0, 0).UTC()
+	}
+	return time.Now().UTC()
+}
+
+func addBundleFile(w *tar.Writer, name string, data []byte, modTime time.Time) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := w.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// writeCaptureBundle writes the inputs of the current analysis to a gzip compressed tar archive at path, so that the
+// analysis can be reproduced on another machine with -replay. The supplied PCRs are those selected before any are
+// added for the IMA log, which are added again on replay.
+func writeCaptureBundle(ctx context.Context, path string, selectedPCRs []tcglog.PCRIndex,
+	tpmPCRValues map[tcglog.PCRIndex]tcglog.DigestMap) error {
+	manifest := bundleManifest{
+		ToolVersion: version,
+		GoVersion:   runtime.Version(),
+		Created:     bundleTime(),
+		Options: bundleOptions{
+			WithGrub:          withGrub,
+			WithSdEfiStub:     withSdEfiStub,
+			SdEfiStubPCR:      sdEfiStubPcr,
+			StrictUTF16:       strictUTF16,
+			AuditDigests:      auditDigests,
+			TPMPCRValuesTaken: tpmPCRValues != nil},
+		SMBIOS: readSMBIOSIdentity()}
+	if reproducible {
+		manifest.GoVersion = ""
+	}
+	if imaLogPath != "" {
+		manifest.Options.IMALogFormat = imaLogFormat
+	}
+	manifest.Options.FinalEvents = finalEvtsPath != ""
+	for _, pcr := range selectedPCRs {
+		manifest.Options.PCRs = append(manifest.Options.PCRs, uint32(pcr))
+	}
+	manifest.Options.Algorithms = tcglog.AlgorithmIdList(algorithms)
+
+	var tpmPCRs []tcglog.PCRIndex
+	for pcr := range tpmPCRValues {
+		tpmPCRs = append(tpmPCRs, pcr)
+	}
+	sort.Slice(tpmPCRs, func(i, j int) bool { return tpmPCRs[i] < tpmPCRs[j] })
+	for _, pcr := range tpmPCRs {
+		for _, alg := range tpmPCRValues[pcr].Algorithms() {
+			manifest.TPMPCRValues = append(manifest.TPMPCRValues, bundlePCRValue{
+				PCR:       uint32(pcr),
+				Algorithm: alg,
+				Value:     hex.EncodeToString(tpmPCRValues[pcr][alg])})
+		}
+	}
+
+	files := map[string][]byte{}
+	for name, path := range map[string]string{
+		bundleLogFile:         logPath,
+		bundleFinalEventsFile: finalEvtsPath,
+		bundleIMALogFile:      imaLogPath,
+		bundleQuoteFile:       quotePath,
+		bundleQuoteSigFile:    quoteSigPath,
+		bundleAKPublicFile:    akPublicPath} {
+		if path == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[name] = data
+	}
+	if tpmPCRValues != nil {
+		data, err := readTPMProperties(ctx)
+		if err != nil {
+			return err
+		}
+		if data != nil {
+			files[bundleTPMPropertiesFile] = data
+		}
+	}
+
+	manifestData, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	if err := addBundleFile(w, bundleManifestFile, manifestData, manifest.Created); err != nil {
+		return err
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := addBundleFile(w, name, files[name], manifest.Created); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// readCaptureBundle reads the capture bundle at path, created by writeCaptureBundle, and extracts its files to a
+// temporary directory. The caller is responsible for removing the directory.
+func readCaptureBundle(path string) (*captureBundle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress bundle: %v", err)
+	}
+	r := tar.NewReader(gz)
+
+	dir, err := ioutil.TempDir("", "tcglog-validate")
+	if err != nil {
+		return nil, err
+	}
+	bundle := &captureBundle{dir: dir}
+
+	haveManifest := false
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("cannot read bundle: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !bundleFiles[hdr.Name] {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("unexpected entry in bundle: %s", hdr.Name)
+		}
+		if hdr.Size > bundleMaxFileSize {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("bundle entry %s is too large", hdr.Name)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("cannot read bundle entry %s: %v", hdr.Name, err)
+		}
+
+		if hdr.Name == bundleManifestFile {
+			if err := json.Unmarshal(data, &bundle.manifest); err != nil {
+				os.RemoveAll(dir)
+				return nil, fmt.Errorf("cannot decode bundle manifest: %v", err)
+			}
+			haveManifest = true
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, hdr.Name), data, 0600); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+
+	if !haveManifest {
+		os.RemoveAll(dir)
+		return nil, errors.New("bundle doesn't contain a manifest")
+	}
+	return bundle, nil
+}
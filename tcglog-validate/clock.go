@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrisccoulson/go-tpm2"
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+// tpmClockReport contains the clock information read from the TPM with -check-tpm-clock, and the findings from
+// comparing it with the system uptime.
+type tpmClockReport struct {
+	Info     *tcglog.TPMClockInfo
+	Uptime   time.Duration
+	Findings []tcglog.Finding
+}
+
+// readSystemUptime returns the time since the OS booted from /proc/uptime, which isn't affected by changes to the
+// system clock.
+func readSystemUptime() (time.Duration, error) {
+	data, err := ioutil.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, errors.New("empty uptime")
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid uptime: %v", err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// readTPMClockInfo reads the clock information from the TPM with the TPM2_ReadClock command.
+func readTPMClockInfo(ctx context.Context) (*tcglog.TPMClockInfo, error) {
+	tcti, err := openTCTI(ctx, tctiSpec)
+	if err != nil {
+		return nil, fmt.Errorf("could not open TPM device: %v", err)
+	}
+	tpm, _ := tpm2.NewTPMContext(tcti)
+	defer tpm.Close()
+
+	if getTPMDeviceVersion(tpm) != 2 {
+		return nil, errors.New("not a TPM2 device")
+	}
+
+	rc, _, out, err := tpm.RunCommandBytes(tpm2.StructTag(0x8001), tpm2.CommandCode(0x00000181), nil)
+	if err != nil {
+		return nil, err
+	}
+	if rc != tpm2.Success {
+		return nil, fmt.Errorf("unexpected response code (0x%08x)", rc)
+	}
+	return tcglog.DecodeTPMTimeInfo(out)
+}
+
+// checkTPMClock reads the clock information from the TPM and checks that the TPM hasn't been reset or restarted since
+// the OS booted.
+func checkTPMClock(ctx context.Context) (*tpmClockReport, error) {
+	info, err := readTPMClockInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read clock from TPM: %v", err)
+	}
+	uptime, err := readSystemUptime()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read system uptime: %v", err)
+	}
+	return &tpmClockReport{Info: info, Uptime: uptime, Findings: tcglog.CheckTPMClockInfo(info, uptime)}, nil
+}
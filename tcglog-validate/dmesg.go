@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+// pcrMismatchFindings returns a finding for each bank of each of the specified PCRs that isn't consistent with
+// tpmPCRValues (which may be nil). This is used for the PCRs that aren't checked by SelfCheck, such as the PCRs
+// used by IMA, and for CC event logs, which SelfCheck doesn't support.
+func pcrMismatchFindings(result *tcglog.LogValidateResult, pcrs []tcglog.PCRIndex, algs tcglog.AlgorithmIdList,
+	tpmPCRValues map[tcglog.PCRIndex]tcglog.DigestMap) []tcglog.Finding {
+	if tpmPCRValues == nil {
+		return nil
+	}
+	var findings []tcglog.Finding
+	for _, i := range pcrs {
+		for _, alg := range algs {
+			if bytes.Equal(result.ExpectedPCRValues[i][alg], tpmPCRValues[i][alg]) {
+				continue
+			}
+			findings = append(findings, tcglog.Finding{
+				Severity: tcglog.SeverityError,
+				Kind:     tcglog.FindingKindPCRMismatch,
+				Description: fmt.Sprintf("log is not consistent with PCR %d, bank %s (actual PCR value: %x, "+
+					"expected PCR value from log: %x)", i, alg, tpmPCRValues[i][alg],
+					result.ExpectedPCRValues[i][alg])})
+		}
+	}
+	return findings
+}
+
+// correlateKernelLog reads the kernel log supplied with -dmesg and returns the findings from correlating its TPM
+// related messages with the supplied findings from the log.
+func correlateKernelLog(findings []tcglog.Finding) ([]tcglog.Finding, error) {
+	f, err := os.Open(dmesgPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	messages, err := tcglog.ReadKernelTPMMessages(f)
+	if err != nil {
+		return nil, err
+	}
+	return tcglog.CorrelateKernelTPMMessages(messages, findings), nil
+}
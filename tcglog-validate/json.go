@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+type jsonDigest tcglog.Digest
+
+func (d jsonDigest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(d))
+}
+
+type jsonEventRef struct {
+	Index     uint   `json:"index"`
+	PCR       uint32 `json:"pcr"`
+	EventType string `json:"type"`
+}
+
+func makeJSONEventRef(e *tcglog.Event) jsonEventRef {
+	return jsonEventRef{Index: e.Index, PCR: uint32(e.PCRIndex), EventType: e.EventType.String()}
+}
+
+type jsonTrailingBytes struct {
+	Event jsonEventRef `json:"event"`
+	Bytes jsonDigest   `json:"bytes"`
+}
+
+type jsonIncorrectDigest struct {
+	Event     jsonEventRef `json:"event"`
+	Algorithm string       `json:"algorithm"`
+	Expected  jsonDigest   `json:"expected"`
+	Got       jsonDigest   `json:"got"`
+}
+
+type jsonFirmwareError struct {
+	Event jsonEventRef `json:"event"`
+	Info  string       `json:"info"`
+}
+
+type jsonSeparatorStatus struct {
+	PCR       uint32     `json:"pcr"`
+	Count     int        `json:"count"`
+	IsError   bool       `json:"isError"`
+	ErrorInfo jsonDigest `json:"errorInfo,omitempty"`
+}
+
+type jsonPCRValue struct {
+	PCR        uint32     `json:"pcr"`
+	Algorithm  string     `json:"algorithm"`
+	Expected   jsonDigest `json:"expected"`
+	Actual     jsonDigest `json:"actual,omitempty"`
+	Consistent *bool      `json:"consistent,omitempty"`
+
+	// History contains the values of the PCR expected from the log after each event that extends it, so that the
+	// report can be used as the reference for -bisect-reference.
+	History []jsonDigest `json:"history,omitempty"`
+
+	// DivergesAfter is the last event after which the value of the PCR expected from the log matches the actual
+	// value, if the log is not consistent with the TPM.
+	DivergesAfter *jsonEventRef `json:"divergesAfter,omitempty"`
+}
+
+type jsonPCRDivergence struct {
+	PCR            uint32        `json:"pcr"`
+	Algorithm      string        `json:"algorithm"`
+	Matching       int           `json:"matching"`
+	FirstDivergent *jsonEventRef `json:"firstDivergent,omitempty"`
+	Missing        int           `json:"missing,omitempty"`
+}
+
+type jsonReferenceChange struct {
+	Kind        string        `json:"kind"`
+	Event       *jsonEventRef `json:"event,omitempty"`
+	Reference   string        `json:"reference,omitempty"`
+	Description string        `json:"description,omitempty"`
+}
+
+type jsonReferenceDiff struct {
+	PCR      uint32                `json:"pcr"`
+	Diverges bool                  `json:"diverges"`
+	Changes  []jsonReferenceChange `json:"changes"`
+}
+
+type jsonFinding struct {
+	Severity    string `json:"severity"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+type jsonTPMClock struct {
+	TimeMillis    uint64        `json:"timeMillis"`
+	ClockMillis   uint64        `json:"clockMillis"`
+	ResetCount    uint32        `json:"resetCount"`
+	RestartCount  uint32        `json:"restartCount"`
+	Safe          bool          `json:"safe"`
+	UptimeSeconds float64       `json:"uptimeSeconds"`
+	Findings      []jsonFinding `json:"findings"`
+}
+
+type jsonPCRTrust struct {
+	PCR     uint32   `json:"pcr"`
+	Trust   string   `json:"trust"`
+	Reasons []string `json:"reasons"`
+}
+
+type jsonQuote struct {
+	ExtraData         jsonDigest `json:"extraData"`
+	PCRDigest         jsonDigest `json:"pcrDigest"`
+	ExpectedPCRDigest jsonDigest `json:"expectedPCRDigest"`
+	Consistent        bool       `json:"consistent"`
+}
+
+type jsonReport struct {
+	Algorithms               []string              `json:"algorithms"`
+	EFIBootVariableDataOnly  bool                  `json:"efiBootVariableDataOnly"`
+	StartupSequence          string                `json:"startupSequence"`
+	StartupProblems          []string              `json:"startupProblems"`
+	ExitBootServices         string                `json:"exitBootServices"`
+	ExitBootServicesProblems []string              `json:"exitBootServicesProblems"`
+	TrailingMeasuredBytes    []jsonTrailingBytes   `json:"trailingMeasuredBytes"`
+	IncorrectDigests         []jsonIncorrectDigest `json:"incorrectDigests"`
+	Separators               []jsonSeparatorStatus `json:"separators"`
+	FirmwareErrors           []jsonFirmwareError   `json:"firmwareErrors"`
+	PCRValues                []jsonPCRValue        `json:"pcrValues"`
+	PCRTrust                 []jsonPCRTrust        `json:"pcrTrust"`
+	LogConsistentWithTPM     *bool                 `json:"logConsistentWithTPM,omitempty"`
+	Quote                    *jsonQuote            `json:"quote,omitempty"`
+	Divergences              []jsonPCRDivergence   `json:"divergences,omitempty"`
+	ReferenceDiffs           []jsonReferenceDiff   `json:"referenceDiffs,omitempty"`
+	KernelDiagnosis          []jsonFinding         `json:"kernelDiagnosis,omitempty"`
+	TPMClock                 *jsonTPMClock         `json:"tpmClock,omitempty"`
+}
+
+func writeJSONReport(w io.Writer, result *tcglog.LogValidateResult,
+	tpmPCRValues map[tcglog.PCRIndex]tcglog.DigestMap, quoteResult *tcglog.QuoteVerifyResult,
+	divergences []*tcglog.PCRDivergence, referenceDiffs []*tcglog.ReferencePCRDiff,
+	kernelFindings []tcglog.Finding, clockReport *tpmClockReport) error {
+	report := jsonReport{
+		EFIBootVariableDataOnly:  result.EfiBootVariableBehaviour == tcglog.EFIBootVariableBehaviourVarDataOnly,
+		StartupSequence:          result.Startup.Sequence.String(),
+		StartupProblems:          append([]string{}, result.Startup.Problems...),
+		ExitBootServices:         result.ExitBootServices.Outcome.String(),
+		ExitBootServicesProblems: append([]string{}, result.ExitBootServices.Problems...),
+		TrailingMeasuredBytes:    []jsonTrailingBytes{},
+		IncorrectDigests:         []jsonIncorrectDigest{},
+		Separators:               []jsonSeparatorStatus{},
+		FirmwareErrors:           []jsonFirmwareError{},
+		PCRValues:                []jsonPCRValue{},
+		PCRTrust:                 []jsonPCRTrust{}}
+
+	for _, alg := range algorithms {
+		report.Algorithms = append(report.Algorithms, alg.String())
+	}
+
+	for _, e := range result.ValidatedEvents {
+		if e.HasTrailingMeasuredBytes() {
+			report.TrailingMeasuredBytes = append(report.TrailingMeasuredBytes, jsonTrailingBytes{
+				Event: makeJSONEventRef(e.Event),
+				Bytes: jsonDigest(e.TrailingBytes())})
+		}
+		for _, v := range e.IncorrectDigestValues {
+			report.IncorrectDigests = append(report.IncorrectDigests, jsonIncorrectDigest{
+				Event:     makeJSONEventRef(e.Event),
+				Algorithm: v.Algorithm.String(),
+				Expected:  jsonDigest(v.Expected),
+				Got:       jsonDigest(e.Event.Digests.Get(v.Algorithm))})
+		}
+	}
+
+	var events []*tcglog.Event
+	for _, e := range result.ValidatedEvents {
+		events = append(events, e.Event)
+	}
+	for _, e := range tcglog.FindFirmwareErrors(events) {
+		report.FirmwareErrors = append(report.FirmwareErrors, jsonFirmwareError{
+			Event: makeJSONEventRef(e.Event),
+			Info:  e.Info})
+	}
+
+	for i := tcglog.PCRIndex(0); i < 8; i++ {
+		status := result.Separators[i]
+		report.Separators = append(report.Separators, jsonSeparatorStatus{
+			PCR:       uint32(i),
+			Count:     len(status.Events),
+			IsError:   status.IsError,
+			ErrorInfo: jsonDigest(status.ErrorInfo())})
+	}
+
+	if tpmPCRValues != nil {
+		consistent := true
+		report.LogConsistentWithTPM = &consistent
+	}
+
+	for _, i := range pcrs {
+		for _, alg := range algorithms {
+			v := jsonPCRValue{PCR: uint32(i), Algorithm: alg.String(),
+				Expected: jsonDigest(result.ExpectedPCRValues[i][alg])}
+			for _, d := range result.PCRHistory(i, alg) {
+				v.History = append(v.History, jsonDigest(d))
+			}
+			if tpmPCRValues != nil {
+				v.Actual = jsonDigest(tpmPCRValues[i][alg])
+				ok := bytes.Equal(result.ExpectedPCRValues[i][alg], tpmPCRValues[i][alg])
+				v.Consistent = &ok
+				if !ok {
+					*report.LogConsistentWithTPM = false
+					if e := result.LastEventWithPCRValue(i, alg, tpmPCRValues[i][alg]); e != nil {
+						ref := makeJSONEventRef(e.Event)
+						v.DivergesAfter = &ref
+					}
+				}
+			}
+			report.PCRValues = append(report.PCRValues, v)
+		}
+	}
+
+	for _, c := range result.ClassifyPCRTrust(pcrs, tpmPCRValues) {
+		report.PCRTrust = append(report.PCRTrust, jsonPCRTrust{PCR: uint32(c.PCR), Trust: c.Trust.String(),
+			Reasons: append([]string{}, c.Reasons...)})
+	}
+
+	if quoteResult != nil {
+		report.Quote = &jsonQuote{
+			ExtraData:         jsonDigest(quoteResult.Quote.ExtraData),
+			PCRDigest:         jsonDigest(quoteResult.Quote.PCRDigest),
+			ExpectedPCRDigest: jsonDigest(quoteResult.ExpectedPCRDigest),
+			Consistent:        quoteResult.Consistent()}
+	}
+
+	for _, d := range divergences {
+		v := jsonPCRDivergence{PCR: uint32(d.PCR), Algorithm: d.Algorithm.String(), Matching: d.Matching,
+			Missing: d.Missing}
+		if d.FirstDivergent != nil {
+			ref := makeJSONEventRef(d.FirstDivergent.Event)
+			v.FirstDivergent = &ref
+		}
+		report.Divergences = append(report.Divergences, v)
+	}
+
+	for _, f := range kernelFindings {
+		report.KernelDiagnosis = append(report.KernelDiagnosis, jsonFinding{Severity: f.Severity.String(),
+			Code: f.Kind.Code(), Description: f.Description})
+	}
+
+	if clockReport != nil {
+		report.TPMClock = &jsonTPMClock{
+			TimeMillis:    clockReport.Info.Time,
+			ClockMillis:   clockReport.Info.Clock,
+			ResetCount:    clockReport.Info.ResetCount,
+			RestartCount:  clockReport.Info.RestartCount,
+			Safe:          clockReport.Info.Safe,
+			UptimeSeconds: clockReport.Uptime.Seconds(),
+			Findings:      []jsonFinding{}}
+		if reproducible {
+			// These depend on when the report was produced.
+			report.TPMClock.TimeMillis = 0
+			report.TPMClock.ClockMillis = 0
+			report.TPMClock.UptimeSeconds = 0
+		}
+		for _, f := range clockReport.Findings {
+			report.TPMClock.Findings = append(report.TPMClock.Findings, jsonFinding{
+				Severity: f.Severity.String(), Code: f.Kind.Code(), Description: f.Description})
+		}
+	}
+
+	for _, d := range referenceDiffs {
+		v := jsonReferenceDiff{PCR: uint32(d.PCR), Diverges: d.Diverges, Changes: []jsonReferenceChange{}}
+		for _, c := range d.Changes {
+			jc := jsonReferenceChange{Kind: c.Kind.String()}
+			if c.Event != nil {
+				ref := makeJSONEventRef(c.Event)
+				jc.Event = &ref
+				if data := c.Event.Data(); data != nil {
+					jc.Description = data.String()
+				}
+			}
+			if c.Reference != nil {
+				jc.Reference = c.Reference.Description
+			}
+			v.Changes = append(v.Changes, jc)
+		}
+		report.ReferenceDiffs = append(report.ReferenceDiffs, v)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(report)
+}
@@ -2,12 +2,16 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/chrisccoulson/go-tpm2"
 	"github.com/chrisccoulson/tcglog-parser"
@@ -41,7 +45,30 @@ var (
 	sdEfiStubPcr  int
 	noDefaultPcrs bool
 	tpmPath       string
+	tctiSpec      string
 	logPath       string
+	finalEvtsPath string
+	format        string
+	imaLogPath    string
+	imaLogFormat  string
+	strictUTF16   bool
+	auditDigests  bool
+	checkClock    bool
+	quotePath     string
+	quoteSigPath  string
+	akPublicPath  string
+	capturePath   string
+	replayPath    string
+	attestSpec    string
+	bisectPath    string
+	referencePath string
+	saveRefPath   string
+	refKeyPath    string
+	dmesgPath     string
+	requireOS     bool
+	templatePath  string
+	timeout       time.Duration
+	reproducible  bool
 	pcrs          tcglog.PCRArgList
 	algorithms    AlgorithmIdArgList
 )
@@ -52,7 +79,53 @@ func init() {
 	flag.IntVar(&sdEfiStubPcr, "systemd-efi-stub-pcr", 8, "Specify the PCR that systemd's EFI stub Linux loader measures to")
 	flag.BoolVar(&noDefaultPcrs, "no-default-pcrs", false, "Don't validate log entries for PCRs 0 - 7")
 	flag.StringVar(&tpmPath, "tpm-path", "/dev/tpm0", "Validate log entries associated with the specified TPM")
+	flag.StringVar(&tctiSpec, "tcti", "", "Read PCR values using the specified TPM interface instead of -tpm-path: "+
+		"device:<path> (eg, device:/dev/tpmrm0), mssim:[<host>[:<port>]] or swtpm:<socket path>. PCR values are read "+
+		"even if -log-path is specified")
 	flag.StringVar(&logPath, "log-path", "", "")
+	flag.StringVar(&finalEvtsPath, "final-events-path", "", "Merge the events from the specified copy of the final "+
+		"events table (EFI_TCG2_FINAL_EVENTS_TABLE) with the log, skipping those that are already in the log")
+	flag.StringVar(&format, "format", "text", "Output format for the validation report (text or json)")
+	flag.StringVar(&imaLogPath, "ima-log-path", "", "Also validate the specified Linux IMA runtime measurement list")
+	flag.StringVar(&imaLogFormat, "ima-log-format", "binary", "Format of the IMA runtime measurement list (binary "+
+		"or ascii)")
+	flag.BoolVar(&strictUTF16, "strict-utf16", false, "Report variable and partition names that aren't well-formed UTF-16")
+	flag.BoolVar(&auditDigests, "audit-digests", false, "Report digests that were computed with a different algorithm to the one they were recorded for")
+	flag.BoolVar(&checkClock, "check-tpm-clock", false, "Check that the TPM hasn't been reset or restarted since "+
+		"the log was produced, by comparing its clock information with the system uptime")
+	flag.StringVar(&quotePath, "quote", "", "Validate the log against the specified TPM2 quote (TPMS_ATTEST) instead "+
+		"of reading PCR values from the TPM")
+	flag.StringVar(&quoteSigPath, "quote-signature", "", "Signature of the quote (TPMT_SIGNATURE)")
+	flag.StringVar(&akPublicPath, "ak-public", "", "Public area of the key that signed the quote (TPM2B_PUBLIC)")
+	flag.StringVar(&capturePath, "capture", "", "Write the inputs of the analysis (the logs, final events table, PCR "+
+		"values read from the TPM, TPM properties, SMBIOS identity and tool version) to the specified gzip "+
+		"compressed tar archive (eg, bundle.tar.gz), so that the analysis can be reproduced elsewhere with -replay")
+	flag.StringVar(&replayPath, "replay", "", "Reproduce the analysis from the specified archive created with -capture "+
+		"instead of reading the logs and the TPM on this machine. Other options are taken from the archive")
+	flag.StringVar(&attestSpec, "attestation", "", "Validate the log against the PCR values in the specified cloud "+
+		"VM attestation document instead of reading them from the TPM, in the form FORMAT:PATH where FORMAT is "+
+		"azure, gcp, nitrotpm or tdx. The log is taken from the document if it contains one and -log-path isn't "+
+		"specified. For tdx, PATH is a TD quote and -log-path is a CC event log (eg, "+
+		"/sys/firmware/acpi/tables/data/CCEL), and PCRs are measurement register indices (1 - 4 for RTMR0 - RTMR3)")
+	flag.StringVar(&bisectPath, "bisect-reference", "", "Compare the log with the JSON report (created with -format "+
+		"json) of a known-good boot, and report the earliest event at which each PCR diverges from it")
+	flag.StringVar(&referencePath, "reference", "", "Compare the log with the specified reference file (created "+
+		"with -save-reference) of a known-good boot, and report which components changed")
+	flag.StringVar(&saveRefPath, "save-reference", "", "Save the expected PCR values and event digests for the "+
+		"selected PCRs and algorithms to the specified reference file, for use with -reference")
+	flag.StringVar(&refKeyPath, "reference-key", "", "PEM encoded Ed25519 key used to sign the file "+
+		"written by -save-reference (private key) or to verify the file specified by -reference (public key)")
+	flag.StringVar(&dmesgPath, "dmesg", "", "Correlate TPM errors in the specified kernel log (the output of dmesg "+
+		"or journalctl -k) with the findings from the log")
+	flag.BoolVar(&requireOS, "require-os-present", false, "Fail if the log doesn't show that the last call to "+
+		"ExitBootServices returned with success")
+	flag.StringVar(&templatePath, "template", "", "Render the validation report with the specified Go text/template "+
+		"file instead of the built-in text format")
+	flag.DurationVar(&timeout, "timeout", 0, "Give up if validating the log and reading PCR values from the TPM "+
+		"takes longer than the specified duration (eg, 30s)")
+	flag.BoolVar(&reproducible, "reproducible", false, "Make reports and capture bundles independent of when and "+
+		"where they are created, so that identical inputs produce identical output. Timestamps are zeroed, times "+
+		"are rendered in UTC and the Go version isn't recorded")
 	flag.Var(&pcrs, "pcr", "Validate log entries for the specified PCR. Can be specified multiple times")
 	flag.Var(&algorithms, "alg", "Validate log entries for the specified algorithm. Can be specified "+
 		"multiple times")
@@ -65,7 +138,8 @@ func pcrIndexListToSelectionData(l []tcglog.PCRIndex) (out tpm2.PCRSelectionData
 	return
 }
 
-func readPCRsFromTPM2Device(tpm *tpm2.TPMContext) (map[tcglog.PCRIndex]tcglog.DigestMap, error) {
+func readPCRsFromTPM2Device(tpm *tpm2.TPMContext, pcrs []tcglog.PCRIndex,
+	algorithms tcglog.AlgorithmIdList) (map[tcglog.PCRIndex]tcglog.DigestMap, error) {
 	result := make(map[tcglog.PCRIndex]tcglog.DigestMap)
 
 	var selections tpm2.PCRSelectionList
@@ -91,7 +165,8 @@ func readPCRsFromTPM2Device(tpm *tpm2.TPMContext) (map[tcglog.PCRIndex]tcglog.Di
 	return result, nil
 }
 
-func readPCRsFromTPM1Device(tpm *tpm2.TPMContext) (map[tcglog.PCRIndex]tcglog.DigestMap, error) {
+func readPCRsFromTPM1Device(tpm *tpm2.TPMContext,
+	pcrs []tcglog.PCRIndex) (map[tcglog.PCRIndex]tcglog.DigestMap, error) {
 	result := make(map[tcglog.PCRIndex]tcglog.DigestMap)
 	for _, i := range pcrs {
 		in, err := tpm2.MarshalToBytes(uint32(i))
@@ -128,8 +203,9 @@ func getTPMDeviceVersion(tpm *tpm2.TPMContext) int {
 	return 0
 }
 
-func readPCRs() (map[tcglog.PCRIndex]tcglog.DigestMap, error) {
-	tcti, err := tpm2.OpenTPMDevice(tpmPath)
+func readPCRs(ctx context.Context, pcrs []tcglog.PCRIndex,
+	algorithms tcglog.AlgorithmIdList) (map[tcglog.PCRIndex]tcglog.DigestMap, error) {
+	tcti, err := openTCTI(ctx, tctiSpec)
 	if err != nil {
 		return nil, fmt.Errorf("could not open TPM device: %v", err)
 	}
@@ -138,24 +214,187 @@ func readPCRs() (map[tcglog.PCRIndex]tcglog.DigestMap, error) {
 
 	switch getTPMDeviceVersion(tpm) {
 	case 2:
-		return readPCRsFromTPM2Device(tpm)
+		return readPCRsFromTPM2Device(tpm, pcrs, algorithms)
 	case 1:
-		return readPCRsFromTPM1Device(tpm)
+		return readPCRsFromTPM1Device(tpm, pcrs)
 	}
 
 	return nil, errors.New("not a valid TPM device")
 }
 
+// pcrReader is the source of PCR values that the log is checked against by SelfCheck. It returns the values from a
+// capture bundle or attestation document if values is set, or reads them from the TPM otherwise. The values of
+// extraPCRs, which SelfCheck doesn't check (eg, the PCRs used by IMA), are read at the same time.
+type pcrReader struct {
+	values    tcglog.PCRValues
+	extraPCRs []tcglog.PCRIndex
+}
+
+func (r *pcrReader) ReadPCRs(ctx context.Context, pcrs []tcglog.PCRIndex,
+	algorithms tcglog.AlgorithmIdList) (tcglog.PCRValues, error) {
+	if r.values != nil {
+		return r.values, nil
+	}
+	return readPCRs(ctx, append(append([]tcglog.PCRIndex(nil), pcrs...), r.extraPCRs...), algorithms)
+}
+
+// newPCRReader returns the source of PCR values for SelfCheck, or nil if the log isn't being checked against any.
+func newPCRReader(bundle *captureBundle, attestation *tcglog.CloudAttestation,
+	extraPCRs []tcglog.PCRIndex) (tcglog.PCRReader, error) {
+	switch {
+	case bundle != nil:
+		values, err := bundle.tpmPCRValues()
+		if err != nil || values == nil {
+			return nil, err
+		}
+		return &pcrReader{values: values}, nil
+	case attestation != nil:
+		return &pcrReader{values: attestation.PCRValues}, nil
+	case tpmPath != "":
+		return &pcrReader{extraPCRs: extraPCRs}, nil
+	}
+	return nil, nil
+}
+
+// logAlgorithms returns the digest algorithms of the log, without replaying it.
+func logAlgorithms(options tcglog.LogOptions) (tcglog.AlgorithmIdList, error) {
+	file, err := os.Open(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	log, err := tcglog.NewLog(file, options)
+	if err != nil {
+		return nil, err
+	}
+	return log.Algorithms, nil
+}
+
+func readIMALog() ([]*tcglog.IMAEvent, error) {
+	var f tcglog.IMALogFormat
+	switch imaLogFormat {
+	case "binary":
+		f = tcglog.IMALogFormatBinary
+	case "ascii":
+		f = tcglog.IMALogFormatASCII
+	default:
+		return nil, fmt.Errorf("unrecognized IMA log format \"%s\"", imaLogFormat)
+	}
+
+	file, err := os.Open(imaLogPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return tcglog.ReadIMALog(file, f, tcglog.AlgorithmSha1)
+}
+
+// imaPCRs returns the PCRs that the supplied IMA events are measured to.
+func imaPCRs(events []*tcglog.IMAEvent) (out []tcglog.PCRIndex) {
+	seen := make(map[tcglog.PCRIndex]bool)
+	for _, e := range events {
+		if !seen[e.PCRIndex] {
+			seen[e.PCRIndex] = true
+			out = append(out, e.PCRIndex)
+		}
+	}
+	return out
+}
+
+// checkIMABootAggregate checks the boot_aggregate entry of the IMA log against the event log.
+func checkIMABootAggregate(events []*tcglog.IMAEvent, options tcglog.LogOptions) error {
+	file, err := os.Open(logPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	log, err := tcglog.NewLog(file, options)
+	if err != nil {
+		return err
+	}
+	return tcglog.CheckIMABootAggregate(events, log)
+}
+
+func verifyQuote(values tcglog.PCRValues) (*tcglog.QuoteVerifyResult, error) {
+	attest, err := ioutil.ReadFile(quotePath)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := ioutil.ReadFile(quoteSigPath)
+	if err != nil {
+		return nil, err
+	}
+	akPublic, err := ioutil.ReadFile(akPublicPath)
+	if err != nil {
+		return nil, err
+	}
+	return tcglog.VerifyQuote(attest, sig, akPublic, values)
+}
+
+// cleanups are run before the process exits.
+var cleanups []func()
+
+func exit(code int) {
+	for _, fn := range cleanups {
+		fn()
+	}
+	os.Exit(code)
+}
+
 func main() {
 	flag.Parse()
+	defer func() {
+		for _, fn := range cleanups {
+			fn()
+		}
+	}()
 
 	args := flag.Args()
 	if len(args) > 0 {
 		fmt.Fprintf(os.Stderr, "Too many arguments\n")
-		os.Exit(1)
+		exit(1)
+	}
+
+	var bundle *captureBundle
+	if replayPath != "" {
+		if capturePath != "" || finalEvtsPath != "" {
+			fmt.Fprintf(os.Stderr, "-replay can't be used with -capture or -final-events-path\n")
+			exit(1)
+		}
+		var err error
+		bundle, err = readCaptureBundle(replayPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot read capture bundle: %v\n", err)
+			exit(1)
+		}
+		cleanups = append(cleanups, func() { os.RemoveAll(bundle.dir) })
+		if err := bundle.applyOptions(); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid capture bundle: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Replaying analysis captured by tcglog-validate %s on %s\n",
+			bundle.manifest.ToolVersion, bundle.manifest.Created.Format(time.RFC3339))
+	}
+
+	switch format {
+	case "text", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "Unrecognized output format \"%s\"\n", format)
+		exit(1)
+	}
+	if templatePath != "" && format != "text" {
+		fmt.Fprintf(os.Stderr, "-template can't be used with -format %s\n", format)
+		exit(1)
 	}
 
-	if !noDefaultPcrs {
+	switch {
+	case noDefaultPcrs || bundle != nil:
+	case isTDXAttestation():
+		pcrs = append(pcrs, tcglog.TDXRTMR0, tcglog.TDXRTMR1, tcglog.TDXRTMR2)
+	default:
 		pcrs = append(pcrs, 0, 1, 2, 3, 4, 5, 6, 7)
 		if withGrub {
 			pcrs = append(pcrs, 8, 9)
@@ -164,39 +403,390 @@ func main() {
 
 	sort.SliceStable(pcrs, func(i, j int) bool { return pcrs[i] < pcrs[j] })
 
-	if logPath == "" {
-		if filepath.Dir(tpmPath) != "/dev" {
+	if quotePath != "" && (quoteSigPath == "" || akPublicPath == "") {
+		fmt.Fprintf(os.Stderr, "-quote-signature and -ak-public must be specified with -quote\n")
+		exit(1)
+	}
+
+	var attestation *tcglog.CloudAttestation
+	if attestSpec != "" {
+		if bundle != nil || quotePath != "" {
+			fmt.Fprintf(os.Stderr, "-attestation can't be used with -replay or -quote\n")
+			exit(1)
+		}
+		var err error
+		attestation, err = readCloudAttestation(attestSpec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot read attestation document: %v\n", err)
+			exit(1)
+		}
+		if len(attestation.Quotes) > 0 {
+			if err := attestation.VerifyQuotes(); err != nil {
+				fmt.Fprintf(os.Stderr, "Cannot verify attestation document: %v\n", err)
+				exit(1)
+			}
+		} else if isTDXAttestation() {
+			fmt.Fprintf(os.Stderr, "Warning: the signature of the TD quote isn't verified, so its RTMR values are "+
+				"not authenticated\n")
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: the attestation document doesn't contain a quote, so its PCR values "+
+				"are not authenticated\n")
+		}
+		if logPath == "" {
+			if len(attestation.EventLog) == 0 {
+				fmt.Fprintf(os.Stderr, "-log-path must be specified when the attestation document doesn't "+
+					"contain an event log\n")
+				exit(1)
+			}
+			logPath, err = writeAttestationLog(attestation)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Cannot write event log from attestation document: %v\n", err)
+				exit(1)
+			}
+			path := logPath
+			cleanups = append(cleanups, func() { os.Remove(path) })
+		}
+	}
+
+	explicitTCTI := tctiSpec != ""
+	if !explicitTCTI {
+		tctiSpec = "device:" + tpmPath
+	}
+
+	if bundle != nil || attestation != nil {
+		// PCR values are taken from the bundle or attestation document rather than the TPM.
+		tpmPath = ""
+	} else if logPath == "" {
+		devPath, isDevice := tctiDevicePath(tctiSpec)
+		if !isDevice {
+			fmt.Fprintf(os.Stderr, "-log-path must be specified when not using a TPM device\n")
+			exit(1)
+		}
+		if filepath.Dir(devPath) != "/dev" {
 			fmt.Fprintf(os.Stderr, "Expected TPM path to be a device node in /dev")
-			os.Exit(1)
+			exit(1)
 		}
-		logPath = fmt.Sprintf("/sys/kernel/security/%s/binary_bios_measurements", filepath.Base(tpmPath))
-	} else {
+		logPath = fmt.Sprintf("/sys/kernel/security/%s/binary_bios_measurements", tpmDeviceName(devPath))
+	} else if !explicitTCTI {
+		tpmPath = ""
+	}
+	if quotePath != "" {
 		tpmPath = ""
 	}
 
-	result, err := tcglog.ReplayAndValidateLog(logPath, tcglog.LogOptions{EnableGrub: withGrub, EnableSystemdEFIStub: withSdEfiStub, SystemdEFIStubPCR: tcglog.PCRIndex(sdEfiStubPcr)})
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to replay and validate log file: %v\n", err)
-		os.Exit(1)
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		cleanups = append(cleanups, cancel)
+	}
+
+	logOptions := tcglog.LogOptions{EnableGrub: withGrub, EnableSystemdEFIStub: withSdEfiStub, SystemdEFIStubPCR: tcglog.PCRIndex(sdEfiStubPcr)}
+
+	selectedPCRs := append([]tcglog.PCRIndex(nil), pcrs...)
+
+	var imaEvents []*tcglog.IMAEvent
+	if imaLogPath != "" {
+		var err error
+		imaEvents, err = readIMALog()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read IMA log: %v\n", err)
+			exit(1)
+		}
+	}
+
+	if len(algorithms) == 0 && attestation != nil {
+		// Only check the banks that the attestation document has values for.
+		logAlgs, err := logAlgorithms(logOptions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read log file: %v\n", err)
+			exit(1)
+		}
+		algorithms = attestationAlgorithms(attestation, logAlgs)
+		if len(algorithms) == 0 {
+			fmt.Fprintf(os.Stderr, "Attestation document doesn't contain PCR values for any of the "+
+				"algorithms in the log\n")
+			exit(1)
+		}
+	}
+
+	var result *tcglog.LogValidateResult
+	var tpmPCRValues map[tcglog.PCRIndex]tcglog.DigestMap
+	var findings []tcglog.Finding
+	var err error
+	if isTDXAttestation() {
+		// SelfCheck doesn't support CC event logs, so the log is replayed and checked against the RTMR values
+		// from the quote here.
+		if finalEvtsPath != "" {
+			fmt.Fprintf(os.Stderr, "-final-events-path can't be used with a TDX quote\n")
+			exit(1)
+		}
+		result, err = tcglog.ReplayAndValidateCCEventLog(logPath, logOptions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to replay and validate log file: %v\n", err)
+			exit(1)
+		}
+		for _, alg := range algorithms {
+			if !result.Algorithms.Contains(alg) {
+				fmt.Fprintf(os.Stderr, "Log doesn't contain entries for %s algorithm", alg)
+				exit(1)
+			}
+		}
+		tpmPCRValues = attestation.PCRValues
+		findings = tcglog.FindingsFromResult(result, strictUTF16)
+		if auditDigests {
+			findings = append(findings, tcglog.DigestAuditFindings(result)...)
+		}
+		findings = append(findings, pcrMismatchFindings(result, pcrs, tcglog.AlgorithmIdList(algorithms),
+			tpmPCRValues)...)
+	} else {
+		reader, err := newPCRReader(bundle, attestation, imaPCRs(imaEvents))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid capture bundle: %v\n", err)
+			exit(1)
+		}
+		report, err := tcglog.SelfCheck(ctx, tcglog.SelfCheckOptions{
+			LogOptions:      logOptions,
+			LogPath:         logPath,
+			PCRs:            selectedPCRs,
+			Algorithms:      tcglog.AlgorithmIdList(algorithms),
+			PCRReader:       reader,
+			StrictUTF16:     strictUTF16,
+			FinalEventsPath: finalEvtsPath,
+			AuditDigests:    auditDigests})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to check log file: %v\n", err)
+			exit(1)
+		}
+		result = report.Result
+		tpmPCRValues = report.TPMPCRValues
+		findings = report.Findings
+	}
+	if result.ExpectedPCRValuesWithFinalEvents != nil {
+		// The events in the final events table were measured after the log was retrieved, so the TPM is compared
+		// with the values after them.
+		fmt.Fprintf(os.Stderr, "Merged %d events from the final events table (skipped %d that are already in the "+
+			"log)\n", len(result.FinalEvents), result.DuplicateFinalEvents)
+		result.ExpectedPCRValues = result.ExpectedPCRValuesWithFinalEvents
+	}
+
+	if requireOS {
+		if err := result.ExitBootServices.RequireOSPresent(); err != nil {
+			fmt.Fprintf(os.Stderr, "The log doesn't show that the OS is present: %v\n", err)
+			exit(1)
+		}
 	}
 
 	if len(algorithms) == 0 {
 		algorithms = AlgorithmIdArgList(result.Algorithms)
 	}
-	for _, alg := range algorithms {
-		if !result.Algorithms.Contains(alg) {
-			fmt.Fprintf(os.Stderr, "Log doesn't contain entries for %s algorithm", alg)
-			os.Exit(1)
+
+	var imaResult *tcglog.IMAValidateResult
+	var imaBootAggregateErr error
+	if imaLogPath != "" {
+		imaResult = tcglog.ReplayAndValidateIMALog(imaEvents, tcglog.AlgorithmSha1, tcglog.AlgorithmIdList(algorithms))
+		if !isTDXAttestation() {
+			imaBootAggregateErr = checkIMABootAggregate(imaEvents, logOptions)
+		}
+		for i, values := range imaResult.ExpectedPCRValues {
+			if _, exists := result.ExpectedPCRValues[i]; exists {
+				fmt.Fprintf(os.Stderr, "IMA log measures to PCR %d, which is also used by the event log\n", i)
+				exit(1)
+			}
+			result.ExpectedPCRValues[i] = values
+			pcrs = append(pcrs, i)
+		}
+		sort.SliceStable(pcrs, func(i, j int) bool { return pcrs[i] < pcrs[j] })
+		findings = append(findings, pcrMismatchFindings(result, imaPCRs(imaEvents), tcglog.AlgorithmIdList(algorithms),
+			tpmPCRValues)...)
+	}
+
+	var quoteResult *tcglog.QuoteVerifyResult
+	if quotePath != "" {
+		quoteResult, err = verifyQuote(result.ExpectedPCRValues)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot verify quote: %v\n", err)
+			exit(1)
+		}
+	}
+
+	var clockReport *tpmClockReport
+	if checkClock {
+		if bundle != nil || attestation != nil || tpmPath == "" {
+			fmt.Fprintf(os.Stderr, "-check-tpm-clock can only be used when reading PCR values from a TPM\n")
+			exit(1)
 		}
+		clockReport, err = checkTPMClock(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot check TPM clock: %v\n", err)
+			exit(1)
+		}
+	}
+
+	switch {
+	case bundle != nil && tpmPCRValues != nil:
+		tpmPath = replayPath
+	case attestation != nil:
+		tpmPath = attestSpec
+	}
+
+	var divergences []*tcglog.PCRDivergence
+	if bisectPath != "" {
+		divergences, err = bisectAgainstReference(result, bisectPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot compare log with reference report: %v\n", err)
+			exit(1)
+		}
+	}
+
+	var referenceDiffs []*tcglog.ReferencePCRDiff
+	if referencePath != "" {
+		referenceDiffs, err = compareWithReference(result, referencePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot compare log with reference file: %v\n", err)
+			exit(1)
+		}
+	}
+
+	var kernelFindings []tcglog.Finding
+	if dmesgPath != "" {
+		kernelFindings, err = correlateKernelLog(findings)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot read kernel log: %v\n", err)
+			exit(1)
+		}
+	}
+
+	if saveRefPath != "" {
+		if err := saveReference(result, saveRefPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write reference file: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote reference file to %s\n", saveRefPath)
+	}
+
+	if capturePath != "" {
+		if err := writeCaptureBundle(ctx, capturePath, selectedPCRs, tpmPCRValues); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write capture bundle: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote capture bundle to %s\n", capturePath)
+	}
+
+	if templatePath != "" {
+		report := &templateReport{
+			Result:       result,
+			Findings:     findings,
+			PCRs:         pcrs,
+			Algorithms:   tcglog.AlgorithmIdList(algorithms),
+			TPMPCRValues: tpmPCRValues,
+			IMA:          imaResult,
+			Quote:        quoteResult,
+
+			KernelFindings: kernelFindings,
+			TPMClock:       clockReport}
+		if err := writeTemplateReport(os.Stdout, templatePath, report); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot render report template: %v\n", err)
+			exit(1)
+		}
+		return
+	}
+
+	if format == "json" {
+		if err := writeJSONReport(os.Stdout, result, tpmPCRValues, quoteResult, divergences, referenceDiffs,
+			kernelFindings, clockReport); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write JSON report: %v\n", err)
+			exit(1)
+		}
+		return
 	}
 
 	if result.EfiBootVariableBehaviour == tcglog.EFIBootVariableBehaviourVarDataOnly {
 		fmt.Printf("- EV_EFI_VARIABLE_BOOT events only contain measurement of variable data rather than the entire UEFI_VARIABLE_DATA structure\n\n")
 	}
 
+	if result.Startup.Sequence != tcglog.StartupSequenceLocality0 {
+		fmt.Printf("- PCR 0 was initialized by a %s\n", result.Startup.Sequence)
+	}
+	for _, p := range result.Startup.Problems {
+		fmt.Printf("- Startup sequence inconsistency: %s\n", p)
+	}
+	if result.Startup.Sequence != tcglog.StartupSequenceLocality0 || len(result.Startup.Problems) > 0 {
+		fmt.Printf("\n")
+	}
+
+	if segments, err := result.BootSegments(); err == nil && len(segments) > 1 {
+		fmt.Printf("- The log contains measurements from %d boots (eg, because a kernel started with kexec "+
+			"appended its own measurements):\n", len(segments))
+		for i, seg := range segments {
+			fmt.Printf("  - Segment %d (%s): %d events, PCRs reset: %t\n", i, seg.Start, len(seg.Events),
+				seg.Reset)
+		}
+		fmt.Printf("\n")
+	}
+
+	if result.ExitBootServices.Outcome == tcglog.ExitBootServicesFailed {
+		fmt.Printf("- %v, so the platform didn't transition to the OS\n", result.ExitBootServices.RequireOSPresent())
+	}
+	for _, p := range result.ExitBootServices.Problems {
+		fmt.Printf("- ExitBootServices event inconsistency: %s\n", p)
+	}
+	if result.ExitBootServices.Outcome == tcglog.ExitBootServicesFailed || len(result.ExitBootServices.Problems) > 0 {
+		fmt.Printf("\n")
+	}
+
+	if imaBootAggregateErr != nil {
+		fmt.Printf("- The IMA log's boot_aggregate can't be verified against the log: %v\n\n", imaBootAggregateErr)
+	}
+
+	if imaResult != nil && len(imaResult.IncorrectTemplateDigests) > 0 {
+		fmt.Printf("- The following IMA log entries have template digests that aren't generated from their " +
+			"template data:\n")
+		for _, e := range imaResult.IncorrectTemplateDigests {
+			fmt.Printf("  - %s (template digest: %x)\n", e, e.TemplateDigest)
+		}
+		fmt.Printf("\n")
+	}
+
+	seenInconsistentLengths := false
+	for _, e := range result.ValidatedEvents {
+		i := tcglog.CheckInternalLengths(e.Event)
+		if i == nil {
+			continue
+		}
+
+		if !seenInconsistentLengths {
+			seenInconsistentLengths = true
+			fmt.Printf("- The following events have internal lengths that are inconsistent with the size of " +
+				"their event data:\n")
+		}
+		fmt.Printf("  - Event %d in PCR %d (type: %s): %s\n", e.Event.Index, e.Event.PCRIndex,
+			e.Event.EventType, i)
+	}
+	if seenInconsistentLengths {
+		fmt.Printf("\n")
+	}
+
+	if strictUTF16 {
+		seenMalformedUTF16 := false
+		for _, e := range result.ValidatedEvents {
+			for _, p := range tcglog.CheckUTF16Strings(e.Event) {
+				if !seenMalformedUTF16 {
+					seenMalformedUTF16 = true
+					fmt.Printf("- The following events contain strings that aren't well-formed UTF-16:\n")
+				}
+				fmt.Printf("  - Event %d in PCR %d (type: %s): %s\n", e.Event.Index, e.Event.PCRIndex,
+					e.Event.EventType, p)
+			}
+		}
+		if seenMalformedUTF16 {
+			fmt.Printf("\n")
+		}
+	}
+
 	seenTrailingMeasuredBytes := false
 	for _, e := range result.ValidatedEvents {
-		if e.MeasuredTrailingBytesCount == 0 {
+		if !e.HasTrailingMeasuredBytes() {
 			continue
 		}
 
@@ -207,8 +797,7 @@ func main() {
 		}
 
 		fmt.Printf("  - Event %d in PCR %d (type: %s): %x (%d bytes)\n", e.Event.Index, e.Event.PCRIndex,
-			e.Event.EventType, e.MeasuredBytes[len(e.MeasuredBytes)-e.MeasuredTrailingBytesCount:len(e.MeasuredBytes)],
-			e.MeasuredTrailingBytesCount)
+			e.Event.EventType, e.TrailingBytes(), e.MeasuredTrailingBytesCount)
 	}
 	if seenTrailingMeasuredBytes {
 		fmt.Printf("  This trailing bytes should be taken in to account when calculating updated " +
@@ -231,7 +820,7 @@ func main() {
 		for _, v := range e.IncorrectDigestValues {
 			fmt.Printf("  - Event %d in PCR %d (type: %s, alg: %s) - expected (from data): %x, "+
 				"got: %x\n", e.Event.Index, e.Event.PCRIndex, e.Event.EventType, v.Algorithm,
-				v.Expected, e.Event.Digests[v.Algorithm])
+				v.Expected, e.Event.Digests.Get(v.Algorithm))
 		}
 	}
 	if seenIncorrectDigests {
@@ -240,6 +829,154 @@ func main() {
 			"when the components being measured are upgraded or changed in some way.\n\n")
 	}
 
+	if auditDigests {
+		seenMismatches := false
+		for _, e := range result.ValidatedEvents {
+			for _, m := range tcglog.AuditEventDigests(e) {
+				if !seenMismatches {
+					seenMismatches = true
+					fmt.Printf("- The following events have digests that were computed with a different " +
+						"algorithm to the one they were recorded for:\n")
+				}
+				fmt.Printf("  - Event %d in PCR %d (type: %s): %s\n", e.Event.Index, e.Event.PCRIndex,
+					e.Event.EventType, m)
+			}
+		}
+		if seenMismatches {
+			fmt.Printf("  This is a firmware bug. The affected PCR banks can't be predicted from the " +
+				"components being measured.\n\n")
+		}
+	}
+
+	var events []*tcglog.Event
+	for _, e := range result.ValidatedEvents {
+		events = append(events, e.Event)
+	}
+	if firmwareErrors := tcglog.FindFirmwareErrors(events); len(firmwareErrors) > 0 {
+		fmt.Printf("- The platform reported a measurement error during boot, so the log may not be a " +
+			"complete record of what was measured:\n")
+		for _, e := range firmwareErrors {
+			fmt.Printf("  - %s\n", e)
+		}
+		fmt.Printf("\n")
+	}
+
+	if entries := tcglog.DetectFirmwareUIEntry(events); len(entries) > 0 {
+		fmt.Printf("- The user interacted with the firmware during boot, so the values of PCRs 1, 4 and 7 may " +
+			"differ from those of a normal boot:\n")
+		for _, e := range entries {
+			fmt.Printf("  - %s\n", e)
+		}
+		fmt.Printf("\n")
+	}
+
+	if updates := tcglog.DetectCapsuleUpdates(events); len(updates) > 0 {
+		fmt.Printf("- A firmware update was processed during boot, so the values of PCRs 0 and 2 will differ " +
+			"on the next boot:\n")
+		for _, e := range updates {
+			fmt.Printf("  - %s\n", e)
+		}
+		fmt.Printf("\n")
+	}
+
+	seenSeparatorIssue := false
+	for i := tcglog.PCRIndex(0); i < 8; i++ {
+		status := result.Separators[i]
+		var issue string
+		switch {
+		case !status.Present():
+			issue = "no EV_SEPARATOR event"
+		case status.Duplicated():
+			issue = fmt.Sprintf("%d EV_SEPARATOR events", len(status.Events))
+		case status.IsError:
+			issue = fmt.Sprintf("EV_SEPARATOR event signals a pre-OS error (error info: %x)", status.ErrorInfo())
+		default:
+			continue
+		}
+
+		if !seenSeparatorIssue {
+			seenSeparatorIssue = true
+			fmt.Printf("- The following PCRs don't have a single, successful EV_SEPARATOR event:\n")
+		}
+		fmt.Printf("  - PCR %d: %s\n", i, issue)
+	}
+	if seenSeparatorIssue {
+		fmt.Printf("\n")
+	}
+
+	if bisectPath != "" {
+		if len(divergences) == 0 {
+			fmt.Printf("- The log is consistent with the reference boot in %s\n\n", bisectPath)
+		} else {
+			fmt.Printf("- The log diverges from the reference boot in %s for some PCRs:\n", bisectPath)
+			for _, d := range divergences {
+				printDivergence(d)
+			}
+			fmt.Printf("\n")
+		}
+	}
+
+	if referencePath != "" {
+		if len(referenceDiffs) == 0 {
+			fmt.Printf("- The log matches the reference file %s\n\n", referencePath)
+		} else {
+			fmt.Printf("- The log differs from the reference file %s for some PCRs:\n", referencePath)
+			for _, d := range referenceDiffs {
+				printReferenceDiff(d)
+			}
+			fmt.Printf("\n")
+		}
+	}
+
+	if dmesgPath != "" {
+		if len(kernelFindings) == 0 {
+			fmt.Printf("- The kernel log %s doesn't contain any TPM errors\n\n", dmesgPath)
+		} else {
+			fmt.Printf("- The kernel log %s contains TPM related messages:\n", dmesgPath)
+			for _, f := range kernelFindings {
+				fmt.Printf("  - [%s] %s: %s\n", f.Severity, f.Kind.Code(), f.Description)
+			}
+			fmt.Printf("\n")
+		}
+	}
+
+	if clockReport != nil {
+		fmt.Printf("- TPM clock: %s since the TPM was last started (system uptime: %s), reset count: %d, "+
+			"restart count: %d\n", clockReport.Info.TimeSinceStartup().Round(time.Second),
+			clockReport.Uptime.Round(time.Second), clockReport.Info.ResetCount, clockReport.Info.RestartCount)
+		if len(clockReport.Findings) == 0 {
+			fmt.Printf("  - The TPM hasn't been reset or restarted since the OS booted\n")
+		}
+		for _, f := range clockReport.Findings {
+			fmt.Printf("  - [%s] %s: %s\n", f.Severity, f.Kind.Code(), f.Description)
+		}
+		fmt.Printf("\n")
+	}
+
+	fmt.Printf("- PCR trust classification (whether each PCR is suitable for sealing against on this platform):\n")
+	for _, c := range result.ClassifyPCRTrust(pcrs, tpmPCRValues) {
+		fmt.Printf("  - PCR %d: %s\n", c.PCR, c.Trust)
+		for _, r := range c.Reasons {
+			fmt.Printf("    - %s\n", r)
+		}
+	}
+	fmt.Printf("\n")
+
+	if quoteResult != nil {
+		var selection []string
+		for _, s := range quoteResult.Quote.PCRSelection {
+			selection = append(selection, fmt.Sprintf("%s:%v", s.Algorithm, s.PCRs))
+		}
+		fmt.Printf("- The quote signature is valid (PCR selection: %s, extra data: %x)\n",
+			strings.Join(selection, " "), quoteResult.Quote.ExtraData)
+		if !quoteResult.Consistent() {
+			fmt.Printf("- The log is not consistent with the quote - PCR digest from quote: %x, expected "+
+				"PCR digest from log: %x\n", quoteResult.Quote.PCRDigest, quoteResult.ExpectedPCRDigest)
+			fmt.Printf("*** The event log is broken! ***\n")
+		}
+		return
+	}
+
 	if tpmPath == "" {
 		fmt.Printf("- Expected PCR values from log:\n")
 		for _, i := range pcrs {
@@ -250,12 +987,6 @@ func main() {
 		return
 	}
 
-	tpmPCRValues, err := readPCRs()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Cannot read PCR values from TPM: %v", err)
-		os.Exit(1)
-	}
-
 	seenLogConsistencyError := false
 	for _, i := range pcrs {
 		for _, alg := range algorithms {
@@ -269,6 +1000,10 @@ func main() {
 			}
 			fmt.Printf("  - PCR %d, bank %s - actual PCR value: %x, expected PCR value from log: %x\n",
 				i, alg, tpmPCRValues[i][alg], result.ExpectedPCRValues[i][alg])
+			if e := result.LastEventWithPCRValue(i, alg, tpmPCRValues[i][alg]); e != nil {
+				fmt.Printf("    The actual PCR value matches the value after event %d (type: %s), so the log "+
+					"diverges from what was measured after this event\n", e.Event.Index, e.Event.EventType)
+			}
 		}
 	}
 
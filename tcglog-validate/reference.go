@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+// readReferenceKey reads the PEM encoded key specified with -reference-key. This is a PKCS #8 Ed25519 private key
+// when writing a reference file with -save-reference, and a PKIX Ed25519 public key when comparing with -reference.
+func readReferenceKey(path string) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := key.(ed25519.PrivateKey); !ok {
+			return nil, errors.New("private key is not an Ed25519 key")
+		}
+		return key, nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := key.(ed25519.PublicKey); !ok {
+			return nil, errors.New("public key is not an Ed25519 key")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unexpected PEM block type (%s)", block.Type)
+	}
+}
+
+// saveReference writes the selected PCRs and algorithms of result to the reference file specified with
+// -save-reference, signing it if -reference-key specifies a private key.
+func saveReference(result *tcglog.LogValidateResult, path string) error {
+	var key ed25519.PrivateKey
+	if refKeyPath != "" {
+		k, err := readReferenceKey(refKeyPath)
+		if err != nil {
+			return fmt.Errorf("cannot read key: %v", err)
+		}
+		var ok bool
+		if key, ok = k.(ed25519.PrivateKey); !ok {
+			return errors.New("a private key is required to sign a reference file")
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ref := tcglog.NewReferenceValues(result, pcrs, tcglog.AlgorithmIdList(algorithms))
+	if err := ref.Write(f, key); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// compareWithReference compares result with the reference file specified with -reference, and returns the PCRs
+// that differ from it. If -reference-key specifies a public key, the reference file must be signed with the
+// corresponding private key.
+func compareWithReference(result *tcglog.LogValidateResult, path string) ([]*tcglog.ReferencePCRDiff, error) {
+	var key ed25519.PublicKey
+	if refKeyPath != "" {
+		k, err := readReferenceKey(refKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read key: %v", err)
+		}
+		var ok bool
+		if key, ok = k.(ed25519.PublicKey); !ok {
+			return nil, errors.New("a public key is required to verify a reference file")
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ref, err := tcglog.ReadReferenceValues(f, key)
+	if err != nil {
+		return nil, err
+	}
+	return ref.Compare(result), nil
+}
+
+func printReferenceDiff(d *tcglog.ReferencePCRDiff) {
+	if d.Diverges {
+		fmt.Printf("  - PCR %d: the expected value differs from the reference value\n", d.PCR)
+	} else {
+		fmt.Printf("  - PCR %d: the expected value matches the reference value\n", d.PCR)
+	}
+	for _, c := range d.Changes {
+		fmt.Printf("    - %s\n", c)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/chrisccoulson/go-tpm2"
+)
+
+const (
+	mssimSendCommand uint32 = 8  // TPM_SEND_COMMAND
+	mssimSessionEnd  uint32 = 20 // TPM_SESSION_END
+	mssimDefaultPort        = "2321"
+	mssimDefaultHost        = "localhost"
+)
+
+// mssimTCTI is a TCTI implementation for the TPM command interface of the Microsoft TPM2 simulator, which is also
+// implemented by swtpm when it is started with a TCP or UNIX socket server.
+type mssimTCTI struct {
+	conn net.Conn
+	rsp  *bytes.Reader
+}
+
+func (t *mssimTCTI) Write(data []byte) (int, error) {
+	var hdr [9]byte
+	binary.BigEndian.PutUint32(hdr[0:], mssimSendCommand)
+	hdr[4] = 0 // locality
+	binary.BigEndian.PutUint32(hdr[5:], uint32(len(data)))
+	if _, err := t.conn.Write(append(hdr[:], data...)); err != nil {
+		return 0, err
+	}
+
+	var size uint32
+	if err := binary.Read(t.conn, binary.BigEndian, &size); err != nil {
+		return 0, fmt.Errorf("cannot read response size: %v", err)
+	}
+	rsp := make([]byte, size)
+	if _, err := io.ReadFull(t.conn, rsp); err != nil {
+		return 0, fmt.Errorf("cannot read response: %v", err)
+	}
+	var ack uint32
+	if err := binary.Read(t.conn, binary.BigEndian, &ack); err != nil {
+		return 0, fmt.Errorf("cannot read acknowledgement: %v", err)
+	}
+	if ack != 0 {
+		return 0, fmt.Errorf("simulator returned an error (%d)", ack)
+	}
+
+	t.rsp = bytes.NewReader(rsp)
+	return len(data), nil
+}
+
+func (t *mssimTCTI) Read(data []byte) (int, error) {
+	if t.rsp == nil {
+		return 0, io.EOF
+	}
+	return t.rsp.Read(data)
+}
+
+func (t *mssimTCTI) Close() error {
+	binary.Write(t.conn, binary.BigEndian, mssimSessionEnd)
+	return t.conn.Close()
+}
+
+func dialMssimTCTI(ctx context.Context, network, address string) (*mssimTCTI, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return &mssimTCTI{conn: conn}, nil
+}
+
+// parseTCTI parses a TCTI specification of the form "<type>:<config>", where type is one of:
+//   - device: config is the path of a TPM character device, eg, /dev/tpm0 or /dev/tpmrm0
+//   - mssim: config is the host and port of the TPM command interface of the Microsoft TPM2 simulator (defaults to
+//     localhost:2321)
+//   - swtpm: config is the path of the UNIX socket of a swtpm instance
+//
+// A specification without a type is assumed to be the path of a device.
+func parseTCTI(spec string) (kind, config string) {
+	if !strings.Contains(spec, ":") {
+		return "device", spec
+	}
+	parts := strings.SplitN(spec, ":", 2)
+	return parts[0], parts[1]
+}
+
+// tctiDevicePath returns the path of the TPM device node for the supplied TCTI specification, or false if it doesn't
+// refer to a device.
+func tctiDevicePath(spec string) (string, bool) {
+	kind, config := parseTCTI(spec)
+	if kind != "device" {
+		return "", false
+	}
+	return config, true
+}
+
+// tpmDeviceName returns the name of the TPM associated with the supplied device node, as used in securityfs. The
+// kernel resource manager device (tpmrmN) is associated with tpmN.
+func tpmDeviceName(path string) string {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, "tpmrm") {
+		name = "tpm" + strings.TrimPrefix(name, "tpmrm")
+	}
+	return name
+}
+
+// openTCTI opens the TPM interface described by spec. For the socket based interfaces, connecting and every command
+// are subject to the deadline of ctx, if it has one.
+func openTCTI(ctx context.Context, spec string) (tpm2.TCTI, error) {
+	kind, config := parseTCTI(spec)
+	switch kind {
+	case "device":
+		tcti, err := tpm2.OpenTPMDevice(config)
+		if err != nil {
+			return nil, err
+		}
+		return tcti, nil
+	case "mssim":
+		host, port := mssimDefaultHost, mssimDefaultPort
+		if config != "" {
+			if strings.Contains(config, ":") {
+				var err error
+				host, port, err = net.SplitHostPort(config)
+				if err != nil {
+					return nil, fmt.Errorf("invalid simulator address: %v", err)
+				}
+			} else {
+				host = config
+			}
+		}
+		return dialMssimTCTI(ctx, "tcp", net.JoinHostPort(host, port))
+	case "swtpm":
+		if config == "" {
+			return nil, errors.New("missing swtpm socket path")
+		}
+		return dialMssimTCTI(ctx, "unix", config)
+	default:
+		return nil, fmt.Errorf("unrecognized TCTI type \"%s\"", kind)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"sort"
+
+	"github.com/chrisccoulson/tcglog-parser"
+)
+
+// templateReport is the data supplied to templates specified with -template.
+type templateReport struct {
+	Result       *tcglog.LogValidateResult
+	Findings     []tcglog.Finding // Findings in descending order of severity
+	PCRs         []tcglog.PCRIndex
+	Algorithms   tcglog.AlgorithmIdList
+	TPMPCRValues map[tcglog.PCRIndex]tcglog.DigestMap // PCR values read from the TPM, if any
+	IMA          *tcglog.IMAValidateResult            // The result of validating the IMA log, if any
+	Quote        *tcglog.QuoteVerifyResult            // The result of verifying the quote, if any
+
+	// KernelFindings are the findings from correlating the kernel log supplied with -dmesg, if any.
+	KernelFindings []tcglog.Finding
+
+	// TPMClock is the clock information read from the TPM with -check-tpm-clock, if any.
+	TPMClock *tpmClockReport
+}
+
+// reportEnvironment returns the environment that templates are rendered in, which doesn't depend on the host when
+// -reproducible is specified.
+func reportEnvironment() tcglog.ReportEnvironment {
+	if reproducible {
+		return tcglog.ReproducibleReportEnvironment
+	}
+	return tcglog.ReportEnvironment{}
+}
+
+func writeTemplateReport(w io.Writer, path string, report *templateReport) error {
+	tmpl, err := tcglog.ParseReportTemplateFileWithEnvironment(path, reportEnvironment())
+	if err != nil {
+		return err
+	}
+
+	report.Findings = append(report.Findings, report.KernelFindings...)
+	if report.TPMClock != nil {
+		report.Findings = append(report.Findings, report.TPMClock.Findings...)
+	}
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return report.Findings[i].Severity > report.Findings[j].Severity
+	})
+
+	return tmpl.Execute(w, report)
+}
@@ -0,0 +1,162 @@
+package tcglog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// The measurement registers of an Intel TDX guest, identified by their index in a confidential computing (CC) event
+// log. A CC event log has the same format as a crypto-agile TCG log, but the PCR index of each event is the index of
+// the measurement register (CC_EVENT.MrIndex) that it was extended to. MRTD is measured by the TDX module when the TD
+// is built, so it isn't extended by any events in the log.
+const (
+	TDXMRTD  PCRIndex = 0
+	TDXRTMR0 PCRIndex = 1
+	TDXRTMR1 PCRIndex = 2
+	TDXRTMR2 PCRIndex = 3
+	TDXRTMR3 PCRIndex = 4
+)
+
+// TDXRegisterName returns the name of the TDX measurement register with the specified index in a CC event log (eg,
+// "RTMR0").
+func TDXRegisterName(index PCRIndex) string {
+	switch {
+	case index == TDXMRTD:
+		return "MRTD"
+	case index >= TDXRTMR0 && index <= TDXRTMR3:
+		return fmt.Sprintf("RTMR%d", index-TDXRTMR0)
+	default:
+		return fmt.Sprintf("MR%d", index)
+	}
+}
+
+// TDXRegisterForPCR returns the index of the TDX measurement register that UEFI firmware (eg, TDVF) measures to in
+// place of the specified PCR, as defined by EFI_CC_MEASUREMENT_PROTOCOL. It returns false if the PCR isn't mapped to a
+// measurement register.
+func TDXRegisterForPCR(pcr PCRIndex) (PCRIndex, bool) {
+	switch {
+	case pcr == 0:
+		return TDXMRTD, true
+	case pcr == 1 || pcr == 7:
+		return TDXRTMR0, true
+	case pcr >= 2 && pcr <= 6:
+		return TDXRTMR1, true
+	case pcr >= 8 && pcr <= 15:
+		return TDXRTMR2, true
+	default:
+		return 0, false
+	}
+}
+
+// NewCCEventLog creates a new Log instance that reads a confidential computing event log from a fixed size log area
+// of the specified size, such as the area advertised by the ACPI CCEL table (see DecodeACPILogArea), which Linux
+// exposes as /sys/firmware/acpi/tables/data/CCEL. The PCR index of each event is the index of a measurement register
+// (see TDXRegisterName).
+func NewCCEventLog(r io.ReaderAt, size int64, options LogOptions) (*Log, error) {
+	log, err := NewLogFromArea(r, size, options)
+	if err != nil {
+		return nil, err
+	}
+	if log.Spec != SpecEFI_2 {
+		return nil, errors.New("log is not a crypto-agile log")
+	}
+	return log, nil
+}
+
+// ReplayAndValidateCCEventLog is like ReplayAndValidateLog, but reads a confidential computing event log from the log
+// area at logPath (see NewCCEventLog). The expected values in the result are those of the measurement registers that
+// are extended by the log, which start from zero, and they are indexed by measurement register rather than PCR. The
+// analysis of separators, the startup locality and ExitBootServices in the result assumes that the log is indexed by
+// PCR, and doesn't apply to these logs.
+func ReplayAndValidateCCEventLog(logPath string, options LogOptions) (*LogValidateResult, error) {
+	return replayAndValidateLogArea(logPath, options, NewCCEventLog, nil)
+}
+
+// https://download.01.org/intel-sgx/latest/dcap-latest/linux/docs/Intel_TDX_DCAP_Quoting_Library_API.pdf
+//  (appendix A.3 "Version 4 Quote Format" and appendix A.4 "Version 5 Quote Format")
+const (
+	tdxQuoteHeaderSize = 48
+	tdxQuoteTEETypeTDX = 0x00000081
+
+	tdxQuoteBodyTypeTD10 = 2
+	tdxQuoteBodyTypeTD15 = 3
+
+	tdxReportBodyMRTDOffset       = 136
+	tdxReportBodyRTMROffset       = 328
+	tdxReportBodyReportDataOffset = 520
+	tdxReportBodyMinimumSize      = 584
+	tdxMeasurementSize            = 48
+)
+
+// TDXQuote contains the measurements from the TD report in a TDX quote.
+//
+// The measurements are copied from the quote as they are. The signature of the quote isn't verified, which requires
+// the quote verification collateral from Intel, so they should only be trusted once the quote has been verified
+// separately (eg, with the Intel DCAP quote verification library).
+type TDXQuote struct {
+	MRTD       Digest    // The measurement of the initial contents of the TD
+	RTMRs      [4]Digest // The runtime measurement registers, RTMR0 to RTMR3
+	ReportData []byte    // The data supplied by the TD when the quote was generated, eg, a nonce
+}
+
+// ReadTDXQuote reads a version 4 or 5 TDX quote, as returned by the Linux configfs-tsm interface or the TDX quote
+// generation service.
+func ReadTDXQuote(r io.Reader) (*TDXQuote, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < tdxQuoteHeaderSize {
+		return nil, errors.New("quote is too short for a quote header")
+	}
+
+	version := binary.LittleEndian.Uint16(data[0:])
+	if teeType := binary.LittleEndian.Uint32(data[4:]); teeType != tdxQuoteTEETypeTDX {
+		return nil, fmt.Errorf("quote is not a TDX quote (TEE type: 0x%08x)", teeType)
+	}
+
+	body := data[tdxQuoteHeaderSize:]
+	switch version {
+	case 4:
+	case 5:
+		if len(body) < 6 {
+			return nil, errors.New("quote is too short for a quote body descriptor")
+		}
+		bodyType := binary.LittleEndian.Uint16(body[0:])
+		bodySize := binary.LittleEndian.Uint32(body[2:])
+		if bodyType != tdxQuoteBodyTypeTD10 && bodyType != tdxQuoteBodyTypeTD15 {
+			return nil, fmt.Errorf("quote body is not a TD report (type: %d)", bodyType)
+		}
+		body = body[6:]
+		if uint64(bodySize) < tdxReportBodyMinimumSize || uint64(bodySize) > uint64(len(body)) {
+			return nil, fmt.Errorf("invalid quote body size (%d bytes)", bodySize)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported quote version %d", version)
+	}
+	if len(body) < tdxReportBodyMinimumSize {
+		return nil, errors.New("quote is too short for a TD report")
+	}
+
+	quote := &TDXQuote{
+		MRTD:       Digest(body[tdxReportBodyMRTDOffset : tdxReportBodyMRTDOffset+tdxMeasurementSize]),
+		ReportData: body[tdxReportBodyReportDataOffset:tdxReportBodyMinimumSize]}
+	for i := range quote.RTMRs {
+		offset := tdxReportBodyRTMROffset + i*tdxMeasurementSize
+		quote.RTMRs[i] = Digest(body[offset : offset+tdxMeasurementSize])
+	}
+	return quote, nil
+}
+
+// RTMRValues returns the values of the RTMRs in the quote as SHA-384 values indexed by measurement register, so that
+// they can be compared with the result of ReplayAndValidateCCEventLog in the same way as PCR values.
+func (q *TDXQuote) RTMRValues() PCRValues {
+	values := make(PCRValues)
+	for i, rtmr := range q.RTMRs {
+		values[TDXRTMR0+PCRIndex(i)] = DigestMap{AlgorithmSha384: rtmr}
+	}
+	return values
+}
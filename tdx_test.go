@@ -0,0 +1,119 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makeTestTDXQuote(version uint16, mrtd, reportData []byte, rtmrs ...[]byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, version)
+	binary.Write(&buf, binary.LittleEndian, uint16(2)) // ECDSA-256-with-P-256
+	binary.Write(&buf, binary.LittleEndian, uint32(tdxQuoteTEETypeTDX))
+	buf.Write(make([]byte, tdxQuoteHeaderSize-8))
+
+	body := make([]byte, tdxReportBodyMinimumSize)
+	copy(body[tdxReportBodyMRTDOffset:], mrtd)
+	for i, rtmr := range rtmrs {
+		copy(body[tdxReportBodyRTMROffset+i*tdxMeasurementSize:], rtmr)
+	}
+	copy(body[tdxReportBodyReportDataOffset:], reportData)
+
+	if version == 5 {
+		binary.Write(&buf, binary.LittleEndian, uint16(tdxQuoteBodyTypeTD10))
+		binary.Write(&buf, binary.LittleEndian, uint32(len(body)))
+	}
+	buf.Write(body)
+	buf.Write(make([]byte, 64)) // Signature data
+	return buf.Bytes()
+}
+
+func TestTDXRegisterForPCR(t *testing.T) {
+	for _, data := range []struct {
+		pcr      PCRIndex
+		register PCRIndex
+		ok       bool
+	}{
+		{pcr: 0, register: TDXMRTD, ok: true},
+		{pcr: 1, register: TDXRTMR0, ok: true},
+		{pcr: 7, register: TDXRTMR0, ok: true},
+		{pcr: 4, register: TDXRTMR1, ok: true},
+		{pcr: 9, register: TDXRTMR2, ok: true},
+		{pcr: 16},
+	} {
+		register, ok := TDXRegisterForPCR(data.pcr)
+		if register != data.register || ok != data.ok {
+			t.Errorf("Unexpected result for PCR %d: %s %v", data.pcr, TDXRegisterName(register), ok)
+		}
+	}
+	if TDXRegisterName(TDXRTMR2) != "RTMR2" {
+		t.Errorf("Unexpected name: %s", TDXRegisterName(TDXRTMR2))
+	}
+}
+
+func TestReadTDXQuote(t *testing.T) {
+	mrtd := bytes.Repeat([]byte{0x11}, 48)
+	rtmr0 := bytes.Repeat([]byte{0xa0}, 48)
+	rtmr2 := bytes.Repeat([]byte{0xa2}, 48)
+	reportData := bytes.Repeat([]byte{0x55}, 64)
+
+	for _, version := range []uint16{4, 5} {
+		quote, err := ReadTDXQuote(bytes.NewReader(
+			makeTestTDXQuote(version, mrtd, reportData, rtmr0, make([]byte, 48), rtmr2)))
+		if err != nil {
+			t.Fatalf("ReadTDXQuote failed for version %d: %v", version, err)
+		}
+		if !bytes.Equal(quote.MRTD, mrtd) || !bytes.Equal(quote.ReportData, reportData) {
+			t.Errorf("Unexpected MRTD or report data for version %d", version)
+		}
+		values := quote.RTMRValues()
+		if !bytes.Equal(values[TDXRTMR0][AlgorithmSha384], rtmr0) ||
+			!bytes.Equal(values[TDXRTMR2][AlgorithmSha384], rtmr2) || len(values) != 4 {
+			t.Errorf("Unexpected RTMR values for version %d", version)
+		}
+	}
+
+	sgx := makeTestTDXQuote(3, mrtd, reportData)
+	binary.LittleEndian.PutUint32(sgx[4:], 0)
+	if _, err := ReadTDXQuote(bytes.NewReader(sgx)); err == nil {
+		t.Errorf("ReadTDXQuote should fail for a quote that isn't a TDX quote")
+	}
+	if _, err := ReadTDXQuote(bytes.NewReader(makeTestTDXQuote(4, mrtd, reportData)[:200])); err == nil {
+		t.Errorf("ReadTDXQuote should fail for a truncated quote")
+	}
+}
+
+func TestReplayAndValidateCCEventLog(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha384}
+	area := append(makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(TDXRTMR0, EventTypeEFIVariableDriverConfig, []byte("config"), algs...),
+		makeTestLogEvent(TDXRTMR1, EventTypeEFIAction, []byte("Calling EFI Application from Boot Option"), algs...),
+		makeTestLogEvent(TDXRTMR2, EventTypeEventTag, []byte("kernel"), algs...)}), make([]byte, 4096)...)
+
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "CCEL")
+	if err := ioutil.WriteFile(path, area, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	result, err := ReplayAndValidateCCEventLog(path, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayAndValidateCCEventLog failed: %v", err)
+	}
+	if _, ok := result.ExpectedPCRValues[TDXMRTD]; ok || len(result.ExpectedPCRValues) != 3 {
+		t.Errorf("Unexpected registers: %v", result.ExpectedPCRValues.PCRs())
+	}
+
+	expected := performHashExtendOperation(AlgorithmSha384, make(Digest, 48), AlgorithmSha384.hash([]byte("kernel")))
+	if !bytes.Equal(result.ExpectedPCRValues[TDXRTMR2][AlgorithmSha384], expected) {
+		t.Errorf("Unexpected RTMR2 value: %x", result.ExpectedPCRValues[TDXRTMR2][AlgorithmSha384])
+	}
+}
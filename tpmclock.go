@@ -0,0 +1,79 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// TPMClockInfo corresponds to a TPMS_TIME_INFO structure, as returned by the TPM2_ReadClock command. Unlike the
+// system clock, the TPM's time and counters can't be adjusted by the OS (eg, by NTP), so they can be used to check that
+// the PCR values read from the TPM belong to the same boot as the log.
+type TPMClockInfo struct {
+	Time         uint64 // The time in milliseconds since the last TPM Reset or TPM Restart
+	Clock        uint64 // The time in milliseconds that the TPM has been powered since it was last cleared
+	ResetCount   uint32 // The number of TPM Resets (eg, reboots) since the TPM was last cleared
+	RestartCount uint32 // The number of TPM Restarts or TPM Resumes since the last TPM Reset
+	Safe         bool   // Whether Clock is guaranteed not to have gone backwards since it was last reported
+}
+
+// DecodeTPMTimeInfo decodes the supplied TPMS_TIME_INFO structure, which is the response of the TPM2_ReadClock command.
+//
+// https://trustedcomputinggroup.org/wp-content/uploads/TCG_TPM2_r1p59_Part2_Structures_pub.pdf
+//  (section 10.11.6 "TPMS_TIME_INFO")
+func DecodeTPMTimeInfo(data []byte) (*TPMClockInfo, error) {
+	var info struct {
+		Time         uint64
+		Clock        uint64
+		ResetCount   uint32
+		RestartCount uint32
+		Safe         uint8
+	}
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &info); err != nil {
+		return nil, fmt.Errorf("cannot read time info: %v", err)
+	}
+	return &TPMClockInfo{
+		Time:         info.Time,
+		Clock:        info.Clock,
+		ResetCount:   info.ResetCount,
+		RestartCount: info.RestartCount,
+		Safe:         info.Safe != 0}, nil
+}
+
+// TimeSinceStartup returns the time since the last TPM Reset or TPM Restart.
+func (i *TPMClockInfo) TimeSinceStartup() time.Duration {
+	return time.Duration(i.Time) * time.Millisecond
+}
+
+// CheckTPMClockInfo returns findings that indicate that the TPM has been reset or restarted since the log for the
+// current boot was produced, using the supplied clock information read from the TPM and the time since the OS
+// booted (eg, from /proc/uptime), neither of which depend on the system clock. The TPM is started up by the firmware
+// before the OS boots, so its time since startup should be at least as long as the uptime. The TPM clock is only
+// required to be accurate to within ±32.5%, so a shorter time is only treated as a reset if it is much shorter.
+func CheckTPMClockInfo(info *TPMClockInfo, uptime time.Duration) []Finding {
+	var findings []Finding
+
+	if info.RestartCount > 0 {
+		findings = append(findings, Finding{
+			Severity: SeverityWarning,
+			Kind:     FindingKindTPMRestarted,
+			Description: fmt.Sprintf("the TPM has been restarted or resumed %d times since it was last reset, eg, "+
+				"on resume from suspend or hibernation. PCR values are preserved on resume from suspend, but "+
+				"they are reset and measured again on resume from hibernation, so they may not correspond to "+
+				"the log", info.RestartCount)})
+		// The TPM time is from the last restart, so it can't be compared with the uptime.
+		return findings
+	}
+
+	if tpmTime := info.TimeSinceStartup(); uptime > 0 && tpmTime < uptime*2/3 {
+		findings = append(findings, Finding{
+			Severity: SeverityError,
+			Kind:     FindingKindTPMResetAfterBoot,
+			Description: fmt.Sprintf("the TPM was started %s ago, but the OS booted %s ago, which indicates that "+
+				"the TPM was reset after the log was produced and that its PCR values don't correspond to the "+
+				"log", tpmTime.Round(time.Second), uptime.Round(time.Second))})
+	}
+
+	return findings
+}
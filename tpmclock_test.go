@@ -0,0 +1,59 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestDecodeTPMTimeInfo(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint64(90000))
+	binary.Write(&buf, binary.BigEndian, uint64(123456789))
+	binary.Write(&buf, binary.BigEndian, uint32(42))
+	binary.Write(&buf, binary.BigEndian, uint32(1))
+	buf.WriteByte(1)
+
+	info, err := DecodeTPMTimeInfo(buf.Bytes())
+	if err != nil {
+		t.Fatalf("DecodeTPMTimeInfo failed: %v", err)
+	}
+	expected := TPMClockInfo{Time: 90000, Clock: 123456789, ResetCount: 42, RestartCount: 1, Safe: true}
+	if *info != expected {
+		t.Errorf("Unexpected clock info: %+v", info)
+	}
+	if info.TimeSinceStartup() != 90*time.Second {
+		t.Errorf("Unexpected time since startup: %s", info.TimeSinceStartup())
+	}
+
+	if _, err := DecodeTPMTimeInfo(buf.Bytes()[:20]); err == nil {
+		t.Errorf("DecodeTPMTimeInfo should fail for truncated data")
+	}
+}
+
+func TestCheckTPMClockInfo(t *testing.T) {
+	for i, data := range []struct {
+		info   TPMClockInfo
+		uptime time.Duration
+		kinds  []FindingKind
+	}{
+		{info: TPMClockInfo{Time: 65000}, uptime: 60 * time.Second},
+		// The TPM clock is allowed to run slower than the system clock.
+		{info: TPMClockInfo{Time: 50000}, uptime: 60 * time.Second},
+		{info: TPMClockInfo{Time: 10000}, uptime: 60 * time.Second, kinds: []FindingKind{FindingKindTPMResetAfterBoot}},
+		{info: TPMClockInfo{Time: 10000, RestartCount: 2}, uptime: 60 * time.Second,
+			kinds: []FindingKind{FindingKindTPMRestarted}},
+	} {
+		findings := CheckTPMClockInfo(&data.info, data.uptime)
+		if len(findings) != len(data.kinds) {
+			t.Errorf("Unexpected number of findings for test %d: %d", i, len(findings))
+			continue
+		}
+		for j, f := range findings {
+			if f.Kind != data.kinds[j] {
+				t.Errorf("Unexpected finding for test %d: %s", i, f.Kind.Code())
+			}
+		}
+	}
+}
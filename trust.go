@@ -0,0 +1,166 @@
+package tcglog
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// PCRTrust classifies how suitable a PCR is for sealing secrets against on a platform.
+type PCRTrust int
+
+const (
+	// PCRTrustStable indicates that every event measured to the PCR can be verified from the log, and that none of
+	// them are known to vary between boots. The PCR is a good candidate for sealing against.
+	PCRTrustStable PCRTrust = iota
+
+	// PCRTrustVariable indicates that the events measured to the PCR can be verified from the log, but that some of
+	// them record things that are known to vary between otherwise identical boots (eg, user interaction with the
+	// firmware). Sealing against the PCR requires predicting these events or tolerating failures to unseal.
+	PCRTrustVariable
+
+	// PCRTrustUntrusted indicates that the value of the PCR can't be fully explained by the log, so future values
+	// can't be predicted from it. The PCR should not be sealed against on this platform.
+	PCRTrustUntrusted
+)
+
+func (t PCRTrust) String() string {
+	switch t {
+	case PCRTrustStable:
+		return "stable"
+	case PCRTrustVariable:
+		return "variable"
+	case PCRTrustUntrusted:
+		return "untrusted"
+	default:
+		return fmt.Sprintf("PCRTrust(%d)", int(t))
+	}
+}
+
+// PCRTrustClassification is the trust classification of a single PCR.
+type PCRTrustClassification struct {
+	PCR     PCRIndex
+	Trust   PCRTrust
+	Reasons []string // Why the PCR isn't stable, in the order in which they were found
+}
+
+func (c *PCRTrustClassification) add(trust PCRTrust, reason string) {
+	if trust > c.Trust {
+		c.Trust = trust
+	}
+	c.Reasons = append(c.Reasons, reason)
+}
+
+// ClassifyPCRTrust combines the analyses of the log into a trust classification for each of the specified PCRs, in
+// the order in which they are supplied. A PCR is untrusted if any of its events have digests that can't be verified
+// from the event data, if parsing its events relied on working around deviations from the specification, if the
+// platform reported an error or the PCR doesn't have a successful EV_SEPARATOR event, or if it isn't consistent with
+// tpmPCRValues (which may be nil). The values after the final events are compared with tpmPCRValues if there are
+// any. A PCR is variable if it records user interaction with the firmware, a one-shot BootNext boot, or retried
+// calls to ExitBootServices.
+//
+// If a bank in tpmPCRValues is still in its reset state for a PCR that the log extends, the bank is reported as not
+// being extended by the firmware, which means that sealing against that bank protects nothing.
+func (r *LogValidateResult) ClassifyPCRTrust(pcrs []PCRIndex, tpmPCRValues PCRValues) []*PCRTrustClassification {
+	classifications := make(map[PCRIndex]*PCRTrustClassification)
+	var out []*PCRTrustClassification
+	for _, pcr := range pcrs {
+		if _, ok := classifications[pcr]; ok {
+			continue
+		}
+		c := &PCRTrustClassification{PCR: pcr}
+		classifications[pcr] = c
+		out = append(out, c)
+	}
+	classify := func(e *Event, trust PCRTrust, reason string) {
+		if c, ok := classifications[e.PCRIndex]; ok {
+			c.add(trust, fmt.Sprintf("event %d (type: %s): %s", e.Index, e.EventType, reason))
+		}
+	}
+
+	var events []*Event
+	for _, e := range append(append([]*ValidatedEvent(nil), r.ValidatedEvents...), r.FinalEvents...) {
+		events = append(events, e.Event)
+		for _, v := range e.IncorrectDigestValues {
+			classify(e.Event, PCRTrustUntrusted, fmt.Sprintf("%s digest isn't generated from the event data",
+				v.Algorithm))
+		}
+		if e.HasTrailingMeasuredBytes() {
+			classify(e.Event, PCRTrustUntrusted, "measured bytes extend beyond the decoded event data")
+		}
+		for _, q := range e.Event.Quirks {
+			if q == EventQuirkUnexpectedSpecIdEvent {
+				continue
+			}
+			classify(e.Event, PCRTrustUntrusted, fmt.Sprintf("parsing relied on a workaround (%s)", q))
+		}
+		if e.Event.EventType == EventTypeEFIVariableBoot {
+			if d, ok := e.Event.Data().(*EFIVariableEventData); ok && d.VariableName == efiGlobalVariableGUID &&
+				d.UnicodeName == "BootNext" {
+				classify(e.Event, PCRTrustVariable, "BootNext selects a boot option for this boot only")
+			}
+		}
+	}
+
+	for _, e := range FindFirmwareErrors(events) {
+		if exitBootServicesAction(e.Event) != "" {
+			// Failed calls to ExitBootServices are handled below.
+			continue
+		}
+		classify(e.Event, PCRTrustUntrusted, "platform reported a measurement error")
+	}
+	for _, e := range DetectFirmwareUIEntry(events) {
+		classify(e.Event, PCRTrustVariable, fmt.Sprintf("user interaction with the firmware (%s)", e.Kind))
+	}
+	for _, e := range DetectCapsuleUpdates(events) {
+		classify(e.Event, PCRTrustVariable, fmt.Sprintf("firmware update during boot (%s)", e.Kind))
+	}
+	if ebs := r.ExitBootServices; ebs != nil && len(ebs.Attempts) > 1 {
+		for _, a := range ebs.Attempts[:len(ebs.Attempts)-1] {
+			e := a.Return
+			if e == nil {
+				e = a.Invocation
+			}
+			classify(e, PCRTrustVariable, "ExitBootServices was retried")
+		}
+	}
+
+	for _, c := range out {
+		if c.PCR < 8 {
+			switch status := r.Separators[c.PCR]; {
+			case status == nil || !status.Present():
+				c.add(PCRTrustUntrusted, "no EV_SEPARATOR event")
+			case status.IsError:
+				c.add(PCRTrustUntrusted, "EV_SEPARATOR event signals a pre-OS error")
+			}
+		}
+
+		if tpmPCRValues == nil {
+			continue
+		}
+		for _, alg := range r.Algorithms {
+			actual, ok := tpmPCRValues[c.PCR][alg]
+			if !ok {
+				continue
+			}
+			expected := r.ExpectedPCRValues[c.PCR][alg]
+			if r.ExpectedPCRValuesWithFinalEvents != nil {
+				expected = r.ExpectedPCRValuesWithFinalEvents[c.PCR][alg]
+			}
+			if bytes.Equal(actual, expected) {
+				continue
+			}
+			if isResetPCRValue(actual) {
+				c.add(PCRTrustUntrusted, fmt.Sprintf("%s bank is not being extended by the firmware", alg))
+			} else {
+				c.add(PCRTrustUntrusted, fmt.Sprintf("log is not consistent with the %s bank", alg))
+			}
+		}
+	}
+
+	return out
+}
+
+// isResetPCRValue indicates whether v is the value of a PCR after a TPM reset, which is all zeros or all ones.
+func isResetPCRValue(v Digest) bool {
+	return bytes.Count(v, []byte{0x00}) == len(v) || bytes.Count(v, []byte{0xff}) == len(v)
+}
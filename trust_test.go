@@ -0,0 +1,89 @@
+package tcglog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestClassifyPCRTrust(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+	separator := []byte{0, 0, 0, 0}
+
+	incorrect := makeTestLogEvent(2, EventTypeEFIAction, []byte("foo"), algs...)
+	incorrect.digests[1].digest = AlgorithmSha256.hash([]byte("bar"))
+
+	events := []testLogEvent{
+		makeTestLogEvent(0, EventTypeSCRTMVersion, []byte("version"), algs...),
+		incorrect,
+		makeTestLogEvent(4, EventTypeEFIAction, []byte("Calling EFI Application from Boot Option"), algs...),
+		makeTestLogEvent(4, EventTypeEFIAction, []byte("Returning from EFI Application from Boot Option"), algs...),
+		makeTestLogEvent(4, EventTypeEFIAction, []byte("Calling EFI Application from Boot Option"), algs...)}
+	for i := PCRIndex(0); i < 7; i++ {
+		events = append(events, makeTestLogEvent(i, EventTypeSeparator, separator, algs...))
+	}
+	events = append(events,
+		makeTestLogEvent(5, EventTypeEFIAction, []byte("Exit Boot Services Invocation"), algs...),
+		makeTestLogEvent(5, EventTypeEFIAction, []byte("Exit Boot Services Returned with Failure"), algs...),
+		makeTestLogEvent(5, EventTypeEFIAction, []byte("Exit Boot Services Invocation"), algs...),
+		makeTestLogEvent(5, EventTypeEFIAction, []byte("Exit Boot Services Returned with Success"), algs...))
+
+	logPath := filepath.Join(dir, "log")
+	if err := ioutil.WriteFile(logPath, makeTestLog_2(algs, events), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	result, err := ReplayAndValidateLog(logPath, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayAndValidateLog failed: %v", err)
+	}
+
+	pcrs := []PCRIndex{0, 1, 2, 4, 5, 7}
+	classifications := result.ClassifyPCRTrust(pcrs, nil)
+	for i, data := range []struct {
+		trust   PCRTrust
+		reasons []string
+	}{
+		{trust: PCRTrustStable},
+		{trust: PCRTrustStable},
+		{trust: PCRTrustUntrusted,
+			reasons: []string{"event 0 (type: EV_EFI_ACTION): SHA-256 digest isn't generated from the event data"}},
+		{trust: PCRTrustVariable,
+			reasons: []string{"event 1 (type: EV_EFI_ACTION): user interaction with the firmware (return from boot " +
+				"option)"}},
+		{trust: PCRTrustVariable, reasons: []string{"event 2 (type: EV_EFI_ACTION): ExitBootServices was retried"}},
+		{trust: PCRTrustUntrusted, reasons: []string{"no EV_SEPARATOR event"}},
+	} {
+		c := classifications[i]
+		if c.PCR != pcrs[i] {
+			t.Fatalf("Unexpected PCR: %d", c.PCR)
+		}
+		if c.Trust != data.trust {
+			t.Errorf("Unexpected trust for PCR %d: %s", c.PCR, c.Trust)
+		}
+		if !reflect.DeepEqual(c.Reasons, data.reasons) {
+			t.Errorf("Unexpected reasons for PCR %d: %q", c.PCR, c.Reasons)
+		}
+	}
+
+	tpmPCRValues := PCRValues{
+		0: DigestMap{AlgorithmSha1: result.ExpectedPCRValues[0][AlgorithmSha1], AlgorithmSha256: make(Digest, 32)},
+		1: DigestMap{AlgorithmSha1: make(Digest, 20)}}
+	tpmPCRValues[1][AlgorithmSha1][0] = 1
+	classifications = result.ClassifyPCRTrust([]PCRIndex{0, 1}, tpmPCRValues)
+	if classifications[0].Trust != PCRTrustUntrusted ||
+		!reflect.DeepEqual(classifications[0].Reasons, []string{"SHA-256 bank is not being extended by the firmware"}) {
+		t.Errorf("Unexpected classification for PCR 0: %s %q", classifications[0].Trust, classifications[0].Reasons)
+	}
+	if classifications[1].Trust != PCRTrustUntrusted ||
+		!reflect.DeepEqual(classifications[1].Reasons, []string{"log is not consistent with the SHA-1 bank"}) {
+		t.Errorf("Unexpected classification for PCR 1: %s %q", classifications[1].Trust, classifications[1].Reasons)
+	}
+}
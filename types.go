@@ -7,6 +7,8 @@ import (
 	_ "crypto/sha512"
 	"fmt"
 	"hash"
+	"io"
+	"sort"
 )
 
 // Spec corresponds to the TCG specification that an event log conforms to.
@@ -62,6 +64,155 @@ type Digest []byte
 // DigestMap is a map of algorithms to digests.
 type DigestMap map[AlgorithmId]Digest
 
+// Algorithms returns the algorithms contained in this map, sorted in ascending order of their identifiers. This should
+// be used instead of iterating over the map directly when the order matters, eg, when producing output.
+func (m DigestMap) Algorithms() AlgorithmIdList {
+	out := make(AlgorithmIdList, 0, len(m))
+	for alg := range m {
+		out = append(out, alg)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// EventDigests contains the digests of an event for each supported algorithm. Rather than a map, it is a slice of
+// digests indexed by the position of the algorithm in an algorithm table, and the table is shared by all events read
+// from the same log. This avoids allocating a map for every event in large logs. The zero value contains no digests.
+//
+// Like a slice, copies of EventDigests share the same storage until Set adds an algorithm that isn't already present.
+// The accessors are safe for concurrent readers, but Set must not be called concurrently with any other method.
+type EventDigests struct {
+	algorithms AlgorithmIdList // Sorted in ascending order, and shared - never modified in place
+	digests    []Digest        // Indexed by the position of the algorithm in algorithms, nil if not present
+}
+
+// newEventDigests returns an EventDigests for the supplied algorithm table, which must be sorted in ascending order
+// and must not be modified afterwards.
+func newEventDigests(algorithms AlgorithmIdList) EventDigests {
+	return EventDigests{algorithms: algorithms, digests: make([]Digest, len(algorithms))}
+}
+
+// sortedAlgorithmTable returns a copy of the supplied algorithms, sorted in ascending order of their identifiers, for
+// use as the algorithm table of EventDigests.
+func sortedAlgorithmTable(algorithms AlgorithmIdList) AlgorithmIdList {
+	out := make(AlgorithmIdList, len(algorithms))
+	copy(out, algorithms)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// NewEventDigests returns an EventDigests containing the digests from the supplied map.
+func NewEventDigests(m DigestMap) EventDigests {
+	d := newEventDigests(m.Algorithms())
+	for i, alg := range d.algorithms {
+		d.digests[i] = m[alg]
+	}
+	return d
+}
+
+func (d EventDigests) index(alg AlgorithmId) int {
+	i := sort.Search(len(d.algorithms), func(i int) bool { return d.algorithms[i] >= alg })
+	if i < len(d.algorithms) && d.algorithms[i] == alg {
+		return i
+	}
+	return -1
+}
+
+// Lookup returns the digest for the specified algorithm, and whether there is one.
+func (d EventDigests) Lookup(alg AlgorithmId) (Digest, bool) {
+	i := d.index(alg)
+	if i < 0 || d.digests[i] == nil {
+		return nil, false
+	}
+	return d.digests[i], true
+}
+
+// Get returns the digest for the specified algorithm, or nil if there isn't one.
+func (d EventDigests) Get(alg AlgorithmId) Digest {
+	digest, _ := d.Lookup(alg)
+	return digest
+}
+
+// Set sets the digest for the specified algorithm. If the algorithm isn't already in the algorithm table, a new table
+// is created for these digests rather than modifying the shared one.
+func (d *EventDigests) Set(alg AlgorithmId, digest Digest) {
+	if i := d.index(alg); i >= 0 {
+		d.digests[i] = digest
+		return
+	}
+
+	i := sort.Search(len(d.algorithms), func(i int) bool { return d.algorithms[i] >= alg })
+
+	algorithms := make(AlgorithmIdList, 0, len(d.algorithms)+1)
+	algorithms = append(algorithms, d.algorithms[:i]...)
+	algorithms = append(algorithms, alg)
+	d.algorithms = append(algorithms, d.algorithms[i:]...)
+
+	digests := make([]Digest, 0, len(d.digests)+1)
+	digests = append(digests, d.digests[:i]...)
+	digests = append(digests, digest)
+	d.digests = append(digests, d.digests[i:]...)
+}
+
+// Len returns the number of digests.
+func (d EventDigests) Len() (n int) {
+	for _, digest := range d.digests {
+		if digest != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Algorithms returns the algorithms for which there is a digest, sorted in ascending order of their identifiers.
+func (d EventDigests) Algorithms() AlgorithmIdList {
+	out := make(AlgorithmIdList, 0, len(d.algorithms))
+	for i, alg := range d.algorithms {
+		if d.digests[i] != nil {
+			out = append(out, alg)
+		}
+	}
+	return out
+}
+
+// Map returns the digests as a DigestMap, for compatibility with code that expects a map. The returned map is a
+// copy, so modifying it doesn't affect these digests.
+func (d EventDigests) Map() DigestMap {
+	out := make(DigestMap, len(d.algorithms))
+	for i, alg := range d.algorithms {
+		if d.digests[i] != nil {
+			out[alg] = d.digests[i]
+		}
+	}
+	return out
+}
+
+// PCRValues is a map of PCR indices to digests for each algorithm.
+type PCRValues map[PCRIndex]DigestMap
+
+// PCRs returns the PCR indices contained in this map, sorted in ascending order. This should be used instead of
+// iterating over the map directly when the order matters, eg, when producing output.
+func (v PCRValues) PCRs() []PCRIndex {
+	out := make([]PCRIndex, 0, len(v))
+	for pcr := range v {
+		out = append(out, pcr)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// Copy returns a deep copy of these PCR values.
+func (v PCRValues) Copy() PCRValues {
+	out := make(PCRValues, len(v))
+	for pcr, digests := range v {
+		out[pcr] = make(DigestMap, len(digests))
+		for alg, digest := range digests {
+			out[pcr][alg] = append(Digest(nil), digest...)
+		}
+	}
+	return out
+}
+
 func (e EventType) String() string {
 	switch e {
 	case EventTypePrebootCert:
@@ -111,17 +262,67 @@ func (e EventType) String() string {
 	case EventTypeEFIRuntimeServicesDriver:
 		return "EV_EFI_RUNTIME_SERVICES_DRIVER"
 	case EventTypeEFIGPTEvent:
-		return "EF_EFI_GPT_EVENT"
+		return "EV_EFI_GPT_EVENT"
 	case EventTypeEFIAction:
 		return "EV_EFI_ACTION"
 	case EventTypeEFIPlatformFirmwareBlob:
 		return "EV_EFI_PLATFORM_FIRMWARE_BLOB"
 	case EventTypeEFIHandoffTables:
 		return "EV_EFI_HANDOFF_TABLES"
+	case EventTypeEFIPlatformFirmwareBlob2:
+		return "EV_EFI_PLATFORM_FIRMWARE_BLOB2"
+	case EventTypeEFIHandoffTables2:
+		return "EV_EFI_HANDOFF_TABLES2"
 	case EventTypeEFIHCRTMEvent:
 		return "EV_EFI_HCRTM_EVENT"
 	case EventTypeEFIVariableAuthority:
 		return "EV_EFI_VARIABLE_AUTHORITY"
+	case EventTypeTXTPCRMapping:
+		return "EVTYPE_PCRMAPPING"
+	case EventTypeTXTHashStart:
+		return "EVTYPE_HASH_START"
+	case EventTypeTXTCombinedHash:
+		return "EVTYPE_COMBINED_HASH"
+	case EventTypeTXTMLEHash:
+		return "EVTYPE_MLE_HASH"
+	case EventTypeTXTBIOSACRegData:
+		return "EVTYPE_BIOSAC_REG_DATA"
+	case EventTypeTXTCPUSCRTMStat:
+		return "EVTYPE_CPU_SCRTM_STAT"
+	case EventTypeTXTLCPControlHash:
+		return "EVTYPE_LCP_CONTROL_HASH"
+	case EventTypeTXTElementsHash:
+		return "EVTYPE_ELEMENTS_HASH"
+	case EventTypeTXTSTMHash:
+		return "EVTYPE_STM_HASH"
+	case EventTypeTXTOSSinitDataCapHash:
+		return "EVTYPE_OSSINITDATA_CAP_HASH"
+	case EventTypeTXTSinitPubKeyHash:
+		return "EVTYPE_SINIT_PUBKEY_HASH"
+	case EventTypeTXTLCPHash:
+		return "EVTYPE_LCP_HASH"
+	case EventTypeTXTLCPDetailsHash:
+		return "EVTYPE_LCP_DETAILS_HASH"
+	case EventTypeTXTLCPAuthoritiesHash:
+		return "EVTYPE_LCP_AUTHORITIES_HASH"
+	case EventTypeTXTNVInfoHash:
+		return "EVTYPE_NV_INFO_HASH"
+	case EventTypeTXTColdBootBIOSHash:
+		return "EVTYPE_COLD_BOOT_BIOS_HASH"
+	case EventTypeTXTKMHash:
+		return "EVTYPE_KM_HASH"
+	case EventTypeTXTBPMHash:
+		return "EVTYPE_BPM_HASH"
+	case EventTypeTXTKMInfoHash:
+		return "EVTYPE_KM_INFO_HASH"
+	case EventTypeTXTBPMInfoHash:
+		return "EVTYPE_BPM_INFO_HASH"
+	case EventTypeTXTBootPolHash:
+		return "EVTYPE_BOOT_POL_HASH"
+	case EventTypeTXTRandomValue:
+		return "EVTYPE_RANDOM_VALUE"
+	case EventTypeTXTCapValue:
+		return "EVTYPE_CAP_VALUE"
 	default:
 		return fmt.Sprintf("%08x", uint32(e))
 	}
@@ -172,11 +373,126 @@ func (l AlgorithmIdList) Contains(a AlgorithmId) bool {
 	return false
 }
 
+// TaggedDigest corresponds to a single digest as it appears in an event, along with the algorithm that it is
+// associated with (TPMT_HA).
+type TaggedDigest struct {
+	Algorithm AlgorithmId
+	Digest    Digest
+}
+
+// TaggedDigestList is a list of digests in the order that they appear in an event (TPML_DIGEST_VALUES).
+type TaggedDigestList []TaggedDigest
+
+// EventQuirk describes a deviation from the specification that was detected and worked around when parsing an
+// event.
+type EventQuirk int
+
+func (q EventQuirk) String() string {
+	switch q {
+	case EventQuirkDigestCountMismatch:
+		return "digest count mismatch"
+	case EventQuirkTrailingPadding:
+		return "trailing padding"
+	case EventQuirkDuplicateDigest:
+		return "duplicate digest"
+	case EventQuirkUnexpectedDigestAlgorithm:
+		return "unexpected digest algorithm"
+	case EventQuirkInconsistentInternalLengths:
+		return "inconsistent internal lengths"
+	case EventQuirkPrecededByGap:
+		return "preceded by gap"
+	case EventQuirkUnexpectedSpecIdEvent:
+		return "unexpected Spec ID event"
+	default:
+		return fmt.Sprintf("quirk(%d)", int(q))
+	}
+}
+
 // Event corresponds to a single event in an event log.
+//
+// Events and their data are immutable once they have been returned from this package. The event data is decoded the
+// first time that it is accessed rather than when the event is read, so that consumers that only need the digests
+// (eg, to replay a log) don't pay the cost of decoding it. Decoding is synchronized, and none of the other methods on
+// Event, EventData or EventDigests update cached state. This means that an event is safe for concurrent readers.
+// Functions in this package that accept events (eg, DiffLogs and DetermineStartupSequence) only read them.
 type Event struct {
-	Index     uint      // Sequential index of event in the log
-	PCRIndex  PCRIndex  // PCR index to which this event was measured
-	EventType EventType // The type of this event
-	Digests   DigestMap // The digests corresponding to this event for the supported algorithms
-	Data      EventData // The data recorded with this event
+	Index      uint             // Sequential index of event in the log
+	PCRIndex   PCRIndex         // PCR index to which this event was measured
+	EventType  EventType        // The type of this event
+	Digests    EventDigests     // The digests corresponding to this event for the supported algorithms
+	RawDigests TaggedDigestList // All of the digests for this event in the order they appear in the log, including unsupported algorithms
+	Quirks     []EventQuirk     // Deviations from the specification that were worked around when parsing this event
+
+	data EventData      // The data for an event that was constructed with its data already decoded
+	lazy *lazyEventData // The data for an event that is decoded on first access
+}
+
+// Data returns the data recorded with this event, decoding it if this is the first access.
+func (e *Event) Data() EventData {
+	if e.lazy != nil {
+		return e.lazy.get().data
+	}
+	return e.data
+}
+
+// trailingBytes returns the number of bytes at the end of the event data that weren't consumed by its decoder.
+func (e *Event) trailingBytes() int {
+	if e.lazy != nil {
+		return e.lazy.get().trailingBytes
+	}
+	return 0
+}
+
+// DecodeError returns an error if the event data is malformed and couldn't be decoded, in which case Data returns a
+// *BrokenEventData. It returns nil for event data that was decoded successfully or that is in a format that isn't
+// known.
+func (e *Event) DecodeError() *EventDecodeError {
+	return newEventDecodeError(e)
+}
+
+// DataConsumed returns the number of bytes at the start of the event data that were consumed when decoding it. If
+// this is less than the size of the event data, the remaining bytes aren't part of the decoded structure (see
+// TrailingDataBytes). It is zero for event data that is in a format that isn't known or that couldn't be decoded.
+func (e *Event) DataConsumed() int {
+	if e.lazy == nil {
+		return 0
+	}
+	return eventDataConsumed(e.Data(), e.trailingBytes())
+}
+
+// TrailingDataBytes returns the bytes at the end of the event data that weren't consumed when decoding it, such as
+// vendor data appended to a structure defined by the specification. It returns nil if there are none or if the event
+// data wasn't decoded.
+func (e *Event) TrailingDataBytes() []byte {
+	data := e.Data()
+	if data == nil || !isDecodedEventData(data) {
+		return nil
+	}
+	consumed := e.DataConsumed()
+	if consumed >= len(data.Bytes()) {
+		return nil
+	}
+	return data.Bytes()[consumed:]
+}
+
+// IsDataOverDeclared indicates whether the event data couldn't be decoded because it is shorter than a structure or
+// length field inside it declares.
+func (e *Event) IsDataOverDeclared() bool {
+	err := e.DecodeError()
+	return err != nil && err.Err == io.ErrUnexpectedEOF
+}
+
+// HasQuirk indicates whether the specified deviation from the specification was detected when parsing this event.
+// EventQuirkInconsistentInternalLengths is detected when the event data is decoded, so checking for it decodes the
+// event data if it hasn't been already.
+func (e *Event) HasQuirk(q EventQuirk) bool {
+	if q == EventQuirkInconsistentInternalLengths {
+		return CheckInternalLengths(e) != nil
+	}
+	for _, x := range e.Quirks {
+		if x == q {
+			return true
+		}
+	}
+	return false
 }
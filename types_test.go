@@ -0,0 +1,71 @@
+package tcglog
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestEventDigests(t *testing.T) {
+	sha1 := AlgorithmSha1.hash([]byte("foo"))
+	sha256 := AlgorithmSha256.hash([]byte("foo"))
+
+	d := NewEventDigests(DigestMap{AlgorithmSha256: sha256, AlgorithmSha1: sha1})
+	if d.Len() != 2 {
+		t.Errorf("Unexpected length: %d", d.Len())
+	}
+	if !reflect.DeepEqual(d.Algorithms(), AlgorithmIdList{AlgorithmSha1, AlgorithmSha256}) {
+		t.Errorf("Unexpected algorithms: %v", d.Algorithms())
+	}
+	if !bytes.Equal(d.Get(AlgorithmSha256), sha256) {
+		t.Errorf("Unexpected sha256 digest: %x", d.Get(AlgorithmSha256))
+	}
+	if _, ok := d.Lookup(AlgorithmSha384); ok {
+		t.Errorf("Lookup returned a digest for an algorithm that isn't present")
+	}
+	if d.Get(AlgorithmSha384) != nil {
+		t.Errorf("Get returned a digest for an algorithm that isn't present")
+	}
+	if !reflect.DeepEqual(d.Map(), DigestMap{AlgorithmSha1: sha1, AlgorithmSha256: sha256}) {
+		t.Errorf("Unexpected map: %v", d.Map())
+	}
+
+	sha384 := AlgorithmSha384.hash([]byte("foo"))
+	c := d
+	c.Set(AlgorithmSha384, sha384)
+	if !bytes.Equal(c.Get(AlgorithmSha384), sha384) || c.Len() != 3 {
+		t.Errorf("Set failed to add a new algorithm")
+	}
+	if d.Len() != 2 {
+		t.Errorf("Adding an algorithm to a copy modified the original")
+	}
+
+	var z EventDigests
+	if z.Len() != 0 || len(z.Algorithms()) != 0 || len(z.Map()) != 0 {
+		t.Errorf("Zero value isn't empty")
+	}
+	z.Set(AlgorithmSha256, sha256)
+	if !bytes.Equal(z.Get(AlgorithmSha256), sha256) {
+		t.Errorf("Set failed on zero value")
+	}
+}
+
+func TestEventDigestsSharedTable(t *testing.T) {
+	table := sortedAlgorithmTable(AlgorithmIdList{AlgorithmSha256, AlgorithmSha1})
+	a := newEventDigests(table)
+	b := newEventDigests(table)
+	a.Set(AlgorithmSha1, AlgorithmSha1.hash([]byte("a")))
+	b.Set(AlgorithmSha256, AlgorithmSha256.hash([]byte("b")))
+
+	if !reflect.DeepEqual(a.Algorithms(), AlgorithmIdList{AlgorithmSha1}) {
+		t.Errorf("Unexpected algorithms: %v", a.Algorithms())
+	}
+	if !reflect.DeepEqual(b.Algorithms(), AlgorithmIdList{AlgorithmSha256}) {
+		t.Errorf("Unexpected algorithms: %v", b.Algorithms())
+	}
+
+	a.Set(AlgorithmSha384, AlgorithmSha384.hash([]byte("a")))
+	if !reflect.DeepEqual(table, AlgorithmIdList{AlgorithmSha1, AlgorithmSha256}) {
+		t.Errorf("Shared table was modified: %v", table)
+	}
+}
@@ -0,0 +1,56 @@
+package tcglog
+
+import (
+	"fmt"
+	"io"
+)
+
+// UntrustedMaxEventDataSize is the value of LogOptions.MaxEventDataSize used by ParseUntrusted if it isn't
+// specified. It is lower than DefaultMaxEventDataSize, but still much larger than the data of any event recorded by
+// real firmware.
+const UntrustedMaxEventDataSize = 1024 * 1024
+
+// UntrustedMaxEventCount is the maximum number of events that ParseUntrusted will read from a log.
+const UntrustedMaxEventCount = 65536
+
+// ParseUntrusted reads all of the events from a log that comes from an untrusted source, such as a log supplied by a
+// remote attestation client, with all of the available hardening enabled. The log is rejected if any event declares
+// event data larger than options.MaxEventDataSize (UntrustedMaxEventDataSize if that is zero), if it contains more
+// than UntrustedMaxEventCount events, or if options fails Validate. A panic whilst parsing the log is returned as an
+// error rather than propagated, so that a log that triggers a bug in this package can't take down the caller.
+//
+// On success, the returned Log can be used to obtain the properties of the log, such as its algorithms and any gaps
+// skipped in permissive mode.
+func ParseUntrusted(r io.ReaderAt, options LogOptions) (log *Log, events []*Event, err error) {
+	if options.MaxEventDataSize == 0 {
+		options.MaxEventDataSize = UntrustedMaxEventDataSize
+	}
+	if err := options.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			log, events, err = nil, nil, fmt.Errorf("cannot parse log: %v", p)
+		}
+	}()
+
+	log, err = NewLog(r, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for {
+		event, err := log.NextEvent()
+		if err == io.EOF {
+			return log, events, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(events) == UntrustedMaxEventCount {
+			return nil, nil, fmt.Errorf("log contains more than %d events", UntrustedMaxEventCount)
+		}
+		events = append(events, event)
+	}
+}
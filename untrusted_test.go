@@ -0,0 +1,55 @@
+package tcglog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseUntrusted(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+	data := makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(7, EventTypeEFIAction, []byte("foo"), algs...),
+		makeTestLogEvent(7, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...)})
+
+	log, events, err := ParseUntrusted(bytes.NewReader(data), LogOptions{})
+	if err != nil {
+		t.Fatalf("ParseUntrusted failed: %v", err)
+	}
+	if log.Spec != SpecEFI_2 || len(events) != 3 {
+		t.Errorf("Unexpected result (spec: %v, events: %d)", log.Spec, len(events))
+	}
+
+	if _, _, err := ParseUntrusted(bytes.NewReader(data), LogOptions{EnableSystemdEFIStub: true}); err == nil {
+		t.Errorf("ParseUntrusted should fail with invalid options")
+	}
+	if _, _, err := ParseUntrusted(bytes.NewReader(data[:len(data)-2]), LogOptions{}); err == nil {
+		t.Errorf("ParseUntrusted should fail with a truncated log")
+	}
+}
+
+func TestParseUntrustedLimits(t *testing.T) {
+	algs := []AlgorithmId{AlgorithmSha256}
+
+	large := makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(7, EventTypeEFIAction, make([]byte, UntrustedMaxEventDataSize+1), algs...)})
+	if _, _, err := ParseUntrusted(bytes.NewReader(large), LogOptions{}); err == nil {
+		t.Errorf("ParseUntrusted should fail with an event that exceeds the default limit")
+	}
+	options := LogOptions{MaxEventDataSize: DefaultMaxEventDataSize}
+	if _, _, err := ParseUntrusted(bytes.NewReader(large), options); err != nil {
+		t.Errorf("ParseUntrusted failed with a larger limit: %v", err)
+	}
+
+	event := makeTestLogEvent(7, EventTypeEFIAction, []byte("foo"), algs...)
+	events := make([]testLogEvent, UntrustedMaxEventCount)
+	for i := range events {
+		events[i] = event
+	}
+	if _, _, err := ParseUntrusted(bytes.NewReader(makeTestLog_2(algs, events)), LogOptions{}); err == nil {
+		t.Errorf("ParseUntrusted should fail with too many events")
+	}
+	if _, events, err := ParseUntrusted(bytes.NewReader(makeTestLog_2(algs, events[1:])), LogOptions{}); err != nil ||
+		len(events) != UntrustedMaxEventCount {
+		t.Errorf("ParseUntrusted failed with the maximum number of events: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package tcglog
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// UTF16ProblemKind describes the type of a UTF16Problem.
+type UTF16ProblemKind int
+
+const (
+	// UTF16UnpairedSurrogate indicates a high surrogate that isn't followed by a low surrogate, or a low surrogate
+	// that isn't preceded by a high surrogate.
+	UTF16UnpairedSurrogate UTF16ProblemKind = iota
+
+	// UTF16EmbeddedNUL indicates a NUL character inside a string, rather than as a terminator or padding.
+	UTF16EmbeddedNUL
+
+	// UTF16NonCanonical indicates a byte order mark or a noncharacter (U+FFFE or U+FFFF), which suggests that the
+	// string was written with the wrong byte order or from uninitialized memory.
+	UTF16NonCanonical
+)
+
+func (k UTF16ProblemKind) String() string {
+	switch k {
+	case UTF16UnpairedSurrogate:
+		return "unpaired surrogate"
+	case UTF16EmbeddedNUL:
+		return "embedded NUL"
+	case UTF16NonCanonical:
+		return "non-canonical encoding"
+	default:
+		return fmt.Sprintf("UTF16ProblemKind(%d)", int(k))
+	}
+}
+
+// UTF16Problem describes a malformed UTF-16 string inside the event data of an event.
+type UTF16Problem struct {
+	Kind   UTF16ProblemKind
+	Field  string // The name of the field containing the string, eg, "UnicodeName"
+	Offset int    // The offset of the problem in code units from the start of the string
+	Value  uint16 // The code unit at Offset
+}
+
+func (p UTF16Problem) String() string {
+	return fmt.Sprintf("%s at offset %d of %s (0x%04x)", p.Kind, p.Offset, p.Field, p.Value)
+}
+
+// checkUTF16String checks a string for malformed UTF-16. If nulTerminated is true, the string ends at the first NUL
+// character and must only be followed by NUL padding.
+func checkUTF16String(field string, units []uint16, nulTerminated bool) (out []UTF16Problem) {
+	for i := 0; i < len(units); i++ {
+		u := units[i]
+		switch {
+		case u == 0:
+			if !nulTerminated {
+				out = append(out, UTF16Problem{Kind: UTF16EmbeddedNUL, Field: field, Offset: i, Value: u})
+				continue
+			}
+			for j := i + 1; j < len(units); j++ {
+				if units[j] != 0 {
+					out = append(out, UTF16Problem{Kind: UTF16EmbeddedNUL, Field: field, Offset: i, Value: u})
+					break
+				}
+			}
+			return out
+		case u >= surr1 && u < surr2:
+			if i+1 < len(units) && units[i+1] >= surr2 && units[i+1] < surr3 {
+				i++
+				continue
+			}
+			out = append(out, UTF16Problem{Kind: UTF16UnpairedSurrogate, Field: field, Offset: i, Value: u})
+		case u >= surr2 && u < surr3:
+			out = append(out, UTF16Problem{Kind: UTF16UnpairedSurrogate, Field: field, Offset: i, Value: u})
+		case u == 0xfeff || u == 0xfffe || u == 0xffff:
+			out = append(out, UTF16Problem{Kind: UTF16NonCanonical, Field: field, Offset: i, Value: u})
+		}
+	}
+	return out
+}
+
+func readUTF16Units(data []byte) []uint16 {
+	out := make([]uint16, len(data)/2)
+	for i := range out {
+		out[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return out
+}
+
+// CheckUTF16Strings performs a strict check of the UTF-16 strings inside the event data of the supplied event, for
+// events that contain a UEFI_VARIABLE_DATA or UEFI_GPT_DATA structure. Some firmware writes malformed UCS-2 strings
+// that the decoder silently repairs (eg, by inserting replacement characters), but which may break other consumers
+// of the log. This reports the raw problems rather than repairing them. The strings are checked as far as the event
+// data allows, and nil is returned if there are no problems.
+func CheckUTF16Strings(event *Event) []UTF16Problem {
+	if event.Data() == nil {
+		return nil
+	}
+	data := event.Data().Bytes()
+
+	switch event.EventType {
+	case EventTypeEFIVariableDriverConfig, EventTypeEFIVariableBoot, EventTypeEFIVariableAuthority:
+		// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+		//  (section 9.2.6 "UEFI_VARIABLE_DATA Structure")
+		if len(data) < 32 {
+			return nil
+		}
+		n := binary.LittleEndian.Uint64(data[16:])
+		if n > uint64(len(data)-32)/2 {
+			n = uint64(len(data)-32) / 2
+		}
+		return checkUTF16String("UnicodeName", readUTF16Units(data[32:32+n*2]), false)
+	case EventTypeEFIGPTEvent:
+		// https://trustedcomputinggroup.org/wp-content/uploads/TCG_PCClientSpecPlat_TPM_2p0_1p04_pub.pdf
+		//  (section 9.2.5 "UEFI_GPT_DATA Structure")
+		if len(data) < 100 {
+			return nil
+		}
+		entrySize := uint64(binary.LittleEndian.Uint32(data[84:]))
+		if entrySize < 128 {
+			return nil
+		}
+		var out []UTF16Problem
+		numberOfPartitions := binary.LittleEndian.Uint64(data[92:])
+		for i := uint64(0); i < numberOfPartitions; i++ {
+			start := 100 + i*entrySize
+			if start+128 > uint64(len(data)) {
+				break
+			}
+			// EFI_PARTITION_ENTRY.PartitionName is a 36 character, NUL padded field at offset 56.
+			field := fmt.Sprintf("Partitions[%d].PartitionName", i)
+			out = append(out, checkUTF16String(field, readUTF16Units(data[start+56:start+128]), true)...)
+		}
+		return out
+	default:
+		return nil
+	}
+}
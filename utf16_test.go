@@ -0,0 +1,94 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func makeTestVariableEventData(name []uint16) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, efiGlobalVariableGUID)
+	binary.Write(&buf, binary.LittleEndian, uint64(len(name)))
+	binary.Write(&buf, binary.LittleEndian, uint64(1))
+	binary.Write(&buf, binary.LittleEndian, name)
+	buf.WriteByte(1)
+	return buf.Bytes()
+}
+
+func TestCheckUTF16StringsVariable(t *testing.T) {
+	for _, data := range []struct {
+		desc     string
+		name     []uint16
+		expected []UTF16Problem
+	}{
+		{
+			desc: "Valid",
+			name: convertStringToUtf16("SecureBoot"),
+		},
+		{
+			desc: "ValidSurrogatePair",
+			name: []uint16{'A', 0xd83d, 0xde00},
+		},
+		{
+			desc:     "UnpairedHighSurrogate",
+			name:     []uint16{'A', 0xd83d, 'B'},
+			expected: []UTF16Problem{{Kind: UTF16UnpairedSurrogate, Field: "UnicodeName", Offset: 1, Value: 0xd83d}},
+		},
+		{
+			desc:     "UnpairedLowSurrogate",
+			name:     []uint16{0xde00, 'B'},
+			expected: []UTF16Problem{{Kind: UTF16UnpairedSurrogate, Field: "UnicodeName", Offset: 0, Value: 0xde00}},
+		},
+		{
+			desc:     "EmbeddedNUL",
+			name:     []uint16{'d', 'b', 0},
+			expected: []UTF16Problem{{Kind: UTF16EmbeddedNUL, Field: "UnicodeName", Offset: 2, Value: 0}},
+		},
+		{
+			desc:     "ByteOrderMark",
+			name:     []uint16{0xfeff, 'd', 'b'},
+			expected: []UTF16Problem{{Kind: UTF16NonCanonical, Field: "UnicodeName", Offset: 0, Value: 0xfeff}},
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			event := &Event{EventType: EventTypeEFIVariableDriverConfig,
+				data: &opaqueEventData{data: makeTestVariableEventData(data.name)}}
+			problems := CheckUTF16Strings(event)
+			if len(problems) != len(data.expected) {
+				t.Fatalf("Unexpected problems: %v", problems)
+			}
+			for i, p := range problems {
+				if p != data.expected[i] {
+					t.Errorf("Unexpected problem: %v", p)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckUTF16StringsGPT(t *testing.T) {
+	data := make([]byte, 100+2*128)
+	binary.LittleEndian.PutUint32(data[84:], 128)
+	binary.LittleEndian.PutUint64(data[92:], 2)
+
+	name := convertStringToUtf16("EFI System")
+	for i, c := range name {
+		binary.LittleEndian.PutUint16(data[100+56+i*2:], c)
+	}
+	name = convertStringToUtf16("root")
+	for i, c := range name {
+		binary.LittleEndian.PutUint16(data[228+56+i*2:], c)
+	}
+	// Garbage after the terminator
+	binary.LittleEndian.PutUint16(data[228+56+20:], 'x')
+
+	problems := CheckUTF16Strings(&Event{EventType: EventTypeEFIGPTEvent, data: &opaqueEventData{data: data}})
+	if len(problems) != 1 {
+		t.Fatalf("Unexpected problems: %v", problems)
+	}
+	expected := UTF16Problem{Kind: UTF16EmbeddedNUL, Field: "Partitions[1].PartitionName", Offset: 4, Value: 0}
+	if problems[0] != expected {
+		t.Errorf("Unexpected problem: %v", problems[0])
+	}
+}
@@ -63,6 +63,86 @@ func ParseAlgorithm(alg string) (AlgorithmId, error) {
 	}
 }
 
+var knownEventTypes = [...]EventType{
+	EventTypePrebootCert,
+	EventTypePostCode,
+	EventTypeNoAction,
+	EventTypeSeparator,
+	EventTypeAction,
+	EventTypeEventTag,
+	EventTypeSCRTMContents,
+	EventTypeSCRTMVersion,
+	EventTypeCPUMicrocode,
+	EventTypePlatformConfigFlags,
+	EventTypeTableOfDevices,
+	EventTypeCompactHash,
+	EventTypeIPL,
+	EventTypeIPLPartitionData,
+	EventTypeNonhostCode,
+	EventTypeNonhostConfig,
+	EventTypeNonhostInfo,
+	EventTypeOmitBootDeviceEvents,
+	EventTypeEFIVariableDriverConfig,
+	EventTypeEFIVariableBoot,
+	EventTypeEFIBootServicesApplication,
+	EventTypeEFIBootServicesDriver,
+	EventTypeEFIRuntimeServicesDriver,
+	EventTypeEFIGPTEvent,
+	EventTypeEFIAction,
+	EventTypeEFIPlatformFirmwareBlob,
+	EventTypeEFIHandoffTables,
+	EventTypeEFIPlatformFirmwareBlob2,
+	EventTypeEFIHandoffTables2,
+	EventTypeEFIHCRTMEvent,
+	EventTypeEFIVariableAuthority,
+	EventTypeTXTPCRMapping,
+	EventTypeTXTHashStart,
+	EventTypeTXTCombinedHash,
+	EventTypeTXTMLEHash,
+	EventTypeTXTBIOSACRegData,
+	EventTypeTXTCPUSCRTMStat,
+	EventTypeTXTLCPControlHash,
+	EventTypeTXTElementsHash,
+	EventTypeTXTSTMHash,
+	EventTypeTXTOSSinitDataCapHash,
+	EventTypeTXTSinitPubKeyHash,
+	EventTypeTXTLCPHash,
+	EventTypeTXTLCPDetailsHash,
+	EventTypeTXTLCPAuthoritiesHash,
+	EventTypeTXTNVInfoHash,
+	EventTypeTXTColdBootBIOSHash,
+	EventTypeTXTKMHash,
+	EventTypeTXTBPMHash,
+	EventTypeTXTKMInfoHash,
+	EventTypeTXTBPMInfoHash,
+	EventTypeTXTBootPolHash,
+	EventTypeTXTRandomValue,
+	EventTypeTXTCapValue,
+}
+
+func isKnownEventType(t EventType) bool {
+	for _, k := range knownEventTypes {
+		if k == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseEventType converts the name of an event type (eg, "EV_EFI_ACTION") or its numeric value in to an EventType.
+func ParseEventType(str string) (EventType, error) {
+	for _, t := range knownEventTypes {
+		if t.String() == str {
+			return t, nil
+		}
+	}
+	v, err := strconv.ParseUint(str, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Unrecognized event type \"%s\"", str)
+	}
+	return EventType(v), nil
+}
+
 func convertStringToUtf16(str string) []uint16 {
 	var unicodePoints []rune
 	for len(str) > 0 {
@@ -2,7 +2,9 @@ package tcglog
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"os"
 )
@@ -25,14 +27,77 @@ type ValidatedEvent struct {
 	MeasuredBytes              []byte
 	MeasuredTrailingBytesCount int
 	IncorrectDigestValues      []IncorrectDigestValue
+
+	// PCRValueAfter contains the expected value of the PCR that this event is measured to, for each algorithm in
+	// the log, once this event and all of the events before it have been replayed. For events that don't extend the
+	// PCR, it is the same as the value after the previous event in the same PCR.
+	PCRValueAfter DigestMap
 }
 
+// LogValidateResult is the result of ReplayAndValidateLog. It isn't modified after it is returned, so a single result
+// can be shared by concurrent readers (eg, request handlers in a server) without synchronization, as long as they
+// don't modify it.
 type LogValidateResult struct {
 	EfiBootVariableBehaviour EFIBootVariableBehaviour
 	ValidatedEvents          []*ValidatedEvent
 	Spec                     Spec
 	Algorithms               AlgorithmIdList
-	ExpectedPCRValues        map[PCRIndex]DigestMap
+	ExpectedPCRValues        PCRValues // The values computed from the events in the main log only
+	Separators               map[PCRIndex]*SeparatorStatus
+	Startup                  *StartupInfo
+
+	// ExitBootServices describes the calls to ExitBootServices recorded in the main log and the final events table,
+	// if one was supplied.
+	ExitBootServices *ExitBootServicesInfo
+
+	// FinalEvents contains the events read from the final events table, if one was supplied, excluding those that
+	// duplicate events at the end of the main log.
+	FinalEvents []*ValidatedEvent
+
+	// DuplicateFinalEvents is the number of events at the start of the final events table that were skipped because
+	// they are also at the end of the main log.
+	DuplicateFinalEvents int
+
+	// ExpectedPCRValuesWithFinalEvents contains the values computed from the events in the main log followed by
+	// those in the final events table. It is nil if a final events table wasn't supplied.
+	ExpectedPCRValuesWithFinalEvents PCRValues
+}
+
+// HasTrailingMeasuredBytes indicates whether the bytes hashed and measured for this event include bytes at the end of
+// the event data that were not consumed by the decoder.
+func (e *ValidatedEvent) HasTrailingMeasuredBytes() bool {
+	return e.MeasuredTrailingBytesCount > 0
+}
+
+// TrailingBytes returns the bytes at the end of the event data that were not consumed by the decoder but which were
+// hashed and measured, or nil if there aren't any. These need to be taken in to account when computing updated
+// digests for this event.
+func (e *ValidatedEvent) TrailingBytes() []byte {
+	if !e.HasTrailingMeasuredBytes() {
+		return nil
+	}
+	return e.MeasuredBytes[len(e.MeasuredBytes)-e.MeasuredTrailingBytesCount:]
+}
+
+// ComputeEventDigests computes the digests of data for each of the specified algorithms, for use when predicting
+// the digests of an event. If includeTrailingBytes is true, the trailing measured bytes of the supplied event (see
+// ValidatedEvent.TrailingBytes) are appended to data before hashing, so that they are reproduced in the same way
+// that the firmware measured them. The supplied event may be nil if includeTrailingBytes is false.
+func ComputeEventDigests(algorithms AlgorithmIdList, data []byte, event *ValidatedEvent,
+	includeTrailingBytes bool) DigestMap {
+	var trailing []byte
+	if includeTrailingBytes && event != nil {
+		trailing = event.TrailingBytes()
+	}
+
+	digests := make(DigestMap)
+	for _, alg := range algorithms {
+		h := alg.newHash()
+		h.Write(data)
+		h.Write(trailing)
+		digests[alg] = h.Sum(nil)
+	}
+	return digests
 }
 
 func doesEventTypeExtendPCR(t EventType) bool {
@@ -50,16 +115,16 @@ func performHashExtendOperation(alg AlgorithmId, initial Digest, event Digest) D
 }
 
 func determineMeasuredBytes(event *Event, efiBootVariableQuirk bool) ([]byte, bool) {
-	switch d := event.Data.(type) {
+	switch d := event.Data().(type) {
 	case *opaqueEventData:
 		switch event.EventType {
 		case EventTypeEventTag, EventTypeSCRTMVersion, EventTypePlatformConfigFlags,
 			EventTypeTableOfDevices, EventTypeNonhostInfo, EventTypeOmitBootDeviceEvents:
-			return event.Data.Bytes(), false
+			return event.Data().Bytes(), false
 		}
 	case *separatorEventData:
 		if !d.isError {
-			return event.Data.Bytes(), false
+			return event.Data().Bytes(), false
 		} else {
 			out := make([]byte, 4)
 			binary.LittleEndian.PutUint32(out, separatorEventErrorValue)
@@ -68,16 +133,18 @@ func determineMeasuredBytes(event *Event, efiBootVariableQuirk bool) ([]byte, bo
 	case *asciiStringEventData:
 		switch event.EventType {
 		case EventTypeAction, EventTypeEFIAction:
-			return event.Data.Bytes(), false
+			return event.Data().Bytes(), false
 		}
-	case *EFIVariableEventData:
+	case efiVariableEventDataProvider:
 		if event.EventType == EventTypeEFIVariableBoot && efiBootVariableQuirk {
-			return d.VariableData, false
+			return d.variableEventData().VariableData, false
 		} else {
-			return event.Data.Bytes(), true
+			return event.Data().Bytes(), true
 		}
-	case *efiGPTEventData:
-		return event.Data.Bytes(), true
+	case *EFIGPTEventData:
+		return event.Data().Bytes(), true
+	case *SCRTMVersionEventData:
+		return event.Data().Bytes(), false
 	case *GrubStringEventData:
 		return []byte(d.Str), false
 	case *SystemdEFIStubEventData:
@@ -98,13 +165,22 @@ func isExpectedDigestValue(digest Digest, alg AlgorithmId, measuredBytes []byte)
 
 type logValidator struct {
 	log                      *Log
-	expectedPCRValues        map[PCRIndex]DigestMap
+	finalEvents              io.ReaderAt // The final events table, if there is one
+	options                  LogOptions
+	expectedPCRValues        PCRValues
 	efiBootVariableBehaviour EFIBootVariableBehaviour
-	validatedEvents          []*ValidatedEvent
+	pcr0Startup              pcr0Startup
+
+	// efiBootVariableBehaviourUnconfirmed indicates that efiBootVariableBehaviour was loaded from a previous run
+	// (see PlatformBehaviour) and hasn't been confirmed by an EV_EFI_VARIABLE_BOOT event in this log yet.
+	efiBootVariableBehaviourUnconfirmed bool
+
+	validatedEvents []*ValidatedEvent
 }
 
 func (v *logValidator) checkEventDigests(e *ValidatedEvent, trailingBytes int) {
-	for alg, digest := range e.Event.Digests {
+	for _, alg := range e.Event.Digests.Algorithms() {
+		digest := e.Event.Digests.Get(alg)
 		if len(e.MeasuredBytes) > 0 {
 			// We've already determined the bytes measured for this event for a previous digest
 			if ok, expected := isExpectedDigestValue(digest, alg, e.MeasuredBytes); !ok {
@@ -115,6 +191,7 @@ func (v *logValidator) checkEventDigests(e *ValidatedEvent, trailingBytes int) {
 		}
 
 		efiBootVariableBehaviourTry := v.efiBootVariableBehaviour
+		triedOtherEFIBootVariableBehaviour := false
 
 	Loop:
 		for {
@@ -137,12 +214,14 @@ func (v *logValidator) checkEventDigests(e *ValidatedEvent, trailingBytes int) {
 					// All good
 					e.MeasuredBytes = provisionalMeasuredBytes
 					e.MeasuredTrailingBytesCount = provisionalMeasuredTrailingBytes
-					if e.Event.EventType == EventTypeEFIVariableBoot && v.efiBootVariableBehaviour == EFIBootVariableBehaviourUnknown {
+					if e.Event.EventType == EventTypeEFIVariableBoot &&
+						(v.efiBootVariableBehaviour == EFIBootVariableBehaviourUnknown || v.efiBootVariableBehaviourUnconfirmed) {
 						// This is the first EV_EFI_VARIABLE_BOOT event, so record the measurement behaviour.
 						v.efiBootVariableBehaviour = efiBootVariableBehaviourTry
 						if efiBootVariableBehaviourTry == EFIBootVariableBehaviourUnknown {
 							v.efiBootVariableBehaviour = EFIBootVariableBehaviourFull
 						}
+						v.efiBootVariableBehaviourUnconfirmed = false
 					}
 					break Loop
 				case provisionalMeasuredTrailingBytes > 0:
@@ -159,6 +238,17 @@ func (v *logValidator) checkEventDigests(e *ValidatedEvent, trailingBytes int) {
 						efiBootVariableBehaviourTry = EFIBootVariableBehaviourVarDataOnly
 						continue Loop
 					}
+					if e.Event.EventType == EventTypeEFIVariableBoot && v.efiBootVariableBehaviourUnconfirmed &&
+						!triedOtherEFIBootVariableBehaviour {
+						// The behaviour loaded from a previous run isn't consistent with this log (eg, because the
+						// firmware was updated), so repeat the test with the other variant.
+						triedOtherEFIBootVariableBehaviour = true
+						efiBootVariableBehaviourTry = EFIBootVariableBehaviourVarDataOnly
+						if v.efiBootVariableBehaviour == EFIBootVariableBehaviourVarDataOnly {
+							efiBootVariableBehaviourTry = EFIBootVariableBehaviourFull
+						}
+						continue Loop
+					}
 					// Record the expected digest on the event
 					expectedMeasuredBytes, _ := determineMeasuredBytes(e.Event, false)
 					e.IncorrectDigestValues = append(
@@ -171,6 +261,48 @@ func (v *logValidator) checkEventDigests(e *ValidatedEvent, trailingBytes int) {
 	}
 }
 
+// reserveValidatedEvents grows the capacity of validatedEvents to the estimated number of events in the log when
+// it is full, which avoids repeatedly growing it for logs with thousands of events. If the estimate doesn't leave
+// enough headroom, this falls back to the normal growth of append.
+func (v *logValidator) reserveValidatedEvents() {
+	n := len(v.validatedEvents)
+	if n < cap(v.validatedEvents) {
+		return
+	}
+	estimate := v.log.estimatedEventCount()
+	estimate += estimate / 8
+	if estimate < n+n/8+1 {
+		return
+	}
+	events := make([]*ValidatedEvent, n, estimate)
+	copy(events, v.validatedEvents)
+	v.validatedEvents = events
+}
+
+// reinitializePCR0 initializes PCR 0 for the specified locality, and then extends it again with the supplied events,
+// which have already been processed (see pcr0Startup).
+func (v *logValidator) reinitializePCR0(locality uint8, replay []*Event) {
+	for _, alg := range v.log.Algorithms {
+		v.expectedPCRValues[0][alg] = initialPCRValue(alg, 0, locality)
+	}
+	for _, e := range replay {
+		for _, alg := range e.Digests.Algorithms() {
+			v.expectedPCRValues[0][alg] =
+				performHashExtendOperation(alg, v.expectedPCRValues[0][alg], e.Digests.Get(alg))
+		}
+		for _, ve := range v.validatedEvents {
+			if ve.Event != e {
+				continue
+			}
+			ve.PCRValueAfter = make(DigestMap, len(v.expectedPCRValues[0]))
+			for alg, digest := range v.expectedPCRValues[0] {
+				ve.PCRValueAfter[alg] = digest
+			}
+			break
+		}
+	}
+}
+
 func (v *logValidator) processEvent(event *Event, trailingBytes int) {
 	if _, exists := v.expectedPCRValues[event.PCRIndex]; !exists {
 		v.expectedPCRValues[event.PCRIndex] = DigestMap{}
@@ -180,49 +312,212 @@ func (v *logValidator) processEvent(event *Event, trailingBytes int) {
 	}
 
 	ve := &ValidatedEvent{Event: event}
+	v.reserveValidatedEvents()
 	v.validatedEvents = append(v.validatedEvents, ve)
 
-	if !doesEventTypeExtendPCR(event.EventType) {
-		return
+	if locality, replay, reinitialize := v.pcr0Startup.process(event); reinitialize {
+		v.reinitializePCR0(locality, replay)
 	}
 
-	for alg, digest := range event.Digests {
-		v.expectedPCRValues[event.PCRIndex][alg] =
-			performHashExtendOperation(alg, v.expectedPCRValues[event.PCRIndex][alg], digest)
+	if doesEventTypeExtendPCR(event.EventType) {
+		for _, alg := range event.Digests.Algorithms() {
+			v.expectedPCRValues[event.PCRIndex][alg] =
+				performHashExtendOperation(alg, v.expectedPCRValues[event.PCRIndex][alg], event.Digests.Get(alg))
+		}
+
+		v.checkEventDigests(ve, trailingBytes)
 	}
 
-	v.checkEventDigests(ve, trailingBytes)
+	// Extending a PCR always produces a new digest, so the digests can be shared with expectedPCRValues.
+	ve.PCRValueAfter = make(DigestMap, len(v.expectedPCRValues[event.PCRIndex]))
+	for alg, digest := range v.expectedPCRValues[event.PCRIndex] {
+		ve.PCRValueAfter[alg] = digest
+	}
 }
 
-func (v *logValidator) run() (*LogValidateResult, error) {
+func (v *logValidator) processEvents(ctx context.Context) error {
 	for {
-		event, trailingBytes, err := v.log.nextEventInternal()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		event, err := v.log.NextEvent()
 		if err != nil {
 			if err == io.EOF {
-				return &LogValidateResult{
-					EfiBootVariableBehaviour: v.efiBootVariableBehaviour,
-					ValidatedEvents:          v.validatedEvents,
-					Spec:                     v.log.Spec,
-					Algorithms:               v.log.Algorithms,
-					ExpectedPCRValues:        v.expectedPCRValues}, nil
+				return nil
 			}
+			return err
+		}
+		v.processEvent(event, event.trailingBytes())
+	}
+}
+
+func (v *logValidator) run(ctx context.Context) (*LogValidateResult, error) {
+	if err := v.processEvents(ctx); err != nil {
+		return nil, err
+	}
+
+	events := make([]*Event, 0, len(v.validatedEvents))
+	for _, e := range v.validatedEvents {
+		events = append(events, e.Event)
+	}
+	result := &LogValidateResult{
+		EfiBootVariableBehaviour: v.efiBootVariableBehaviour,
+		ValidatedEvents:          v.validatedEvents,
+		Spec:                     v.log.Spec,
+		Algorithms:               v.log.Algorithms,
+		ExpectedPCRValues:        v.expectedPCRValues,
+		Separators:               CheckSeparators(events),
+		Startup:                  DetermineStartupSequence(events),
+		ExitBootServices:         CheckExitBootServices(events)}
+
+	if v.finalEvents == nil {
+		return result, nil
+	}
+
+	// The final events continue from the PCR values and event indices of the main log, so this can only be opened
+	// once all of the events in the main log have been read.
+	finalEventsLog, err := NewFinalEventsLog(v.finalEvents, v.log, v.options)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open final events table: %v", err)
+	}
+	result.ExpectedPCRValues = v.expectedPCRValues.Copy()
+	v.log = finalEventsLog
+	v.validatedEvents = nil
+
+	var finalEvents []*Event
+	for {
+		if err := ctx.Err(); err != nil {
 			return nil, err
 		}
-		v.processEvent(event, trailingBytes)
+		event, err := finalEventsLog.NextEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot process final events table: %w", err)
+		}
+		finalEvents = append(finalEvents, event)
 	}
+
+	// Skip the events that were already returned in the main log, and renumber the remaining events so that their
+	// indices continue from the main log.
+	result.DuplicateFinalEvents = countDuplicateFinalEvents(events, finalEvents)
+	skipped := make(map[PCRIndex]uint)
+	for _, e := range finalEvents[:result.DuplicateFinalEvents] {
+		skipped[e.PCRIndex]++
+	}
+	for _, e := range finalEvents[result.DuplicateFinalEvents:] {
+		e.Index -= skipped[e.PCRIndex]
+		v.processEvent(e, e.trailingBytes())
+	}
+	result.FinalEvents = v.validatedEvents
+	for _, e := range v.validatedEvents {
+		events = append(events, e.Event)
+	}
+	result.ExitBootServices = CheckExitBootServices(events)
+	result.ExpectedPCRValuesWithFinalEvents = v.expectedPCRValues
+
+	return result, nil
 }
 
-func ReplayAndValidateLog(logPath string, options LogOptions) (*LogValidateResult, error) {
+// LastEventWithPCRValue returns the last event measured to the specified PCR after which the expected value of the
+// PCR for the specified algorithm is equal to value, searching the final events before the events in the main log.
+// When a PCR value read from the TPM is not consistent with the log, this identifies the event after which the log
+// diverges from what was measured. It returns nil if value doesn't match the value after any event, which is also
+// the case if value is the initial value of the PCR.
+func (r *LogValidateResult) LastEventWithPCRValue(pcr PCRIndex, alg AlgorithmId, value Digest) *ValidatedEvent {
+	for _, events := range [][]*ValidatedEvent{r.FinalEvents, r.ValidatedEvents} {
+		for i := len(events) - 1; i >= 0; i-- {
+			e := events[i]
+			if e.Event.PCRIndex == pcr && bytes.Equal(e.PCRValueAfter[alg], value) {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// countDuplicateFinalEvents returns the number of events at the start of finalEvents that are duplicates of the
+// events at the end of mainEvents. The firmware records every event measured after the first call to GetEventLog in
+// the final events table, but the log returned by a later call to GetEventLog also contains the events measured
+// before that call (eg, if the log was retrieved by the bootloader and then again by the OS loader, or if the OS has
+// already appended the final events to the log that it exports). The duplicates are the longest run of events at the
+// start of the table that matches the events at the end of the main log.
+func countDuplicateFinalEvents(mainEvents, finalEvents []*Event) int {
+	// https://trustedcomputinggroup.org/wp-content/uploads/EFI-Protocol-Specification-rev13-160330final.pdf
+	//  (section 7 "Final Events Table")
+	n := len(finalEvents)
+	if len(mainEvents) < n {
+		n = len(mainEvents)
+	}
+	for ; n > 0; n-- {
+		tail := mainEvents[len(mainEvents)-n:]
+		match := true
+		for i, e := range finalEvents[:n] {
+			if e.PCRIndex != tail[i].PCRIndex || !eventsEqual(e, tail[i]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return n
+		}
+	}
+	return 0
+}
+
+func replayAndValidateLogImpl(ctx context.Context, logPath, finalEventsPath string, options LogOptions,
+	behaviour *PlatformBehaviour) (*LogValidateResult, error) {
 	file, err := os.Open(logPath)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
 	log, err := NewLog(file, options)
 	if err != nil {
 		return nil, err
 	}
 
-	v := &logValidator{log: log, expectedPCRValues: make(map[PCRIndex]DigestMap)}
-	return v.run()
+	v := &logValidator{log: log, expectedPCRValues: make(PCRValues), options: options}
+	if behaviour != nil && behaviour.EFIBootVariableBehaviour != EFIBootVariableBehaviourUnknown {
+		v.efiBootVariableBehaviour = behaviour.EFIBootVariableBehaviour
+		v.efiBootVariableBehaviourUnconfirmed = true
+	}
+
+	if finalEventsPath != "" {
+		finalEventsFile, err := os.Open(finalEventsPath)
+		if err != nil {
+			return nil, err
+		}
+		defer finalEventsFile.Close()
+		v.finalEvents = finalEventsFile
+	}
+	return v.run(ctx)
+}
+
+func ReplayAndValidateLog(logPath string, options LogOptions) (*LogValidateResult, error) {
+	return ReplayAndValidateLogContext(context.Background(), logPath, options)
+}
+
+// ReplayAndValidateLogContext is like ReplayAndValidateLog, but stops and returns the error from ctx if it is
+// cancelled or its deadline expires before all of the events have been processed.
+func ReplayAndValidateLogContext(ctx context.Context, logPath string, options LogOptions) (*LogValidateResult, error) {
+	return replayAndValidateLogImpl(ctx, logPath, "", options, nil)
+}
+
+// ReplayAndValidateLogWithFinalEvents is like ReplayAndValidateLog, but also replays the events from the final events
+// table (EFI_TCG2_FINAL_EVENTS_TABLE) read from finalEventsPath after the events in the main log. Events at the start
+// of the table that duplicate events at the end of the main log are skipped (see LogValidateResult.
+// DuplicateFinalEvents). The expected PCR values both before and after the final events are returned in the result.
+func ReplayAndValidateLogWithFinalEvents(logPath, finalEventsPath string, options LogOptions) (*LogValidateResult,
+	error) {
+	return ReplayAndValidateLogWithFinalEventsContext(context.Background(), logPath, finalEventsPath, options)
+}
+
+// ReplayAndValidateLogWithFinalEventsContext is like ReplayAndValidateLogWithFinalEvents, but stops and returns the
+// error from ctx if it is cancelled or its deadline expires before all of the events have been processed.
+func ReplayAndValidateLogWithFinalEventsContext(ctx context.Context, logPath, finalEventsPath string,
+	options LogOptions) (*LogValidateResult, error) {
+	return replayAndValidateLogImpl(ctx, logPath, finalEventsPath, options, nil)
 }
@@ -0,0 +1,338 @@
+package tcglog
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestComputeEventDigestsWithTrailingBytes(t *testing.T) {
+	e := &ValidatedEvent{MeasuredBytes: []byte("foobar"), MeasuredTrailingBytesCount: 3}
+	if !e.HasTrailingMeasuredBytes() {
+		t.Fatalf("Expected trailing measured bytes")
+	}
+	if !bytes.Equal(e.TrailingBytes(), []byte("bar")) {
+		t.Errorf("Unexpected trailing bytes: %q", e.TrailingBytes())
+	}
+
+	algs := AlgorithmIdList{AlgorithmSha1, AlgorithmSha256}
+	digests := ComputeEventDigests(algs, []byte("baz"), e, true)
+	for _, alg := range algs {
+		if !bytes.Equal(digests[alg], alg.hash([]byte("bazbar"))) {
+			t.Errorf("Unexpected %s digest with trailing bytes", alg)
+		}
+	}
+	digests = ComputeEventDigests(algs, []byte("baz"), e, false)
+	for _, alg := range algs {
+		if !bytes.Equal(digests[alg], alg.hash([]byte("baz"))) {
+			t.Errorf("Unexpected %s digest without trailing bytes", alg)
+		}
+	}
+}
+
+func TestReplayAndValidateLogWithFinalEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+	logPath := filepath.Join(dir, "log")
+	if err := ioutil.WriteFile(logPath, makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(4, EventTypeEFIAction, []byte("Calling EFI Application from Boot Option"), algs...),
+		makeTestLogEvent(4, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...),
+	}), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	finalEventsPath := filepath.Join(dir, "final-events")
+	if err := ioutil.WriteFile(finalEventsPath, makeTestFinalEventsTable([]testLogEvent{
+		makeTestLogEvent(5, EventTypeEFIAction, []byte("Exit Boot Services Invocation"), algs...),
+	}), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	result, err := ReplayAndValidateLogWithFinalEvents(logPath, finalEventsPath, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayAndValidateLogWithFinalEvents failed: %v", err)
+	}
+	if len(result.ValidatedEvents) != 3 {
+		t.Errorf("Unexpected number of main log events: %d", len(result.ValidatedEvents))
+	}
+	if len(result.FinalEvents) != 1 {
+		t.Fatalf("Unexpected number of final events: %d", len(result.FinalEvents))
+	}
+	if result.ExitBootServices.Outcome != ExitBootServicesNoResult {
+		t.Errorf("Unexpected ExitBootServices outcome with final events: %s", result.ExitBootServices.Outcome)
+	}
+
+	for _, alg := range algs {
+		pcr4 := make(Digest, alg.size())
+		pcr4 = performHashExtendOperation(alg, pcr4, alg.hash([]byte("Calling EFI Application from Boot Option")))
+		pcr4 = performHashExtendOperation(alg, pcr4, alg.hash([]byte{0, 0, 0, 0}))
+		pcr5 := performHashExtendOperation(alg, make(Digest, alg.size()), alg.hash([]byte("Exit Boot Services Invocation")))
+
+		if !bytes.Equal(result.ExpectedPCRValues[4][alg], pcr4) {
+			t.Errorf("Unexpected %s value for PCR 4 from the main log", alg)
+		}
+		if _, exists := result.ExpectedPCRValues[5]; exists {
+			t.Errorf("PCR 5 shouldn't be extended by the main log")
+		}
+		if !bytes.Equal(result.ExpectedPCRValuesWithFinalEvents[4][alg], pcr4) {
+			t.Errorf("Unexpected %s value for PCR 4 with final events", alg)
+		}
+		if !bytes.Equal(result.ExpectedPCRValuesWithFinalEvents[5][alg], pcr5) {
+			t.Errorf("Unexpected %s value for PCR 5 with final events", alg)
+		}
+	}
+
+	result, err = ReplayAndValidateLog(logPath, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayAndValidateLog failed: %v", err)
+	}
+	if result.FinalEvents != nil || result.ExpectedPCRValuesWithFinalEvents != nil {
+		t.Errorf("Unexpected final events results without a final events table")
+	}
+	if result.ExitBootServices.Outcome != ExitBootServicesNotInvoked {
+		t.Errorf("Unexpected ExitBootServices outcome: %s", result.ExitBootServices.Outcome)
+	}
+}
+
+func TestReplayAndValidateLogWithDuplicateFinalEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	algs := []AlgorithmId{AlgorithmSha256}
+	boot := makeTestLogEvent(4, EventTypeEFIAction, []byte("Calling EFI Application from Boot Option"), algs...)
+	separator := makeTestLogEvent(4, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...)
+	grub := makeTestLogEvent(8, EventTypeIPL, []byte("grub_cmd: linux /vmlinuz"), algs...)
+	invocation := makeTestLogEvent(5, EventTypeEFIAction, []byte("Exit Boot Services Invocation"), algs...)
+	success := makeTestLogEvent(5, EventTypeEFIAction, []byte("Exit Boot Services Returned with Success"), algs...)
+
+	// The table was started when the bootloader first retrieved the log, so it also contains the events measured
+	// before the OS loader retrieved the log again.
+	logPath := filepath.Join(dir, "log")
+	if err := ioutil.WriteFile(logPath, makeTestLog_2(algs, []testLogEvent{boot, separator, grub, grub}),
+		0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	finalEventsPath := filepath.Join(dir, "final-events")
+	if err := ioutil.WriteFile(finalEventsPath, makeTestFinalEventsTable([]testLogEvent{grub, grub, invocation,
+		success}), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	result, err := ReplayAndValidateLogWithFinalEvents(logPath, finalEventsPath, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayAndValidateLogWithFinalEvents failed: %v", err)
+	}
+	if result.DuplicateFinalEvents != 2 {
+		t.Errorf("Unexpected number of duplicate final events: %d", result.DuplicateFinalEvents)
+	}
+	if len(result.FinalEvents) != 2 {
+		t.Fatalf("Unexpected number of final events: %d", len(result.FinalEvents))
+	}
+	for i, e := range result.FinalEvents {
+		if e.Event.PCRIndex != 5 || e.Event.Index != uint(i) {
+			t.Errorf("Unexpected final event %d: PCR %d, index %d", i, e.Event.PCRIndex, e.Event.Index)
+		}
+	}
+	if result.ExitBootServices.Outcome != ExitBootServicesSucceeded {
+		t.Errorf("Unexpected ExitBootServices outcome: %s", result.ExitBootServices.Outcome)
+	}
+	if !bytes.Equal(result.ExpectedPCRValuesWithFinalEvents[8][AlgorithmSha256],
+		result.ExpectedPCRValues[8][AlgorithmSha256]) {
+		t.Errorf("Duplicate final events were replayed")
+	}
+
+	// A table that only contains events that aren't in the main log is replayed in full.
+	if err := ioutil.WriteFile(finalEventsPath, makeTestFinalEventsTable([]testLogEvent{invocation, success}),
+		0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	result, err = ReplayAndValidateLogWithFinalEvents(logPath, finalEventsPath, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayAndValidateLogWithFinalEvents failed: %v", err)
+	}
+	if result.DuplicateFinalEvents != 0 || len(result.FinalEvents) != 2 {
+		t.Errorf("Unexpected final events: %d duplicates, %d events", result.DuplicateFinalEvents,
+			len(result.FinalEvents))
+	}
+}
+
+func TestReplayAndValidateLogWithFinalEventsHugeEventCount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	algs := []AlgorithmId{AlgorithmSha256}
+	logPath := filepath.Join(dir, "log")
+	if err := ioutil.WriteFile(logPath, makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(4, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...)}), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// The event count in the header isn't trusted for preallocating storage for the validated events.
+	table := makeTestFinalEventsTable([]testLogEvent{
+		makeTestLogEvent(5, EventTypeEFIAction, []byte("Exit Boot Services Invocation"), algs...)})
+	binary.LittleEndian.PutUint64(table[8:], 1<<40)
+	finalEventsPath := filepath.Join(dir, "final-events")
+	if err := ioutil.WriteFile(finalEventsPath, table, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	result, err := ReplayAndValidateLogWithFinalEvents(logPath, finalEventsPath, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayAndValidateLogWithFinalEvents failed: %v", err)
+	}
+	if len(result.FinalEvents) != 1 {
+		t.Errorf("Unexpected number of final events: %d", len(result.FinalEvents))
+	}
+	if c := cap(result.FinalEvents); c > maxEstimatedEventCount+maxEstimatedEventCount/8 {
+		t.Errorf("Unexpected capacity: %d", c)
+	}
+}
+
+func TestReplayAndValidateLogHCRTM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	algs := []AlgorithmId{AlgorithmSha256}
+	hcrtm := makeTestLogEvent(0, EventTypeEFIHCRTMEvent, []byte("HCRTM"), algs...)
+	hcrtm.digests[0].digest = AlgorithmSha256.hash([]byte("hcrtm"))
+	locality := makeTestLogEvent(0, EventTypeNoAction, []byte("StartupLocality\x00\x04"), algs...)
+	locality.digests[0].digest = make(Digest, 32)
+	crtm := makeTestLogEvent(0, EventTypeSCRTMVersion, []byte("1.0"), algs...)
+
+	initial := make(Digest, 32)
+	initial[31] = 4
+	afterHCRTM := performHashExtendOperation(AlgorithmSha256, initial, hcrtm.digests[0].digest)
+	expected := performHashExtendOperation(AlgorithmSha256, afterHCRTM, crtm.digests[0].digest)
+
+	for _, data := range []struct {
+		desc   string
+		events []testLogEvent
+	}{
+		{desc: "LocalityFirst", events: []testLogEvent{locality, hcrtm, crtm}},
+		{desc: "LocalityAfterHCRTM", events: []testLogEvent{hcrtm, locality, crtm}},
+		{desc: "NoLocality", events: []testLogEvent{hcrtm, crtm}},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			logPath := filepath.Join(dir, data.desc)
+			if err := ioutil.WriteFile(logPath, makeTestLog_2(algs, data.events), 0644); err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+			result, err := ReplayAndValidateLog(logPath, LogOptions{})
+			if err != nil {
+				t.Fatalf("ReplayAndValidateLog failed: %v", err)
+			}
+			if !bytes.Equal(result.ExpectedPCRValues[0][AlgorithmSha256], expected) {
+				t.Errorf("Unexpected PCR 0 value: %x", result.ExpectedPCRValues[0][AlgorithmSha256])
+			}
+			for _, e := range result.ValidatedEvents {
+				if e.Event.EventType == EventTypeEFIHCRTMEvent &&
+					!bytes.Equal(e.PCRValueAfter[AlgorithmSha256], afterHCRTM) {
+					t.Errorf("Unexpected PCR value after H-CRTM event: %x", e.PCRValueAfter[AlgorithmSha256])
+				}
+			}
+			if result.Startup.Sequence != StartupSequenceHCRTM {
+				t.Errorf("Unexpected startup sequence: %s", result.Startup.Sequence)
+			}
+		})
+	}
+}
+
+func TestReplayAndValidateLogContextCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	algs := []AlgorithmId{AlgorithmSha256}
+	logPath := filepath.Join(dir, "log")
+	if err := ioutil.WriteFile(logPath, makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(4, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...),
+	}), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := ReplayAndValidateLogContext(ctx, logPath, LogOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := ReplayAndValidateLogContext(context.Background(), logPath, LogOptions{}); err != nil {
+		t.Errorf("ReplayAndValidateLogContext failed: %v", err)
+	}
+}
+
+func TestPCRValueAfter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcglog-test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	algs := []AlgorithmId{AlgorithmSha1, AlgorithmSha256}
+	logPath := filepath.Join(dir, "log")
+	if err := ioutil.WriteFile(logPath, makeTestLog_2(algs, []testLogEvent{
+		makeTestLogEvent(4, EventTypeEFIAction, []byte("Calling EFI Application from Boot Option"), algs...),
+		makeTestLogEvent(5, EventTypeEFIAction, []byte("Exit Boot Services Invocation"), algs...),
+		makeTestLogEvent(4, EventTypeSeparator, []byte{0, 0, 0, 0}, algs...),
+	}), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	result, err := ReplayAndValidateLog(logPath, LogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayAndValidateLog failed: %v", err)
+	}
+	if len(result.ValidatedEvents) != 4 {
+		t.Fatalf("Unexpected number of events: %d", len(result.ValidatedEvents))
+	}
+
+	for _, alg := range algs {
+		pcr4 := performHashExtendOperation(alg, make(Digest, alg.size()),
+			alg.hash([]byte("Calling EFI Application from Boot Option")))
+		pcr5 := performHashExtendOperation(alg, make(Digest, alg.size()), alg.hash([]byte("Exit Boot Services Invocation")))
+
+		// The spec ID event doesn't extend PCR 0.
+		if !bytes.Equal(result.ValidatedEvents[0].PCRValueAfter[alg], make(Digest, alg.size())) {
+			t.Errorf("Unexpected %s value after event 0", alg)
+		}
+		if !bytes.Equal(result.ValidatedEvents[1].PCRValueAfter[alg], pcr4) {
+			t.Errorf("Unexpected %s value after event 1", alg)
+		}
+		if !bytes.Equal(result.ValidatedEvents[2].PCRValueAfter[alg], pcr5) {
+			t.Errorf("Unexpected %s value after event 2", alg)
+		}
+		if !bytes.Equal(result.ValidatedEvents[3].PCRValueAfter[alg], result.ExpectedPCRValues[4][alg]) {
+			t.Errorf("Unexpected %s value after event 3", alg)
+		}
+
+		if e := result.LastEventWithPCRValue(4, alg, pcr4); e != result.ValidatedEvents[1] {
+			t.Errorf("Unexpected event with intermediate %s value: %v", alg, e)
+		}
+		if e := result.LastEventWithPCRValue(4, alg, result.ExpectedPCRValues[4][alg]); e != result.ValidatedEvents[3] {
+			t.Errorf("Unexpected event with final %s value: %v", alg, e)
+		}
+		if e := result.LastEventWithPCRValue(4, alg, pcr5); e != nil {
+			t.Errorf("Unexpected event with value from another PCR: %v", e)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package tcglog
+
+// EFIVariableEvent is an event that measures an EFI variable.
+type EFIVariableEvent struct {
+	Event    *ValidatedEvent
+	Variable *EFIVariableEventData
+}
+
+// wellKnownVariableGUID returns the GUID of the namespace that a well-known variable belongs to.
+func wellKnownVariableGUID(name string) (EFIGUID, bool) {
+	switch {
+	case name == "SecureBoot" || name == "PK" || name == "KEK" || name == "BootOrder" || name == "BootCurrent" ||
+		name == "BootNext" || name == "SetupMode" || name == "AuditMode" || name == "DeployedMode" ||
+		isBootOptionVariable(efiGlobalVariableGUID, name):
+		return efiGlobalVariableGUID, true
+	case name == "db" || name == "dbx" || name == "dbt" || name == "dbr":
+		return efiImageSecurityDatabaseGUID, true
+	case name == "SbatLevel" || name == "MokList" || name == "MokListX" || name == "MokSBState":
+		return shimLockGUID, true
+	default:
+		return EFIGUID{}, false
+	}
+}
+
+// VariableEventsWithGUID returns the events of any type that measure the EFI variable with the specified GUID and
+// name, in the order in which they appear in the log.
+func (r *LogValidateResult) VariableEventsWithGUID(guid EFIGUID, name string) []*EFIVariableEvent {
+	var out []*EFIVariableEvent
+	for _, e := range r.ValidatedEvents {
+		d, ok := e.Event.Data().(efiVariableEventDataProvider)
+		if !ok {
+			continue
+		}
+		v := d.variableEventData()
+		if v.VariableName != guid || v.UnicodeName != name {
+			continue
+		}
+		out = append(out, &EFIVariableEvent{Event: e, Variable: v})
+	}
+	return out
+}
+
+// VariableEvents returns the events of any type that measure the EFI variable with the specified name, in the order
+// in which they appear in the log. The name is resolved to the correct namespace for well-known variables (eg,
+// SecureBoot, PK and KEK are in the global namespace, and db and dbx are in the image security database namespace).
+// Variables with other names are matched in any namespace.
+func (r *LogValidateResult) VariableEvents(name string) []*EFIVariableEvent {
+	if guid, ok := wellKnownVariableGUID(name); ok {
+		return r.VariableEventsWithGUID(guid, name)
+	}
+
+	var out []*EFIVariableEvent
+	for _, e := range r.ValidatedEvents {
+		d, ok := e.Event.Data().(efiVariableEventDataProvider)
+		if !ok {
+			continue
+		}
+		if v := d.variableEventData(); v.UnicodeName == name {
+			out = append(out, &EFIVariableEvent{Event: e, Variable: v})
+		}
+	}
+	return out
+}
+
+func (r *LogValidateResult) driverConfigMeasurements(name string) []*EFIVariableEvent {
+	var out []*EFIVariableEvent
+	for _, e := range r.VariableEvents(name) {
+		if e.Event.Event.EventType == EventTypeEFIVariableDriverConfig {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// SecureBootMeasurements returns the EV_EFI_VARIABLE_DRIVER_CONFIG events that measure the SecureBoot variable.
+func (r *LogValidateResult) SecureBootMeasurements() []*EFIVariableEvent {
+	return r.driverConfigMeasurements("SecureBoot")
+}
+
+// PKMeasurements returns the EV_EFI_VARIABLE_DRIVER_CONFIG events that measure the PK variable.
+func (r *LogValidateResult) PKMeasurements() []*EFIVariableEvent {
+	return r.driverConfigMeasurements("PK")
+}
+
+// KEKMeasurements returns the EV_EFI_VARIABLE_DRIVER_CONFIG events that measure the KEK variable.
+func (r *LogValidateResult) KEKMeasurements() []*EFIVariableEvent {
+	return r.driverConfigMeasurements("KEK")
+}
+
+// DbMeasurements returns the EV_EFI_VARIABLE_DRIVER_CONFIG events that measure the db variable. The
+// EV_EFI_VARIABLE_AUTHORITY events for entries in db that were used to authorize images can be obtained with
+// AuthorityMeasurements.
+func (r *LogValidateResult) DbMeasurements() []*EFIVariableEvent {
+	return r.driverConfigMeasurements("db")
+}
+
+// DbxMeasurements returns the EV_EFI_VARIABLE_DRIVER_CONFIG events that measure the dbx variable.
+func (r *LogValidateResult) DbxMeasurements() []*EFIVariableEvent {
+	return r.driverConfigMeasurements("dbx")
+}
+
+// AuthorityMeasurements returns all of the EV_EFI_VARIABLE_AUTHORITY events.
+func (r *LogValidateResult) AuthorityMeasurements() []*EFIVariableEvent {
+	var out []*EFIVariableEvent
+	for _, e := range r.ValidatedEvents {
+		if e.Event.EventType != EventTypeEFIVariableAuthority {
+			continue
+		}
+		d, ok := e.Event.Data().(efiVariableEventDataProvider)
+		if !ok {
+			continue
+		}
+		out = append(out, &EFIVariableEvent{Event: e, Variable: d.variableEventData()})
+	}
+	return out
+}
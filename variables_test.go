@@ -0,0 +1,44 @@
+package tcglog
+
+import (
+	"testing"
+)
+
+func TestLogValidateResultVariableEvents(t *testing.T) {
+	makeEvent := func(t EventType, guid EFIGUID, name string) *ValidatedEvent {
+		return &ValidatedEvent{Event: &Event{PCRIndex: 7, EventType: t,
+			data: &EFIVariableEventData{VariableName: guid, UnicodeName: name}}}
+	}
+	bogus := *NewEFIGUID(0x12345678, 0x1234, 0x5678, 0x9abc, [...]uint8{0, 1, 2, 3, 4, 5})
+
+	result := &LogValidateResult{ValidatedEvents: []*ValidatedEvent{
+		makeEvent(EventTypeEFIVariableDriverConfig, efiGlobalVariableGUID, "SecureBoot"),
+		makeEvent(EventTypeEFIVariableDriverConfig, efiImageSecurityDatabaseGUID, "db"),
+		makeEvent(EventTypeEFIVariableDriverConfig, bogus, "db"),
+		makeEvent(EventTypeEFIVariableAuthority, efiImageSecurityDatabaseGUID, "db"),
+		makeEvent(EventTypeEFIVariableDriverConfig, bogus, "Custom"),
+		{Event: &Event{PCRIndex: 7, EventType: EventTypeSeparator, data: &separatorEventData{}}},
+	}}
+
+	if e := result.SecureBootMeasurements(); len(e) != 1 || e[0].Event != result.ValidatedEvents[0] {
+		t.Errorf("Unexpected SecureBoot measurements")
+	}
+	if e := result.DbMeasurements(); len(e) != 1 || e[0].Event != result.ValidatedEvents[1] {
+		t.Errorf("Unexpected db measurements")
+	}
+	if e := result.VariableEvents("db"); len(e) != 2 || e[1].Event != result.ValidatedEvents[3] {
+		t.Errorf("Unexpected db events")
+	}
+	if e := result.VariableEvents("Custom"); len(e) != 1 || e[0].Variable.VariableName != bogus {
+		t.Errorf("Unexpected Custom events")
+	}
+	if e := result.VariableEventsWithGUID(bogus, "db"); len(e) != 1 || e[0].Event != result.ValidatedEvents[2] {
+		t.Errorf("Unexpected events for db with a non-standard GUID")
+	}
+	if e := result.AuthorityMeasurements(); len(e) != 1 || e[0].Event != result.ValidatedEvents[3] {
+		t.Errorf("Unexpected authority measurements")
+	}
+	if e := result.DbxMeasurements(); len(e) != 0 {
+		t.Errorf("Unexpected dbx measurements")
+	}
+}
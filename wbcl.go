@@ -0,0 +1,263 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// SIPAEventType corresponds to the type of a SIPA event, which is the namespace that Windows uses for the events
+// contained in EV_EVENT_TAG events in a Windows Boot Configuration Log (WBCL). These are mostly measured to PCRs
+// 11-14.
+type SIPAEventType uint32
+
+const (
+	sipaEventTypeNonMeasured SIPAEventType = 0x80000000 // SIPAEVENTTYPE_NONMEASURED
+	sipaEventTypeAggregation SIPAEventType = 0x40000000 // SIPAEVENTTYPE_AGGREGATION
+	sipaEventTypeMask        SIPAEventType = 0x000f0000
+	sipaEventTypeContainer   SIPAEventType = 0x00010000 // SIPAEVENTTYPE_CONTAINER
+)
+
+type sipaValueFormat int
+
+const (
+	sipaValueBytes sipaValueFormat = iota
+	sipaValueString
+	sipaValueBool
+	sipaValueUint
+)
+
+var sipaEventTypes = map[SIPAEventType]struct {
+	name   string
+	format sipaValueFormat
+}{
+	0x40010001: {"SIPAEVENT_TRUSTBOUNDARY", sipaValueBytes},
+	0x40010002: {"SIPAEVENT_ELAM_AGGREGATION", sipaValueBytes},
+	0x40010003: {"SIPAEVENT_LOADEDMODULE_AGGREGATION", sipaValueBytes},
+	0xc0010004: {"SIPAEVENT_TRUSTPOINT_AGGREGATION", sipaValueBytes},
+	0x40010005: {"SIPAEVENT_KSR_AGGREGATION", sipaValueBytes},
+	0x40010006: {"SIPAEVENT_KSR_SIGNED_MEASUREMENT_AGGREGATION", sipaValueBytes},
+	0x00020001: {"SIPAEVENT_INFORMATION", sipaValueBytes},
+	0x00020002: {"SIPAEVENT_BOOTCOUNTER", sipaValueUint},
+	0x00020003: {"SIPAEVENT_TRANSFER_CONTROL", sipaValueUint},
+	0x00020004: {"SIPAEVENT_APPLICATION_RETURN", sipaValueUint},
+	0x00020005: {"SIPAEVENT_BITLOCKER_UNLOCK", sipaValueUint},
+	0x00020006: {"SIPAEVENT_EVENTCOUNTER", sipaValueUint},
+	0x00020007: {"SIPAEVENT_COUNTERID", sipaValueUint},
+	0x00020008: {"SIPAEVENT_MORBIT_NOT_CANCELABLE", sipaValueUint},
+	0x00020009: {"SIPAEVENT_APPLICATION_SVN", sipaValueUint},
+	0x0002000a: {"SIPAEVENT_SVN_CHAIN_STATUS", sipaValueUint},
+	0x0002000b: {"SIPAEVENT_MORBIT_API_STATUS", sipaValueUint},
+	0x00040001: {"SIPAEVENT_BOOTDEBUGGING", sipaValueBool},
+	0x00040002: {"SIPAEVENT_BOOT_REVOCATION_LIST", sipaValueBytes},
+	0x00050001: {"SIPAEVENT_OSKERNELDEBUG", sipaValueBool},
+	0x00050002: {"SIPAEVENT_CODEINTEGRITY", sipaValueBool},
+	0x00050003: {"SIPAEVENT_TESTSIGNING", sipaValueBool},
+	0x00050004: {"SIPAEVENT_DATAEXECUTIONPREVENTION", sipaValueUint},
+	0x00050005: {"SIPAEVENT_SAFEMODE", sipaValueBool},
+	0x00050006: {"SIPAEVENT_WINPE", sipaValueBool},
+	0x00050007: {"SIPAEVENT_PHYSICALADDRESSEXTENSION", sipaValueUint},
+	0x00050008: {"SIPAEVENT_OSDEVICE", sipaValueUint},
+	0x00050009: {"SIPAEVENT_SYSTEMROOT", sipaValueString},
+	0x0005000a: {"SIPAEVENT_HYPERVISOR_LAUNCH_TYPE", sipaValueUint},
+	0x0005000b: {"SIPAEVENT_HYPERVISOR_PATH", sipaValueString},
+	0x0005000c: {"SIPAEVENT_HYPERVISOR_IOMMU_POLICY", sipaValueUint},
+	0x0005000d: {"SIPAEVENT_HYPERVISOR_DEBUG", sipaValueBool},
+	0x0005000e: {"SIPAEVENT_DRIVER_LOAD_POLICY", sipaValueUint},
+	0x0005000f: {"SIPAEVENT_SI_POLICY", sipaValueBytes},
+	0x00050010: {"SIPAEVENT_HYPERVISOR_MMIO_NX_POLICY", sipaValueUint},
+	0x00050011: {"SIPAEVENT_HYPERVISOR_MSR_FILTER_POLICY", sipaValueUint},
+	0x00050012: {"SIPAEVENT_VSM_LAUNCH_TYPE", sipaValueUint},
+	0x00050013: {"SIPAEVENT_OS_REVOCATION_LIST", sipaValueBytes},
+	0x00050014: {"SIPAEVENT_SMT_STATUS", sipaValueUint},
+	0x00050020: {"SIPAEVENT_VSM_IDK_INFO", sipaValueBytes},
+	0x00050021: {"SIPAEVENT_FLIGHTSIGNING", sipaValueBool},
+	0x00050022: {"SIPAEVENT_PAGEFILE_ENCRYPTION_ENABLED", sipaValueBool},
+	0x00050023: {"SIPAEVENT_VSM_IDKS_INFO", sipaValueBytes},
+	0x00050024: {"SIPAEVENT_HIBERNATION_DISABLED", sipaValueBool},
+	0x00050025: {"SIPAEVENT_DUMPS_DISABLED", sipaValueBool},
+	0x00050026: {"SIPAEVENT_DUMP_ENCRYPTION_ENABLED", sipaValueBool},
+	0x00050027: {"SIPAEVENT_DUMP_ENCRYPTION_KEY_DIGEST", sipaValueBytes},
+	0x00050028: {"SIPAEVENT_LSAISO_CONFIG", sipaValueUint},
+	0x00050029: {"SIPAEVENT_SBCP_INFO", sipaValueBytes},
+	0x00050030: {"SIPAEVENT_HYPERVISOR_BOOT_DMA_PROTECTION", sipaValueUint},
+	0x00060001: {"SIPAEVENT_NOAUTHORITY", sipaValueBytes},
+	0x00060002: {"SIPAEVENT_AUTHORITYPUBKEY", sipaValueBytes},
+	0x00070001: {"SIPAEVENT_FILEPATH", sipaValueString},
+	0x00070002: {"SIPAEVENT_IMAGESIZE", sipaValueUint},
+	0x00070003: {"SIPAEVENT_HASHALGORITHMID", sipaValueUint},
+	0x00070004: {"SIPAEVENT_AUTHENTICODEHASH", sipaValueBytes},
+	0x00070005: {"SIPAEVENT_AUTHORITYISSUER", sipaValueString},
+	0x00070006: {"SIPAEVENT_AUTHORITYSERIAL", sipaValueBytes},
+	0x00070007: {"SIPAEVENT_IMAGEBASE", sipaValueUint},
+	0x00070008: {"SIPAEVENT_AUTHORITYPUBLISHER", sipaValueString},
+	0x00070009: {"SIPAEVENT_AUTHORITYSHA1THUMBPRINT", sipaValueBytes},
+	0x0007000a: {"SIPAEVENT_IMAGEVALIDATED", sipaValueBool},
+	0x0007000b: {"SIPAEVENT_MODULE_SVN", sipaValueUint},
+	0x80080001: {"SIPAEVENT_QUOTE", sipaValueBytes},
+	0x80080002: {"SIPAEVENT_QUOTESIGNATURE", sipaValueBytes},
+	0x80080003: {"SIPAEVENT_AIKID", sipaValueBytes},
+	0x80080004: {"SIPAEVENT_AIKPUBDIGEST", sipaValueBytes},
+	0x00090001: {"SIPAEVENT_ELAM_KEYNAME", sipaValueString},
+	0x00090002: {"SIPAEVENT_ELAM_CONFIGURATION", sipaValueBytes},
+	0x00090003: {"SIPAEVENT_ELAM_POLICY", sipaValueBytes},
+	0x00090004: {"SIPAEVENT_ELAM_MEASURED", sipaValueBytes},
+}
+
+func (t SIPAEventType) String() string {
+	if info, ok := sipaEventTypes[t]; ok {
+		return info.name
+	}
+	return fmt.Sprintf("SIPAEVENT(0x%08x)", uint32(t))
+}
+
+// IsContainer indicates whether events of this type contain other SIPA events.
+func (t SIPAEventType) IsContainer() bool {
+	return t&sipaEventTypeMask == sipaEventTypeContainer
+}
+
+// IsMeasured indicates whether events of this type contribute to the measurement of the containing event.
+func (t SIPAEventType) IsMeasured() bool {
+	return t&sipaEventTypeNonMeasured == 0
+}
+
+// SIPAEvent corresponds to a single SIPA event inside the event data of an EV_EVENT_TAG event in a WBCL.
+type SIPAEvent struct {
+	Type     SIPAEventType
+	Data     []byte       // The event payload. For containers, this is the encoded child events
+	Children []*SIPAEvent // The child events, if this is a container
+}
+
+func decodeSIPAString(data []byte) string {
+	u16 := make([]uint16, len(data)/2)
+	for i := range u16 {
+		u16[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	for i, c := range u16 {
+		if c == 0 {
+			u16 = u16[:i]
+			break
+		}
+	}
+	return string(utf16.Decode(u16))
+}
+
+func (e *SIPAEvent) valueString() string {
+	switch sipaEventTypes[e.Type].format {
+	case sipaValueString:
+		return fmt.Sprintf("\"%s\"", decodeSIPAString(e.Data))
+	case sipaValueBool:
+		if len(e.Data) == 1 {
+			return fmt.Sprintf("%t", e.Data[0] != 0)
+		}
+	case sipaValueUint:
+		switch len(e.Data) {
+		case 1:
+			return fmt.Sprintf("%d", e.Data[0])
+		case 2:
+			return fmt.Sprintf("%d", binary.LittleEndian.Uint16(e.Data))
+		case 4:
+			return fmt.Sprintf("%d", binary.LittleEndian.Uint32(e.Data))
+		case 8:
+			return fmt.Sprintf("%d", binary.LittleEndian.Uint64(e.Data))
+		}
+	}
+	return fmt.Sprintf("%x", e.Data)
+}
+
+func (e *SIPAEvent) String() string {
+	if !e.Type.IsContainer() {
+		return fmt.Sprintf("%s: %s", e.Type, e.valueString())
+	}
+	var builder bytes.Buffer
+	fmt.Fprintf(&builder, "%s{ ", e.Type)
+	for i, c := range e.Children {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString(c.String())
+	}
+	builder.WriteString(" }")
+	return builder.String()
+}
+
+// decodeSIPAEvents decodes a sequence of SIPA events. It returns the number of bytes at the end of data that are too
+// short to contain another event.
+func decodeSIPAEvents(data []byte, depth int, limits decodeLimits) ([]*SIPAEvent, int, error) {
+	if depth > limits.nestingDepth() {
+		return nil, 0, &DecodeLimitError{Kind: DecodeLimitNestingDepth, Limit: limits.nestingDepth()}
+	}
+
+	var events []*SIPAEvent
+	for len(data) >= 8 {
+		t := SIPAEventType(binary.LittleEndian.Uint32(data))
+		size := binary.LittleEndian.Uint32(data[4:])
+		if uint64(size) > uint64(len(data)-8) {
+			return nil, 0, fmt.Errorf("%s event has a size (%d) that exceeds the remaining data (%d)", t, size,
+				len(data)-8)
+		}
+		e := &SIPAEvent{Type: t, Data: data[8 : 8+size]}
+		if t.IsContainer() {
+			children, trailing, err := decodeSIPAEvents(e.Data, depth+1, limits)
+			if err != nil {
+				return nil, 0, err
+			}
+			if trailing > 0 {
+				return nil, 0, fmt.Errorf("%s event has %d trailing bytes", t, trailing)
+			}
+			e.Children = children
+		}
+		events = append(events, e)
+		data = data[8+size:]
+	}
+	return events, len(data), nil
+}
+
+// SIPAEventData corresponds to the event data of an EV_EVENT_TAG event in a Windows Boot Configuration Log, which
+// contains a sequence of SIPA events. WBCL files (eg, those exported from C:\Windows\Logs\MeasuredBoot) use the same
+// format as other TCG logs and can be read with NewLog by setting LogOptions.EnableWindowsSIPA.
+type SIPAEventData struct {
+	data   []byte
+	Events []*SIPAEvent
+}
+
+func (e *SIPAEventData) String() string {
+	var builder bytes.Buffer
+	for i, s := range e.Events {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString(s.String())
+	}
+	return builder.String()
+}
+
+func (e *SIPAEventData) Bytes() []byte {
+	return e.data
+}
+
+// Find returns the first SIPA event with the specified type, searching inside containers.
+func (e *SIPAEventData) Find(t SIPAEventType) (*SIPAEvent, bool) {
+	var find func(events []*SIPAEvent) (*SIPAEvent, bool)
+	find = func(events []*SIPAEvent) (*SIPAEvent, bool) {
+		for _, s := range events {
+			if s.Type == t {
+				return s, true
+			}
+			if r, ok := find(s.Children); ok {
+				return r, true
+			}
+		}
+		return nil, false
+	}
+	return find(e.Events)
+}
+
+func decodeEventDataSIPA(data []byte, limits decodeLimits) (out EventData, trailingBytes int, err error) {
+	events, trailingBytes, err := decodeSIPAEvents(data, 0, limits)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &SIPAEventData{data: data, Events: events}, trailingBytes, nil
+}
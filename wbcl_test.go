@@ -0,0 +1,69 @@
+package tcglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func encodeTestSIPAEvent(t SIPAEventType, data []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(t))
+	binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestDecodeEventDataSIPA(t *testing.T) {
+	var path bytes.Buffer
+	binary.Write(&path, binary.LittleEndian, append(convertStringToUtf16("\\Windows\\system32\\winload.efi"), 0))
+
+	var module bytes.Buffer
+	module.Write(encodeTestSIPAEvent(0x00070001, path.Bytes()))
+	module.Write(encodeTestSIPAEvent(0x00070002, []byte{0x00, 0x10, 0, 0, 0, 0, 0, 0}))
+
+	var data bytes.Buffer
+	data.Write(encodeTestSIPAEvent(0x40010003, module.Bytes()))
+	data.Write(encodeTestSIPAEvent(0x00050003, []byte{0}))
+	data.Write([]byte{0xff, 0xff})
+
+	event, trailing := decodeEventData(13, EventTypeEventTag, data.Bytes(), &LogOptions{EnableWindowsSIPA: true}, false)
+	d, ok := event.(*SIPAEventData)
+	if !ok {
+		t.Fatalf("Unexpected event data type: %T (%s)", event, event)
+	}
+	if trailing != 2 {
+		t.Errorf("Unexpected trailing bytes: %d", trailing)
+	}
+	if len(d.Events) != 2 || !d.Events[0].Type.IsContainer() || len(d.Events[0].Children) != 2 {
+		t.Fatalf("Unexpected events: %s", d)
+	}
+
+	expected := "SIPAEVENT_LOADEDMODULE_AGGREGATION{ SIPAEVENT_FILEPATH: \"\\Windows\\system32\\winload.efi\", " +
+		"SIPAEVENT_IMAGESIZE: 4096 }, SIPAEVENT_TESTSIGNING: false"
+	if d.String() != expected {
+		t.Errorf("Unexpected string: %s", d)
+	}
+
+	if e, ok := d.Find(0x00070002); !ok || binary.LittleEndian.Uint64(e.Data) != 4096 {
+		t.Errorf("Find failed")
+	}
+	if _, ok := d.Find(0x00050001); ok {
+		t.Errorf("Find returned an event that doesn't exist")
+	}
+
+	event, _ = decodeEventData(13, EventTypeEventTag, data.Bytes(), &LogOptions{}, false)
+	if _, ok := event.(*SIPAEventData); ok {
+		t.Errorf("SIPA events should only be decoded when enabled")
+	}
+}
+
+func TestDecodeEventDataSIPAInvalidSize(t *testing.T) {
+	data := encodeTestSIPAEvent(0x40010003, encodeTestSIPAEvent(0x00070001, []byte{1, 2}))
+	binary.LittleEndian.PutUint32(data[12:], 100)
+
+	event, _ := decodeEventData(13, EventTypeEventTag, data, &LogOptions{EnableWindowsSIPA: true}, false)
+	if _, ok := event.(*BrokenEventData); !ok {
+		t.Errorf("Unexpected event data type: %T", event)
+	}
+}